@@ -0,0 +1,75 @@
+package atkmod
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// The well-known annotations of a module. Other tools can add annotations
+// with their own keys, which are kept as they are.
+const (
+	// AnnotationDocsURL is the URL of the documentation of the module.
+	AnnotationDocsURL = "itzcli/docs-url"
+	// AnnotationOwner is the team or person that owns the module.
+	AnnotationOwner = "itzcli/owner"
+	// AnnotationSupportContact is who to contact for help with the module,
+	// such as an email address or a Slack channel.
+	AnnotationSupportContact = "itzcli/support-contact"
+)
+
+// Annotation returns the value of the annotation, or an empty string if the
+// module does not have it.
+func (m MetadataInfo) Annotation(key string) string {
+	return m.Annotations[key]
+}
+
+// SetAnnotation sets the value of the annotation.
+func (m *MetadataInfo) SetAnnotation(key string, value string) {
+	if m.Annotations == nil {
+		m.Annotations = make(map[string]string)
+	}
+	m.Annotations[key] = value
+}
+
+// DocsURL returns the value of the AnnotationDocsURL annotation.
+func (m MetadataInfo) DocsURL() string {
+	return m.Annotation(AnnotationDocsURL)
+}
+
+// Owner returns the value of the AnnotationOwner annotation.
+func (m MetadataInfo) Owner() string {
+	return m.Annotation(AnnotationOwner)
+}
+
+// SupportContact returns the value of the AnnotationSupportContact
+// annotation.
+func (m MetadataInfo) SupportContact() string {
+	return m.Annotation(AnnotationSupportContact)
+}
+
+// checkAnnotations returns the findings for the well-known annotations that
+// have invalid values.
+func checkAnnotations(m *ModuleInfo) []Finding {
+	var findings []Finding
+	keys := make([]string, 0, len(m.Metadata.Annotations))
+	for key := range m.Metadata.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if len(key) == 0 {
+			findings = append(findings, Finding{Path: "metadata.annotations", Message: "annotation keys cannot be empty"})
+		}
+	}
+	if docs := m.Metadata.DocsURL(); len(docs) > 0 {
+		u, err := url.Parse(docs)
+		if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+			findings = append(findings, Finding{
+				Path:    fmt.Sprintf("metadata.annotations[%s]", AnnotationDocsURL),
+				Message: fmt.Sprintf("%q is not an http or https URL", docs),
+			})
+		}
+	}
+	return findings
+}
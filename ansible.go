@@ -0,0 +1,110 @@
+package atkmod
+
+import "path"
+
+const (
+	// DefaultAnsibleRunnerImage is the ansible-runner image used by
+	// NewAnsibleStage when no other image is given.
+	DefaultAnsibleRunnerImage = "quay.io/ansible/ansible-runner:latest"
+	// AnsibleRunnerDir is the private data directory of ansible-runner in
+	// the container, where the workspace is mounted. The playbooks are in
+	// its project directory and the inventory in its inventory directory.
+	AnsibleRunnerDir = "/runner"
+)
+
+// AnsibleStage has the settings of an ansible-runner stage that is created
+// with NewAnsibleStage.
+type AnsibleStage struct {
+	// Image is the ansible-runner image, DefaultAnsibleRunnerImage if empty.
+	Image string
+	// Workspace is the local directory that is mounted as the private data
+	// directory of ansible-runner and as the workspace of the stage,
+	// DefaultScaffoldWorkspace if empty.
+	Workspace string
+	// Inventory is the inventory file or directory, relative to the
+	// workspace. If empty, ansible-runner uses the inventory directory.
+	Inventory string
+	// EnvVars are added to the standard environment of the stage.
+	EnvVars []EnvVarInfo
+}
+
+// AnsibleStageOption configures optional settings of NewAnsibleStage.
+type AnsibleStageOption func(*AnsibleStage)
+
+// WithAnsibleImage runs the playbook with the given ansible-runner image.
+func WithAnsibleImage(image string) AnsibleStageOption {
+	return func(s *AnsibleStage) {
+		s.Image = image
+	}
+}
+
+// WithAnsibleWorkspace mounts the local directory as the workspace.
+func WithAnsibleWorkspace(dir string) AnsibleStageOption {
+	return func(s *AnsibleStage) {
+		s.Workspace = dir
+	}
+}
+
+// WithAnsibleInventory uses the inventory at the path, which is relative to
+// the workspace, such as inventory/hosts.yaml.
+func WithAnsibleInventory(inventory string) AnsibleStageOption {
+	return func(s *AnsibleStage) {
+		s.Inventory = inventory
+	}
+}
+
+// WithAnsibleEnv adds the environment variable to the stage, such as an
+// ANSIBLE_ setting. It takes precedence over the standard environment.
+func WithAnsibleEnv(name string, value string) AnsibleStageOption {
+	return func(s *AnsibleStage) {
+		s.EnvVars = append(s.EnvVars, EnvVarInfo{Name: name, Value: value})
+	}
+}
+
+// NewAnsibleStage creates a hook or lifecycle stage that runs the playbook
+// with ansible-runner, so that a module based on Ansible only has to name
+// its playbook. The playbook is relative to the project directory of the
+// workspace, as ansible-runner expects, such as site.yml for
+// <workspace>/project/site.yml. The workspace is mounted both as the private
+// data directory of ansible-runner and at /workspace, and the stage has the
+// standard environment of a non-interactive run, such as no host key
+// checking and no retry files.
+func NewAnsibleStage(playbook string, opts ...AnsibleStageOption) ImageInfo {
+	s := &AnsibleStage{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	workspace := Iif(s.Workspace, DefaultScaffoldWorkspace)
+	env := []EnvVarInfo{
+		{Name: "RUNNER_PLAYBOOK", Value: playbook},
+		{Name: "ANSIBLE_HOST_KEY_CHECKING", Value: "False"},
+		{Name: "ANSIBLE_RETRY_FILES_ENABLED", Value: "False"},
+		{Name: "ANSIBLE_NOCOLOR", Value: "True"},
+	}
+	if len(s.Inventory) > 0 {
+		env = append(env, EnvVarInfo{Name: "ANSIBLE_INVENTORY", Value: path.Join(AnsibleRunnerDir, s.Inventory)})
+	}
+	for _, e := range s.EnvVars {
+		env = setEnvVar(env, e)
+	}
+	return ImageInfo{
+		Image:   Iif(s.Image, DefaultAnsibleRunnerImage),
+		EnvVars: env,
+		Volumes: []VolumeInfo{
+			{Name: workspace, MountPath: AnsibleRunnerDir},
+			{Name: workspace, MountPath: "/workspace"},
+		},
+	}
+}
+
+// setEnvVar replaces the value of the environment variable with the same
+// name, or else adds it.
+func setEnvVar(env []EnvVarInfo, e EnvVarInfo) []EnvVarInfo {
+	for idx := range env {
+		if env[idx].Name == e.Name {
+			env[idx].Value = e.Value
+			return env
+		}
+	}
+	return append(env, e)
+}
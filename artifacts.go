@@ -0,0 +1,160 @@
+package atkmod
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Artifact is a file that a lifecycle stage produced in its workspace,
+// which was copied to the artifacts directory of the deployment.
+type Artifact struct {
+	State State `json:"state" yaml:"state"`
+	// Path is the path of the file in the workspace, relative to
+	// /workspace.
+	Path string `json:"path" yaml:"path"`
+	// File is the local path of the copy.
+	File string `json:"file" yaml:"file"`
+	Size int64  `json:"size" yaml:"size"`
+}
+
+// DefaultArtifactsDir returns the directory that the artifacts are copied to
+// when no other directory is given, which is in the user's cache directory.
+func DefaultArtifactsDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "atk", "artifacts"), nil
+}
+
+// WithArtifactsDir copies the artifacts of the stages to the given directory
+// instead of DefaultArtifactsDir. The artifacts of a deployment are in
+// <namespace>/<module>/<run ID>/<state> under it.
+func WithArtifactsDir(dir string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.artifactsDir = dir
+	}
+}
+
+// Artifacts returns the artifacts that the stages of the last deployment
+// produced, in the order that they were collected.
+func (m *DeployableModule) Artifacts() []Artifact {
+	m.stageMu.Lock()
+	defer m.stageMu.Unlock()
+	return append([]Artifact(nil), m.artifacts...)
+}
+
+// artifactPattern returns the pattern relative to /workspace, or an error if
+// it is not a valid pattern under /workspace.
+func artifactPattern(pattern string) (string, error) {
+	p := path.Clean(strings.TrimPrefix(pattern, "/workspace/"))
+	if len(pattern) == 0 || path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("artifact %q is not under /workspace", pattern)
+	}
+	if _, err := path.Match(p, ""); err != nil {
+		return "", fmt.Errorf("invalid artifact pattern %q", pattern)
+	}
+	return p, nil
+}
+
+// stageWorkspace returns the local directory that is mounted as the
+// workspace of the stage, if any.
+func (m *DeployableModule) stageWorkspace(info ImageInfo) string {
+	for _, v := range info.Volumes {
+		if v.MountPath == "/workspace" {
+			if abs, err := filepath.Abs(v.Name); err == nil {
+				return abs
+			}
+			return v.Name
+		}
+	}
+	if len(m.workspaceRoot) > 0 {
+		if dir, err := ModuleWorkspace(m.workspaceRoot, m.module); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// collectArtifacts copies the files in the workspace of the stage that match
+// its artifacts to the artifacts directory. The artifacts are collected
+// whether the stage succeeded or not, so that its logs can be found, and the
+// files that cannot be copied are only logged.
+func (m *DeployableModule) collectArtifacts(ctx *RunContext, state State, info ImageInfo) {
+	if len(info.Artifacts) == 0 {
+		return
+	}
+	log := ctx.Log.WithField(RunIDLogField, m.runID)
+	workspace := m.stageWorkspace(info)
+	if len(workspace) == 0 {
+		log.Warnf("the artifacts of stage %s were not collected because it has no workspace", state)
+		return
+	}
+	root := m.artifactsDir
+	if len(root) == 0 {
+		var err error
+		if root, err = DefaultArtifactsDir(); err != nil {
+			log.Warnf("the artifacts of stage %s were not collected: %v", state, err)
+			return
+		}
+	}
+	dest := filepath.Join(root, namespaceOf(m.module), m.module.Metadata.Name, m.runID, string(state))
+	copied := make(map[string]bool)
+	for _, pattern := range info.Artifacts {
+		p, err := artifactPattern(pattern)
+		if err != nil {
+			log.Warn(err.Error())
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(workspace, filepath.FromSlash(p)))
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(file string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() || copied[file] {
+					return err
+				}
+				copied[file] = true
+				rel, err := filepath.Rel(workspace, file)
+				if err != nil {
+					return err
+				}
+				target := filepath.Join(dest, rel)
+				size, err := copyArtifact(file, target)
+				if err != nil {
+					return err
+				}
+				m.stageMu.Lock()
+				m.artifacts = append(m.artifacts, Artifact{State: state, Path: filepath.ToSlash(rel), File: target, Size: size})
+				m.stageMu.Unlock()
+				return nil
+			})
+			if err != nil {
+				log.Warnf("could not collect the artifact %s of stage %s: %v", match, state, err)
+			}
+		}
+	}
+}
+
+func copyArtifact(from string, to string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return 0, err
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return size, err
+}
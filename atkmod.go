@@ -7,15 +7,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
+	"github.com/cloud-native-toolkit/atkmod/fsm"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
 	logger "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
 )
 
 type AtkContextKey string
@@ -37,6 +40,7 @@ const (
 	PreDeployLifecycleRequestEvent  ModuleEventType = "com.ibm.techzone.cli.lifecycle.pre_deploy.request"
 	DeployLifecycleRequestEvent     ModuleEventType = "com.ibm.techzone.cli.lifecycle.deploy.request"
 	PostDeployLifecycleRequestEvent ModuleEventType = "com.ibm.techzone.cli.lifecycle.post_deploy.request"
+	StateChangedEvent               ModuleEventType = "com.ibm.techzone.cli.lifecycle.state_changed"
 	LoggerContextKey                AtkContextKey   = "atk.logger"
 	StdOutContextKey                AtkContextKey   = "atk.stdout"
 	StdErrContextKey                AtkContextKey   = "atk.stderr"
@@ -44,6 +48,22 @@ const (
 	ListHook                        Hook            = "list"
 	ValidateHook                    Hook            = "validate"
 	GetStateHook                    Hook            = "get_state"
+
+	// RunIDEnvVar is the environment variable that has the run ID of the
+	// deployment in all of the containers.
+	RunIDEnvVar = "ATK_RUN_ID"
+	// RunIDLabel is the label that has the run ID of the deployment on the
+	// resources that a deployment creates, such as its volumes, so that
+	// Undo removes them.
+	RunIDLabel = "atk.runId"
+	// RunIDExtension is the CloudEvents extension that has the run ID of the
+	// deployment on all of the request events.
+	RunIDExtension = "atkrunid"
+	// RunIDLogField is the log field that has the run ID of the deployment.
+	RunIDLogField = "runId"
+	// StageLogField is the log field that has the stage of a context that
+	// was derived with Child.
+	StageLogField = "stage"
 )
 
 var (
@@ -55,6 +75,23 @@ type EventDataVarInfo struct {
 	Value       string `json:"value,omitempty" yaml:"value,omitempty"`
 	Default     string `json:"default,omitempty" yaml:"default,omitempty"`
 	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Sensitive variables, such as passwords, have their values masked in
+	// the logs. See IsSensitiveVariable.
+	Sensitive bool `json:"sensitive,omitempty" yaml:"sensitive,omitempty"`
+	// Options are the values that the variable can have, if it can only
+	// have some, such as the regions of a cloud. They are offered by
+	// Complete.
+	Options []string `json:"options,omitempty" yaml:"options,omitempty"`
+	// Type is the type of the value, a string if it is empty. A password is
+	// always sensitive.
+	Type VariableType `json:"type,omitempty" yaml:"type,omitempty"`
+	// Required variables must have a value or a default.
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+	// Pattern is a regular expression that the whole value must match.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// DefaultFrom is where the default is read from on the host when the
+	// variable has none, such as kubectl.context. See DefaultSources.
+	DefaultFrom string `json:"defaultFrom,omitempty" yaml:"defaultFrom,omitempty"`
 }
 
 type EventData struct {
@@ -64,6 +101,11 @@ type EventData struct {
 type EnvVarInfo struct {
 	Name  string `json:"name" yaml:"name"`
 	Value string `json:"value" yaml:"value"`
+	// Secret passes the value to podman in its environment, with -e NAME,
+	// even without PassEnv, so that it is never on the command line, where
+	// it would show in the logs and the process listings. It is set by the
+	// options that add credentials, not by the manifests.
+	Secret bool `json:"-" yaml:"-"`
 }
 
 func (e *EnvVarInfo) String() string {
@@ -82,28 +124,66 @@ type ImageInfo struct {
 	Args    []string     `json:"args" yaml:"args"`
 	EnvVars []EnvVarInfo `json:"env" yaml:"env"`
 	Volumes []VolumeInfo `json:"volumeMounts" yaml:"volumeMounts"`
+	// Scanners are matched against the output of the stage while it runs.
+	Scanners []ScannerInfo `json:"scanners,omitempty" yaml:"scanners,omitempty"`
+	// InheritEnv are the names of the environment variables of the host that
+	// are passed to the stage, such as HTTPS_PROXY, as patterns like
+	// TF_* or * for all of them. None are passed if it is empty.
+	InheritEnv []string `json:"inheritEnv,omitempty" yaml:"inheritEnv,omitempty"`
+	// Sandbox relaxes the hardened defaults of a hook, such as to give it a
+	// network. It is ignored for the lifecycle stages.
+	Sandbox *SandboxInfo `json:"sandbox,omitempty" yaml:"sandbox,omitempty"`
+	// Artifacts are the files that a lifecycle stage produces, as patterns
+	// under /workspace such as out/*.log or /workspace/kubeconfig, which are
+	// copied to the artifacts directory after the stage. See
+	// WithArtifactsDir.
+	Artifacts []string `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
 }
 
 type HookInfo struct {
 	GetState ImageInfo `json:"get_state" yaml:"get_state"`
 	List     ImageInfo `json:"list" yaml:"list"`
 	Validate ImageInfo `json:"validate" yaml:"validate"`
+	// Info is the optional hook that is run first, to learn the
+	// capabilities of the other hooks. See Handshake.
+	Info ImageInfo `json:"info,omitempty" yaml:"info,omitempty"`
 }
 
 type MetadataInfo struct {
 	Name      string            `json:"name" yaml:"name"`
 	Namespace string            `json:"namespace" yaml:"namespace"`
 	Labels    map[string]string `json:"labels" yaml:"labels"`
+	// Generation is incremented by the author each time the manifest
+	// changes. It is reported as the observed generation by Status.
+	Generation int64 `json:"generation,omitempty" yaml:"generation,omitempty"`
+	// Annotations are arbitrary metadata for other tools, which are kept as
+	// they are. See AnnotationDocsURL for the well-known keys.
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	// DependsOn are the names of the other modules of a DeploymentPlan that
+	// must be deployed before this one.
+	DependsOn []string `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
 }
 type LifecycleInfo struct {
 	PreDeploy  ImageInfo `json:"pre_deploy" yaml:"pre_deploy"`
 	Deploy     ImageInfo `json:"deploy" yaml:"deploy"`
 	PostDeploy ImageInfo `json:"post_deploy" yaml:"post_deploy"`
+	// OnCancel is run when the deployment is cancelled, to clean up after
+	// the stage that was stopped.
+	OnCancel ImageInfo `json:"on_cancel,omitempty" yaml:"on_cancel,omitempty"`
 }
 
 type SpecInfo struct {
 	Hooks     HookInfo      `json:"hooks" yaml:"hooks"`
 	Lifecycle LifecycleInfo `json:"lifecycle" yaml:"lifecycle"`
+	// Readiness, if set, is checked after the deploy stage and the module
+	// only moves to Deployed once it is ready.
+	Readiness *ReadinessInfo `json:"readiness,omitempty" yaml:"readiness,omitempty"`
+	// Requires, if set, is what the host needs to deploy the module, which
+	// is checked by Preflight.
+	Requires *RequiresInfo `json:"requires,omitempty" yaml:"requires,omitempty"`
+	// Includes are the other module manifests that are deployed before the
+	// lifecycle stages of the module. See LoadIncludes and WithIncludes.
+	Includes []IncludeInfo `json:"includes,omitempty" yaml:"includes,omitempty"`
 }
 
 type ApiVersion struct {
@@ -159,19 +239,62 @@ func (m *ModuleInfo) IsSupported() bool {
 	return m.IsSupportedKind() && m.IsSupportedVersion()
 }
 
-// CliParts represents the parts of the entire podman command line.
+// PortMap maps a port of the host to a port of the container.
+type PortMap struct {
+	// Local is the port on the host, which may have the address to bind
+	// to, such as 127.0.0.1:8080.
+	Local     string
+	Container string
+}
+
+func (p PortMap) String() string {
+	return p.Local + ":" + p.Container
+}
+
+// CliParts represents the parts of the entire podman command line. The
+// collections are in the order that they were added in, unless Canonical is
+// set.
 type CliParts struct {
-	Path             string
+	Path string
+	// Cmd is the podman command, such as run, which may have several words
+	// and its own options, such as ps --format "{{.Image}}". It is split
+	// into arguments as a POSIX shell would.
 	Cmd              string
 	Image            string
 	Flags            []string
 	Workdir          string
 	VolumeMaps       []string
 	DefaultVolumeOpt string
-	Ports            map[string]string
+	Ports            []PortMap
 	UidMaps          []string
 	Envvars          []EnvVarInfo
-	// TODO: Add command support that will be used instead of an entrypoint
+	// Canonical sorts the port maps, the uid maps, the volumes and the
+	// environment variables of the command line, so that it does not depend
+	// on the order that they were added in, such as for golden tests. The
+	// flags and the commands keep their order, which matters to podman.
+	Canonical bool
+	// PassEnv passes the values of the environment variables to podman in
+	// its own environment, with -e NAME, instead of on the command line, so
+	// that they do not show in the process listings, the shell history or
+	// the logs of the command. See WithPassEnv.
+	PassEnv bool
+	// Interactive keeps stdin of the container open, so the input of the
+	// RunContext is sent to the container.
+	Interactive bool
+	// Connection is the podman system connection that runs the command,
+	// which is passed to podman with --connection. If empty, podman uses
+	// its active connection.
+	Connection string
+	// Platform is the platform of the host, which decides how the local
+	// paths of the volumes are translated. If empty, the platform of this
+	// host is used.
+	Platform HostPlatform
+	// Entrypoint overrides the entrypoint of the image, with --entrypoint.
+	// It is the first element of the Command of the ImageInfo.
+	Entrypoint string
+	// Commands are the arguments that are passed to the container after the
+	// image, which are the rest of the Command and the Args of the
+	// ImageInfo.
 	Commands []string
 }
 
@@ -189,6 +312,22 @@ func (b *PodmanCliCommandBuilder) WithPath(path string) *PodmanCliCommandBuilder
 	return b
 }
 
+// WithConnection runs the command on the podman system connection with the
+// given name, such as a podman machine or a remote socket.
+func (b *PodmanCliCommandBuilder) WithConnection(name string) *PodmanCliCommandBuilder {
+	b.parts.Connection = name
+	return b
+}
+
+// globalArgs returns the path of podman and the global flags that come
+// before the command, for the commands that are not built with Build.
+func (b *PodmanCliCommandBuilder) globalArgs() (string, []string) {
+	if len(b.parts.Connection) == 0 {
+		return b.parts.Path, nil
+	}
+	return b.parts.Path, []string{"--connection", b.parts.Connection}
+}
+
 // WithImage specifies the container image used in the command.
 func (b *PodmanCliCommandBuilder) WithImage(imageName string) *PodmanCliCommandBuilder {
 	b.parts.Image = imageName
@@ -201,7 +340,15 @@ func (b *PodmanCliCommandBuilder) WithWorkspace(localdir string) *PodmanCliComma
 	return b.WithVolume(localdir, b.parts.Workdir)
 }
 
-// WithVolume adds a volume mapping to the command.
+// WithPlatform sets the platform of the host, which decides how the local
+// paths of the volumes are translated for the podman machine.
+func (b *PodmanCliCommandBuilder) WithPlatform(platform HostPlatform) *PodmanCliCommandBuilder {
+	b.parts.Platform = platform
+	return b
+}
+
+// WithVolume adds a volume mapping to the command. The local directory is
+// translated with MachinePath for the platform of the host.
 func (b *PodmanCliCommandBuilder) WithVolume(localdir string, containerdir string) *PodmanCliCommandBuilder {
 	return b.WithVolumeOpt(localdir, containerdir, "")
 }
@@ -209,6 +356,7 @@ func (b *PodmanCliCommandBuilder) WithVolume(localdir string, containerdir strin
 // WithVolume adds a volume mapping to the command.
 func (b *PodmanCliCommandBuilder) WithVolumeOpt(localdir string, containerdir string, option string) *PodmanCliCommandBuilder {
 	var volMap string
+	localdir = MachinePath(b.parts.Platform, localdir)
 	if len(option) > 0 {
 		volMap = fmt.Sprintf("%s:%s:%s", localdir, containerdir, option)
 	} else {
@@ -224,9 +372,24 @@ func (b *PodmanCliCommandBuilder) WithUserMap(localUser int, containerUser int,
 	return b
 }
 
-// WithPort adds a port mapping to the command
+// WithPort adds a port mapping to the command. A port of the host that is
+// bound more than once is a conflict that Build reports.
 func (b *PodmanCliCommandBuilder) WithPort(localport string, containerport string) *PodmanCliCommandBuilder {
-	b.parts.Ports[localport] = containerport
+	b.parts.Ports = append(b.parts.Ports, PortMap{Local: localport, Container: containerport})
+	return b
+}
+
+// WithCanonicalOrder sorts the collections of the command line, as
+// CliParts.Canonical does.
+func (b *PodmanCliCommandBuilder) WithCanonicalOrder() *PodmanCliCommandBuilder {
+	b.parts.Canonical = true
+	return b
+}
+
+// WithFlags adds the given flags to the command, after the command and
+// before any of the other options.
+func (b *PodmanCliCommandBuilder) WithFlags(flags ...string) *PodmanCliCommandBuilder {
+	b.parts.Flags = append(b.parts.Flags, flags...)
 	return b
 }
 
@@ -242,34 +405,137 @@ func (b *PodmanCliCommandBuilder) WithEnvvar(name string, value string) *PodmanC
 	return b
 }
 
-// Build builds the command line for the container command
+// cliTemplate is the template of the command line, which is parsed once
+// rather than on each Build. It is hardcoded here, so if it does not parse
+// properly, we want the developer to know right away.
+var cliTemplate = template.Must(template.New("cli").Funcs(template.FuncMap{"passEnv": (*CliParts).passEnv, "quote": shellQuote}).Parse("{{quote .Path}}{{if .Connection}} --connection {{quote .Connection}}{{end}} {{.Cmd}}{{- range .Flags}} {{quote .}}{{end}}{{- range .UidMaps}} --uidmap {{quote .}}{{end}}{{- range .VolumeMaps}} -v {{quote .}}{{end}}{{- range .Ports}} -p {{quote .String}}{{end}}{{range .Envvars}} -e {{if passEnv $ .}}{{quote .Name}}{{else}}{{quote .String}}{{end}}{{end}}{{if .Entrypoint}} --entrypoint {{quote .Entrypoint}}{{end}}{{if .Image}} {{quote .Image}}{{end}}{{range .Commands}} {{quote .}}{{end}}"))
+
+// buildBuffers are the buffers that Build writes the command line to, which
+// are reused across the builds.
+var buildBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// Build builds the command line for the container command, with the values
+// quoted for a POSIX shell where needed, so that it can be copied and run.
+// It returns a *CliPartsError if the environment variables, the volumes or
+// the port maps conflict; see Validate for the rest of the problems.
 func (b *PodmanCliCommandBuilder) Build() (string, error) {
-	buf := new(bytes.Buffer)
-	tmpl, err := template.New("cli").Parse("{{.Path}} {{.Cmd}}{{- range .Flags}} {{.}}{{end}}{{- range .UidMaps}} --uidmap {{.}}{{end}}{{- range .VolumeMaps}} -v {{.}}{{end}}{{- range $k,$v := .Ports}} -p {{$k}}:{{$v}}{{end}}{{range .Envvars}} -e {{.}}{{end}}{{if .Image}} {{.Image}}{{end}}")
-	if err != nil {
-		// This template is hardcoded here, so if it does not parse properly,
-		// we want the developer to know write away.
-		panic(err)
+	if err := b.parts.conflicts(); err != nil {
+		return "", err
+	}
+	buf := buildBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer buildBuffers.Put(buf)
+	if err := cliTemplate.Execute(buf, b.parts.ordered()); err != nil {
+		return "", err
 	}
-	tmpl.Execute(buf, b.parts)
 	return strings.TrimSpace(buf.String()), nil
 }
 
+// BuildArgs builds the arguments of the container command, starting with the
+// path of podman, in the same order as Build but without formatting them as
+// a command line, so that the values with spaces are kept whole. It is what
+// the runner executes.
+func (b *PodmanCliCommandBuilder) BuildArgs() []string {
+	p := b.parts.ordered()
+	args := make([]string, 0, 6+len(p.Flags)+2*(len(p.UidMaps)+len(p.VolumeMaps)+len(p.Ports)+len(p.Envvars))+len(p.Commands))
+	args = append(args, p.Path)
+	if len(p.Connection) > 0 {
+		args = append(args, "--connection", p.Connection)
+	}
+	args = append(args, shellSplit(p.Cmd)...)
+	args = append(args, p.Flags...)
+	for _, m := range p.UidMaps {
+		args = append(args, "--uidmap", m)
+	}
+	for _, v := range p.VolumeMaps {
+		args = append(args, "-v", v)
+	}
+	for _, port := range p.Ports {
+		args = append(args, "-p", port.String())
+	}
+	for _, e := range p.Envvars {
+		if p.passEnv(e) {
+			args = append(args, "-e", e.Name)
+		} else {
+			args = append(args, "-e", e.Name+"="+e.Value)
+		}
+	}
+	if len(p.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", p.Entrypoint)
+	}
+	if len(p.Image) > 0 {
+		args = append(args, p.Image)
+	}
+	return append(args, p.Commands...)
+}
+
 func (b *PodmanCliCommandBuilder) BuildFrom(info ImageInfo) (string, error) {
-	// TODO: this should go away once this is supported, but for now we want
-	// to make sure we tell the user.
-	if len(info.Command) > 0 {
-		return "", errors.New("command is not yet supported")
+	if err := b.withImageInfo(info); err != nil {
+		return "", err
+	}
+	return b.Build()
+}
+
+// BuildArgsFrom builds the arguments of the container command for the image,
+// as BuildFrom does, with BuildArgs. Like Build, it returns a *CliPartsError
+// if the parts conflict.
+func (b *PodmanCliCommandBuilder) BuildArgsFrom(info ImageInfo) ([]string, error) {
+	if err := b.withImageInfo(info); err != nil {
+		return nil, err
+	}
+	if err := b.parts.conflicts(); err != nil {
+		return nil, err
 	}
+	return b.BuildArgs(), nil
+}
 
+// withImageInfo adds the image, its command, its arguments, its environment
+// variables and its volumes to the command. As with the LocalModuleRunner,
+// the first element of the Command is the executable, which replaces the
+// entrypoint of the image, and the rest of it comes before the Args.
+func (b *PodmanCliCommandBuilder) withImageInfo(info ImageInfo) error {
 	b.WithImage(info.Image)
-	for _, envvar := range info.EnvVars {
-		b.WithEnvvar(envvar.Name, envvar.Value)
+	if len(info.Command) > 0 {
+		b.parts.Entrypoint = info.Command[0]
+		b.parts.Commands = append(b.parts.Commands, info.Command[1:]...)
 	}
+	b.parts.Commands = append(b.parts.Commands, info.Args...)
+	b.parts.Envvars = append(b.parts.Envvars, info.EnvVars...)
 	for _, v := range info.Volumes {
 		b.WithVolume(v.Name, v.MountPath)
 	}
-	return b.Build()
+	return nil
+}
+
+// ordered returns the parts in the order of the command line, which is a
+// sorted copy if they are Canonical.
+func (p *CliParts) ordered() *CliParts {
+	if !p.Canonical {
+		return p
+	}
+	c := *p
+	c.Ports = append([]PortMap(nil), p.Ports...)
+	sort.SliceStable(c.Ports, func(i, j int) bool { return c.Ports[i].Local < c.Ports[j].Local })
+	c.UidMaps = append([]string(nil), p.UidMaps...)
+	sort.Strings(c.UidMaps)
+	c.VolumeMaps = append([]string(nil), p.VolumeMaps...)
+	sort.Strings(c.VolumeMaps)
+	c.Envvars = append([]EnvVarInfo(nil), p.Envvars...)
+	sort.SliceStable(c.Envvars, func(i, j int) bool { return c.Envvars[i].Name < c.Envvars[j].Name })
+	return &c
+}
+
+// clone returns a copy of the builder that can be modified without changing
+// this builder.
+func (b *PodmanCliCommandBuilder) clone() *PodmanCliCommandBuilder {
+	parts := b.parts
+	parts.Flags = append([]string(nil), b.parts.Flags...)
+	parts.VolumeMaps = append([]string(nil), b.parts.VolumeMaps...)
+	parts.UidMaps = append([]string(nil), b.parts.UidMaps...)
+	parts.Envvars = append([]EnvVarInfo(nil), b.parts.Envvars...)
+	parts.Commands = append([]string(nil), b.parts.Commands...)
+	parts.Ports = append([]PortMap(nil), b.parts.Ports...)
+	return &PodmanCliCommandBuilder{parts: parts}
 }
 
 // NewPodmanCliCommandBuilder creates a new PodmanCliCommandBuilder
@@ -280,19 +546,28 @@ func NewPodmanCliCommandBuilder(cli *CliParts) *PodmanCliCommandBuilder {
 	defaults := cli
 	if defaults == nil {
 		defaults = &CliParts{}
-		defaults.Path = os.Getenv("ITZ_PODMAN_PATH")
+		defaults.Path = DefaultConfig().PodmanPath
+		defaults.Connection = DefaultConfig().PodmanConnection
 	}
 	defaultFlags := make([]string, 0)
 	parts := &CliParts{
-		Path:             Iif(defaults.Path, "/usr/local/bin/podman"),
+		Path:             Iif(defaults.Path, DefaultPodmanPath),
 		Cmd:              Iif(defaults.Cmd, "run"),
 		Workdir:          Iif(defaults.Workdir, "/workspace"),
 		Flags:            append(defaults.Flags, defaultFlags...),
 		Envvars:          defaults.Envvars,
 		DefaultVolumeOpt: "Z",
 		VolumeMaps:       make([]string, 0),
-		Ports:            make(map[string]string, 0),
+		Ports:            make([]PortMap, 0),
 		UidMaps:          make([]string, 0),
+		Interactive:      defaults.Interactive,
+		Connection:       defaults.Connection,
+		Platform:         defaults.Platform,
+		Canonical:        defaults.Canonical,
+		PassEnv:          defaults.PassEnv,
+	}
+	if len(parts.Platform) == 0 {
+		parts.Platform = CurrentHostPlatform()
 	}
 	return &PodmanCliCommandBuilder{
 		parts: *parts,
@@ -314,6 +589,51 @@ type RunContext struct {
 	Err         io.Writer
 	Errors      []error
 	LastErrCode int
+	// RunID is the run ID of the deployment that is running an image with
+	// this context, which is added to the log entries of the runners.
+	RunID string
+	// JSONLog, if set, receives a JSON line for each stage of a deployment
+	// and for each command that is run, as JSONLogRecord values.
+	JSONLog io.Writer
+	// Stage is the name of the stage that the context was derived for with
+	// Child, which is added to the log entries.
+	Stage string
+	// Verbosity controls whether the commands that are run and the output of
+	// the lifecycle stages reach the streams of the context.
+	Verbosity Verbosity
+	// ShowPullProgress writes the progress of podman pulling the images to
+	// the error stream, which is filtered out below VerbosityDebug.
+	ShowPullProgress bool
+
+	mu       sync.Mutex
+	children []*RunContext
+	stdout   *tailBuffer
+	stderr   *tailBuffer
+	masked   []string
+	command  []string
+}
+
+// Logger returns the log entry used to log with this context, which has the
+// run ID as a field if there is one. If the context has no logger, the one
+// set on its Context with WithLogger is used, or else the standard logger of
+// logrus, so that a RunContext that was not created with NewRunContext can
+// still log.
+func (c *RunContext) Logger() *logger.Entry {
+	l := &c.Log
+	if !c.hasLogger() {
+		l = LoggerFrom(c.Context)
+		if l == nil {
+			l = logger.StandardLogger()
+		}
+	}
+	entry := logger.NewEntry(l)
+	if len(c.RunID) > 0 {
+		entry = entry.WithField(RunIDLogField, c.RunID)
+	}
+	if len(c.Stage) > 0 {
+		entry = entry.WithField(StageLogField, c.Stage)
+	}
+	return entry
 }
 
 // AddError adds an error to the context
@@ -332,53 +652,176 @@ func (c *RunContext) SetLastErrCode(errCode int) {
 	c.LastErrCode = errCode
 }
 
-// IsErrored returns true if there are errors in the context
+// IsErrored returns true if there are errors in the context or in any of the
+// contexts derived from it with Child.
 func (c *RunContext) IsErrored() bool {
-	return len(c.Errors) > 0 || c.LastErrCode != 0
+	if len(c.Errors) > 0 || c.LastErrCode != 0 {
+		return true
+	}
+	for _, child := range c.Children() {
+		if child.IsErrored() {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageRunner runs the container (or equivalent) that is defined in an
+// ImageInfo using the given context. The CliModuleRunner is the default
+// implementation, but other implementations can be provided to the
+// DeployableModule using WithRunner.
+type ImageRunner interface {
+	RunImage(ctx *RunContext, info ImageInfo) error
 }
 
 type CliModuleRunner struct {
 	PodmanCliCommandBuilder
+	// Pull, if set, pulls the image with retries before it is run. See
+	// PullOptions.
+	Pull *PullOptions
+	// HelperImage is the image of the helper containers of the runner,
+	// DefaultHelperImage if empty.
+	HelperImage string
+}
+
+// runCmd runs the command with the environment variables added to the
+// environment of the process.
+func (r *CliModuleRunner) runCmd(ctx *RunContext, args []string, env []string) error {
+	ctx.logCommand("running command: %s", shellJoin(args))
+	cmd := exec.Command(args[0], args[1:]...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return execCmd(ctx, cmd)
 }
 
-func (r *CliModuleRunner) runCmd(ctx *RunContext, cmd string) error {
-	ctx.Log.Infof("running command: %s", cmd)
-	cmdParts := strings.Split(cmd, " ")
-	runCmd := exec.Command(cmdParts[0], cmdParts[1:]...)
+// execCmd runs the given command using the in, out and err streams of the
+// context, recording the exit code and any error on the context. The command
+// is killed if the context of the RunContext is done before it exits.
+func execCmd(ctx *RunContext, runCmd *exec.Cmd) error {
+	errOut, flush := ctx.errWriter()
+	defer flush()
 	runCmd.Stdout = ctx.Out
-	runCmd.Stderr = ctx.Err
+	runCmd.Stderr = errOut
 	runCmd.Stdin = ctx.In
-	err := runCmd.Run()
+
+	command := ctx.maskAll(runCmd.Args)
+	var stdout, stderr *headBuffer
+	if ctx.JSONLog != nil {
+		stdout = &headBuffer{limit: MaxJSONLogOutput}
+		stderr = &headBuffer{limit: MaxJSONLogOutput}
+		runCmd.Stdout = teeWriter(ctx.Out, stdout)
+		runCmd.Stderr = teeWriter(errOut, stderr)
+		writeJSONLog(ctx, JSONLogRecord{Type: CommandRecord, Command: command})
+	}
+
+	ctx.setCommand(command)
+	started := time.Now()
+	err := runCmd.Start()
+	if err == nil {
+		stop := killOnDone(ctx.Context, runCmd)
+		err = runCmd.Wait()
+		stop()
+	}
+	exitCode := 0
 	if err != nil {
+		exitCode = -1
 		if exiterr, ok := err.(*exec.ExitError); ok {
-			ctx.SetLastErrCode(exiterr.ExitCode())
+			exitCode = exiterr.ExitCode()
+			ctx.SetLastErrCode(exitCode)
 		}
 		ctx.AddError(err)
 	}
+
+	if ctx.JSONLog != nil {
+		record := JSONLogRecord{
+			Type:       ExitRecord,
+			Command:    command,
+			ExitCode:   &exitCode,
+			Stdout:     ctx.mask(string(stdout.buf)),
+			Stderr:     ctx.mask(string(stderr.buf)),
+			Truncated:  stdout.truncated || stderr.truncated,
+			DurationMs: time.Since(started).Milliseconds(),
+		}
+		if err != nil {
+			record.Error = ctx.mask(err.Error())
+		}
+		writeJSONLog(ctx, record)
+	}
 	return err
 }
 
-// RunImage runs the container that is defined in the provided ImageInfo
+// killOnDone kills the process of the started command when the context is
+// done. The returned function stops watching the context and must be called
+// once the command has exited.
+func killOnDone(ctx context.Context, cmd *exec.Cmd) func() {
+	if ctx == nil || ctx.Done() == nil {
+		return func() {}
+	}
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+	return func() { close(exited) }
+}
+
+// RunImage runs the container that is defined in the provided ImageInfo.
+// The builder of the runner is not modified, so the same runner can be used
+// to run several images. The logger and the streams that the context does
+// not have are taken from its Context, as set with WithLogger, WithStdOut
+// and WithStdErr.
 func (r *CliModuleRunner) RunImage(ctx *RunContext, info ImageInfo) error {
-	cmdStr, err := r.BuildFrom(info)
+	ctx.useContextValues()
+	builder := r.PodmanCliCommandBuilder.clone()
+	if ctx.In != nil && (builder.parts.Interactive || sendsInput(ctx.Context)) {
+		// Keeps stdin open so the input of the context reaches the container.
+		builder.WithFlags("-i")
+	}
+	if name := containerNameOf(ctx.Context); len(name) > 0 {
+		builder.WithFlags("--name", name)
+	}
+	if sandbox := sandboxOf(ctx.Context); sandbox != nil {
+		builder.WithFlags(sandbox.podmanFlags()...)
+	}
+	if uid, ok := runAsUserOf(ctx.Context); ok {
+		builder.WithFlags(fmt.Sprintf("--user=%d:0", uid))
+	}
+	if r.Pull != nil && len(info.Image) > 0 {
+		if err := r.pullImage(ctx, info.Image); err != nil {
+			ctx.AddError(err)
+			return err
+		}
+		builder.WithFlags("--pull=never")
+	}
+	args, err := builder.BuildArgsFrom(info)
+	if err == nil {
+		err = builder.Validate()
+	}
 	if err != nil {
 		ctx.AddError(err)
 		return err
 	}
 
-	return r.runCmd(ctx, cmdStr)
+	return r.runCmd(ctx, args, builder.BuildEnv())
 }
 
-// Run runs the container that has been defined in the builder setup.
+// Run runs the container that has been defined in the builder setup. The
+// logger and the streams that the context does not have are taken from its
+// Context, as RunImage does.
 func (r *CliModuleRunner) Run(ctx *RunContext) error {
-	cmdStr, err := r.Build()
+	ctx.useContextValues()
+	err := r.Validate()
 	if err != nil {
 		ctx.AddError(err)
 		return err
 	}
 	// Immediately before we run, we reset the context
 	ctx.Reset()
-	return r.runCmd(ctx, cmdStr)
+	return r.runCmd(ctx, r.BuildArgs(), r.BuildEnv())
 }
 
 type State string
@@ -397,6 +840,11 @@ const (
 	PostDeployed  State = "postdeployed"
 	Done                = PostDeployed
 	Errored       State = "errored"
+	// TimedOut is the state of a deployment that did not finish before the
+	// deadline set with WithDeadline.
+	TimedOut State = "timedout"
+	// Cancelled is the state of a deployment that was stopped with Cancel.
+	Cancelled State = "cancelled"
 )
 
 var DefaultOrder = []State{
@@ -449,20 +897,150 @@ type CmdItr interface {
 }
 
 type DeployableModule struct {
-	module    *ModuleInfo
-	cli       *CliModuleRunner
-	runCtx    RunContext
-	cmds      map[State]StateCmd
-	hooks     map[Hook]HookCmd
-	previous  State
-	current   State
-	execOrder []State
+	module *ModuleInfo
+	// opts are the options that the deployment was created with, which
+	// the deployments of the included modules are created with as well.
+	opts          []DeployableModuleOption
+	runner        ImageRunner
+	runID         string
+	sinks         []EventSink
+	sinkTimeout   time.Duration
+	history       *HistoryStore
+	locker        *Locker
+	hookCache     *HookCache
+	progress      ProgressReporter
+	outputs       map[State]*StageOutput
+	outputLimit   int
+	captureOutput bool
+	lineFunc      LineFunc
+	decorator     *OutputDecorator
+	notifiers     []DeploymentNotifier
+	// slowStageFactor is the budget of the stages as a multiple of their
+	// p95, or zero if slow stages are not reported.
+	slowStageFactor  float64
+	tracker          *progressTracker
+	deadline         time.Duration
+	checkpointDir    string
+	stageMu          sync.Mutex
+	running          State
+	suspended        *CheckpointInfo
+	cancelled        *string
+	cancelRun        context.CancelFunc
+	variables        []EventDataVarInfo
+	variableKeys     KeySource
+	validation       *ValidationResult
+	initialState     *ModuleState
+	transcript       string
+	transcriptEvents *eventRecorder
+	vulnScanner      VulnScanner
+	vulnThreshold    VulnSeverity
+	listed           *EventData
+	scanMu           sync.Mutex
+	scanned          map[string]string
+	runCtx           *RunContext
+	machine          *fsm.Machine[State, StateCmd]
+	strict           bool
+	guards           []fsm.Guard[State]
+	rejected         error
+	transitionMu     sync.Mutex
+	transitions      []Transition
+	failureLines     int
+	deadLetters      DeadLetterQueue
+	checksumOnce     sync.Once
+	checksum         string
+	capabilities     *HookCapabilities
+	noSandbox        bool
+	source           string
+	trustPolicy      TrustPolicy
+	trustedSources   []string
+	trust            *trustCache
+	snapshot         bool
+	before           *environmentSnapshot
+	changes          *EnvironmentChanges
+	kubeconfigPaths  []string
+	cacheDir         *string
+	caFiles          *[]string
+	mountPolicy      *MountPolicy
+	runAsUser        *int
+	artifactsDir     string
+	artifacts        []Artifact
+	commands         map[string]ExecutedCommand
+	commandOrder     []string
+	defaultSources   map[string]DefaultSource
+	resolvedDefaults map[string]string
+	hooks            map[Hook]HookCmd
+	conditions       []Condition
+	provenance       DigestResolver
+	workspaceRoot    string
+	credentials      []credential
+	terraform        bool
+	includes         []*ModuleInfo
+	subDeployments   []*DeployableModule
+	runningInclude   *DeployableModule
+	includeResults   []*DeploymentResult
+}
+
+func (m *DeployableModule) getHookCmd(name Hook, img ImageInfo) HookCmd {
+	return func(ctx *RunContext) error {
+		if sandbox := m.hookSandbox(img); sandbox != nil {
+			prevCtx := ctx.Context
+			ctx.Context = withSandbox(ctx.Context, sandbox)
+			defer func() { ctx.Context = prevCtx }()
+		}
+		return m.runImage(ctx, string(name), img)
+	}
 }
 
-func (m *DeployableModule) getHookCmd(img ImageInfo) HookCmd {
-	return func(ctx *RunContext) error {
-		return m.cli.RunImage(ctx, img)
+// runImage runs the image with the runner of the module, adding the run ID
+// of the deployment to the environment and to the logs of the runner.
+func (m *DeployableModule) runImage(ctx *RunContext, name string, info ImageInfo) error {
+	if err := m.checkImageMounts(name, info); err != nil {
+		ctx.AddError(err)
+		return err
+	}
+	img := info.DeepCopy()
+	found := false
+	for idx := range img.EnvVars {
+		if img.EnvVars[idx].Name == RunIDEnvVar {
+			img.EnvVars[idx].Value = m.runID
+			found = true
+		}
+	}
+	if !found {
+		img.EnvVars = append(img.EnvVars, EnvVarInfo{Name: RunIDEnvVar, Value: m.runID})
+	}
+	if err := m.withCredentials(&img); err != nil {
+		ctx.AddError(err)
+		return err
+	}
+	img.EnvVars = append(img.EnvVars, inheritedEnv(img)...)
+	if err := m.withWorkspace(&img); err != nil {
+		ctx.AddError(err)
+		return err
 	}
+	if err := m.withTerraform(ctx, &img); err != nil {
+		ctx.AddError(err)
+		return err
+	}
+	if err := m.withCache(&img); err != nil {
+		ctx.AddError(err)
+		return err
+	}
+	if err := m.withCABundle(&img); err != nil {
+		ctx.AddError(err)
+		return err
+	}
+	if err := m.confirmTrust(ctx, img); err != nil {
+		ctx.AddError(err)
+		return err
+	}
+
+	prevRunID := ctx.RunID
+	ctx.RunID = m.runID
+	defer func() { ctx.RunID = prevRunID }()
+	ctx.setCommand(nil)
+	defer m.recordCommand(ctx, name, time.Now().UTC())
+	return m.runner.RunImage(ctx, img)
 }
 
 func (m *DeployableModule) addHook(name Hook, hook HookCmd) error {
@@ -471,129 +1049,280 @@ func (m *DeployableModule) addHook(name Hook, hook HookCmd) error {
 }
 
 func (m *DeployableModule) State() State {
-	return m.current
+	return m.machine.Current()
 }
 
 func (m *DeployableModule) Notify(state State) error {
-	m.previous = m.current
-	m.current = state
+	from := m.machine.Current()
+	if err := m.machine.Transition(state); err != nil {
+		m.rejectTransition(state, err)
+		return err
+	}
+	m.moved(from, state, nil)
 	return nil
 }
 
 func (m *DeployableModule) NotifyErr(state State, err error) {
 	m.runCtx.AddError(err)
-	m.previous = m.current
-	m.current = state
+	from := m.machine.Current()
+	if terr := m.machine.Transition(state); terr != nil {
+		m.rejectTransition(state, terr)
+		return
+	}
+	m.moved(from, state, err)
 }
 
 func (m *DeployableModule) AddCmd(status State, handler StateCmd) error {
-	m.runCtx.Log.Tracef("Adding command for: %s", status)
-	if m.cmds[status] == nil {
-		m.cmds[status] = handler
-		return nil
-	} else {
+	m.runCtx.Log.WithField(RunIDLogField, m.runID).Tracef("Adding command for: %s", status)
+	if err := m.machine.Handle(status, handler); err != nil {
 		return fmt.Errorf("handler for state %s already exists", status)
 	}
+	return nil
 }
 
 func (m *DeployableModule) GetCmdFor(status State) StateCmd {
-	m.runCtx.Log.Tracef("Getting command for: %s", status)
-	return m.cmds[status]
+	m.runCtx.Log.WithField(RunIDLogField, m.runID).Tracef("Getting command for: %s", status)
+	cmd, _ := m.machine.Handler(status)
+	return cmd
 }
 
 func (m *DeployableModule) GetHook(name Hook) HookCmd {
-	m.runCtx.Log.Tracef("Getting hook for: %s", name)
+	m.runCtx.Log.WithField(RunIDLogField, m.runID).Tracef("Getting hook for: %s", name)
 	return m.hooks[name]
 }
 
 type NextFunc func() (StateCmd, bool)
 
+// NoHandlerError is returned when the deployment is in a state that has no
+// command registered for it, or that is not in its execution order.
+type NoHandlerError struct {
+	State State
+}
+
+func (e *NoHandlerError) Error() string {
+	return fmt.Sprintf("no handler for state %s", e.State)
+}
+
+// noHandler returns a StateCmd that fails with a NoHandlerError.
+func noHandler(state State) StateCmd {
+	return func(ctx *RunContext, notifier Notifier) error {
+		return &NoHandlerError{State: state}
+	}
+}
+
+// Itr returns a function that returns the command for the current state of
+// the deployment and whether there are more commands after it. When the
+// deployment is done or errored, the DoneHandler is returned. When there is
+// no command for the current state, a command that fails with a
+// NoHandlerError is returned instead of nil.
 func (m *DeployableModule) Itr() (NextFunc, bool) {
 	return func() (StateCmd, bool) {
-		if m.current == Done {
+		current := m.machine.Current()
+		if current == Done {
 			return DoneHandler, false
 		}
-		if m.current == Errored {
+		if m.IsErrored() || current == Cancelled {
 			return DoneHandler, false
 		}
 
-		for idx, state := range m.execOrder {
-			if m.current == state {
-				m.runCtx.Log.Tracef("Found state: %s; next state is: %s", m.current, m.execOrder[idx+1])
-				return m.GetCmdFor(m.execOrder[idx]), true
+		for _, state := range m.machine.Order() {
+			if current != state {
+				continue
 			}
+			next, ok := m.machine.Next(state)
+			if !ok {
+				next = None
+			}
+			m.runCtx.Log.WithField(RunIDLogField, m.runID).Tracef("Found state: %s; next state is: %s", current, next)
+			cmd := m.GetCmdFor(state)
+			if cmd == nil {
+				return noHandler(state), false
+			}
+			return cmd, true
 		}
-		return NoopHandler, false
+		return noHandler(current), false
 	}, true
 }
 
+// ValidateHandlers checks that every state in the execution order of the
+// deployment, other than Done, has a command registered for it, and returns
+// a NoHandlerError for the first one that does not.
+func (m *DeployableModule) ValidateHandlers() error {
+	for _, state := range m.machine.Order() {
+		if state == Done {
+			continue
+		}
+		if cmd, _ := m.machine.Handler(state); cmd == nil {
+			return &NoHandlerError{State: state}
+		}
+	}
+	return nil
+}
+
 func (m *DeployableModule) preDeploy(ctx *RunContext, notifier Notifier) error {
 	notifier.Notify(PreDeploying)
-	err := m.cli.RunImage(ctx, m.module.Specifications.Lifecycle.PreDeploy)
-	if err != nil {
-		notifier.Notify(Errored)
-	} else {
-		notifier.Notify(PreDeployed)
-	}
-	return err
+	err := m.runStage(ctx, PreDeploying, m.module.Specifications.Lifecycle.PreDeploy)
+	return m.finishStage(notifier, PreDeployed, err)
 }
 
 func (m *DeployableModule) deploy(ctx *RunContext, notifier Notifier) error {
 	notifier.Notify(Deploying)
-	err := m.cli.RunImage(ctx, m.module.Specifications.Lifecycle.Deploy)
-	if err != nil {
-		notifier.Notify(Errored)
-	} else {
-		notifier.Notify(Deployed)
+	err := m.runStage(ctx, Deploying, m.module.Specifications.Lifecycle.Deploy)
+	if err == nil && m.module.Specifications.Readiness != nil {
+		if err = m.waitUntilReady(ctx); err != nil {
+			ctx.AddError(err)
+		}
 	}
-	return err
+	return m.finishStage(notifier, Deployed, err)
 }
 
 func (m *DeployableModule) postDeploy(ctx *RunContext, notifier Notifier) error {
 	notifier.Notify(PostDeploying)
-	err := m.cli.RunImage(ctx, m.module.Specifications.Lifecycle.PostDeploy)
-	if err != nil {
+	err := m.runStage(ctx, PostDeploying, m.module.Specifications.Lifecycle.PostDeploy)
+	return m.finishStage(notifier, PostDeployed, err)
+}
+
+// finishStage moves the deployment to the done state of the stage, or to
+// Errored if the stage failed. A stage that was suspended stays in its
+// state, so that it can be resumed.
+func (m *DeployableModule) finishStage(notifier Notifier, done State, err error) error {
+	var suspended *SuspendedError
+	var cancelled *CancelledError
+	switch {
+	case errors.As(err, &suspended), errors.As(err, &cancelled):
+	case err != nil:
 		notifier.Notify(Errored)
-	} else {
-		notifier.Notify(PostDeployed)
+	default:
+		notifier.Notify(done)
 	}
 	return err
 }
 
-func (m *DeployableModule) resolveState(ctx *RunContext, notifier Notifier) error {
-	// err := m.cli.RunImage(ctx, m.module.Specifications.PostDeploy)
-	// TODO: From this one, we grab the output from the context and
-	// use that to notify the state of the current module
-	notifier.Notify(Configured)
-	return nil
+// RunID returns the ID of this deployment, which is used to correlate the
+// events, containers and logs of a single deployment.
+func (m *DeployableModule) RunID() string {
+	return m.runID
 }
 
+// Name returns the name of the module.
+func (m *DeployableModule) Name() string {
+	return m.module.Metadata.Name
+}
+
+// Metadata returns a copy of the metadata of the module.
+func (m *DeployableModule) Metadata() MetadataInfo {
+	return m.module.Metadata.DeepCopy()
+}
+
+// Images returns the names of the images used by the hooks and lifecycle
+// stages of the module, in the order that they are defined and without
+// duplicates.
+func (m *DeployableModule) Images() []string {
+	stages := stageImages(m.module)
+	images := make([]string, 0, len(stages))
+	seen := make(map[string]bool)
+	for _, s := range stages {
+		if len(s.Info.Image) == 0 || seen[s.Info.Image] {
+			continue
+		}
+		seen[s.Info.Image] = true
+		images = append(images, s.Info.Image)
+	}
+	return images
+}
+
+// Stage returns a copy of the ImageInfo that is run in the given state, such
+// as the pre_deploy image for PreDeploying. For states that do not run an
+// image, an empty ImageInfo is returned.
+func (m *DeployableModule) Stage(state State) ImageInfo {
+	switch state {
+	case PreDeploying:
+		return m.module.Specifications.Lifecycle.PreDeploy.DeepCopy()
+	case Deploying:
+		return m.module.Specifications.Lifecycle.Deploy.DeepCopy()
+	case PostDeploying:
+		return m.module.Specifications.Lifecycle.PostDeploy.DeepCopy()
+	default:
+		return ImageInfo{}
+	}
+}
+
+// IsErrored returns true if the deployment has failed, either because one of
+// its stages failed or because it timed out.
 func (m *DeployableModule) IsErrored() bool {
-	return m.current == Errored
+	current := m.machine.Current()
+	return current == Errored || current == TimedOut
+}
+
+// DeployableModuleOption configures optional settings of a DeployableModule.
+type DeployableModuleOption func(*DeployableModule)
+
+// WithRunID uses the given run ID for the deployment instead of a generated
+// one, for example to continue a deployment that was started earlier.
+func WithRunID(id string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.runID = id
+	}
+}
+
+// WithExecOrder drives the deployment through the given states instead of
+// the DefaultOrder. Each of the states needs a command, registered with
+// AddCmd, which can be checked with ValidateHandlers.
+func WithExecOrder(order []State) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.machine = fsm.New[State, StateCmd](Invalid, order)
+	}
+}
+
+// WithRunner uses the given runner to run the hooks and lifecycle stages of
+// the module instead of the default podman CliModuleRunner.
+func WithRunner(runner ImageRunner) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.runner = runner
+	}
 }
 
-func NewDeployableModule(runCtx *RunContext, module *ModuleInfo) *DeployableModule {
+func NewDeployableModule(runCtx *RunContext, module *ModuleInfo, opts ...DeployableModuleOption) *DeployableModule {
 	builder := NewPodmanCliCommandBuilder(nil)
 
 	deployment := &DeployableModule{
-		module:    module,
-		cli:       &CliModuleRunner{*builder},
-		runCtx:    *runCtx,
-		execOrder: DefaultOrder,
-		current:   Invalid,
-		cmds:      make(map[State]StateCmd),
-		hooks:     make(map[Hook]HookCmd),
+		module:       module,
+		failureLines: DefaultFailureStderrLines,
+		runner:       &CliModuleRunner{PodmanCliCommandBuilder: *builder},
+		runCtx:       runCtx,
+		runID:        uuid.New().String(),
+		machine:      fsm.New[State, StateCmd](Invalid, DefaultOrder),
+		hooks:        make(map[Hook]HookCmd),
+		outputs:      make(map[State]*StageOutput),
+		scanned:      make(map[string]string),
+		trust:        &trustCache{confirmed: make(map[string]bool)},
+		mountPolicy:  DefaultMountPolicy(),
+		opts:         append([]DeployableModuleOption(nil), opts...),
+	}
+	for _, opt := range opts {
+		opt(deployment)
 	}
 
-	deployment.addHook(ListHook, deployment.getHookCmd(module.Specifications.Hooks.List))
-	deployment.addHook(ValidateHook, deployment.getHookCmd(module.Specifications.Hooks.Validate))
-	deployment.addHook(GetStateHook, deployment.getHookCmd(module.Specifications.Hooks.GetState))
+	deployment.addHook(ListHook, deployment.getHookCmd(ListHook, module.Specifications.Hooks.List))
+	deployment.addHook(ValidateHook, deployment.getHookCmd(ValidateHook, module.Specifications.Hooks.Validate))
+	deployment.addHook(GetStateHook, deployment.getHookCmd(GetStateHook, module.Specifications.Hooks.GetState))
+	deployment.addHook(InfoHook, deployment.getHookCmd(InfoHook, module.Specifications.Hooks.Info))
+
+	// Any state can fail, time out or be cancelled, and the stages move to
+	// their own state again when they start.
+	for _, state := range deployment.machine.Order() {
+		deployment.machine.Allow(state, state, Errored, TimedOut, Cancelled)
+	}
+	deployment.machine.SetStrict(deployment.strict)
+	for _, guard := range deployment.guards {
+		deployment.machine.AddGuard(guard)
+	}
 
 	// Now configure the cmds for the module deployment
 	deployment.AddCmd(Invalid, advanceTo(Initializing))
 	deployment.AddCmd(Initializing, deployment.resolveState)
-	deployment.AddCmd(Configured, advanceTo(Validated))
-	deployment.AddCmd(Validated, advanceTo(PreDeploying))
+	deployment.AddCmd(Configured, deployment.validate)
+	deployment.AddCmd(Validated, deployment.deployIncludes)
 	deployment.AddCmd(PreDeploying, deployment.preDeploy)
 	deployment.AddCmd(PreDeployed, advanceTo(Deploying))
 	deployment.AddCmd(Deploying, deployment.deploy)
@@ -616,45 +1345,132 @@ type ModuleLoader interface {
 }
 
 type ManifestFileLoader struct {
-	path string
+	path      string
+	verifiers []ManifestVerifier
+	defaults  ManifestDefaults
+	applied   *DefaultsReport
 }
 
+// Load loads the manifest of the file. If the file is a stream of YAML
+// documents, the first manifest is loaded; see LoadAll.
 func (l *ManifestFileLoader) Load(uri string) (*ModuleInfo, error) {
-	l.path = uri
 	logger.Debug("Loading module from manifest file")
-	var module = &ModuleInfo{}
-	yamlFile, err := ioutil.ReadFile(uri)
+	f, err := os.Open(uri)
 	if err != nil {
 		return nil, err
 	}
-	err = yaml.Unmarshal(yamlFile, &module)
-	if err != nil {
+	defer f.Close()
+	return l.LoadReader(f, uri)
+}
+
+// LoadReader loads the first manifest of the reader, as Load does. The URI
+// names the manifest in the errors and is the path that its includes are
+// relative to.
+func (l *ManifestFileLoader) LoadReader(r io.Reader, uri string) (*ModuleInfo, error) {
+	modules, err := l.load(r, uri, 1)
+	if len(modules) == 0 {
 		return nil, err
 	}
-	// Now check to make sure the module is a supported version
-	supported := module.IsSupported()
-	if !supported {
-		err = fmt.Errorf("module version %s is not supported", module.ApiVersion)
+	return modules[0], err
+}
+
+// LoadAll loads each of the manifests of the stream of YAML documents of the
+// reader, in order. The manifests are decoded one at a time, so the stream
+// is not read at once, unless the loader has verifiers, which verify the
+// whole content first.
+func (l *ManifestFileLoader) LoadAll(r io.Reader, uri string) ([]*ModuleInfo, error) {
+	return l.load(r, uri, 0)
+}
+
+// load loads up to the limit of manifests from the reader, or all of them if
+// the limit is 0. The manifests that were loaded before an error are
+// returned with it, including the one that the error is about if it could
+// be decoded.
+func (l *ManifestFileLoader) load(r io.Reader, uri string, limit int) ([]*ModuleInfo, error) {
+	l.path = uri
+	l.applied = nil
+	if len(l.verifiers) > 0 {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.verify(uri, content); err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(content)
+	}
+	decoder := NewManifestDecoder(r, uri)
+	var modules []*ModuleInfo
+	for limit == 0 || len(modules) < limit {
+		module, err := decoder.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return modules, err
+		}
+		modules = append(modules, module)
+		// Now check to make sure the module is a supported version
+		if !module.IsSupported() {
+			return modules, fmt.Errorf("module version %s is not supported", module.ApiVersion)
+		}
+		applied, err := module.ApplyDefaults(l.defaults)
+		for _, a := range applied.Applied {
+			logger.Debugf("applied default %s", a)
+		}
+		if l.applied == nil {
+			l.applied = applied
+		} else {
+			l.applied.Applied = append(l.applied.Applied, applied.Applied...)
+			l.applied.Warnings = append(l.applied.Warnings, applied.Warnings...)
+		}
+		if err != nil {
+			return modules, err
+		}
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no manifest found in %s", uri)
 	}
-	return module, err
+	return modules, nil
 }
 
-func NewAtkManifestFileLoader() *ManifestFileLoader {
-	return &ManifestFileLoader{}
+func NewAtkManifestFileLoader(opts ...ManifestLoaderOption) *ManifestFileLoader {
+	l := &ManifestFileLoader{}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
+// LoadEventData decodes the data of the event into EventData, using the
+// datacontenttype of the event. See DecodeEventData.
 func LoadEventData(event *cloudevents.Event) (*EventData, error) {
 	var data EventData
-	err := yaml.Unmarshal(event.Data(), &data)
+	err := DecodeEventData(event, &data)
 	return &data, err
 }
 
+// LoadEvent loads the CloudEvent from the string and validates that it has
+// all of the required fields. See ValidateEvent. The event can either be in
+// the JSON format or, if it does not start with a "{", in YAML.
 func LoadEvent(eventS string) (*cloudevents.Event, error) {
+	return loadEvent(eventS, "")
+}
+
+// loadEvent loads the event from JSON or YAML and validates it, including
+// its type if expected is not empty.
+func loadEvent(eventS string, expected ModuleEventType) (*cloudevents.Event, error) {
+	if !strings.HasPrefix(strings.TrimSpace(eventS), "{") {
+		return loadEventYAML(eventS, expected)
+	}
 	event := cloudevents.NewEvent()
 	err := json.Unmarshal([]byte(eventS), &event)
 	if err != nil {
 		return nil, err
 	}
+	if err := ValidateEvent(&event, expected); err != nil {
+		return nil, err
+	}
 	return &event, nil
 }
 
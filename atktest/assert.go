@@ -0,0 +1,91 @@
+package atktest
+
+import (
+	"reflect"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+)
+
+// AssertRan fails the test if the runner did not run the given image.
+func AssertRan(t testing.TB, r *FakeRunner, image string) bool {
+	t.Helper()
+	for _, ran := range r.Images() {
+		if ran == image {
+			return true
+		}
+	}
+	t.Errorf("expected image %s to be run, but ran: %v", image, r.Images())
+	return false
+}
+
+// AssertNotRan fails the test if the runner ran the given image.
+func AssertNotRan(t testing.TB, r *FakeRunner, image string) bool {
+	t.Helper()
+	for _, ran := range r.Images() {
+		if ran == image {
+			t.Errorf("expected image %s not to be run, but it was", image)
+			return false
+		}
+	}
+	return true
+}
+
+// AssertRunOrder fails the test if the runner did not run exactly the given
+// images in the given order.
+func AssertRunOrder(t testing.TB, r *FakeRunner, images ...string) bool {
+	t.Helper()
+	actual := r.Images()
+	if len(images) == 0 && len(actual) == 0 {
+		return true
+	}
+	if !reflect.DeepEqual(images, actual) {
+		t.Errorf("expected images to run in order %v, but ran: %v", images, actual)
+		return false
+	}
+	return true
+}
+
+// AssertEventType fails the test if the output cannot be loaded as an event
+// or if the event is not of the given type.
+func AssertEventType(t testing.TB, output string, eventType atk.ModuleEventType) bool {
+	t.Helper()
+	event, err := atk.LoadEvent(output)
+	if err != nil {
+		t.Errorf("expected a valid event, but got error: %v", err)
+		return false
+	}
+	if event.Type() != string(eventType) {
+		t.Errorf("expected event of type %s, but got: %s", eventType, event.Type())
+		return false
+	}
+	return true
+}
+
+// AssertVariables fails the test if the event in the output does not contain
+// exactly the variables with the given names, in order.
+func AssertVariables(t testing.TB, output string, names ...string) bool {
+	t.Helper()
+	event, err := atk.LoadEvent(output)
+	if err != nil {
+		t.Errorf("expected a valid event, but got error: %v", err)
+		return false
+	}
+	data, err := atk.LoadEventData(event)
+	if err != nil {
+		t.Errorf("expected valid event data, but got error: %v", err)
+		return false
+	}
+	actual := make([]string, 0, len(data.Variables))
+	for _, v := range data.Variables {
+		actual = append(actual, v.Name)
+	}
+	if len(names) == 0 && len(actual) == 0 {
+		return true
+	}
+	if !reflect.DeepEqual(names, actual) {
+		t.Errorf("expected variables %v, but got: %v", names, actual)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package atktest
+
+import (
+	"bytes"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+)
+
+// FixtureSource is the source of the events created by the fixtures.
+const FixtureSource = "https://github.com/cloud-native-toolkit/atkmod/atktest"
+
+// ListResponse is a canned response of a list hook, as written to standard
+// out by the hook container.
+var ListResponse = NewResponse(atk.ListHookResponseEvent,
+	atk.EventDataVarInfo{Name: "TF_VAR_cloud_provider", Default: "fyre"},
+	atk.EventDataVarInfo{Name: "TF_VAR_cloud_type", Default: "private"},
+	atk.EventDataVarInfo{Name: "TF_VAR_api_key"},
+)
+
+// ValidateResponse is a canned response of a validate hook.
+var ValidateResponse = NewResponse(atk.ValidateHookResponseEvent,
+	atk.EventDataVarInfo{Name: "TF_VAR_cloud_provider", Value: "fyre"},
+)
+
+// GetStateResponse is a canned response of a get_state hook.
+var GetStateResponse = newEventJSON(atk.GetStateHookResponseEvent, map[string]interface{}{})
+
+// NewResponse creates the JSON of a response event of the given type with
+// the given variables as its data.
+func NewResponse(eventType atk.ModuleEventType, vars ...atk.EventDataVarInfo) string {
+	return newEventJSON(eventType, &atk.EventData{Variables: vars})
+}
+
+// StateResponse returns a response of a get_state hook that reports the given
+// health status, such as DEPLOYED.
+func StateResponse(status string) string {
+	return newEventJSON(atk.GetStateHookResponseEvent, &atk.ModuleState{Health: atk.ModuleHealth{Status: status}})
+}
+
+// StateResponseWithData returns the JSON of a get_state hook response with
+// the given health status and state data.
+func StateResponseWithData(status string, data interface{}) string {
+	return newEventJSON(atk.GetStateHookResponseEvent, &atk.ModuleState{Health: atk.ModuleHealth{Status: status}, Data: data})
+}
+
+func newEventJSON(eventType atk.ModuleEventType, data interface{}) string {
+	event, err := atk.NewEvent(eventType, "atktest", data)
+	if err != nil {
+		// The fixtures are always serializable, so this is a programming
+		// error.
+		panic(err)
+	}
+	event.SetSource(FixtureSource)
+	buf := new(bytes.Buffer)
+	if err := atk.WriteEvent(event, buf); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+// Manifest returns a valid ModuleInfo that uses the given image names for the
+// hooks and lifecycle stages, which makes it easy to set up responses on a
+// FakeRunner.
+func Manifest(name string) *atk.ModuleInfo {
+	return &atk.ModuleInfo{
+		ApiVersion: "itzcli/v1alpha1",
+		Kind:       "InstallManifest",
+		Metadata: atk.MetadataInfo{
+			Name:      name,
+			Namespace: "atktest",
+		},
+		Specifications: atk.SpecInfo{
+			Hooks: atk.HookInfo{
+				List:     atk.ImageInfo{Image: name + "-list"},
+				Validate: atk.ImageInfo{Image: name + "-validate"},
+				GetState: atk.ImageInfo{Image: name + "-get-state"},
+			},
+			Lifecycle: atk.LifecycleInfo{
+				PreDeploy:  atk.ImageInfo{Image: name + "-pre-deploy"},
+				Deploy:     atk.ImageInfo{Image: name + "-deploy"},
+				PostDeploy: atk.ImageInfo{Image: name + "-post-deploy"},
+			},
+		},
+	}
+}
@@ -0,0 +1,164 @@
+// Package atktest provides a fake runner, canned CloudEvent fixtures and
+// assertion helpers for testing code that uses atkmod without podman.
+package atktest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+)
+
+// Response is the canned output of a fake image run.
+type Response struct {
+	// Out is written to the output stream of the context.
+	Out string
+	// Err is written to the error stream of the context.
+	Err string
+	// ExitCode is the exit code of the run. Anything other than zero results
+	// in an error.
+	ExitCode int
+}
+
+// RunCall is the record of a single call to FakeRunner.RunImage.
+type RunCall struct {
+	Info atk.ImageInfo
+	// In is what was read from the input stream of the context, if any. Only
+	// in-memory readers, such as a bytes.Buffer or a strings.Reader, are read,
+	// so a fake run never blocks on a terminal or an open pipe.
+	In string
+}
+
+// ExitError is returned by the FakeRunner when the response has a non-zero
+// exit code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code, so the error can be used like an
+// exec.ExitError.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+var _ atk.ImageRunner = (*FakeRunner)(nil)
+
+// FakeRunner is a recording implementation of the runner that returns canned
+// responses keyed by image name instead of running containers.
+type FakeRunner struct {
+	mu        sync.Mutex
+	responses map[string]Response
+	sequences map[string][]Response
+	calls     []RunCall
+	// Default is the response used for images that do not have a response.
+	Default Response
+}
+
+// NewFakeRunner creates a FakeRunner with no canned responses.
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{
+		responses: make(map[string]Response),
+		sequences: make(map[string][]Response),
+	}
+}
+
+// On sets the response returned when the given image is run.
+func (r *FakeRunner) On(image string, resp Response) *FakeRunner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses[image] = resp
+	return r
+}
+
+// OnSequence sets the responses returned by the runs of the given image, in
+// turn. Once they have all been returned, the last one is repeated. This is
+// useful for hooks that are polled, such as get_state.
+func (r *FakeRunner) OnSequence(image string, resps ...Response) *FakeRunner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequences[image] = resps
+	return r
+}
+
+// RunImage records the call and writes the canned response for the image to
+// the context.
+func (r *FakeRunner) RunImage(ctx *atk.RunContext, info atk.ImageInfo) error {
+	call := RunCall{Info: info}
+	if isInMemory(ctx.In) {
+		if in, err := io.ReadAll(ctx.In); err == nil {
+			call.In = string(in)
+		}
+	}
+
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	resp, ok := r.responses[info.Image]
+	if !ok {
+		resp = r.Default
+	}
+	if seq := r.sequences[info.Image]; len(seq) > 0 {
+		resp = seq[0]
+		if len(seq) > 1 {
+			r.sequences[info.Image] = seq[1:]
+		}
+	}
+	r.mu.Unlock()
+
+	if ctx.Out != nil && len(resp.Out) > 0 {
+		ctx.Out.Write([]byte(resp.Out))
+	}
+	if ctx.Err != nil && len(resp.Err) > 0 {
+		ctx.Err.Write([]byte(resp.Err))
+	}
+	if resp.ExitCode != 0 {
+		err := &ExitError{Code: resp.ExitCode}
+		ctx.SetLastErrCode(resp.ExitCode)
+		ctx.AddError(err)
+		return err
+	}
+	return nil
+}
+
+// isInMemory returns true if the reader is backed by memory, so reading it
+// cannot block.
+func isInMemory(r io.Reader) bool {
+	switch r.(type) {
+	case *bytes.Buffer, *bytes.Reader, *strings.Reader:
+		return true
+	default:
+		return false
+	}
+}
+
+// Calls returns the calls made to the runner, in order.
+func (r *FakeRunner) Calls() []RunCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := make([]RunCall, len(r.calls))
+	copy(calls, r.calls)
+	return calls
+}
+
+// Images returns the names of the images run, in order.
+func (r *FakeRunner) Images() []string {
+	calls := r.Calls()
+	images := make([]string, 0, len(calls))
+	for _, c := range calls {
+		images = append(images, c.Info.Image)
+	}
+	return images
+}
+
+// Reset clears the recorded calls.
+func (r *FakeRunner) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
@@ -0,0 +1,113 @@
+package atkmod
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// HookResult is the result of running a hook for one of the modules given to
+// RunHookAll.
+type HookResult struct {
+	Module *ModuleInfo
+	// Events are the events written by the hook, in order.
+	Events []*cloudevents.Event
+	// Stderr is what the hook wrote to standard error.
+	Stderr string
+	// Err is the error from running the hook or parsing its output, if any.
+	Err error
+}
+
+// hookImage returns the image of the given hook of the module.
+func hookImage(module *ModuleInfo, hook Hook) (ImageInfo, error) {
+	switch hook {
+	case ListHook:
+		return module.Specifications.Hooks.List, nil
+	case ValidateHook:
+		return module.Specifications.Hooks.Validate, nil
+	case GetStateHook:
+		return module.Specifications.Hooks.GetState, nil
+	default:
+		return ImageInfo{}, fmt.Errorf("unknown hook: %s", hook)
+	}
+}
+
+// newWorkerContext creates a context for running an image apart from the
+// parent, with its own output buffers and errors, that logs in the same way
+// as the parent.
+func newWorkerContext(parent *RunContext, out *bytes.Buffer, errOut *bytes.Buffer) *RunContext {
+	return &RunContext{
+		Context:          parent.Context,
+		Out:              out,
+		Err:              errOut,
+		Log:              copyLogger(&parent.Log),
+		RunID:            parent.RunID,
+		JSONLog:          parent.JSONLog,
+		Verbosity:        parent.Verbosity,
+		ShowPullProgress: parent.ShowPullProgress,
+	}
+}
+
+// RunHookAll runs the hook of each of the modules, with at most concurrency
+// hooks running at the same time, and returns the results in the same order
+// as the modules. If concurrency is zero or less, the number of CPUs is used.
+// The options are applied to the deployment of each module, so the runner
+// is set with WithRunner. Modules that have not been started when the context
+// is cancelled get the error of the context.
+func RunHookAll(ctx *RunContext, modules []*ModuleInfo, hook Hook, concurrency int, opts ...DeployableModuleOption) []HookResult {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	results := make([]HookResult, len(modules))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx] = runHookFor(ctx, modules[idx], hook, opts)
+			}
+		}()
+	}
+
+	for idx := range modules {
+		if ctx.Context != nil && ctx.Context.Err() != nil {
+			results[idx] = HookResult{Module: modules[idx], Err: ctx.Context.Err()}
+			continue
+		}
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func runHookFor(parent *RunContext, module *ModuleInfo, hook Hook, opts []DeployableModuleOption) HookResult {
+	result := HookResult{Module: module}
+	info, err := hookImage(module, hook)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if len(info.Image) == 0 && len(info.Script) == 0 {
+		result.Err = fmt.Errorf("module %s does not have a %s hook", module.Metadata.Name, hook)
+		return result
+	}
+
+	out := new(bytes.Buffer)
+	errOut := new(bytes.Buffer)
+	ctx := newWorkerContext(parent, out, errOut)
+	deployment := NewDeployableModule(ctx, module, opts...)
+	err = deployment.GetHook(hook)(ctx)
+	result.Stderr = errOut.String()
+	if err != nil {
+		result.Err = fmt.Errorf("%s hook of module %s failed: %w", hook, module.Metadata.Name, err)
+		return result
+	}
+	result.Events, result.Err = ParseEvents(out)
+	return result
+}
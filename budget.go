@@ -0,0 +1,165 @@
+package atkmod
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// SlowStageEvent is emitted when a stage of a deployment runs for longer
+// than its budget.
+const SlowStageEvent ModuleEventType = "com.ibm.techzone.cli.lifecycle.slow_stage"
+
+// The defaults of the slow stage warnings.
+const (
+	// DefaultSlowStageFactor is how many times the p95 of a stage it may
+	// run for before it is reported as slow.
+	DefaultSlowStageFactor = 2.0
+	// DefaultSlowStageMinSamples is the number of durations of a stage that
+	// the history must have before the stage gets a budget.
+	DefaultSlowStageMinSamples = 3
+)
+
+// StageHistogram has the durations of a stage in the previous deployments of
+// a module.
+type StageHistogram struct {
+	State State
+	// Durations are sorted from the shortest to the longest.
+	Durations []time.Duration
+}
+
+// StageHistograms returns the histogram of each state from the stage timings
+// of the deployments. The stage that a deployment failed in is left out,
+// since it did not run to completion.
+func StageHistograms(history []DeploymentResult) map[State]*StageHistogram {
+	histograms := make(map[State]*StageHistogram)
+	for _, result := range history {
+		for _, timing := range result.Stages {
+			if len(result.FailedState) > 0 && timing.State == result.FailedState {
+				continue
+			}
+			h, ok := histograms[timing.State]
+			if !ok {
+				h = &StageHistogram{State: timing.State}
+				histograms[timing.State] = h
+			}
+			h.Durations = append(h.Durations, timing.Duration)
+		}
+	}
+	for _, h := range histograms {
+		sort.Slice(h.Durations, func(i, j int) bool { return h.Durations[i] < h.Durations[j] })
+	}
+	return histograms
+}
+
+// Count is the number of durations in the histogram.
+func (h *StageHistogram) Count() int {
+	return len(h.Durations)
+}
+
+// Quantile returns the duration that q of the durations are at most, such
+// as 0.95 for the p95, using the nearest rank.
+func (h *StageHistogram) Quantile(q float64) time.Duration {
+	if len(h.Durations) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q*float64(len(h.Durations)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(h.Durations) {
+		rank = len(h.Durations) - 1
+	}
+	return h.Durations[rank]
+}
+
+// Buckets returns the number of durations that are at most each of the
+// bounds, which must be sorted, followed by the number that are longer than
+// the last bound.
+func (h *StageHistogram) Buckets(bounds []time.Duration) []int {
+	counts := make([]int, len(bounds)+1)
+	for _, d := range h.Durations {
+		idx := sort.Search(len(bounds), func(i int) bool { return d <= bounds[i] })
+		counts[idx]++
+	}
+	return counts
+}
+
+// SlowStage is the data of a SlowStageEvent.
+type SlowStage struct {
+	Module  string        `json:"module" yaml:"module"`
+	State   State         `json:"state" yaml:"state"`
+	Elapsed time.Duration `json:"elapsed" yaml:"elapsed"`
+	P95     time.Duration `json:"p95" yaml:"p95"`
+	Budget  time.Duration `json:"budget" yaml:"budget"`
+}
+
+// WithSlowStageWarnings logs a warning and emits a SlowStageEvent when a
+// stage runs for longer than factor times its p95 in the history of the
+// module, so that a hung stage is noticed early. It needs WithHistory, and
+// only the stages with at least DefaultSlowStageMinSamples durations in the
+// history get a budget. If factor is zero or less, DefaultSlowStageFactor is
+// used.
+func WithSlowStageWarnings(factor float64) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		if factor <= 0 {
+			factor = DefaultSlowStageFactor
+		}
+		m.slowStageFactor = factor
+	}
+}
+
+// stageBudgets returns the p95 of each state that has enough history, or
+// nil if the deployment does not warn about slow stages.
+func (m *DeployableModule) stageBudgets(ctx *RunContext) map[State]time.Duration {
+	if m.slowStageFactor <= 0 || m.history == nil {
+		return nil
+	}
+	results, err := m.history.History(m.module)
+	if err != nil {
+		ctx.Logger().Debugf("could not load the history of module %s for the stage budgets: %v", m.module.Metadata.Name, err)
+		return nil
+	}
+	p95s := make(map[State]time.Duration)
+	for state, h := range StageHistograms(results) {
+		if h.Count() >= DefaultSlowStageMinSamples {
+			p95s[state] = h.Quantile(0.95)
+		}
+	}
+	return p95s
+}
+
+// warnIfSlow starts a timer that warns when the stage runs for longer than
+// its budget. The returned function stops the timer and must be called when
+// the stage is done.
+func (m *DeployableModule) warnIfSlow(ctx *RunContext, p95s map[State]time.Duration, state State) func() {
+	p95, ok := p95s[state]
+	if !ok || p95 <= 0 {
+		return func() {}
+	}
+	budget := time.Duration(float64(p95) * m.slowStageFactor)
+	started := time.Now()
+	timer := time.AfterFunc(budget, func() {
+		slow := SlowStage{
+			Module:  m.module.Metadata.Name,
+			State:   state,
+			Elapsed: time.Since(started),
+			P95:     p95,
+			Budget:  budget,
+		}
+		ctx.Log.WithField(RunIDLogField, m.runID).Warn(slow.String())
+		if len(m.sinks) > 0 {
+			event := mustNewEvent(SlowStageEvent, m.module.Metadata.Name, slow)
+			m.setDeploymentExtensions(event)
+			m.emit(event)
+		}
+	})
+	return func() { timer.Stop() }
+}
+
+func (s SlowStage) String() string {
+	return fmt.Sprintf("stage %s of module %s has been running for %s, longer than its budget of %s (%.3gx its p95 of %s)",
+		s.State, s.Module, s.Elapsed.Round(time.Second), s.Budget.Round(time.Second),
+		float64(s.Budget)/float64(s.P95), s.P95.Round(time.Second))
+}
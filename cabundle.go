@@ -0,0 +1,147 @@
+package atkmod
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CABundleMountPaths are the paths in the containers where the CA bundle of
+// WithCABundle is mounted, which are where the distributions keep the
+// bundle of the system: Debian and Alpine, RHEL and Fedora, and OpenSSL.
+var CABundleMountPaths = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/cert.pem",
+}
+
+// CABundleEnvVars are the names of the environment variables that point
+// the tools in the containers to the CA bundle of WithCABundle: OpenSSL,
+// python requests, curl, node, git and the AWS CLI.
+var CABundleEnvVars = []string{
+	"SSL_CERT_FILE",
+	"REQUESTS_CA_BUNDLE",
+	"CURL_CA_BUNDLE",
+	"NODE_EXTRA_CA_CERTS",
+	"GIT_SSL_CAINFO",
+	"AWS_CA_BUNDLE",
+}
+
+// systemCABundles are the paths of the CA bundle of the host, the first one
+// that exists is used.
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// WithCABundle mounts the CA bundle of the host, followed by the
+// certificates of the PEM files, at the CABundleMountPaths in each hook and
+// stage and sets the CABundleEnvVars to it, so that the tools in the
+// containers trust the CAs of the host, such as the CA of a proxy that
+// intercepts TLS. The bundle is written to the cache directory of the user.
+// The environment variables and the mounts of an image take precedence.
+func WithCABundle(files ...string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		caFiles := append([]string(nil), files...)
+		m.caFiles = &caFiles
+	}
+}
+
+// hostCABundle returns the content of the CA bundle of the host, or nil if
+// it has none.
+func hostCABundle() ([]byte, error) {
+	for _, path := range systemCABundles {
+		content, err := os.ReadFile(path)
+		if err == nil {
+			return content, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// writeCABundle writes the CA bundle of the host and the PEM files to a file
+// in the cache directory that is named after its checksum, so that the same
+// bundle is written once, and returns its path.
+func writeCABundle(files []string) (string, error) {
+	bundle, err := hostCABundle()
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("could not read the CA file: %w", err)
+		}
+		if block, _ := pem.Decode(content); block == nil {
+			return "", fmt.Errorf("no PEM encoded certificates found in the CA file %s", file)
+		}
+		if len(bundle) > 0 && !bytes.HasSuffix(bundle, []byte("\n")) {
+			bundle = append(bundle, '\n')
+		}
+		bundle = append(bundle, content...)
+	}
+	if len(bundle) == 0 {
+		return "", errors.New("no CA bundle found on the host and no CA files given")
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "atk", "ca")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%x.pem", sha256.Sum256(bundle)))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	tmp, err := os.CreateTemp(dir, ".bundle-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(bundle); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// withCABundle mounts the CA bundle in the image.
+func (m *DeployableModule) withCABundle(img *ImageInfo) error {
+	if m.caFiles == nil {
+		return nil
+	}
+	bundle, err := writeCABundle(*m.caFiles)
+	if err != nil {
+		return err
+	}
+	for _, mountPath := range CABundleMountPaths {
+		if !hasMount(*img, mountPath) {
+			img.Volumes = append(img.Volumes, VolumeInfo{Name: bundle, MountPath: mountPath})
+		}
+	}
+	for _, name := range CABundleEnvVars {
+		if !hasEnvVar(*img, name) {
+			img.EnvVars = append(img.EnvVars, EnvVarInfo{Name: name, Value: CABundleMountPaths[0]})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package atkmod
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// CacheMountPath is the path in the containers where the cache of
+// WithCacheVolume is mounted.
+const CacheMountPath = "/var/cache/atk"
+
+// CacheEnvVars are the environment variables that point the package
+// managers in the containers to their directories in the cache of
+// WithCacheVolume.
+var CacheEnvVars = []EnvVarInfo{
+	{Name: "TF_PLUGIN_CACHE_DIR", Value: path.Join(CacheMountPath, "terraform", "plugins")},
+	{Name: "PIP_CACHE_DIR", Value: path.Join(CacheMountPath, "pip")},
+	{Name: "npm_config_cache", Value: path.Join(CacheMountPath, "npm")},
+}
+
+// DefaultCacheDir returns the directory of the cache of the package
+// managers, which is in the cache directory of the user.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "atk", "cache"), nil
+}
+
+// WithCacheVolume mounts the local directory, or DefaultCacheDir if it is
+// empty, at CacheMountPath in each hook and stage and sets the CacheEnvVars,
+// so that the terraform providers and the pip and npm packages that are
+// downloaded by one stage or run are reused by the others. The directory is
+// shared by all of the modules that use it. The environment variables and
+// the mount of an image take precedence over the cache.
+//
+// The terraform plugin cache is not safe for concurrent use, so modules that
+// deploy at the same time, such as in a DeploymentPlan, should not share it.
+func WithCacheVolume(dir string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.cacheDir = &dir
+	}
+}
+
+// withCache mounts the cache in the image, creating the directories of the
+// package managers if needed.
+func (m *DeployableModule) withCache(img *ImageInfo) error {
+	if m.cacheDir == nil || hasMount(*img, CacheMountPath) {
+		return nil
+	}
+	dir := *m.cacheDir
+	if len(dir) == 0 {
+		var err error
+		if dir, err = DefaultCacheDir(); err != nil {
+			return err
+		}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range CacheEnvVars {
+		rel, _ := filepath.Rel(CacheMountPath, filepath.FromSlash(e.Value))
+		if err := os.MkdirAll(filepath.Join(dir, rel), 0755); err != nil {
+			return err
+		}
+		if !hasEnvVar(*img, e.Name) {
+			img.EnvVars = append(img.EnvVars, e)
+		}
+	}
+	img.Volumes = append(img.Volumes, VolumeInfo{Name: dir, MountPath: CacheMountPath})
+	return nil
+}
@@ -0,0 +1,128 @@
+package atkmod
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// CancelReasonEnvVar is the environment variable that has the reason of the
+// cancellation in the on_cancel image.
+const CancelReasonEnvVar = "ATK_CANCEL_REASON"
+
+// CancelledError is returned by Deploy when the deployment was cancelled
+// with Cancel.
+type CancelledError struct {
+	Module string
+	// State is the state that the deployment was in when it was cancelled.
+	State  State
+	Reason string
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("deployment of module %s was cancelled in state %s: %s", e.Module, e.State, e.Reason)
+}
+
+// Stopper is implemented by the runners that can stop a running container
+// by its name, so that a cancelled stage gets the chance to exit cleanly
+// before its command is killed.
+type Stopper interface {
+	Stop(ctx *RunContext, container string) error
+}
+
+// Stop stops the container with podman stop, which sends SIGTERM and then
+// SIGKILL after 10 seconds.
+func (r *CliModuleRunner) Stop(ctx *RunContext, container string) error {
+	path, global := r.PodmanCliCommandBuilder.globalArgs()
+	cmd := exec.Command(path, append(global, "stop", "--time", "10", container)...)
+	ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not stop container %s: %w: %s", container, err, out)
+	}
+	return nil
+}
+
+// Cancel stops the deployment: the container of the lifecycle stage that is
+// running is stopped, the on_cancel image of the module is run if it has
+// one, and the deployment moves to the Cancelled state. Deploy returns a
+// CancelledError with the reason, which is also recorded in the result. A
+// deployment that is not running is cancelled when Deploy is called.
+func (m *DeployableModule) Cancel(reason string) error {
+	m.stageMu.Lock()
+	if m.cancelled != nil {
+		m.stageMu.Unlock()
+		return nil
+	}
+	m.cancelled = &reason
+	state, cancelRun, include := m.running, m.cancelRun, m.runningInclude
+	m.stageMu.Unlock()
+
+	log := m.runCtx.Log.WithField(RunIDLogField, m.runID)
+	log.Infof("cancelling the deployment of module %s: %s", m.module.Metadata.Name, reason)
+	if stopper, ok := m.runner.(Stopper); ok && len(state) > 0 {
+		if err := stopper.Stop(m.runCtx, m.containerName(state)); err != nil {
+			log.Warnf("%v", err)
+		}
+	}
+	if include != nil {
+		include.Cancel(reason)
+	}
+	if cancelRun != nil {
+		cancelRun()
+	}
+	return nil
+}
+
+// IsCancelled returns true if the deployment was cancelled with Cancel.
+func (m *DeployableModule) IsCancelled() bool {
+	_, ok := m.cancelReason()
+	return ok
+}
+
+func (m *DeployableModule) cancelReason() (string, bool) {
+	m.stageMu.Lock()
+	defer m.stageMu.Unlock()
+	if m.cancelled == nil {
+		return "", false
+	}
+	return *m.cancelled, true
+}
+
+// setCancelRun sets the function that cancels the context of the stages
+// that Deploy runs.
+func (m *DeployableModule) setCancelRun(cancel context.CancelFunc) {
+	m.stageMu.Lock()
+	defer m.stageMu.Unlock()
+	m.cancelRun = cancel
+}
+
+// cancelledOr returns a CancelledError if the deployment was cancelled while
+// the stage ran, removing the errors that the runner recorded when the
+// container was stopped, or else the given error.
+func (m *DeployableModule) cancelledOr(ctx *RunContext, errCount int, state State, err error) error {
+	reason, ok := m.cancelReason()
+	if !ok || state == Cancelled {
+		return err
+	}
+	ctx.Errors = ctx.Errors[:errCount]
+	ctx.Reset()
+	return &CancelledError{Module: m.module.Metadata.Name, State: state, Reason: reason}
+}
+
+// finishCancel runs the on_cancel image of the module, if it has one, and
+// moves the deployment to the Cancelled state.
+func (m *DeployableModule) finishCancel(ctx *RunContext, parent context.Context, reason string) *CancelledError {
+	cancelled := &CancelledError{Module: m.module.Metadata.Name, State: m.machine.Current(), Reason: reason}
+	onCancel := m.module.Specifications.Lifecycle.OnCancel
+	if len(onCancel.Image) > 0 || len(onCancel.Script) > 0 || len(onCancel.Command) > 0 {
+		img := onCancel.DeepCopy()
+		img.EnvVars = append(img.EnvVars, EnvVarInfo{Name: CancelReasonEnvVar, Value: reason})
+		stageCtx := ctx.Child(string(Cancelled))
+		stageCtx.Context = parent
+		if err := m.runStage(stageCtx, Cancelled, img); err != nil {
+			ctx.Log.WithField(RunIDLogField, m.runID).Warnf("the on_cancel image of module %s failed: %v", m.module.Metadata.Name, err)
+		}
+	}
+	m.Notify(Cancelled)
+	return cancelled
+}
@@ -0,0 +1,314 @@
+package atkmod
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CatalogManifest is a manifest found by a CatalogSource.
+type CatalogManifest struct {
+	// Source is where the manifest was found, such as its path in a
+	// directory or the OCI reference that it was pulled from.
+	Source string
+	Module *ModuleInfo
+}
+
+// CatalogSource finds the manifests to index for a catalog.
+type CatalogSource interface {
+	Manifests(ctx *RunContext) ([]CatalogManifest, error)
+}
+
+// DirSource finds the manifests in a directory and its subdirectories. Every
+// YAML file that is a supported manifest is included; other YAML files are
+// skipped.
+type DirSource struct {
+	Dir string
+	// Loader loads the manifests. If it is nil, a loader without verifiers
+	// is used.
+	Loader *ManifestFileLoader
+}
+
+// Manifests returns the manifests in the directory, ordered by path.
+func (s *DirSource) Manifests(ctx *RunContext) ([]CatalogManifest, error) {
+	return manifestsInDir(ctx, s.Dir, s.Loader, func(rel string) string {
+		return filepath.Join(s.Dir, rel)
+	})
+}
+
+// manifestsInDir finds the manifests in the directory. The source of each
+// manifest is given by the source func from its path relative to the
+// directory.
+func manifestsInDir(ctx *RunContext, dir string, loader *ManifestFileLoader, source func(rel string) string) ([]CatalogManifest, error) {
+	if loader == nil {
+		loader = NewAtkManifestFileLoader()
+	}
+	var manifests []CatalogManifest
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		module, err := loader.Load(path)
+		if err != nil {
+			ctx.Logger().Debugf("skipping %s: %v", path, err)
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		manifests = append(manifests, CatalogManifest{Source: source(rel), Module: module})
+		return nil
+	})
+	return manifests, err
+}
+
+// GitSource finds the manifests in a git repository, which is cloned to a
+// temporary directory with the git command.
+type GitSource struct {
+	URL string
+	// Ref is the branch or tag to clone. If it is empty, the default branch
+	// is used.
+	Ref string
+	// Path is the path of the git command, git by default.
+	Path string
+}
+
+// Manifests clones the repository and returns the manifests in it, with
+// the URL of the repository followed by their paths as their sources.
+func (s *GitSource) Manifests(ctx *RunContext) ([]CatalogManifest, error) {
+	dir, err := os.MkdirTemp("", "atk-catalog-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--depth", "1"}
+	if len(s.Ref) > 0 {
+		args = append(args, "--branch", s.Ref)
+	}
+	cmd := exec.Command(Iif(s.Path, "git"), append(args, s.URL, dir)...)
+	ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("could not clone %s: %w: %s", s.URL, err, strings.TrimSpace(string(out)))
+	}
+	return manifestsInDir(ctx, dir, nil, func(rel string) string {
+		return strings.TrimSuffix(s.URL, "/") + "/" + filepath.ToSlash(rel)
+	})
+}
+
+// OCISource pulls manifests that are stored as OCI artifacts with the oras
+// command and finds the manifests in them.
+type OCISource struct {
+	Refs []string
+	// Path is the path of the oras command, oras by default.
+	Path string
+}
+
+// Manifests pulls each of the references and returns the manifests in them,
+// with the reference as their source.
+func (s *OCISource) Manifests(ctx *RunContext) ([]CatalogManifest, error) {
+	var manifests []CatalogManifest
+	for _, ref := range s.Refs {
+		dir, err := os.MkdirTemp("", "atk-catalog-")
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(Iif(s.Path, "oras"), "pull", ref, "-o", dir)
+		ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("could not pull %s: %w: %s", ref, err, strings.TrimSpace(string(out)))
+		}
+		found, err := manifestsInDir(ctx, dir, nil, func(string) string { return ref })
+		os.RemoveAll(dir)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, found...)
+	}
+	return manifests, nil
+}
+
+// CatalogEntry is a module in a CatalogIndex.
+type CatalogEntry struct {
+	Name      string            `json:"name" yaml:"name"`
+	Namespace string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Source    string            `json:"source" yaml:"source"`
+	// Variables are the variables reported by the list hook of the module.
+	Variables []EventDataVarInfo `json:"variables,omitempty" yaml:"variables,omitempty"`
+	// Images are the images of the hooks and lifecycle stages.
+	Images []string `json:"images,omitempty" yaml:"images,omitempty"`
+	// Error is why the list hook could not be run, if it failed.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// matches returns true if the term is found in the name, namespace, labels,
+// variables or images of the entry, ignoring case.
+func (e CatalogEntry) matches(term string) bool {
+	fields := []string{e.Name, e.Namespace}
+	for key, value := range e.Labels {
+		fields = append(fields, key, value)
+	}
+	for _, v := range e.Variables {
+		fields = append(fields, v.Name, v.Description)
+	}
+	fields = append(fields, e.Images...)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), term) {
+			return true
+		}
+	}
+	return false
+}
+
+// CatalogIndex is a searchable index of modules, the building block for a
+// module marketplace.
+type CatalogIndex struct {
+	GeneratedAt time.Time      `json:"generatedAt" yaml:"generatedAt"`
+	Modules     []CatalogEntry `json:"modules" yaml:"modules"`
+}
+
+// Search returns the modules that match all of the words of the query. An
+// empty query returns all of the modules.
+func (c *CatalogIndex) Search(query string) []CatalogEntry {
+	terms := strings.Fields(strings.ToLower(query))
+	var found []CatalogEntry
+	for _, entry := range c.Modules {
+		matched := true
+		for _, term := range terms {
+			if !entry.matches(term) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+// Save writes the index to the writer as indented JSON.
+func (c *CatalogIndex) Save(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+// LoadCatalogIndex reads an index written with Save.
+func LoadCatalogIndex(r io.Reader) (*CatalogIndex, error) {
+	index := &CatalogIndex{}
+	if err := json.NewDecoder(r).Decode(index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// CatalogBuilder builds a CatalogIndex from the manifests of the sources,
+// running their list hooks to find their variables.
+type CatalogBuilder struct {
+	Sources []CatalogSource
+	// Concurrency is the number of list hooks that run at the same time. If
+	// it is zero or less, the number of CPUs is used.
+	Concurrency int
+	// Options are applied to the deployment of each module, so the runner of
+	// the list hooks is set with WithRunner.
+	Options []DeployableModuleOption
+	// Selector limits the index to the modules whose labels match it.
+	Selector Selector
+}
+
+// Build finds the manifests of all of the sources and runs their list hooks.
+// A module whose list hook fails is still indexed, with the error. The
+// modules are ordered by namespace and name.
+func (b *CatalogBuilder) Build(ctx *RunContext) (*CatalogIndex, error) {
+	var manifests []CatalogManifest
+	for _, source := range b.Sources {
+		found, err := source.Manifests(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, manifest := range found {
+			if b.Selector.Matches(manifest.Module.Metadata.Labels) {
+				manifests = append(manifests, manifest)
+			}
+		}
+	}
+
+	modules := make([]*ModuleInfo, len(manifests))
+	for idx, manifest := range manifests {
+		modules[idx] = manifest.Module
+	}
+	results := RunHookAll(ctx, modules, ListHook, b.Concurrency, b.Options...)
+
+	index := &CatalogIndex{GeneratedAt: time.Now().UTC(), Modules: make([]CatalogEntry, 0, len(manifests))}
+	for idx, manifest := range manifests {
+		entry := newCatalogEntry(manifest)
+		if vars, err := listVariables(results[idx]); err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Variables = vars
+		}
+		index.Modules = append(index.Modules, entry)
+	}
+	sort.SliceStable(index.Modules, func(i, j int) bool {
+		a, b := index.Modules[i], index.Modules[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return index, nil
+}
+
+func newCatalogEntry(manifest CatalogManifest) CatalogEntry {
+	module := manifest.Module
+	entry := CatalogEntry{
+		Name:      module.Metadata.Name,
+		Namespace: module.Metadata.Namespace,
+		Labels:    copyStringMap(module.Metadata.Labels),
+		Source:    manifest.Source,
+	}
+	seen := make(map[string]bool)
+	for _, img := range stageImages(module) {
+		if len(img.Info.Image) > 0 && !seen[img.Info.Image] {
+			seen[img.Info.Image] = true
+			entry.Images = append(entry.Images, img.Info.Image)
+		}
+	}
+	return entry
+}
+
+// listVariables returns the variables of the list hook response in the
+// result.
+func listVariables(result HookResult) ([]EventDataVarInfo, error) {
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	for _, event := range result.Events {
+		if event.Type() != string(ListHookResponseEvent) {
+			continue
+		}
+		data, err := LoadEventData(event)
+		if err != nil {
+			return nil, fmt.Errorf("could not load list hook response data: %w", err)
+		}
+		return data.Variables, nil
+	}
+	return nil, fmt.Errorf("module %s did not write a list hook response", result.Module.Metadata.Name)
+}
@@ -0,0 +1,314 @@
+package atkmod
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrCheckpointNotSupported is returned by Suspend and Resume when the runner
+// of the deployment cannot checkpoint containers.
+var ErrCheckpointNotSupported = errors.New("the runner does not support checkpoints")
+
+// Checkpointer is implemented by the runners that can checkpoint a running
+// container to an archive and restore it later, such as the
+// CliModuleRunner with podman.
+type Checkpointer interface {
+	// Checkpoint saves the state of the running container to the archive and
+	// stops the container.
+	Checkpoint(ctx *RunContext, container string, archive string) error
+	// Restore restores the container from the archive and waits for it to
+	// exit, writing its output to the context.
+	Restore(ctx *RunContext, container string, archive string) error
+}
+
+// CheckpointInfo describes a stage that was suspended with Suspend. It is
+// saved next to the archive of the container, so the deployment can be
+// resumed by another process, for example after a reboot.
+type CheckpointInfo struct {
+	Module    string    `json:"module" yaml:"module"`
+	Namespace string    `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	RunID     string    `json:"runId" yaml:"runId"`
+	State     State     `json:"state" yaml:"state"`
+	Container string    `json:"container" yaml:"container"`
+	Archive   string    `json:"archive" yaml:"archive"`
+	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
+	// VariableNames are the names of the variables of the deployment whose
+	// values are not their defaults.
+	VariableNames []string `json:"variableNames,omitempty" yaml:"variableNames,omitempty"`
+	// Variables are those variables, with their values, encrypted with the
+	// key of WithVariableEncryption. It is nil if there was no key, in which
+	// case the values must be given again when the deployment is resumed.
+	Variables *SealedVariables `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// SuspendedError is returned by Deploy when the stage that was running was
+// suspended with Suspend. The deployment stays in the state of the stage and
+// can be continued with Resume.
+type SuspendedError struct {
+	Checkpoint CheckpointInfo
+}
+
+func (e *SuspendedError) Error() string {
+	return fmt.Sprintf("deployment was suspended in state %s to %s", e.Checkpoint.State, e.Checkpoint.Archive)
+}
+
+// DefaultCheckpointDir returns the directory used for the checkpoints when
+// no other directory is given, which is in the user's cache directory so that
+// it survives a reboot.
+func DefaultCheckpointDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "atk", "checkpoints"), nil
+}
+
+// WithCheckpointDir stores the checkpoints made by Suspend in the given
+// directory instead of DefaultCheckpointDir.
+func WithCheckpointDir(dir string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.checkpointDir = dir
+	}
+}
+
+// LoadCheckpoint loads the checkpoint of the given run of the module from
+// the directory.
+func LoadCheckpoint(dir string, module *ModuleInfo, runID string) (*CheckpointInfo, error) {
+	moduleDir, err := scopedDir(dir, module)
+	if err != nil {
+		return nil, err
+	}
+	return readCheckpoint(checkpointFile(moduleDir, runID))
+}
+
+func readCheckpoint(path string) (*CheckpointInfo, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &CheckpointInfo{}
+	if err := json.Unmarshal(content, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func checkpointFile(dir string, runID string) string {
+	return filepath.Join(dir, runID+".json")
+}
+
+// checkpointDirectory returns the directory of the checkpoints of the
+// module, which is scoped by its namespace and name.
+func (m *DeployableModule) checkpointDirectory() (string, error) {
+	dir := m.checkpointDir
+	if len(dir) == 0 {
+		var err error
+		if dir, err = DefaultCheckpointDir(); err != nil {
+			return "", err
+		}
+	}
+	return scopedDir(dir, m.module)
+}
+
+var invalidContainerNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// containerName returns the name of the container of the lifecycle stage that
+// runs in the given state, which is unique for each run of the deployment.
+func (m *DeployableModule) containerName(state State) string {
+	parts := []string{"atk"}
+	for _, part := range []string{namespaceOf(m.module), m.module.Metadata.Name, m.runID, string(state)} {
+		if len(part) > 0 {
+			parts = append(parts, part)
+		}
+	}
+	return invalidContainerNameChars.ReplaceAllString(strings.Join(parts, "-"), "-")
+}
+
+type containerNameContextKey struct{}
+
+// withContainerName sets the name that the runners give to the container.
+func withContainerName(ctx context.Context, name string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, containerNameContextKey{}, name)
+}
+
+// containerNameOf returns the name set with withContainerName, if any.
+func containerNameOf(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	name, _ := ctx.Value(containerNameContextKey{}).(string)
+	return name
+}
+
+func (m *DeployableModule) setRunning(state State) {
+	m.stageMu.Lock()
+	defer m.stageMu.Unlock()
+	m.running = state
+}
+
+// suspendedOr returns a SuspendedError if the stage was suspended while it
+// ran, removing the errors that the runner recorded when the container was
+// stopped, or else the given error.
+func (m *DeployableModule) suspendedOr(ctx *RunContext, errCount int, err error) error {
+	m.stageMu.Lock()
+	defer m.stageMu.Unlock()
+	if m.suspended == nil {
+		return err
+	}
+	ctx.Errors = ctx.Errors[:errCount]
+	ctx.Reset()
+	return &SuspendedError{Checkpoint: *m.suspended}
+}
+
+// Suspend checkpoints the container of the lifecycle stage that is running,
+// which stops it, so that the deployment can be continued later with Resume
+// instead of running the stage again. Deploy returns a SuspendedError once
+// the stage has stopped. The runner must implement Checkpointer. The values
+// of the variables are saved with the checkpoint only if they can be
+// encrypted, with WithVariableEncryption.
+func (m *DeployableModule) Suspend(ctx *RunContext) (*CheckpointInfo, error) {
+	checkpointer, ok := m.runner.(Checkpointer)
+	if !ok {
+		return nil, ErrCheckpointNotSupported
+	}
+	dir, err := m.checkpointDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	m.stageMu.Lock()
+	state := m.running
+	m.stageMu.Unlock()
+	if len(state) == 0 {
+		return nil, fmt.Errorf("module %s is not running a lifecycle stage", m.module.Metadata.Name)
+	}
+
+	info := CheckpointInfo{
+		Module:    m.module.Metadata.Name,
+		Namespace: m.module.Metadata.Namespace,
+		RunID:     m.runID,
+		State:     state,
+		Container: m.containerName(state),
+		Archive:   filepath.Join(dir, m.runID+".tar.gz"),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := m.sealVariables(ctx, &info); err != nil {
+		return nil, fmt.Errorf("could not save the variables of run %s: %w", m.runID, err)
+	}
+	content, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	// Marks the stage as suspended before the container is stopped, so the
+	// stage does not fail when the runner returns.
+	m.stageMu.Lock()
+	m.suspended = &info
+	m.stageMu.Unlock()
+	if err := checkpointer.Checkpoint(ctx, info.Container, info.Archive); err != nil {
+		m.stageMu.Lock()
+		m.suspended = nil
+		m.stageMu.Unlock()
+		return nil, fmt.Errorf("could not checkpoint container %s: %w", info.Container, err)
+	}
+	if err := os.WriteFile(checkpointFile(dir, m.runID), content, 0600); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Resume restores the container of the stage that was suspended with
+// Suspend, waits for it to finish and then continues the deployment with
+// Deploy. The checkpoint is loaded from the checkpoint directory, so a
+// deployment created with the same run ID, using WithRunID, can be resumed
+// by another process. The variables that were saved with the checkpoint are
+// restored; if their values were not saved, and are not given with
+// WithVariables, a MissingVariablesError is returned.
+func (m *DeployableModule) Resume(ctx *RunContext) (*DeploymentResult, error) {
+	checkpointer, ok := m.runner.(Checkpointer)
+	if !ok {
+		return nil, ErrCheckpointNotSupported
+	}
+	dir, err := m.checkpointDirectory()
+	if err != nil {
+		return nil, err
+	}
+	info, err := readCheckpoint(checkpointFile(dir, m.runID))
+	if err != nil {
+		return nil, fmt.Errorf("could not load the checkpoint of run %s: %w", m.runID, err)
+	}
+	if err := m.restoreVariables(info); err != nil {
+		return nil, err
+	}
+
+	m.stageMu.Lock()
+	m.suspended = nil
+	m.stageMu.Unlock()
+	if from := m.machine.Current(); from != info.State {
+		// The deployment carries on from the state that it was suspended in,
+		// which is not a transition of its execution order.
+		m.machine.Restore(info.State, from)
+		m.moved(from, info.State, nil)
+	}
+
+	started := time.Now().UTC()
+	stageCtx := ctx.Child(string(info.State))
+	err = checkpointer.Restore(stageCtx, info.Container, info.Archive)
+	if err == nil && info.State == Deploying && m.module.Specifications.Readiness != nil {
+		if err = m.waitUntilReady(stageCtx); err != nil {
+			stageCtx.AddError(err)
+		}
+	}
+	if err := m.finishStage(m, completedState(info.State), err); err != nil {
+		result := &DeploymentResult{
+			Module:    m.module.Metadata.Name,
+			Namespace: m.module.Metadata.Namespace,
+			RunID:     m.runID,
+			StartedAt: started,
+		}
+		result.notStarted(m.machine.Current(), err)
+		result.FailedState = info.State
+		return result, err
+	}
+
+	os.Remove(info.Archive)
+	os.Remove(checkpointFile(dir, m.runID))
+	return m.Deploy(ctx)
+}
+
+// Checkpoint checkpoints the running container with podman to the archive,
+// which stops the container.
+func (r *CliModuleRunner) Checkpoint(ctx *RunContext, container string, archive string) error {
+	path, global := r.PodmanCliCommandBuilder.globalArgs()
+	cmd := exec.Command(path, append(global, "container", "checkpoint", "--export", archive, container)...)
+	ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+	return execCmd(ctx, cmd)
+}
+
+// Restore restores the container with podman from the archive and attaches
+// to it until it exits.
+func (r *CliModuleRunner) Restore(ctx *RunContext, container string, archive string) error {
+	path, global := r.PodmanCliCommandBuilder.globalArgs()
+	restore := exec.Command(path, append(global, "container", "restore", "--import", archive, "--name", container)...)
+	ctx.logCommand("running command: %s", shellJoin(restore.Args))
+	if err := execCmd(ctx, restore); err != nil {
+		return err
+	}
+	attach := exec.Command(path, append(global, "attach", "--no-stdin", container)...)
+	ctx.logCommand("running command: %s", shellJoin(attach.Args))
+	return execCmd(ctx, attach)
+}
@@ -0,0 +1,240 @@
+package atkmod
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CliPartsError is returned by Validate with all of the problems found in
+// the parts of a podman command.
+type CliPartsError struct {
+	Problems []string
+}
+
+func (e *CliPartsError) Error() string {
+	return fmt.Sprintf("invalid podman command: %s", strings.Join(e.Problems, "; "))
+}
+
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks the parts of the command for the problems that would make
+// podman fail: a run command without an image, malformed port and uid maps,
+// invalid volumes, and the conflicts: duplicate environment variables,
+// volumes that mount the same path in the container and port maps that bind
+// the same port of the host. All of the problems are returned at once in a
+// *CliPartsError, or nil if there are none.
+func (p *CliParts) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(strings.TrimSpace(p.Path)) == 0 {
+		add("the path of podman is empty")
+	}
+	if fields := strings.Fields(p.Cmd); len(fields) > 0 && fields[0] == "run" && len(p.Image) == 0 {
+		add("an image is required to run a container")
+	}
+
+	for idx, port := range p.Ports {
+		if !validHostPort(port.Local) || !validContainerPort(port.Container) {
+			add("invalid port map %s", port)
+		} else if other, ok := p.duplicatePort(idx); ok {
+			add(portConflict, other, port)
+		}
+	}
+
+	for _, uidMap := range p.UidMaps {
+		if !validUidMap(uidMap) {
+			add("invalid uid map %s; expected container:host:size", uidMap)
+		}
+	}
+
+	seen := make(map[string]bool, len(p.Envvars))
+	for _, envvar := range p.Envvars {
+		switch {
+		case !envVarName.MatchString(envvar.Name):
+			add("invalid environment variable name %q", envvar.Name)
+		case seen[envvar.Name]:
+			add(envvarConflict, envvar.Name)
+		}
+		seen[envvar.Name] = true
+	}
+
+	for idx, volMap := range p.VolumeMaps {
+		if problem := volumeProblem(volMap); len(problem) > 0 {
+			add("invalid volume %s: %s", volMap, problem)
+		} else if other, ok := p.duplicateVolume(idx); ok {
+			add(volumeConflict, other, volMap, volumeTarget(volMap))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &CliPartsError{Problems: problems}
+	}
+	return nil
+}
+
+// The messages of the conflicts.
+const (
+	envvarConflict = "duplicate environment variable %s"
+	volumeConflict = "volumes %s and %s both mount %s in the container"
+	portConflict   = "port maps %s and %s bind the same port of the host"
+)
+
+// conflicts returns the problems of the parts that are given more than
+// once, which Validate reports as well, and which podman would otherwise
+// fail on with a cryptic message or resolve silently.
+func (p *CliParts) conflicts() error {
+	var problems []string
+	for idx, port := range p.Ports {
+		if other, ok := p.duplicatePort(idx); ok {
+			problems = append(problems, fmt.Sprintf(portConflict, other, port))
+		}
+	}
+	seen := make(map[string]bool, len(p.Envvars))
+	for _, envvar := range p.Envvars {
+		if seen[envvar.Name] {
+			problems = append(problems, fmt.Sprintf(envvarConflict, envvar.Name))
+		}
+		seen[envvar.Name] = true
+	}
+	for idx, volMap := range p.VolumeMaps {
+		if other, ok := p.duplicateVolume(idx); ok {
+			problems = append(problems, fmt.Sprintf(volumeConflict, other, volMap, volumeTarget(volMap)))
+		}
+	}
+	if len(problems) > 0 {
+		return &CliPartsError{Problems: problems}
+	}
+	return nil
+}
+
+// duplicatePort returns the port map before the one at the index that binds
+// the same port of the host, for the same protocol, on the same address or
+// on all of the addresses.
+func (p *CliParts) duplicatePort(idx int) (PortMap, bool) {
+	addr, port, protocol := hostBinding(p.Ports[idx])
+	for _, other := range p.Ports[:idx] {
+		otherAddr, otherPort, otherProtocol := hostBinding(other)
+		if port == otherPort && protocol == otherProtocol && (addr == otherAddr || isAnyAddr(addr) || isAnyAddr(otherAddr)) {
+			return other, true
+		}
+	}
+	return PortMap{}, false
+}
+
+// hostBinding returns the address and the port of the host that the port map
+// binds, and its protocol, which is tcp if it has none.
+func hostBinding(port PortMap) (string, string, string) {
+	addr, hostPort := "", port.Local
+	if idx := strings.LastIndex(port.Local, ":"); idx >= 0 {
+		addr, hostPort = port.Local[:idx], port.Local[idx+1:]
+	}
+	protocol := "tcp"
+	if _, p, found := strings.Cut(port.Container, "/"); found {
+		protocol = p
+	}
+	return addr, hostPort, protocol
+}
+
+// isAnyAddr returns true if the address binds all of the addresses of the
+// host.
+func isAnyAddr(addr string) bool {
+	switch addr {
+	case "", "0.0.0.0", "::", "[::]":
+		return true
+	}
+	return false
+}
+
+// duplicateVolume returns the volume map before the one at the index that
+// mounts the same path in the container.
+func (p *CliParts) duplicateVolume(idx int) (string, bool) {
+	target := volumeTarget(p.VolumeMaps[idx])
+	if len(target) == 0 {
+		return "", false
+	}
+	for _, other := range p.VolumeMaps[:idx] {
+		if volumeTarget(other) == target {
+			return other, true
+		}
+	}
+	return "", false
+}
+
+// volumeTarget returns the clean path in the container of the volume map,
+// or an empty string if it has none.
+func volumeTarget(volMap string) string {
+	parts := strings.Split(volMap, ":")
+	if len(parts) < 2 || !strings.HasPrefix(parts[1], "/") {
+		return ""
+	}
+	return path.Clean(parts[1])
+}
+
+// Validate checks the parts of the command that the builder has so far.
+// See CliParts.Validate.
+func (b *PodmanCliCommandBuilder) Validate() error {
+	return b.parts.Validate()
+}
+
+// validPort returns true if the value is a port number.
+func validPort(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port > 0 && port <= 65535
+}
+
+// validHostPort returns true for a port on the host, which may have the
+// address to bind to, such as 127.0.0.1:8080.
+func validHostPort(value string) bool {
+	if idx := strings.LastIndex(value, ":"); idx >= 0 {
+		value = value[idx+1:]
+	}
+	return validPort(value)
+}
+
+// validContainerPort returns true for a port in the container, which may
+// have the protocol, such as 53/udp.
+func validContainerPort(value string) bool {
+	port, protocol, found := strings.Cut(value, "/")
+	if found && protocol != "tcp" && protocol != "udp" && protocol != "sctp" {
+		return false
+	}
+	return validPort(port)
+}
+
+// validUidMap returns true for a uid map of container:host:size.
+func validUidMap(value string) bool {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i == 2 && n == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// volumeProblem returns what is wrong with the volume map of
+// local:container[:options], or an empty string.
+func volumeProblem(volMap string) string {
+	parts := strings.Split(volMap, ":")
+	switch {
+	case len(parts) < 2 || len(parts) > 3:
+		return "expected local:container[:options]"
+	case len(parts[0]) == 0:
+		return "the local path or volume name is empty"
+	case !strings.HasPrefix(parts[1], "/"):
+		return "the path in the container must be absolute"
+	case len(parts) == 3 && len(parts[2]) == 0:
+		return "the options are empty"
+	}
+	return ""
+}
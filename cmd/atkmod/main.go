@@ -0,0 +1,796 @@
+// Command atkmod is a small command line tool for module authors that
+// validates, plans, deploys and runs the hooks of a module manifest without
+// requiring the itz CLI. It only uses the public API of the atkmod library.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	logger "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `Usage: atkmod <command> [options] <manifest>
+
+Commands:
+  init        prints a starter manifest for a new module
+  validate    validates the manifest file
+  plan        explains what will run for the manifest, in order
+  deploy      runs the full lifecycle of the manifest
+  preflight   checks that the host meets the requirements of the manifest
+  hook run    runs the given hook (list, validate or get_state)
+  state       runs the get_state hook for the manifest
+  diff        shows what a re-deploy would change, using the get_state hook
+  catalog     prints a JSON index of the manifests in the given directories
+  complete    prints the completions of a NAME=VALUE variable, for shell completion
+  helper      pins (pin), vendors (save <archive>) or loads (load <archive>) the helper image
+
+Run "atkmod <command> -h" for the options of the command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, out io.Writer, errOut io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(errOut, usage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "init":
+		err = initCmd(args[1:], out, errOut)
+	case "validate":
+		err = validateCmd(args[1:], out, errOut)
+	case "plan":
+		err = planCmd(args[1:], out, errOut)
+	case "deploy":
+		err = deployCmd(args[1:], out, errOut)
+	case "preflight":
+		err = preflightCmd(args[1:], out, errOut)
+	case "hook":
+		if len(args) < 2 || args[1] != "run" {
+			fmt.Fprint(errOut, usage)
+			return 2
+		}
+		err = hookCmd(args[2:], out, errOut)
+	case "state":
+		err = stateCmd(args[1:], out, errOut)
+	case "diff":
+		err = diffCmd(args[1:], out, errOut)
+	case "catalog":
+		err = catalogCmd(args[1:], out, errOut)
+	case "complete":
+		err = completeCmd(args[1:], out, errOut)
+	case "helper":
+		err = helperCmd(args[1:], out, errOut)
+	case "help", "-h", "--help":
+		fmt.Fprint(out, usage)
+		return 0
+	default:
+		fmt.Fprintf(errOut, "unknown command: %s\n\n%s", args[0], usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(errOut, "error: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// commonFlags are the flags shared by all of the commands.
+type commonFlags struct {
+	verbose   bool
+	quiet     bool
+	runner    string
+	workspace string
+	checksum  string
+	keyFile   string
+	errOut    io.Writer
+	// loader is the loader of the manifest, which loads its includes.
+	loader *atk.ManifestFileLoader
+}
+
+func newFlagSet(name string, errOut io.Writer, opts *commonFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	opts.errOut = errOut
+	fs.BoolVar(&opts.verbose, "v", false, "enables debug logging and shows the progress of pulling images")
+	fs.BoolVar(&opts.quiet, "q", false, "does not print the commands that are run or the output of the lifecycle stages")
+	fs.StringVar(&opts.runner, "runner", "podman", "the runner used for the images (podman, local or wasm, which runs WASI hooks with the wazero CLI)")
+	fs.StringVar(&opts.workspace, "workspace", "", "the local directory used as the workspace by the local and wasm runners")
+	fs.StringVar(&opts.checksum, "sha256", "", "verifies that the manifest has the given sha256 checksum before loading it")
+	fs.StringVar(&opts.keyFile, "key", "", "verifies the signature in <manifest>.sig with the PEM public keys in the given file before loading the manifest")
+	return fs
+}
+
+// newRunner creates the runner selected by the flags. It is a variable so
+// that the tests can replace it with a fake runner.
+var newRunner = func(opts *commonFlags) (atk.ImageRunner, error) {
+	switch opts.runner {
+	case "podman", "":
+		return atk.DefaultConfig().PodmanRunner(), nil
+	case "local":
+		return atk.NewLocalModuleRunner(opts.workspace), nil
+	case "wasm":
+		return atk.NewWazeroCliRunner(opts.workspace), nil
+	default:
+		return nil, fmt.Errorf("unknown runner: %s", opts.runner)
+	}
+}
+
+func loadManifest(fs *flag.FlagSet, opts *commonFlags) (*atk.ModuleInfo, error) {
+	if fs.NArg() != 1 {
+		return nil, fmt.Errorf("expected exactly one manifest file, got %d", fs.NArg())
+	}
+	loaderOpts := []atk.ManifestLoaderOption{atk.WithDefaults(atk.DefaultConfig().ManifestDefaults())}
+	if len(opts.checksum) > 0 {
+		loaderOpts = append(loaderOpts, atk.WithManifestVerifier(&atk.ChecksumVerifier{SHA256: opts.checksum}))
+	}
+	if len(opts.keyFile) > 0 {
+		content, err := os.ReadFile(opts.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := atk.ParsePublicKeys(content)
+		if err != nil {
+			return nil, err
+		}
+		loaderOpts = append(loaderOpts, atk.WithManifestVerifier(&atk.SignatureVerifier{Keys: keys}))
+	}
+	opts.loader = atk.NewAtkManifestFileLoader(loaderOpts...)
+	module, err := opts.loader.Load(fs.Arg(0))
+	if report := opts.loader.Applied(); report != nil && !opts.quiet {
+		for _, applied := range report.Applied {
+			fmt.Fprintf(opts.errOut, "%s: default applied: %s\n", fs.Arg(0), applied)
+		}
+		for _, warning := range report.Warnings {
+			fmt.Fprintf(opts.errOut, "%s: warning: %s\n", fs.Arg(0), warning)
+		}
+	}
+	return module, err
+}
+
+func newRunContext(out io.Writer, errOut io.Writer, opts *commonFlags) *atk.RunContext {
+	level, verbosity := logger.InfoLevel, atk.VerbosityNormal
+	switch {
+	case opts.verbose:
+		level, verbosity = logger.DebugLevel, atk.VerbosityDebug
+	case opts.quiet:
+		verbosity = atk.VerbositySilent
+	}
+	return &atk.RunContext{
+		Context: context.Background(),
+		In:      os.Stdin,
+		Out:     out,
+		Err:     errOut,
+		Log: logger.Logger{
+			Out:       errOut,
+			Formatter: new(logger.TextFormatter),
+			Hooks:     make(logger.LevelHooks),
+			Level:     level,
+		},
+		Verbosity: verbosity,
+	}
+}
+
+func initCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("init", errOut, opts)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("usage: atkmod init <name> [image...]")
+	}
+	module := atk.NewModuleScaffold(fs.Arg(0), fs.Args()[1:]...)
+	return module.Save(out)
+}
+
+func validateCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("validate", errOut, opts)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	module, err := loadManifest(fs, opts)
+	if err != nil {
+		return err
+	}
+	findings := atk.Lint(module)
+	for _, f := range findings {
+		fmt.Fprintf(out, "%s: %s\n", fs.Arg(0), f.String())
+	}
+	if atk.HasErrors(findings) {
+		return fmt.Errorf("manifest for module %s has errors", module.Metadata.Name)
+	}
+	fmt.Fprintf(out, "%s: manifest for module %s is valid\n", fs.Arg(0), module.Metadata.Name)
+	return nil
+}
+
+func planCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("plan", errOut, opts)
+	format := fs.String("o", "text", "the format of the plan (text, table, markdown, yaml or json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	module, err := loadManifest(fs, opts)
+	if err != nil {
+		return err
+	}
+
+	deployment := atk.NewDeployableModule(newRunContext(out, errOut, opts), module)
+	switch *format {
+	case "text", "":
+		fmt.Fprint(out, deployment.Explain())
+		return nil
+	case "table":
+		return deployment.Plan().Summary().WriteText(out)
+	case "markdown":
+		return deployment.Plan().Summary().WriteMarkdown(out)
+	case "yaml":
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		return encoder.Encode(deployment.Plan())
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(deployment.Plan())
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+}
+
+func deployCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("deploy", errOut, opts)
+	config := atk.DefaultConfig()
+	timeout := fs.Duration("timeout", config.DeployTimeout, "the time limit for the whole deployment, such as 30m (no limit by default)")
+	status := fs.Bool("status", false, "prints the status of the deployment as YAML when it finishes")
+	summary := fs.String("summary", "", "prints a summary of the deployment when it finishes, as a table or as markdown")
+	provenance := fs.String("provenance", "", "writes the SLSA provenance of a successful deployment as JSON to the given file")
+	transcript := fs.String("transcript", "", "writes a transcript of the deployment to the given directory, or .tar.gz file, for support tickets")
+	var notify stringsFlag
+	fs.Var(&notify, "notify", "sends a notification when the deployment finishes: desktop, slack:<webhook url> or webhook:<url> (can be repeated)")
+	scan := fs.String("scan", "", "scans the images for vulnerabilities before deploying, with trivy or grype")
+	severity := fs.String("severity", string(atk.VulnCritical), "the lowest severity of the vulnerabilities that stop the deployment with -scan")
+	kubeconfig := fs.String("kubeconfig", "", "mounts the given kubeconfig file in the hooks and stages and sets KUBECONFIG")
+	aws := fs.Bool("aws", false, "passes the AWS credentials of the environment and ~/.aws to the hooks and stages")
+	ibmcloud := fs.Bool("ibmcloud", false, "passes the IBM Cloud API key of the keychain, or else of the environment, to the hooks and stages")
+	deadLetters := fs.String("dead-letters", "", "keeps the output of the hooks that could not be understood in the given directory")
+	terraform := fs.Bool("terraform", false, "passes the variables to the hooks and stages as TF_VAR_ variables and writes them to the workspace as a tfvars file")
+	artifacts := fs.String("artifacts", "", "copies the artifacts of the stages to the given directory instead of the default one")
+	cache := fs.Bool("cache", false, "mounts a cache for the terraform providers and the pip and npm packages that is kept across runs")
+	ca := fs.Bool("ca", false, "mounts the CA bundle of the host, with the caBundle of the configuration, in the hooks and stages")
+	var vars varsFlag
+	fs.Var(&vars, "var", "a NAME=VALUE variable of the deployment, which is sent to the validate hook; can be repeated")
+	confirm := fs.Bool("confirm", false, "asks before running each image of a manifest that is not under one of the -trust paths or URLs")
+	var trusted stringsFlag
+	fs.Var(&trusted, "trust", "a path or URL whose manifests are run without asking with -confirm (can be repeated)")
+	var allowedMounts stringsFlag
+	fs.Var(&allowedMounts, "allow-mount", "a host path that the manifest may mount even though the mount policy denies it (can be repeated)")
+	ephemeralUser := fs.Bool("ephemeral-user", false, "runs the stages as a non-root user and gives the files in the workspace back to you afterwards")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *summary != "" && *summary != "table" && *summary != "markdown" {
+		return fmt.Errorf("unknown summary format %s", *summary)
+	}
+	module, err := loadManifest(fs, opts)
+	if err != nil {
+		return err
+	}
+
+	includes, err := opts.loader.LoadIncludes(module)
+	if err != nil {
+		return err
+	}
+
+	runner, err := newRunner(opts)
+	if err != nil {
+		return err
+	}
+	runCtx := newRunContext(out, errOut, opts)
+	options := []atk.DeployableModuleOption{atk.WithRunner(runner),
+		atk.WithLocker(atk.NewLocker(config.LockDir())), atk.WithDeadline(*timeout), atk.WithVariables(vars...),
+		atk.WithIncludes(includes...)}
+	notifiers, err := newNotifiers(notify)
+	if err != nil {
+		return err
+	}
+	if len(notifiers) > 0 {
+		options = append(options, atk.WithNotifiers(notifiers...))
+	}
+	if atk.IsTerminal(out) {
+		options = append(options, atk.WithOutputDecorator(atk.NewOutputDecorator(out)))
+	}
+	if root := config.WorkspaceRoot(); len(root) > 0 {
+		options = append(options, atk.WithWorkspaceRoot(root))
+	}
+	if len(*transcript) > 0 {
+		options = append(options, atk.WithTranscript(*transcript))
+	}
+	if len(*kubeconfig) > 0 {
+		options = append(options, atk.WithKubeconfig(*kubeconfig))
+	}
+	if *aws {
+		options = append(options, atk.WithAWSCredentials())
+	}
+	if *ibmcloud {
+		options = append(options, atk.WithIBMCloudAPIKey(atk.NewKeychainStore()))
+	}
+	if *terraform {
+		options = append(options, atk.WithTerraformVariables())
+	}
+	if len(*artifacts) > 0 {
+		options = append(options, atk.WithArtifactsDir(*artifacts))
+	}
+	if *cache {
+		dir, err := config.CacheDir()
+		if err != nil {
+			return err
+		}
+		options = append(options, atk.WithCacheVolume(dir))
+	}
+	if len(allowedMounts) > 0 {
+		options = append(options, atk.WithAllowedMounts(allowedMounts...))
+	}
+	if *ephemeralUser {
+		options = append(options, atk.WithEphemeralUser())
+	}
+	if *ca {
+		var files []string
+		if len(config.CABundle) > 0 {
+			files = append(files, config.CABundle)
+		}
+		options = append(options, atk.WithCABundle(files...))
+	}
+	if len(*deadLetters) > 0 {
+		options = append(options, atk.WithDeadLetters(atk.NewDirDeadLetterQueue(*deadLetters)))
+	}
+	if len(*scan) > 0 {
+		scanner, err := newVulnScanner(*scan, *severity)
+		if err != nil {
+			return err
+		}
+		options = append(options, scanner)
+	}
+	if *confirm {
+		trustOpts, err := newTrustPolicy(fs.Arg(0), trusted, errOut)
+		if err != nil {
+			return err
+		}
+		options = append(options, trustOpts...)
+	}
+	if len(*provenance) > 0 {
+		var digest atk.DigestResolver
+		if opts.runner == "podman" {
+			digest = atk.PodmanImageDigest("")
+		}
+		options = append(options, atk.WithProvenance(digest))
+	}
+	deployment := atk.NewDeployableModule(runCtx, module, options...)
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		if _, ok := <-interrupts; ok {
+			deployment.Cancel("interrupted")
+		}
+	}()
+	result, err := deployment.Deploy(runCtx)
+	if *status {
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		if serr := encoder.Encode(deployment.Status()); serr != nil {
+			return serr
+		}
+	}
+	if !opts.quiet {
+		for _, artifact := range result.Artifacts {
+			fmt.Fprintf(errOut, "artifact of %s: %s\n", artifact.State, artifact.File)
+		}
+	}
+	switch *summary {
+	case "table":
+		if serr := result.Summary().WriteText(out); serr != nil {
+			return serr
+		}
+	case "markdown":
+		if serr := result.Summary().WriteMarkdown(out); serr != nil {
+			return serr
+		}
+	}
+	var cancelled *atk.CancelledError
+	if errors.As(err, &cancelled) {
+		return err
+	}
+	if err != nil {
+		printFailure(errOut, result.Failure)
+		return fmt.Errorf("deployment failed in state %s: %w", result.FailedState, err)
+	}
+	fmt.Fprintf(errOut, "module %s deployed\n", module.Metadata.Name)
+	if len(*provenance) > 0 && result.Provenance != nil {
+		content, err := json.MarshalIndent(result.Provenance, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(*provenance, append(content, '\n'), 0644)
+	}
+	return nil
+}
+
+// printFailure prints the exit code, the command and the end of the error
+// stream of the stage that the deployment failed in.
+func printFailure(errOut io.Writer, failure *atk.FailureDiagnostics) {
+	if failure == nil {
+		return
+	}
+	if failure.ExitCode != 0 {
+		fmt.Fprintf(errOut, "stage %s exited with code %d\n", failure.State, failure.ExitCode)
+	}
+	if len(failure.Command) > 0 {
+		fmt.Fprintf(errOut, "command: %s\n", strings.Join(failure.Command, " "))
+	}
+	for _, line := range failure.Stderr {
+		fmt.Fprintf(errOut, "  %s\n", line)
+	}
+}
+
+// trustPrompt is where the answers to -confirm are read from. It is a
+// variable so that the tests can answer.
+var trustPrompt io.Reader = os.Stdin
+
+// newTrustPolicy creates the options that ask on the error stream before
+// each image of the manifest is run, unless it is under one of the trusted
+// paths or URLs.
+func newTrustPolicy(manifest string, trusted []string, errOut io.Writer) ([]atk.DeployableModuleOption, error) {
+	source, err := filepath.Abs(manifest)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]string, 0, len(trusted))
+	for _, t := range trusted {
+		if !strings.Contains(t, "://") {
+			if t, err = filepath.Abs(t); err != nil {
+				return nil, err
+			}
+		}
+		sources = append(sources, t)
+	}
+	answers := bufio.NewReader(trustPrompt)
+	policy := atk.TrustPolicyFunc(func(ctx *atk.RunContext, req atk.TrustRequest) (bool, error) {
+		fmt.Fprintf(errOut, "%s\n", req)
+		if len(req.Command) > 0 || len(req.Args) > 0 {
+			fmt.Fprintf(errOut, "  command: %s\n", strings.Join(append(append([]string(nil), req.Command...), req.Args...), " "))
+		}
+		if len(req.EnvNames) > 0 {
+			fmt.Fprintf(errOut, "  env: %s\n", strings.Join(req.EnvNames, ", "))
+		}
+		if len(req.Network) > 0 {
+			fmt.Fprintf(errOut, "  network: %s\n", req.Network)
+		}
+		fmt.Fprint(errOut, "continue? [y/N] ")
+		answer, err := answers.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes", nil
+	})
+	return []atk.DeployableModuleOption{atk.WithManifestSource(source), atk.WithTrustPolicy(policy, sources...)}, nil
+}
+
+// newVulnScanner creates the option that scans the images with the scanner
+// given with -scan.
+func newVulnScanner(name string, severity string) (atk.DeployableModuleOption, error) {
+	threshold, err := atk.ParseVulnSeverity(severity)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "trivy":
+		return atk.WithVulnScan(atk.NewTrivyScanner(), threshold), nil
+	case "grype":
+		return atk.WithVulnScan(atk.NewGrypeScanner(), threshold), nil
+	default:
+		return nil, fmt.Errorf("unknown scanner %s; use trivy or grype", name)
+	}
+}
+
+// newNotifiers creates the notifiers given with -notify.
+func newNotifiers(values []string) ([]atk.DeploymentNotifier, error) {
+	notifiers := make([]atk.DeploymentNotifier, 0, len(values))
+	for _, value := range values {
+		kind, url, _ := strings.Cut(value, ":")
+		switch {
+		case kind == "desktop":
+			notifiers = append(notifiers, &atk.DesktopNotifier{})
+		case kind == "slack" && len(url) > 0:
+			notifiers = append(notifiers, atk.NewSlackNotifier(url))
+		case kind == "webhook" && len(url) > 0:
+			notifiers = append(notifiers, atk.NewWebhookNotifier(url))
+		default:
+			return nil, fmt.Errorf("invalid notifier %q; expected desktop, slack:<webhook url> or webhook:<url>", value)
+		}
+	}
+	return notifiers, nil
+}
+
+// varsFlag collects the NAME=VALUE variables given with -var.
+type varsFlag []atk.EventDataVarInfo
+
+func (v *varsFlag) String() string {
+	names := make([]string, 0, len(*v))
+	for _, info := range *v {
+		names = append(names, info.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (v *varsFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, "=")
+	if !ok || len(name) == 0 {
+		return fmt.Errorf("expected NAME=VALUE, got %s", value)
+	}
+	*v = append(*v, atk.EventDataVarInfo{Name: name, Value: val})
+	return nil
+}
+
+// stringsFlag collects the values of a flag that can be repeated.
+type stringsFlag []string
+
+func (v *stringsFlag) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *stringsFlag) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+func catalogCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("catalog", errOut, opts)
+	var repos, refs stringsFlag
+	fs.Var(&repos, "git", "also indexes the manifests in the git repository with the given URL (can be repeated)")
+	fs.Var(&refs, "oci", "also indexes the manifests in the OCI artifact with the given reference, pulled with oras (can be repeated)")
+	labels := fs.String("l", "", "only indexes the modules whose labels match the selector, such as tier=demo,cloud in (aws,azure)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	selector, err := atk.ParseSelector(*labels)
+	if err != nil {
+		return err
+	}
+
+	var sources []atk.CatalogSource
+	for _, dir := range fs.Args() {
+		sources = append(sources, &atk.DirSource{Dir: dir})
+	}
+	for _, repo := range repos {
+		sources = append(sources, &atk.GitSource{URL: repo})
+	}
+	if len(refs) > 0 {
+		sources = append(sources, &atk.OCISource{Refs: refs})
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("expected at least one directory, -git or -oci source")
+	}
+
+	runner, err := newRunner(opts)
+	if err != nil {
+		return err
+	}
+	runCtx := newRunContext(out, errOut, opts)
+	builder := &atk.CatalogBuilder{Sources: sources, Selector: selector, Options: []atk.DeployableModuleOption{atk.WithRunner(runner)}}
+	index, err := builder.Build(runCtx)
+	if err != nil {
+		return err
+	}
+	return index.Save(out)
+}
+
+func hookCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("hook run", errOut, opts)
+	var vars varsFlag
+	fs.Var(&vars, "var", "a NAME=VALUE variable sent to the validate hook; can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: atkmod hook run <hook> <manifest>")
+	}
+	name := atk.Hook(fs.Arg(0))
+	module, err := atk.NewAtkManifestFileLoader().Load(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if name == atk.ValidateHook {
+		return runValidate(module, atk.EventData{Variables: vars}, out, errOut, opts)
+	}
+	return runHook(module, name, out, errOut, opts)
+}
+
+func preflightCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("preflight", errOut, opts)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	module, err := loadManifest(fs, opts)
+	if err != nil {
+		return err
+	}
+	runCtx := newRunContext(out, errOut, opts)
+	deployment := atk.NewDeployableModule(runCtx, module)
+	result, err := deployment.Preflight(runCtx)
+	for _, check := range result.Checks {
+		status := "ok"
+		if !check.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(out, "%-4s %s\n", status, check)
+	}
+	return err
+}
+
+func stateCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("state", errOut, opts)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	module, err := loadManifest(fs, opts)
+	if err != nil {
+		return err
+	}
+	return runHook(module, atk.GetStateHook, out, errOut, opts)
+}
+
+func completeCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("complete", errOut, opts)
+	word := fs.String("word", "", "the NAME=VALUE variable that is being typed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	module, err := loadManifest(fs, opts)
+	if err != nil {
+		return err
+	}
+	runner, err := newRunner(opts)
+	if err != nil {
+		return err
+	}
+	runCtx := newRunContext(io.Discard, errOut, opts)
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	completions, err := deployment.Complete(runCtx, *word)
+	if err != nil {
+		return err
+	}
+	// The value and the description are separated by a tab, as zsh and
+	// fish expect them.
+	for _, c := range completions {
+		if len(c.Description) > 0 {
+			fmt.Fprintf(out, "%s\t%s\n", c.Value, c.Description)
+		} else {
+			fmt.Fprintln(out, c.Value)
+		}
+	}
+	return nil
+}
+
+func helperCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("helper", errOut, opts)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	runner, err := newRunner(opts)
+	if err != nil {
+		return err
+	}
+	podman, ok := runner.(*atk.CliModuleRunner)
+	if !ok {
+		return fmt.Errorf("the helper image is only used by the podman runner")
+	}
+	runCtx := newRunContext(out, errOut, opts)
+	switch {
+	case fs.NArg() == 1 && fs.Arg(0) == "pin":
+		image, err := podman.PinHelperImage(runCtx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, image)
+		return nil
+	case fs.NArg() == 2 && fs.Arg(0) == "save":
+		return podman.SaveHelperImage(runCtx, fs.Arg(1))
+	case fs.NArg() == 2 && fs.Arg(0) == "load":
+		return podman.LoadHelperImage(runCtx, fs.Arg(1))
+	default:
+		return fmt.Errorf("expected pin, save <archive> or load <archive>")
+	}
+}
+
+func diffCmd(args []string, out io.Writer, errOut io.Writer) error {
+	opts := &commonFlags{}
+	fs := newFlagSet("diff", errOut, opts)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	module, err := loadManifest(fs, opts)
+	if err != nil {
+		return err
+	}
+	runner, err := newRunner(opts)
+	if err != nil {
+		return err
+	}
+	runCtx := newRunContext(out, errOut, opts)
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	diff, err := deployment.Diff(runCtx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, diff.String())
+	return nil
+}
+
+func runHook(module *atk.ModuleInfo, name atk.Hook, out io.Writer, errOut io.Writer, opts *commonFlags) error {
+	runner, err := newRunner(opts)
+	if err != nil {
+		return err
+	}
+	runCtx := newRunContext(out, errOut, opts)
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	hook := deployment.GetHook(name)
+	if hook == nil {
+		return fmt.Errorf("unknown hook: %s", name)
+	}
+	return hook(runCtx)
+}
+
+func runValidate(module *atk.ModuleInfo, vars atk.EventData, out io.Writer, errOut io.Writer, opts *commonFlags) error {
+	runner, err := newRunner(opts)
+	if err != nil {
+		return err
+	}
+	runCtx := newRunContext(out, errOut, opts)
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	result, err := deployment.Validate(runCtx, vars)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "status: %s\n", result.Status)
+	for _, msg := range result.Messages {
+		fmt.Fprintf(out, "  %s\n", msg)
+	}
+	for _, v := range result.Variables {
+		if v.Valid {
+			fmt.Fprintf(out, "  %s: valid\n", v.Name)
+		} else {
+			fmt.Fprintf(out, "  %s: invalid: %s\n", v.Name, v.Message)
+		}
+	}
+	if !result.IsValid() {
+		return fmt.Errorf("module %s is %s", module.Metadata.Name, result.Status)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useFakeRunner replaces the runner of the commands with a fake runner for
+// the duration of the test.
+func useFakeRunner(t *testing.T) *atktest.FakeRunner {
+	runner := atktest.NewFakeRunner()
+	prev := newRunner
+	newRunner = func(opts *commonFlags) (atk.ImageRunner, error) {
+		return runner, nil
+	}
+	t.Cleanup(func() { newRunner = prev })
+	return runner
+}
+
+// writeManifest saves the module to a manifest file in a temporary directory.
+func writeManifest(t *testing.T, module *atk.ModuleInfo) string {
+	path := filepath.Join(t.TempDir(), "itz-manifest.yaml")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, module.Save(f))
+	return path
+}
+
+func runCli(args ...string) (int, string, string) {
+	out := new(bytes.Buffer)
+	errOut := new(bytes.Buffer)
+	code := run(args, out, errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestUsage(t *testing.T) {
+	code, _, errOut := runCli()
+	assert.Equal(t, 2, code)
+	assert.Contains(t, errOut, "Usage: atkmod")
+
+	code, out, _ := runCli("help")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "Usage: atkmod")
+
+	code, _, errOut = runCli("frobnicate")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, errOut, "unknown command: frobnicate")
+
+	code, _, _ = runCli("hook", "list")
+	assert.Equal(t, 2, code)
+}
+
+func TestInitCmd(t *testing.T) {
+	code, out, _ := runCli("init", "mymodule", "docker.io/library/alpine:3.16")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "name: mymodule")
+	assert.Contains(t, out, "image: docker.io/library/alpine:3.16")
+
+	code, _, errOut := runCli("init")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "usage: atkmod init")
+}
+
+func TestValidateCmd(t *testing.T) {
+	path := writeManifest(t, atk.NewModuleScaffold("mymodule"))
+	code, out, _ := runCli("validate", path)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "manifest for module mymodule is valid")
+
+	module := atk.NewModuleScaffold("mymodule")
+	module.Specifications.Lifecycle.Deploy = atk.ImageInfo{}
+	path = writeManifest(t, module)
+	code, out, errOut := runCli("validate", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out, "ATK003")
+	assert.Contains(t, errOut, "has errors")
+
+	code, _, _ = runCli("validate")
+	assert.Equal(t, 1, code)
+}
+
+func TestPlanCmd(t *testing.T) {
+	path := writeManifest(t, atktest.Manifest("mymodule"))
+	code, out, _ := runCli("plan", path)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "Module: mymodule (namespace: atktest)")
+	assert.Contains(t, out, "mymodule-deploy")
+	assert.Less(t, strings.Index(out, "mymodule-pre-deploy"), strings.Index(out, "mymodule-post-deploy"))
+	assert.Contains(t, out, "env: ATK_RUN_ID (from deployment)")
+
+	code, out, _ = runCli("plan", "-o", "json", path)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, `"pulls": [`)
+}
+
+func TestHookRunCmd(t *testing.T) {
+	runner := useFakeRunner(t)
+	runner.On("mymodule-list", atktest.Response{Out: atktest.ListResponse})
+	path := writeManifest(t, atktest.Manifest("mymodule"))
+
+	code, out, _ := runCli("hook", "run", "list", path)
+	assert.Equal(t, 0, code)
+	atktest.AssertRunOrder(t, runner, "mymodule-list")
+	atktest.AssertEventType(t, out, atk.ListHookResponseEvent)
+
+	code, _, errOut := runCli("hook", "run", "unknown", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "unknown hook")
+}
+
+func TestCompleteCmd(t *testing.T) {
+	runner := useFakeRunner(t)
+	runner.On("mymodule-list", atktest.Response{Out: atktest.NewResponse(atk.ListHookResponseEvent,
+		atk.EventDataVarInfo{Name: "region", Description: "the region of the cluster", Options: []string{"us-east", "us-south", "eu-de"}},
+		atk.EventDataVarInfo{Name: "replicas", Default: "3"})})
+	path := writeManifest(t, atktest.Manifest("mymodule"))
+
+	code, out, _ := runCli("complete", "-word", "re", path)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "region=\tthe region of the cluster\nreplicas=\n", out)
+
+	code, out, _ = runCli("complete", "-word", "region=us", path)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "region=us-east\nregion=us-south\n", out)
+}
+
+func TestHookRunValidateCmd(t *testing.T) {
+	runner := useFakeRunner(t)
+	path := writeManifest(t, atktest.Manifest("mymodule"))
+
+	code, out, _ := runCli("hook", "run", "-var", "TF_VAR_region=us-east", "validate", path)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "status: valid")
+	in := runner.Calls()[0].In
+	atktest.AssertEventType(t, in, atk.ValidateHookRequestEvent)
+	atktest.AssertVariables(t, in, "TF_VAR_region")
+
+	runner.On("mymodule-validate", atktest.Response{ExitCode: atk.HookExitInvalid})
+	code, out, _ = runCli("hook", "run", "validate", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out, "status: invalid")
+}
+
+func TestDeployCmdConfirm(t *testing.T) {
+	runner := useFakeRunner(t)
+	path := writeManifest(t, atktest.Manifest("mymodule"))
+	prev := trustPrompt
+	defer func() { trustPrompt = prev }()
+
+	trustPrompt = strings.NewReader("n\n")
+	code, _, errOut := runCli("deploy", "-confirm", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "module mymodule will run mymodule-get-state")
+	assert.Contains(t, errOut, "continue? [y/N]")
+	assert.Contains(t, errOut, "not trusted")
+	assert.Empty(t, runner.Calls())
+
+	code, _, _ = runCli("deploy", "-confirm", "-trust", filepath.Dir(path), path)
+	assert.Equal(t, 0, code)
+}
+
+func TestDeployCmd(t *testing.T) {
+	runner := useFakeRunner(t)
+	path := writeManifest(t, atktest.Manifest("mymodule"))
+
+	code, _, errOut := runCli("deploy", path)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, errOut, "module mymodule deployed")
+	atktest.AssertRunOrder(t, runner, "mymodule-get-state", "mymodule-list", "mymodule-validate", "mymodule-pre-deploy", "mymodule-deploy", "mymodule-post-deploy")
+
+	provenance := filepath.Join(t.TempDir(), "provenance.json")
+	code, _, _ = runCli("deploy", "-runner", "local", "-provenance", provenance, path)
+	assert.Equal(t, 0, code)
+	content, err := os.ReadFile(provenance)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"uri": "mymodule-deploy"`)
+
+	runner.On("mymodule-deploy", atktest.Response{ExitCode: 1})
+	code, _, errOut = runCli("deploy", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "deployment failed in state deploying")
+
+	code, out, _ := runCli("deploy", "-status", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out, "state: errored")
+	assert.Contains(t, out, "reason: DeployFailed")
+}
+
+func TestCatalogCmd(t *testing.T) {
+	runner := useFakeRunner(t)
+	runner.On("mymodule-list", atktest.Response{Out: atktest.NewResponse(atk.ListHookResponseEvent, atk.EventDataVarInfo{Name: "REGION"})})
+	path := writeManifest(t, atktest.Manifest("mymodule"))
+
+	code, out, _ := runCli("catalog", filepath.Dir(path))
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, `"name": "REGION"`)
+
+	code, _, _ = runCli("catalog")
+	assert.Equal(t, 1, code)
+}
+
+func TestHelperPin(t *testing.T) {
+	podman := filepath.Join(t.TempDir(), "podman")
+	require.NoError(t, os.WriteFile(podman, []byte("#!/bin/sh\n[ \"$1\" = image ] && echo sha256:0123\nexit 0\n"), 0755))
+	prev := newRunner
+	newRunner = func(opts *commonFlags) (atk.ImageRunner, error) {
+		return &atk.CliModuleRunner{
+			PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman}),
+			HelperImage:             "mirror.example.com/busybox:1.36",
+		}, nil
+	}
+	t.Cleanup(func() { newRunner = prev })
+
+	code, out, errOut := runCli("helper", "-q", "pin")
+	require.Equal(t, 0, code, errOut)
+	assert.Equal(t, "mirror.example.com/busybox:1.36@sha256:0123\n", out)
+}
+
+func TestHelperNeedsPodmanRunner(t *testing.T) {
+	useFakeRunner(t)
+	code, _, errOut := runCli("helper", "pin")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "only used by the podman runner")
+}
@@ -0,0 +1,60 @@
+package atkmod
+
+import "time"
+
+// ExecutedCommand is the command line that was last run for a lifecycle
+// stage or a hook, so that it can be run again by hand, such as to reproduce
+// a failure. The values that are masked in the logs are masked here too.
+type ExecutedCommand struct {
+	// Name is the state of the stage, such as deploying, or the name of the
+	// hook, such as get_state.
+	Name string    `json:"name" yaml:"name"`
+	Argv []string  `json:"argv" yaml:"argv"`
+	At   time.Time `json:"at" yaml:"at"`
+}
+
+// LastCommand returns the command line that was last run for the stage, as
+// its state such as string(Deploying), or for the hook, such as
+// string(GetStateHook), or nil if none was run. Runners that do not run a
+// command, such as fakes in tests, do not record any.
+func (m *DeployableModule) LastCommand(name string) []string {
+	m.stageMu.Lock()
+	defer m.stageMu.Unlock()
+	return append([]string(nil), m.commands[name].Argv...)
+}
+
+// LastCommands returns the commands that were last run for each stage and
+// hook, in the order that they were run.
+func (m *DeployableModule) LastCommands() []ExecutedCommand {
+	m.stageMu.Lock()
+	defer m.stageMu.Unlock()
+	commands := make([]ExecutedCommand, 0, len(m.commandOrder))
+	for _, name := range m.commandOrder {
+		c := m.commands[name]
+		c.Argv = append([]string(nil), c.Argv...)
+		commands = append(commands, c)
+	}
+	return commands
+}
+
+// recordCommand records the command that the runner last ran with the
+// context as the command of the stage or hook.
+func (m *DeployableModule) recordCommand(ctx *RunContext, name string, at time.Time) {
+	argv := ctx.Command()
+	if len(argv) == 0 {
+		return
+	}
+	m.stageMu.Lock()
+	defer m.stageMu.Unlock()
+	if m.commands == nil {
+		m.commands = make(map[string]ExecutedCommand)
+	}
+	m.commands[name] = ExecutedCommand{Name: name, Argv: argv, At: at}
+	for idx, n := range m.commandOrder {
+		if n == name {
+			m.commandOrder = append(m.commandOrder[:idx], m.commandOrder[idx+1:]...)
+			break
+		}
+	}
+	m.commandOrder = append(m.commandOrder, name)
+}
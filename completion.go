@@ -0,0 +1,64 @@
+package atkmod
+
+import (
+	"sort"
+	"strings"
+)
+
+// Completion is a candidate for the completion of a NAME=VALUE variable on
+// a command line, for building shell completion.
+type Completion struct {
+	// Value is what the word is completed to, such as region= or
+	// region=us-east.
+	Value       string `json:"value" yaml:"value"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// Complete returns the completions of the word, which is a variable as
+// NAME=VALUE that is being typed. A word without = completes to the names of
+// the variables that start with it, followed by =, with their descriptions.
+// A word with = completes to the options of the variable, or to its default
+// if it has no options, that start with the value. The completions are
+// sorted.
+func (d *EventData) Complete(word string) []Completion {
+	completions := make([]Completion, 0)
+	if d == nil {
+		return completions
+	}
+	name, value, hasValue := strings.Cut(word, "=")
+	for _, v := range d.Variables {
+		if !hasValue {
+			if strings.HasPrefix(v.Name, name) {
+				completions = append(completions, Completion{Value: v.Name + "=", Description: v.Description})
+			}
+			continue
+		}
+		if v.Name != name {
+			continue
+		}
+		candidates := v.Options
+		if len(candidates) == 0 && len(v.Default) > 0 {
+			candidates = []string{v.Default}
+		}
+		for _, c := range candidates {
+			if strings.HasPrefix(c, value) {
+				completions = append(completions, Completion{Value: v.Name + "=" + c})
+			}
+		}
+	}
+	sort.Slice(completions, func(i, j int) bool {
+		return completions[i].Value < completions[j].Value
+	})
+	return completions
+}
+
+// Complete runs the list hook of the module, or uses its cached response if
+// the deployment has a HookCache, and returns the completions of the word.
+// See EventData.Complete.
+func (m *DeployableModule) Complete(ctx *RunContext, word string) ([]Completion, error) {
+	data, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return data.Complete(word), nil
+}
@@ -0,0 +1,324 @@
+package atkmod
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// The environment variables that override the values of the configuration
+// file.
+const (
+	ConfigFileEnvVar       = "ITZ_ATK_CONFIG"
+	PodmanPathEnvVar       = "ITZ_PODMAN_PATH"
+	PodmanConnectionEnvVar = "ITZ_PODMAN_CONNECTION"
+	WazeroPathEnvVar       = "ITZ_WAZERO_PATH"
+	RegistryAuthFileEnvVar = "ITZ_REGISTRY_AUTH_FILE"
+	BaseDirEnvVar          = "ITZ_ATK_BASE_DIR"
+	PullPolicyEnvVar       = "ITZ_PULL_POLICY"
+	DeployTimeoutEnvVar    = "ITZ_DEPLOY_TIMEOUT"
+	DefaultRegistryEnvVar  = "ITZ_DEFAULT_REGISTRY"
+	TagPolicyEnvVar        = "ITZ_TAG_POLICY"
+	ProxyEnvVar            = "ITZ_PROXY"
+	NoProxyEnvVar          = "ITZ_NO_PROXY"
+	CABundleEnvVar         = "ITZ_CA_BUNDLE"
+	ClientCertEnvVar       = "ITZ_CLIENT_CERT"
+	ClientKeyEnvVar        = "ITZ_CLIENT_KEY"
+	HelperImageEnvVar      = "ITZ_HELPER_IMAGE"
+	PassEnvEnvVar          = "ITZ_PASS_ENV"
+)
+
+// DefaultPodmanPath is the path of podman when no other path is configured.
+const DefaultPodmanPath = "/usr/local/bin/podman"
+
+// The pull policies of podman, which are passed to podman run with --pull.
+const (
+	PullAlways  = "always"
+	PullMissing = "missing"
+	PullNever   = "never"
+	PullNewer   = "newer"
+)
+
+// Config has the defaults of the library, so that the consumers do not have
+// to look them up themselves. The values are read from the configuration
+// file, ~/.atk/config.yaml by default, and then from the environment
+// variables, which take precedence. Options given in code, such as
+// WithDeadline, take precedence over both.
+type Config struct {
+	// PodmanPath is the path of podman, DefaultPodmanPath if empty.
+	PodmanPath string `json:"podmanPath,omitempty" yaml:"podmanPath,omitempty"`
+	// PodmanConnection is the podman system connection that runs the
+	// containers. If empty, the active connection of podman is used.
+	PodmanConnection string `json:"podmanConnection,omitempty" yaml:"podmanConnection,omitempty"`
+	// WazeroPath is the path of the wazero CLI, wazero from PATH if empty.
+	WazeroPath string `json:"wazeroPath,omitempty" yaml:"wazeroPath,omitempty"`
+	// RegistryAuthFile is the auth file that podman uses to pull images
+	// from private registries.
+	RegistryAuthFile string `json:"registryAuthFile,omitempty" yaml:"registryAuthFile,omitempty"`
+	// BaseDir is the directory that has the history, locks, checkpoints,
+	// cache and workspaces. If it is empty, each of them has its own default.
+	BaseDir string `json:"baseDir,omitempty" yaml:"baseDir,omitempty"`
+	// PullPolicy is when podman pulls the images: always, missing, never or
+	// newer. If it is empty, the default of podman is used.
+	PullPolicy string `json:"pullPolicy,omitempty" yaml:"pullPolicy,omitempty"`
+	// DeployTimeout limits the time of a deployment, like WithDeadline.
+	DeployTimeout time.Duration `json:"deployTimeout,omitempty" yaml:"deployTimeout,omitempty"`
+	// DefaultRegistry is added to the images of the manifests that do not
+	// name a registry, like ManifestDefaults.Registry.
+	DefaultRegistry string `json:"defaultRegistry,omitempty" yaml:"defaultRegistry,omitempty"`
+	// TagPolicy is what is done with the images of the manifests that use
+	// the latest tag: allow, warn or reject. If it is empty, they are
+	// allowed.
+	TagPolicy string `json:"tagPolicy,omitempty" yaml:"tagPolicy,omitempty"`
+	// Proxy is the URL of the proxy of the requests to remote servers, such
+	// as the registry and the webhooks. If it is empty, HTTPS_PROXY,
+	// HTTP_PROXY and NO_PROXY are used.
+	Proxy string `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+	// NoProxy is the comma-separated list of the hosts and domains that are
+	// not reached through Proxy.
+	NoProxy string `json:"noProxy,omitempty" yaml:"noProxy,omitempty"`
+	// CABundle is a PEM file of the CAs that are trusted by the requests to
+	// remote servers, in addition to those of the system.
+	CABundle string `json:"caBundle,omitempty" yaml:"caBundle,omitempty"`
+	// ClientCert and ClientKey are the PEM files of the client certificate
+	// that the requests to remote servers authenticate with.
+	ClientCert string `json:"clientCert,omitempty" yaml:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty" yaml:"clientKey,omitempty"`
+	// HelperImage is the image of the helper containers of the runner,
+	// DefaultHelperImage if empty. It can point to a mirror and be pinned to
+	// a digest, see PinImage.
+	HelperImage string `json:"helperImage,omitempty" yaml:"helperImage,omitempty"`
+	// PassEnv passes the values of the environment variables of the
+	// containers to podman in its environment instead of on the command
+	// line, like CliParts.PassEnv.
+	PassEnv bool `json:"passEnv,omitempty" yaml:"passEnv,omitempty"`
+}
+
+// DefaultConfigPath returns the path of the configuration file, which is
+// ~/.atk/config.yaml unless ITZ_ATK_CONFIG is set.
+func DefaultConfigPath() (string, error) {
+	if path := os.Getenv(ConfigFileEnvVar); len(path) > 0 {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".atk", "config.yaml"), nil
+}
+
+// LoadConfig reads the configuration file at the path and then applies the
+// environment variables. A file that does not exist is not an error, so the
+// configuration only has the values of the environment variables.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	content, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := yaml.Unmarshal(content, cfg); err != nil {
+			return nil, fmt.Errorf("could not read configuration file %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+var (
+	defaultConfigOnce sync.Once
+	defaultConfig     *Config
+)
+
+// DefaultConfig returns the configuration loaded from DefaultConfigPath the
+// first time that it is called. If the file cannot be read, the error is
+// logged and only the environment variables are used.
+func DefaultConfig() *Config {
+	defaultConfigOnce.Do(func() {
+		path, err := DefaultConfigPath()
+		if err == nil {
+			defaultConfig, err = LoadConfig(path)
+		}
+		if err != nil {
+			logger.Warnf("could not load the atk configuration: %v", err)
+			defaultConfig = &Config{}
+			defaultConfig.applyEnv(os.Getenv)
+		}
+	})
+	return defaultConfig
+}
+
+// applyEnv overrides the values that have an environment variable set.
+func (c *Config) applyEnv(getenv func(string) string) error {
+	for envVar, field := range map[string]*string{
+		PodmanPathEnvVar:       &c.PodmanPath,
+		PodmanConnectionEnvVar: &c.PodmanConnection,
+		WazeroPathEnvVar:       &c.WazeroPath,
+		RegistryAuthFileEnvVar: &c.RegistryAuthFile,
+		BaseDirEnvVar:          &c.BaseDir,
+		PullPolicyEnvVar:       &c.PullPolicy,
+		DefaultRegistryEnvVar:  &c.DefaultRegistry,
+		TagPolicyEnvVar:        &c.TagPolicy,
+		ProxyEnvVar:            &c.Proxy,
+		NoProxyEnvVar:          &c.NoProxy,
+		CABundleEnvVar:         &c.CABundle,
+		ClientCertEnvVar:       &c.ClientCert,
+		ClientKeyEnvVar:        &c.ClientKey,
+		HelperImageEnvVar:      &c.HelperImage,
+	} {
+		if value := getenv(envVar); len(value) > 0 {
+			*field = value
+		}
+	}
+	if value := getenv(DeployTimeoutEnvVar); len(value) > 0 {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", DeployTimeoutEnvVar, err)
+		}
+		c.DeployTimeout = timeout
+	}
+	if value := getenv(PassEnvEnvVar); len(value) > 0 {
+		passEnv, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", PassEnvEnvVar, err)
+		}
+		c.PassEnv = passEnv
+	}
+	return nil
+}
+
+// Validate returns an error if the pull policy, the tag policy, the timeout
+// or the proxy are invalid, or if only one of the client certificate and
+// its key is set.
+func (c *Config) Validate() error {
+	switch strings.ToLower(c.PullPolicy) {
+	case "", PullAlways, PullMissing, PullNever, PullNewer:
+	default:
+		return fmt.Errorf("invalid pull policy %q; expected always, missing, never or newer", c.PullPolicy)
+	}
+	if _, err := ParseTagPolicy(c.TagPolicy); err != nil {
+		return err
+	}
+	if c.DeployTimeout < 0 {
+		return fmt.Errorf("invalid deploy timeout %s", c.DeployTimeout)
+	}
+	if len(c.Proxy) > 0 {
+		if _, err := parseProxy(c.Proxy); err != nil {
+			return err
+		}
+	}
+	if (len(c.ClientCert) > 0) != (len(c.ClientKey) > 0) {
+		return errors.New("the client certificate and its key must be given together")
+	}
+	return nil
+}
+
+// podmanPath returns the configured path of podman or DefaultPodmanPath.
+func (c *Config) podmanPath() string {
+	return Iif(c.PodmanPath, DefaultPodmanPath)
+}
+
+// dir returns the directory under BaseDir with the name, or the result of
+// the fallback if BaseDir is empty.
+func (c *Config) dir(name string, fallback func() (string, error)) (string, error) {
+	if len(c.BaseDir) > 0 {
+		return filepath.Join(c.BaseDir, name), nil
+	}
+	return fallback()
+}
+
+// ManifestDefaults returns the defaults that are applied to the manifests
+// when they are loaded, for WithDefaults.
+func (c *Config) ManifestDefaults() ManifestDefaults {
+	policy, _ := ParseTagPolicy(c.TagPolicy)
+	return ManifestDefaults{Registry: c.DefaultRegistry, TagPolicy: policy}
+}
+
+// HistoryDir returns the directory of the deployment history.
+func (c *Config) HistoryDir() (string, error) {
+	return c.dir("history", DefaultHistoryDir)
+}
+
+// LockDir returns the directory of the lock files.
+func (c *Config) LockDir() string {
+	dir, _ := c.dir("locks", func() (string, error) { return DefaultLockDir(), nil })
+	return dir
+}
+
+// CheckpointDir returns the directory of the checkpoints.
+func (c *Config) CheckpointDir() (string, error) {
+	return c.dir("checkpoints", DefaultCheckpointDir)
+}
+
+// CacheDir returns the directory of the cache of WithCacheVolume.
+func (c *Config) CacheDir() (string, error) {
+	return c.dir("cache", DefaultCacheDir)
+}
+
+// WorkspaceRoot returns the root of the module workspaces, or an empty
+// string if BaseDir is not set.
+func (c *Config) WorkspaceRoot() string {
+	if len(c.BaseDir) == 0 {
+		return ""
+	}
+	return filepath.Join(c.BaseDir, "workspaces")
+}
+
+// CliParts returns the settings of podman for the configuration, with the
+// connection, and the auth file and the pull policy as flags.
+func (c *Config) CliParts() *CliParts {
+	parts := &CliParts{Path: c.podmanPath(), Connection: c.PodmanConnection, PassEnv: c.PassEnv}
+	if len(c.RegistryAuthFile) > 0 {
+		parts.Flags = append(parts.Flags, "--authfile", c.RegistryAuthFile)
+	}
+	if len(c.PullPolicy) > 0 {
+		parts.Flags = append(parts.Flags, "--pull="+strings.ToLower(c.PullPolicy))
+	}
+	return parts
+}
+
+// PodmanRunner returns a CliModuleRunner that uses the configuration. The
+// runner pulls the images with retries, according to the pull policy, before
+// it runs them.
+func (c *Config) PodmanRunner() *CliModuleRunner {
+	parts := &CliParts{Path: c.podmanPath(), Connection: c.PodmanConnection, PassEnv: c.PassEnv}
+	if len(c.RegistryAuthFile) > 0 {
+		parts.Flags = append(parts.Flags, "--authfile", c.RegistryAuthFile)
+	}
+	return &CliModuleRunner{
+		PodmanCliCommandBuilder: *NewPodmanCliCommandBuilder(parts),
+		Pull:                    &PullOptions{Policy: c.PullPolicy, AuthFile: c.RegistryAuthFile},
+		HelperImage:             c.HelperImage,
+	}
+}
+
+// Options returns the options of a deployment for the configuration: the
+// runner, the timeout, a locker and the checkpoint and workspace
+// directories under BaseDir. Options given after them take precedence.
+func (c *Config) Options() []DeployableModuleOption {
+	opts := []DeployableModuleOption{
+		WithRunner(c.PodmanRunner()),
+		WithLocker(NewLocker(c.LockDir())),
+	}
+	if c.DeployTimeout > 0 {
+		opts = append(opts, WithDeadline(c.DeployTimeout))
+	}
+	if dir, err := c.CheckpointDir(); err == nil && len(c.BaseDir) > 0 {
+		opts = append(opts, WithCheckpointDir(dir))
+	}
+	if root := c.WorkspaceRoot(); len(root) > 0 {
+		opts = append(opts, WithWorkspaceRoot(root))
+	}
+	return opts
+}
@@ -0,0 +1,101 @@
+package atkmod
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ContainerConnectionEnvVar is the environment variable that podman reads
+// to select the system connection, which takes precedence over its
+// configuration files.
+const ContainerConnectionEnvVar = "CONTAINER_CONNECTION"
+
+// containersConfigDir returns the directory of the configuration files of
+// podman, which is $XDG_CONFIG_HOME/containers or ~/.config/containers on
+// every platform.
+func containersConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); len(dir) > 0 {
+		return filepath.Join(dir, "containers"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "containers"), nil
+}
+
+// ActivePodmanConnection returns the name of the podman system connection
+// that podman uses when --connection is not given: the value of
+// CONTAINER_CONNECTION, the default connection in podman-connections.json
+// or the active_service in containers.conf. If podman has no active
+// connection, an empty string is returned, and podman uses the local
+// socket.
+func ActivePodmanConnection() (string, error) {
+	if name := os.Getenv(ContainerConnectionEnvVar); len(name) > 0 {
+		return name, nil
+	}
+	dir, err := containersConfigDir()
+	if err != nil {
+		return "", err
+	}
+	name, err := readConnectionsFile(filepath.Join(dir, "podman-connections.json"))
+	if err != nil || len(name) > 0 {
+		return name, err
+	}
+	return readActiveService(filepath.Join(dir, "containers.conf"))
+}
+
+// readConnectionsFile returns the default connection in the
+// podman-connections.json file of podman 4.8 and later.
+func readConnectionsFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var conns struct {
+		Connection struct {
+			Default string `json:"Default"`
+		} `json:"Connection"`
+	}
+	if err := json.Unmarshal(content, &conns); err != nil {
+		return "", err
+	}
+	return conns.Connection.Default, nil
+}
+
+// readActiveService returns the active_service of the [engine] table in
+// containers.conf. Only the lines of the table are read, so the file does
+// not have to be parsed as TOML.
+func readActiveService(path string) (string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	inEngine := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inEngine = line == "[engine]"
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !inEngine || !found || strings.TrimSpace(key) != "active_service" {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(value), `"'`), nil
+	}
+	return "", scanner.Err()
+}
@@ -0,0 +1,122 @@
+package atkmod
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VariableType is the type of the value of a variable.
+type VariableType string
+
+// The types of the variables. A variable without a type is a string.
+const (
+	VarTypeString VariableType = "string"
+	VarTypeInt    VariableType = "int"
+	VarTypeBool   VariableType = "bool"
+	// VarTypePassword is a string that is always treated as sensitive.
+	VarTypePassword VariableType = "password"
+)
+
+// VariableProblem is a variable whose value does not meet its constraints.
+type VariableProblem struct {
+	Name    string `json:"name" yaml:"name"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// VariableConstraintError is returned by ValidateVariables, and by Deploy
+// before the validate hook and the lifecycle stages run, when the values of
+// the variables do not meet their constraints.
+type VariableConstraintError struct {
+	Module   string
+	Problems []VariableProblem
+}
+
+func (e *VariableConstraintError) Error() string {
+	problems := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		problems = append(problems, fmt.Sprintf("variable %s: %s", p.Name, p.Message))
+	}
+	if len(e.Module) == 0 {
+		return fmt.Sprintf("the variables are not valid: %s", strings.Join(problems, "; "))
+	}
+	return fmt.Sprintf("the variables of module %s are not valid: %s", e.Module, strings.Join(problems, "; "))
+}
+
+// CheckVariable checks the value of the variable, or its default if it has
+// no value, against its constraints: a required variable must have a value,
+// and a value must be of its type, be one of its options, if it has any, and
+// match its pattern, if it has one. The pattern must match the whole value.
+func CheckVariable(v EventDataVarInfo) error {
+	value := Iif(v.Value, v.Default)
+	if len(value) == 0 {
+		if v.Required {
+			return fmt.Errorf("a value is required")
+		}
+		return nil
+	}
+	switch v.Type {
+	case "", VarTypeString, VarTypePassword:
+	case VarTypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("the value is not an int")
+		}
+	case VarTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("the value is not a bool")
+		}
+	default:
+		return fmt.Errorf("unknown type %s", v.Type)
+	}
+	// The values of sensitive variables are not included in the messages.
+	shown := fmt.Sprintf("%q", value)
+	if IsSensitiveVariable(v) {
+		shown = "the value"
+	}
+	if len(v.Options) > 0 {
+		found := false
+		for _, o := range v.Options {
+			found = found || o == value
+		}
+		if !found {
+			return fmt.Errorf("%s is not one of %s", shown, strings.Join(v.Options, ", "))
+		}
+	}
+	if len(v.Pattern) > 0 {
+		re, err := regexp.Compile("^(?:" + v.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", v.Pattern, err)
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("%s does not match %s", shown, v.Pattern)
+		}
+	}
+	return nil
+}
+
+// ValidateVariables checks each of the variables with CheckVariable and
+// returns a VariableConstraintError with all of the problems, if there are
+// any.
+func ValidateVariables(vars []EventDataVarInfo) error {
+	var problems []VariableProblem
+	for _, v := range vars {
+		if err := CheckVariable(v); err != nil {
+			problems = append(problems, VariableProblem{Name: v.Name, Message: err.Error()})
+		}
+	}
+	if len(problems) > 0 {
+		return &VariableConstraintError{Problems: problems}
+	}
+	return nil
+}
+
+// checkConstraints checks the variables of the deployment against their
+// constraints.
+func (m *DeployableModule) checkConstraints() error {
+	err := ValidateVariables(m.Variables().Variables)
+	if constraintErr, ok := err.(*VariableConstraintError); ok {
+		constraintErr.Module = m.module.Metadata.Name
+	}
+	return err
+}
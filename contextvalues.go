@@ -0,0 +1,106 @@
+package atkmod
+
+import (
+	"context"
+	"io"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// WithLogger returns a copy of the context with the logger, which the
+// runners use when the RunContext has no logger of its own.
+func WithLogger(ctx context.Context, l *logger.Logger) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, LoggerContextKey, l)
+}
+
+// LoggerFrom returns the logger set with WithLogger, or nil if there is none.
+func LoggerFrom(ctx context.Context) *logger.Logger {
+	if ctx == nil {
+		return nil
+	}
+	l, _ := ctx.Value(LoggerContextKey).(*logger.Logger)
+	return l
+}
+
+// WithStdOut returns a copy of the context with the writer, which the
+// runners write the output of the images to when the RunContext has no
+// output stream.
+func WithStdOut(ctx context.Context, w io.Writer) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, StdOutContextKey, w)
+}
+
+// StdOutFrom returns the writer set with WithStdOut, or nil if there is
+// none.
+func StdOutFrom(ctx context.Context) io.Writer {
+	if ctx == nil {
+		return nil
+	}
+	w, _ := ctx.Value(StdOutContextKey).(io.Writer)
+	return w
+}
+
+// WithStdErr returns a copy of the context with the writer, which the
+// runners write the errors of the images to when the RunContext has no
+// error stream.
+func WithStdErr(ctx context.Context, w io.Writer) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, StdErrContextKey, w)
+}
+
+// StdErrFrom returns the writer set with WithStdErr, or nil if there is
+// none.
+func StdErrFrom(ctx context.Context) io.Writer {
+	if ctx == nil {
+		return nil
+	}
+	w, _ := ctx.Value(StdErrContextKey).(io.Writer)
+	return w
+}
+
+// WithBaseDirectory returns a copy of the context with the base directory.
+func WithBaseDirectory(ctx context.Context, dir string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, BaseDirectory, dir)
+}
+
+// BaseDirectoryFrom returns the base directory set with WithBaseDirectory,
+// or an empty string if there is none.
+func BaseDirectoryFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	dir, _ := ctx.Value(BaseDirectory).(string)
+	return dir
+}
+
+// hasLogger returns true if the logger of the RunContext was set, which the
+// zero Logger, that cannot log, is not.
+func (c *RunContext) hasLogger() bool {
+	return c.Log.Out != nil && c.Log.Formatter != nil
+}
+
+// useContextValues sets the logger and the streams of the RunContext that
+// are not set to those of its context, if it has them.
+func (c *RunContext) useContextValues() {
+	if !c.hasLogger() {
+		if l := LoggerFrom(c.Context); l != nil {
+			c.Log = copyLogger(l)
+		}
+	}
+	if c.Out == nil {
+		c.Out = StdOutFrom(c.Context)
+	}
+	if c.Err == nil {
+		c.Err = StdErrFrom(c.Context)
+	}
+}
@@ -0,0 +1,162 @@
+package atkmod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The paths in the containers of the stages where the credentials of the
+// helpers are mounted.
+const (
+	KubeconfigMountPath     = "/var/run/atk/kube/config"
+	AWSCredentialsMountPath = "/var/run/atk/aws"
+)
+
+// The environment variables of the host that are passed to the stages by
+// WithAWSCredentials and WithIBMCloudAPIKeyFromEnv.
+var (
+	AWSEnvVars = []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_PROFILE"}
+	// IBMCloudAPIKeyEnvVars are the names of the API key that the ibmcloud
+	// CLI and the terraform provider read, which are all set to the key.
+	IBMCloudAPIKeyEnvVars = []string{"IBMCLOUD_API_KEY", "IC_API_KEY"}
+)
+
+// credential returns the environment variables and the volumes that give a
+// stage access to a cluster or a cloud.
+type credential func() ([]EnvVarInfo, []VolumeInfo, error)
+
+// WithKubeconfig mounts the kubeconfig file at the path in each hook and
+// stage at KubeconfigMountPath and sets KUBECONFIG to it. If the path is
+// empty, the first file of KUBECONFIG on the host is used, or else
+// ~/.kube/config. The stages fail if the file does not exist.
+func WithKubeconfig(path string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.kubeconfigPaths = append(m.kubeconfigPaths, path)
+		m.credentials = append(m.credentials, func() ([]EnvVarInfo, []VolumeInfo, error) {
+			file, err := kubeconfigPath(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, err := os.Stat(file); err != nil {
+				return nil, nil, fmt.Errorf("could not mount the kubeconfig: %w", err)
+			}
+			return []EnvVarInfo{{Name: "KUBECONFIG", Value: KubeconfigMountPath}},
+				[]VolumeInfo{{Name: file, MountPath: KubeconfigMountPath}}, nil
+		})
+	}
+}
+
+func kubeconfigPath(path string) (string, error) {
+	if len(path) > 0 {
+		return filepath.Abs(path)
+	}
+	if list := filepath.SplitList(os.Getenv("KUBECONFIG")); len(list) > 0 && len(list[0]) > 0 {
+		return filepath.Abs(list[0])
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+// WithAWSCredentials passes the AWSEnvVars that are set on the host to each
+// hook and stage and, if ~/.aws exists, mounts it at AWSCredentialsMountPath
+// with AWS_SHARED_CREDENTIALS_FILE and AWS_CONFIG_FILE set to the files in
+// it, so that both keys and profiles work.
+func WithAWSCredentials() DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.credentials = append(m.credentials, func() ([]EnvVarInfo, []VolumeInfo, error) {
+			env := hostEnv(AWSEnvVars...)
+			var volumes []VolumeInfo
+			if home, err := os.UserHomeDir(); err == nil {
+				dir := filepath.Join(home, ".aws")
+				if info, err := os.Stat(dir); err == nil && info.IsDir() {
+					volumes = append(volumes, VolumeInfo{Name: dir, MountPath: AWSCredentialsMountPath})
+					env = append(env,
+						EnvVarInfo{Name: "AWS_SHARED_CREDENTIALS_FILE", Value: AWSCredentialsMountPath + "/credentials"},
+						EnvVarInfo{Name: "AWS_CONFIG_FILE", Value: AWSCredentialsMountPath + "/config"})
+				}
+			}
+			if len(env) == 0 {
+				return nil, nil, fmt.Errorf("no AWS credentials found in the environment or in ~/.aws")
+			}
+			return env, volumes, nil
+		})
+	}
+}
+
+// WithIBMCloudAPIKeyFromEnv passes the IBM Cloud API key of the host, from
+// IBMCLOUD_API_KEY or IC_API_KEY, to each hook and stage as all of the
+// IBMCloudAPIKeyEnvVars. The key is a secret, so it is passed to podman in
+// its environment rather than on the command line. The stages fail if
+// neither is set.
+func WithIBMCloudAPIKeyFromEnv() DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.credentials = append(m.credentials, func() ([]EnvVarInfo, []VolumeInfo, error) {
+			found := hostEnv(IBMCloudAPIKeyEnvVars...)
+			if len(found) == 0 {
+				return nil, nil, fmt.Errorf("no IBM Cloud API key found in %s or %s", IBMCloudAPIKeyEnvVars[0], IBMCloudAPIKeyEnvVars[1])
+			}
+			env := make([]EnvVarInfo, 0, len(IBMCloudAPIKeyEnvVars))
+			for _, name := range IBMCloudAPIKeyEnvVars {
+				env = append(env, EnvVarInfo{Name: name, Value: found[0].Value, Secret: true})
+			}
+			return env, nil, nil
+		})
+	}
+}
+
+// hostEnv returns the environment variables with the names that are set on
+// the host, in the same order.
+func hostEnv(names ...string) []EnvVarInfo {
+	var env []EnvVarInfo
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok && len(value) > 0 {
+			env = append(env, EnvVarInfo{Name: name, Value: value})
+		}
+	}
+	return env
+}
+
+// withCredentials adds the environment variables and the volumes of the
+// credentials of the deployment to the image. The values that the image
+// sets itself, and the paths that it mounts itself, take precedence.
+func (m *DeployableModule) withCredentials(img *ImageInfo) error {
+	for _, cred := range m.credentials {
+		env, volumes, err := cred()
+		if err != nil {
+			return err
+		}
+		for _, e := range env {
+			if !hasEnvVar(*img, e.Name) {
+				img.EnvVars = append(img.EnvVars, e)
+			}
+		}
+		for _, v := range volumes {
+			if !hasMount(*img, v.MountPath) {
+				img.Volumes = append(img.Volumes, v)
+			}
+		}
+	}
+	return nil
+}
+
+func hasEnvVar(info ImageInfo, name string) bool {
+	for _, e := range info.EnvVars {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMount(info ImageInfo, mountPath string) bool {
+	for _, v := range info.Volumes {
+		if v.MountPath == mountPath {
+			return true
+		}
+	}
+	return false
+}
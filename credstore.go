@@ -0,0 +1,233 @@
+package atkmod
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrCredentialNotFound is returned by a CredentialStore that has no
+// credential for the server.
+var ErrCredentialNotFound = errors.New("credential not found")
+
+// The credential helpers of the keychains of the OSes, which are used by
+// NewKeychainStore.
+const (
+	// CredentialHelperKeychain stores the credentials in the macOS keychain.
+	CredentialHelperKeychain = "osxkeychain"
+	// CredentialHelperSecretService stores the credentials with libsecret,
+	// in the secret service of the desktop, such as GNOME Keyring.
+	CredentialHelperSecretService = "secretservice"
+	// CredentialHelperWincred stores the credentials in the Windows
+	// Credential Manager.
+	CredentialHelperWincred = "wincred"
+)
+
+// IBMCloudCredentialServer is the server of the IBM Cloud API key in a
+// CredentialStore, which is read by WithIBMCloudAPIKey.
+const IBMCloudCredentialServer = "cloud.ibm.com"
+
+// Credential is the secret that authenticates with a server, such as a
+// registry or an API.
+type Credential struct {
+	// Server is the host name of the server, such as quay.io.
+	Server   string `json:"ServerURL"`
+	Username string `json:"Username"`
+	// Secret is the password or the token.
+	Secret string `json:"Secret"`
+}
+
+// CredentialStore keeps the credentials of the servers, so that the tokens
+// of the registries and the APIs do not have to be kept in environment
+// variables or in files.
+type CredentialStore interface {
+	// Get returns the credential of the server, or an error that wraps
+	// ErrCredentialNotFound if there is none.
+	Get(server string) (*Credential, error)
+	// Store adds the credential, replacing the one of the same server.
+	Store(cred Credential) error
+	// Erase removes the credential of the server.
+	Erase(server string) error
+}
+
+// HelperCredentialStore is a CredentialStore that keeps the credentials with
+// a docker credential helper, such as docker-credential-osxkeychain, which
+// is also used by docker and podman to keep the logins to the registries.
+type HelperCredentialStore struct {
+	// Helper is the name of the helper, such as CredentialHelperKeychain.
+	Helper string
+	// Path is the path of the helper command. If it is empty,
+	// docker-credential-<Helper> is found in the PATH.
+	Path string
+}
+
+// NewKeychainStore returns the CredentialStore of the keychain of the OS:
+// the macOS keychain, the Windows Credential Manager, or else the secret
+// service with libsecret.
+func NewKeychainStore() *HelperCredentialStore {
+	switch runtime.GOOS {
+	case "darwin":
+		return &HelperCredentialStore{Helper: CredentialHelperKeychain}
+	case "windows":
+		return &HelperCredentialStore{Helper: CredentialHelperWincred}
+	default:
+		return &HelperCredentialStore{Helper: CredentialHelperSecretService}
+	}
+}
+
+// Get returns the credential of the server from the helper.
+func (s *HelperCredentialStore) Get(server string) (*Credential, error) {
+	server = CredentialServer(server)
+	out, err := s.run("get", []byte(server))
+	if err != nil {
+		return nil, fmt.Errorf("could not get the credential of %s: %w", server, err)
+	}
+	cred := &Credential{}
+	if err := json.Unmarshal(out, cred); err != nil {
+		return nil, fmt.Errorf("could not read the credential of %s: %w", server, err)
+	}
+	cred.Server = server
+	return cred, nil
+}
+
+// Store adds the credential to the helper.
+func (s *HelperCredentialStore) Store(cred Credential) error {
+	cred.Server = CredentialServer(cred.Server)
+	content, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	if _, err := s.run("store", content); err != nil {
+		return fmt.Errorf("could not store the credential of %s: %w", cred.Server, err)
+	}
+	return nil
+}
+
+// Erase removes the credential of the server from the helper.
+func (s *HelperCredentialStore) Erase(server string) error {
+	server = CredentialServer(server)
+	if _, err := s.run("erase", []byte(server)); err != nil {
+		return fmt.Errorf("could not erase the credential of %s: %w", server, err)
+	}
+	return nil
+}
+
+// run runs the helper with the action, writing the input to its standard
+// input. A helper that is not installed has no credentials.
+func (s *HelperCredentialStore) run(action string, input []byte) ([]byte, error) {
+	cmd := exec.Command(Iif(s.Path, "docker-credential-"+s.Helper), action)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return nil, fmt.Errorf("%w: the credential helper %s is not installed", ErrCredentialNotFound, cmd.Path)
+	case err != nil:
+		message := strings.TrimSpace(string(out) + " " + stderr.String())
+		if strings.Contains(strings.ToLower(message), "credentials not found") {
+			return nil, fmt.Errorf("%w: %s", ErrCredentialNotFound, message)
+		}
+		return nil, fmt.Errorf("%w: %s", err, message)
+	}
+	return out, nil
+}
+
+// CredentialServer returns the server that the credentials of the URL or
+// the image reference are kept for, which is its host name, such as quay.io
+// for https://quay.io/v2/ or quay.io/org/image:tag.
+func CredentialServer(ref string) string {
+	if strings.Contains(ref, "://") {
+		if u, err := url.Parse(ref); err == nil && len(u.Host) > 0 {
+			return u.Host
+		}
+	}
+	return strings.SplitN(ref, "/", 2)[0]
+}
+
+// imageRegistry returns the registry of the image, which is docker.io for
+// the images without one.
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 || !(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return "docker.io"
+	}
+	return parts[0]
+}
+
+// lookupCredential returns the credential of the server from the store, or
+// nil if the store has none.
+func lookupCredential(store CredentialStore, server string) (*Credential, error) {
+	if store == nil {
+		return nil, nil
+	}
+	cred, err := store.Get(server)
+	if errors.Is(err, ErrCredentialNotFound) {
+		return nil, nil
+	}
+	return cred, err
+}
+
+// writeAuthFile writes the credential to a new auth file in the format of
+// podman --authfile in a temporary directory, which is removed by the
+// returned function.
+func writeAuthFile(server string, cred *Credential) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "atk-auth-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	auth := base64.StdEncoding.EncodeToString([]byte(cred.Username + ":" + cred.Secret))
+	content, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{server: map[string]string{"auth": auth}},
+	})
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	path := filepath.Join(dir, "auth.json")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
+
+// WithIBMCloudAPIKey passes the IBM Cloud API key to each hook and stage as
+// all of the IBMCloudAPIKeyEnvVars, in the environment of podman rather than
+// on the command line, as WithIBMCloudAPIKeyFromEnv does, but reads it from
+// the secret of IBMCloudCredentialServer in the store, such as the keychain
+// of the OS. If the store has no key, the key of the host, from
+// IBMCLOUD_API_KEY or IC_API_KEY, is used.
+func WithIBMCloudAPIKey(store CredentialStore) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.credentials = append(m.credentials, func() ([]EnvVarInfo, []VolumeInfo, error) {
+			cred, err := lookupCredential(store, IBMCloudCredentialServer)
+			if err != nil {
+				return nil, nil, err
+			}
+			key := ""
+			if cred != nil {
+				key = cred.Secret
+			} else if found := hostEnv(IBMCloudAPIKeyEnvVars...); len(found) > 0 {
+				key = found[0].Value
+			}
+			if len(key) == 0 {
+				return nil, nil, fmt.Errorf("no IBM Cloud API key found in the credential store, %s or %s", IBMCloudAPIKeyEnvVars[0], IBMCloudAPIKeyEnvVars[1])
+			}
+			env := make([]EnvVarInfo, 0, len(IBMCloudAPIKeyEnvVars))
+			for _, name := range IBMCloudAPIKeyEnvVars {
+				env = append(env, EnvVarInfo{Name: name, Value: key, Secret: true})
+			}
+			return env, nil, nil
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package atkmod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HookDeadLetterEvent is the type of the event that a SinkDeadLetterQueue
+// sends with a DeadLetter as its data.
+const HookDeadLetterEvent ModuleEventType = "com.ibm.techzone.cli.hook.dead_letter"
+
+// HookOutputError is returned when the output of a hook is not a response
+// that can be understood, such as output that is not an event or an event
+// of the wrong type. The raw output is kept, and is written to the dead
+// letter queue of the deployment if it has one.
+type HookOutputError struct {
+	Module string
+	Hook   Hook
+	// Output is the raw output of the hook.
+	Output []byte
+	Err    error
+	// DeadLetter is where the output was written to by the dead letter
+	// queue, if it was.
+	DeadLetter string
+}
+
+func (e *HookOutputError) Error() string {
+	if len(e.DeadLetter) > 0 {
+		return fmt.Sprintf("%v; the output of the hook was kept in %s", e.Err, e.DeadLetter)
+	}
+	return e.Err.Error()
+}
+
+func (e *HookOutputError) Unwrap() error {
+	return e.Err
+}
+
+// DeadLetter is the record of the output of a hook that could not be
+// understood.
+type DeadLetter struct {
+	Module string    `json:"module" yaml:"module"`
+	RunID  string    `json:"runId" yaml:"runId"`
+	Hook   Hook      `json:"hook" yaml:"hook"`
+	At     time.Time `json:"at" yaml:"at"`
+	Output string    `json:"output" yaml:"output"`
+	// Error is why the output could not be understood.
+	Error string `json:"error" yaml:"error"`
+}
+
+// DeadLetterQueue keeps the outputs of the hooks that could not be
+// understood, so that the evidence is not lost with the deployment.
+type DeadLetterQueue interface {
+	// Put keeps the letter and returns where it was kept.
+	Put(ctx context.Context, letter DeadLetter) (string, error)
+}
+
+// DirDeadLetterQueue writes each dead letter as a JSON file in a directory.
+type DirDeadLetterQueue struct {
+	Dir string
+}
+
+// NewDirDeadLetterQueue creates a DirDeadLetterQueue that writes the dead
+// letters to the directory, which is created if needed.
+func NewDirDeadLetterQueue(dir string) *DirDeadLetterQueue {
+	return &DirDeadLetterQueue{Dir: dir}
+}
+
+// Put writes the letter to a file named after the run, the hook and the
+// time, and returns its path.
+func (q *DirDeadLetterQueue) Put(ctx context.Context, letter DeadLetter) (string, error) {
+	if err := os.MkdirAll(q.Dir, 0755); err != nil {
+		return "", err
+	}
+	content, err := json.MarshalIndent(letter, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s-%d.json", letter.RunID, letter.Hook, letter.At.UnixNano())
+	path := filepath.Join(q.Dir, name)
+	return path, os.WriteFile(path, append(content, '\n'), 0600)
+}
+
+// SinkDeadLetterQueue sends each dead letter to an EventSink as a
+// HookDeadLetterEvent.
+type SinkDeadLetterQueue struct {
+	Sink EventSink
+}
+
+// Put sends the letter and returns the ID of the event.
+func (q *SinkDeadLetterQueue) Put(ctx context.Context, letter DeadLetter) (string, error) {
+	event, err := NewEvent(HookDeadLetterEvent, letter.Module, letter)
+	if err != nil {
+		return "", err
+	}
+	event.SetExtension(RunIDExtension, letter.RunID)
+	return event.ID(), q.Sink.Send(ctx, event)
+}
+
+// WithDeadLetters writes the output of the hooks that could not be
+// understood to the queue, such as a DirDeadLetterQueue.
+func WithDeadLetters(queue DeadLetterQueue) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.deadLetters = queue
+	}
+}
+
+// hookOutputError returns the HookOutputError of the output of the hook,
+// after it is written to the dead letter queue of the deployment. A hook
+// that wrote nothing has no evidence to keep. A dead letter that cannot be
+// written is logged, so that it does not hide the error of the hook.
+func (m *DeployableModule) hookOutputError(ctx *RunContext, hook Hook, output []byte, err error) error {
+	hookErr := &HookOutputError{Module: m.module.Metadata.Name, Hook: hook, Output: output, Err: err}
+	if m.deadLetters == nil || len(bytes.TrimSpace(output)) == 0 {
+		return hookErr
+	}
+	letter := DeadLetter{
+		Module: m.module.Metadata.Name,
+		RunID:  m.runID,
+		Hook:   hook,
+		At:     time.Now().UTC(),
+		Output: string(output),
+		Error:  err.Error(),
+	}
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	location, perr := m.deadLetters.Put(parent, letter)
+	if perr != nil {
+		ctx.Logger().Warnf("could not keep the output of the %s hook: %v", hook, perr)
+		return hookErr
+	}
+	hookErr.DeadLetter = location
+	return hookErr
+}
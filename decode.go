@@ -0,0 +1,135 @@
+package atkmod
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestSyntaxError is returned when a manifest cannot be decoded, with the
+// position of the error in the input.
+type ManifestSyntaxError struct {
+	URI string
+	// Document is the number of the document in the stream, from 1.
+	Document int
+	// Line is the line of the error in the stream, from 1, and Offset is the
+	// byte offset of the start of the line. Line is 0 if the position of the
+	// error is not known.
+	Line   int
+	Offset int64
+	Err    error
+}
+
+func (e *ManifestSyntaxError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("could not decode document %d of manifest %s: %v", e.Document, e.URI, e.Err)
+	}
+	return fmt.Sprintf("could not decode document %d of manifest %s at line %d (byte %d): %v", e.Document, e.URI, e.Line, e.Offset, e.Err)
+}
+
+func (e *ManifestSyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// yamlErrorLine finds the line in the errors of the YAML decoder, such as
+// "yaml: line 3: did not find expected key".
+var yamlErrorLine = regexp.MustCompile(`line (\d+):`)
+
+// ManifestDecoder decodes the manifests of a YAML document stream, in which
+// the documents are separated by ---, one at a time, so that the stream does
+// not have to be read at once.
+type ManifestDecoder struct {
+	uri      string
+	decoder  *yaml.Decoder
+	lines    *lineCounter
+	document int
+	err      error
+}
+
+// NewManifestDecoder returns a decoder of the manifests of the reader. The
+// URI names the input in the errors.
+func NewManifestDecoder(r io.Reader, uri string) *ManifestDecoder {
+	lines := &lineCounter{r: r, starts: []int64{0}}
+	return &ManifestDecoder{uri: uri, decoder: yaml.NewDecoder(lines), lines: lines}
+}
+
+// Decode returns the next manifest of the stream, or io.EOF when there are no
+// more. Empty documents are skipped. After a ManifestSyntaxError, the rest of
+// the stream cannot be decoded, so the same error is returned again.
+func (d *ManifestDecoder) Decode() (*ModuleInfo, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	for {
+		var node yaml.Node
+		d.document++
+		if err := d.decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			d.err = d.syntaxError(err)
+			return nil, d.err
+		}
+		if isEmptyDocument(&node) {
+			continue
+		}
+		module := &ModuleInfo{}
+		if err := node.Decode(module); err != nil {
+			// The document was parsed, so the next one can still be decoded.
+			return nil, d.syntaxError(err)
+		}
+		return module, nil
+	}
+}
+
+// syntaxError wraps the error of the YAML decoder with its position.
+func (d *ManifestDecoder) syntaxError(err error) *ManifestSyntaxError {
+	syntaxErr := &ManifestSyntaxError{URI: d.uri, Document: d.document, Err: err}
+	if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		syntaxErr.Line, _ = strconv.Atoi(match[1])
+		syntaxErr.Offset = d.lines.offset(syntaxErr.Line)
+	}
+	return syntaxErr
+}
+
+// isEmptyDocument returns true if the document has no content, such as the
+// one before a leading --- or after a trailing one.
+func isEmptyDocument(node *yaml.Node) bool {
+	if node.Kind != yaml.DocumentNode || len(node.Content) == 0 {
+		return true
+	}
+	content := node.Content[0]
+	return content.Kind == yaml.ScalarNode && content.Tag == "!!null"
+}
+
+// lineCounter records the offsets of the starts of the lines that are read
+// through it, so that the lines of the errors can be turned into offsets.
+type lineCounter struct {
+	r      io.Reader
+	read   int64
+	starts []int64
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] == '\n' {
+			c.starts = append(c.starts, c.read+int64(i)+1)
+		}
+	}
+	c.read += int64(n)
+	return n, err
+}
+
+// offset returns the offset of the start of the line, from 1, or 0 if the
+// line has not been read.
+func (c *lineCounter) offset(line int) int64 {
+	if line < 1 || line > len(c.starts) {
+		return 0
+	}
+	return c.starts[line-1]
+}
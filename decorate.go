@@ -0,0 +1,187 @@
+package atkmod
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// The ANSI escape codes used by the OutputDecorator.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+	ansiDim    = "\x1b[2m"
+)
+
+// The glyphs written by the OutputDecorator when a stage starts, succeeds
+// and fails.
+const (
+	GlyphStarted   = "▶"
+	GlyphSucceeded = "✔"
+	GlyphFailed    = "✖"
+)
+
+// IsTerminal returns true if the writer is a terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorEnabled returns true if colors can be written to the writer: it is a
+// terminal, NO_COLOR is not set and TERM is not dumb.
+func ColorEnabled(w io.Writer) bool {
+	if len(os.Getenv("NO_COLOR")) > 0 || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(w)
+}
+
+// OutputDecorator makes the output of a deployment easier to scan: each line
+// of the output of a lifecycle stage starts with the name of the stage, and
+// a line with a glyph is written when the stage starts, succeeds or fails.
+// Set it on a deployment with WithOutputDecorator.
+type OutputDecorator struct {
+	// Color adds ANSI colors to the prefixes and the glyphs.
+	Color bool
+	// NoPrefix does not add the name of the stage to the lines of output.
+	NoPrefix bool
+}
+
+// NewOutputDecorator returns an OutputDecorator for the writer, which uses
+// colors if ColorEnabled is true for it.
+func NewOutputDecorator(w io.Writer) *OutputDecorator {
+	return &OutputDecorator{Color: ColorEnabled(w)}
+}
+
+// WithOutputDecorator decorates the output of the lifecycle stages of the
+// deployment, which is written to the streams of the context, with the
+// decorator.
+func WithOutputDecorator(d *OutputDecorator) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.decorator = d
+	}
+}
+
+func (d *OutputDecorator) paint(color string, s string) string {
+	if !d.Color {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// Writer returns a writer that writes each line to w with the name of the
+// stage as a prefix. Flush must be called on it once the stage has run.
+func (d *OutputDecorator) Writer(w io.Writer, state State, stream OutputStream) *PrefixWriter {
+	color := ansiDim
+	if stream == Stderr {
+		color = ansiYellow
+	}
+	return &PrefixWriter{w: w, prefix: []byte(d.paint(color, "["+string(state)+"]") + " ")}
+}
+
+// Started writes the line for a stage that has started.
+func (d *OutputDecorator) Started(w io.Writer, state State) {
+	if w == nil {
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", d.paint(ansiCyan, GlyphStarted), state)
+}
+
+// Stopped writes the line for a stage that has succeeded, or has failed
+// with err.
+func (d *OutputDecorator) Stopped(w io.Writer, state State, elapsed time.Duration, err error) {
+	if w == nil {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(w, "%s %s: %v\n", d.paint(ansiRed, GlyphFailed), state, err)
+		return
+	}
+	fmt.Fprintf(w, "%s %s %s\n", d.paint(ansiGreen, GlyphSucceeded), state, d.paint(ansiDim, "("+elapsed.Round(time.Millisecond).String()+")"))
+}
+
+// decorateStage replaces the streams of the context with streams that add
+// the prefix of the stage, and returns the function that flushes them.
+func (m *DeployableModule) decorateStage(ctx *RunContext, state State) func() {
+	if m.decorator == nil || m.decorator.NoPrefix {
+		return func() {}
+	}
+	out := m.decorator.Writer(ctx.Out, state, Stdout)
+	errOut := m.decorator.Writer(ctx.Err, state, Stderr)
+	ctx.Out, ctx.Err = out, errOut
+	return func() {
+		out.Flush()
+		errOut.Flush()
+	}
+}
+
+// showsStatus returns true if the decorator writes the status of the state,
+// which is the case for the lifecycle stages.
+func (m *DeployableModule) showsStatus(ctx *RunContext, state State) bool {
+	if m.decorator == nil || ctx.Verbosity == VerbositySilent {
+		return false
+	}
+	for _, img := range stageImages(m.module) {
+		if img.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+// PrefixWriter writes each line written to it to another writer with a
+// prefix. A line that is not complete is held until the rest of it is
+// written or until Flush is called.
+type PrefixWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	prefix  []byte
+	pending []byte
+}
+
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, b...)
+	for {
+		idx := bytes.IndexByte(p.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		if err := p.writeLine(p.pending[:idx+1]); err != nil {
+			return len(b), err
+		}
+		p.pending = p.pending[idx+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes the line that is not complete, with a new line.
+func (p *PrefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pending) == 0 {
+		return nil
+	}
+	line := append(p.pending, '\n')
+	p.pending = nil
+	return p.writeLine(line)
+}
+
+func (p *PrefixWriter) writeLine(line []byte) error {
+	if p.w == nil {
+		return nil
+	}
+	_, err := p.w.Write(append(append([]byte(nil), p.prefix...), line...))
+	return err
+}
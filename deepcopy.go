@@ -0,0 +1,235 @@
+package atkmod
+
+// DeepCopy returns a copy of the ModuleInfo that does not share any slices
+// or maps with the original, so it can be safely modified.
+func (m *ModuleInfo) DeepCopy() *ModuleInfo {
+	if m == nil {
+		return nil
+	}
+	return &ModuleInfo{
+		ApiVersion:     m.ApiVersion,
+		Kind:           m.Kind,
+		Metadata:       m.Metadata.DeepCopy(),
+		Specifications: m.Specifications.DeepCopy(),
+	}
+}
+
+// Equal returns true if the two modules have the same values. Nil and empty
+// slices and maps are considered equal.
+func (m *ModuleInfo) Equal(other *ModuleInfo) bool {
+	if m == nil || other == nil {
+		return m == other
+	}
+	return m.ApiVersion == other.ApiVersion &&
+		m.Kind == other.Kind &&
+		m.Metadata.Equal(other.Metadata) &&
+		m.Specifications.Equal(other.Specifications)
+}
+
+// DeepCopy returns a copy of the metadata with its own labels and
+// annotations.
+func (m MetadataInfo) DeepCopy() MetadataInfo {
+	c := m
+	c.Labels = copyStringMap(m.Labels)
+	c.Annotations = copyStringMap(m.Annotations)
+	c.DependsOn = copyStrings(m.DependsOn)
+	return c
+}
+
+// Equal returns true if the two metadata have the same values.
+func (m MetadataInfo) Equal(other MetadataInfo) bool {
+	return m.Name == other.Name &&
+		m.Namespace == other.Namespace &&
+		equalStringMap(m.Labels, other.Labels) &&
+		m.Generation == other.Generation &&
+		equalStringMap(m.Annotations, other.Annotations) &&
+		equalStrings(m.DependsOn, other.DependsOn)
+}
+
+// DeepCopy returns a copy of the spec that does not share any slices with
+// the original.
+func (s SpecInfo) DeepCopy() SpecInfo {
+	c := SpecInfo{
+		Hooks:     s.Hooks.DeepCopy(),
+		Lifecycle: s.Lifecycle.DeepCopy(),
+	}
+	if s.Readiness != nil {
+		readiness := *s.Readiness
+		c.Readiness = &readiness
+	}
+	if s.Requires != nil {
+		requires := RequiresInfo{
+			Tools:     append([]ToolRequirement(nil), s.Requires.Tools...),
+			DiskSpace: s.Requires.DiskSpace,
+			Endpoints: copyStrings(s.Requires.Endpoints),
+		}
+		c.Requires = &requires
+	}
+	if s.Includes != nil {
+		c.Includes = append([]IncludeInfo{}, s.Includes...)
+	}
+	return c
+}
+
+// Equal returns true if the two specs have the same values.
+func (s SpecInfo) Equal(other SpecInfo) bool {
+	if (s.Readiness == nil) != (other.Readiness == nil) {
+		return false
+	}
+	if s.Readiness != nil && *s.Readiness != *other.Readiness {
+		return false
+	}
+	if (s.Requires == nil) != (other.Requires == nil) {
+		return false
+	}
+	if s.Requires != nil && !s.Requires.Equal(*other.Requires) {
+		return false
+	}
+	if len(s.Includes) != len(other.Includes) {
+		return false
+	}
+	for idx := range s.Includes {
+		if s.Includes[idx] != other.Includes[idx] {
+			return false
+		}
+	}
+	return s.Hooks.Equal(other.Hooks) && s.Lifecycle.Equal(other.Lifecycle)
+}
+
+// DeepCopy returns a copy of the hooks that does not share any slices with
+// the original.
+func (h HookInfo) DeepCopy() HookInfo {
+	return HookInfo{
+		GetState: h.GetState.DeepCopy(),
+		List:     h.List.DeepCopy(),
+		Validate: h.Validate.DeepCopy(),
+		Info:     h.Info.DeepCopy(),
+	}
+}
+
+// Equal returns true if the two hooks have the same values.
+func (h HookInfo) Equal(other HookInfo) bool {
+	return h.GetState.Equal(other.GetState) &&
+		h.List.Equal(other.List) &&
+		h.Validate.Equal(other.Validate) &&
+		h.Info.Equal(other.Info)
+}
+
+// DeepCopy returns a copy of the lifecycle that does not share any slices
+// with the original.
+func (l LifecycleInfo) DeepCopy() LifecycleInfo {
+	return LifecycleInfo{
+		PreDeploy:  l.PreDeploy.DeepCopy(),
+		Deploy:     l.Deploy.DeepCopy(),
+		PostDeploy: l.PostDeploy.DeepCopy(),
+		OnCancel:   l.OnCancel.DeepCopy(),
+	}
+}
+
+// Equal returns true if the two lifecycles have the same values.
+func (l LifecycleInfo) Equal(other LifecycleInfo) bool {
+	return l.PreDeploy.Equal(other.PreDeploy) &&
+		l.Deploy.Equal(other.Deploy) &&
+		l.PostDeploy.Equal(other.PostDeploy) &&
+		l.OnCancel.Equal(other.OnCancel)
+}
+
+// DeepCopy returns a copy of the image that does not share any slices with
+// the original.
+func (i ImageInfo) DeepCopy() ImageInfo {
+	c := i
+	c.Command = copyStrings(i.Command)
+	c.Args = copyStrings(i.Args)
+	c.InheritEnv = copyStrings(i.InheritEnv)
+	c.Sandbox = i.Sandbox.DeepCopy()
+	c.Artifacts = copyStrings(i.Artifacts)
+	if i.EnvVars != nil {
+		c.EnvVars = make([]EnvVarInfo, len(i.EnvVars))
+		copy(c.EnvVars, i.EnvVars)
+	}
+	if i.Volumes != nil {
+		c.Volumes = make([]VolumeInfo, len(i.Volumes))
+		copy(c.Volumes, i.Volumes)
+	}
+	if i.Scanners != nil {
+		c.Scanners = make([]ScannerInfo, len(i.Scanners))
+		copy(c.Scanners, i.Scanners)
+	}
+	return c
+}
+
+// Equal returns true if the two images have the same values.
+func (i ImageInfo) Equal(other ImageInfo) bool {
+	if i.Image != other.Image || i.Script != other.Script {
+		return false
+	}
+	if !equalStrings(i.Command, other.Command) || !equalStrings(i.Args, other.Args) || !equalStrings(i.InheritEnv, other.InheritEnv) {
+		return false
+	}
+	if !i.Sandbox.Equal(other.Sandbox) || !equalStrings(i.Artifacts, other.Artifacts) {
+		return false
+	}
+	if len(i.EnvVars) != len(other.EnvVars) || len(i.Volumes) != len(other.Volumes) || len(i.Scanners) != len(other.Scanners) {
+		return false
+	}
+	for idx := range i.EnvVars {
+		if i.EnvVars[idx] != other.EnvVars[idx] {
+			return false
+		}
+	}
+	for idx := range i.Volumes {
+		if i.Volumes[idx] != other.Volumes[idx] {
+			return false
+		}
+	}
+	for idx := range i.Scanners {
+		if i.Scanners[idx] != other.Scanners[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	c := make([]string, len(s))
+	copy(c, s)
+	return c
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func equalStringMap(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
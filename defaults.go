@@ -0,0 +1,187 @@
+package atkmod
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TagPolicy is what the defaulting pass does with images that use the latest
+// tag or that have no tag or digest, which podman resolves to latest.
+type TagPolicy string
+
+const (
+	// TagPolicyAllow leaves the images as they are.
+	TagPolicyAllow TagPolicy = "allow"
+	// TagPolicyWarn reports a warning for each of the images.
+	TagPolicyWarn TagPolicy = "warn"
+	// TagPolicyReject fails the load of the manifest.
+	TagPolicyReject TagPolicy = "reject"
+)
+
+// ParseTagPolicy parses a tag policy such as warn. An empty string is
+// TagPolicyAllow.
+func ParseTagPolicy(s string) (TagPolicy, error) {
+	switch policy := TagPolicy(strings.ToLower(strings.TrimSpace(s))); policy {
+	case "":
+		return TagPolicyAllow, nil
+	case TagPolicyAllow, TagPolicyWarn, TagPolicyReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid tag policy %q; expected allow, warn or reject", s)
+	}
+}
+
+// ManifestDefaults configures the defaulting pass that is applied to the
+// manifests after they are loaded. The names of the images are always
+// trimmed and lowercased, and the values of the environment variables are
+// always trimmed; the rest is only done when it is configured.
+type ManifestDefaults struct {
+	// Registry is added to the images that do not name a registry, such as
+	// quay.io. If it is docker.io, the images with a single path component
+	// are also put in library/, as podman does.
+	Registry string `json:"registry,omitempty" yaml:"registry,omitempty"`
+	// TagPolicy is what is done with the images that use the latest tag.
+	TagPolicy TagPolicy `json:"tagPolicy,omitempty" yaml:"tagPolicy,omitempty"`
+}
+
+// AppliedDefault is a value of the manifest that was changed by the
+// defaulting pass.
+type AppliedDefault struct {
+	// Path is the location of the value in the manifest, such as
+	// spec.lifecycle.deploy.image.
+	Path string `json:"path" yaml:"path"`
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+}
+
+func (a AppliedDefault) String() string {
+	return fmt.Sprintf("%s: %q -> %q", a.Path, a.From, a.To)
+}
+
+// DefaultsReport is the result of the defaulting pass, so that the users
+// can see how the effective manifest differs from the file.
+type DefaultsReport struct {
+	Applied  []AppliedDefault `json:"applied,omitempty" yaml:"applied,omitempty"`
+	Warnings []string         `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// ApplyDefaults applies the defaults to the hooks and lifecycle stages of
+// the module in place and reports what was changed. If the tag policy is
+// TagPolicyReject, an error is returned that names each of the images that
+// use the latest tag, along with the report of the rest of the changes.
+func (m *ModuleInfo) ApplyDefaults(d ManifestDefaults) (*DefaultsReport, error) {
+	report := &DefaultsReport{}
+	var rejected []string
+	for _, ref := range imageRefs(m) {
+		info := ref.info
+		if len(info.Image) > 0 {
+			image := d.normalizeImage(info.Image)
+			report.set(ref.path+".image", &info.Image, image)
+			if usesLatestTag(image) {
+				switch d.TagPolicy {
+				case TagPolicyWarn:
+					report.Warnings = append(report.Warnings, fmt.Sprintf("%s.image: image %s uses the latest tag", ref.path, image))
+				case TagPolicyReject:
+					rejected = append(rejected, fmt.Sprintf("%s (%s.image)", image, ref.path))
+				}
+			}
+		}
+		for i := range info.EnvVars {
+			env := &info.EnvVars[i]
+			report.set(fmt.Sprintf("%s.env[%d].value", ref.path, i), &env.Value, strings.TrimSpace(env.Value))
+		}
+	}
+	if len(rejected) > 0 {
+		return report, fmt.Errorf("images must be pinned to a tag other than latest or to a digest: %s", strings.Join(rejected, ", "))
+	}
+	return report, nil
+}
+
+// set changes the field to the value and records the change if it differs.
+func (r *DefaultsReport) set(path string, field *string, value string) {
+	if *field == value {
+		return
+	}
+	r.Applied = append(r.Applied, AppliedDefault{Path: path, From: *field, To: value})
+	*field = value
+}
+
+// imageRef is a hook or lifecycle stage of the module that can be changed in
+// place, with its location in the manifest.
+type imageRef struct {
+	path string
+	info *ImageInfo
+}
+
+// imageRefs returns the same hooks and lifecycle stages as stageImages, but
+// as pointers into the module.
+func imageRefs(m *ModuleInfo) []imageRef {
+	spec := &m.Specifications
+	return []imageRef{
+		{"spec.hooks.list", &spec.Hooks.List},
+		{"spec.hooks.validate", &spec.Hooks.Validate},
+		{"spec.hooks.get_state", &spec.Hooks.GetState},
+		{"spec.hooks.info", &spec.Hooks.Info},
+		{"spec.lifecycle.pre_deploy", &spec.Lifecycle.PreDeploy},
+		{"spec.lifecycle.deploy", &spec.Lifecycle.Deploy},
+		{"spec.lifecycle.post_deploy", &spec.Lifecycle.PostDeploy},
+		{"spec.lifecycle.on_cancel", &spec.Lifecycle.OnCancel},
+	}
+}
+
+// splitImage splits an image reference into its name, its tag and its
+// digest, which include their leading : and @.
+func splitImage(image string) (name string, tag string, digest string) {
+	name = image
+	if idx := strings.Index(name, "@"); idx >= 0 {
+		name, digest = name[:idx], name[idx:]
+	}
+	if idx := strings.LastIndex(name, ":"); idx > strings.LastIndex(name, "/") {
+		name, tag = name[:idx], name[idx:]
+	}
+	return name, tag, digest
+}
+
+// normalizeImage trims and lowercases the name of the image and adds the
+// default registry. The tag and the digest are kept as they are, as tags are
+// case sensitive.
+func (d ManifestDefaults) normalizeImage(image string) string {
+	name, tag, digest := splitImage(strings.TrimSpace(image))
+	name = strings.ToLower(name)
+	if registry := strings.TrimSuffix(d.Registry, "/"); len(registry) > 0 && !hasRegistry(name) {
+		if registry == "docker.io" && !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+		name = registry + "/" + name
+	}
+	return name + tag + digest
+}
+
+// hasRegistry returns true if the first component of the image name is a
+// registry, which has a domain or a port, or is localhost.
+func hasRegistry(name string) bool {
+	first, _, found := strings.Cut(name, "/")
+	return found && (strings.ContainsAny(first, ".:") || first == "localhost")
+}
+
+// usesLatestTag returns true if the image has the latest tag or no tag and
+// no digest.
+func usesLatestTag(image string) bool {
+	_, tag, digest := splitImage(image)
+	return len(digest) == 0 && (len(tag) == 0 || tag == ":latest")
+}
+
+// WithDefaults applies the defaults to the manifests after they are loaded,
+// in addition to the normalization that is always done. The changes are
+// reported by Applied.
+func WithDefaults(d ManifestDefaults) ManifestLoaderOption {
+	return func(l *ManifestFileLoader) {
+		l.defaults = d
+	}
+}
+
+// Applied returns the report of the defaulting pass of the last manifest
+// that was loaded, or nil if none was.
+func (l *ManifestFileLoader) Applied() *DefaultsReport {
+	return l.applied
+}
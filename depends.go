@@ -0,0 +1,240 @@
+package atkmod
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DependencyCycleError is returned by NewDeploymentPlan when the modules
+// depend on each other, so that none of them can be deployed first.
+type DependencyCycleError struct {
+	// Cycle is the names of the modules in the cycle, starting and ending
+	// with the same module.
+	Cycle []string
+}
+
+func (e *DependencyCycleError) Error() string {
+	return fmt.Sprintf("modules depend on each other: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// DependencyFailedError is the error of a module in a DeploymentPlan that
+// was skipped because one of the modules that it depends on did not deploy.
+type DependencyFailedError struct {
+	Module     string
+	Dependency string
+}
+
+func (e *DependencyFailedError) Error() string {
+	return fmt.Sprintf("module %s was skipped because its dependency %s did not deploy", e.Module, e.Dependency)
+}
+
+// DeploymentPlan deploys a bundle of modules in the order of their
+// metadata.dependsOn: each module is deployed once all of the modules that
+// it depends on are deployed, and the modules that do not depend on each
+// other are deployed at the same time.
+type DeploymentPlan struct {
+	// Modules are the modules of the plan in an order in which each one comes
+	// after the modules that it depends on.
+	Modules []*ModuleInfo
+	deps    map[string][]string
+	// stateRefs are the modules whose state is referenced by other modules,
+	// which is read with their get_state hook once they are deployed.
+	stateRefs map[string]bool
+}
+
+// PlanResult is the result of deploying one of the modules of a
+// DeploymentPlan.
+type PlanResult struct {
+	Module *ModuleInfo
+	// Result is the result of the deployment, or nil if the module was
+	// skipped or could not be started.
+	Result *DeploymentResult
+	Err    error
+	// Skipped is true if the module was not deployed because one of the
+	// modules that it depends on did not deploy.
+	Skipped bool
+}
+
+// NewDeploymentPlan creates the plan for the modules. It returns an error if
+// two of the modules have the same name, if a module depends on a module
+// that is not in the plan or references a module that it does not depend
+// on, or a DependencyCycleError if the modules depend on each other.
+func NewDeploymentPlan(modules []*ModuleInfo) (*DeploymentPlan, error) {
+	byName := make(map[string]*ModuleInfo, len(modules))
+	deps := make(map[string][]string, len(modules))
+	for _, module := range modules {
+		name := module.Metadata.Name
+		if _, ok := byName[name]; ok {
+			return nil, fmt.Errorf("module %s is in the plan more than once", name)
+		}
+		byName[name] = module
+	}
+	for _, module := range modules {
+		for _, dep := range module.Metadata.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("module %s depends on module %s, which is not in the plan", module.Metadata.Name, dep)
+			}
+			deps[module.Metadata.Name] = append(deps[module.Metadata.Name], dep)
+		}
+	}
+	stateRefs := make(map[string]bool)
+	for _, module := range modules {
+		for _, ref := range ModuleReferences(module) {
+			found := false
+			for _, dep := range module.Metadata.DependsOn {
+				found = found || dep == ref.Module
+			}
+			if !found {
+				return nil, fmt.Errorf("module %s references %s, but does not depend on module %s", module.Metadata.Name, ref, ref.Module)
+			}
+			if ref.Kind == ReferenceState {
+				stateRefs[ref.Module] = true
+			}
+		}
+	}
+
+	plan := &DeploymentPlan{Modules: make([]*ModuleInfo, 0, len(modules)), deps: deps, stateRefs: stateRefs}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(modules))
+	var stack []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for idx, s := range stack {
+				if s == name {
+					start = idx
+				}
+			}
+			return &DependencyCycleError{Cycle: append(append([]string{}, stack[start:]...), name)}
+		}
+		marks[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		marks[name] = visited
+		plan.Modules = append(plan.Modules, byName[name])
+		return nil
+	}
+	for _, module := range modules {
+		if err := visit(module.Metadata.Name); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// DependsOn returns the names of the modules that the module depends on.
+func (p *DeploymentPlan) DependsOn(name string) []string {
+	return append([]string(nil), p.deps[name]...)
+}
+
+// Dependents returns the names of the modules that depend on the module,
+// directly or through other modules, sorted by name.
+func (p *DeploymentPlan) Dependents(name string) []string {
+	found := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for module, deps := range p.deps {
+			for _, dep := range deps {
+				if !found[module] && (dep == name || found[dep]) {
+					found[module] = true
+					changed = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(found))
+	for module := range found {
+		names = append(names, module)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Deploy deploys the modules of the plan, with at most concurrency modules
+// deploying at the same time, and returns the results in the order of
+// Modules. If concurrency is zero or less, the number of CPUs is used. The
+// options are applied to the deployment of each module. A module whose
+// dependency did not deploy is skipped with a DependencyFailedError, and so
+// are the modules that depend on it in turn. Modules that have not been
+// started when the context is cancelled get the error of the context.
+//
+// The references of a module to the values of its dependencies, such as
+// ${modules.vpc.outputs.vpc_id}, are replaced before it is deployed. A
+// reference to a value that the dependency did not produce fails the module
+// with an UnresolvedReferenceError.
+func (p *DeploymentPlan) Deploy(ctx *RunContext, concurrency int, opts ...DeployableModuleOption) []PlanResult {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	results := make([]PlanResult, len(p.Modules))
+	states := make([]*ModuleState, len(p.Modules))
+	done := make(map[string]chan struct{}, len(p.Modules))
+	index := make(map[string]int, len(p.Modules))
+	for idx, module := range p.Modules {
+		done[module.Metadata.Name] = make(chan struct{})
+		index[module.Metadata.Name] = idx
+	}
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for idx, module := range p.Modules {
+		wg.Add(1)
+		go func(idx int, module *ModuleInfo) {
+			defer wg.Done()
+			defer close(done[module.Metadata.Name])
+			result := PlanResult{Module: module}
+			defer func() { results[idx] = result }()
+
+			for _, dep := range p.deps[module.Metadata.Name] {
+				<-done[dep]
+				if depResult := results[index[dep]]; depResult.Err != nil {
+					result.Skipped = true
+					result.Err = &DependencyFailedError{Module: module.Metadata.Name, Dependency: dep}
+					return
+				}
+			}
+			resolved, err := resolveReferences(module, func(ref ModuleReference) (string, bool) {
+				dep := index[ref.Module]
+				if ref.Kind == ReferenceState {
+					return stateValue(states[dep], ref.Key)
+				}
+				value, ok := results[dep].Result.Outputs[ref.Key]
+				return value, ok
+			})
+			if err != nil {
+				result.Err = err
+				return
+			}
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if ctx.Context != nil && ctx.Context.Err() != nil {
+				result.Err = ctx.Context.Err()
+				return
+			}
+			moduleCtx := ctx.Child(module.Metadata.Name)
+			deployment := NewDeployableModule(moduleCtx, resolved, opts...)
+			result.Result, result.Err = deployment.Deploy(moduleCtx)
+			if result.Err == nil && p.stateRefs[module.Metadata.Name] {
+				states[idx], result.Err = deployment.GetState(moduleCtx)
+			}
+		}(idx, module)
+	}
+	wg.Wait()
+	return results
+}
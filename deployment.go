@@ -0,0 +1,333 @@
+package atkmod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeploymentResult is the outcome of a single deployment of a module.
+type DeploymentResult struct {
+	Module    string `json:"module" yaml:"module"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	RunID     string `json:"runId" yaml:"runId"`
+	// State is the state of the module when the deployment finished.
+	State State `json:"state" yaml:"state"`
+	// FailedState is the state that the deployment was in when it failed,
+	// if it failed.
+	FailedState State     `json:"failedState,omitempty" yaml:"failedState,omitempty"`
+	Error       string    `json:"error,omitempty" yaml:"error,omitempty"`
+	StartedAt   time.Time `json:"startedAt" yaml:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt" yaml:"finishedAt"`
+	// Stages is how long the deployment spent in each of the states that it
+	// went through, in order.
+	Stages []StageTiming `json:"stages,omitempty" yaml:"stages,omitempty"`
+	// Provenance is the provenance of a successful deployment, if it was
+	// enabled with WithProvenance.
+	Provenance *Provenance `json:"provenance,omitempty" yaml:"provenance,omitempty"`
+	// CancelReason is the reason given to Cancel, if the deployment was
+	// cancelled.
+	CancelReason string `json:"cancelReason,omitempty" yaml:"cancelReason,omitempty"`
+	// InitialState is the state that the get_state hook of the module
+	// reported before the deployment started, if it reported one.
+	InitialState *ModuleState `json:"initialState,omitempty" yaml:"initialState,omitempty"`
+	// Validation is the result of the validate hook of the module, if it
+	// was run.
+	Validation *ValidationResult `json:"validation,omitempty" yaml:"validation,omitempty"`
+	// Vulnerabilities are the images with vulnerabilities at or above the
+	// threshold of WithVulnScan, which stopped the deployment.
+	Vulnerabilities []ImageScanReport `json:"vulnerabilities,omitempty" yaml:"vulnerabilities,omitempty"`
+	// Transcript is the path of the transcript of the deployment, if it was
+	// written. See WithTranscript.
+	Transcript string `json:"transcript,omitempty" yaml:"transcript,omitempty"`
+	// Includes are the results of the deployments of the included modules,
+	// in the order that they were deployed. See WithIncludes.
+	Includes []*DeploymentResult `json:"includes,omitempty" yaml:"includes,omitempty"`
+	// Outputs are the outputs that the scanners of the stages extracted.
+	Outputs map[string]string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	// Failure describes the stage that the deployment failed in, if it
+	// failed in one of its states.
+	Failure *FailureDiagnostics `json:"failure,omitempty" yaml:"failure,omitempty"`
+	// Changes are the artifacts that the deployment created on the host, if
+	// it took snapshots with WithEnvironmentSnapshot.
+	Changes *EnvironmentChanges `json:"changes,omitempty" yaml:"changes,omitempty"`
+	// Artifacts are the files that the stages produced, which were copied
+	// to the artifacts directory.
+	Artifacts []Artifact `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+}
+
+// Succeeded returns true if the deployment finished without errors.
+func (r DeploymentResult) Succeeded() bool {
+	return r.State == Done && len(r.Error) == 0
+}
+
+// Duration returns how long the deployment took.
+func (r DeploymentResult) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// DeadlineExceededError is returned by Deploy when the deployment did not
+// finish before the deadline set with WithDeadline.
+type DeadlineExceededError struct {
+	Module   string
+	State    State
+	Deadline time.Duration
+}
+
+func (e *DeadlineExceededError) Error() string {
+	return fmt.Sprintf("deployment of module %s did not finish within %s; it was in state %s", e.Module, e.Deadline, e.State)
+}
+
+// Unwrap returns context.DeadlineExceeded.
+func (e *DeadlineExceededError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// WithDeadline limits the time that Deploy can take across all of the
+// stages. When the deadline passes, the command of the stage that is running
+// is killed and the deployment moves to the TimedOut state with a
+// DeadlineExceededError.
+func WithDeadline(d time.Duration) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.deadline = d
+	}
+}
+
+// timeOut moves the deployment to the TimedOut state. If the stage that was
+// running already moved the deployment to Errored, the state that it failed
+// in is kept as the previous state.
+func (m *DeployableModule) timeOut(err error) {
+	m.runCtx.AddError(err)
+	previous := m.machine.Current()
+	if previous == Errored {
+		previous = m.machine.Previous()
+	}
+	m.recordTransition(Transition{From: m.machine.Current(), To: TimedOut}, err)
+	m.machine.Restore(TimedOut, previous)
+	m.emitStateChange(err)
+}
+
+// notStarted records the error that stopped the deployment before it ran
+// any of its states.
+func (r *DeploymentResult) notStarted(state State, err error) {
+	r.FinishedAt = time.Now().UTC()
+	r.State = state
+	r.FailedState = state
+	r.Error = err.Error()
+}
+
+// Deploy drives the deployment through all of its states, starting from the
+// current one, until it is done or fails. If the module declares
+// requirements, they are checked with Preflight first, and a PreflightError
+// is returned if the host does not meet them. If the deployment has a
+// VulnScanner, the images are scanned next. If the deployment has a locker,
+// the module is locked for the whole deployment and a LockedError is
+// returned if another deployment holds the lock. The result is recorded in
+// the history of the deployment, if it has one, and is returned along with
+// the error that stopped the deployment. Each state is run with a context
+// derived from ctx with Child, so ctx.Summary reports the outcome of each
+// stage.
+func (m *DeployableModule) Deploy(ctx *RunContext) (*DeploymentResult, error) {
+	result := &DeploymentResult{
+		Module:    m.module.Metadata.Name,
+		Namespace: m.module.Metadata.Namespace,
+		RunID:     m.runID,
+		StartedAt: time.Now().UTC(),
+	}
+
+	if err := m.ValidateHandlers(); err != nil {
+		result.notStarted(m.machine.Current(), err)
+		return result, err
+	}
+	if err := m.checkMounts(); err != nil {
+		result.notStarted(m.machine.Current(), err)
+		return result, err
+	}
+
+	if _, err := m.Preflight(ctx); err != nil {
+		result.notStarted(m.machine.Current(), err)
+		return result, err
+	}
+	if reports, err := m.ScanImages(ctx); err != nil {
+		result.Vulnerabilities = reports
+		result.notStarted(m.machine.Current(), err)
+		return result, err
+	}
+
+	if m.locker != nil {
+		lock, err := m.locker.Acquire(m.module, m.workspace(), m.runID)
+		if err != nil {
+			result.notStarted(m.machine.Current(), err)
+			return result, err
+		}
+		defer func() {
+			if rerr := lock.Release(); rerr != nil {
+				ctx.Log.WithField(RunIDLogField, m.runID).Warnf("could not release the lock of module %s: %v", m.module.Metadata.Name, rerr)
+			}
+		}()
+	}
+
+	if m.snapshot {
+		m.before = m.takeSnapshot(ctx)
+	}
+
+	if len(m.transcript) > 0 && !m.captureOutput {
+		// The output is only captured for the transcript.
+		m.captureOutput = true
+		defer func() {
+			m.CloseOutputs()
+			m.captureOutput = false
+		}()
+	}
+	if m.transcriptEvents != nil {
+		m.transcriptEvents.reset()
+	}
+
+	progress := m.newProgressTracker(ctx, result.StartedAt)
+	m.tracker = progress
+	defer func() { m.tracker = nil }()
+	progress.report()
+
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	runContext, cancel := parent, context.CancelFunc(func() {})
+	if m.deadline > 0 {
+		runContext, cancel = context.WithTimeout(parent, m.deadline)
+	}
+	defer cancel()
+	runContext, cancelRun := context.WithCancel(runContext)
+	defer cancelRun()
+	m.setCancelRun(cancelRun)
+	defer m.setCancelRun(nil)
+
+	m.rejected = nil
+	m.stageMu.Lock()
+	m.artifacts = nil
+	m.stageMu.Unlock()
+	budgets := m.stageBudgets(ctx)
+	var err error
+	var step StateCmd
+	var failed *FailureDiagnostics
+	for next, hasNext := m.Itr(); hasNext; {
+		if runContext.Err() != nil || m.IsCancelled() {
+			break
+		}
+		step, hasNext = next()
+		state, stepStarted := m.machine.Current(), time.Now()
+		writeJSONLog(ctx, JSONLogRecord{Type: StageStartRecord, RunID: m.runID, Module: m.module.Metadata.Name, State: state})
+		// Each state runs with its own context, so the errors of one stage
+		// are not mixed with those of the others.
+		stageCtx := ctx.Child(string(state))
+		stageCtx.Context = runContext
+		status := m.showsStatus(ctx, state)
+		if status {
+			m.decorator.Started(ctx.Out, state)
+		}
+		stopWatch := m.warnIfSlow(ctx, budgets, state)
+		err = step(stageCtx, m)
+		stopWatch()
+		elapsed := time.Since(stepStarted)
+		if status || (err != nil && m.decorator != nil && ctx.Verbosity != VerbositySilent) {
+			m.decorator.Stopped(ctx.Out, state, elapsed, err)
+		}
+		result.Stages = append(result.Stages, StageTiming{State: state, Duration: elapsed})
+		m.logStageStop(ctx, state, elapsed, err)
+		progress.report()
+		if failed == nil && (err != nil || m.IsErrored()) {
+			failed = m.newFailureDiagnostics(state, stageCtx, err)
+		}
+		if err != nil {
+			break
+		}
+	}
+	var cancelled *CancelledError
+	if reason, ok := m.cancelReason(); ok && m.machine.Current() != Done && !m.IsErrored() {
+		cancelled = m.finishCancel(ctx, parent, reason)
+		err = cancelled
+		result.CancelReason = reason
+	}
+	if cancelled == nil && m.deadline > 0 && errors.Is(runContext.Err(), context.DeadlineExceeded) && m.machine.Current() != Done {
+		state := m.machine.Current()
+		if state == Errored {
+			state = m.machine.Previous()
+		}
+		err = &DeadlineExceededError{Module: m.module.Metadata.Name, State: state, Deadline: m.deadline}
+		m.timeOut(err)
+	}
+	if err == nil && m.rejected != nil {
+		err = m.rejected
+	}
+	if err == nil && m.IsErrored() {
+		err = fmt.Errorf("deployment of module %s failed in state %s", m.module.Metadata.Name, m.machine.Previous())
+	}
+
+	result.FinishedAt = time.Now().UTC()
+	result.State = m.machine.Current()
+	result.InitialState = m.initialState
+	result.Validation = m.validation
+	result.Includes = m.includeResults
+	result.Outputs = m.Outputs()
+	result.Artifacts = m.Artifacts()
+	if m.snapshot {
+		// The changes are taken before the result is recorded, so that the
+		// history, the transcript and the notifications have them.
+		m.changes = m.takeSnapshot(ctx).changesSince(m.before)
+		result.Changes = m.changes
+	}
+	var suspended *SuspendedError
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if err != nil && !errors.As(err, &suspended) && cancelled == nil {
+		result.FailedState = m.machine.Current()
+		if m.IsErrored() {
+			result.FailedState = m.machine.Previous()
+		}
+		result.Failure = failed
+	}
+
+	if err == nil && m.provenance != nil && result.Succeeded() {
+		provenance, perr := m.newProvenance(ctx, result)
+		if perr != nil {
+			ctx.Log.WithField(RunIDLogField, m.runID).Warnf("could not generate the provenance of the deployment: %v", perr)
+		}
+		result.Provenance = provenance
+	}
+
+	if len(m.transcript) > 0 {
+		result.Transcript = m.transcript
+		if terr := m.WriteTranscript(m.transcript, result); terr != nil {
+			ctx.Log.WithField(RunIDLogField, m.runID).Warnf("%v", terr)
+			result.Transcript = ""
+		}
+	}
+	if m.history != nil {
+		if herr := m.history.Record(*result); herr != nil {
+			ctx.Log.WithField(RunIDLogField, m.runID).Warnf("could not record the deployment history: %v", herr)
+		}
+	}
+	if suspended == nil {
+		m.notify(ctx, result)
+	}
+	return result, err
+}
+
+// logStageStop writes the stage_stop record of the state to the JSON log of
+// the context.
+func (m *DeployableModule) logStageStop(ctx *RunContext, state State, elapsed time.Duration, err error) {
+	record := JSONLogRecord{
+		Type:       StageStopRecord,
+		RunID:      m.runID,
+		Module:     m.module.Metadata.Name,
+		State:      state,
+		Next:       m.machine.Current(),
+		DurationMs: elapsed.Milliseconds(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	writeJSONLog(ctx, record)
+}
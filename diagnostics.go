@@ -0,0 +1,68 @@
+package atkmod
+
+import (
+	"strings"
+)
+
+// DefaultFailureStderrLines is the number of lines at the end of the error
+// stream of a failed stage that are kept in its FailureDiagnostics.
+const DefaultFailureStderrLines = 20
+
+// FailureDiagnostics describe the stage that a deployment failed in, so that
+// the failure can be reported without digging through the logs.
+type FailureDiagnostics struct {
+	// State is the state that failed.
+	State State `json:"state" yaml:"state"`
+	// ExitCode is the exit code of the container of the stage, or zero if it
+	// did not exit with one, such as when it could not be started.
+	ExitCode int `json:"exitCode,omitempty" yaml:"exitCode,omitempty"`
+	// Command is the last command that was run for the stage, with the
+	// masked values masked, if the runner runs commands.
+	Command []string `json:"command,omitempty" yaml:"command,omitempty"`
+	// Stderr is the last lines of the error stream of the stage.
+	Stderr []string `json:"stderr,omitempty" yaml:"stderr,omitempty"`
+	// Errors are the errors of the stage.
+	Errors []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// WithFailureStderrLines keeps the last n lines of the error stream of a
+// failed stage in the FailureDiagnostics of the result, instead of
+// DefaultFailureStderrLines.
+func WithFailureStderrLines(n int) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.failureLines = n
+	}
+}
+
+// newFailureDiagnostics returns the diagnostics of the state that failed,
+// which ran with the context.
+func (m *DeployableModule) newFailureDiagnostics(state State, ctx *RunContext, err error) *FailureDiagnostics {
+	d := &FailureDiagnostics{
+		State:    state,
+		ExitCode: ctx.LastErrCode,
+		Command:  ctx.Command(),
+		Stderr:   lastLines(ctx.Stderr(), m.failureLines),
+	}
+	if code, ok := ExitCodeOf(err); ok && d.ExitCode == 0 {
+		d.ExitCode = code
+	}
+	for _, e := range ctx.AllErrors() {
+		d.Errors = append(d.Errors, e.Error())
+	}
+	if len(d.Errors) == 0 && err != nil {
+		d.Errors = []string{err.Error()}
+	}
+	return d
+}
+
+// lastLines returns the last n non empty lines of the string.
+func lastLines(s string, n int) []string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) == 1 && len(lines[0]) == 0 || n <= 0 {
+		return nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
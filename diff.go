@@ -0,0 +1,139 @@
+package atkmod
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DiffChange is the kind of change of a field between the target of the
+// manifest and the state reported by the module.
+type DiffChange string
+
+const (
+	// DiffAdd is a field of the target that the module does not report.
+	DiffAdd DiffChange = "add"
+	// DiffUpdate is a field that the module reports with another value.
+	DiffUpdate DiffChange = "update"
+)
+
+// FieldDiff is the difference of a single field. The Path uses dots to
+// separate the keys of the reported state, such as data.region.
+type FieldDiff struct {
+	Path    string     `json:"path" yaml:"path"`
+	Change  DiffChange `json:"change" yaml:"change"`
+	Desired string     `json:"desired" yaml:"desired"`
+	Actual  string     `json:"actual,omitempty" yaml:"actual,omitempty"`
+}
+
+// StateDiff is the difference between the target declared by the manifest
+// and the state reported by the get_state hook, which is what a re-deploy
+// would change.
+type StateDiff struct {
+	Module  string      `json:"module" yaml:"module"`
+	Changes []FieldDiff `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+// Empty returns true if the module is in the target state.
+func (d *StateDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// String returns the diff in the form of a plan, with + for the added
+// fields and ~ for the updated ones.
+func (d *StateDiff) String() string {
+	if d.Empty() {
+		return fmt.Sprintf("module %s is up to date\n", d.Module)
+	}
+	b := new(strings.Builder)
+	for _, c := range d.Changes {
+		switch c.Change {
+		case DiffAdd:
+			fmt.Fprintf(b, "+ %s: %s\n", c.Path, c.Desired)
+		default:
+			fmt.Fprintf(b, "~ %s: %s -> %s\n", c.Path, c.Actual, c.Desired)
+		}
+	}
+	return b.String()
+}
+
+// Diff runs the get_state hook and compares the state that the module
+// reports with the target declared by the manifest. The target is a health
+// status of DEPLOYED and, in the data of the state, the values of the
+// environment variables of the deploy stage. Variables without a value in
+// the manifest are set from the input of the deployment, so they are not
+// compared.
+func (m *DeployableModule) Diff(ctx *RunContext) (*StateDiff, error) {
+	state, err := m.GetState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &StateDiff{Module: m.module.Metadata.Name}
+	if !state.IsDeployed() {
+		change := DiffUpdate
+		if len(strings.TrimSpace(state.Health.Status)) == 0 {
+			change = DiffAdd
+		}
+		diff.Changes = append(diff.Changes, FieldDiff{
+			Path:    "health.status",
+			Change:  change,
+			Desired: HealthDeployed,
+			Actual:  state.Health.Status,
+		})
+	}
+
+	reported := make(map[string]string)
+	flattenState("data", state.Data, reported)
+	for _, e := range m.module.Specifications.Lifecycle.Deploy.EnvVars {
+		if len(e.Value) == 0 || e.Name == RunIDEnvVar {
+			continue
+		}
+		path := "data." + e.Name
+		actual, found := lookupReported(reported, path)
+		switch {
+		case !found:
+			diff.Changes = append(diff.Changes, FieldDiff{Path: path, Change: DiffAdd, Desired: e.Value})
+		case actual != e.Value:
+			diff.Changes = append(diff.Changes, FieldDiff{Path: path, Change: DiffUpdate, Desired: e.Value, Actual: actual})
+		}
+	}
+	return diff, nil
+}
+
+// lookupReported finds the value of the path, ignoring the case of the keys
+// if there is no exact match, as modules often report the variables in
+// lower case.
+func lookupReported(reported map[string]string, path string) (string, bool) {
+	if value, found := reported[path]; found {
+		return value, true
+	}
+	keys := make([]string, 0, len(reported))
+	for key := range reported {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.EqualFold(key, path) {
+			return reported[key], true
+		}
+	}
+	return "", false
+}
+
+// flattenState adds the values of the data to the map by their paths.
+func flattenState(path string, data interface{}, into map[string]string) {
+	switch v := data.(type) {
+	case nil:
+	case map[string]interface{}:
+		for key, value := range v {
+			flattenState(path+"."+key, value, into)
+		}
+	case []interface{}:
+		for idx, value := range v {
+			flattenState(fmt.Sprintf("%s[%d]", path, idx), value, into)
+		}
+	default:
+		into[path] = fmt.Sprint(v)
+	}
+}
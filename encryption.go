@@ -0,0 +1,296 @@
+package atkmod
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNoEncryptionKey is returned by a KeySource that has no key, such as a
+// key file that does not exist. The values of the variables are not
+// persisted when there is no key.
+var ErrNoEncryptionKey = errors.New("no encryption key is available")
+
+// CipherAES256GCM is the cipher of the SealedVariables.
+const CipherAES256GCM = "aes-256-gcm"
+
+// KeySource returns the key that encrypts the values of the variables that
+// are persisted, such as in the checkpoints made by Suspend.
+type KeySource interface {
+	// Key returns the key, or an error that wraps ErrNoEncryptionKey if
+	// there is none.
+	Key() ([]byte, error)
+}
+
+// KeySourceFunc is a function that is a KeySource.
+type KeySourceFunc func() ([]byte, error)
+
+// Key calls the function.
+func (f KeySourceFunc) Key() ([]byte, error) {
+	return f()
+}
+
+// KeyFile returns the KeySource that reads the key from the file, such as one
+// created by GenerateKeyFile or an age identity file. The key is the SHA-256
+// of the trimmed content of the file, so a file of any length can be used. A
+// file that does not exist has no key.
+func KeyFile(path string) KeySource {
+	return KeySourceFunc(func() ([]byte, error) {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: key file %s does not exist", ErrNoEncryptionKey, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return deriveKey(content, path)
+	})
+}
+
+// GenerateKeyFile writes a new random key to the file, which is only
+// readable by the user. An existing file is not overwritten.
+func GenerateKeyFile(path string) error {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, base64.StdEncoding.EncodeToString(key)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// CredentialKey returns the KeySource that derives the key from the secret
+// of the server in the credential store, such as the keychain of the OS.
+// The key is the SHA-256 of the secret. There is no key if the store has no
+// credential for the server.
+func CredentialKey(store CredentialStore, server string) KeySource {
+	return KeySourceFunc(func() ([]byte, error) {
+		cred, err := store.Get(server)
+		if errors.Is(err, ErrCredentialNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrNoEncryptionKey, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return deriveKey([]byte(cred.Secret), "the secret of "+server)
+	})
+}
+
+// KeychainKey returns the CredentialKey of the server in the keychain of
+// the OS, which is the store of NewKeychainStore.
+func KeychainKey(server string) KeySource {
+	return CredentialKey(NewKeychainStore(), server)
+}
+
+func deriveKey(secret []byte, from string) ([]byte, error) {
+	secret = bytes.TrimSpace(secret)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%w: %s is empty", ErrNoEncryptionKey, from)
+	}
+	key := sha256.Sum256(secret)
+	return key[:], nil
+}
+
+// SealedVariables are variables, with their values, that are encrypted with
+// SealVariables.
+type SealedVariables struct {
+	Cipher string `json:"cipher" yaml:"cipher"`
+	// Data is the nonce followed by the encrypted variables.
+	Data []byte `json:"data" yaml:"data"`
+}
+
+// SealVariables encrypts the variables with the 32 byte key.
+func SealVariables(key []byte, vars []EventDataVarInfo) (*SealedVariables, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(vars)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return &SealedVariables{Cipher: CipherAES256GCM, Data: aead.Seal(nonce, nonce, plain, nil)}, nil
+}
+
+// Open decrypts the variables with the key that they were sealed with.
+func (s *SealedVariables) Open(key []byte) ([]EventDataVarInfo, error) {
+	if s.Cipher != CipherAES256GCM {
+		return nil, fmt.Errorf("unsupported cipher %s", s.Cipher)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Data) < aead.NonceSize() {
+		return nil, errors.New("the sealed variables are truncated")
+	}
+	nonce, data := s.Data[:aead.NonceSize()], s.Data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, errors.New("could not decrypt the variables; the key is not the one they were sealed with")
+	}
+	vars := make([]EventDataVarInfo, 0)
+	if err := json.Unmarshal(plain, &vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("the key must be 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// MissingVariablesError is returned by Resume when the values of the
+// variables of the suspended deployment were not persisted, or cannot be
+// decrypted, and are not given with WithVariables. The user must be prompted
+// for them again.
+type MissingVariablesError struct {
+	Module string
+	Names  []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return fmt.Sprintf("the values of the variables %s of module %s were not saved and must be given again", strings.Join(e.Names, ", "), e.Module)
+}
+
+// WithVariableEncryption encrypts the values of the variables of the
+// deployment that are persisted, such as in the checkpoints made by Suspend,
+// with the key of the source. Without it, or when the source has no key, the
+// values are not persisted, only their names, so that the user can be
+// prompted for them again.
+func WithVariableEncryption(keys KeySource) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.variableKeys = keys
+	}
+}
+
+// CanPersistVariables returns true if the values of the variables of the
+// deployment are persisted, encrypted, because it has a key to encrypt them.
+func (m *DeployableModule) CanPersistVariables() bool {
+	_, err := m.variableKey()
+	return err == nil
+}
+
+func (m *DeployableModule) variableKey() ([]byte, error) {
+	if m.variableKeys == nil {
+		return nil, ErrNoEncryptionKey
+	}
+	return m.variableKeys.Key()
+}
+
+// sealVariables adds the variables of the deployment whose values are not
+// their defaults to the checkpoint, encrypted if there is a key, or else only
+// their names.
+func (m *DeployableModule) sealVariables(ctx *RunContext, info *CheckpointInfo) error {
+	var vars []EventDataVarInfo
+	for _, v := range m.Variables().Variables {
+		if len(v.Value) > 0 && v.Value != v.Default {
+			vars = append(vars, v)
+			info.VariableNames = append(info.VariableNames, v.Name)
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+	key, err := m.variableKey()
+	if errors.Is(err, ErrNoEncryptionKey) {
+		ctx.Log.WithField(RunIDLogField, m.runID).Debugf("the variables of module %s are not saved with the checkpoint: %v", m.module.Metadata.Name, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info.Variables, err = SealVariables(key, vars)
+	return err
+}
+
+// OpenVariables returns the variables of the checkpoint that could be
+// decrypted with the key of the source, and the names of the variables
+// whose values were not saved or cannot be decrypted, which must be given
+// again.
+func (c *CheckpointInfo) OpenVariables(keys KeySource) ([]EventDataVarInfo, []string, error) {
+	var vars []EventDataVarInfo
+	if c.Variables != nil && keys != nil {
+		key, err := keys.Key()
+		if err != nil && !errors.Is(err, ErrNoEncryptionKey) {
+			return nil, nil, err
+		}
+		if err == nil {
+			if vars, err = c.Variables.Open(key); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	opened := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		opened[v.Name] = true
+	}
+	var missing []string
+	for _, name := range c.VariableNames {
+		if !opened[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return vars, missing, nil
+}
+
+// restoreVariables adds the variables that were saved with the checkpoint
+// to the deployment, unless they are given with WithVariables, which take
+// precedence.
+func (m *DeployableModule) restoreVariables(info *CheckpointInfo) error {
+	given := make(map[string]bool, len(m.variables))
+	for _, v := range m.variables {
+		given[v.Name] = len(v.Value) > 0
+	}
+	vars, missing, err := info.OpenVariables(m.variableKeys)
+	if err != nil {
+		return fmt.Errorf("could not restore the variables of run %s: %w", info.RunID, err)
+	}
+	for _, v := range vars {
+		if !given[v.Name] {
+			m.variables = append(m.variables, v)
+		}
+	}
+	var names []string
+	for _, name := range missing {
+		if !given[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		return &MissingVariablesError{Module: m.module.Metadata.Name, Names: names}
+	}
+	return nil
+}
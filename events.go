@@ -0,0 +1,291 @@
+package atkmod
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// supportedSpecVersion is the CloudEvents specversion supported by this
+// package.
+const supportedSpecVersion = "1.0"
+
+// ApplicationYAML is the datacontenttype of events with YAML data.
+const ApplicationYAML = "application/yaml"
+
+// EventSource is the default source of the events created by this package.
+const EventSource = "https://github.com/cloud-native-toolkit/atkmod"
+
+// InvalidEventError is returned when an event is missing required fields or
+// is not of the expected type.
+type InvalidEventError struct {
+	// Type is the type of the invalid event, if known.
+	Type     string
+	Problems []string
+}
+
+func (e *InvalidEventError) Error() string {
+	if len(e.Type) > 0 {
+		return fmt.Sprintf("invalid event of type %s: %s", e.Type, strings.Join(e.Problems, "; "))
+	}
+	return fmt.Sprintf("invalid event: %s", strings.Join(e.Problems, "; "))
+}
+
+// mediaTypeOf returns the media type of the content type without any
+// parameters, such as the charset.
+func mediaTypeOf(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// isJSONContentType returns true if the content type is JSON.
+func isJSONContentType(contentType string) bool {
+	mediaType := mediaTypeOf(contentType)
+	return mediaType == cloudevents.ApplicationJSON || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// isYAMLContentType returns true if the content type is YAML.
+func isYAMLContentType(contentType string) bool {
+	switch mediaType := mediaTypeOf(contentType); mediaType {
+	case ApplicationYAML, "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	default:
+		return strings.HasSuffix(mediaType, "+yaml")
+	}
+}
+
+// ValidateEvent checks that the event has a supported specversion, an id, a
+// source, a type, a JSON or YAML datacontenttype and data. If expected is not empty,
+// the event must also be of the expected type. All of the problems are
+// returned in a single InvalidEventError.
+func ValidateEvent(event *cloudevents.Event, expected ModuleEventType) error {
+	problems := make([]string, 0)
+	if event.SpecVersion() != supportedSpecVersion {
+		problems = append(problems, fmt.Sprintf("specversion must be %s, got %q", supportedSpecVersion, event.SpecVersion()))
+	}
+	if len(event.ID()) == 0 {
+		problems = append(problems, "id is required")
+	}
+	if len(event.Source()) == 0 {
+		problems = append(problems, "source is required")
+	}
+	if len(event.Type()) == 0 {
+		problems = append(problems, "type is required")
+	} else if len(expected) > 0 && event.Type() != string(expected) {
+		problems = append(problems, fmt.Sprintf("expected type %s", expected))
+	}
+	if len(event.DataContentType()) == 0 {
+		problems = append(problems, "datacontenttype is required")
+	} else if !isJSONContentType(event.DataContentType()) && !isYAMLContentType(event.DataContentType()) {
+		problems = append(problems, fmt.Sprintf("datacontenttype %s is not supported", event.DataContentType()))
+	}
+	if len(strings.TrimSpace(string(event.Data()))) == 0 {
+		problems = append(problems, "data is required")
+	}
+	if len(problems) > 0 {
+		return &InvalidEventError{Type: event.Type(), Problems: problems}
+	}
+	return nil
+}
+
+// LoadEventOfType loads the CloudEvent from the JSON or YAML string and
+// validates that it has all of the required fields and is of the expected
+// type.
+func LoadEventOfType(eventS string, expected ModuleEventType) (*cloudevents.Event, error) {
+	return loadEvent(eventS, expected)
+}
+
+// NewEvent creates an event of the given type with a new UUID as the id, the
+// current time, EventSource as the source and the data as JSON.
+func NewEvent(eventType ModuleEventType, subject string, data interface{}) (*cloudevents.Event, error) {
+	event := cloudevents.NewEvent()
+	event.SetID(uuid.New().String())
+	event.SetSource(EventSource)
+	event.SetType(string(eventType))
+	event.SetSubject(subject)
+	event.SetTime(time.Now().UTC())
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// mustNewEvent creates the event with data that is always serializable to
+// JSON, so an error is a programming error.
+func mustNewEvent(eventType ModuleEventType, subject string, data interface{}) *cloudevents.Event {
+	event, err := NewEvent(eventType, subject, data)
+	if err != nil {
+		panic(err)
+	}
+	return event
+}
+
+// NewListResponseEvent creates the event written by a list hook with the
+// variables of the module.
+func NewListResponseEvent(subject string, data EventData) *cloudevents.Event {
+	return mustNewEvent(ListHookResponseEvent, subject, data)
+}
+
+// NewValidateRequestEvent creates the event sent to a validate hook with the
+// variables to validate.
+func NewValidateRequestEvent(subject string, data EventData) *cloudevents.Event {
+	return mustNewEvent(ValidateHookRequestEvent, subject, data)
+}
+
+// NewValidateResponseEvent creates the event written by a validate hook with
+// the result of the validation.
+func NewValidateResponseEvent(subject string, data ValidateResponseData) *cloudevents.Event {
+	return mustNewEvent(ValidateHookResponseEvent, subject, data)
+}
+
+// NewGetStateRequestEvent creates the event sent to a get_state hook.
+func NewGetStateRequestEvent(subject string, data EventData) *cloudevents.Event {
+	return mustNewEvent(GetStateHookRequestEvent, subject, data)
+}
+
+// NewGetStateResponseEvent creates the event written by a get_state hook. The
+// data can be any value that can be serialized to JSON.
+func NewGetStateResponseEvent(subject string, data interface{}) (*cloudevents.Event, error) {
+	return NewEvent(GetStateHookResponseEvent, subject, data)
+}
+
+// setDeploymentExtensions sets the extensions of the deployment and the
+// identity of the module on an event that is sent by the deployment, such as
+// a request sent to a hook or a change of state.
+func (m *DeployableModule) setDeploymentExtensions(event *cloudevents.Event) {
+	event.SetExtension(RunIDExtension, m.runID)
+	setModuleExtensions(event, m.module, m.manifestChecksum())
+}
+
+// DecodeEventData decodes the data of the event into v according to the
+// datacontenttype of the event, which can be JSON or YAML. Data that was
+// sent base64 encoded (data_base64) has already been decoded by the
+// CloudEvents SDK when the event was loaded.
+func DecodeEventData(event *cloudevents.Event, v interface{}) error {
+	contentType := event.DataContentType()
+	switch {
+	case len(contentType) == 0, isJSONContentType(contentType):
+		return json.Unmarshal(event.Data(), v)
+	case isYAMLContentType(contentType):
+		return yaml.Unmarshal(event.Data(), v)
+	default:
+		return fmt.Errorf("cannot decode data with datacontenttype %s", contentType)
+	}
+}
+
+// LoadEventYAML loads a CloudEvent from the YAML string and validates that
+// it has all of the required fields. The data of the event is kept in the
+// format of its datacontenttype, so YAML data in an event with a JSON
+// datacontenttype is converted to JSON.
+func LoadEventYAML(eventS string) (*cloudevents.Event, error) {
+	return loadEventYAML(eventS, "")
+}
+
+func loadEventYAML(eventS string, expected ModuleEventType) (*cloudevents.Event, error) {
+	var envelope map[string]interface{}
+	if err := yaml.Unmarshal([]byte(eventS), &envelope); err != nil {
+		return nil, err
+	}
+	if envelope == nil {
+		return nil, &InvalidEventError{Problems: []string{"event is empty"}}
+	}
+	data, hasData := envelope["data"]
+	delete(envelope, "data")
+	raw, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	event := cloudevents.NewEvent()
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, err
+	}
+
+	if hasData && data != nil {
+		contentType := event.DataContentType()
+		var encoded []byte
+		switch {
+		case len(contentType) == 0, isJSONContentType(contentType):
+			encoded, err = json.Marshal(data)
+		case isYAMLContentType(contentType):
+			encoded, err = yaml.Marshal(data)
+		default:
+			// Other content types, such as text/plain, are kept as written.
+			if str, ok := data.(string); ok {
+				encoded = []byte(str)
+			} else {
+				encoded, err = json.Marshal(data)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := event.SetData(contentType, encoded); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateEvent(&event, expected); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// yamlEnvelope is the YAML representation of a CloudEvent, with the
+// attributes in the same order as the JSON format.
+type yamlEnvelope struct {
+	SpecVersion     string                 `yaml:"specversion"`
+	Type            string                 `yaml:"type"`
+	Source          string                 `yaml:"source"`
+	Subject         string                 `yaml:"subject,omitempty"`
+	ID              string                 `yaml:"id"`
+	Time            string                 `yaml:"time,omitempty"`
+	DataSchema      string                 `yaml:"dataschema,omitempty"`
+	DataContentType string                 `yaml:"datacontenttype,omitempty"`
+	Extensions      map[string]interface{} `yaml:",inline"`
+	Data            interface{}            `yaml:"data,omitempty"`
+	DataBase64      string                 `yaml:"data_base64,omitempty"`
+}
+
+// WriteEventYAML writes the event to the writer as YAML. JSON and YAML data
+// is written as structured YAML, and any other data is written base64
+// encoded in data_base64.
+func WriteEventYAML(event *cloudevents.Event, out io.Writer) error {
+	envelope := &yamlEnvelope{
+		SpecVersion:     event.SpecVersion(),
+		Type:            event.Type(),
+		Source:          event.Source(),
+		Subject:         event.Subject(),
+		ID:              event.ID(),
+		DataSchema:      event.DataSchema(),
+		DataContentType: event.DataContentType(),
+		Extensions:      event.Extensions(),
+	}
+	if !event.Time().IsZero() {
+		envelope.Time = event.Time().Format(time.RFC3339Nano)
+	}
+	if len(event.Data()) > 0 {
+		contentType := event.DataContentType()
+		if len(contentType) == 0 || isJSONContentType(contentType) || isYAMLContentType(contentType) {
+			// YAML is a superset of JSON, so this works for both.
+			var data interface{}
+			if err := yaml.Unmarshal(event.Data(), &data); err != nil {
+				return err
+			}
+			envelope.Data = data
+		} else {
+			envelope.DataBase64 = base64.StdEncoding.EncodeToString(event.Data())
+		}
+	}
+
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(envelope); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,228 @@
+package atkmod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultEventSinkTimeout is how long a deployment waits for a sink to
+// accept an event before it moves on.
+const DefaultEventSinkTimeout = 2 * time.Second
+
+// EventSink receives the events emitted by a DeployableModule, such as state
+// changes and the requests sent to the hooks, so that other systems can
+// follow a deployment in real time.
+type EventSink interface {
+	Send(ctx context.Context, event *cloudevents.Event) error
+	Close() error
+}
+
+// StateChange is the data of a StateChangedEvent.
+type StateChange struct {
+	Module   string `json:"module" yaml:"module"`
+	Previous State  `json:"previous" yaml:"previous"`
+	Current  State  `json:"current" yaml:"current"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// WithEventSink sends the events emitted by the deployment to the given
+// sinks. Errors sending to a sink are logged but do not fail the deployment.
+func WithEventSink(sinks ...EventSink) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.sinks = append(m.sinks, sinks...)
+	}
+}
+
+// WithEventSinkTimeout sets how long the deployment waits for each sink to
+// accept an event, which is DefaultEventSinkTimeout unless it is set.
+func WithEventSinkTimeout(timeout time.Duration) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.sinkTimeout = timeout
+	}
+}
+
+// emit sends the event to all of the sinks of the deployment. Each sink gets
+// a short timeout, so that a slow sink does not hold up the deployment.
+func (m *DeployableModule) emit(event *cloudevents.Event) {
+	if len(m.sinks) == 0 {
+		return
+	}
+	parent := m.runCtx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	timeout := m.sinkTimeout
+	if timeout <= 0 {
+		timeout = DefaultEventSinkTimeout
+	}
+	for _, sink := range m.sinks {
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		err := sink.Send(ctx, event)
+		cancel()
+		if err != nil {
+			m.runCtx.Log.WithField(RunIDLogField, m.runID).Warnf("could not send event %s: %v", event.Type(), err)
+		}
+	}
+}
+
+func (m *DeployableModule) emitStateChange(err error) {
+	if len(m.sinks) == 0 {
+		return
+	}
+	change := StateChange{
+		Module:   m.module.Metadata.Name,
+		Previous: m.machine.Previous(),
+		Current:  m.machine.Current(),
+	}
+	if err != nil {
+		change.Error = err.Error()
+	}
+	event := mustNewEvent(StateChangedEvent, m.module.Metadata.Name, change)
+	m.setDeploymentExtensions(event)
+	m.emit(event)
+}
+
+// FileEventSink writes the events as JSON lines to a file.
+type FileEventSink struct {
+	mu  sync.Mutex
+	out io.WriteCloser
+}
+
+// NewFileEventSink creates a FileEventSink that appends the events to the
+// file at the given path, creating it if needed.
+func NewFileEventSink(path string) (*FileEventSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileEventSink{out: f}, nil
+}
+
+// Send writes the event as a single line of JSON.
+func (s *FileEventSink) Send(ctx context.Context, event *cloudevents.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.out.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (s *FileEventSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.out.Close()
+}
+
+// HTTPEventSink POSTs the events to a webhook in the structured CloudEvents
+// JSON format.
+type HTTPEventSink struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// NewHTTPEventSink creates an HTTPEventSink that POSTs the events to the
+// given URL, through the proxy and with the TLS configuration of the
+// DefaultConfig.
+func NewHTTPEventSink(url string) *HTTPEventSink {
+	return &HTTPEventSink{
+		URL:     url,
+		Headers: make(map[string]string),
+		Client:  newHTTPClient(10 * time.Second),
+	}
+}
+
+// Send POSTs the event and returns an error if the response is not a 2xx.
+func (s *HTTPEventSink) Send(ctx context.Context, event *cloudevents.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned status %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// Close does nothing for the HTTPEventSink.
+func (s *HTTPEventSink) Close() error {
+	return nil
+}
+
+// NATSEventSink publishes the events as JSON to a subject on a NATS server.
+type NATSEventSink struct {
+	conn    *nats.Conn
+	Subject string
+}
+
+// NewNATSEventSink connects to the NATS server at the given URL, such as
+// nats://localhost:4222, and publishes the events to the subject. The options
+// are passed to the NATS client, for example nats.UserCredentials or
+// nats.Secure to authenticate and to use TLS. The CA bundle and the client
+// certificate of the DefaultConfig are used if the server requires TLS.
+func NewNATSEventSink(url string, subject string, opts ...nats.Option) (*NATSEventSink, error) {
+	tlsOpts, err := DefaultConfig().NATSOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(append([]nats.Option{nats.Name("atkmod")}, tlsOpts...), opts...)
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSEventSink{conn: conn, Subject: subject}, nil
+}
+
+// Send publishes the event and waits until the server has received it, or
+// until the context is done.
+func (s *NATSEventSink) Send(ctx context.Context, event *cloudevents.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := s.conn.Publish(s.Subject, payload); err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		return s.conn.FlushTimeout(DefaultEventSinkTimeout)
+	}
+	return s.conn.FlushWithContext(ctx)
+}
+
+// Close flushes the pending events and closes the connection to the server.
+func (s *NATSEventSink) Close() error {
+	err := s.conn.Drain()
+	if errors.Is(err, nats.ErrConnectionClosed) {
+		return nil
+	}
+	return err
+}
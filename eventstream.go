@@ -0,0 +1,76 @@
+package atkmod
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// ErrNoEvent is returned when the output of a hook does not contain an event
+// of the expected type.
+var ErrNoEvent = errors.New("no event found in output")
+
+// ParseEvents scans the output of a hook for CloudEvents and returns all of
+// the events found, in order. Each event is expected to start on a new line,
+// either as newline-delimited JSON or as a pretty-printed JSON object. Lines
+// that are not events, such as progress messages, are ignored.
+func ParseEvents(r io.Reader) ([]*cloudevents.Event, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*cloudevents.Event, 0)
+	offset := 0
+	for offset < len(raw) {
+		line := raw[offset:]
+		end := bytes.IndexByte(line, '\n')
+		if end < 0 {
+			end = len(line)
+		}
+		if !bytes.HasPrefix(bytes.TrimSpace(line[:end]), []byte("{")) {
+			offset += end + 1
+			continue
+		}
+
+		// The object might span several lines, so decode from here rather
+		// than only the current line.
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		var obj json.RawMessage
+		if err := decoder.Decode(&obj); err != nil {
+			offset += end + 1
+			continue
+		}
+		event, err := LoadEvent(string(obj))
+		if err != nil {
+			offset += end + 1
+			continue
+		}
+		events = append(events, event)
+		offset += int(decoder.InputOffset())
+	}
+	return events, nil
+}
+
+// ParseEventStream scans the output of a hook for CloudEvents and returns the
+// last event of the expected type, or the last event of any type if expected
+// is empty. If there is no such event, ErrNoEvent is returned.
+func ParseEventStream(r io.Reader, expected ModuleEventType) (*cloudevents.Event, error) {
+	events, err := ParseEvents(r)
+	if err != nil {
+		return nil, err
+	}
+	for idx := len(events) - 1; idx >= 0; idx-- {
+		if len(expected) == 0 || events[idx].Type() == string(expected) {
+			return events[idx], nil
+		}
+	}
+	if len(expected) > 0 {
+		return nil, fmt.Errorf("%w of type %s", ErrNoEvent, expected)
+	}
+	return nil, ErrNoEvent
+}
@@ -0,0 +1,202 @@
+// Package fsm is a small, generic finite state machine. A Machine moves
+// through the states of an execution order, running the handler that is
+// registered for its current state, and has an explicit transition table of
+// the states that each state can move to.
+//
+// The states and the handlers are type parameters, so a machine only accepts
+// the states of its own type, such as:
+//
+//	type Phase string
+//
+//	m := fsm.New[Phase, func() error]("new", []Phase{"new", "running", "done"})
+//	m.Allow("running", "failed")
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrHandlerExists is returned by Handle when the state already has a
+// handler.
+var ErrHandlerExists = errors.New("handler already exists")
+
+// Table is a transition table: the states that each state can move to.
+type Table[S comparable] map[S][]S
+
+// Sequence returns the table in which each of the states can move to the
+// state after it.
+func Sequence[S comparable](order ...S) Table[S] {
+	t := make(Table[S], len(order))
+	for idx := 0; idx+1 < len(order); idx++ {
+		t.Allow(order[idx], order[idx+1])
+	}
+	return t
+}
+
+// Allow adds the transitions from the state to each of the other states.
+func (t Table[S]) Allow(from S, to ...S) {
+	for _, s := range to {
+		if !t.Allows(from, s) {
+			t[from] = append(t[from], s)
+		}
+	}
+}
+
+// Allows returns true if the table has the transition from the state to the
+// other state.
+func (t Table[S]) Allows(from S, to S) bool {
+	for _, s := range t[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Guard checks a transition before the machine makes it. A guard that
+// returns an error stops the transition.
+type Guard[S comparable] func(from S, to S) error
+
+// IllegalTransitionError is returned by Transition in strict mode for a
+// transition that is not in the transition table of the machine.
+type IllegalTransitionError[S comparable] struct {
+	From S
+	To   S
+}
+
+func (e *IllegalTransitionError[S]) Error() string {
+	return fmt.Sprintf("illegal transition from %v to %v", e.From, e.To)
+}
+
+// Machine is a state machine with states of type S and handlers of type H.
+// A Machine is not safe for concurrent use.
+type Machine[S comparable, H any] struct {
+	order    []S
+	table    Table[S]
+	handlers map[S]H
+	guards   []Guard[S]
+	strict   bool
+	previous S
+	current  S
+}
+
+// New creates a machine in the initial state that moves through the states
+// of the order. Its transition table is the Sequence of the order, to which
+// other transitions can be added with Allow.
+func New[S comparable, H any](initial S, order []S) *Machine[S, H] {
+	return &Machine[S, H]{
+		order:    append([]S(nil), order...),
+		table:    Sequence(order...),
+		handlers: make(map[S]H),
+		current:  initial,
+	}
+}
+
+// Current returns the state that the machine is in.
+func (m *Machine[S, H]) Current() S {
+	return m.current
+}
+
+// Previous returns the state that the machine was in before the current
+// state.
+func (m *Machine[S, H]) Previous() S {
+	return m.previous
+}
+
+// Order returns a copy of the execution order of the machine.
+func (m *Machine[S, H]) Order() []S {
+	return append([]S(nil), m.order...)
+}
+
+// Next returns the state after the state in the execution order, and false
+// if the state is the last one or is not in the order.
+func (m *Machine[S, H]) Next(state S) (S, bool) {
+	for idx, s := range m.order {
+		if s == state && idx+1 < len(m.order) {
+			return m.order[idx+1], true
+		}
+	}
+	var none S
+	return none, false
+}
+
+// Allow adds the transitions from the state to each of the other states to
+// the transition table of the machine.
+func (m *Machine[S, H]) Allow(from S, to ...S) {
+	m.table.Allow(from, to...)
+}
+
+// Allows returns true if the transition table of the machine has the
+// transition from the state to the other state.
+func (m *Machine[S, H]) Allows(from S, to S) bool {
+	return m.table.Allows(from, to)
+}
+
+// Table returns a copy of the transition table of the machine.
+func (m *Machine[S, H]) Table() Table[S] {
+	t := make(Table[S], len(m.table))
+	for from, to := range m.table {
+		t[from] = append([]S(nil), to...)
+	}
+	return t
+}
+
+// SetStrict turns the strict mode of the machine on or off. In strict mode,
+// Transition rejects the transitions that are not in the transition table.
+func (m *Machine[S, H]) SetStrict(strict bool) {
+	m.strict = strict
+}
+
+// Strict returns true if the machine is in strict mode.
+func (m *Machine[S, H]) Strict() bool {
+	return m.strict
+}
+
+// AddGuard adds the guard, which is checked for every transition after the
+// guards that were added before it.
+func (m *Machine[S, H]) AddGuard(guard Guard[S]) {
+	m.guards = append(m.guards, guard)
+}
+
+// Transition moves the machine to the state, keeping the current state as
+// the previous one. In strict mode, a transition that is not in the
+// transition table is rejected with an IllegalTransitionError. A transition
+// that one of the guards returns an error for is rejected with that error.
+// A rejected transition leaves the machine in its current state.
+func (m *Machine[S, H]) Transition(to S) error {
+	if m.strict && !m.table.Allows(m.current, to) {
+		return &IllegalTransitionError[S]{From: m.current, To: to}
+	}
+	for _, guard := range m.guards {
+		if err := guard(m.current, to); err != nil {
+			return err
+		}
+	}
+	m.previous = m.current
+	m.current = to
+	return nil
+}
+
+// Restore puts the machine in the current and previous states without a
+// transition, such as when a run is resumed. The guards are not checked.
+func (m *Machine[S, H]) Restore(current S, previous S) {
+	m.current = current
+	m.previous = previous
+}
+
+// Handle registers the handler for the state. It returns an error that
+// wraps ErrHandlerExists if the state already has a handler.
+func (m *Machine[S, H]) Handle(state S, handler H) error {
+	if _, ok := m.handlers[state]; ok {
+		return fmt.Errorf("state %v: %w", state, ErrHandlerExists)
+	}
+	m.handlers[state] = handler
+	return nil
+}
+
+// Handler returns the handler of the state, and false if it has none.
+func (m *Machine[S, H]) Handler(state S) (H, bool) {
+	h, ok := m.handlers[state]
+	return h, ok
+}
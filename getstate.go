@@ -0,0 +1,125 @@
+package atkmod
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HealthDeployed is the health status reported by the get_state hook for a
+// module that has been deployed successfully.
+const HealthDeployed = "DEPLOYED"
+
+// ModuleHealth is the reserved health element of the response of the
+// get_state hook.
+type ModuleHealth struct {
+	Status string `json:"status" yaml:"status"`
+	// Lifecycle has the status of each stage of the lifecycle, by the name
+	// of the stage, such as deploy.
+	Lifecycle map[string]string `json:"lifecycle,omitempty" yaml:"lifecycle,omitempty"`
+}
+
+// ModuleState is the response of the get_state hook.
+type ModuleState struct {
+	Health ModuleHealth `json:"health" yaml:"health"`
+	// Data is the state of the module, in any form that the module uses.
+	Data interface{} `json:"data,omitempty" yaml:"data,omitempty"`
+}
+
+// State returns the health status as a State, such as Deployed for a status
+// of DEPLOYED. The status is not checked against the known states.
+func (s *ModuleState) State() State {
+	return State(strings.ToLower(strings.TrimSpace(s.Health.Status)))
+}
+
+// IsDeployed returns true if the module reported that it is deployed.
+func (s *ModuleState) IsDeployed() bool {
+	return strings.EqualFold(strings.TrimSpace(s.Health.Status), HealthDeployed)
+}
+
+// GetState runs the get_state hook of the module and returns the state that
+// it reports.
+func (m *DeployableModule) GetState(ctx *RunContext) (*ModuleState, error) {
+	if m.module.Specifications.Hooks.GetState.Equal(ImageInfo{}) {
+		return nil, fmt.Errorf("module %s does not have a get_state hook", m.module.Metadata.Name)
+	}
+	out := new(bytes.Buffer)
+	prevOut := ctx.Out
+	ctx.Out = out
+	err := m.GetHook(GetStateHook)(ctx)
+	ctx.Out = prevOut
+	if err != nil {
+		return nil, err
+	}
+
+	raw := append([]byte(nil), out.Bytes()...)
+	event, err := ParseEventStream(out, GetStateHookResponseEvent)
+	if err != nil {
+		return nil, m.hookOutputError(ctx, GetStateHook, raw, fmt.Errorf("could not load get_state hook response: %w", err))
+	}
+	state := &ModuleState{}
+	if err := DecodeEventData(event, state); err != nil {
+		return nil, m.hookOutputError(ctx, GetStateHook, raw, fmt.Errorf("could not load get_state hook response data: %w", err))
+	}
+	return state, nil
+}
+
+// WaitForStateError is returned by WaitForState when the module did not
+// reach the desired state before the timeout.
+type WaitForStateError struct {
+	Module  string
+	Desired State
+	// Last is the last state that the module reported, if any.
+	Last State
+	// Err is the error of the last run of the get_state hook, if it failed.
+	Err     error
+	Timeout time.Duration
+}
+
+func (e *WaitForStateError) Error() string {
+	msg := fmt.Sprintf("module %s did not reach state %s within %s", e.Module, e.Desired, e.Timeout)
+	if len(e.Last) > 0 {
+		msg += fmt.Sprintf("; last state was %s", e.Last)
+	}
+	if e.Err != nil {
+		msg += fmt.Sprintf(": %v", e.Err)
+	}
+	return msg
+}
+
+func (e *WaitForStateError) Unwrap() error {
+	return e.Err
+}
+
+// WaitForState runs the get_state hook every interval until the module
+// reports the desired state, and returns the state that it reported. Errors
+// of the hook are retried until the timeout passes, when a
+// WaitForStateError is returned. If the context of ctx is done first, its
+// error is returned.
+func (m *DeployableModule) WaitForState(ctx *RunContext, desired State, interval time.Duration, timeout time.Duration) (*ModuleState, error) {
+	if interval <= 0 {
+		interval = DefaultReadinessInterval
+	}
+	var reported *ModuleState
+	var last State
+	err := pollUntil(ctx.Context, interval, timeout, func() (bool, error) {
+		state, err := m.GetState(ctx)
+		if err != nil {
+			ctx.Logger().Debugf("could not get the state of module %s: %v", m.module.Metadata.Name, err)
+			return false, err
+		}
+		last = state.State()
+		if last == desired {
+			reported = state
+			return true, nil
+		}
+		return false, nil
+	}, func(lastErr error) error {
+		return &WaitForStateError{Module: m.module.Metadata.Name, Desired: desired, Last: last, Err: lastErr, Timeout: timeout}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reported, nil
+}
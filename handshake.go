@@ -0,0 +1,192 @@
+package atkmod
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// InfoHook is the optional hook that atkmod shakes hands with before
+	// the other hooks run, to learn the capabilities of the hooks.
+	InfoHook Hook = "info"
+
+	InfoHookRequestEvent  ModuleEventType = "com.ibm.techzone.cli.hook.info.request"
+	InfoHookResponseEvent ModuleEventType = "com.ibm.techzone.cli.hook.info.response"
+
+	// EventFileEnvVar is the environment variable that has the path of the
+	// request event in the container, for hooks that receive their requests
+	// in a file.
+	EventFileEnvVar = "ATK_EVENT_FILE"
+	// EventFileMountPath is where the request event is mounted in the
+	// container for hooks that receive their requests in a file.
+	EventFileMountPath = "/var/run/atk/event/request.json"
+)
+
+// EventDelivery is the way that request events are delivered to the hooks.
+type EventDelivery string
+
+const (
+	// DeliverStdin writes the request event to the standard input of the
+	// hook. It is the default.
+	DeliverStdin EventDelivery = "stdin"
+	// DeliverFile mounts the request event as a file at EventFileMountPath
+	// and sets EventFileEnvVar to its path.
+	DeliverFile EventDelivery = "file"
+)
+
+// SupportedDeliveries are the ways that atkmod can deliver request events.
+var SupportedDeliveries = []EventDelivery{DeliverStdin, DeliverFile}
+
+// HandshakeRequest is the data of the InfoHookRequestEvent, which tells the
+// info hook what this version of atkmod supports.
+type HandshakeRequest struct {
+	// Version is the Version of atkmod.
+	Version string `json:"version" yaml:"version"`
+	// SpecVersions are the CloudEvents spec versions of the events that
+	// atkmod sends and understands.
+	SpecVersions []string `json:"specVersions" yaml:"specVersions"`
+	// EventTypes are the types of the events that atkmod sends to the hooks
+	// and understands from them.
+	EventTypes []ModuleEventType `json:"eventTypes" yaml:"eventTypes"`
+	// Deliveries are the ways that atkmod can deliver request events.
+	Deliveries []EventDelivery `json:"deliveries" yaml:"deliveries"`
+}
+
+// HookCapabilities is the data of the InfoHookResponseEvent, with which the
+// info hook tells atkmod how to talk to the hooks of the module.
+type HookCapabilities struct {
+	// SpecVersion is the CloudEvents spec version that the hooks use, which
+	// must be one of the SpecVersions of the request. It defaults to 1.0.
+	SpecVersion string `json:"specVersion,omitempty" yaml:"specVersion,omitempty"`
+	// Delivery is how the hooks want their request events, which must be
+	// one of the Deliveries of the request. It defaults to DeliverStdin.
+	Delivery EventDelivery `json:"delivery,omitempty" yaml:"delivery,omitempty"`
+	// EventTypes are the types of the events that the hooks understand, if
+	// they report them.
+	EventTypes []ModuleEventType `json:"eventTypes,omitempty" yaml:"eventTypes,omitempty"`
+}
+
+// defaultCapabilities are the capabilities of the hooks of a module that
+// does not have an info hook.
+var defaultCapabilities = HookCapabilities{SpecVersion: supportedSpecVersion, Delivery: DeliverStdin}
+
+// HandshakeError is returned when the capabilities reported by the info
+// hook of a module are not supported by this version of atkmod.
+type HandshakeError struct {
+	Module string
+	Reason string
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("could not shake hands with the hooks of module %s: %s", e.Module, e.Reason)
+}
+
+// NewHandshakeRequest returns the request that is sent to the info hook.
+func NewHandshakeRequest() HandshakeRequest {
+	return HandshakeRequest{
+		Version:      Version,
+		SpecVersions: []string{supportedSpecVersion},
+		EventTypes: []ModuleEventType{
+			ListHookResponseEvent,
+			ValidateHookRequestEvent,
+			ValidateHookResponseEvent,
+			GetStateHookResponseEvent,
+		},
+		Deliveries: append([]EventDelivery(nil), SupportedDeliveries...),
+	}
+}
+
+// Handshake runs the info hook of the module with a HandshakeRequest on its
+// standard input and returns the capabilities that it reports, which are
+// used for the other hooks from then on. A module without an info hook, or
+// whose info hook writes nothing, gets the default capabilities: CloudEvents
+// 1.0 on standard input. A HandshakeError is returned if the capabilities
+// are not supported. Deploy shakes hands when it initializes.
+func (m *DeployableModule) Handshake(ctx *RunContext) (*HookCapabilities, error) {
+	if m.module.Specifications.Hooks.Info.Equal(ImageInfo{}) {
+		m.capabilities = nil
+		capabilities := defaultCapabilities
+		return &capabilities, nil
+	}
+	request, err := NewEvent(InfoHookRequestEvent, m.Name(), NewHandshakeRequest())
+	if err != nil {
+		return nil, err
+	}
+	m.setDeploymentExtensions(request)
+	m.emit(request)
+	in := new(bytes.Buffer)
+	if err := WriteEvent(request, in); err != nil {
+		return nil, err
+	}
+	out := new(bytes.Buffer)
+	prevCtx, prevIn, prevOut := ctx.Context, ctx.In, ctx.Out
+	ctx.Context, ctx.In, ctx.Out = withInput(ctx.Context), in, out
+	err = m.GetHook(InfoHook)(ctx)
+	ctx.Context, ctx.In, ctx.Out = prevCtx, prevIn, prevOut
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities := defaultCapabilities
+	if raw := append([]byte(nil), out.Bytes()...); len(bytes.TrimSpace(raw)) > 0 {
+		event, err := ParseEventStream(out, InfoHookResponseEvent)
+		if err != nil {
+			return nil, m.hookOutputError(ctx, InfoHook, raw, fmt.Errorf("could not load info hook response: %w", err))
+		}
+		if err := DecodeEventData(event, &capabilities); err != nil {
+			return nil, m.hookOutputError(ctx, InfoHook, raw, fmt.Errorf("could not load info hook response data: %w", err))
+		}
+		capabilities.SpecVersion = Iif(capabilities.SpecVersion, supportedSpecVersion)
+		capabilities.Delivery = EventDelivery(Iif(string(capabilities.Delivery), string(DeliverStdin)))
+	}
+	if capabilities.SpecVersion != supportedSpecVersion {
+		return nil, &HandshakeError{Module: m.Name(), Reason: fmt.Sprintf("the hooks use CloudEvents %s, but only %s is supported", capabilities.SpecVersion, supportedSpecVersion)}
+	}
+	if !supportsDelivery(capabilities.Delivery) {
+		return nil, &HandshakeError{Module: m.Name(), Reason: fmt.Sprintf("the hooks want their events by %s, which is not supported", capabilities.Delivery)}
+	}
+	m.capabilities = &capabilities
+	return &capabilities, nil
+}
+
+// Capabilities returns the capabilities that the info hook reported in the
+// last handshake, or the default capabilities if there was none.
+func (m *DeployableModule) Capabilities() HookCapabilities {
+	if m.capabilities == nil {
+		return defaultCapabilities
+	}
+	return *m.capabilities
+}
+
+func supportsDelivery(delivery EventDelivery) bool {
+	for _, d := range SupportedDeliveries {
+		if d == delivery {
+			return true
+		}
+	}
+	return false
+}
+
+// withEventFile writes the request event to a private temporary file and
+// returns a copy of the hook that has it mounted at EventFileMountPath. The
+// returned function removes the file.
+func withEventFile(info ImageInfo, request []byte) (ImageInfo, func(), error) {
+	dir, err := os.MkdirTemp("", "atk-event-")
+	if err != nil {
+		return info, nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	path := filepath.Join(dir, "request.json")
+	// The directory is private, but the file must be readable by the user
+	// of the container.
+	if err := os.WriteFile(path, request, 0644); err != nil {
+		cleanup()
+		return info, nil, err
+	}
+	img := info.DeepCopy()
+	img.EnvVars = setEnvVar(img.EnvVars, EnvVarInfo{Name: EventFileEnvVar, Value: EventFileMountPath})
+	img.Volumes = append(img.Volumes, VolumeInfo{Name: path, MountPath: EventFileMountPath})
+	return img, cleanup, nil
+}
@@ -0,0 +1,146 @@
+package atkmod
+
+import "path"
+
+// DefaultHelmImage is the helm image used by NewHelmStage when no other
+// image is given. Its entrypoint is helm.
+const DefaultHelmImage = "docker.io/alpine/helm:3.14.4"
+
+// HelmStage has the settings of a helm stage that is created with
+// NewHelmStage.
+type HelmStage struct {
+	// Image is the helm image, DefaultHelmImage if empty.
+	Image string
+	// Chart is the reference of the chart, such as oci://quay.io/org/chart
+	// or a path in the workspace, such as /workspace/chart.
+	Chart string
+	// Version is the version of the chart. If empty, the latest is used.
+	Version string
+	// Release is the name of the release, the name of the module if empty.
+	Release string
+	// Namespace is the namespace of the release, the namespace of the
+	// module if empty, or else DefaultNamespace.
+	Namespace string
+	// Workspace is the local directory that is mounted as the workspace,
+	// DefaultScaffoldWorkspace if empty.
+	Workspace string
+	// ValuesFiles are the values files of the release, relative to the
+	// workspace.
+	ValuesFiles []string
+	// Kubeconfig is the local kubeconfig file that is mounted at
+	// KubeconfigMountPath. If empty, nothing is mounted, so that the
+	// deployment can provide it, such as with WithKubeconfig.
+	Kubeconfig string
+}
+
+// HelmStageOption configures optional settings of NewHelmStage.
+type HelmStageOption func(*HelmStage)
+
+// WithHelmImage runs helm with the given image.
+func WithHelmImage(image string) HelmStageOption {
+	return func(s *HelmStage) {
+		s.Image = image
+	}
+}
+
+// WithHelmVersion installs the given version of the chart.
+func WithHelmVersion(version string) HelmStageOption {
+	return func(s *HelmStage) {
+		s.Version = version
+	}
+}
+
+// WithHelmRelease sets the name of the release.
+func WithHelmRelease(release string) HelmStageOption {
+	return func(s *HelmStage) {
+		s.Release = release
+	}
+}
+
+// WithHelmNamespace installs the release in the namespace.
+func WithHelmNamespace(namespace string) HelmStageOption {
+	return func(s *HelmStage) {
+		s.Namespace = namespace
+	}
+}
+
+// WithHelmWorkspace mounts the local directory as the workspace.
+func WithHelmWorkspace(dir string) HelmStageOption {
+	return func(s *HelmStage) {
+		s.Workspace = dir
+	}
+}
+
+// WithHelmValues adds the values file, which is relative to the workspace.
+// The files are passed to helm in the order that they are added.
+func WithHelmValues(file string) HelmStageOption {
+	return func(s *HelmStage) {
+		s.ValuesFiles = append(s.ValuesFiles, file)
+	}
+}
+
+// WithHelmKubeconfig mounts the local kubeconfig file in the stage.
+func WithHelmKubeconfig(path string) HelmStageOption {
+	return func(s *HelmStage) {
+		s.Kubeconfig = path
+	}
+}
+
+func newHelmStage(module *ModuleInfo, chart string, opts []HelmStageOption) *HelmStage {
+	s := &HelmStage{Chart: chart}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Release = Iif(s.Release, module.Metadata.Name)
+	s.Namespace = Iif(s.Namespace, namespaceOf(module))
+	return s
+}
+
+// image returns the stage that runs helm with the arguments, followed by the
+// arguments of the chart.
+func (s *HelmStage) image(args ...string) ImageInfo {
+	args = append(args, s.Release, s.Chart, "--namespace", s.Namespace)
+	if len(s.Version) > 0 {
+		args = append(args, "--version", s.Version)
+	}
+	for _, file := range s.ValuesFiles {
+		args = append(args, "--values", path.Join("/workspace", file))
+	}
+	info := ImageInfo{
+		Image: Iif(s.Image, DefaultHelmImage),
+		Args:  args,
+		// helm writes its cache and its repositories to the home directory,
+		// which may not be writable in the image.
+		EnvVars: []EnvVarInfo{
+			{Name: "HELM_CACHE_HOME", Value: "/tmp/helm/cache"},
+			{Name: "HELM_CONFIG_HOME", Value: "/tmp/helm/config"},
+			{Name: "HELM_DATA_HOME", Value: "/tmp/helm/data"},
+		},
+		Volumes: []VolumeInfo{{Name: Iif(s.Workspace, DefaultScaffoldWorkspace), MountPath: "/workspace"}},
+	}
+	if len(s.Kubeconfig) > 0 {
+		info.EnvVars = append(info.EnvVars, EnvVarInfo{Name: "KUBECONFIG", Value: KubeconfigMountPath})
+		info.Volumes = append(info.Volumes, VolumeInfo{Name: s.Kubeconfig, MountPath: KubeconfigMountPath})
+	}
+	return info
+}
+
+// NewHelmStage creates a lifecycle stage that installs or upgrades the chart
+// with helm upgrade --install and waits for the release to be ready. The
+// release is named after the module and is in the namespace of the module,
+// unless other options are given.
+func NewHelmStage(module *ModuleInfo, chart string, opts ...HelmStageOption) ImageInfo {
+	return newHelmStage(module, chart, opts).image("upgrade", "--install", "--wait", "--create-namespace")
+}
+
+// NewHelmLifecycle creates the lifecycle stages of a module that is deployed
+// with helm: the pre_deploy stage renders the chart with helm template, so
+// that a chart or values that do not render fail before anything is
+// installed, and the deploy stage is NewHelmStage.
+func NewHelmLifecycle(module *ModuleInfo, chart string, opts ...HelmStageOption) LifecycleInfo {
+	s := newHelmStage(module, chart, opts)
+	return LifecycleInfo{
+		PreDeploy: s.image("template"),
+		Deploy:    s.image("upgrade", "--install", "--wait", "--create-namespace"),
+	}
+}
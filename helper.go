@@ -0,0 +1,85 @@
+package atkmod
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// DefaultHelperImage is the image of the helper containers that the runner
+// uses for its own operations, such as FixOwnership, unless the
+// configuration has another helperImage, such as the same image in the
+// mirror of an air-gapped registry.
+const DefaultHelperImage = "docker.io/library/busybox:1.36"
+
+// PinImage returns the reference of the image with the digest that the
+// resolver returns for it, such as quay.io/org/image:1.0@sha256:..., so that
+// the image cannot change without the reference changing. An image that
+// already has a digest is returned as it is.
+func PinImage(image string, digest DigestResolver) (string, error) {
+	name, tag, pinned := splitImage(strings.TrimSpace(image))
+	if len(pinned) > 0 {
+		return image, nil
+	}
+	resolved, err := digest(image)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(resolved, "sha256:") {
+		return "", fmt.Errorf("could not pin image %s: %q is not a digest", image, resolved)
+	}
+	return name + tag + "@" + resolved, nil
+}
+
+// helperImage returns the image of the helper containers of the runner.
+func (r *CliModuleRunner) helperImage() string {
+	return Iif(r.HelperImage, DefaultHelperImage)
+}
+
+// PinHelperImage pulls the helper image and returns its reference with its
+// digest, which can be set as the helperImage of the configuration.
+func (r *CliModuleRunner) PinHelperImage(ctx *RunContext) (string, error) {
+	image := r.helperImage()
+	args := []string{"pull", "--quiet"}
+	if r.Pull != nil && len(r.Pull.AuthFile) > 0 {
+		args = append(args, "--authfile", r.Pull.AuthFile)
+	}
+	if err := r.podman(ctx, append(args, image)...); err != nil {
+		return "", err
+	}
+	return PinImage(image, r.imageDigest)
+}
+
+// SaveHelperImage writes the helper image to the archive at the path with
+// podman save, so that it can be vendored and loaded on a host that cannot
+// reach the registry with LoadHelperImage. The image must have been pulled.
+func (r *CliModuleRunner) SaveHelperImage(ctx *RunContext, path string) error {
+	return r.podman(ctx, "save", "--quiet", "-o", path, r.helperImage())
+}
+
+// LoadHelperImage loads the archive at the path, written by
+// SaveHelperImage, with podman load, so that the helper image is not pulled.
+func (r *CliModuleRunner) LoadHelperImage(ctx *RunContext, path string) error {
+	return r.podman(ctx, "load", "--quiet", "-i", path)
+}
+
+// imageDigest returns the digest of the local image.
+func (r *CliModuleRunner) imageDigest(image string) (string, error) {
+	path, global := r.PodmanCliCommandBuilder.globalArgs()
+	out, err := exec.Command(path, append(global, "image", "inspect", "--format", "{{.Digest}}", image)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("could not get the digest of image %s: %w", image, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// podman runs the podman command with the global arguments of the runner.
+func (r *CliModuleRunner) podman(ctx *RunContext, args ...string) error {
+	path, global := r.PodmanCliCommandBuilder.globalArgs()
+	cmd := exec.Command(path, append(global, args...)...)
+	ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("podman %s failed: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package atkmod
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultHistoryLimit is the number of deployments kept for each module by
+// a HistoryStore, unless another limit is set.
+const DefaultHistoryLimit = 10
+
+// HistoryStore keeps the results of the last deployments of each module in
+// a local directory, so the last deployment of a module and the reason it
+// failed can be shown without running any of its hooks.
+//
+// The results are stored as JSON, one file for each module in a directory
+// for its namespace, with the most recent deployment first.
+type HistoryStore struct {
+	mu sync.Mutex
+	// Dir is the directory where the history is stored.
+	Dir string
+	// Limit is the number of deployments kept for each module.
+	Limit int
+}
+
+// NewHistoryStore creates a HistoryStore in the given directory that keeps
+// the last DefaultHistoryLimit deployments of each module.
+func NewHistoryStore(dir string) *HistoryStore {
+	return &HistoryStore{
+		Dir:   dir,
+		Limit: DefaultHistoryLimit,
+	}
+}
+
+// DefaultHistoryDir returns the directory used for the history when no other
+// directory is given, which is in the user's configuration directory.
+func DefaultHistoryDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "atk", "history"), nil
+}
+
+// WithHistory records the result of the deployment in the given store when
+// the deployment is driven by Deploy.
+func WithHistory(store *HistoryStore) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.history = store
+	}
+}
+
+// pathFor returns the path of the history file of the module. The name and
+// namespace are used as path elements, so names that would escape the
+// directory of the store are rejected.
+func (s *HistoryStore) pathFor(namespace string, name string) (string, error) {
+	namespace, err := checkScope(namespace, name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, namespace, name+".json"), nil
+}
+
+func (s *HistoryStore) load(path string) ([]DeploymentResult, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []DeploymentResult{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	results := make([]DeploymentResult, 0)
+	if err := json.Unmarshal(content, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Record adds the result to the history of its module, removing the oldest
+// results over the limit of the store.
+func (s *HistoryStore) Record(result DeploymentResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.pathFor(result.Namespace, result.Module)
+	if err != nil {
+		return err
+	}
+	results, err := s.load(path)
+	if err != nil {
+		return err
+	}
+	results = append([]DeploymentResult{result}, results...)
+	limit := s.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	content, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Writes to a temporary file first so a failure never leaves a partial
+	// history behind.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// History returns the results of the last deployments of the module, with
+// the most recent deployment first. If the module has never been deployed,
+// an empty list is returned.
+func (s *HistoryStore) History(module *ModuleInfo) ([]DeploymentResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := s.pathFor(module.Metadata.Namespace, module.Metadata.Name)
+	if err != nil {
+		return nil, err
+	}
+	return s.load(path)
+}
+
+// Last returns the result of the most recent deployment of the module, or
+// nil if the module has never been deployed.
+func (s *HistoryStore) Last(module *ModuleInfo) (*DeploymentResult, error) {
+	results, err := s.History(module)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// LastFailure returns the result of the most recent failed deployment of the
+// module, or nil if none of the deployments in the history failed.
+func (s *HistoryStore) LastFailure(module *ModuleInfo) (*DeploymentResult, error) {
+	results, err := s.History(module)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range results {
+		if !results[idx].Succeeded() {
+			return &results[idx], nil
+		}
+	}
+	return nil, nil
+}
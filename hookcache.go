@@ -0,0 +1,186 @@
+package atkmod
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHookCacheTTL is how long the responses are kept by a HookCache,
+// unless another TTL is set.
+const DefaultHookCacheTTL = 5 * time.Minute
+
+// DigestResolver returns the digest of the given image, so that a cached
+// response is not used after the image has changed.
+type DigestResolver func(image string) (string, error)
+
+// ImageRefDigest is the default DigestResolver, which uses the digest in the
+// image reference, if it has one, or else the reference itself. Images that
+// are referenced by a tag, such as latest, can change without the reference
+// changing, so use PodmanImageDigest for those.
+func ImageRefDigest(image string) (string, error) {
+	if idx := strings.Index(image, "@"); idx >= 0 {
+		return image[idx+1:], nil
+	}
+	return image, nil
+}
+
+// PodmanImageDigest returns a DigestResolver that asks podman for the digest
+// of the local image. If path is empty, the path and the connection of
+// podman in the DefaultConfig are used.
+func PodmanImageDigest(path string) DigestResolver {
+	return func(image string) (string, error) {
+		builder := NewPodmanCliCommandBuilder(DefaultConfig().CliParts())
+		if len(path) > 0 {
+			builder.WithPath(path)
+		}
+		podman, args := builder.globalArgs()
+		args = append(args, "image", "inspect", "--format", "{{.Digest}}", image)
+		out, err := exec.Command(podman, args...).Output()
+		if err != nil {
+			return "", fmt.Errorf("could not get the digest of image %s: %w", image, err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+}
+
+type hookCacheEntry struct {
+	module  string
+	data    *EventData
+	expires time.Time
+}
+
+// HookCache keeps the parsed responses of hooks, such as the variables
+// returned by the list hook, for a time so that the hook does not have to
+// be run again. The responses are keyed on the module, the hook, the digest
+// of the image and the settings of the image, so a change to any of them
+// runs the hook again.
+type HookCache struct {
+	mu      sync.Mutex
+	entries map[string]hookCacheEntry
+	// TTL is how long a response is kept.
+	TTL time.Duration
+	// Digest resolves the digest of the image of the hook.
+	Digest DigestResolver
+}
+
+// NewHookCache creates a HookCache that keeps the responses for the given
+// TTL and uses ImageRefDigest to resolve the image digests.
+func NewHookCache(ttl time.Duration) *HookCache {
+	return &HookCache{
+		entries: make(map[string]hookCacheEntry),
+		TTL:     ttl,
+		Digest:  ImageRefDigest,
+	}
+}
+
+// WithHookCache uses the given cache for the responses of the hooks of the
+// deployment.
+func WithHookCache(cache *HookCache) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.hookCache = cache
+	}
+}
+
+func moduleCacheID(module *ModuleInfo) string {
+	return module.Metadata.Namespace + "/" + module.Metadata.Name
+}
+
+// Key returns the key of the response of the hook of the module, which is
+// run with the given image.
+func (c *HookCache) Key(module *ModuleInfo, hook Hook, info ImageInfo) (string, error) {
+	resolve := c.Digest
+	if resolve == nil {
+		resolve = ImageRefDigest
+	}
+	digest, err := resolve(info.Image)
+	if err != nil {
+		return "", err
+	}
+	settings, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(settings)
+	return strings.Join([]string{moduleCacheID(module), string(hook), digest, hex.EncodeToString(sum[:8])}, "|"), nil
+}
+
+// Get returns the response for the key, if there is one that has not
+// expired.
+func (c *HookCache) Get(key string) (*EventData, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return copyEventData(entry.data), true
+}
+
+// Put stores the response of a hook of the module for the key.
+func (c *HookCache) Put(key string, module *ModuleInfo, data *EventData) {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultHookCacheTTL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = hookCacheEntry{
+		module:  moduleCacheID(module),
+		data:    copyEventData(data),
+		expires: time.Now().Add(ttl),
+	}
+}
+
+// Invalidate removes all of the responses of the module.
+func (c *HookCache) Invalidate(module *ModuleInfo) {
+	id := moduleCacheID(module)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if entry.module == id {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// InvalidateAll removes all of the responses.
+func (c *HookCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]hookCacheEntry)
+}
+
+// Len returns the number of responses in the cache, including any that have
+// expired but have not been removed yet.
+func (c *HookCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// copyEventData returns a copy of the data, so the cached data cannot be
+// changed by the callers.
+func copyEventData(data *EventData) *EventData {
+	if data == nil {
+		return nil
+	}
+	c := &EventData{}
+	if data.Variables != nil {
+		c.Variables = make([]EventDataVarInfo, len(data.Variables))
+		copy(c.Variables, data.Variables)
+		for idx := range c.Variables {
+			c.Variables[idx].Options = copyStrings(c.Variables[idx].Options)
+		}
+	}
+	return c
+}
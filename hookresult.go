@@ -0,0 +1,83 @@
+package atkmod
+
+import (
+	"fmt"
+)
+
+// The exit codes of the hooks that have a documented meaning. Any other
+// non-zero exit code means that the hook failed.
+const (
+	// HookExitOK means the hook completed successfully. For the validate
+	// hook, it means that the input is valid.
+	HookExitOK = 0
+	// HookExitFailed means that the hook failed to run.
+	HookExitFailed = 1
+	// HookExitInvalid means that the hook ran, but the input was invalid.
+	HookExitInvalid = 3
+	// HookExitUndetermined means that the hook ran, but could not determine
+	// the result, for example because the environment is not reachable.
+	HookExitUndetermined = 4
+)
+
+// ValidationStatus is the outcome of running the validate hook.
+type ValidationStatus string
+
+const (
+	ValidationValid        ValidationStatus = "valid"
+	ValidationInvalid      ValidationStatus = "invalid"
+	ValidationUndetermined ValidationStatus = "undetermined"
+)
+
+// ValidationResult is the typed result of running the validate hook.
+type ValidationResult struct {
+	Status   ValidationStatus `json:"status" yaml:"status"`
+	ExitCode int              `json:"exitCode" yaml:"exitCode"`
+	Messages []string         `json:"messages,omitempty" yaml:"messages,omitempty"`
+	// Variables has the result of the validation of each variable, if the
+	// hook reported it.
+	Variables []VariableValidation `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// IsValid returns true if the hook reported the input as valid.
+func (r *ValidationResult) IsValid() bool {
+	return r.Status == ValidationValid
+}
+
+// exitCoder is implemented by errors that carry the exit code of a process,
+// such as exec.ExitError.
+type exitCoder interface {
+	ExitCode() int
+}
+
+// ExitCodeOf returns the exit code carried by the error and true, or zero and
+// false if the error does not have an exit code.
+func ExitCodeOf(err error) (int, bool) {
+	if err == nil {
+		return HookExitOK, true
+	}
+	if e, ok := err.(exitCoder); ok {
+		return e.ExitCode(), true
+	}
+	return 0, false
+}
+
+// NewValidationResult interprets the error returned by running the validate
+// hook using the documented exit codes. If the hook ran and reported that
+// the input is valid, invalid, or undetermined, a result is returned without
+// an error. Otherwise, the hook failed and the error is returned.
+func NewValidationResult(err error) (*ValidationResult, error) {
+	code, ok := ExitCodeOf(err)
+	if !ok {
+		return nil, err
+	}
+	switch code {
+	case HookExitOK:
+		return &ValidationResult{Status: ValidationValid, ExitCode: code}, nil
+	case HookExitInvalid:
+		return &ValidationResult{Status: ValidationInvalid, ExitCode: code}, nil
+	case HookExitUndetermined:
+		return &ValidationResult{Status: ValidationUndetermined, ExitCode: code}, nil
+	default:
+		return nil, fmt.Errorf("validate hook failed with exit code %d: %w", code, err)
+	}
+}
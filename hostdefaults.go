@@ -0,0 +1,191 @@
+package atkmod
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSource returns a value from the host, such as the current context
+// of kubectl, for the defaults of the variables that declare it in their
+// defaultFrom.
+type DefaultSource func(ctx *RunContext) (string, error)
+
+// The well-known sources of the defaults of the variables.
+const (
+	// DefaultFromKubeContext is the current context of the kubeconfig.
+	DefaultFromKubeContext = "kubectl.context"
+	// DefaultFromKubeNamespace is the namespace of the current context of
+	// the kubeconfig.
+	DefaultFromKubeNamespace = "kubectl.namespace"
+	// DefaultFromIBMCloudRegion is the region that the ibmcloud CLI is
+	// logged in to.
+	DefaultFromIBMCloudRegion = "ibmcloud.region"
+	// DefaultFromIBMCloudResourceGroup is the resource group that the
+	// ibmcloud CLI targets.
+	DefaultFromIBMCloudResourceGroup = "ibmcloud.resource_group"
+	// DefaultFromIBMCloudAccount is the ID of the account that the ibmcloud
+	// CLI is logged in to.
+	DefaultFromIBMCloudAccount = "ibmcloud.account"
+	// DefaultFromGitUserName is user.name in the git configuration.
+	DefaultFromGitUserName = "git.user.name"
+	// DefaultFromGitUserEmail is user.email in the git configuration.
+	DefaultFromGitUserEmail = "git.user.email"
+)
+
+// DefaultSources are the well-known sources of the defaults of the
+// variables, by name.
+var DefaultSources = map[string]DefaultSource{
+	DefaultFromKubeContext:           kubeconfigValue(func(c kubeconfig) string { return c.CurrentContext }),
+	DefaultFromKubeNamespace:         kubeconfigValue(func(c kubeconfig) string { return c.namespace() }),
+	DefaultFromIBMCloudRegion:        ibmcloudValue(func(c ibmcloudConfig) string { return c.Region }),
+	DefaultFromIBMCloudResourceGroup: ibmcloudValue(func(c ibmcloudConfig) string { return c.ResourceGroup.Name }),
+	DefaultFromIBMCloudAccount:       ibmcloudValue(func(c ibmcloudConfig) string { return c.Account.GUID }),
+	DefaultFromGitUserName:           gitConfigValue("user.name"),
+	DefaultFromGitUserEmail:          gitConfigValue("user.email"),
+}
+
+// WithDefaultSource adds the source of the defaults of the variables, or
+// replaces the well-known source with the name.
+func WithDefaultSource(name string, source DefaultSource) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		if m.defaultSources == nil {
+			m.defaultSources = make(map[string]DefaultSource)
+		}
+		m.defaultSources[name] = source
+	}
+}
+
+// ResolveDefaults reads the defaults of the variables of the deployment that
+// have none but declare a defaultFrom, such as kubectl.context, from the
+// host. A source that is unknown or that has no value leaves the variable
+// without a default, which is only logged. The defaults are read once for
+// each source and are then used by Variables. Deploy resolves them before the
+// variables are validated.
+func (m *DeployableModule) ResolveDefaults(ctx *RunContext) {
+	log := ctx.Log.WithField(RunIDLogField, m.runID)
+	for _, v := range m.Variables().Variables {
+		if len(v.Value) > 0 || len(v.DefaultFrom) == 0 {
+			continue
+		}
+		if _, ok := m.resolvedDefaults[v.DefaultFrom]; ok {
+			continue
+		}
+		source, ok := m.defaultSources[v.DefaultFrom]
+		if !ok {
+			source, ok = DefaultSources[v.DefaultFrom]
+		}
+		if !ok {
+			log.Warnf("variable %s has an unknown defaultFrom %s", v.Name, v.DefaultFrom)
+			continue
+		}
+		value, err := source(ctx)
+		if err != nil {
+			log.Debugf("could not read the default of variable %s from %s: %v", v.Name, v.DefaultFrom, err)
+			continue
+		}
+		if m.resolvedDefaults == nil {
+			m.resolvedDefaults = make(map[string]string)
+		}
+		m.resolvedDefaults[v.DefaultFrom] = value
+	}
+}
+
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// namespace returns the namespace of the current context, which is default
+// if the context has none.
+func (c kubeconfig) namespace() string {
+	for _, ctx := range c.Contexts {
+		if ctx.Name == c.CurrentContext {
+			return Iif(ctx.Context.Namespace, "default")
+		}
+	}
+	return ""
+}
+
+// kubeconfigValue reads the value from the first file of KUBECONFIG, or else
+// ~/.kube/config.
+func kubeconfigValue(value func(kubeconfig) string) DefaultSource {
+	return func(ctx *RunContext) (string, error) {
+		file, err := kubeconfigPath("")
+		if err != nil {
+			return "", err
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		var config kubeconfig
+		if err := yaml.Unmarshal(content, &config); err != nil {
+			return "", fmt.Errorf("could not parse the kubeconfig %s: %w", file, err)
+		}
+		return nonEmpty(value(config), "the kubeconfig "+file)
+	}
+}
+
+type ibmcloudConfig struct {
+	Region  string `json:"Region"`
+	Account struct {
+		GUID string `json:"GUID"`
+	} `json:"Account"`
+	ResourceGroup struct {
+		Name string `json:"Name"`
+	} `json:"ResourceGroup"`
+}
+
+// ibmcloudValue reads the value from the configuration of the ibmcloud CLI,
+// which is in $IBMCLOUD_HOME/.bluemix/config.json, or else in the home
+// directory.
+func ibmcloudValue(value func(ibmcloudConfig) string) DefaultSource {
+	return func(ctx *RunContext) (string, error) {
+		home := os.Getenv("IBMCLOUD_HOME")
+		if len(home) == 0 {
+			var err error
+			if home, err = os.UserHomeDir(); err != nil {
+				return "", err
+			}
+		}
+		file := filepath.Join(home, ".bluemix", "config.json")
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		var config ibmcloudConfig
+		if err := json.Unmarshal(content, &config); err != nil {
+			return "", fmt.Errorf("could not parse the ibmcloud configuration %s: %w", file, err)
+		}
+		return nonEmpty(value(config), "the ibmcloud configuration "+file)
+	}
+}
+
+// gitConfigValue reads the value of the key with git config.
+func gitConfigValue(key string) DefaultSource {
+	return func(ctx *RunContext) (string, error) {
+		out, err := exec.Command("git", "config", "--get", key).Output()
+		if err != nil {
+			return "", fmt.Errorf("could not read %s from git: %w", key, err)
+		}
+		return nonEmpty(strings.TrimSpace(string(out)), "git config "+key)
+	}
+}
+
+func nonEmpty(value string, from string) (string, error) {
+	if len(value) == 0 {
+		return "", fmt.Errorf("%s has no value", from)
+	}
+	return value, nil
+}
@@ -0,0 +1,94 @@
+package atkmod
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// HostPlatform is the platform of the host that runs podman, which decides
+// how the local paths of the volumes are translated to the paths that the
+// podman machine sees.
+type HostPlatform string
+
+const (
+	// PlatformLinux runs the containers on the host, so the paths are not
+	// translated.
+	PlatformLinux HostPlatform = "linux"
+	// PlatformWindows runs the containers in a podman machine on WSL, which
+	// has the drives of Windows in /mnt.
+	PlatformWindows HostPlatform = "windows"
+	// PlatformWSL is a Linux distribution on WSL, where the drives of
+	// Windows are in /mnt as well.
+	PlatformWSL HostPlatform = "wsl"
+	// PlatformDarwin runs the containers in a podman machine that mounts
+	// /Users, /private and /var/folders from macOS.
+	PlatformDarwin HostPlatform = "darwin"
+)
+
+var windowsDrivePath = regexp.MustCompile(`^([A-Za-z]):(?:[\\/](.*))?$`)
+
+// CurrentHostPlatform returns the platform of this host.
+func CurrentHostPlatform() HostPlatform {
+	switch runtime.GOOS {
+	case "windows":
+		return PlatformWindows
+	case "darwin":
+		return PlatformDarwin
+	case "linux":
+		if isWSL() {
+			return PlatformWSL
+		}
+	}
+	return PlatformLinux
+}
+
+// isWSL returns true if this Linux host is a distribution on WSL.
+func isWSL() bool {
+	if len(os.Getenv("WSL_DISTRO_NAME")) > 0 {
+		return true
+	}
+	version, err := os.ReadFile("/proc/version")
+	return err == nil && strings.Contains(strings.ToLower(string(version)), "microsoft")
+}
+
+// MachinePath translates the local path on the host to the path of the same
+// directory in the podman machine of the platform:
+//
+//   - On Windows and WSL, C:\Users\me\work is /mnt/c/Users/me/work.
+//   - On macOS, /tmp, /var and /etc are the directories under /private,
+//     because they are links on macOS but not in the machine, and ~ is the
+//     home directory.
+//
+// Names of volumes, which are not paths, and paths on Linux are returned as
+// they are.
+func MachinePath(platform HostPlatform, localPath string) string {
+	switch platform {
+	case PlatformWindows, PlatformWSL:
+		if match := windowsDrivePath.FindStringSubmatch(localPath); match != nil {
+			rest := strings.ReplaceAll(match[2], `\`, "/")
+			return strings.TrimSuffix("/mnt/"+strings.ToLower(match[1])+"/"+rest, "/")
+		}
+	case PlatformDarwin:
+		if localPath == "~" || strings.HasPrefix(localPath, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				localPath = home + localPath[1:]
+			}
+		}
+		if !strings.HasPrefix(localPath, "/") {
+			return localPath
+		}
+		localPath = path.Clean(localPath)
+		for _, dir := range []string{"/tmp", "/var", "/etc"} {
+			if localPath == dir || strings.HasPrefix(localPath, dir+"/") {
+				if dir == "/var" && strings.HasPrefix(localPath, "/var/folders") {
+					break
+				}
+				return "/private" + localPath
+			}
+		}
+	}
+	return localPath
+}
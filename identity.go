@@ -0,0 +1,83 @@
+package atkmod
+
+import (
+	"runtime/debug"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// The CloudEvents extensions with the identity of the module that are set
+// on the request events sent by a deployment, so that the hooks can check
+// that they are compatible and include them in their logs.
+const (
+	// ModuleExtension is the name of the module.
+	ModuleExtension = "atkmodule"
+	// NamespaceExtension is the namespace of the module, DefaultNamespace if
+	// it has none.
+	NamespaceExtension = "atknamespace"
+	// ManifestChecksumExtension is the ManifestChecksum of the manifest.
+	ManifestChecksumExtension = "atkchecksum"
+	// VersionExtension is the Version of atkmod.
+	VersionExtension = "atkversion"
+)
+
+// modulePath is the path of the Go module of this package.
+const modulePath = "github.com/cloud-native-toolkit/atkmod"
+
+// Version is the version of atkmod, which is read from the build
+// information of the binary, or "(devel)" if it is not known. It can be set
+// at build time with -ldflags "-X github.com/cloud-native-toolkit/atkmod.Version=v1.2.3".
+var Version = buildVersion()
+
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath && len(info.Main.Version) > 0 {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil && len(dep.Replace.Version) > 0 {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+// SetModuleExtensions sets the extensions with the identity of the module on
+// the event, for events that are sent to the hooks of the module outside of
+// a deployment.
+func SetModuleExtensions(event *cloudevents.Event, module *ModuleInfo) error {
+	checksum, err := ManifestChecksum(module)
+	if err != nil {
+		return err
+	}
+	setModuleExtensions(event, module, checksum)
+	return nil
+}
+
+func setModuleExtensions(event *cloudevents.Event, module *ModuleInfo, checksum string) {
+	event.SetExtension(ModuleExtension, module.Metadata.Name)
+	event.SetExtension(NamespaceExtension, namespaceOf(module))
+	if len(checksum) > 0 {
+		event.SetExtension(ManifestChecksumExtension, checksum)
+	}
+	event.SetExtension(VersionExtension, Version)
+}
+
+// manifestChecksum returns the checksum of the manifest of the deployment,
+// which is computed once, or an empty string if it cannot be computed.
+func (m *DeployableModule) manifestChecksum() string {
+	m.checksumOnce.Do(func() {
+		checksum, err := ManifestChecksum(m.module)
+		if err != nil {
+			m.runCtx.Log.WithField(RunIDLogField, m.runID).Warnf("could not compute the checksum of the manifest of module %s: %v", m.module.Metadata.Name, err)
+		}
+		m.checksum = checksum
+	})
+	return m.checksum
+}
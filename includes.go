@@ -0,0 +1,224 @@
+package atkmod
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloud-native-toolkit/atkmod/fsm"
+	"github.com/google/uuid"
+)
+
+// IncludeInfo is another module manifest that is deployed as a part of the
+// module, before its own lifecycle stages, so that a big solution can be
+// assembled from smaller modules.
+type IncludeInfo struct {
+	// Path is the path of the manifest, relative to the directory of the
+	// manifest that includes it, or a file:// URI.
+	Path string `json:"path" yaml:"path"`
+	// SHA256 is the checksum of the included manifest, which is verified
+	// when the manifest is loaded. The includes of a manifest that is
+	// verified with a ChecksumVerifier must have one, so that they are
+	// verified as well.
+	SHA256 string `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+}
+
+// IncludeError is returned by Deploy when the deployment of a module that
+// is included by the module failed.
+type IncludeError struct {
+	Module  string
+	Include string
+	Err     error
+}
+
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("included module %s of module %s failed: %v", e.Include, e.Module, e.Err)
+}
+
+func (e *IncludeError) Unwrap() error {
+	return e.Err
+}
+
+// LoadIncludes loads the manifests that are included by the module, which
+// was loaded from the last path given to Load, and the manifests that they
+// include in turn. The manifests are returned in the order that they are
+// deployed: each one after the manifests that it includes. A manifest that
+// is included more than once is only returned once, and a manifest that
+// includes itself is an error.
+//
+// The included manifests are loaded with the same verifiers and defaults as
+// the module, except for a ChecksumVerifier, which is the checksum of the
+// including manifest only. Instead, an include with a sha256 is verified with
+// a ChecksumVerifier of its own, and if the module was verified with a
+// ChecksumVerifier, all of its includes must have a sha256, and so must
+// theirs, so that all of the manifests are verified.
+func (l *ManifestFileLoader) LoadIncludes(module *ModuleInfo) ([]*ModuleInfo, error) {
+	if len(l.path) == 0 {
+		return nil, errors.New("the includes can only be loaded after the manifest")
+	}
+	root, err := filepath.Abs(l.path)
+	if err != nil {
+		return nil, err
+	}
+	loader := &ManifestFileLoader{defaults: l.defaults}
+	checksummed := false
+	for _, verifier := range l.verifiers {
+		if _, ok := verifier.(*ChecksumVerifier); ok {
+			checksummed = true
+		} else {
+			loader.verifiers = append(loader.verifiers, verifier)
+		}
+	}
+	modules := make([]*ModuleInfo, 0)
+	visited := map[string]bool{root: true}
+	err = loader.loadIncludes(root, module, checksummed, []string{root}, visited, &modules)
+	return modules, err
+}
+
+// forInclude returns the loader of the include, which also verifies its
+// checksum, if it has one.
+func (l *ManifestFileLoader) forInclude(include IncludeInfo) *ManifestFileLoader {
+	if len(include.SHA256) == 0 {
+		return l
+	}
+	verifiers := append(append([]ManifestVerifier(nil), l.verifiers...), &ChecksumVerifier{SHA256: include.SHA256})
+	return &ManifestFileLoader{defaults: l.defaults, verifiers: verifiers}
+}
+
+func (l *ManifestFileLoader) loadIncludes(path string, module *ModuleInfo, checksummed bool, stack []string, visited map[string]bool, modules *[]*ModuleInfo) error {
+	for _, include := range module.Specifications.Includes {
+		includePath, err := resolveInclude(path, include.Path)
+		if err != nil {
+			return err
+		}
+		for _, p := range stack {
+			if p == includePath {
+				return fmt.Errorf("manifest %s includes itself through %s", includePath, strings.Join(append(stack, includePath), " -> "))
+			}
+		}
+		if checksummed && len(include.SHA256) == 0 {
+			return fmt.Errorf("the manifest %s included by %s has no sha256, which is needed because %s is verified with a checksum", include.Path, path, path)
+		}
+		if visited[includePath] {
+			continue
+		}
+		visited[includePath] = true
+		included, err := l.forInclude(include).Load(includePath)
+		if err != nil {
+			return fmt.Errorf("could not load the manifest %s included by %s: %w", include.Path, path, err)
+		}
+		if err := l.loadIncludes(includePath, included, checksummed || len(include.SHA256) > 0, append(stack, includePath), visited, modules); err != nil {
+			return err
+		}
+		*modules = append(*modules, included)
+	}
+	return nil
+}
+
+// resolveInclude returns the absolute path of the manifest that is included
+// by the manifest at the path.
+func resolveInclude(from string, include string) (string, error) {
+	if strings.Contains(include, "://") {
+		u, err := url.Parse(include)
+		if err != nil {
+			return "", err
+		}
+		if u.Scheme != "file" {
+			return "", fmt.Errorf("unsupported include %s; only paths and file:// URIs can be included", include)
+		}
+		include = filepath.FromSlash(u.Path)
+	}
+	if len(include) == 0 {
+		return "", fmt.Errorf("the includes of %s must have a path", from)
+	}
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(filepath.Dir(from), include)
+	}
+	return filepath.Clean(include), nil
+}
+
+// WithIncludes deploys the modules, in order, before the lifecycle stages of
+// the module, each as a deployment of its own, such as the modules returned
+// by LoadIncludes. The included modules are deployed with the options of the
+// module, such as its runner, workspace root, credentials and variables, but
+// with run IDs of their own. If one of them fails, so does the module, with
+// an IncludeError.
+func WithIncludes(modules ...*ModuleInfo) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.includes = append(m.includes, modules...)
+	}
+}
+
+// Includes returns the deployments of the included modules of the last
+// deployment, in the order that they were deployed.
+func (m *DeployableModule) Includes() []*DeployableModule {
+	m.stageMu.Lock()
+	defer m.stageMu.Unlock()
+	return append([]*DeployableModule(nil), m.subDeployments...)
+}
+
+// newSubDeployment creates the deployment of the included module with the
+// options of the module, so that it runs with the same settings, except for
+// what belongs to the module itself: its includes, which LoadIncludes has
+// already flattened, its run ID, its transcript and its order of states.
+// The variables are those of the module now, with the ones that it resolved,
+// and the images that the user trusted are trusted for both.
+func (m *DeployableModule) newSubDeployment(include *ModuleInfo) *DeployableModule {
+	opts := append(append([]DeployableModuleOption(nil), m.opts...), func(sub *DeployableModule) {
+		sub.includes = nil
+		sub.runID = uuid.New().String()
+		sub.machine = fsm.New[State, StateCmd](Invalid, DefaultOrder)
+		sub.variables = append([]EventDataVarInfo(nil), m.variables...)
+		sub.trust = m.trust
+		if sub.transcriptEvents != nil {
+			sinks := sub.sinks[:0]
+			for _, sink := range sub.sinks {
+				if sink != EventSink(sub.transcriptEvents) {
+					sinks = append(sinks, sink)
+				}
+			}
+			sub.sinks = sinks
+			sub.transcript = ""
+			sub.transcriptEvents = nil
+		}
+	})
+	return NewDeployableModule(m.runCtx, include, opts...)
+}
+
+// deployIncludes deploys the included modules and moves the deployment on to
+// its own lifecycle stages.
+func (m *DeployableModule) deployIncludes(ctx *RunContext, notifier Notifier) error {
+	m.stageMu.Lock()
+	m.subDeployments = nil
+	m.stageMu.Unlock()
+	m.includeResults = nil
+	for _, include := range m.includes {
+		if m.IsCancelled() {
+			return nil
+		}
+		sub := m.newSubDeployment(include)
+		m.stageMu.Lock()
+		m.subDeployments = append(m.subDeployments, sub)
+		m.runningInclude = sub
+		m.stageMu.Unlock()
+		result, err := sub.Deploy(ctx)
+		m.stageMu.Lock()
+		m.runningInclude = nil
+		m.stageMu.Unlock()
+		m.includeResults = append(m.includeResults, result)
+		if m.IsCancelled() {
+			// The deployment of the module is cancelled once this returns.
+			return nil
+		}
+		if err != nil {
+			err = &IncludeError{Module: m.module.Metadata.Name, Include: include.Metadata.Name, Err: err}
+			ctx.AddError(err)
+			notifier.Notify(Errored)
+			return err
+		}
+	}
+	notifier.Notify(PreDeploying)
+	return nil
+}
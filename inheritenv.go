@@ -0,0 +1,42 @@
+package atkmod
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// inheritedEnv returns the environment variables of the host that match the
+// InheritEnv patterns of the image, sorted by name. The variables that the
+// image sets itself are not inherited, so that the manifest takes precedence.
+func inheritedEnv(info ImageInfo) []EnvVarInfo {
+	if len(info.InheritEnv) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(info.EnvVars))
+	for _, env := range info.EnvVars {
+		set[env.Name] = true
+	}
+	inherited := make([]EnvVarInfo, 0)
+	for _, entry := range os.Environ() {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || len(name) == 0 || set[name] || !matchesAny(info.InheritEnv, name) {
+			continue
+		}
+		inherited = append(inherited, EnvVarInfo{Name: name, Value: value})
+	}
+	sort.Slice(inherited, func(i, j int) bool { return inherited[i].Name < inherited[j].Name })
+	return inherited
+}
+
+// matchesAny returns true if the name matches any of the patterns. Invalid
+// patterns, which are reported by Lint, match nothing.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
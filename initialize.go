@@ -0,0 +1,108 @@
+package atkmod
+
+import (
+	"errors"
+)
+
+// resolveState initializes the deployment: the info hook, if there is one,
+// reports the capabilities of the hooks, the get_state hook reports the
+// state of the module before anything runs, and the list hook reports the
+// variables that the module expects, whose defaults are used by Variables.
+// If the reported state is a state of the execution order after Configured,
+// the deployment starts from that state instead of configuring the module
+// again, so that a module that is already deployed is not deployed twice.
+// A hook that is not declared, or that does not write a response, is
+// skipped, as is a get_state hook that cannot determine the state, for
+// example because nothing has been deployed yet. If a hook fails, the
+// deployment fails.
+func (m *DeployableModule) resolveState(ctx *RunContext, notifier Notifier) error {
+	log := ctx.Log.WithField(RunIDLogField, m.runID)
+	hooks := m.module.Specifications.Hooks
+	if !hooks.Info.Equal(ImageInfo{}) {
+		errCount := len(ctx.Errors)
+		capabilities, err := m.Handshake(ctx)
+		if err != nil {
+			addHookError(ctx, errCount, err)
+			notifier.Notify(Errored)
+			return err
+		}
+		log.Debugf("the hooks of module %s use CloudEvents %s by %s", m.module.Metadata.Name, capabilities.SpecVersion, capabilities.Delivery)
+	}
+	start := Configured
+	if !hooks.GetState.Equal(ImageInfo{}) {
+		errCount := len(ctx.Errors)
+		state, err := m.GetState(ctx)
+		code, _ := ExitCodeOf(err)
+		switch {
+		case err == nil:
+			m.initialState = state
+			log.Debugf("module %s reported the state %s", m.module.Metadata.Name, state.State())
+			if m.isAfter(state.State(), Configured) {
+				start = state.State()
+			}
+		case errors.Is(err, ErrNoEvent), code == HookExitUndetermined:
+			log.Debugf("the get_state hook of module %s did not report a state: %v", m.module.Metadata.Name, err)
+			ctx.Errors = ctx.Errors[:errCount]
+			ctx.Reset()
+		default:
+			addHookError(ctx, errCount, err)
+			notifier.Notify(Errored)
+			return err
+		}
+	}
+	if !hooks.List.Equal(ImageInfo{}) {
+		errCount := len(ctx.Errors)
+		listed, err := m.List(ctx)
+		switch {
+		case err == nil:
+			m.listed = listed
+		case errors.Is(err, ErrNoEvent):
+			log.Debugf("the list hook of module %s did not report any variables: %v", m.module.Metadata.Name, err)
+		default:
+			addHookError(ctx, errCount, err)
+			notifier.Notify(Errored)
+			return err
+		}
+	}
+	if start != Configured {
+		// The deployment starts from the state of the module, which is not a
+		// transition of its execution order.
+		from := m.machine.Current()
+		log.Debugf("module %s starts from the state %s", m.module.Metadata.Name, start)
+		m.machine.Restore(start, from)
+		m.moved(from, start, nil)
+		return nil
+	}
+	notifier.Notify(Configured)
+	return nil
+}
+
+// isAfter returns true if the state comes after the other state in the
+// execution order of the deployment.
+func (m *DeployableModule) isAfter(state State, other State) bool {
+	seen := false
+	for _, s := range m.machine.Order() {
+		switch s {
+		case other:
+			seen = true
+		case state:
+			return seen
+		}
+	}
+	return false
+}
+
+// addHookError adds the error of a hook to the context, unless the runner
+// has already recorded the failure of the hook since errCount.
+func addHookError(ctx *RunContext, errCount int, err error) {
+	if len(ctx.Errors) == errCount {
+		ctx.AddError(err)
+	}
+}
+
+// InitialState returns the state that the get_state hook of the module
+// reported when the deployment was initialized, or nil if it did not report
+// one.
+func (m *DeployableModule) InitialState() *ModuleState {
+	return m.initialState
+}
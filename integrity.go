@@ -0,0 +1,155 @@
+package atkmod
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SignatureFileSuffix is added to the path of a manifest to find its
+// detached signature, when the signature is not given to the verifier.
+const SignatureFileSuffix = ".sig"
+
+// ManifestVerifier checks the integrity of the contents of a manifest
+// before it is loaded.
+type ManifestVerifier interface {
+	Verify(uri string, content []byte) error
+}
+
+// ManifestIntegrityError is returned by the loader when a manifest does not
+// pass the verification.
+type ManifestIntegrityError struct {
+	URI string
+	Err error
+}
+
+func (e *ManifestIntegrityError) Error() string {
+	return fmt.Sprintf("integrity check of manifest %s failed: %v", e.URI, e.Err)
+}
+
+func (e *ManifestIntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// ChecksumVerifier verifies that the sha256 checksum of the manifest is the
+// expected one.
+type ChecksumVerifier struct {
+	// SHA256 is the hex encoded checksum, with or without a sha256: prefix.
+	SHA256 string
+}
+
+// Verify returns an error if the checksum of the content is not the expected
+// one.
+func (v *ChecksumVerifier) Verify(uri string, content []byte) error {
+	sum := sha256.Sum256(content)
+	actual := hex.EncodeToString(sum[:])
+	expected := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(v.SHA256), "sha256:"))
+	if actual != expected {
+		return fmt.Errorf("expected sha256 checksum %s but got %s", expected, actual)
+	}
+	return nil
+}
+
+// SignatureVerifier verifies a detached signature of the manifest with the
+// public keys configured by the caller. The signature is base64 encoded, as
+// written by `cosign sign-blob`: ECDSA and RSA signatures are of the sha256
+// digest of the manifest, while ed25519 signatures are of the manifest
+// itself. The manifest is valid if any of the keys verifies the signature.
+type SignatureVerifier struct {
+	Keys []crypto.PublicKey
+	// Signature is the signature of the manifest. If it is empty, the
+	// signature is read from the file next to the manifest that has the
+	// SignatureFileSuffix.
+	Signature []byte
+}
+
+// Verify returns an error if none of the keys verifies the signature.
+func (v *SignatureVerifier) Verify(uri string, content []byte) error {
+	if len(v.Keys) == 0 {
+		return errors.New("no public keys to verify the signature")
+	}
+	encoded := v.Signature
+	if len(encoded) == 0 {
+		var err error
+		if encoded, err = os.ReadFile(uri + SignatureFileSuffix); err != nil {
+			return fmt.Errorf("could not read the signature: %w", err)
+		}
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("could not decode the signature: %w", err)
+	}
+
+	digest := sha256.Sum256(content)
+	for _, key := range v.Keys {
+		switch k := key.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, content, signature) {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, digest[:], signature) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil {
+				return nil
+			}
+		default:
+			return fmt.Errorf("unsupported public key type %T", key)
+		}
+	}
+	return errors.New("the signature is not valid for any of the keys")
+}
+
+// ParsePublicKeys parses the PEM encoded PKIX public keys, such as the
+// cosign.pub file written by `cosign generate-key-pair`.
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse public key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM encoded public keys found")
+	}
+	return keys, nil
+}
+
+// ManifestLoaderOption configures optional settings of a ManifestFileLoader.
+type ManifestLoaderOption func(*ManifestFileLoader)
+
+// WithManifestVerifier verifies the contents of the manifests with the
+// given verifier before they are loaded. All of the verifiers must pass.
+func WithManifestVerifier(verifier ManifestVerifier) ManifestLoaderOption {
+	return func(l *ManifestFileLoader) {
+		l.verifiers = append(l.verifiers, verifier)
+	}
+}
+
+func (l *ManifestFileLoader) verify(uri string, content []byte) error {
+	for _, verifier := range l.verifiers {
+		if err := verifier.Verify(uri, content); err != nil {
+			return &ManifestIntegrityError{URI: uri, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package atkmod
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// MaxJSONLogOutput is the number of bytes of the output and error streams of
+// a command that are included in its exit record.
+const MaxJSONLogOutput = 4096
+
+// JSONLogRecordType is the type of a record written to the JSON log.
+type JSONLogRecordType string
+
+const (
+	// StageStartRecord is written when a deployment enters a state.
+	StageStartRecord JSONLogRecordType = "stage_start"
+	// StageStopRecord is written when the command of a state has finished.
+	StageStopRecord JSONLogRecordType = "stage_stop"
+	// CommandRecord is written before a runner runs a command.
+	CommandRecord JSONLogRecordType = "command"
+	// ExitRecord is written after a command has exited.
+	ExitRecord JSONLogRecordType = "exit"
+)
+
+// JSONLogRecord is a single line of the JSON log of a RunContext. Tools that
+// wrap atkmod can read these instead of parsing the text of the logs.
+type JSONLogRecord struct {
+	Time   time.Time         `json:"time"`
+	Type   JSONLogRecordType `json:"type"`
+	RunID  string            `json:"runId,omitempty"`
+	Module string            `json:"module,omitempty"`
+	// State is the state of the deployment for the stage records.
+	State State `json:"state,omitempty"`
+	// Next is the state that the deployment moved to, for the stage_stop
+	// records.
+	Next State `json:"next,omitempty"`
+	// Command is the command line for the command and exit records.
+	Command  []string `json:"command,omitempty"`
+	ExitCode *int     `json:"exitCode,omitempty"`
+	// Stdout and Stderr are the first MaxJSONLogOutput bytes of the output
+	// of the command, and Truncated is true if there was more.
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// jsonLogMu serializes the writes to the JSON logs, which may be shared by
+// the contexts of several workers.
+var jsonLogMu sync.Mutex
+
+// writeJSONLog writes the record as a single line to the JSON log of the
+// context, if it has one. Failing to write the log does not fail the run.
+func writeJSONLog(ctx *RunContext, record JSONLogRecord) {
+	if ctx.JSONLog == nil {
+		return
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	if len(record.RunID) == 0 {
+		record.RunID = ctx.RunID
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		ctx.Logger().Warnf("could not encode the JSON log record: %v", err)
+		return
+	}
+	jsonLogMu.Lock()
+	defer jsonLogMu.Unlock()
+	if _, err := ctx.JSONLog.Write(append(line, '\n')); err != nil {
+		ctx.Logger().Warnf("could not write the JSON log record: %v", err)
+	}
+}
+
+// headBuffer keeps the first limit bytes written to it and discards the
+// rest, remembering that it did.
+type headBuffer struct {
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	room := b.limit - len(b.buf)
+	if room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf = append(b.buf, p[:room]...)
+		}
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// teeWriter returns a writer that writes to w, if it is not nil, and to the
+// capture buffer.
+func teeWriter(w io.Writer, capture io.Writer) io.Writer {
+	if w == nil {
+		return capture
+	}
+	return io.MultiWriter(w, capture)
+}
@@ -0,0 +1,345 @@
+package atkmod
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Severity is the severity of a lint Finding.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Finding is a single problem found in a manifest by Lint.
+type Finding struct {
+	RuleID   string   `json:"ruleId" yaml:"ruleId"`
+	Severity Severity `json:"severity" yaml:"severity"`
+	// Path is the location of the problem in the manifest, such as
+	// spec.lifecycle.deploy.image.
+	Path    string `json:"path" yaml:"path"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s [%s] %s: %s", f.Severity, f.RuleID, f.Path, f.Message)
+}
+
+// LintRule is a rule that is checked against a manifest by Lint.
+type LintRule struct {
+	ID          string
+	Severity    Severity
+	Description string
+	Check       func(m *ModuleInfo) []Finding
+}
+
+// stageImage is an ImageInfo along with its location in the manifest and
+// the state that it runs in, for the lifecycle stages.
+type stageImage struct {
+	Path  string
+	Info  ImageInfo
+	State State
+}
+
+// stageImages returns all of the hooks and lifecycle stages of the module,
+// in the order that they are defined in the manifest.
+func stageImages(m *ModuleInfo) []stageImage {
+	spec := m.Specifications
+	return []stageImage{
+		{"spec.hooks.list", spec.Hooks.List, ""},
+		{"spec.hooks.validate", spec.Hooks.Validate, ""},
+		{"spec.hooks.get_state", spec.Hooks.GetState, ""},
+		{"spec.hooks.info", spec.Hooks.Info, ""},
+		{"spec.lifecycle.pre_deploy", spec.Lifecycle.PreDeploy, PreDeploying},
+		{"spec.lifecycle.deploy", spec.Lifecycle.Deploy, Deploying},
+		{"spec.lifecycle.post_deploy", spec.Lifecycle.PostDeploy, PostDeploying},
+		{"spec.lifecycle.on_cancel", spec.Lifecycle.OnCancel, Cancelled},
+	}
+}
+
+// imageHasTag returns true if the image reference includes a tag or a
+// digest.
+func imageHasTag(image string) bool {
+	if strings.Contains(image, "@") {
+		return true
+	}
+	name := image
+	if idx := strings.LastIndex(image, "/"); idx >= 0 {
+		name = image[idx+1:]
+	}
+	return strings.Contains(name, ":")
+}
+
+// DefaultLintRules are the rules used by Lint.
+var DefaultLintRules = []LintRule{
+	{
+		ID:          "ATK001",
+		Severity:    SeverityError,
+		Description: "the apiVersion and kind must be supported",
+		Check: func(m *ModuleInfo) []Finding {
+			if m.IsSupported() {
+				return nil
+			}
+			return []Finding{{Path: "apiVersion", Message: fmt.Sprintf("%s %s is not supported", m.ApiVersion, m.Kind)}}
+		},
+	},
+	{
+		ID:          "ATK002",
+		Severity:    SeverityError,
+		Description: "the module must have a name",
+		Check: func(m *ModuleInfo) []Finding {
+			if len(strings.TrimSpace(m.Metadata.Name)) > 0 {
+				return nil
+			}
+			return []Finding{{Path: "metadata.name", Message: "module name is missing"}}
+		},
+	},
+	{
+		ID:          "ATK003",
+		Severity:    SeverityError,
+		Description: "the deploy stage must have an image",
+		Check: func(m *ModuleInfo) []Finding {
+			if len(m.Specifications.Lifecycle.Deploy.Image) > 0 {
+				return nil
+			}
+			return []Finding{{Path: "spec.lifecycle.deploy.image", Message: "deploy image is missing"}}
+		},
+	},
+	{
+		ID:          "ATK004",
+		Severity:    SeverityWarning,
+		Description: "images should have a tag or digest",
+		Check: func(m *ModuleInfo) []Finding {
+			var findings []Finding
+			for _, s := range stageImages(m) {
+				if len(s.Info.Image) > 0 && !imageHasTag(s.Info.Image) {
+					findings = append(findings, Finding{Path: s.Path + ".image", Message: fmt.Sprintf("image %s is missing a tag", s.Info.Image)})
+				}
+			}
+			return findings
+		},
+	},
+	{
+		ID:          "ATK005",
+		Severity:    SeverityWarning,
+		Description: "the workspace should be mounted in the deploy stage",
+		Check: func(m *ModuleInfo) []Finding {
+			deploy := m.Specifications.Lifecycle.Deploy
+			if len(deploy.Image) == 0 {
+				return nil
+			}
+			for _, v := range deploy.Volumes {
+				if v.MountPath == "/workspace" {
+					return nil
+				}
+			}
+			return []Finding{{Path: "spec.lifecycle.deploy.volumeMounts", Message: "workspace is not mounted in the deploy stage"}}
+		},
+	},
+	{
+		ID:          "ATK006",
+		Severity:    SeverityWarning,
+		Description: "the get_state hook should be defined",
+		Check: func(m *ModuleInfo) []Finding {
+			if len(m.Specifications.Hooks.GetState.Image) > 0 {
+				return nil
+			}
+			return []Finding{{Path: "spec.hooks.get_state", Message: "get_state hook is missing"}}
+		},
+	},
+	{
+		ID:          "ATK007",
+		Severity:    SeverityInfo,
+		Description: "the list hook should be defined",
+		Check: func(m *ModuleInfo) []Finding {
+			if len(m.Specifications.Hooks.List.Image) > 0 {
+				return nil
+			}
+			return []Finding{{Path: "spec.hooks.list", Message: "list hook is missing, so variables cannot be discovered"}}
+		},
+	},
+	{
+		ID:          "ATK008",
+		Severity:    SeverityWarning,
+		Description: "the command must start with an executable",
+		Check: func(m *ModuleInfo) []Finding {
+			var findings []Finding
+			for _, s := range stageImages(m) {
+				if len(s.Info.Command) > 0 && strings.ContainsAny(s.Info.Command[0], " \t") {
+					findings = append(findings, Finding{Path: s.Path + ".command", Message: fmt.Sprintf("the first element of the command is run as the executable, but %q has spaces; put its arguments in the next elements", s.Info.Command[0])})
+				}
+			}
+			return findings
+		},
+	},
+	{
+		ID:          "ATK009",
+		Severity:    SeverityError,
+		Description: "the scanners of the lifecycle stages must be valid",
+		Check: func(m *ModuleInfo) []Finding {
+			var findings []Finding
+			for _, s := range stageImages(m) {
+				if len(s.Info.Scanners) == 0 || len(s.State) == 0 {
+					continue
+				}
+				if _, err := compileScanners(s.State, s.Info.Scanners); err != nil {
+					findings = append(findings, Finding{Path: s.Path + ".scanners", Message: err.Error()})
+				}
+			}
+			return findings
+		},
+	},
+	{
+		ID:          "ATK010",
+		Severity:    SeverityWarning,
+		Description: "scanners are only used by the lifecycle stages",
+		Check: func(m *ModuleInfo) []Finding {
+			var findings []Finding
+			for _, s := range stageImages(m) {
+				if len(s.Info.Scanners) > 0 && len(s.State) == 0 {
+					findings = append(findings, Finding{Path: s.Path + ".scanners", Message: "scanners are ignored for hooks"})
+				}
+			}
+			return findings
+		},
+	},
+	{
+		ID:          "ATK011",
+		Severity:    SeverityError,
+		Description: "the readiness check must be valid",
+		Check: func(m *ModuleInfo) []Finding {
+			readiness := m.Specifications.Readiness
+			if readiness == nil {
+				return nil
+			}
+			if _, _, err := readiness.durations(); err != nil {
+				return []Finding{{Path: "spec.readiness", Message: err.Error()}}
+			}
+			if len(readiness.HTTPGet) > 0 && len(readiness.TCPSocket) > 0 {
+				return []Finding{{Path: "spec.readiness", Message: "only one of httpGet and tcpSocket can be set"}}
+			}
+			if len(readiness.HTTPGet) == 0 && len(readiness.TCPSocket) == 0 && len(m.Specifications.Hooks.GetState.Image) == 0 {
+				return []Finding{{Path: "spec.readiness", Message: "readiness without a probe needs the get_state hook"}}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "ATK012",
+		Severity:    SeverityWarning,
+		Description: "the well-known annotations must have valid values",
+		Check:       checkAnnotations,
+	},
+	{
+		ID:          "ATK013",
+		Severity:    SeverityError,
+		Description: "the requirements of the module must be valid",
+		Check: func(m *ModuleInfo) []Finding {
+			if m.Specifications.Requires == nil {
+				return nil
+			}
+			var findings []Finding
+			for _, problem := range m.Specifications.Requires.validate() {
+				findings = append(findings, Finding{Path: "spec.requires", Message: problem})
+			}
+			return findings
+		},
+	},
+	{
+		ID:          "ATK014",
+		Severity:    SeverityError,
+		Description: "the inherited environment variables must be valid patterns",
+		Check: func(m *ModuleInfo) []Finding {
+			var findings []Finding
+			for _, s := range stageImages(m) {
+				for idx, pattern := range s.Info.InheritEnv {
+					if _, err := path.Match(pattern, ""); err != nil {
+						findings = append(findings, Finding{Path: fmt.Sprintf("%s.inheritEnv[%d]", s.Path, idx), Message: fmt.Sprintf("invalid pattern %q", pattern)})
+					}
+				}
+			}
+			return findings
+		},
+	},
+	{
+		ID:          "ATK015",
+		Severity:    SeverityError,
+		Description: "the includes must have a path",
+		Check: func(m *ModuleInfo) []Finding {
+			var findings []Finding
+			for idx, include := range m.Specifications.Includes {
+				if len(strings.TrimSpace(include.Path)) == 0 {
+					findings = append(findings, Finding{Path: fmt.Sprintf("spec.includes[%d].path", idx), Message: "include is missing a path"})
+				}
+			}
+			return findings
+		},
+	},
+	{
+		ID:          "ATK016",
+		Severity:    SeverityError,
+		Description: "the artifacts must be valid patterns under /workspace",
+		Check: func(m *ModuleInfo) []Finding {
+			var findings []Finding
+			for _, s := range stageImages(m) {
+				for idx, pattern := range s.Info.Artifacts {
+					if _, err := artifactPattern(pattern); err != nil {
+						findings = append(findings, Finding{Path: fmt.Sprintf("%s.artifacts[%d]", s.Path, idx), Message: err.Error()})
+					}
+				}
+			}
+			return findings
+		},
+	},
+}
+
+// Lint checks the module against the DefaultLintRules and returns the
+// findings, ordered by severity and then by rule ID.
+func Lint(module *ModuleInfo) []Finding {
+	return LintWith(module, DefaultLintRules...)
+}
+
+// LintWith checks the module against the given rules.
+func LintWith(module *ModuleInfo, rules ...LintRule) []Finding {
+	findings := make([]Finding, 0)
+	for _, rule := range rules {
+		for _, f := range rule.Check(module) {
+			f.RuleID = rule.ID
+			f.Severity = rule.Severity
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return severityRank(findings[i].Severity) < severityRank(findings[j].Severity)
+		}
+		return findings[i].RuleID < findings[j].RuleID
+	})
+	return findings
+}
+
+// HasErrors returns true if any of the findings has a severity of error.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func severityRank(s Severity) int {
+	switch s {
+	case SeverityError:
+		return 0
+	case SeverityWarning:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,46 @@
+package atkmod
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// List runs the list hook of the module and returns the variables that it
+// reports. If the deployment has a HookCache, the variables are returned
+// from the cache while they are fresh, without running the hook.
+func (m *DeployableModule) List(ctx *RunContext) (*EventData, error) {
+	var key string
+	if m.hookCache != nil {
+		var err error
+		key, err = m.hookCache.Key(m.module, ListHook, m.module.Specifications.Hooks.List)
+		if err != nil {
+			ctx.Logger().Warnf("could not use the hook cache: %v", err)
+		} else if data, ok := m.hookCache.Get(key); ok {
+			return data, nil
+		}
+	}
+
+	out := new(bytes.Buffer)
+	hook := m.GetHook(ListHook)
+	prevOut := ctx.Out
+	ctx.Out = out
+	err := hook(ctx)
+	ctx.Out = prevOut
+	if err != nil {
+		return nil, err
+	}
+
+	raw := append([]byte(nil), out.Bytes()...)
+	event, err := ParseEventStream(out, ListHookResponseEvent)
+	if err != nil {
+		return nil, m.hookOutputError(ctx, ListHook, raw, fmt.Errorf("could not load list hook response: %w", err))
+	}
+	data, err := LoadEventData(event)
+	if err != nil {
+		return nil, m.hookOutputError(ctx, ListHook, raw, fmt.Errorf("could not load list hook response data: %w", err))
+	}
+	if m.hookCache != nil && len(key) > 0 {
+		m.hookCache.Put(key, m.module, data)
+	}
+	return data, nil
+}
@@ -0,0 +1,123 @@
+package atkmod
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalModuleRunner runs the hooks and lifecycle stages defined in an
+// ImageInfo directly on the host instead of inside a container. This is
+// useful on machines that do not have podman installed, or for quickly
+// iterating on a hook during development.
+//
+// Instead of the image, the runner uses the Command (if provided) or the
+// Script of the ImageInfo as the executable, followed by the Args. The
+// environment variables are added to the environment of the current
+// process and the workspace is used as the working directory. Paths under
+// the container workspace, such as /workspace/hooks/list.sh, are mapped to
+// the local workspace. Volumes other than the workspace cannot be mounted
+// on the host, so they are reported as errors unless the host path is the
+// same as the mount path.
+type LocalModuleRunner struct {
+	// Workdir is the local directory used as the workspace. If it is empty,
+	// the host path of the volume mounted to ContainerWorkdir is used.
+	Workdir string
+	// ContainerWorkdir is the path of the workspace inside the container
+	// that the ImageInfo would normally mount, which defaults to /workspace.
+	ContainerWorkdir string
+}
+
+// NewLocalModuleRunner creates a LocalModuleRunner that uses the given
+// local directory as the workspace.
+func NewLocalModuleRunner(workdir string) *LocalModuleRunner {
+	return &LocalModuleRunner{
+		Workdir:          workdir,
+		ContainerWorkdir: "/workspace",
+	}
+}
+
+// BuildFrom returns the command for the given ImageInfo as it will be run
+// on the local host.
+func (r *LocalModuleRunner) BuildFrom(info ImageInfo) (*exec.Cmd, error) {
+	var argv []string
+	if len(info.Command) > 0 {
+		argv = append(argv, info.Command...)
+	} else if len(strings.TrimSpace(info.Script)) > 0 {
+		argv = append(argv, info.Script)
+	} else {
+		return nil, errors.New("no command or script defined to run locally")
+	}
+	argv = append(argv, info.Args...)
+
+	workdir := r.workdirFor(info)
+	containerDir := Iif(r.ContainerWorkdir, "/workspace")
+	for _, v := range info.Volumes {
+		if v.MountPath != containerDir && path.Clean(v.Name) != path.Clean(v.MountPath) {
+			return nil, fmt.Errorf("volume %s cannot be mounted at %s by the local runner", v.Name, v.MountPath)
+		}
+	}
+	for idx, arg := range argv {
+		mapped, err := mapWorkspacePath(arg, containerDir, workdir)
+		if err != nil {
+			return nil, err
+		}
+		argv[idx] = mapped
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = workdir
+	cmd.Env = os.Environ()
+	for _, envvar := range info.EnvVars {
+		cmd.Env = append(cmd.Env, envvar.String())
+	}
+	return cmd, nil
+}
+
+// mapWorkspacePath maps a path under the container workspace to the same
+// path under the local workspace. Other values are returned unchanged.
+func mapWorkspacePath(value string, containerDir string, workdir string) (string, error) {
+	if value != containerDir && !strings.HasPrefix(value, containerDir+"/") {
+		return value, nil
+	}
+	if len(workdir) == 0 {
+		return "", fmt.Errorf("%s is in the workspace, but no local workspace is defined", value)
+	}
+	return filepath.Join(workdir, filepath.FromSlash(strings.TrimPrefix(value, containerDir))), nil
+}
+
+func (r *LocalModuleRunner) workdirFor(info ImageInfo) string {
+	if len(r.Workdir) > 0 {
+		return r.Workdir
+	}
+	containerDir := Iif(r.ContainerWorkdir, "/workspace")
+	for _, v := range info.Volumes {
+		if v.MountPath == containerDir {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+// RunImage runs the script or command that is defined in the provided
+// ImageInfo on the local host.
+func (r *LocalModuleRunner) RunImage(ctx *RunContext, info ImageInfo) error {
+	cmd, err := r.BuildFrom(info)
+	if err != nil {
+		ctx.AddError(err)
+		return err
+	}
+	ctx.logCommand("running local command: %s", strings.Join(cmd.Args, " "))
+	if len(cmd.Dir) > 0 {
+		if _, err := os.Stat(cmd.Dir); err != nil {
+			err = fmt.Errorf("workspace %s is not available: %w", cmd.Dir, err)
+			ctx.AddError(err)
+			return err
+		}
+	}
+	return execCmd(ctx, cmd)
+}
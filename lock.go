@@ -0,0 +1,223 @@
+package atkmod
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LockInfo describes the holder of a module lock. It is written to the lock
+// file so that other processes can report who holds the lock and detect
+// locks that were left behind.
+type LockInfo struct {
+	Module    string    `json:"module" yaml:"module"`
+	Namespace string    `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Workspace string    `json:"workspace,omitempty" yaml:"workspace,omitempty"`
+	RunID     string    `json:"runId" yaml:"runId"`
+	PID       int       `json:"pid" yaml:"pid"`
+	Host      string    `json:"host" yaml:"host"`
+	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
+}
+
+// LockedError is returned when a module is already locked by another
+// deployment.
+type LockedError struct {
+	Holder LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("module %s is already being deployed by process %d on %s (run %s, since %s)",
+		e.Holder.Module, e.Holder.PID, e.Holder.Host, e.Holder.RunID, e.Holder.CreatedAt.Format(time.RFC3339))
+}
+
+// Locker creates advisory locks that keep two deployments of the same module
+// and workspace from running at the same time, even from different
+// processes. The locks are files in a directory, so they work wherever the
+// directory is shared.
+type Locker struct {
+	// Dir is the directory of the lock files.
+	Dir string
+	// StaleAfter is the age after which a lock is considered to be left
+	// behind, even if its process seems to be running. If it is zero, only
+	// locks of processes that are no longer running are stale.
+	StaleAfter time.Duration
+}
+
+// NewLocker creates a Locker that keeps its lock files in the given
+// directory.
+func NewLocker(dir string) *Locker {
+	return &Locker{Dir: dir}
+}
+
+// DefaultLockDir returns the directory used for the lock files when no other
+// directory is given.
+func DefaultLockDir() string {
+	return filepath.Join(os.TempDir(), "atkmod-locks")
+}
+
+// ModuleLock is a lock held on a module and workspace.
+type ModuleLock struct {
+	path string
+	Info LockInfo
+}
+
+// WithLocker locks the module and its workspace with the given locker while
+// the deployment is driven by Deploy.
+func WithLocker(locker *Locker) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.locker = locker
+	}
+}
+
+// workspaceOf returns the local directory mounted as the workspace of the
+// deploy stage of the module, if there is one.
+func workspaceOf(module *ModuleInfo) string {
+	for _, v := range module.Specifications.Lifecycle.Deploy.Volumes {
+		if v.MountPath == "/workspace" {
+			if abs, err := filepath.Abs(v.Name); err == nil {
+				return abs
+			}
+			return v.Name
+		}
+	}
+	return ""
+}
+
+func (l *Locker) pathFor(module *ModuleInfo, workspace string) string {
+	key := sha256.Sum256([]byte(module.Metadata.Namespace + "/" + module.Metadata.Name + "\x00" + workspace))
+	return filepath.Join(l.Dir, hex.EncodeToString(key[:])[:32]+".lock")
+}
+
+// Acquire locks the module and workspace for the run. If the lock is held by
+// another deployment, a LockedError is returned. A lock that was left behind
+// by a process that is no longer running, or that is older than StaleAfter,
+// is removed and acquired.
+func (l *Locker) Acquire(module *ModuleInfo, workspace string, runID string) (*ModuleLock, error) {
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	lock := &ModuleLock{
+		path: l.pathFor(module, workspace),
+		Info: LockInfo{
+			Module:    module.Metadata.Name,
+			Namespace: module.Metadata.Namespace,
+			Workspace: workspace,
+			RunID:     runID,
+			PID:       os.Getpid(),
+			Host:      host,
+			CreatedAt: time.Now().UTC(),
+		},
+	}
+	content, err := json.Marshal(lock.Info)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lock is written to a temporary file first and linked into place,
+	// which fails if the lock exists, so that the lock file is never seen
+	// without its content.
+	tmp, err := os.CreateTemp(l.Dir, ".lock-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Tries twice, so that a stale lock can be removed once.
+	for attempt := 0; attempt < 2; attempt++ {
+		err := os.Link(tmp.Name(), lock.path)
+		if err == nil {
+			return lock, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		holder, err := readLockInfo(lock.path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Released in the meantime.
+			continue
+		}
+		if err == nil && !l.isStale(holder) {
+			return nil, &LockedError{Holder: *holder}
+		}
+		if err != nil && !isOlderThan(lock.path, unreadableLockGrace) {
+			// The lock could not be read, but it may be being written by
+			// a version that did not link it into place.
+			return nil, fmt.Errorf("module %s is locked by %s, which could not be read: %w", module.Metadata.Name, lock.path, err)
+		}
+		// The lock is stale, or could not be read for long enough that
+		// its process must have died while writing it.
+		if err := os.Remove(lock.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("could not lock module %s", module.Metadata.Name)
+}
+
+// unreadableLockGrace is the time after which a lock file that cannot be
+// read is removed as stale.
+const unreadableLockGrace = 10 * time.Second
+
+// isOlderThan returns true if the file was last modified longer than the
+// duration ago, or is gone.
+func isOlderThan(path string, age time.Duration) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Is(err, os.ErrNotExist)
+	}
+	return time.Since(info.ModTime()) > age
+}
+
+func readLockInfo(path string) (*LockInfo, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &LockInfo{}
+	if err := json.Unmarshal(content, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// isStale returns true if the lock was left behind.
+func (l *Locker) isStale(info *LockInfo) bool {
+	if l.StaleAfter > 0 && time.Since(info.CreatedAt) > l.StaleAfter {
+		return true
+	}
+	host, _ := os.Hostname()
+	if info.Host != host {
+		// The process cannot be checked on another host.
+		return false
+	}
+	return !processAlive(info.PID)
+}
+
+// Release removes the lock. Releasing a lock that is no longer held, for
+// example because it was removed as stale, does nothing.
+func (lk *ModuleLock) Release() error {
+	holder, err := readLockInfo(lk.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err == nil && (holder.RunID != lk.Info.RunID || holder.PID != lk.Info.PID) {
+		return nil
+	}
+	if err := os.Remove(lk.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
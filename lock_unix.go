@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package atkmod
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processAlive returns true if a process with the pid is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	// EPERM means the process exists, but belongs to another user.
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
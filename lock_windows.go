@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package atkmod
+
+import "os"
+
+// processAlive returns true if a process with the pid is running. On
+// Windows, FindProcess opens the process, which fails if it does not exist.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,207 @@
+package atkmod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDeniedMounts are the host paths that the volumes of a manifest may
+// not mount by default: the credentials of the user, the configuration and
+// the sockets of the host and the container engines, and the directories
+// of the kernel. A volume that mounts a directory that contains one of
+// them, such as / or the home directory, is denied as well.
+var DefaultDeniedMounts = []string{
+	"~/.ssh",
+	"~/.gnupg",
+	"~/.aws",
+	"~/.azure",
+	"~/.kube",
+	"~/.bluemix",
+	"~/.docker",
+	"~/.config/containers",
+	"~/.atk",
+	"/etc",
+	"/root",
+	"/boot",
+	"/proc",
+	"/sys",
+	"/dev",
+	"/run",
+	"/var/run",
+}
+
+// MountPolicy restricts the host paths that the volumes of a manifest may
+// mount, because the manifests come from third parties. A path is denied
+// if it is one of the Deny paths, is under one of them, or contains one of
+// them, unless it is one of the Allow paths or is under one of them. The
+// paths may start with ~ for the home directory of the user.
+//
+// The policy only applies to the volumes of the manifest, not to those that
+// the options of the deployment add, such as WithKubeconfig.
+type MountPolicy struct {
+	Deny  []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+}
+
+// DefaultMountPolicy returns the policy that denies the
+// DefaultDeniedMounts, which is the policy of the deployments that are not
+// given another one.
+func DefaultMountPolicy() *MountPolicy {
+	return &MountPolicy{Deny: append([]string(nil), DefaultDeniedMounts...)}
+}
+
+// MountViolation is a volume of a manifest that the MountPolicy denies.
+type MountViolation struct {
+	// Path is the path of the hook or stage in the manifest, such as
+	// spec.lifecycle.deploy.
+	Path   string     `json:"path" yaml:"path"`
+	Volume VolumeInfo `json:"volume" yaml:"volume"`
+	// Denied is the path of the policy that denies the volume.
+	Denied string `json:"denied" yaml:"denied"`
+}
+
+func (v MountViolation) String() string {
+	return fmt.Sprintf("%s: volume %s is not allowed by the mount policy, which denies %s", v.Path, v.Volume.Name, v.Denied)
+}
+
+// MountPolicyError is returned by Deploy, before anything runs, and by the
+// hooks when the manifest mounts host paths that the MountPolicy denies.
+type MountPolicyError struct {
+	Module     string
+	Violations []MountViolation
+}
+
+func (e *MountPolicyError) Error() string {
+	violations := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		violations = append(violations, v.String())
+	}
+	return fmt.Sprintf("module %s mounts host paths that are not allowed: %s", e.Module, strings.Join(violations, "; "))
+}
+
+// WithMountPolicy replaces the DefaultMountPolicy of the deployment. A nil
+// policy allows all of the host paths.
+func WithMountPolicy(policy *MountPolicy) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.mountPolicy = policy
+	}
+}
+
+// WithAllowedMounts allows the manifest to mount the host paths, and the
+// paths under them, even though the mount policy denies them.
+func WithAllowedMounts(paths ...string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		if m.mountPolicy == nil {
+			return
+		}
+		policy := *m.mountPolicy
+		policy.Allow = append(append([]string(nil), policy.Allow...), paths...)
+		m.mountPolicy = &policy
+	}
+}
+
+// Check returns the volumes of the hooks and lifecycle stages of the module
+// that the policy denies, in the order that they are defined.
+func (p *MountPolicy) Check(module *ModuleInfo) []MountViolation {
+	var violations []MountViolation
+	for _, img := range stageImages(module) {
+		violations = append(violations, p.checkImage(img.Path, img.Info)...)
+	}
+	return violations
+}
+
+func (p *MountPolicy) checkImage(path string, info ImageInfo) []MountViolation {
+	if p == nil {
+		return nil
+	}
+	var violations []MountViolation
+	for _, v := range info.Volumes {
+		host, ok := hostMountPath(v.Name)
+		if !ok || p.allows(host) {
+			continue
+		}
+		for _, deny := range p.Deny {
+			denied, ok := hostMountPath(deny)
+			if ok && (isPathUnder(host, denied) || isPathUnder(denied, host)) {
+				violations = append(violations, MountViolation{Path: path, Volume: v, Denied: deny})
+				break
+			}
+		}
+	}
+	return violations
+}
+
+func (p *MountPolicy) allows(host string) bool {
+	for _, allow := range p.Allow {
+		if allowed, ok := hostMountPath(allow); ok && isPathUnder(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostMountPath returns the absolute, clean path of the host path of a
+// volume, with ~ expanded and the links resolved, and false if the volume
+// is a named volume.
+func hostMountPath(name string) (string, bool) {
+	switch {
+	case name == "~" || strings.HasPrefix(name, "~/"):
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		name = filepath.Join(home, name[1:])
+	case windowsDrivePath.MatchString(name):
+		return strings.ToLower(filepath.Clean(name)), true
+	case !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, "."):
+		return "", false
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", false
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	return abs, true
+}
+
+// isPathUnder returns true if the path is the directory or is under it.
+func isPathUnder(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkImageMounts returns a MountPolicyError if the image, which is run as
+// the hook or the stage with the name, mounts host paths that the mount
+// policy of the deployment denies. The violations have the path of the
+// image in the manifest, if it is one of its hooks or stages.
+func (m *DeployableModule) checkImageMounts(name string, info ImageInfo) error {
+	violations := m.mountPolicy.checkImage(name, info)
+	if len(violations) == 0 {
+		return nil
+	}
+	for _, img := range stageImages(m.module) {
+		if img.Info.Equal(info) {
+			for idx := range violations {
+				violations[idx].Path = img.Path
+			}
+			break
+		}
+	}
+	return &MountPolicyError{Module: m.module.Metadata.Name, Violations: violations}
+}
+
+// checkMounts returns a MountPolicyError if the manifest mounts host paths
+// that the mount policy of the deployment denies.
+func (m *DeployableModule) checkMounts() error {
+	if m.mountPolicy == nil {
+		return nil
+	}
+	if violations := m.mountPolicy.Check(m.module); len(violations) > 0 {
+		return &MountPolicyError{Module: m.module.Metadata.Name, Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package atkmod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultNamespace is used for the modules that do not have a namespace,
+// when their workspaces, containers and persisted state are scoped by the
+// namespace.
+const DefaultNamespace = "default"
+
+// namespaceOf returns the namespace of the module, or DefaultNamespace.
+func namespaceOf(module *ModuleInfo) string {
+	return Iif(module.Metadata.Namespace, DefaultNamespace)
+}
+
+// checkScope returns the namespace, or DefaultNamespace if it is empty, and
+// an error if the namespace or name cannot be used as a directory name.
+func checkScope(namespace string, name string) (string, error) {
+	namespace = Iif(namespace, DefaultNamespace)
+	for _, elem := range []string{namespace, name} {
+		if len(elem) == 0 || elem == "." || elem == ".." || strings.ContainsAny(elem, "/\\") {
+			return "", fmt.Errorf("invalid module name or namespace: %q", elem)
+		}
+	}
+	return namespace, nil
+}
+
+// scopedDir returns dir/<namespace>/<name> for the module.
+func scopedDir(dir string, module *ModuleInfo) (string, error) {
+	namespace, err := checkScope(module.Metadata.Namespace, module.Metadata.Name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, namespace, module.Metadata.Name), nil
+}
+
+// ModuleWorkspace returns the workspace directory of the module under the
+// root, which is root/<namespace>/<name>, so that two modules with the same
+// name in different namespaces do not share a workspace.
+func ModuleWorkspace(root string, module *ModuleInfo) (string, error) {
+	return scopedDir(root, module)
+}
+
+// WithWorkspaceRoot gives the module its own workspace under the root,
+// scoped by its namespace and name (see ModuleWorkspace). The workspace is
+// mounted at /workspace in the hooks and stages that do not mount a
+// workspace of their own, and is created when they run.
+func WithWorkspaceRoot(root string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.workspaceRoot = root
+	}
+}
+
+// hasWorkspace returns true if the image mounts a volume at /workspace.
+func hasWorkspace(info ImageInfo) bool {
+	for _, v := range info.Volumes {
+		if v.MountPath == "/workspace" {
+			return true
+		}
+	}
+	return false
+}
+
+// withWorkspace mounts the workspace of the module in the image, unless the
+// image mounts its own, creating the directory if needed.
+func (m *DeployableModule) withWorkspace(img *ImageInfo) error {
+	if len(m.workspaceRoot) == 0 || hasWorkspace(*img) {
+		return nil
+	}
+	dir, err := ModuleWorkspace(m.workspaceRoot, m.module)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	img.Volumes = append(img.Volumes, VolumeInfo{Name: dir, MountPath: "/workspace"})
+	return nil
+}
+
+// workspace returns the local directory used as the workspace of the deploy
+// stage of the module, if any.
+func (m *DeployableModule) workspace() string {
+	if len(m.workspaceRoot) > 0 && !hasWorkspace(m.module.Specifications.Lifecycle.Deploy) {
+		if dir, err := ModuleWorkspace(m.workspaceRoot, m.module); err == nil {
+			return dir
+		}
+	}
+	return workspaceOf(m.module)
+}
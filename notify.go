@@ -0,0 +1,229 @@
+package atkmod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// DefaultNotifierTimeout is how long a deployment waits for each
+// DeploymentNotifier to send its notification.
+const DefaultNotifierTimeout = 10 * time.Second
+
+// Notification tells the user that a deployment has finished, either in the
+// Done or in the Errored state.
+type Notification struct {
+	Module      string        `json:"module" yaml:"module"`
+	Namespace   string        `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	RunID       string        `json:"runId" yaml:"runId"`
+	State       State         `json:"state" yaml:"state"`
+	Succeeded   bool          `json:"succeeded" yaml:"succeeded"`
+	FailedState State         `json:"failedState,omitempty" yaml:"failedState,omitempty"`
+	Error       string        `json:"error,omitempty" yaml:"error,omitempty"`
+	Duration    time.Duration `json:"duration" yaml:"duration"`
+}
+
+// NewNotification returns the Notification for the result of a deployment.
+func NewNotification(result *DeploymentResult) Notification {
+	return Notification{
+		Module:      result.Module,
+		Namespace:   result.Namespace,
+		RunID:       result.RunID,
+		State:       result.State,
+		Succeeded:   result.Succeeded(),
+		FailedState: result.FailedState,
+		Error:       result.Error,
+		Duration:    result.Duration(),
+	}
+}
+
+// Title is the short summary of the notification.
+func (n Notification) Title() string {
+	if n.Succeeded {
+		return fmt.Sprintf("Module %s deployed", n.Module)
+	}
+	if n.State == Cancelled {
+		return fmt.Sprintf("Module %s cancelled", n.Module)
+	}
+	return fmt.Sprintf("Module %s failed", n.Module)
+}
+
+// Message is the text of the notification.
+func (n Notification) Message() string {
+	duration := n.Duration.Round(time.Second)
+	if n.Succeeded {
+		return fmt.Sprintf("The deployment of module %s finished in %s (run %s).", n.Module, duration, n.RunID)
+	}
+	return fmt.Sprintf("The deployment of module %s failed in state %s after %s (run %s): %s",
+		n.Module, n.FailedState, duration, n.RunID, n.Error)
+}
+
+// DeploymentNotifier sends a Notification when a deployment driven by Deploy
+// finishes, so that the users of long deployments do not have to watch them.
+type DeploymentNotifier interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// WithNotifiers sends a Notification to each of the notifiers when the
+// deployment is Done or Errored. Errors sending a notification are logged
+// but do not fail the deployment.
+func WithNotifiers(notifiers ...DeploymentNotifier) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.notifiers = append(m.notifiers, notifiers...)
+	}
+}
+
+// notify sends the notification for the result to the notifiers of the
+// deployment, unless the deployment was suspended.
+func (m *DeployableModule) notify(ctx *RunContext, result *DeploymentResult) {
+	if len(m.notifiers) == 0 || (result.State != Done && result.State != Errored && len(result.Error) == 0) {
+		return
+	}
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	n := NewNotification(result)
+	for _, notifier := range m.notifiers {
+		sendCtx, cancel := context.WithTimeout(parent, DefaultNotifierTimeout)
+		err := notifier.Send(sendCtx, n)
+		cancel()
+		if err != nil {
+			ctx.Log.WithField(RunIDLogField, m.runID).Warnf("could not send the notification of the deployment: %v", err)
+		}
+	}
+}
+
+// DesktopNotifier shows the notification on the desktop with notify-send on
+// Linux, osascript on macOS and PowerShell on Windows.
+type DesktopNotifier struct {
+	// OS is the operating system, which is runtime.GOOS if empty.
+	OS string
+}
+
+// Command returns the command that shows the notification.
+func (d *DesktopNotifier) Command(ctx context.Context, n Notification) (*exec.Cmd, error) {
+	goos := Iif(d.OS, runtime.GOOS)
+	switch goos {
+	case "linux", "freebsd", "openbsd":
+		urgency := "normal"
+		if !n.Succeeded {
+			urgency = "critical"
+		}
+		return exec.CommandContext(ctx, "notify-send", "--app-name=atk", "--urgency="+urgency, n.Title(), n.Message()), nil
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(n.Message()), appleScriptString(n.Title()))
+		return exec.CommandContext(ctx, "osascript", "-e", script), nil
+	case "windows":
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms, System.Drawing; `+
+			`$n = New-Object System.Windows.Forms.NotifyIcon; `+
+			`$n.Icon = [System.Drawing.SystemIcons]::Information; $n.Visible = $true; `+
+			`$n.ShowBalloonTip(10000, %s, %s, 'Info'); Start-Sleep -Seconds 1`,
+			powerShellString(n.Title()), powerShellString(n.Message()))
+		return exec.CommandContext(ctx, "powershell", "-NoProfile", "-Command", script), nil
+	default:
+		return nil, fmt.Errorf("desktop notifications are not supported on %s", goos)
+	}
+}
+
+// Send shows the notification.
+func (d *DesktopNotifier) Send(ctx context.Context, n Notification) error {
+	cmd, err := d.Command(ctx, n)
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not show the desktop notification: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func powerShellString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// SlackNotifier posts the notification to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+// NewSlackNotifier creates a SlackNotifier that posts to the webhook URL,
+// through the proxy and with the TLS configuration of the DefaultConfig.
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{WebhookURL: webhookURL, Client: newHTTPClient(DefaultNotifierTimeout)}
+}
+
+// Send posts the notification as the text of a Slack message.
+func (s *SlackNotifier) Send(ctx context.Context, n Notification) error {
+	emoji := ":white_check_mark:"
+	if !n.Succeeded {
+		emoji = ":x:"
+	}
+	text := fmt.Sprintf("%s *%s*\n%s", emoji, n.Title(), n.Message())
+	return postJSON(ctx, s.Client, s.WebhookURL, nil, map[string]string{"text": text})
+}
+
+// WebhookNotifier POSTs the notification as JSON to a URL.
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// NewWebhookNotifier creates a WebhookNotifier that POSTs to the URL,
+// through the proxy and with the TLS configuration of the DefaultConfig.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:     url,
+		Headers: make(map[string]string),
+		Client:  newHTTPClient(DefaultNotifierTimeout),
+	}
+}
+
+// Send POSTs the notification and returns an error if the response is not
+// a 2xx.
+func (w *WebhookNotifier) Send(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.Client, w.URL, w.Headers, n)
+}
+
+// postJSON POSTs the value as JSON to the URL and returns an error if the
+// response is not a 2xx.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned status %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package atkmod
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// OutputStream identifies the output or the error stream of a stage.
+type OutputStream string
+
+// The streams of a stage.
+const (
+	Stdout OutputStream = "stdout"
+	Stderr OutputStream = "stderr"
+)
+
+// LineFunc is called with each line of the output of a lifecycle stage as
+// soon as it is written, without the line ending. If it returns an error, the
+// stage is stopped and fails with a StageAbortedError.
+type LineFunc func(state State, stream OutputStream, line string) error
+
+// StageAbortedError is returned when a stage was stopped because a LineFunc
+// returned an error for one of its lines.
+type StageAbortedError struct {
+	State  State
+	Stream OutputStream
+	Line   string
+	Err    error
+}
+
+func (e *StageAbortedError) Error() string {
+	return fmt.Sprintf("stage %s was aborted on %s line %q: %v", e.State, e.Stream, e.Line, e.Err)
+}
+
+func (e *StageAbortedError) Unwrap() error {
+	return e.Err
+}
+
+// StageOutput is the output and error streams of a lifecycle stage that were
+// captured during a deployment.
+type StageOutput struct {
+	State  State
+	Stdout *SpoolBuffer
+	Stderr *SpoolBuffer
+}
+
+// Close removes the temporary files of the captured streams.
+func (o *StageOutput) Close() error {
+	err := o.Stdout.Close()
+	if serr := o.Stderr.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// WithCapturedOutput captures the output and error streams of the lifecycle
+// stages of the deployment, while still writing them to the streams of the
+// context, so they can be read with Output once the stage has run. Each
+// stream keeps up to memoryLimit bytes in memory before spilling to a
+// temporary file; if memoryLimit is zero or less, DefaultSpoolMemoryLimit is
+// used. The temporary files are removed by CloseOutputs.
+func WithCapturedOutput(memoryLimit int) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.captureOutput = true
+		m.outputLimit = memoryLimit
+	}
+}
+
+// Output returns the captured output of the lifecycle stage that runs in the
+// given state, such as Deploying, or nil if the stage has not run or the
+// output is not captured.
+func (m *DeployableModule) Output(state State) *StageOutput {
+	return m.outputs[state]
+}
+
+// CloseOutputs removes the temporary files of all of the captured output.
+func (m *DeployableModule) CloseOutputs() error {
+	var err error
+	for _, output := range m.outputs {
+		if cerr := output.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// WithLineCallback calls fn with each line of the output and error streams of
+// the lifecycle stages while they run, in addition to writing them to the
+// streams of the context and capturing them. The lines of each stream are
+// passed in order, but the lines of the two streams may be interleaved.
+func WithLineCallback(fn LineFunc) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.lineFunc = fn
+	}
+}
+
+// runStage runs the image of the lifecycle stage in the given state,
+// capturing its output and passing its lines to the line callback if the
+// deployment is configured to.
+func (m *DeployableModule) runStage(ctx *RunContext, state State, info ImageInfo) error {
+	prevOut, prevErr, prevContext := ctx.Out, ctx.Err, ctx.Context
+	errCount := len(ctx.Errors)
+	defer func() {
+		ctx.Out, ctx.Err, ctx.Context = prevOut, prevErr, prevContext
+	}()
+	defer m.collectArtifacts(ctx, state, info)
+	restoreOwner, err := m.runStageAs(ctx, state, info)
+	if err != nil {
+		ctx.AddError(err)
+		return err
+	}
+	defer restoreOwner()
+
+	scanners, err := compileScanners(state, info.Scanners)
+	if err != nil {
+		ctx.AddError(err)
+		return err
+	}
+	if ctx.Verbosity == VerbositySilent {
+		// The output is still captured and passed to the line callback,
+		// which tee off of these streams.
+		ctx.Out, ctx.Err = io.Discard, io.Discard
+	}
+	defer m.decorateStage(ctx, state)()
+	if m.captureOutput {
+		m.captureStage(ctx, state)
+	}
+	fn := m.lineFunc
+	if len(scanners) > 0 {
+		fn = chainLineFuncs(m.scanLine(scanners), m.lineFunc)
+	}
+	ctx.Context = withContainerName(ctx.Context, m.containerName(state))
+	m.setRunning(state)
+	defer m.setRunning("")
+	if fn == nil {
+		err = m.runImage(ctx, string(state), info)
+		return m.suspendedOr(ctx, errCount, m.cancelledOr(ctx, errCount, state, err))
+	}
+
+	lines := newLineStreamer(ctx, state, fn)
+	err = m.runImage(ctx, string(state), info)
+	aborted := lines.close()
+	if interrupted := m.suspendedOr(ctx, errCount, m.cancelledOr(ctx, errCount, state, nil)); interrupted != nil {
+		return interrupted
+	}
+	if errors.Is(aborted, errStageComplete) {
+		// The container was stopped because a scanner found that the stage
+		// is complete, so the error of the runner is expected.
+		ctx.Errors = ctx.Errors[:errCount]
+		ctx.Reset()
+		return nil
+	}
+	if aborted != nil {
+		ctx.AddError(aborted)
+		return aborted
+	}
+	return err
+}
+
+// chainLineFuncs returns a LineFunc that calls each of the non nil funcs in
+// turn, stopping at the first error.
+func chainLineFuncs(fns ...LineFunc) LineFunc {
+	return func(state State, stream OutputStream, line string) error {
+		for _, fn := range fns {
+			if fn == nil {
+				continue
+			}
+			if err := fn(state, stream, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// captureStage replaces the streams of the context with streams that also
+// capture the output of the stage.
+func (m *DeployableModule) captureStage(ctx *RunContext, state State) {
+	if prev := m.outputs[state]; prev != nil {
+		prev.Close()
+	}
+	output := &StageOutput{
+		State:  state,
+		Stdout: NewSpoolBuffer(m.outputLimit),
+		Stderr: NewSpoolBuffer(m.outputLimit),
+	}
+	m.outputs[state] = output
+	ctx.Out = teeWriter(ctx.Out, output.Stdout)
+	ctx.Err = teeWriter(ctx.Err, output.Stderr)
+}
+
+// lineStreamer passes the lines written to the streams of a context to a
+// LineFunc through pipes, and cancels the context of the RunContext when the
+// LineFunc returns an error so the running command is stopped.
+type lineStreamer struct {
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	writers []*io.PipeWriter
+	cancel  context.CancelFunc
+	aborted *StageAbortedError
+}
+
+func newLineStreamer(ctx *RunContext, state State, fn LineFunc) *lineStreamer {
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	l := &lineStreamer{}
+	ctx.Context, l.cancel = context.WithCancel(parent)
+	ctx.Out = teeWriter(ctx.Out, l.stream(state, Stdout, fn))
+	ctx.Err = teeWriter(ctx.Err, l.stream(state, Stderr, fn))
+	return l
+}
+
+// stream returns a writer that passes the lines written to it to fn. Once fn
+// has failed, the rest of the output is read and discarded so the writers
+// are never blocked.
+func (l *lineStreamer) stream(state State, stream OutputStream, fn LineFunc) io.Writer {
+	pr, pw := io.Pipe()
+	l.writers = append(l.writers, pw)
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		reader := bufio.NewReader(pr)
+		for {
+			line, err := reader.ReadString('\n')
+			if len(line) > 0 && !l.isAborted() {
+				line = strings.TrimRight(line, "\r\n")
+				if ferr := fn(state, stream, line); ferr != nil {
+					l.abort(&StageAbortedError{State: state, Stream: stream, Line: line, Err: ferr})
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return pw
+}
+
+func (l *lineStreamer) isAborted() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.aborted != nil
+}
+
+func (l *lineStreamer) abort(err *StageAbortedError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.aborted == nil {
+		l.aborted = err
+		l.cancel()
+	}
+}
+
+// close waits until all of the lines have been passed to the LineFunc and
+// returns the error of the LineFunc, if it failed.
+func (l *lineStreamer) close() error {
+	for _, pw := range l.writers {
+		pw.Close()
+	}
+	l.wg.Wait()
+	l.cancel()
+	if l.aborted != nil {
+		return l.aborted
+	}
+	return nil
+}
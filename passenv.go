@@ -0,0 +1,60 @@
+package atkmod
+
+import "strings"
+
+// podmanEnvPrefixes are the prefixes of the names of the environment
+// variables that podman reads itself, which are passed on the command line
+// even with PassEnv, so that they do not change how podman runs.
+var podmanEnvPrefixes = []string{"CONTAINER", "PODMAN", "BUILDAH", "STORAGE_", "XDG_", "LD_", "DOCKER_"}
+
+// podmanEnvNames are the names of the other environment variables that
+// podman reads itself.
+var podmanEnvNames = map[string]bool{
+	"PATH":                     true,
+	"HOME":                     true,
+	"USER":                     true,
+	"TMPDIR":                   true,
+	"REGISTRY_AUTH_FILE":       true,
+	"DBUS_SESSION_BUS_ADDRESS": true,
+	"SSH_AUTH_SOCK":            true,
+}
+
+// WithPassEnv passes the values of the environment variables to podman in
+// its environment, with -e NAME, instead of on the command line. The
+// variables that podman reads itself, such as PATH, HOME and
+// CONTAINER_HOST, are still passed with their values, so that they do not
+// change how podman runs.
+func (b *PodmanCliCommandBuilder) WithPassEnv() *PodmanCliCommandBuilder {
+	b.parts.PassEnv = true
+	return b
+}
+
+// BuildEnv returns the NAME=value of the environment variables that are
+// passed to podman in its environment, with PassEnv or as secrets, which the runner adds to
+// the environment of the command of BuildArgs, or nil if there are none.
+func (b *PodmanCliCommandBuilder) BuildEnv() []string {
+	var env []string
+	for _, e := range b.parts.Envvars {
+		if b.parts.passEnv(e) {
+			env = append(env, e.Name+"="+e.Value)
+		}
+	}
+	return env
+}
+
+// passEnv returns true if the environment variable is passed to podman in
+// its environment, which the secrets always are.
+func (p *CliParts) passEnv(e EnvVarInfo) bool {
+	if e.Secret {
+		return true
+	}
+	if !p.PassEnv || podmanEnvNames[e.Name] {
+		return false
+	}
+	for _, prefix := range podmanEnvPrefixes {
+		if strings.HasPrefix(e.Name, prefix) {
+			return false
+		}
+	}
+	return true
+}
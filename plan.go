@@ -0,0 +1,185 @@
+package atkmod
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnvVarSource is where the value of an environment variable of an image
+// comes from.
+type EnvVarSource string
+
+const (
+	// EnvFromManifest is a variable with a value in the manifest.
+	EnvFromManifest EnvVarSource = "manifest"
+	// EnvFromInput is a variable without a value in the manifest, which is
+	// set from the variables that are given to the deployment, such as the
+	// ones returned by the list hook.
+	EnvFromInput EnvVarSource = "input"
+	// EnvFromDeployment is a variable that is set by the deployment itself,
+	// such as ATK_RUN_ID.
+	EnvFromDeployment EnvVarSource = "deployment"
+)
+
+// PlannedEnvVar is an environment variable of a planned image. The value is
+// not included, as it may be a secret.
+type PlannedEnvVar struct {
+	Name   string       `json:"name" yaml:"name"`
+	Source EnvVarSource `json:"source" yaml:"source"`
+}
+
+// PlannedImage is a hook or lifecycle stage that will run for a deployment.
+type PlannedImage struct {
+	// Name is the name of the hook or stage in the manifest, such as
+	// pre_deploy.
+	Name string `json:"name" yaml:"name"`
+	// State is the state that a lifecycle stage runs in. It is empty for
+	// the hooks.
+	State   State           `json:"state,omitempty" yaml:"state,omitempty"`
+	Image   string          `json:"image,omitempty" yaml:"image,omitempty"`
+	Script  string          `json:"script,omitempty" yaml:"script,omitempty"`
+	Command []string        `json:"command,omitempty" yaml:"command,omitempty"`
+	Args    []string        `json:"args,omitempty" yaml:"args,omitempty"`
+	Env     []PlannedEnvVar `json:"env,omitempty" yaml:"env,omitempty"`
+	Volumes []VolumeInfo    `json:"volumeMounts,omitempty" yaml:"volumeMounts,omitempty"`
+}
+
+// Defined returns true if the manifest has an image or script for it.
+func (p PlannedImage) Defined() bool {
+	return len(p.Image) > 0 || len(p.Script) > 0
+}
+
+// Plan describes what a deployment will run, much like `terraform plan`,
+// without running anything.
+type Plan struct {
+	Module    string `json:"module" yaml:"module"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	RunID     string `json:"runId" yaml:"runId"`
+	// Stages are the lifecycle stages in the order that they run.
+	Stages []PlannedImage `json:"stages" yaml:"stages"`
+	Hooks  []PlannedImage `json:"hooks" yaml:"hooks"`
+	// Pulls are the images that podman may have to pull, in the order that
+	// they are first used. Images that are already present are not pulled,
+	// so this is an estimate.
+	Pulls []string `json:"pulls,omitempty" yaml:"pulls,omitempty"`
+	// Violations are the volumes that the mount policy of the deployment
+	// denies, which stop the deployment before anything runs.
+	Violations []MountViolation `json:"violations,omitempty" yaml:"violations,omitempty"`
+}
+
+// Plan returns what the deployment will run, with the lifecycle stages in
+// the execution order of the deployment.
+func (m *DeployableModule) Plan() *Plan {
+	plan := &Plan{
+		Module:    m.module.Metadata.Name,
+		Namespace: m.module.Metadata.Namespace,
+		RunID:     m.runID,
+	}
+	images := stageImages(m.module)
+	for _, state := range m.machine.Order() {
+		for _, img := range images {
+			if len(img.State) > 0 && img.State == state {
+				plan.Stages = append(plan.Stages, newPlannedImage(img))
+			}
+		}
+	}
+	for _, img := range images {
+		// The info hook is optional, so it is only planned if it is defined.
+		if img.Path == "spec.hooks.info" && img.Info.Equal(ImageInfo{}) {
+			continue
+		}
+		if len(img.State) == 0 {
+			plan.Hooks = append(plan.Hooks, newPlannedImage(img))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range append(append([]PlannedImage{}, plan.Hooks...), plan.Stages...) {
+		if len(p.Image) > 0 && !seen[p.Image] {
+			seen[p.Image] = true
+			plan.Pulls = append(plan.Pulls, p.Image)
+		}
+	}
+	plan.Violations = m.mountPolicy.Check(m.module)
+	return plan
+}
+
+func newPlannedImage(img stageImage) PlannedImage {
+	p := PlannedImage{
+		Name:    img.Path[strings.LastIndex(img.Path, ".")+1:],
+		State:   img.State,
+		Image:   img.Info.Image,
+		Script:  img.Info.Script,
+		Command: img.Info.Command,
+		Args:    img.Info.Args,
+		Volumes: img.Info.Volumes,
+	}
+	if !p.Defined() {
+		return p
+	}
+	hasRunID := false
+	for _, e := range img.Info.EnvVars {
+		source := EnvFromManifest
+		switch {
+		case e.Name == RunIDEnvVar:
+			source, hasRunID = EnvFromDeployment, true
+		case len(e.Value) == 0:
+			source = EnvFromInput
+		}
+		p.Env = append(p.Env, PlannedEnvVar{Name: e.Name, Source: source})
+	}
+	if !hasRunID {
+		p.Env = append(p.Env, PlannedEnvVar{Name: RunIDEnvVar, Source: EnvFromDeployment})
+	}
+	return p
+}
+
+// Explain returns a human-readable description of what the deployment will
+// run, which is the same as the document returned by Plan.
+func (m *DeployableModule) Explain() string {
+	return m.Plan().String()
+}
+
+// String returns the plan as a human-readable description.
+func (p *Plan) String() string {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "Module: %s (namespace: %s)\n", p.Module, p.Namespace)
+	fmt.Fprintln(b, "Lifecycle, in the order that it runs:")
+	for _, s := range p.Stages {
+		writePlannedImage(b, s)
+	}
+	fmt.Fprintln(b, "Hooks:")
+	for _, h := range p.Hooks {
+		writePlannedImage(b, h)
+	}
+	if len(p.Pulls) > 0 {
+		fmt.Fprintf(b, "Images that may be pulled: %d\n", len(p.Pulls))
+		for _, image := range p.Pulls {
+			fmt.Fprintf(b, "  %s\n", image)
+		}
+	}
+	if len(p.Violations) > 0 {
+		fmt.Fprintln(b, "Mounts that are not allowed:")
+		for _, v := range p.Violations {
+			fmt.Fprintf(b, "  %s\n", v)
+		}
+	}
+	return b.String()
+}
+
+func writePlannedImage(b *strings.Builder, p PlannedImage) {
+	if !p.Defined() {
+		fmt.Fprintf(b, "  %-12s (not defined)\n", p.Name)
+		return
+	}
+	fmt.Fprintf(b, "  %-12s %s\n", p.Name, Iif(p.Image, p.Script))
+	if len(p.Command) > 0 || len(p.Args) > 0 {
+		fmt.Fprintf(b, "  %-12s   command: %s\n", "", strings.Join(append(append([]string{}, p.Command...), p.Args...), " "))
+	}
+	for _, v := range p.Volumes {
+		fmt.Fprintf(b, "  %-12s   volume: %s -> %s\n", "", v.Name, v.MountPath)
+	}
+	for _, e := range p.Env {
+		fmt.Fprintf(b, "  %-12s   env: %s (from %s)\n", "", e.Name, e.Source)
+	}
+}
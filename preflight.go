@@ -0,0 +1,425 @@
+package atkmod
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPreflightTimeout is how long Preflight waits for a tool to
+	// report its version or for an endpoint to accept a connection.
+	DefaultPreflightTimeout = 10 * time.Second
+)
+
+// RequiresInfo declares what the host needs in order to deploy the module,
+// which is checked by Preflight before anything runs.
+type RequiresInfo struct {
+	// Tools are the command line tools that must be installed.
+	Tools []ToolRequirement `json:"tools,omitempty" yaml:"tools,omitempty"`
+	// DiskSpace is the free disk space needed in the workspace of the
+	// module, such as 10Gi or 500MB.
+	DiskSpace string `json:"diskSpace,omitempty" yaml:"diskSpace,omitempty"`
+	// Endpoints are the host:port addresses or the URLs that must be
+	// reachable, such as the registry of the images.
+	Endpoints []string `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+}
+
+// Equal returns true if the two requirements have the same values.
+func (r RequiresInfo) Equal(other RequiresInfo) bool {
+	if len(r.Tools) != len(other.Tools) {
+		return false
+	}
+	for idx := range r.Tools {
+		if r.Tools[idx] != other.Tools[idx] {
+			return false
+		}
+	}
+	return r.DiskSpace == other.DiskSpace && equalStrings(r.Endpoints, other.Endpoints)
+}
+
+// ToolRequirement is a command line tool that the module needs.
+type ToolRequirement struct {
+	Name string `json:"name" yaml:"name"`
+	// Version is the version that is needed, such as ">= 4.0" or "4.x". A
+	// version without an operator is the minimum version, and x stands for
+	// any number. The version of the tool is read from the output of
+	// "<name> --version".
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// PreflightCheck is the outcome of checking a single requirement.
+type PreflightCheck struct {
+	// Requirement describes what was checked, such as "podman >= 4.0".
+	Requirement string `json:"requirement" yaml:"requirement"`
+	Passed      bool   `json:"passed" yaml:"passed"`
+	Message     string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+func (c PreflightCheck) String() string {
+	if len(c.Message) == 0 {
+		return c.Requirement
+	}
+	return fmt.Sprintf("%s: %s", c.Requirement, c.Message)
+}
+
+// PreflightResult has the outcome of each of the requirements of a module.
+type PreflightResult struct {
+	Checks []PreflightCheck `json:"checks" yaml:"checks"`
+}
+
+// Passed returns true if all of the requirements are met.
+func (r *PreflightResult) Passed() bool {
+	return len(r.Failures()) == 0
+}
+
+// Failures returns the checks of the requirements that are not met.
+func (r *PreflightResult) Failures() []PreflightCheck {
+	var failures []PreflightCheck
+	for _, c := range r.Checks {
+		if !c.Passed {
+			failures = append(failures, c)
+		}
+	}
+	return failures
+}
+
+// PreflightError is returned when the host does not meet the requirements of
+// the module.
+type PreflightError struct {
+	Module   string
+	Failures []PreflightCheck
+}
+
+func (e *PreflightError) Error() string {
+	problems := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		problems = append(problems, f.String())
+	}
+	return fmt.Sprintf("the host does not meet the requirements of module %s: %s", e.Module, strings.Join(problems, "; "))
+}
+
+// Preflight checks that the host meets the requirements in spec.requires of
+// the module: that the tools are installed in the needed versions, that there
+// is enough free disk space in the workspace and that the endpoints are
+// reachable. All of the requirements are checked, and a PreflightError with
+// the failures is returned along with the result if any of them are not met.
+// Deploy runs Preflight before anything else.
+func (m *DeployableModule) Preflight(ctx *RunContext) (*PreflightResult, error) {
+	result := &PreflightResult{Checks: make([]PreflightCheck, 0)}
+	requires := m.module.Specifications.Requires
+	if requires == nil {
+		return result, nil
+	}
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	for _, tool := range requires.Tools {
+		result.Checks = append(result.Checks, checkTool(parent, tool))
+	}
+	if len(requires.DiskSpace) > 0 {
+		result.Checks = append(result.Checks, checkDiskSpace(m.workspace(), requires.DiskSpace))
+	}
+	for _, endpoint := range requires.Endpoints {
+		result.Checks = append(result.Checks, checkEndpoint(parent, endpoint))
+	}
+
+	log := ctx.Log.WithField(RunIDLogField, m.runID)
+	for _, c := range result.Checks {
+		if c.Passed {
+			log.Debugf("preflight check passed: %s", c)
+		} else {
+			log.Debugf("preflight check failed: %s", c)
+		}
+	}
+	if failures := result.Failures(); len(failures) > 0 {
+		return result, &PreflightError{Module: m.module.Metadata.Name, Failures: failures}
+	}
+	return result, nil
+}
+
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+|\d+`)
+
+func checkTool(parent context.Context, tool ToolRequirement) PreflightCheck {
+	check := PreflightCheck{Requirement: strings.TrimSpace(tool.Name + " " + tool.Version)}
+	path, err := exec.LookPath(tool.Name)
+	if err != nil {
+		check.Message = "not found"
+		return check
+	}
+	if len(tool.Version) == 0 {
+		check.Passed = true
+		return check
+	}
+	constraint, err := parseVersionConstraint(tool.Version)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(parent, DefaultPreflightTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		check.Message = fmt.Sprintf("could not get the version: %v", err)
+		return check
+	}
+	found := versionPattern.FindString(string(out))
+	if len(found) == 0 {
+		check.Message = fmt.Sprintf("could not find the version in %q", strings.TrimSpace(string(out)))
+		return check
+	}
+	version, _ := parseVersion(found)
+	check.Passed = constraint.matches(version)
+	if !check.Passed {
+		check.Message = fmt.Sprintf("found version %s", found)
+	}
+	return check
+}
+
+// versionConstraint is a parsed ToolRequirement.Version.
+type versionConstraint struct {
+	op      string
+	version []int
+}
+
+var constraintOps = []string{">=", "<=", "==", ">", "<", "="}
+
+func parseVersionConstraint(s string) (versionConstraint, error) {
+	s = strings.TrimSpace(s)
+	c := versionConstraint{op: ">="}
+	for _, op := range constraintOps {
+		if strings.HasPrefix(s, op) {
+			c.op, s = op, strings.TrimSpace(s[len(op):])
+			break
+		}
+	}
+	if c.op == "==" {
+		c.op = "="
+	}
+	s = strings.TrimPrefix(s, "v")
+	// The wildcards only stand for the rest of the version, so the version
+	// is compared up to the first one.
+	parts := strings.Split(s, ".")
+	for idx, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			if idx == 0 {
+				return c, fmt.Errorf("invalid version %q", s)
+			}
+			parts = parts[:idx]
+			break
+		}
+	}
+	version, err := parseVersion(strings.Join(parts, "."))
+	if err != nil {
+		return c, err
+	}
+	c.version = version
+	return c, nil
+}
+
+func parseVersion(s string) ([]int, error) {
+	parts := strings.Split(s, ".")
+	version := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		version = append(version, n)
+	}
+	return version, nil
+}
+
+// matches compares the version with the version of the constraint, up to
+// the number of parts of the constraint, so 4.5.1 is = 4.x and = 4.5.
+func (c versionConstraint) matches(version []int) bool {
+	cmp := 0
+	for idx, want := range c.version {
+		got := 0
+		if idx < len(version) {
+			got = version[idx]
+		}
+		if got != want {
+			cmp = 1
+			if got < want {
+				cmp = -1
+			}
+			break
+		}
+	}
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "=":
+		return cmp == 0
+	default:
+		return cmp >= 0
+	}
+}
+
+var sizeUnits = map[string]uint64{
+	"":   1,
+	"B":  1,
+	"K":  1000,
+	"KB": 1000,
+	"M":  1000 * 1000,
+	"MB": 1000 * 1000,
+	"G":  1000 * 1000 * 1000,
+	"GB": 1000 * 1000 * 1000,
+	"T":  1000 * 1000 * 1000 * 1000,
+	"TB": 1000 * 1000 * 1000 * 1000,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+}
+
+var sizePattern = regexp.MustCompile(`^(\d+)\s*([A-Za-z]*)$`)
+
+// ParseSize parses a size such as 10Gi, 500MB or 1024 into bytes. The units
+// with an i, such as Gi, are powers of 1024 and the others powers of 1000.
+func ParseSize(s string) (uint64, error) {
+	match := sizePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit := match[2]
+	if strings.HasSuffix(unit, "iB") {
+		unit = strings.TrimSuffix(unit, "B")
+	}
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %s", s, match[2])
+	}
+	n, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	return n * multiplier, nil
+}
+
+func checkDiskSpace(workspace string, size string) PreflightCheck {
+	check := PreflightCheck{Requirement: fmt.Sprintf("%s of free disk space", size)}
+	needed, err := ParseSize(size)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	dir := existingDir(workspace)
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		check.Message = fmt.Sprintf("could not get the free disk space of %s: %v", dir, err)
+		return check
+	}
+	check.Passed = free >= needed
+	if !check.Passed {
+		check.Message = fmt.Sprintf("%s has %d bytes free", dir, free)
+	}
+	return check
+}
+
+// existingDir returns the directory, or its closest parent that exists, as
+// the workspace may not have been created yet.
+func existingDir(dir string) string {
+	if len(dir) == 0 {
+		dir = "."
+	}
+	dir, _ = filepath.Abs(dir)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+func checkEndpoint(parent context.Context, endpoint string) PreflightCheck {
+	check := PreflightCheck{Requirement: fmt.Sprintf("%s is reachable", endpoint)}
+	address, err := endpointAddress(endpoint)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	ctx, cancel := context.WithTimeout(parent, DefaultPreflightTimeout)
+	defer cancel()
+	conn, err := new(net.Dialer).DialContext(ctx, "tcp", address)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	conn.Close()
+	check.Passed = true
+	return check
+}
+
+// endpointAddress returns the host:port of the endpoint, which is either a
+// URL, a host:port or a host, such as a registry, which is reached on 443.
+func endpointAddress(endpoint string) (string, error) {
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", err
+		}
+		port := u.Port()
+		if len(port) == 0 {
+			port = "443"
+			if u.Scheme == "http" {
+				port = "80"
+			}
+		}
+		return net.JoinHostPort(u.Hostname(), port), nil
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err == nil {
+		return endpoint, nil
+	}
+	if len(endpoint) == 0 {
+		return "", fmt.Errorf("empty endpoint")
+	}
+	return net.JoinHostPort(endpoint, "443"), nil
+}
+
+// validate returns the problems with the requirements that can be found
+// without checking the host.
+func (r *RequiresInfo) validate() []string {
+	var problems []string
+	for idx, tool := range r.Tools {
+		if len(strings.TrimSpace(tool.Name)) == 0 {
+			problems = append(problems, fmt.Sprintf("tools[%d] has no name", idx))
+		}
+		if len(tool.Version) > 0 {
+			if _, err := parseVersionConstraint(tool.Version); err != nil {
+				problems = append(problems, fmt.Sprintf("tools[%d].version: %v", idx, err))
+			}
+		}
+	}
+	if len(r.DiskSpace) > 0 {
+		if _, err := ParseSize(r.DiskSpace); err != nil {
+			problems = append(problems, fmt.Sprintf("diskSpace: %v", err))
+		}
+	}
+	for idx, endpoint := range r.Endpoints {
+		if _, err := endpointAddress(endpoint); err != nil {
+			problems = append(problems, fmt.Sprintf("endpoints[%d]: %v", idx, err))
+		}
+	}
+	return problems
+}
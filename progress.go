@@ -0,0 +1,204 @@
+package atkmod
+
+import (
+	"sync"
+	"time"
+)
+
+// Progress is an estimate of how far a deployment has progressed.
+type Progress struct {
+	Module string
+	RunID  string
+	// State is the state that the deployment is in.
+	State State
+	// Percent is the estimated percentage of the deployment that is
+	// complete, from 0 to 100.
+	Percent float64
+	// Elapsed is the time since the deployment started.
+	Elapsed time.Duration
+}
+
+// ProgressReporter is notified of the progress of a deployment that is driven
+// by Deploy, each time that the deployment moves to another state.
+type ProgressReporter interface {
+	Progress(p Progress)
+}
+
+// ProgressFunc is an adapter to use an ordinary function as a
+// ProgressReporter.
+type ProgressFunc func(p Progress)
+
+// Progress calls f(p).
+func (f ProgressFunc) Progress(p Progress) {
+	f(p)
+}
+
+// StageTiming is how long a deployment spent in one of its states.
+type StageTiming struct {
+	State    State         `json:"state" yaml:"state"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+}
+
+// StageWeights are the relative amounts of time that a deployment is expected
+// to spend in each of its states.
+type StageWeights map[State]float64
+
+// DefaultStageWeights are the weights used when there is no history for the
+// module. The states that run an image are expected to take much longer than
+// the states that only move the deployment along.
+var DefaultStageWeights = StageWeights{
+	PreDeploying:  10,
+	Deploying:     30,
+	PostDeploying: 10,
+}
+
+// defaultStageWeight is the weight of the states that are not in the
+// weights, which is one second for the weights estimated from the history.
+const defaultStageWeight = 1
+
+// EstimateStageWeights returns the average time spent in each state by the
+// given deployments, in seconds. If the history has no timings at all,
+// DefaultStageWeights are returned.
+func EstimateStageWeights(history []DeploymentResult) StageWeights {
+	totals := make(map[State]time.Duration)
+	counts := make(map[State]int)
+	for _, result := range history {
+		for _, timing := range result.Stages {
+			totals[timing.State] += timing.Duration
+			counts[timing.State]++
+		}
+	}
+	if len(totals) == 0 {
+		return DefaultStageWeights
+	}
+
+	weights := make(StageWeights, len(totals))
+	for state, total := range totals {
+		weights[state] = total.Seconds() / float64(counts[state])
+	}
+	return weights
+}
+
+// percentRange returns the percentage of the weight of the states in the
+// order that come before the given state, and the percentage of the weight
+// of the state itself.
+func (w StageWeights) percentRange(order []State, state State) (float64, float64) {
+	if state == Done {
+		return 100, 0
+	}
+	weightOf := func(s State) float64 {
+		if weight, ok := w[s]; ok {
+			return weight
+		}
+		return defaultStageWeight
+	}
+
+	var total, complete, own float64
+	seen := make(map[State]bool)
+	reached := false
+	for _, s := range order {
+		if seen[s] || s == Done {
+			continue
+		}
+		seen[s] = true
+		if s == state {
+			reached = true
+			own = weightOf(s)
+		}
+		total += weightOf(s)
+		if !reached {
+			complete += weightOf(s)
+		}
+	}
+	if total == 0 || !reached {
+		return 0, 0
+	}
+	return complete / total * 100, own / total * 100
+}
+
+// WithProgressReporter notifies the reporter of the progress of the
+// deployment when it is driven by Deploy. The progress is weighted with the
+// durations of the previous deployments of the module if the deployment has
+// a history, or with DefaultStageWeights if it does not.
+func WithProgressReporter(reporter ProgressReporter) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.progress = reporter
+	}
+}
+
+// progressTracker reports the progress of a single run of Deploy.
+type progressTracker struct {
+	mu       sync.Mutex
+	module   *DeployableModule
+	weights  StageWeights
+	started  time.Time
+	reported bool
+	state    State
+	percent  float64
+}
+
+// newProgressTracker creates a tracker for the deployment, weighting the
+// states with the durations of the previous deployments of the module if
+// the deployment has a history.
+func (m *DeployableModule) newProgressTracker(ctx *RunContext, started time.Time) *progressTracker {
+	t := &progressTracker{module: m, weights: DefaultStageWeights, started: started}
+	if m.progress == nil || m.history == nil {
+		return t
+	}
+	results, err := m.history.History(m.module)
+	if err != nil {
+		ctx.Logger().Debugf("could not load the history of module %s for the progress: %v", m.module.Metadata.Name, err)
+		return t
+	}
+	t.weights = EstimateStageWeights(results)
+	return t
+}
+
+// report notifies the progress reporter of the deployment, if it has one,
+// when the deployment has moved to another state. A deployment that failed
+// keeps the percentage of the last state that it reached.
+func (t *progressTracker) report() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := t.module
+	if m.progress == nil || (t.reported && t.state == m.machine.Current()) {
+		return
+	}
+	t.reported = true
+	t.state = m.machine.Current()
+	if !m.IsErrored() {
+		t.percent, _ = t.weights.percentRange(m.machine.Order(), m.machine.Current())
+	}
+	t.notify()
+}
+
+// reportWithin notifies the progress reporter that the current state is the
+// given percentage complete, such as when an output scanner matches a line
+// of the stage. The progress never goes backwards.
+func (t *progressTracker) reportWithin(percent float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := t.module
+	if m.progress == nil || m.IsErrored() {
+		return
+	}
+	start, width := t.weights.percentRange(m.machine.Order(), m.machine.Current())
+	if percent > 100 {
+		percent = 100
+	}
+	if overall := start + width*percent/100; overall > t.percent {
+		t.percent = overall
+		t.notify()
+	}
+}
+
+func (t *progressTracker) notify() {
+	m := t.module
+	m.progress.Progress(Progress{
+		Module:  m.module.Metadata.Name,
+		RunID:   m.runID,
+		State:   m.machine.Current(),
+		Percent: t.percent,
+		Elapsed: time.Since(t.started),
+	})
+}
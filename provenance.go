@@ -0,0 +1,183 @@
+package atkmod
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ProvenanceStatementType is the in-toto statement type of the
+	// provenance documents.
+	ProvenanceStatementType = "https://in-toto.io/Statement/v0.1"
+	// ProvenancePredicateType is the SLSA provenance predicate type that the
+	// provenance documents follow.
+	ProvenancePredicateType = "https://slsa.dev/provenance/v0.2"
+	// ProvenanceBuildType identifies a deployment of a module manifest.
+	ProvenanceBuildType = "https://github.com/cloud-native-toolkit/atkmod/deployment@v1"
+	// ProvenanceBuilderID identifies the library as the builder.
+	ProvenanceBuilderID = "https://github.com/cloud-native-toolkit/atkmod"
+)
+
+// DigestSet is a set of digests by algorithm, such as sha256.
+type DigestSet map[string]string
+
+// ProvenanceSubject is the manifest that was deployed.
+type ProvenanceSubject struct {
+	Name   string    `json:"name" yaml:"name"`
+	Digest DigestSet `json:"digest" yaml:"digest"`
+}
+
+// ProvenanceMaterial is an image that the deployment ran. The digest is
+// empty if it could not be resolved.
+type ProvenanceMaterial struct {
+	URI    string    `json:"uri" yaml:"uri"`
+	Digest DigestSet `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+// ProvenanceBuilder identifies what ran the deployment.
+type ProvenanceBuilder struct {
+	ID string `json:"id" yaml:"id"`
+}
+
+// ProvenanceInvocation has the names of the variables that were used and
+// the host that ran the deployment. The values of the variables are not
+// recorded, as they may be secrets.
+type ProvenanceInvocation struct {
+	Parameters  ProvenanceParameters  `json:"parameters" yaml:"parameters"`
+	Environment ProvenanceEnvironment `json:"environment" yaml:"environment"`
+}
+
+// ProvenanceParameters are the parameters of the deployment.
+type ProvenanceParameters struct {
+	RunID     string   `json:"runId" yaml:"runId"`
+	Variables []string `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// ProvenanceEnvironment describes the host that ran the deployment.
+type ProvenanceEnvironment struct {
+	Hostname string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	OS       string `json:"os" yaml:"os"`
+	Arch     string `json:"arch" yaml:"arch"`
+}
+
+// ProvenanceMetadata has the timestamps of the deployment.
+type ProvenanceMetadata struct {
+	BuildInvocationID string    `json:"buildInvocationId" yaml:"buildInvocationId"`
+	BuildStartedOn    time.Time `json:"buildStartedOn" yaml:"buildStartedOn"`
+	BuildFinishedOn   time.Time `json:"buildFinishedOn" yaml:"buildFinishedOn"`
+}
+
+// ProvenancePredicate is the SLSA provenance of a deployment.
+type ProvenancePredicate struct {
+	Builder    ProvenanceBuilder    `json:"builder" yaml:"builder"`
+	BuildType  string               `json:"buildType" yaml:"buildType"`
+	Invocation ProvenanceInvocation `json:"invocation" yaml:"invocation"`
+	Metadata   ProvenanceMetadata   `json:"metadata" yaml:"metadata"`
+	Materials  []ProvenanceMaterial `json:"materials,omitempty" yaml:"materials,omitempty"`
+}
+
+// Provenance is an in-toto statement with the SLSA provenance of a
+// successful deployment, for supply-chain audits. It can be marshalled to
+// JSON as is.
+type Provenance struct {
+	Type          string              `json:"_type" yaml:"_type"`
+	PredicateType string              `json:"predicateType" yaml:"predicateType"`
+	Subject       []ProvenanceSubject `json:"subject" yaml:"subject"`
+	Predicate     ProvenancePredicate `json:"predicate" yaml:"predicate"`
+}
+
+// WithProvenance generates the provenance of the deployment after it
+// succeeds and sets it in the DeploymentResult. The digests of the images
+// are resolved with the given resolver, or with ImageRefDigest if it is nil.
+func WithProvenance(digest DigestResolver) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		if digest == nil {
+			digest = ImageRefDigest
+		}
+		m.provenance = digest
+	}
+}
+
+// ManifestChecksum returns the sha256 checksum of the canonical form of the
+// manifest, so that it does not change with the formatting of the file.
+func ManifestChecksum(module *ModuleInfo) (string, error) {
+	content, err := module.Marshal()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// parseDigest splits a digest such as sha256:abcd into a DigestSet. It
+// returns nil if the value is not a digest.
+func parseDigest(value string) DigestSet {
+	idx := strings.Index(value, ":")
+	if idx <= 0 || idx == len(value)-1 || strings.ContainsAny(value, "/@") {
+		return nil
+	}
+	return DigestSet{value[:idx]: value[idx+1:]}
+}
+
+// newProvenance returns the provenance of the deployment with the result.
+func (m *DeployableModule) newProvenance(ctx *RunContext, result *DeploymentResult) (*Provenance, error) {
+	checksum, err := ManifestChecksum(m.module)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	p := &Provenance{
+		Type:          ProvenanceStatementType,
+		PredicateType: ProvenancePredicateType,
+		Subject: []ProvenanceSubject{{
+			Name:   moduleCacheID(m.module),
+			Digest: DigestSet{"sha256": checksum},
+		}},
+		Predicate: ProvenancePredicate{
+			Builder:   ProvenanceBuilder{ID: ProvenanceBuilderID},
+			BuildType: ProvenanceBuildType,
+			Invocation: ProvenanceInvocation{
+				Parameters:  ProvenanceParameters{RunID: m.runID},
+				Environment: ProvenanceEnvironment{Hostname: hostname, OS: runtime.GOOS, Arch: runtime.GOARCH},
+			},
+			Metadata: ProvenanceMetadata{
+				BuildInvocationID: m.runID,
+				BuildStartedOn:    result.StartedAt,
+				BuildFinishedOn:   result.FinishedAt,
+			},
+		},
+	}
+
+	seenImages := make(map[string]bool)
+	variables := make(map[string]bool)
+	for _, img := range stageImages(m.module) {
+		if len(img.State) == 0 {
+			continue
+		}
+		for _, e := range img.Info.EnvVars {
+			variables[e.Name] = true
+		}
+		if len(img.Info.Image) == 0 || seenImages[img.Info.Image] {
+			continue
+		}
+		seenImages[img.Info.Image] = true
+		material := ProvenanceMaterial{URI: img.Info.Image}
+		if digest, err := m.provenance(img.Info.Image); err != nil {
+			ctx.Logger().Warnf("could not resolve the digest of image %s: %v", img.Info.Image, err)
+		} else {
+			material.Digest = parseDigest(digest)
+		}
+		p.Predicate.Materials = append(p.Predicate.Materials, material)
+	}
+	variables[RunIDEnvVar] = true
+	for name := range variables {
+		p.Predicate.Invocation.Parameters.Variables = append(p.Predicate.Invocation.Parameters.Variables, name)
+	}
+	sort.Strings(p.Predicate.Invocation.Parameters.Variables)
+	return p, nil
+}
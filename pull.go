@@ -0,0 +1,161 @@
+package atkmod
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The defaults of PullOptions.
+const (
+	DefaultPullAttempts   = 3
+	DefaultPullBackoff    = 2 * time.Second
+	DefaultPullMaxBackoff = 30 * time.Second
+	DefaultPullTimeout    = 10 * time.Minute
+)
+
+// PullOptions makes the CliModuleRunner pull the image with podman pull,
+// retrying with a backoff, before it runs the container with --pull=never.
+// A flaky registry then does not fail the stage, and a failure to pull is
+// reported as an ImagePullError instead of as a failure of the container.
+type PullOptions struct {
+	// Policy is when the image is pulled: always, missing, newer or never.
+	// The default is missing, which pulls the image only if it is not in
+	// the local storage.
+	Policy string
+	// AuthFile is the auth file for private registries, passed to podman
+	// pull with --authfile.
+	AuthFile string
+	// Credentials is the store of the logins to the registries, such as the
+	// keychain of the OS, which is used when there is no AuthFile. The
+	// login to the registry of the image is passed to podman pull in a
+	// temporary auth file.
+	Credentials CredentialStore
+	// Attempts is the number of times that the pull is tried,
+	// DefaultPullAttempts if zero.
+	Attempts int
+	// Backoff is the time to wait after the first failure, which doubles
+	// after each failure up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout limits the time of each attempt.
+	Timeout time.Duration
+}
+
+// ImagePullError is returned when an image could not be pulled.
+type ImagePullError struct {
+	Image    string
+	Attempts int
+	Err      error
+}
+
+func (e *ImagePullError) Error() string {
+	return fmt.Sprintf("could not pull image %s after %d attempts: %v", e.Image, e.Attempts, e.Err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *ImagePullError) Unwrap() error {
+	return e.Err
+}
+
+func durationOr(d time.Duration, or time.Duration) time.Duration {
+	if d <= 0 {
+		return or
+	}
+	return d
+}
+
+// pullImage pulls the image according to the options, retrying until the
+// pull succeeds, the attempts are used up or the context is done.
+func (r *CliModuleRunner) pullImage(ctx *RunContext, image string) error {
+	opts := r.Pull
+	policy := strings.ToLower(Iif(opts.Policy, PullMissing))
+	if policy == PullNever {
+		return nil
+	}
+	path, global := r.PodmanCliCommandBuilder.globalArgs()
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	if policy == PullMissing {
+		exists := exec.CommandContext(parent, path, append(global, "image", "exists", image)...)
+		if exists.Run() == nil {
+			return nil
+		}
+	}
+
+	args := append(global, "pull")
+	if len(opts.AuthFile) > 0 {
+		args = append(args, "--authfile", opts.AuthFile)
+	} else {
+		registry := imageRegistry(image)
+		cred, err := lookupCredential(opts.Credentials, registry)
+		if err != nil {
+			return fmt.Errorf("could not read the login to %s: %w", registry, err)
+		}
+		if cred != nil {
+			authFile, cleanup, err := writeAuthFile(registry, cred)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			args = append(args, "--authfile", authFile)
+		}
+	}
+	args = append(args, image)
+	attempts := opts.Attempts
+	if attempts <= 0 {
+		attempts = DefaultPullAttempts
+	}
+	backoff := durationOr(opts.Backoff, DefaultPullBackoff)
+	maxBackoff := durationOr(opts.MaxBackoff, DefaultPullMaxBackoff)
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = r.pullOnce(ctx, parent, durationOr(opts.Timeout, DefaultPullTimeout), path, args); err == nil {
+			return nil
+		}
+		if attempt == attempts || parent.Err() != nil {
+			return &ImagePullError{Image: image, Attempts: attempt, Err: err}
+		}
+		ctx.Logger().Warnf("could not pull image %s (attempt %d of %d), retrying in %s: %v", image, attempt, attempts, backoff, err)
+		select {
+		case <-parent.Done():
+			return &ImagePullError{Image: image, Attempts: attempt, Err: parent.Err()}
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	return &ImagePullError{Image: image, Attempts: attempts, Err: err}
+}
+
+// pullOnce runs podman pull once with the timeout. The error has the last
+// line that podman wrote to its error stream.
+func (r *CliModuleRunner) pullOnce(ctx *RunContext, parent context.Context, timeout time.Duration, path string, args []string) error {
+	attemptCtx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(attemptCtx, path, args...)
+	errOut, flush := ctx.errWriter()
+	defer flush()
+	stderr := &tailBuffer{limit: 4 << 10}
+	cmd.Stdout = io.Discard
+	cmd.Stderr = teeWriter(errOut, stderr)
+	ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+
+	err := cmd.Run()
+	if attemptCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		if lines := strings.Split(strings.TrimSpace(stderr.String()), "\n"); len(lines[len(lines)-1]) > 0 {
+			return fmt.Errorf("%w: %s", err, lines[len(lines)-1])
+		}
+	}
+	return err
+}
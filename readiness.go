@@ -0,0 +1,176 @@
+package atkmod
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultReadinessInterval is the time between the checks of the
+	// readiness of a module, unless another interval is set.
+	DefaultReadinessInterval = 5 * time.Second
+	// DefaultReadinessTimeout is the time that Deploy waits for a module to
+	// be ready, unless another timeout is set.
+	DefaultReadinessTimeout = 10 * time.Minute
+)
+
+// ReadinessInfo declares how to check that a module is ready after its
+// deploy stage has run. If neither HTTPGet nor TCPSocket is set, the
+// get_state hook is run until it reports that the module is DEPLOYED.
+//
+// The URL and address can refer to the outputs of the scanners of the
+// stages, such as ${console_url}.
+type ReadinessInfo struct {
+	// HTTPGet is a URL that is ready when it returns a 2xx or 3xx status.
+	HTTPGet string `json:"httpGet,omitempty" yaml:"httpGet,omitempty"`
+	// TCPSocket is a host:port that is ready when it accepts connections.
+	TCPSocket string `json:"tcpSocket,omitempty" yaml:"tcpSocket,omitempty"`
+	// Interval is the time between the checks, such as 10s.
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Timeout is the time to wait for the module to be ready, such as 15m.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// durations returns the interval and the timeout of the readiness checks.
+func (r *ReadinessInfo) durations() (time.Duration, time.Duration, error) {
+	interval, timeout := DefaultReadinessInterval, DefaultReadinessTimeout
+	var err error
+	if len(r.Interval) > 0 {
+		if interval, err = time.ParseDuration(r.Interval); err != nil || interval <= 0 {
+			return 0, 0, fmt.Errorf("invalid readiness interval: %s", r.Interval)
+		}
+	}
+	if len(r.Timeout) > 0 {
+		if timeout, err = time.ParseDuration(r.Timeout); err != nil || timeout <= 0 {
+			return 0, 0, fmt.Errorf("invalid readiness timeout: %s", r.Timeout)
+		}
+	}
+	return interval, timeout, nil
+}
+
+// NotReadyError is returned when a module was not ready before the timeout.
+type NotReadyError struct {
+	Module  string
+	Timeout time.Duration
+	// Err is the reason that the last check failed, if it failed with an
+	// error.
+	Err error
+}
+
+func (e *NotReadyError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("module %s was not ready within %s: %v", e.Module, e.Timeout, e.Err)
+	}
+	return fmt.Sprintf("module %s was not ready within %s", e.Module, e.Timeout)
+}
+
+func (e *NotReadyError) Unwrap() error {
+	return e.Err
+}
+
+// pollUntil calls check every interval until it returns true, the timeout
+// passes or the context is done. The last error returned by check is passed
+// to onTimeout to build the error that is returned when the timeout passes.
+func pollUntil(ctx context.Context, interval time.Duration, timeout time.Duration, check func() (bool, error), onTimeout func(last error) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last error
+	for {
+		done, err := check()
+		if done {
+			return nil
+		}
+		last = err
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return onTimeout(last)
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitUntilReady runs the readiness checks of the module until it is ready.
+func (m *DeployableModule) waitUntilReady(ctx *RunContext) error {
+	readiness := m.module.Specifications.Readiness
+	interval, timeout, err := readiness.durations()
+	if err != nil {
+		return err
+	}
+	outputs := m.Outputs()
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string { return outputs[name] })
+	}
+
+	var check func() (bool, error)
+	switch {
+	case len(readiness.HTTPGet) > 0:
+		url := expand(readiness.HTTPGet)
+		client := newHTTPClient(interval)
+		check = func() (bool, error) {
+			return httpReady(ctx.Context, client, url)
+		}
+	case len(readiness.TCPSocket) > 0:
+		address := expand(readiness.TCPSocket)
+		check = func() (bool, error) {
+			conn, err := net.DialTimeout("tcp", address, interval)
+			if err != nil {
+				return false, err
+			}
+			conn.Close()
+			return true, nil
+		}
+	default:
+		check = func() (bool, error) {
+			state, err := m.GetState(ctx)
+			if err != nil {
+				return false, err
+			}
+			if !state.IsDeployed() {
+				return false, fmt.Errorf("module reported status %s", state.Health.Status)
+			}
+			return true, nil
+		}
+	}
+
+	ctx.Logger().Infof("waiting up to %s for module %s to be ready", timeout, m.module.Metadata.Name)
+	return pollUntil(ctx.Context, interval, timeout, func() (bool, error) {
+		ready, err := check()
+		if err != nil {
+			ctx.Logger().Debugf("module %s is not ready: %v", m.module.Metadata.Name, err)
+		}
+		return ready, err
+	}, func(last error) error {
+		return &NotReadyError{Module: m.module.Metadata.Name, Timeout: timeout, Err: last}
+	})
+}
+
+func httpReady(ctx context.Context, client *http.Client, url string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return false, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return true, nil
+}
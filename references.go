@@ -0,0 +1,134 @@
+package atkmod
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The kinds of the values of other modules that can be referenced.
+const (
+	// ReferenceOutputs is an output of the stages of the module, which is
+	// extracted by their scanners.
+	ReferenceOutputs = "outputs"
+	// ReferenceState is a value in the data of the state that the get_state
+	// hook of the module reports once it is deployed, as a dotted path.
+	ReferenceState = "state"
+)
+
+// moduleReferencePattern matches the references to the values of other
+// modules, such as ${modules.vpc.outputs.vpc_id}.
+var moduleReferencePattern = regexp.MustCompile(`\$\{modules\.([^.}]+)\.(outputs|state)\.([^}]+)\}`)
+
+// ModuleReference is a reference to a value of another module in the
+// environment variables or the arguments of a module, such as
+// ${modules.vpc.outputs.vpc_id}, which is resolved by a DeploymentPlan
+// before the module is deployed.
+type ModuleReference struct {
+	Module string
+	// Kind is ReferenceOutputs or ReferenceState.
+	Kind string
+	Key  string
+}
+
+func (r ModuleReference) String() string {
+	return fmt.Sprintf("${modules.%s.%s.%s}", r.Module, r.Kind, r.Key)
+}
+
+// UnresolvedReferenceError is the error of a module in a DeploymentPlan that
+// references a value that the other module did not produce.
+type UnresolvedReferenceError struct {
+	Module    string
+	Reference ModuleReference
+}
+
+func (e *UnresolvedReferenceError) Error() string {
+	return fmt.Sprintf("module %s references %s, which module %s did not produce", e.Module, e.Reference, e.Reference.Module)
+}
+
+// ModuleReferences returns the references to other modules in the
+// environment variables and the arguments of the hooks and stages of the
+// module, in the order that they appear.
+func ModuleReferences(module *ModuleInfo) []ModuleReference {
+	var refs []ModuleReference
+	for _, s := range stageImages(module) {
+		for _, value := range referencingValues(s.Info) {
+			for _, match := range moduleReferencePattern.FindAllStringSubmatch(value, -1) {
+				refs = append(refs, ModuleReference{Module: match[1], Kind: match[2], Key: match[3]})
+			}
+		}
+	}
+	return refs
+}
+
+func referencingValues(info ImageInfo) []string {
+	values := append([]string(nil), info.Args...)
+	for _, e := range info.EnvVars {
+		values = append(values, e.Value)
+	}
+	return values
+}
+
+// resolveReferences returns a copy of the module with the references to
+// other modules replaced by their values.
+func resolveReferences(module *ModuleInfo, lookup func(ModuleReference) (string, bool)) (*ModuleInfo, error) {
+	resolved := module.DeepCopy()
+	var err error
+	replace := func(value string) string {
+		return moduleReferencePattern.ReplaceAllStringFunc(value, func(s string) string {
+			match := moduleReferencePattern.FindStringSubmatch(s)
+			ref := ModuleReference{Module: match[1], Kind: match[2], Key: match[3]}
+			v, ok := lookup(ref)
+			if !ok && err == nil {
+				err = &UnresolvedReferenceError{Module: module.Metadata.Name, Reference: ref}
+			}
+			return v
+		})
+	}
+	for _, ref := range imageRefs(resolved) {
+		for idx := range ref.info.Args {
+			ref.info.Args[idx] = replace(ref.info.Args[idx])
+		}
+		for idx := range ref.info.EnvVars {
+			ref.info.EnvVars[idx].Value = replace(ref.info.EnvVars[idx].Value)
+		}
+	}
+	return resolved, err
+}
+
+// stateValue returns the value at the dotted path in the data of the state,
+// as a string, or as JSON if it is not a scalar.
+func stateValue(state *ModuleState, path string) (string, bool) {
+	if state == nil {
+		return "", false
+	}
+	content, err := json.Marshal(state.Data)
+	if err != nil {
+		return "", false
+	}
+	var value interface{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		return "", false
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64, bool:
+		return fmt.Sprint(v), true
+	case nil:
+		return "", false
+	default:
+		content, err := json.Marshal(v)
+		return string(content), err == nil
+	}
+}
@@ -0,0 +1,239 @@
+package atkmod
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRegistryPageSize is the number of modules requested in each page
+// by a RegistryClient, unless another size is set.
+const DefaultRegistryPageSize = 50
+
+// RegistryModule is the metadata of a module in the TechZone registry.
+type RegistryModule struct {
+	Namespace   string            `json:"namespace" yaml:"namespace"`
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	UpdatedAt   time.Time         `json:"updatedAt,omitempty" yaml:"updatedAt,omitempty"`
+}
+
+// registryPage is a page of the list of modules. NextPage is empty on the
+// last page.
+type registryPage struct {
+	Modules  []RegistryModule `json:"modules"`
+	NextPage string           `json:"nextPage,omitempty"`
+}
+
+// RegistryError is returned by a RegistryClient when the registry responds
+// with an unexpected status.
+type RegistryError struct {
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+func (e *RegistryError) Error() string {
+	msg := fmt.Sprintf("registry request to %s failed with status %d", e.URL, e.StatusCode)
+	if len(e.Message) > 0 {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+type registryCacheEntry struct {
+	etag string
+	body []byte
+}
+
+// RegistryClient fetches the metadata and the manifests of modules from the
+// TechZone registry API. The modules are listed from {BaseURL}/modules, a
+// page at a time, and the manifest of a module is fetched from
+// {BaseURL}/modules/{namespace}/{name}/manifest. The responses are cached
+// with their ETags, so a response that has not changed is not downloaded
+// again.
+type RegistryClient struct {
+	BaseURL string
+	// Token is sent as a bearer token, if it is set.
+	Token string
+	// Credentials is the store that the token is read from, as the secret of
+	// the host of BaseURL, when Token is not set.
+	Credentials CredentialStore
+	// PageSize is the number of modules in each page of the list.
+	PageSize   int
+	HTTPClient *http.Client
+	// Verifiers check the manifests before they are parsed, as they do for
+	// a ManifestFileLoader.
+	Verifiers []ManifestVerifier
+
+	mu    sync.Mutex
+	cache map[string]registryCacheEntry
+}
+
+// NewRegistryClient creates a client for the registry at the base URL that
+// authenticates with the token, through the proxy and with the TLS
+// configuration of the DefaultConfig.
+func NewRegistryClient(baseURL string, token string) *RegistryClient {
+	return &RegistryClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		PageSize:   DefaultRegistryPageSize,
+		HTTPClient: newHTTPClient(30 * time.Second),
+	}
+}
+
+// ListModules returns the metadata of all of the modules in the registry,
+// following the pages of the list.
+func (c *RegistryClient) ListModules(ctx context.Context) ([]RegistryModule, error) {
+	var modules []RegistryModule
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("limit", fmt.Sprint(c.pageSize()))
+		if len(pageToken) > 0 {
+			query.Set("pageToken", pageToken)
+		}
+		body, err := c.get(ctx, c.BaseURL+"/modules?"+query.Encode(), "application/json")
+		if err != nil {
+			return nil, err
+		}
+		page := &registryPage{}
+		if err := json.Unmarshal(body, page); err != nil {
+			return nil, fmt.Errorf("could not read the list of modules: %w", err)
+		}
+		modules = append(modules, page.Modules...)
+		if len(page.NextPage) == 0 || page.NextPage == pageToken {
+			return modules, nil
+		}
+		pageToken = page.NextPage
+	}
+}
+
+// GetManifest fetches the manifest of the module and returns it ready to be
+// deployed.
+func (c *RegistryClient) GetManifest(ctx context.Context, namespace string, name string) (*ModuleInfo, error) {
+	u := fmt.Sprintf("%s/modules/%s/%s/manifest", c.BaseURL, url.PathEscape(namespace), url.PathEscape(name))
+	body, err := c.get(ctx, u, "application/yaml")
+	if err != nil {
+		return nil, err
+	}
+	for _, verifier := range c.Verifiers {
+		if err := verifier.Verify(u, body); err != nil {
+			return nil, &ManifestIntegrityError{URI: u, Err: err}
+		}
+	}
+	module := &ModuleInfo{}
+	if err := yaml.Unmarshal(body, module); err != nil {
+		return nil, fmt.Errorf("could not read the manifest of module %s/%s: %w", namespace, name, err)
+	}
+	if !module.IsSupported() {
+		return module, fmt.Errorf("module version %s is not supported", module.ApiVersion)
+	}
+	return module, nil
+}
+
+func (c *RegistryClient) pageSize() int {
+	if c.PageSize <= 0 {
+		return DefaultRegistryPageSize
+	}
+	return c.PageSize
+}
+
+// get returns the body of the response to a GET of the URL, using the
+// cached body if the registry responds that it has not been modified.
+func (c *RegistryClient) get(ctx context.Context, u string, accept string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	token := c.Token
+	if len(token) == 0 {
+		cred, err := lookupCredential(c.Credentials, CredentialServer(c.BaseURL))
+		if err != nil {
+			return nil, err
+		}
+		if cred != nil {
+			token = cred.Secret
+		}
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	c.mu.Lock()
+	cached, found := c.cache[u]
+	c.mu.Unlock()
+	if found {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && found:
+		return cached.body, nil
+	case resp.StatusCode != http.StatusOK:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &RegistryError{URL: u, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if etag := resp.Header.Get("ETag"); len(etag) > 0 {
+		c.mu.Lock()
+		if c.cache == nil {
+			c.cache = make(map[string]registryCacheEntry)
+		}
+		c.cache[u] = registryCacheEntry{etag: etag, body: body}
+		c.mu.Unlock()
+	}
+	return body, nil
+}
+
+// RegistrySource is a CatalogSource for the modules in the registry.
+type RegistrySource struct {
+	Client *RegistryClient
+}
+
+// Manifests fetches the manifests of all of the modules in the registry,
+// with the URL of the manifest as their source.
+func (s *RegistrySource) Manifests(ctx *RunContext) ([]CatalogManifest, error) {
+	reqCtx := ctx.Context
+	if reqCtx == nil {
+		reqCtx = context.Background()
+	}
+	modules, err := s.Client.ListModules(reqCtx)
+	if err != nil {
+		return nil, err
+	}
+	var manifests []CatalogManifest
+	for _, m := range modules {
+		module, err := s.Client.GetManifest(reqCtx, m.Namespace, m.Name)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, CatalogManifest{
+			Source: fmt.Sprintf("%s/modules/%s/%s/manifest", s.Client.BaseURL, m.Namespace, m.Name),
+			Module: module,
+		})
+	}
+	return manifests, nil
+}
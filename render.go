@@ -0,0 +1,170 @@
+package atkmod
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SummaryTable is a summary of a deployment result or a plan that can be
+// written as an aligned text table, for a terminal, or as Markdown, for chat
+// messages and pull request comments.
+type SummaryTable struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+	// Notes are the lines that follow the table, such as the error of a
+	// failed deployment.
+	Notes []string
+}
+
+// WriteText writes the table as aligned columns of text.
+func (t *SummaryTable) WriteText(w io.Writer) error {
+	b := new(strings.Builder)
+	if len(t.Title) > 0 {
+		fmt.Fprintln(b, t.Title)
+	}
+	tw := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	writeRow := func(cells []string) {
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	writeRow(upperAll(t.Header))
+	for _, row := range t.Rows {
+		writeRow(row)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, note := range t.Notes {
+		fmt.Fprintln(b, note)
+	}
+	// The tabwriter pads the last column too.
+	lines := strings.Split(b.String(), "\n")
+	for idx := range lines {
+		lines[idx] = strings.TrimRight(lines[idx], " ")
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// WriteMarkdown writes the table as a GitHub flavored Markdown table, with
+// the title in bold and the notes as a list.
+func (t *SummaryTable) WriteMarkdown(w io.Writer) error {
+	b := new(strings.Builder)
+	if len(t.Title) > 0 {
+		fmt.Fprintf(b, "**%s**\n\n", markdownEscape(t.Title))
+	}
+	writeRow := func(cells []string) {
+		escaped := make([]string, len(cells))
+		for idx, cell := range cells {
+			escaped[idx] = markdownEscape(cell)
+		}
+		fmt.Fprintf(b, "| %s |\n", strings.Join(escaped, " | "))
+	}
+	writeRow(t.Header)
+	separator := make([]string, len(t.Header))
+	for idx := range separator {
+		separator[idx] = "---"
+	}
+	fmt.Fprintf(b, "|%s|\n", strings.Join(separator, "|"))
+	for _, row := range t.Rows {
+		writeRow(row)
+	}
+	if len(t.Notes) > 0 {
+		fmt.Fprintln(b)
+		for _, note := range t.Notes {
+			fmt.Fprintf(b, "- %s\n", markdownEscape(note))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// String returns the table as text.
+func (t *SummaryTable) String() string {
+	b := new(strings.Builder)
+	_ = t.WriteText(b)
+	return b.String()
+}
+
+// Markdown returns the table as Markdown.
+func (t *SummaryTable) Markdown() string {
+	b := new(strings.Builder)
+	_ = t.WriteMarkdown(b)
+	return b.String()
+}
+
+func upperAll(values []string) []string {
+	upper := make([]string, len(values))
+	for idx, v := range values {
+		upper[idx] = strings.ToUpper(v)
+	}
+	return upper
+}
+
+// markdownEscape escapes the characters that would break a Markdown table
+// or be taken as formatting.
+func markdownEscape(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`").Replace(s)
+}
+
+// Summary returns the states that the deployment went through with how long
+// each one took and whether it failed, followed by the error, the outputs and the
+// artifacts of the deployment.
+func (r *DeploymentResult) Summary() *SummaryTable {
+	t := &SummaryTable{
+		Title:  fmt.Sprintf("module %s: %s in %s", r.Module, r.State, r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond)),
+		Header: []string{"state", "duration", "status"},
+	}
+	for _, s := range r.Stages {
+		status := "ok"
+		if len(r.FailedState) > 0 && s.State == r.FailedState {
+			status = "failed"
+		}
+		t.Rows = append(t.Rows, []string{string(s.State), s.Duration.Round(time.Millisecond).String(), status})
+	}
+	if len(r.Error) > 0 {
+		t.Notes = append(t.Notes, "error: "+r.Error)
+	}
+	names := make([]string, 0, len(r.Outputs))
+	for name := range r.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.Notes = append(t.Notes, fmt.Sprintf("output %s: %s", name, r.Outputs[name]))
+	}
+	for _, a := range r.Artifacts {
+		t.Notes = append(t.Notes, fmt.Sprintf("artifact of %s: %s", a.State, a.File))
+	}
+	return t
+}
+
+// Summary returns the stages and hooks of the plan with their images and
+// commands, followed by the images that may be pulled.
+func (p *Plan) Summary() *SummaryTable {
+	t := &SummaryTable{
+		Title:  fmt.Sprintf("plan of module %s", p.Module),
+		Header: []string{"name", "state", "image", "command"},
+	}
+	for _, img := range append(append([]PlannedImage{}, p.Stages...), p.Hooks...) {
+		state := Iif(string(img.State), "hook")
+		image := Iif(img.Image, img.Script)
+		if !img.Defined() {
+			image = "(not defined)"
+		}
+		command := strings.Join(append(append([]string{}, img.Command...), img.Args...), " ")
+		t.Rows = append(t.Rows, []string{img.Name, state, image, command})
+	}
+	if len(p.Pulls) > 0 {
+		t.Notes = append(t.Notes, fmt.Sprintf("images that may be pulled: %s", strings.Join(p.Pulls, ", ")))
+	}
+	for _, v := range p.Violations {
+		t.Notes = append(t.Notes, v.String())
+	}
+	return t
+}
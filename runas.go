@@ -0,0 +1,133 @@
+package atkmod
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// DefaultEphemeralUID is the user that WithEphemeralUser runs the lifecycle
+// stages as. It is not root and is not a user of the images, and its group
+// is 0, as on OpenShift, so that the images that make their files writable
+// by the root group work.
+const DefaultEphemeralUID = 10001
+
+// OwnershipFixer is implemented by the runners that can change the owner of
+// the files in a local directory to a user of the containers, so that the
+// files that a stage run as another user writes are owned by the user of
+// the host afterwards.
+type OwnershipFixer interface {
+	// FixOwnership changes the owner of the directory and of the files in
+	// it to the user with the uid in the containers, and their group to 0.
+	// The uid 0 is the user that runs podman.
+	FixOwnership(ctx *RunContext, dir string, uid int) error
+}
+
+// FixOwnership changes the owner of the files with podman unshare, which
+// maps the uids of the containers of rootless podman to the uids on the
+// host. When podman runs as root, the files are changed directly, and when
+// it runs on a podman machine or a remote connection, where podman unshare
+// cannot reach the files, a container of the helper image with the
+// directory mounted changes them.
+func (r *CliModuleRunner) FixOwnership(ctx *RunContext, dir string, uid int) error {
+	owner := fmt.Sprintf("%d:0", uid)
+	path, global := r.PodmanCliCommandBuilder.globalArgs()
+	var cmd *exec.Cmd
+	switch {
+	case len(global) > 0 || r.PodmanCliCommandBuilder.parts.Platform != PlatformLinux:
+		volume := MachinePath(r.PodmanCliCommandBuilder.parts.Platform, dir) + ":/workspace:Z"
+		cmd = exec.Command(path, append(global, "run", "--rm", "--user=0:0", "--network=none", "-v", volume, r.helperImage(), "chown", "-R", owner, "/workspace")...)
+	case os.Geteuid() == 0:
+		ctx.logCommand("changing the owner of %s to %s", dir, owner)
+		return chownAll(dir, uid, 0)
+	default:
+		cmd = exec.Command(path, "unshare", "chown", "-R", owner, dir)
+	}
+	ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not change the owner of %s to %s: %w: %s", dir, owner, err, out)
+	}
+	return nil
+}
+
+// chownAll changes the owner of the directory and of the files in it, not
+// following the links.
+func chownAll(dir string, uid int, gid int) error {
+	return filepath.WalkDir(dir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+// WithRunAsUser runs the lifecycle stages as the user with the uid, and
+// group 0, instead of the user of the images. The workspace of the module
+// is given to the user before each stage, if the runner is an
+// OwnershipFixer, so that the stage can write to it, and is given back to
+// the user of the host afterwards, so that the files that the stage wrote
+// are not owned by the uids that rootless podman maps the users of the
+// containers to. The hooks run as the user of the images.
+func WithRunAsUser(uid int) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.runAsUser = &uid
+	}
+}
+
+// WithEphemeralUser runs the lifecycle stages as the DefaultEphemeralUID,
+// as WithRunAsUser does.
+func WithEphemeralUser() DeployableModuleOption {
+	return WithRunAsUser(DefaultEphemeralUID)
+}
+
+// runStageAs gives the workspace of the stage to the user that the stage
+// runs as and marks the context so that the runners run the stage as the
+// user. The returned function gives the workspace back to the user of the
+// host; the errors of which are only logged, so that they do not hide the
+// result of the stage.
+func (m *DeployableModule) runStageAs(ctx *RunContext, state State, info ImageInfo) (func(), error) {
+	if m.runAsUser == nil {
+		return func() {}, nil
+	}
+	uid := *m.runAsUser
+	ctx.Context = withRunAsUser(ctx.Context, uid)
+	fixer, ok := m.runner.(OwnershipFixer)
+	workspace := m.stageWorkspace(info)
+	if !ok || len(workspace) == 0 {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		return nil, err
+	}
+	if err := fixer.FixOwnership(ctx, workspace, uid); err != nil {
+		return nil, fmt.Errorf("could not give the workspace of stage %s to user %d: %w", state, uid, err)
+	}
+	return func() {
+		if err := fixer.FixOwnership(ctx, workspace, 0); err != nil {
+			ctx.Log.WithField(RunIDLogField, m.runID).Warnf("the files in the workspace of stage %s are still owned by user %d: %v", state, uid, err)
+		}
+	}, nil
+}
+
+type runAsUserContextKey struct{}
+
+// withRunAsUser marks the context so that the runners run the image as the
+// user with the uid.
+func withRunAsUser(ctx context.Context, uid int) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, runAsUserContextKey{}, uid)
+}
+
+// runAsUserOf returns the uid set with withRunAsUser, if any.
+func runAsUserOf(ctx context.Context) (int, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	uid, ok := ctx.Value(runAsUserContextKey{}).(int)
+	return uid, ok
+}
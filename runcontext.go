@@ -0,0 +1,320 @@
+package atkmod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// DefaultChildOutputLimit is the number of bytes at the end of the output
+// and error streams that a context derived with Child keeps.
+const DefaultChildOutputLimit = 64 << 10
+
+// RunContextOption sets a field of the RunContext that NewRunContext creates.
+type RunContextOption func(*RunContext)
+
+// WithContext sets the context of the RunContext, which cancels the commands
+// that are run with it when it is done.
+func WithContext(ctx context.Context) RunContextOption {
+	return func(c *RunContext) {
+		c.Context = ctx
+	}
+}
+
+// WithIn sets the input stream of the RunContext, which is nil by default.
+func WithIn(in io.Reader) RunContextOption {
+	return func(c *RunContext) {
+		c.In = in
+	}
+}
+
+// WithOut sets the output stream of the RunContext.
+func WithOut(out io.Writer) RunContextOption {
+	return func(c *RunContext) {
+		c.Out = out
+	}
+}
+
+// WithErr sets the error stream of the RunContext.
+func WithErr(err io.Writer) RunContextOption {
+	return func(c *RunContext) {
+		c.Err = err
+	}
+}
+
+// WithLog sets the logger of the RunContext. The logger is copied, so it
+// can still be changed afterwards without changing the RunContext.
+func WithLog(l *logger.Logger) RunContextOption {
+	return func(c *RunContext) {
+		if l != nil {
+			c.Log = copyLogger(l)
+		}
+	}
+}
+
+// WithVerbosity sets the verbosity of the RunContext.
+func WithVerbosity(verbosity Verbosity) RunContextOption {
+	return func(c *RunContext) {
+		c.Verbosity = verbosity
+	}
+}
+
+// NewRunContext creates a RunContext with the options. The logger and the
+// streams that the options do not set are taken from the context, as set
+// with WithLogger, WithStdOut and WithStdErr, and otherwise the output and
+// error streams are os.Stdout and os.Stderr, and the logger logs at the info
+// level to the error stream. The context is context.Background() unless
+// WithContext sets another one. An error is returned if the RunContext is
+// not valid, such as when WithContext sets a nil context.
+func NewRunContext(opts ...RunContextOption) (*RunContext, error) {
+	c := &RunContext{Context: context.Background()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.useContextValues()
+	if c.Out == nil {
+		c.Out = os.Stdout
+	}
+	if c.Err == nil {
+		c.Err = os.Stderr
+	}
+	if !c.hasLogger() {
+		c.Log = logger.Logger{
+			Out:       c.Err,
+			Formatter: new(logger.TextFormatter),
+			Hooks:     make(logger.LevelHooks),
+			Level:     logger.InfoLevel,
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the RunContext cannot be used to run images:
+// if it has no context, output stream, error stream or logger, or if its
+// verbosity is not one of the Verbosity constants.
+func (c *RunContext) Validate() error {
+	var problems []string
+	if c.Context == nil {
+		problems = append(problems, "the context is not set")
+	}
+	if c.Out == nil {
+		problems = append(problems, "the output stream is not set")
+	}
+	if c.Err == nil {
+		problems = append(problems, "the error stream is not set")
+	}
+	if !c.hasLogger() {
+		problems = append(problems, "the logger is not set")
+	}
+	if c.Verbosity < VerbositySilent || c.Verbosity > VerbosityDebug {
+		problems = append(problems, fmt.Sprintf("unknown verbosity %d", c.Verbosity))
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid run context: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Child derives a context for a single stage. The child shares the context,
+// input, logger, run ID and JSON log of its parent, and writes its output and
+// error streams to those of the parent, but it has its own list of errors and
+// exit code and keeps the end of its own output. The parent is errored if any
+// of its children is, and Summary rolls the children up.
+func (c *RunContext) Child(stage string) *RunContext {
+	child := &RunContext{
+		Context:          c.Context,
+		In:               c.In,
+		Log:              copyLogger(&c.Log),
+		RunID:            c.RunID,
+		JSONLog:          c.JSONLog,
+		Stage:            stage,
+		Verbosity:        c.Verbosity,
+		ShowPullProgress: c.ShowPullProgress,
+		masked:           c.maskedValues(),
+		stdout:           &tailBuffer{limit: DefaultChildOutputLimit},
+		stderr:           &tailBuffer{limit: DefaultChildOutputLimit},
+	}
+	child.Out = teeWriter(c.Out, child.stdout)
+	child.Err = teeWriter(c.Err, child.stderr)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.children = append(c.children, child)
+	return child
+}
+
+// Children returns the contexts that were derived from this one with Child,
+// in the order that they were derived.
+func (c *RunContext) Children() []*RunContext {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*RunContext(nil), c.children...)
+}
+
+// Stdout returns the end of the output that was written to a context derived
+// with Child, or an empty string for other contexts.
+func (c *RunContext) Stdout() string {
+	if c.stdout == nil {
+		return ""
+	}
+	return c.stdout.String()
+}
+
+// Stderr returns the end of the errors that were written to a context derived
+// with Child, or an empty string for other contexts.
+func (c *RunContext) Stderr() string {
+	if c.stderr == nil {
+		return ""
+	}
+	return c.stderr.String()
+}
+
+// Command returns the last command that was run with the context, with the
+// masked values masked, or nil if none was run.
+func (c *RunContext) Command() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.command...)
+}
+
+func (c *RunContext) setCommand(args []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.command = append([]string(nil), args...)
+}
+
+// AllErrors returns the errors of the context followed by those of its
+// children, in the order that the children were derived.
+func (c *RunContext) AllErrors() []error {
+	errs := append([]error(nil), c.Errors...)
+	for _, child := range c.Children() {
+		errs = append(errs, child.AllErrors()...)
+	}
+	return errs
+}
+
+// RunSummary is the outcome of a context and of the contexts derived from
+// it.
+type RunSummary struct {
+	Stage       string
+	Errors      []error
+	LastErrCode int
+	Stdout      string
+	Stderr      string
+	Children    []RunSummary
+}
+
+// Summary returns the outcome of the context and of its children.
+func (c *RunContext) Summary() RunSummary {
+	summary := RunSummary{
+		Stage:       c.Stage,
+		Errors:      append([]error(nil), c.Errors...),
+		LastErrCode: c.LastErrCode,
+		Stdout:      c.Stdout(),
+		Stderr:      c.Stderr(),
+	}
+	for _, child := range c.Children() {
+		summary.Children = append(summary.Children, child.Summary())
+	}
+	return summary
+}
+
+// Failed returns the summaries of the stages, at any depth, that have errors
+// or a non zero exit code.
+func (s RunSummary) Failed() []RunSummary {
+	failed := make([]RunSummary, 0)
+	if len(s.Errors) > 0 || s.LastErrCode != 0 {
+		failed = append(failed, s)
+	}
+	for _, child := range s.Children {
+		failed = append(failed, child.Failed()...)
+	}
+	return failed
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	mu    sync.Mutex
+	buf   []byte
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = append(b.buf[:0:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// copyLogger returns a logger with the same settings and hooks as the given
+// one, without copying its lock.
+func copyLogger(l *logger.Logger) logger.Logger {
+	return logger.Logger{
+		Out:          l.Out,
+		Formatter:    l.Formatter,
+		Hooks:        l.Hooks,
+		Level:        l.GetLevel(),
+		ReportCaller: l.ReportCaller,
+		ExitFunc:     l.ExitFunc,
+	}
+}
+
+// MaskedValue replaces the values that are masked in the logs.
+const MaskedValue = "*****"
+
+// Mask masks the values, such as the passwords of a deployment, in the
+// commands that are logged with this context and the contexts that are
+// derived from it afterwards.
+func (c *RunContext) Mask(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, value := range values {
+		if len(value) > 0 {
+			c.masked = append(c.masked, value)
+		}
+	}
+}
+
+func (c *RunContext) maskedValues() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.masked...)
+}
+
+// mask returns the string with the masked values replaced by MaskedValue.
+func (c *RunContext) mask(s string) string {
+	for _, value := range c.maskedValues() {
+		s = strings.ReplaceAll(s, value, MaskedValue)
+	}
+	return s
+}
+
+// maskAll returns a copy of the strings with the masked values replaced.
+func (c *RunContext) maskAll(s []string) []string {
+	if len(c.maskedValues()) == 0 {
+		return s
+	}
+	masked := make([]string, len(s))
+	for idx := range s {
+		masked[idx] = c.mask(s[idx])
+	}
+	return masked
+}
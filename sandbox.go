@@ -0,0 +1,95 @@
+package atkmod
+
+import (
+	"context"
+	"strings"
+)
+
+// SandboxInfo relaxes the hardened defaults that the hooks run with. The
+// hooks only report on the module and its environment, so by default they
+// run with a read-only root filesystem, without a network and without any
+// capabilities, which limits what an untrusted module can do to the host.
+// The sandbox only applies to the hooks; the lifecycle stages run as they
+// are defined.
+type SandboxInfo struct {
+	// Network is the network of the container, such as host or bridge.
+	// The hooks have no network if it is empty.
+	Network string `json:"network,omitempty" yaml:"network,omitempty"`
+	// Writable makes the root filesystem of the container writable.
+	Writable bool `json:"writable,omitempty" yaml:"writable,omitempty"`
+	// Capabilities are the capabilities that are added back, such as
+	// NET_RAW.
+	Capabilities []string `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+}
+
+// DeepCopy returns a copy of the sandbox that does not share its
+// capabilities with the original.
+func (s *SandboxInfo) DeepCopy() *SandboxInfo {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Capabilities = copyStrings(s.Capabilities)
+	return &c
+}
+
+// Equal returns true if the two sandboxes have the same values.
+func (s *SandboxInfo) Equal(other *SandboxInfo) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	return s.Network == other.Network && s.Writable == other.Writable && equalStrings(s.Capabilities, other.Capabilities)
+}
+
+// podmanFlags returns the flags of podman run that apply the sandbox.
+func (s *SandboxInfo) podmanFlags() []string {
+	var flags []string
+	if !s.Writable {
+		flags = append(flags, "--read-only")
+	}
+	flags = append(flags, "--network="+Iif(s.Network, "none"), "--cap-drop=all")
+	for _, c := range s.Capabilities {
+		flags = append(flags, "--cap-add="+strings.ToUpper(c))
+	}
+	return append(flags, "--security-opt=no-new-privileges")
+}
+
+// WithoutHookSandbox runs the hooks without the sandbox, like the lifecycle
+// stages, for modules whose hooks predate it.
+func WithoutHookSandbox() DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.noSandbox = true
+	}
+}
+
+// hookSandbox returns the sandbox of the hook, or nil if the hooks of the
+// deployment do not run in one.
+func (m *DeployableModule) hookSandbox(info ImageInfo) *SandboxInfo {
+	if m.noSandbox {
+		return nil
+	}
+	if info.Sandbox != nil {
+		return info.Sandbox
+	}
+	return &SandboxInfo{}
+}
+
+type sandboxContextKey struct{}
+
+// withSandbox marks the context so that the runners run the image in the
+// sandbox.
+func withSandbox(ctx context.Context, sandbox *SandboxInfo) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, sandboxContextKey{}, sandbox)
+}
+
+// sandboxOf returns the sandbox set with withSandbox, if any.
+func sandboxOf(ctx context.Context) *SandboxInfo {
+	if ctx == nil {
+		return nil
+	}
+	sandbox, _ := ctx.Value(sandboxContextKey{}).(*SandboxInfo)
+	return sandbox
+}
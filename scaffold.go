@@ -0,0 +1,65 @@
+package atkmod
+
+const (
+	// DefaultScaffoldImage is the image used by NewModuleScaffold when no
+	// images are provided.
+	DefaultScaffoldImage = "docker.io/library/alpine:3.16"
+	// DefaultScaffoldNamespace is the namespace of scaffolded modules.
+	DefaultScaffoldNamespace = "default"
+	// DefaultScaffoldWorkspace is the local directory mounted as the
+	// workspace in scaffolded lifecycle stages, which is relative to the
+	// directory of the module.
+	DefaultScaffoldWorkspace = "."
+)
+
+// NewModuleScaffold creates a valid v1alpha1 ModuleInfo with the given name
+// that has all of the hooks and lifecycle stages defined, which can be used
+// as the starting point for a new module.
+//
+// The images are used, in order, for the list, validate and get_state hooks
+// and then the pre_deploy, deploy and post_deploy stages. If fewer images are
+// provided, the last one is used for the remaining hooks and stages, so
+// providing a single image uses that image for everything. If no images are
+// provided, DefaultScaffoldImage is used. The lifecycle stages mount the
+// DefaultScaffoldWorkspace as the workspace.
+func NewModuleScaffold(name string, images ...string) *ModuleInfo {
+	if len(images) == 0 {
+		images = []string{DefaultScaffoldImage}
+	}
+	imageAt := func(idx int) string {
+		if idx < len(images) {
+			return images[idx]
+		}
+		return images[len(images)-1]
+	}
+	stage := func(idx int) ImageInfo {
+		return ImageInfo{
+			Image: imageAt(idx),
+			Volumes: []VolumeInfo{
+				{Name: DefaultScaffoldWorkspace, MountPath: "/workspace"},
+			},
+		}
+	}
+
+	return &ModuleInfo{
+		ApiVersion: ApiVersion{Namespace: apiName, Version: apiVersionv1Alpha1}.String(),
+		Kind:       installKind,
+		Metadata: MetadataInfo{
+			Namespace: DefaultScaffoldNamespace,
+			Name:      name,
+			Labels:    map[string]string{},
+		},
+		Specifications: SpecInfo{
+			Hooks: HookInfo{
+				List:     ImageInfo{Image: imageAt(0)},
+				Validate: ImageInfo{Image: imageAt(1)},
+				GetState: ImageInfo{Image: imageAt(2)},
+			},
+			Lifecycle: LifecycleInfo{
+				PreDeploy:  stage(3),
+				Deploy:     stage(4),
+				PostDeploy: stage(5),
+			},
+		},
+	}
+}
@@ -0,0 +1,248 @@
+package atkmod
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ScannerInfo declares a pattern that is matched against each line of the
+// output of a lifecycle stage while it runs. A match can update the progress
+// of the stage, extract an output of the module, such as a URL, or end the
+// stage early.
+type ScannerInfo struct {
+	// Pattern is a regular expression that the line must match. The value
+	// that is extracted is the group named "value", or else the first group,
+	// or else the whole match.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// Path is a JSONPath, such as $.data.url, that is evaluated on the lines
+	// that are JSON objects, such as CloudEvents. If both Path and Pattern
+	// are set, the pattern is matched against the value at the path.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Stream is stdout or stderr. If empty, both streams are scanned.
+	Stream OutputStream `json:"stream,omitempty" yaml:"stream,omitempty"`
+	// Output is the name of the output that is set to the extracted value.
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+	// Progress is the percentage of the stage that is complete when the
+	// line matches.
+	Progress float64 `json:"progress,omitempty" yaml:"progress,omitempty"`
+	// State is the state that the deployment moves to when the line matches.
+	// It can be errored, to fail the stage, or the state that follows the
+	// stage, such as deployed for the deploy stage, to end the stage
+	// successfully without waiting for the container to exit.
+	State State `json:"state,omitempty" yaml:"state,omitempty"`
+}
+
+// ScannerMatchError is the error of a stage that was failed by a scanner
+// with the errored state.
+type ScannerMatchError struct {
+	Scanner ScannerInfo
+	Value   string
+}
+
+func (e *ScannerMatchError) Error() string {
+	return fmt.Sprintf("output matched the failure scanner %s: %s", Iif(e.Scanner.Pattern, e.Scanner.Path), e.Value)
+}
+
+// errStageComplete is returned by the line callback of the scanners when a
+// scanner ends the stage successfully.
+var errStageComplete = errors.New("stage completed by scanner")
+
+// completedState returns the state that follows the lifecycle stage that
+// runs in the given state.
+func completedState(state State) State {
+	switch state {
+	case PreDeploying:
+		return PreDeployed
+	case Deploying:
+		return Deployed
+	case PostDeploying:
+		return PostDeployed
+	default:
+		return ""
+	}
+}
+
+// outputScanner is a compiled ScannerInfo.
+type outputScanner struct {
+	info    ScannerInfo
+	pattern *regexp.Regexp
+	path    []string
+}
+
+// compileScanners compiles the scanners of the lifecycle stage that runs in
+// the given state.
+func compileScanners(state State, infos []ScannerInfo) ([]outputScanner, error) {
+	scanners := make([]outputScanner, 0, len(infos))
+	for idx, info := range infos {
+		s := outputScanner{info: info}
+		if len(info.Pattern) == 0 && len(info.Path) == 0 {
+			return nil, fmt.Errorf("scanner %d has neither a pattern nor a path", idx)
+		}
+		if len(info.Pattern) > 0 {
+			re, err := regexp.Compile(info.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("scanner %d has an invalid pattern: %w", idx, err)
+			}
+			s.pattern = re
+		}
+		if len(info.Path) > 0 {
+			path, err := parseJSONPath(info.Path)
+			if err != nil {
+				return nil, fmt.Errorf("scanner %d has an invalid path: %w", idx, err)
+			}
+			s.path = path
+		}
+		switch info.Stream {
+		case "", Stdout, Stderr:
+		default:
+			return nil, fmt.Errorf("scanner %d has an unknown stream: %s", idx, info.Stream)
+		}
+		if len(info.State) > 0 && info.State != Errored && (state == "" || info.State != completedState(state)) {
+			return nil, fmt.Errorf("scanner %d cannot move the deployment to state %s", idx, info.State)
+		}
+		scanners = append(scanners, s)
+	}
+	return scanners, nil
+}
+
+// match returns the value extracted from the line if it matches.
+func (s *outputScanner) match(stream OutputStream, line string) (string, bool) {
+	if len(s.info.Stream) > 0 && s.info.Stream != stream {
+		return "", false
+	}
+	value := line
+	if s.path != nil {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			return "", false
+		}
+		found, ok := lookupJSONPath(doc, s.path)
+		if !ok {
+			return "", false
+		}
+		value = jsonPathString(found)
+	}
+	if s.pattern == nil {
+		return value, true
+	}
+	match := s.pattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", false
+	}
+	if idx := s.pattern.SubexpIndex("value"); idx > 0 {
+		return match[idx], true
+	}
+	if len(match) > 1 {
+		return match[1], true
+	}
+	return match[0], true
+}
+
+// parseJSONPath parses the subset of JSONPath with fields and indexes, such
+// as $.data.variables[0].name, into its elements.
+func parseJSONPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path %s must start with $", path)
+	}
+	elems := make([]string, 0)
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %s has an empty field", path)
+			}
+			elems = append(elems, rest[1:end+1])
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %s has an unclosed index", path)
+			}
+			if _, err := strconv.Atoi(rest[1:end]); err != nil {
+				return nil, fmt.Errorf("path %s has an invalid index: %s", path, rest[1:end])
+			}
+			elems = append(elems, rest[:end+1])
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("path %s is not valid", path)
+		}
+	}
+	return elems, nil
+}
+
+func lookupJSONPath(doc interface{}, path []string) (interface{}, bool) {
+	current := doc
+	for _, elem := range path {
+		if strings.HasPrefix(elem, "[") {
+			idx, _ := strconv.Atoi(elem[1 : len(elem)-1])
+			list, ok := current.([]interface{})
+			if !ok || idx < 0 || idx >= len(list) {
+				return nil, false
+			}
+			current = list[idx]
+			continue
+		}
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[elem]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func jsonPathString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
+
+// scanLine is the line callback of the scanners of the stage.
+func (m *DeployableModule) scanLine(scanners []outputScanner) LineFunc {
+	return func(state State, stream OutputStream, line string) error {
+		for idx := range scanners {
+			s := &scanners[idx]
+			value, ok := s.match(stream, line)
+			if !ok {
+				continue
+			}
+			if len(s.info.Output) > 0 {
+				m.scanMu.Lock()
+				m.scanned[s.info.Output] = value
+				m.scanMu.Unlock()
+			}
+			if s.info.Progress > 0 && m.tracker != nil {
+				m.tracker.reportWithin(s.info.Progress)
+			}
+			switch s.info.State {
+			case Errored:
+				return &ScannerMatchError{Scanner: s.info, Value: value}
+			case "":
+			default:
+				return errStageComplete
+			}
+		}
+		return nil
+	}
+}
+
+// Outputs returns a copy of the outputs that were extracted from the output
+// of the stages by their scanners.
+func (m *DeployableModule) Outputs() map[string]string {
+	m.scanMu.Lock()
+	defer m.scanMu.Unlock()
+	return copyStringMap(m.scanned)
+}
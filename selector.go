@@ -0,0 +1,207 @@
+package atkmod
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SelectorOperator is the operator of a requirement of a label selector.
+type SelectorOperator string
+
+const (
+	SelectorEquals       SelectorOperator = "="
+	SelectorNotEquals    SelectorOperator = "!="
+	SelectorIn           SelectorOperator = "in"
+	SelectorNotIn        SelectorOperator = "notin"
+	SelectorExists       SelectorOperator = "exists"
+	SelectorDoesNotExist SelectorOperator = "!"
+)
+
+// SelectorRequirement is a single requirement of a label selector, such as
+// tier=demo or cloud in (aws,azure).
+type SelectorRequirement struct {
+	Key      string
+	Operator SelectorOperator
+	Values   []string
+}
+
+// Matches returns true if the labels meet the requirement.
+func (r SelectorRequirement) Matches(labels map[string]string) bool {
+	value, found := labels[r.Key]
+	switch r.Operator {
+	case SelectorExists:
+		return found
+	case SelectorDoesNotExist:
+		return !found
+	case SelectorEquals, SelectorIn:
+		return found && r.hasValue(value)
+	case SelectorNotEquals, SelectorNotIn:
+		return !found || !r.hasValue(value)
+	default:
+		return false
+	}
+}
+
+func (r SelectorRequirement) hasValue(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r SelectorRequirement) String() string {
+	switch r.Operator {
+	case SelectorExists:
+		return r.Key
+	case SelectorDoesNotExist:
+		return "!" + r.Key
+	case SelectorIn, SelectorNotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	default:
+		return r.Key + string(r.Operator) + strings.Join(r.Values, ",")
+	}
+}
+
+// Selector is a Kubernetes-style label selector. The labels match if they
+// meet all of its requirements, so an empty selector matches everything.
+type Selector []SelectorRequirement
+
+// Matches returns true if the labels meet all of the requirements.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for idx, r := range s {
+		parts[idx] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseSelector parses a label selector in the syntax used by kubectl, with
+// requirements separated by commas, such as:
+//
+//	tier=demo,cloud!=azure,region in (us-east,us-south),!deprecated
+//
+// The supported operators are =, ==, !=, in, notin, the key alone for
+// exists and ! before the key for does not exist.
+func ParseSelector(selector string) (Selector, error) {
+	var s Selector
+	for _, part := range splitSelector(selector) {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: %w", selector, err)
+		}
+		s = append(s, r)
+	}
+	return s, nil
+}
+
+// splitSelector splits the selector on the commas that are not in the value
+// lists of the in and notin operators.
+func splitSelector(selector string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for idx, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:idx])
+				start = idx + 1
+			}
+		}
+	}
+	return append(parts, selector[start:])
+}
+
+func parseRequirement(part string) (SelectorRequirement, error) {
+	if strings.HasPrefix(part, "!") && !strings.ContainsAny(part, "=") {
+		return newRequirement(strings.TrimSpace(part[1:]), SelectorDoesNotExist)
+	}
+	for _, op := range []string{"!=", "==", "="} {
+		if idx := strings.Index(part, op); idx >= 0 {
+			value := strings.TrimSpace(part[idx+len(op):])
+			operator := SelectorEquals
+			if op == "!=" {
+				operator = SelectorNotEquals
+			}
+			if strings.ContainsAny(value, "=!(), ") {
+				return SelectorRequirement{}, fmt.Errorf("invalid value %q", value)
+			}
+			return newRequirement(strings.TrimSpace(part[:idx]), operator, value)
+		}
+	}
+	fields := strings.Fields(part)
+	if len(fields) == 1 {
+		return newRequirement(fields[0], SelectorExists)
+	}
+	if len(fields) < 2 {
+		return SelectorRequirement{}, fmt.Errorf("invalid requirement %q", part)
+	}
+	operator := SelectorOperator(fields[1])
+	if operator != SelectorIn && operator != SelectorNotIn {
+		return SelectorRequirement{}, fmt.Errorf("unknown operator %q", fields[1])
+	}
+	list := strings.TrimSpace(strings.Join(fields[2:], " "))
+	if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+		return SelectorRequirement{}, fmt.Errorf("expected a list of values in parentheses in %q", part)
+	}
+	var values []string
+	for _, v := range strings.Split(list[1:len(list)-1], ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return SelectorRequirement{}, fmt.Errorf("no values in %q", part)
+	}
+	sort.Strings(values)
+	return newRequirement(fields[0], operator, values...)
+}
+
+func newRequirement(key string, operator SelectorOperator, values ...string) (SelectorRequirement, error) {
+	if len(key) == 0 || strings.ContainsAny(key, "=!(), ") {
+		return SelectorRequirement{}, fmt.Errorf("invalid key %q", key)
+	}
+	return SelectorRequirement{Key: key, Operator: operator, Values: values}, nil
+}
+
+// Filter returns the modules whose labels match the selector, in the same
+// order.
+func Filter(modules []*ModuleInfo, selector Selector) []*ModuleInfo {
+	var found []*ModuleInfo
+	for _, module := range modules {
+		if selector.Matches(module.Metadata.Labels) {
+			found = append(found, module)
+		}
+	}
+	return found
+}
+
+// Select returns the modules of the index whose labels match the selector.
+func (c *CatalogIndex) Select(selector Selector) []CatalogEntry {
+	var found []CatalogEntry
+	for _, entry := range c.Modules {
+		if selector.Matches(entry.Labels) {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
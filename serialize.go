@@ -0,0 +1,152 @@
+package atkmod
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The canonical* types mirror the manifest types with the fields in the same
+// order as the documented manifest file and with the empty fields omitted,
+// so that the order of the fields of the public types does not matter.
+
+type canonicalModule struct {
+	ApiVersion string             `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string             `json:"kind" yaml:"kind"`
+	Metadata   *canonicalMetadata `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Spec       *canonicalSpec     `json:"spec,omitempty" yaml:"spec,omitempty"`
+}
+
+type canonicalMetadata struct {
+	Namespace   string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Name        string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Generation  int64             `json:"generation,omitempty" yaml:"generation,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	DependsOn   []string          `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
+}
+
+type canonicalSpec struct {
+	Hooks     *canonicalHooks     `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	Lifecycle *canonicalLifecycle `json:"lifecycle,omitempty" yaml:"lifecycle,omitempty"`
+	Readiness *ReadinessInfo      `json:"readiness,omitempty" yaml:"readiness,omitempty"`
+	Requires  *RequiresInfo       `json:"requires,omitempty" yaml:"requires,omitempty"`
+	Includes  []IncludeInfo       `json:"includes,omitempty" yaml:"includes,omitempty"`
+}
+
+type canonicalHooks struct {
+	List     *canonicalImage `json:"list,omitempty" yaml:"list,omitempty"`
+	Validate *canonicalImage `json:"validate,omitempty" yaml:"validate,omitempty"`
+	GetState *canonicalImage `json:"get_state,omitempty" yaml:"get_state,omitempty"`
+	Info     *canonicalImage `json:"info,omitempty" yaml:"info,omitempty"`
+}
+
+type canonicalLifecycle struct {
+	PreDeploy  *canonicalImage `json:"pre_deploy,omitempty" yaml:"pre_deploy,omitempty"`
+	Deploy     *canonicalImage `json:"deploy,omitempty" yaml:"deploy,omitempty"`
+	PostDeploy *canonicalImage `json:"post_deploy,omitempty" yaml:"post_deploy,omitempty"`
+	OnCancel   *canonicalImage `json:"on_cancel,omitempty" yaml:"on_cancel,omitempty"`
+}
+
+type canonicalImage struct {
+	Image      string        `json:"image,omitempty" yaml:"image,omitempty"`
+	Script     string        `json:"script,omitempty" yaml:"script,omitempty"`
+	Command    []string      `json:"command,omitempty" yaml:"command,omitempty"`
+	Args       []string      `json:"args,omitempty" yaml:"args,omitempty"`
+	EnvVars    []EnvVarInfo  `json:"env,omitempty" yaml:"env,omitempty"`
+	Volumes    []VolumeInfo  `json:"volumeMounts,omitempty" yaml:"volumeMounts,omitempty"`
+	Scanners   []ScannerInfo `json:"scanners,omitempty" yaml:"scanners,omitempty"`
+	InheritEnv []string      `json:"inheritEnv,omitempty" yaml:"inheritEnv,omitempty"`
+	Sandbox    *SandboxInfo  `json:"sandbox,omitempty" yaml:"sandbox,omitempty"`
+	Artifacts  []string      `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+}
+
+func newCanonicalImage(i ImageInfo) *canonicalImage {
+	if i.Equal(ImageInfo{}) {
+		return nil
+	}
+	return &canonicalImage{
+		Image:      i.Image,
+		Script:     i.Script,
+		Command:    i.Command,
+		Args:       i.Args,
+		EnvVars:    i.EnvVars,
+		Volumes:    i.Volumes,
+		Scanners:   i.Scanners,
+		InheritEnv: i.InheritEnv,
+		Sandbox:    i.Sandbox,
+		Artifacts:  i.Artifacts,
+	}
+}
+
+func newCanonicalModule(m *ModuleInfo) *canonicalModule {
+	c := &canonicalModule{
+		ApiVersion: m.ApiVersion,
+		Kind:       m.Kind,
+	}
+	if !m.Metadata.Equal(MetadataInfo{}) {
+		c.Metadata = &canonicalMetadata{
+			Namespace:   m.Metadata.Namespace,
+			Name:        m.Metadata.Name,
+			Labels:      m.Metadata.Labels,
+			Generation:  m.Metadata.Generation,
+			Annotations: m.Metadata.Annotations,
+			DependsOn:   m.Metadata.DependsOn,
+		}
+	}
+
+	spec := m.Specifications
+	hooks := &canonicalHooks{
+		List:     newCanonicalImage(spec.Hooks.List),
+		Validate: newCanonicalImage(spec.Hooks.Validate),
+		GetState: newCanonicalImage(spec.Hooks.GetState),
+		Info:     newCanonicalImage(spec.Hooks.Info),
+	}
+	lifecycle := &canonicalLifecycle{
+		PreDeploy:  newCanonicalImage(spec.Lifecycle.PreDeploy),
+		Deploy:     newCanonicalImage(spec.Lifecycle.Deploy),
+		PostDeploy: newCanonicalImage(spec.Lifecycle.PostDeploy),
+		OnCancel:   newCanonicalImage(spec.Lifecycle.OnCancel),
+	}
+	if *hooks == (canonicalHooks{}) {
+		hooks = nil
+	}
+	if *lifecycle == (canonicalLifecycle{}) {
+		lifecycle = nil
+	}
+	if hooks != nil || lifecycle != nil || spec.Readiness != nil || spec.Requires != nil || len(spec.Includes) > 0 {
+		c.Spec = &canonicalSpec{Hooks: hooks, Lifecycle: lifecycle, Readiness: spec.Readiness, Requires: spec.Requires, Includes: spec.Includes}
+	}
+	return c
+}
+
+// Marshal returns the manifest as canonical YAML, with the fields in the
+// same order as the documented manifest file, two-space indentation and
+// empty fields omitted.
+func (m *ModuleInfo) Marshal() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := m.Save(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Save writes the manifest to the writer as canonical YAML.
+func (m *ModuleInfo) Save(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(newCanonicalModule(m)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// SaveJSON writes the manifest to the writer as indented JSON, in the same
+// canonical form as Save.
+func (m *ModuleInfo) SaveJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newCanonicalModule(m))
+}
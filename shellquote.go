@@ -0,0 +1,85 @@
+package atkmod
+
+import "strings"
+
+// shellQuote quotes the value for a POSIX shell if it has any characters
+// other than those that are safe unquoted, so that the command lines that
+// are logged can be copied and run.
+func shellQuote(value string) string {
+	if len(value) == 0 {
+		return "''"
+	}
+	for _, r := range value {
+		if !isShellSafe(r) {
+			return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+		}
+	}
+	return value
+}
+
+// shellJoin joins the arguments into a command line for a POSIX shell.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for idx, arg := range args {
+		quoted[idx] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func isShellSafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("_-+=@%:,./", r)
+}
+
+// shellSplit splits the command line into arguments as a POSIX shell does,
+// without expanding anything: the arguments are separated by spaces, and
+// the quotes and backslashes are removed. A quote that is not closed quotes
+// the rest of the line.
+func shellSplit(line string) []string {
+	var args []string
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\\\"$`", r) {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args
+}
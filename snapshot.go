@@ -0,0 +1,374 @@
+package atkmod
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// VolumeManager is implemented by the runners that can list and remove the
+// named volumes of their containers, so that the volumes a deployment
+// creates can be removed by Undo.
+type VolumeManager interface {
+	// Volumes returns the names of the volumes of the run with the ID,
+	// which are those with the RunIDLabel of the run or with the run ID in
+	// their name, so that the volumes of other deployments and processes
+	// are left alone.
+	Volumes(ctx *RunContext, runID string) ([]string, error)
+	RemoveVolume(ctx *RunContext, name string) error
+}
+
+// Volumes returns the names of the volumes of the run with podman volume ls.
+func (r *CliModuleRunner) Volumes(ctx *RunContext, runID string) ([]string, error) {
+	path, global := r.PodmanCliCommandBuilder.globalArgs()
+	cmd := exec.Command(path, append(global, "volume", "ls", "--format", `{{.Name}} {{index .Labels "`+RunIDLabel+`"}}`)...)
+	ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the volumes: %w", err)
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		name, label, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if len(name) > 0 && (label == runID || strings.Contains(name, runID)) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// RemoveVolume removes the volume with podman volume rm.
+func (r *CliModuleRunner) RemoveVolume(ctx *RunContext, name string) error {
+	path, global := r.PodmanCliCommandBuilder.globalArgs()
+	cmd := exec.Command(path, append(global, "volume", "rm", name)...)
+	ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not remove volume %s: %w: %s", name, err, out)
+	}
+	return nil
+}
+
+// EnvironmentChanges are the artifacts on the host that a deployment
+// created, which are found by comparing snapshots of the host taken before
+// and after it. See WithEnvironmentSnapshot.
+type EnvironmentChanges struct {
+	// Files are the files and directories that were created in the
+	// workspace, as absolute paths. A directory that was created is listed
+	// without the files in it.
+	Files []string `json:"files,omitempty" yaml:"files,omitempty"`
+	// KubeContexts are the contexts that were written to the kubeconfig
+	// files, as the path of the file followed by # and the name of the
+	// context.
+	KubeContexts []string `json:"kubeContexts,omitempty" yaml:"kubeContexts,omitempty"`
+	// KubeClusters and KubeUsers are the clusters and the users that were
+	// written to the kubeconfig files, as KubeContexts are.
+	KubeClusters []string `json:"kubeClusters,omitempty" yaml:"kubeClusters,omitempty"`
+	KubeUsers    []string `json:"kubeUsers,omitempty" yaml:"kubeUsers,omitempty"`
+	// Volumes are the named volumes of the run that were created, which
+	// are those with the RunIDLabel of the run or with the run ID in their
+	// name.
+	Volumes []string `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+}
+
+// IsEmpty returns true if the deployment did not change anything.
+func (c *EnvironmentChanges) IsEmpty() bool {
+	return c == nil || len(c.Files)+len(c.KubeContexts)+len(c.KubeClusters)+len(c.KubeUsers)+len(c.Volumes) == 0
+}
+
+// environmentSnapshot is what is on the host before or after a deployment.
+type environmentSnapshot struct {
+	files map[string]bool
+	// kubeconfigs are the entries of each kubeconfig file.
+	kubeconfigs map[string]*kubeEntries
+	volumes     map[string]bool
+}
+
+// kubeEntries are the names of the entries of a kubeconfig file.
+type kubeEntries struct {
+	current  string
+	contexts map[string]bool
+	clusters map[string]bool
+	users    map[string]bool
+}
+
+// WithEnvironmentSnapshot records the artifacts that the deployment creates
+// on the host: the files in the workspace of the module, the contexts in the
+// kubeconfig files that are given with WithKubeconfig, or else the default
+// one, and the named volumes of the run, if the runner is a VolumeManager.
+// They are reported in the Changes of the result and are removed by Undo.
+// The stages that create volumes give them the RunIDLabel, or put the run ID
+// from the ATK_RUN_ID environment variable in their names, so that they are
+// told apart from the volumes of other deployments.
+func WithEnvironmentSnapshot() DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.snapshot = true
+	}
+}
+
+// Changes returns what the last deployment created on the host, or nil if
+// it did not take snapshots.
+func (m *DeployableModule) Changes() *EnvironmentChanges {
+	return m.changes
+}
+
+// kubeconfigs returns the kubeconfig files that the stages have access to.
+func (m *DeployableModule) kubeconfigs() []string {
+	paths := m.kubeconfigPaths
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	files := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if file, err := kubeconfigPath(p); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// takeSnapshot records what is on the host. The parts that cannot be read,
+// such as a kubeconfig file that does not exist, are empty.
+func (m *DeployableModule) takeSnapshot(ctx *RunContext) *environmentSnapshot {
+	s := &environmentSnapshot{files: make(map[string]bool), kubeconfigs: make(map[string]*kubeEntries), volumes: make(map[string]bool)}
+	if dir := m.workspace(); len(dir) > 0 {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && path != dir {
+				s.files[path] = true
+			}
+			return nil
+		})
+	}
+	for _, file := range m.kubeconfigs() {
+		s.kubeconfigs[file] = readKubeEntries(file)
+	}
+	if volumes, ok := m.runner.(VolumeManager); ok {
+		names, err := volumes.Volumes(ctx, m.runID)
+		if err != nil {
+			ctx.Log.WithField(RunIDLogField, m.runID).Warnf("could not take a snapshot of the volumes: %v", err)
+		}
+		for _, name := range names {
+			s.volumes[name] = true
+		}
+	}
+	return s
+}
+
+// kubeNamed is an entry of a kubeconfig file.
+type kubeNamed struct {
+	Name string `yaml:"name"`
+}
+
+// readKubeEntries returns the names of the entries of the kubeconfig file,
+// which has none if it cannot be read.
+func readKubeEntries(file string) *kubeEntries {
+	entries := &kubeEntries{contexts: make(map[string]bool), clusters: make(map[string]bool), users: make(map[string]bool)}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return entries
+	}
+	var config struct {
+		CurrentContext string      `yaml:"current-context"`
+		Contexts       []kubeNamed `yaml:"contexts"`
+		Clusters       []kubeNamed `yaml:"clusters"`
+		Users          []kubeNamed `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return entries
+	}
+	entries.current = config.CurrentContext
+	for _, c := range config.Contexts {
+		entries.contexts[c.Name] = true
+	}
+	for _, c := range config.Clusters {
+		entries.clusters[c.Name] = true
+	}
+	for _, u := range config.Users {
+		entries.users[u.Name] = true
+	}
+	return entries
+}
+
+// newKubeEntries returns the entries that are in the file but were not in
+// it before, as the path of the file followed by # and the name.
+func newKubeEntries(file string, now map[string]bool, before map[string]bool) []string {
+	var added []string
+	for name := range now {
+		if !before[name] && len(name) > 0 {
+			added = append(added, file+"#"+name)
+		}
+	}
+	return added
+}
+
+// changesSince returns what is in the snapshot but not in the one before it.
+func (s *environmentSnapshot) changesSince(before *environmentSnapshot) *EnvironmentChanges {
+	changes := &EnvironmentChanges{}
+	for path := range s.files {
+		if before.files[path] || s.files[filepath.Dir(path)] && !before.files[filepath.Dir(path)] {
+			continue
+		}
+		changes.Files = append(changes.Files, path)
+	}
+	for file, entries := range s.kubeconfigs {
+		previous := before.kubeconfigs[file]
+		if previous == nil {
+			previous = &kubeEntries{}
+		}
+		changes.KubeContexts = append(changes.KubeContexts, newKubeEntries(file, entries.contexts, previous.contexts)...)
+		changes.KubeClusters = append(changes.KubeClusters, newKubeEntries(file, entries.clusters, previous.clusters)...)
+		changes.KubeUsers = append(changes.KubeUsers, newKubeEntries(file, entries.users, previous.users)...)
+	}
+	for name := range s.volumes {
+		if !before.volumes[name] {
+			changes.Volumes = append(changes.Volumes, name)
+		}
+	}
+	sort.Strings(changes.Files)
+	sort.Strings(changes.KubeContexts)
+	sort.Strings(changes.KubeClusters)
+	sort.Strings(changes.KubeUsers)
+	sort.Strings(changes.Volumes)
+	return changes
+}
+
+// Undo removes what the last deployment created on the host, as recorded by
+// WithEnvironmentSnapshot, for a best-effort cleanup of a module that has no
+// lifecycle to destroy what it deployed. Only the local artifacts are
+// removed, not the resources that the module deployed. A context that is
+// removed from a kubeconfig file is no longer its current context, which
+// goes back to what it was before the deployment. Undo goes on after an
+// error and returns the errors together.
+func (m *DeployableModule) Undo(ctx *RunContext) error {
+	if m.changes == nil {
+		return errors.New("there are no changes to undo; the deployment did not take snapshots")
+	}
+	var failures []string
+	for _, path := range m.changes.Files {
+		if err := os.RemoveAll(path); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	removed := make(map[string]*kubeEntries)
+	var files []string
+	add := func(entries []string, set func(*kubeEntries) map[string]bool) {
+		for _, e := range entries {
+			idx := strings.LastIndex(e, "#")
+			file := e[:idx]
+			if _, ok := removed[file]; !ok {
+				files = append(files, file)
+				removed[file] = &kubeEntries{contexts: make(map[string]bool), clusters: make(map[string]bool), users: make(map[string]bool)}
+			}
+			set(removed[file])[e[idx+1:]] = true
+		}
+	}
+	add(m.changes.KubeContexts, func(k *kubeEntries) map[string]bool { return k.contexts })
+	add(m.changes.KubeClusters, func(k *kubeEntries) map[string]bool { return k.clusters })
+	add(m.changes.KubeUsers, func(k *kubeEntries) map[string]bool { return k.users })
+	for _, file := range files {
+		previous := ""
+		if before := m.before.kubeconfigs[file]; before != nil {
+			previous = before.current
+		}
+		if err := removeKubeEntries(file, removed[file], previous); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(m.changes.Volumes) > 0 {
+		if volumes, ok := m.runner.(VolumeManager); ok {
+			for _, name := range m.changes.Volumes {
+				if err := volumes.RemoveVolume(ctx, name); err != nil {
+					failures = append(failures, err.Error())
+				}
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("could not undo all of the changes of module %s: %s", m.module.Metadata.Name, strings.Join(failures, "; "))
+	}
+	m.changes = &EnvironmentChanges{}
+	return nil
+}
+
+// removeKubeEntries removes the contexts, clusters and users from the
+// kubeconfig file, keeping the rest of the file as it is. The clusters and
+// the users that the contexts that are kept still refer to are kept. If the
+// current context is removed, it is set to the previous one.
+func removeKubeEntries(file string, remove *kubeEntries, previous string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("could not parse the kubeconfig %s: %w", file, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("the kubeconfig %s is not a mapping", file)
+	}
+	root := doc.Content[0]
+	contexts := mappingNode(root, "contexts")
+	if contexts != nil {
+		contexts.Content = removeNamed(contexts.Content, remove.contexts)
+		// Keeps what the remaining contexts refer to.
+		for _, c := range contexts.Content {
+			context := mappingNode(c, "context")
+			delete(remove.clusters, mappingValue(context, "cluster"))
+			delete(remove.users, mappingValue(context, "user"))
+		}
+	}
+	if clusters := mappingNode(root, "clusters"); clusters != nil {
+		clusters.Content = removeNamed(clusters.Content, remove.clusters)
+	}
+	if users := mappingNode(root, "users"); users != nil {
+		users.Content = removeNamed(users.Content, remove.users)
+	}
+	for idx := 0; idx+1 < len(root.Content); idx += 2 {
+		if key, value := root.Content[idx], root.Content[idx+1]; key.Value == "current-context" && remove.contexts[value.Value] {
+			value.Value = previous
+		}
+	}
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, out, 0600)
+}
+
+// removeNamed returns the entries without those with the names.
+func removeNamed(entries []*yaml.Node, names map[string]bool) []*yaml.Node {
+	kept := entries[:0]
+	for _, e := range entries {
+		if !names[mappingValue(e, "name")] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// mappingNode returns the value of the key in the mapping node, or nil.
+func mappingNode(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			return node.Content[idx+1]
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the scalar value of the key in the mapping node.
+func mappingValue(node *yaml.Node, key string) string {
+	if value := mappingNode(node, key); value != nil {
+		return value.Value
+	}
+	return ""
+}
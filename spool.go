@@ -0,0 +1,204 @@
+package atkmod
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// DefaultSpoolMemoryLimit is the number of bytes that a SpoolBuffer
+	// keeps in memory before it spills its content to a temporary file.
+	DefaultSpoolMemoryLimit = 1 << 20
+	// DefaultSpoolHeadTailSize is the number of bytes at the start and at
+	// the end of the content that a SpoolBuffer keeps in memory after it has
+	// spilled to disk.
+	DefaultSpoolHeadTailSize = 64 << 10
+)
+
+// SpoolBuffer captures output in memory until it grows over MemoryLimit, and
+// then spills all of it to a temporary file, keeping only the head and the
+// tail of the content in memory. This keeps the memory used to capture the
+// output of long running containers, such as Terraform or Ansible, bounded.
+//
+// A SpoolBuffer is safe for concurrent use. Close removes the temporary
+// file.
+type SpoolBuffer struct {
+	mu sync.Mutex
+	// MemoryLimit is the number of bytes kept in memory before spilling.
+	MemoryLimit int
+	// HeadTailSize is the number of bytes of the head and of the tail of the
+	// content that are kept in memory once spilled.
+	HeadTailSize int
+	// Dir is the directory for the temporary file, or the default directory
+	// for temporary files if empty.
+	Dir string
+
+	mem    bytes.Buffer
+	head   []byte
+	tail   []byte
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// NewSpoolBuffer creates a SpoolBuffer that spills to disk when its content
+// grows over memoryLimit bytes. If memoryLimit is zero or less,
+// DefaultSpoolMemoryLimit is used.
+func NewSpoolBuffer(memoryLimit int) *SpoolBuffer {
+	if memoryLimit <= 0 {
+		memoryLimit = DefaultSpoolMemoryLimit
+	}
+	headTail := DefaultSpoolHeadTailSize
+	if headTail > memoryLimit {
+		headTail = memoryLimit
+	}
+	return &SpoolBuffer{MemoryLimit: memoryLimit, HeadTailSize: headTail}
+}
+
+// Write adds p to the content of the buffer, spilling it to disk if it has
+// grown over the memory limit.
+func (b *SpoolBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.file == nil && b.mem.Len()+len(p) <= b.MemoryLimit {
+		b.size += int64(len(p))
+		return b.mem.Write(p)
+	}
+	if b.closed {
+		return 0, os.ErrClosed
+	}
+	if b.file == nil {
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := b.file.Write(p)
+	b.size += int64(n)
+	b.keep(p[:n])
+	return n, err
+}
+
+// spill moves the content in memory to a new temporary file.
+func (b *SpoolBuffer) spill() error {
+	file, err := os.CreateTemp(b.Dir, "atkmod-output-*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(b.mem.Bytes()); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	b.file = file
+	b.keep(b.mem.Bytes())
+	b.mem = bytes.Buffer{}
+	return nil
+}
+
+// keep updates the head and the tail that are kept in memory with p.
+func (b *SpoolBuffer) keep(p []byte) {
+	if room := b.HeadTailSize - len(b.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.head = append(b.head, p[:room]...)
+	}
+	b.tail = append(b.tail, p...)
+	if over := len(b.tail) - b.HeadTailSize; over > 0 {
+		b.tail = append(b.tail[:0:0], b.tail[over:]...)
+	}
+}
+
+// Len returns the total number of bytes written to the buffer.
+func (b *SpoolBuffer) Len() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// Spilled returns true if the content has been spilled to disk.
+func (b *SpoolBuffer) Spilled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.file != nil
+}
+
+// Head returns a copy of up to HeadTailSize bytes at the start of the
+// content.
+func (b *SpoolBuffer) Head() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file != nil {
+		return append([]byte(nil), b.head...)
+	}
+	content := b.mem.Bytes()
+	if len(content) > b.HeadTailSize {
+		content = content[:b.HeadTailSize]
+	}
+	return append([]byte(nil), content...)
+}
+
+// Tail returns a copy of up to HeadTailSize bytes at the end of the content.
+func (b *SpoolBuffer) Tail() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file != nil {
+		return append([]byte(nil), b.tail...)
+	}
+	content := b.mem.Bytes()
+	if len(content) > b.HeadTailSize {
+		content = content[len(content)-b.HeadTailSize:]
+	}
+	return append([]byte(nil), content...)
+}
+
+// Reader returns a reader for the whole content of the buffer as it is when
+// Reader is called. The reader must be closed.
+func (b *SpoolBuffer) Reader() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file == nil {
+		content := append([]byte(nil), b.mem.Bytes()...)
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	file, err := os.Open(b.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, b.size), file}, nil
+}
+
+// String returns the whole content of the buffer. For content that has been
+// spilled to disk, use Reader instead.
+func (b *SpoolBuffer) String() string {
+	r, err := b.Reader()
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+	content, _ := io.ReadAll(r)
+	return string(content)
+}
+
+// Close removes the temporary file, if the content was spilled to disk.
+// The head and the tail are still available after Close.
+func (b *SpoolBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file == nil || b.closed {
+		return nil
+	}
+	b.closed = true
+	name := b.file.Name()
+	err := b.file.Close()
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	return err
+}
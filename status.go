@@ -0,0 +1,186 @@
+package atkmod
+
+import (
+	"time"
+)
+
+// ConditionType is the type of a condition of the status of a deployment.
+type ConditionType string
+
+const (
+	// ConditionValidated is true once the module has been validated.
+	ConditionValidated ConditionType = "Validated"
+	// ConditionDeployed is true once the deploy stage has finished.
+	ConditionDeployed ConditionType = "Deployed"
+	// ConditionReady is true once the whole lifecycle has finished and the
+	// module is ready to be used.
+	ConditionReady ConditionType = "Ready"
+)
+
+// ConditionStatus is the status of a condition, which is True, False or
+// Unknown, as in Kubernetes.
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// Condition is a Kubernetes-style condition of the status of a deployment.
+type Condition struct {
+	Type   ConditionType   `json:"type" yaml:"type"`
+	Status ConditionStatus `json:"status" yaml:"status"`
+	// LastTransitionTime is when the status of the condition last changed.
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitempty" yaml:"lastTransitionTime,omitempty"`
+	// Reason is a CamelCase word for the last transition.
+	Reason  string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// ModuleStatus is the status of a deployment, in the form of the status
+// subresource of a Kubernetes object, so that other systems can read it in
+// the same way as the status of their own resources.
+type ModuleStatus struct {
+	Module    string `json:"module" yaml:"module"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	RunID     string `json:"runId" yaml:"runId"`
+	State     State  `json:"state" yaml:"state"`
+	// ObservedGeneration is the generation of the manifest that the
+	// deployment was created with.
+	ObservedGeneration int64       `json:"observedGeneration,omitempty" yaml:"observedGeneration,omitempty"`
+	Conditions         []Condition `json:"conditions" yaml:"conditions"`
+	// Includes are the statuses of the included modules, in the order that
+	// they were deployed.
+	Includes []ModuleStatus `json:"includes,omitempty" yaml:"includes,omitempty"`
+}
+
+// Condition returns the condition of the given type, or nil if the status
+// does not have it.
+func (s *ModuleStatus) Condition(t ConditionType) *Condition {
+	for idx := range s.Conditions {
+		if s.Conditions[idx].Type == t {
+			return &s.Conditions[idx]
+		}
+	}
+	return nil
+}
+
+// IsTrue returns true if the condition of the given type is True.
+func (s *ModuleStatus) IsTrue(t ConditionType) bool {
+	c := s.Condition(t)
+	return c != nil && c.Status == ConditionTrue
+}
+
+// Status returns the status of the deployment, with the Validated, Deployed
+// and Ready conditions. It can be marshalled to YAML or JSON.
+func (m *DeployableModule) Status() ModuleStatus {
+	if m.conditions == nil {
+		m.updateConditions(nil)
+	}
+	conditions := make([]Condition, len(m.conditions))
+	copy(conditions, m.conditions)
+	status := ModuleStatus{
+		Module:             m.module.Metadata.Name,
+		Namespace:          m.module.Metadata.Namespace,
+		RunID:              m.runID,
+		State:              m.machine.Current(),
+		ObservedGeneration: m.module.Metadata.Generation,
+		Conditions:         conditions,
+	}
+	for _, sub := range m.Includes() {
+		status.Includes = append(status.Includes, sub.Status())
+	}
+	return status
+}
+
+// reached returns true if the deployment is in the given state or in a state
+// after it in the execution order.
+func (m *DeployableModule) reached(state State) bool {
+	current := m.machine.Current()
+	if m.IsErrored() || current == Cancelled {
+		current = m.machine.Previous()
+	}
+	at, target := -1, -1
+	for idx, s := range m.machine.Order() {
+		if s == current && at < 0 {
+			at = idx
+		}
+		if s == state && target < 0 {
+			target = idx
+		}
+	}
+	if current == state {
+		return true
+	}
+	return at >= 0 && target >= 0 && at > target
+}
+
+// updateConditions sets the conditions for the current state. The transition
+// time of a condition only changes when its status changes.
+func (m *DeployableModule) updateConditions(err error) {
+	message := ""
+	if err == nil && m.IsErrored() && m.runCtx != nil {
+		if errs := m.runCtx.AllErrors(); len(errs) > 0 {
+			err = errs[len(errs)-1]
+		}
+	}
+	if err != nil {
+		message = err.Error()
+	}
+	failed := m.IsErrored() && !m.reached(Deployed)
+
+	switch {
+	case m.reached(Validated):
+		m.setCondition(ConditionValidated, ConditionTrue, "Validated", "")
+	case m.IsErrored():
+		m.setCondition(ConditionValidated, ConditionFalse, "ValidationFailed", message)
+	default:
+		m.setCondition(ConditionValidated, ConditionUnknown, "Pending", "")
+	}
+
+	switch {
+	case m.reached(Deployed):
+		m.setCondition(ConditionDeployed, ConditionTrue, "Deployed", "")
+	case failed:
+		m.setCondition(ConditionDeployed, ConditionFalse, "DeployFailed", message)
+	case m.reached(PreDeploying):
+		m.setCondition(ConditionDeployed, ConditionFalse, "Deploying", "")
+	default:
+		m.setCondition(ConditionDeployed, ConditionUnknown, "Pending", "")
+	}
+
+	switch {
+	case m.machine.Current() == Done:
+		m.setCondition(ConditionReady, ConditionTrue, "Ready", "")
+	case m.machine.Current() == Cancelled:
+		m.setCondition(ConditionReady, ConditionFalse, "Cancelled", "")
+	case m.IsErrored():
+		m.setCondition(ConditionReady, ConditionFalse, "Failed", message)
+	case m.reached(PreDeploying):
+		m.setCondition(ConditionReady, ConditionFalse, "Deploying", "")
+	default:
+		m.setCondition(ConditionReady, ConditionUnknown, "Pending", "")
+	}
+}
+
+func (m *DeployableModule) setCondition(t ConditionType, status ConditionStatus, reason string, message string) {
+	for idx := range m.conditions {
+		c := &m.conditions[idx]
+		if c.Type != t {
+			continue
+		}
+		if c.Status != status {
+			c.LastTransitionTime = time.Now().UTC()
+		}
+		c.Status, c.Reason, c.Message = status, reason, message
+		return
+	}
+	m.conditions = append(m.conditions, Condition{
+		Type:               t,
+		Status:             status,
+		LastTransitionTime: time.Now().UTC(),
+		Reason:             reason,
+		Message:            message,
+	})
+}
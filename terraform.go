@@ -0,0 +1,116 @@
+package atkmod
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TFVarPrefix is the prefix of the environment variables that terraform
+// reads as the values of its input variables.
+const TFVarPrefix = "TF_VAR_"
+
+// TerraformVarFile is the name of the variable file that is written to the
+// workspace by WithTerraformVariables. Terraform loads it without -var-file
+// when it runs in the workspace, as it ends with .auto.tfvars.json.
+const TerraformVarFile = "atk.auto.tfvars.json"
+
+// sensitiveNameParts are the parts of the names of variables that are
+// treated as sensitive even if they are not marked as such.
+var sensitiveNameParts = []string{"password", "passwd", "secret", "token", "api_key", "apikey", "private_key", "credentials"}
+
+// IsSensitiveVariable returns true if the variable is marked as sensitive,
+// or if its name looks like that of a password, a token or a key, such as
+// TF_VAR_fyre_api_key.
+func IsSensitiveVariable(v EventDataVarInfo) bool {
+	if v.Sensitive || v.Type == VarTypePassword {
+		return true
+	}
+	name := strings.ToLower(v.Name)
+	for _, part := range sensitiveNameParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// TerraformVarName returns the name of the terraform variable, which is the
+// name of the variable without the TF_VAR_ prefix.
+func TerraformVarName(name string) string {
+	return strings.TrimPrefix(name, TFVarPrefix)
+}
+
+// TerraformEnv returns the variables as TF_VAR_ environment variables. The
+// names that already have the prefix, as the list hooks of terraform modules
+// usually report them, are kept as they are. The variables without a value
+// are left out, so that terraform uses its own defaults.
+func TerraformEnv(data EventData) []EnvVarInfo {
+	env := make([]EnvVarInfo, 0, len(data.Variables))
+	for _, v := range data.Variables {
+		value := Iif(v.Value, v.Default)
+		if len(v.Name) == 0 || len(value) == 0 {
+			continue
+		}
+		env = append(env, EnvVarInfo{Name: TFVarPrefix + TerraformVarName(v.Name), Value: value})
+	}
+	return env
+}
+
+// WriteTerraformVarFile writes the variables that have a value to
+// TerraformVarFile in the directory as JSON, keyed by the names of the
+// terraform variables, and returns the path of the file. The file is only
+// readable by the user, as it may have sensitive values.
+func WriteTerraformVarFile(dir string, data EventData) (string, error) {
+	values := make(map[string]string, len(data.Variables))
+	for _, v := range data.Variables {
+		if value := Iif(v.Value, v.Default); len(v.Name) > 0 && len(value) > 0 {
+			values[TerraformVarName(v.Name)] = value
+		}
+	}
+	content, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, TerraformVarFile)
+	return path, os.WriteFile(path, append(content, '\n'), 0600)
+}
+
+// WithTerraformVariables passes the variables of the deployment to each hook
+// and stage as TF_VAR_ environment variables, and writes them to
+// TerraformVarFile in the workspace that is mounted at /workspace, if any.
+// The values of the sensitive variables are masked in the commands that are
+// logged.
+func WithTerraformVariables() DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.terraform = true
+	}
+}
+
+// withTerraform adds the variables of the deployment to the image for
+// terraform, as described by WithTerraformVariables. The environment
+// variables that the image sets itself take precedence.
+func (m *DeployableModule) withTerraform(ctx *RunContext, img *ImageInfo) error {
+	if !m.terraform {
+		return nil
+	}
+	vars := m.Variables()
+	for _, v := range vars.Variables {
+		if IsSensitiveVariable(v) {
+			ctx.Mask(Iif(v.Value, v.Default))
+		}
+	}
+	for _, e := range TerraformEnv(vars) {
+		if !hasEnvVar(*img, e.Name) {
+			img.EnvVars = append(img.EnvVars, e)
+		}
+	}
+	for _, v := range img.Volumes {
+		if v.MountPath == "/workspace" {
+			_, err := WriteTerraformVarFile(v.Name, vars)
+			return err
+		}
+	}
+	return nil
+}
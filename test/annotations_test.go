@@ -0,0 +1,46 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationsRoundTrip(t *testing.T) {
+	module := atk.NewModuleScaffold("mymodule")
+	module.Metadata.SetAnnotation(atk.AnnotationDocsURL, "https://example.com/docs/mymodule")
+	module.Metadata.SetAnnotation(atk.AnnotationOwner, "platform-team")
+	module.Metadata.SetAnnotation("example.com/build", "1234")
+
+	path := filepath.Join(t.TempDir(), "itz-manifest.yaml")
+	content, err := module.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, content, 0644))
+	assert.Contains(t, string(content), "annotations:")
+
+	loaded, err := atk.NewAtkManifestFileLoader().Load(path)
+	require.NoError(t, err)
+	assert.True(t, module.Equal(loaded))
+	assert.Equal(t, "https://example.com/docs/mymodule", loaded.Metadata.DocsURL())
+	assert.Equal(t, "platform-team", loaded.Metadata.Owner())
+	assert.Empty(t, loaded.Metadata.SupportContact())
+	assert.Equal(t, "1234", loaded.Metadata.Annotation("example.com/build"))
+
+	cp := loaded.DeepCopy()
+	cp.Metadata.SetAnnotation(atk.AnnotationOwner, "changed")
+	assert.Equal(t, "platform-team", loaded.Metadata.Owner())
+	assert.False(t, loaded.Equal(cp))
+}
+
+func TestLintDocsURLAnnotation(t *testing.T) {
+	module := atk.NewModuleScaffold("mymodule")
+	module.Metadata.SetAnnotation(atk.AnnotationDocsURL, "docs/readme.md")
+
+	findings := atk.Lint(module)
+	assert.Equal(t, []string{"ATK012"}, ruleIDs(findings))
+	assert.Equal(t, "metadata.annotations[itzcli/docs-url]", findings[0].Path)
+}
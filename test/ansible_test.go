@@ -0,0 +1,42 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAnsibleStage(t *testing.T) {
+	stage := atk.NewAnsibleStage("site.yml")
+
+	assert.Equal(t, atk.DefaultAnsibleRunnerImage, stage.Image)
+	assert.Contains(t, stage.EnvVars, atk.EnvVarInfo{Name: "RUNNER_PLAYBOOK", Value: "site.yml"})
+	assert.Contains(t, stage.Volumes, atk.VolumeInfo{Name: atk.DefaultScaffoldWorkspace, MountPath: atk.AnsibleRunnerDir})
+	assert.Contains(t, stage.Volumes, atk.VolumeInfo{Name: atk.DefaultScaffoldWorkspace, MountPath: "/workspace"})
+	for _, e := range stage.EnvVars {
+		assert.NotEqual(t, "ANSIBLE_INVENTORY", e.Name)
+	}
+}
+
+func TestNewAnsibleStageWithOptions(t *testing.T) {
+	stage := atk.NewAnsibleStage("deploy.yml",
+		atk.WithAnsibleImage("quay.io/example/runner:1.0"),
+		atk.WithAnsibleWorkspace("/tmp/ws"),
+		atk.WithAnsibleInventory("inventory/hosts.yaml"),
+		atk.WithAnsibleEnv("ANSIBLE_NOCOLOR", "False"),
+		atk.WithAnsibleEnv("ANSIBLE_VERBOSITY", "2"))
+
+	assert.Equal(t, "quay.io/example/runner:1.0", stage.Image)
+	assert.Contains(t, stage.EnvVars, atk.EnvVarInfo{Name: "ANSIBLE_INVENTORY", Value: "/runner/inventory/hosts.yaml"})
+	assert.Contains(t, stage.EnvVars, atk.EnvVarInfo{Name: "ANSIBLE_NOCOLOR", Value: "False"})
+	assert.NotContains(t, stage.EnvVars, atk.EnvVarInfo{Name: "ANSIBLE_NOCOLOR", Value: "True"})
+	assert.Contains(t, stage.EnvVars, atk.EnvVarInfo{Name: "ANSIBLE_VERBOSITY", Value: "2"})
+	assert.Contains(t, stage.Volumes, atk.VolumeInfo{Name: "/tmp/ws", MountPath: "/workspace"})
+}
+
+func TestAnsibleModuleIsClean(t *testing.T) {
+	module := atk.NewModuleScaffold("mymodule")
+	module.Specifications.Lifecycle.Deploy = atk.NewAnsibleStage("site.yml")
+	assert.False(t, atk.HasErrors(atk.Lint(module)))
+}
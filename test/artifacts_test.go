@@ -0,0 +1,58 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageArtifacts(t *testing.T) {
+	workspace := t.TempDir()
+	artifacts := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(workspace, "logs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "logs", "apply.log"), []byte("applied"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "kubeconfig"), []byte("apiVersion: v1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "main.tf"), []byte(""), 0644))
+
+	module := atktest.Manifest("artifacts")
+	module.Specifications.Hooks = atk.HookInfo{}
+	module.Specifications.Lifecycle.Deploy.Volumes = []atk.VolumeInfo{{Name: workspace, MountPath: "/workspace"}}
+	module.Specifications.Lifecycle.Deploy.Artifacts = []string{"logs", "/workspace/kubeconfig", "*.url"}
+	runner := atktest.NewFakeRunner().On("artifacts-deploy", atktest.Response{ExitCode: 1})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithArtifactsDir(artifacts))
+
+	// The artifacts are collected even if the stage fails.
+	result, err := deployment.Deploy(runCtx)
+	require.Error(t, err)
+	dest := filepath.Join(artifacts, "atktest", "artifacts", deployment.RunID(), string(atk.Deploying))
+	assert.Equal(t, []atk.Artifact{
+		{State: atk.Deploying, Path: "logs/apply.log", File: filepath.Join(dest, "logs", "apply.log"), Size: 7},
+		{State: atk.Deploying, Path: "kubeconfig", File: filepath.Join(dest, "kubeconfig"), Size: 14},
+	}, result.Artifacts)
+	content, err := os.ReadFile(filepath.Join(dest, "logs", "apply.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "applied", string(content))
+	assert.NoFileExists(t, filepath.Join(dest, "main.tf"))
+}
+
+func TestLintArtifacts(t *testing.T) {
+	module := atktest.Manifest("artifacts")
+	module.Specifications.Lifecycle.Deploy.Artifacts = []string{"out/*.log", "../secrets", "/etc/passwd", "[bad"}
+	var messages []string
+	for _, f := range atk.Lint(module) {
+		if f.RuleID == "ATK016" {
+			messages = append(messages, f.Path+": "+f.Message)
+		}
+	}
+	assert.Equal(t, []string{
+		`spec.lifecycle.deploy.artifacts[1]: artifact "../secrets" is not under /workspace`,
+		`spec.lifecycle.deploy.artifacts[2]: artifact "/etc/passwd" is not under /workspace`,
+		`spec.lifecycle.deploy.artifacts[3]: invalid artifact pattern "[bad"`,
+	}, messages)
+}
@@ -4,10 +4,10 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os"
 	"testing"
 
 	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
 	logger "github.com/sirupsen/logrus"
 	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
@@ -53,16 +53,11 @@ func TestRunListHook(t *testing.T) {
 	outbuff := new(bytes.Buffer)
 	errbuff := new(bytes.Buffer)
 
-	log, _ := logtest.NewNullLogger()
-	log.SetFormatter(&logger.TextFormatter{})
-	log.SetOutput(os.Stdout)
-	log.SetLevel(logger.DebugLevel)
-
 	runCtx := &atk.RunContext{
 		Context: context.Background(),
 		Out:     outbuff,
 		Err:     errbuff,
-		Log:     *log,
+		Log:     testLogger(),
 	}
 	module := atk.NewDeployableModule(runCtx, manifest)
 
@@ -80,18 +75,11 @@ func TestRunHappyPathFullDeployment(t *testing.T) {
 	outbuff := new(bytes.Buffer)
 	errbuff := new(bytes.Buffer)
 
-	// TODO: Move this to a private func
-	// This is only required for unit testing, else normal logrus logger works.
-	log, _ := logtest.NewNullLogger()
-	log.SetFormatter(&logger.TextFormatter{})
-	log.SetOutput(os.Stdout)
-	log.SetLevel(logger.DebugLevel)
-
 	runCtx := &atk.RunContext{
 		Context: context.Background(),
 		Out:     outbuff,
 		Err:     errbuff,
-		Log:     *log,
+		Log:     testLogger(),
 	}
 	module := atk.NewDeployableModule(runCtx, manifest)
 
@@ -100,7 +88,7 @@ func TestRunHappyPathFullDeployment(t *testing.T) {
 	for next, hasNext := module.Itr(); hasNext; i++ {
 		step, hasNext = next()
 		step(runCtx, module)
-		log.Infof("Step %d; running stage %s with output: %s", i, module.State(), outbuff.String())
+		runCtx.Log.Infof("Step %d; running stage %s with output: %s", i, module.State(), outbuff.String())
 	}
 
 	assert.False(t, module.IsErrored())
@@ -114,18 +102,11 @@ func TestRunDeploymentBadCommends(t *testing.T) {
 	outbuff := new(bytes.Buffer)
 	errbuff := new(bytes.Buffer)
 
-	// TODO: Move this to a private func
-	// This is only required for unit testing, else normal logrus logger works.
-	log, _ := logtest.NewNullLogger()
-	log.SetFormatter(&logger.TextFormatter{})
-	log.SetOutput(os.Stdout)
-	log.SetLevel(logger.DebugLevel)
-
 	runCtx := &atk.RunContext{
 		Context: context.Background(),
 		Out:     outbuff,
 		Err:     errbuff,
-		Log:     *log,
+		Log:     testLogger(),
 	}
 	module := atk.NewDeployableModule(runCtx, manifest)
 
@@ -135,10 +116,9 @@ func TestRunDeploymentBadCommends(t *testing.T) {
 		step, hasNext = next()
 		err = step(runCtx, module)
 		if err != nil {
-			log.Errorf("Step %d; running stage %s with error: %s", i, module.State(), err.Error())
-			assert.Equal(t, "command is not yet supported", err.Error())
+			runCtx.Log.Errorf("Step %d; running stage %s with error: %s", i, module.State(), err.Error())
 		} else {
-			log.Infof("Step %d; running stage %s with output: %s", i, module.State(), outbuff.String())
+			runCtx.Log.Infof("Step %d; running stage %s with output: %s", i, module.State(), outbuff.String())
 		}
 	}
 
@@ -149,10 +129,7 @@ func TestRunDeploymentBadCommends(t *testing.T) {
 
 func TestRunDeployment(t *testing.T) {
 
-	log, hook := logtest.NewNullLogger()
-	log.SetFormatter(&logger.TextFormatter{})
-	log.SetOutput(os.Stdout)
-	log.SetLevel(logger.DebugLevel)
+	hook := new(logtest.Hook)
 
 	deployImg := &atk.ImageInfo{
 		Image: "atk-predeployer",
@@ -182,10 +159,10 @@ func TestRunDeployment(t *testing.T) {
 		Context: context.Background(),
 		Out:     outbuff,
 		Err:     errbuff,
-		Log:     *log,
+		Log:     testLogger(hook),
 	}
 
-	deployment := atk.NewDeployableModule(runCtx, module)
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunID("test-run"))
 	// For the test purposes, let us just start out with this ready to pre-deploy
 	deployment.Notify(atk.PreDeploying)
 	// Gets the correct command for the current state
@@ -197,7 +174,7 @@ func TestRunDeployment(t *testing.T) {
 	assert.True(t, exists)
 	assert.Equal(t, 1, len(hook.Entries))
 	assert.Equal(t, logger.InfoLevel, hook.LastEntry().Level)
-	assert.Equal(t, fmt.Sprintf("running command: %s run -v /tmp:/workspace -e MYVAR=thisismyvalue atk-predeployer", testPodmanPath), hook.LastEntry().Message)
+	assert.Equal(t, fmt.Sprintf("running command: %s run --name atk-default-test-run-predeploying -v /tmp:/workspace -e MYVAR=thisismyvalue -e ATK_RUN_ID=test-run atk-predeployer", testPodmanPath), hook.LastEntry().Message)
 	assert.False(t, runCtx.IsErrored())
 	assert.Equal(t, "pre deploying...\n", outbuff.String())
 
@@ -205,10 +182,7 @@ func TestRunDeployment(t *testing.T) {
 
 func TestContainerWithErr(t *testing.T) {
 
-	log, hook := logtest.NewNullLogger()
-	log.SetFormatter(&logger.TextFormatter{})
-	log.SetOutput(os.Stdout)
-	log.SetLevel(logger.DebugLevel)
+	hook := new(logtest.Hook)
 
 	deployImg := &atk.ImageInfo{
 		Image: "atk-errer",
@@ -238,10 +212,10 @@ func TestContainerWithErr(t *testing.T) {
 		Context: context.Background(),
 		Out:     outbuff,
 		Err:     errbuff,
-		Log:     *log,
+		Log:     testLogger(hook),
 	}
 
-	deployment := atk.NewDeployableModule(runCtx, module)
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunID("test-run"))
 	// For the test purposes, let us just start out with this ready to pre-deploy
 	deployment.Notify(atk.PreDeploying)
 	// Gets the correct command for the current state
@@ -259,7 +233,7 @@ func TestContainerWithErr(t *testing.T) {
 	assert.True(t, exists)
 	assert.Equal(t, 1, len(hook.Entries))
 	assert.Equal(t, logger.InfoLevel, hook.LastEntry().Level)
-	assert.Equal(t, fmt.Sprintf("running command: %s run -v /tmp:/workspace -e MYVAR=thisismyvalue atk-errer", testPodmanPath), hook.LastEntry().Message)
+	assert.Equal(t, fmt.Sprintf("running command: %s run --name atk-default-test-run-predeploying -v /tmp:/workspace -e MYVAR=thisismyvalue -e ATK_RUN_ID=test-run atk-errer", testPodmanPath), hook.LastEntry().Message)
 	assert.Equal(t, "", outbuff.String())
 	assert.Equal(t, "sh: nowhereisacommandthatdoesnotexist: not found\n", errbuff.String())
 	assert.True(t, runCtx.IsErrored())
@@ -269,10 +243,7 @@ func TestContainerWithErr(t *testing.T) {
 
 func TestNonExistImage(t *testing.T) {
 
-	log, hook := logtest.NewNullLogger()
-	log.SetFormatter(&logger.TextFormatter{})
-	log.SetOutput(os.Stdout)
-	log.SetLevel(logger.DebugLevel)
+	hook := new(logtest.Hook)
 
 	deployImg := &atk.ImageInfo{
 		Image: "docker.io/library/nowhereisanimagethatdoesnotexist",
@@ -299,10 +270,10 @@ func TestNonExistImage(t *testing.T) {
 		Context: context.Background(),
 		Out:     outbuff,
 		Err:     errbuff,
-		Log:     *log,
+		Log:     testLogger(hook),
 	}
 
-	deployment := atk.NewDeployableModule(runCtx, module)
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunID("test-run"))
 	// For the test purposes, let us just start out with this ready to pre-deploy
 	deployment.Notify(atk.PreDeploying)
 	// Gets the correct command for the current state
@@ -314,9 +285,134 @@ func TestNonExistImage(t *testing.T) {
 	assert.True(t, exists)
 	assert.Equal(t, 1, len(hook.Entries))
 	assert.Equal(t, logger.InfoLevel, hook.LastEntry().Level)
-	assert.Equal(t, fmt.Sprintf("running command: %s run -v /tmp:/workspace docker.io/library/nowhereisanimagethatdoesnotexist", testPodmanPath), hook.LastEntry().Message)
+	assert.Equal(t, fmt.Sprintf("running command: %s run --name atk-default-test-run-predeploying -v /tmp:/workspace -e ATK_RUN_ID=test-run docker.io/library/nowhereisanimagethatdoesnotexist", testPodmanPath), hook.LastEntry().Message)
 	assert.Equal(t, "", outbuff.String())
 	//assert.True(t, strings.Contains(errbuff.String(), "Trying to pull "))
 	assert.True(t, runCtx.IsErrored())
 	assert.Equal(t, 1, len(runCtx.Errors))
 }
+
+func TestDeployableModuleAccessors(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Metadata.Labels = map[string]string{"tier": "demo"}
+	module.Specifications.Lifecycle.PostDeploy.Image = "mymodule-deploy"
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(atktest.NewFakeRunner()))
+
+	assert.Equal(t, "mymodule", deployment.Name())
+	assert.Equal(t, "atktest", deployment.Metadata().Namespace)
+	assert.Equal(t, "demo", deployment.Metadata().Labels["tier"])
+	deployment.Metadata().Labels["tier"] = "prod"
+	assert.Equal(t, "demo", module.Metadata.Labels["tier"])
+
+	assert.Equal(t, []string{
+		"mymodule-list",
+		"mymodule-validate",
+		"mymodule-get-state",
+		"mymodule-pre-deploy",
+		"mymodule-deploy",
+	}, deployment.Images())
+
+	assert.Equal(t, "mymodule-pre-deploy", deployment.Stage(atk.PreDeploying).Image)
+	assert.Equal(t, "", deployment.Stage(atk.Configured).Image)
+
+	stage := deployment.Stage(atk.Deploying)
+	stage.Args = append(stage.Args, "--changed")
+	stage.Image = "changed"
+	assert.Equal(t, "mymodule-deploy", deployment.Stage(atk.Deploying).Image)
+	assert.Empty(t, deployment.Stage(atk.Deploying).Args)
+}
+
+func TestRunIDPropagation(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+	assert.NotEmpty(t, deployment.RunID())
+
+	deployment.Notify(atk.PreDeploying)
+	next, _ := deployment.Itr()
+	cmd, _ := next()
+	cmd(runCtx, deployment)
+	_, err := deployment.Validate(runCtx, atk.EventData{})
+	assert.NoError(t, err)
+
+	calls := runner.Calls()
+	assert.Equal(t, 2, len(calls))
+	for _, call := range calls {
+		assert.Contains(t, call.Info.EnvVars, atk.EnvVarInfo{Name: atk.RunIDEnvVar, Value: deployment.RunID()})
+	}
+	request, err := atk.LoadEvent(calls[1].In)
+	assert.NoError(t, err)
+	assert.Equal(t, deployment.RunID(), request.Extensions()[atk.RunIDExtension])
+}
+
+func TestRunIDInRunnerLogs(t *testing.T) {
+	script := writeScript(t, t.TempDir(), "deploy.sh", "echo \"$ATK_RUN_ID\"\n")
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle.Deploy = atk.ImageInfo{
+		Script:  script,
+		EnvVars: []atk.EnvVarInfo{{Name: atk.RunIDEnvVar, Value: "from-manifest"}},
+	}
+
+	runCtx, outbuff, _, hook := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module,
+		atk.WithRunner(atk.NewLocalModuleRunner(t.TempDir())), atk.WithRunID("test-run"))
+	deployment.Notify(atk.Deploying)
+	next, _ := deployment.Itr()
+	cmd, _ := next()
+	assert.NoError(t, cmd(runCtx, deployment))
+
+	assert.Equal(t, "test-run\n", outbuff.String())
+	entry := hook.LastEntry()
+	if assert.NotNil(t, entry) {
+		assert.Contains(t, entry.Message, "running local command")
+		assert.Equal(t, "test-run", entry.Data[atk.RunIDLogField])
+	}
+	assert.Equal(t, "", runCtx.RunID)
+}
+
+func TestItrLastStateInOrder(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	order := []atk.State{atk.Invalid, atk.Initializing}
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"),
+		atk.WithRunner(atktest.NewFakeRunner()), atk.WithExecOrder(order))
+	deployment.Notify(atk.Initializing)
+
+	next, _ := deployment.Itr()
+	cmd, hasNext := next()
+	assert.True(t, hasNext)
+	assert.NoError(t, cmd(runCtx, deployment))
+	assert.Equal(t, atk.Configured, deployment.State())
+
+	cmd, hasNext = next()
+	assert.False(t, hasNext)
+	var noHandler *atk.NoHandlerError
+	if assert.ErrorAs(t, cmd(runCtx, deployment), &noHandler) {
+		assert.Equal(t, atk.Configured, noHandler.State)
+	}
+}
+
+func TestValidateHandlers(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(atktest.NewFakeRunner()))
+	assert.NoError(t, deployment.ValidateHandlers())
+
+	const custom atk.State = "custom"
+	deployment = atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(atktest.NewFakeRunner()),
+		atk.WithExecOrder([]atk.State{atk.Invalid, custom, atk.Done}))
+	err := deployment.ValidateHandlers()
+	var noHandler *atk.NoHandlerError
+	if assert.ErrorAs(t, err, &noHandler) {
+		assert.Equal(t, custom, noHandler.State)
+	}
+
+	result, err := deployment.Deploy(runCtx)
+	assert.ErrorAs(t, err, &noHandler)
+	assert.Equal(t, atk.Invalid, result.FailedState)
+
+	assert.NoError(t, deployment.AddCmd(custom, func(ctx *atk.RunContext, notifier atk.Notifier) error {
+		return notifier.Notify(atk.Done)
+	}))
+	assert.NoError(t, deployment.ValidateHandlers())
+}
@@ -3,7 +3,9 @@ package test
 import (
 	"bytes"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -214,3 +216,117 @@ func TestWriteEvent(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, outbuff.String())
 }
+
+func TestModuleDeepCopy(t *testing.T) {
+	moduleLoader := atk.NewAtkManifestFileLoader()
+	module, err := moduleLoader.Load("examples/module1.yml")
+	assert.NoError(t, err)
+
+	cp := module.DeepCopy()
+	assert.True(t, module.Equal(cp))
+
+	cp.Metadata.Labels["label1"] = "changed"
+	cp.Specifications.Hooks.List.EnvVars[0].Value = "changed"
+	assert.Equal(t, "value1", module.Metadata.Labels["label1"])
+	assert.Equal(t, "my-base-project", module.Specifications.Hooks.List.EnvVars[0].Value)
+	assert.False(t, module.Equal(cp))
+}
+
+func TestModuleEqual(t *testing.T) {
+	a := &atk.ModuleInfo{Metadata: atk.MetadataInfo{Name: "a"}}
+	b := &atk.ModuleInfo{Metadata: atk.MetadataInfo{Name: "a", Labels: map[string]string{}}}
+	b.Specifications.Lifecycle.Deploy.Args = []string{}
+
+	assert.True(t, a.Equal(b))
+	b.Specifications.Lifecycle.Deploy.Image = "myimage"
+	assert.False(t, a.Equal(b))
+	assert.False(t, a.Equal(nil))
+	var nilModule *atk.ModuleInfo
+	assert.True(t, nilModule.Equal(nil))
+}
+
+func TestModuleMarshal(t *testing.T) {
+	module := &atk.ModuleInfo{
+		ApiVersion: "itzcli/v1alpha1",
+		Kind:       "InstallManifest",
+		Metadata: atk.MetadataInfo{
+			Name:      "MyModule",
+			Namespace: "IBMTechnologyZone",
+			Labels:    map[string]string{"tier": "demo", "cloud": "aws"},
+		},
+		Specifications: atk.SpecInfo{
+			Lifecycle: atk.LifecycleInfo{
+				Deploy: atk.ImageInfo{
+					Image:   "atk-deployer",
+					Volumes: []atk.VolumeInfo{{Name: "/tmp", MountPath: "/workspace"}},
+				},
+			},
+		},
+	}
+
+	actual, err := module.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `apiVersion: itzcli/v1alpha1
+kind: InstallManifest
+metadata:
+  namespace: IBMTechnologyZone
+  name: MyModule
+  labels:
+    cloud: aws
+    tier: demo
+spec:
+  lifecycle:
+    deploy:
+      image: atk-deployer
+      volumeMounts:
+        - mountPath: /workspace
+          name: /tmp
+`, string(actual))
+}
+
+func TestModuleSaveRoundTrip(t *testing.T) {
+	moduleLoader := atk.NewAtkManifestFileLoader()
+	module, err := moduleLoader.Load("examples/module1.yml")
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "module.yml")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, module.Save(f))
+	f.Close()
+
+	saved, err := moduleLoader.Load(path)
+	assert.NoError(t, err)
+	assert.True(t, module.Equal(saved))
+}
+
+func TestModuleSaveJSON(t *testing.T) {
+	module := &atk.ModuleInfo{
+		ApiVersion: "itzcli/v1alpha1",
+		Kind:       "InstallManifest",
+		Metadata:   atk.MetadataInfo{Name: "MyModule"},
+		Specifications: atk.SpecInfo{
+			Lifecycle: atk.LifecycleInfo{
+				Deploy: atk.ImageInfo{Image: "atk-deployer"},
+			},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, module.SaveJSON(buf))
+	assert.Equal(t, `{
+  "apiVersion": "itzcli/v1alpha1",
+  "kind": "InstallManifest",
+  "metadata": {
+    "name": "MyModule"
+  },
+  "spec": {
+    "lifecycle": {
+      "deploy": {
+        "image": "atk-deployer"
+      }
+    }
+  }
+}
+`, buf.String())
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeRunnerRecordsCalls(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("atk-lister", atktest.Response{Out: atktest.ListResponse})
+
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runCtx.In = strings.NewReader("some input")
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "atk-lister"})
+
+	assert.NoError(t, err)
+	assert.False(t, runCtx.IsErrored())
+	atktest.AssertRunOrder(t, runner, "atk-lister")
+	atktest.AssertEventType(t, outbuff.String(), atk.ListHookResponseEvent)
+	atktest.AssertVariables(t, outbuff.String(), "TF_VAR_cloud_provider", "TF_VAR_cloud_type", "TF_VAR_api_key")
+	assert.Equal(t, "some input", runner.Calls()[0].In)
+}
+
+func TestFakeRunnerWithErr(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("atk-errer", atktest.Response{Err: "not found\n", ExitCode: 127})
+
+	runCtx, outbuff, errbuff, _ := newTestRunContext()
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "atk-errer"})
+
+	assert.Error(t, err)
+	assert.Equal(t, "", outbuff.String())
+	assert.Equal(t, "not found\n", errbuff.String())
+	assert.True(t, runCtx.IsErrored())
+	assert.Equal(t, 127, runCtx.LastErrCode)
+}
+
+func TestNewResponseFixture(t *testing.T) {
+	out := atktest.NewResponse(atk.ValidateHookResponseEvent, atk.EventDataVarInfo{Name: "MYVAR", Value: "myvalue"})
+
+	atktest.AssertEventType(t, out, atk.ValidateHookResponseEvent)
+	atktest.AssertVariables(t, out, "MYVAR")
+}
+
+func TestManifestFixture(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+
+	assert.True(t, module.IsSupported())
+	assert.Equal(t, "mymodule-deploy", module.Specifications.Lifecycle.Deploy.Image)
+}
+
+func TestDeploymentWithFakeRunner(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	module := atktest.Manifest("mymodule")
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+
+	var step atk.StateCmd
+	for next, hasNext := deployment.Itr(); hasNext; {
+		step, hasNext = next()
+		step(runCtx, deployment)
+	}
+
+	assert.False(t, deployment.IsErrored())
+	assert.Equal(t, atk.Done, deployment.State())
+	atktest.AssertRunOrder(t, runner, "mymodule-get-state", "mymodule-list", "mymodule-validate", "mymodule-pre-deploy", "mymodule-deploy", "mymodule-post-deploy")
+}
+
+func TestDeploymentWithFakeRunnerErr(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-deploy", atktest.Response{ExitCode: 1})
+	module := atktest.Manifest("mymodule")
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+
+	var step atk.StateCmd
+	for next, hasNext := deployment.Itr(); hasNext; {
+		step, hasNext = next()
+		step(runCtx, deployment)
+	}
+
+	assert.True(t, deployment.IsErrored())
+	atktest.AssertNotRan(t, runner, "mymodule-post-deploy")
+}
+
+func TestFakeRunnerDoesNotReadPipes(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	require.NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	runCtx.In = reader
+	// The pipe is never closed by the writer, so reading it would block.
+	err = runner.RunImage(runCtx, atk.ImageInfo{Image: "atk-lister"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "", runner.Calls()[0].In)
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHookAll(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	runner.Default = atktest.Response{Out: atktest.ListResponse}
+	runner.On("module3-list", atktest.Response{Err: "boom\n", ExitCode: 1})
+
+	modules := make([]*atk.ModuleInfo, 0)
+	for i := 0; i < 20; i++ {
+		modules = append(modules, atktest.Manifest(fmt.Sprintf("module%d", i)))
+	}
+	runCtx, _, _, _ := newTestRunContext()
+	results := atk.RunHookAll(runCtx, modules, atk.ListHook, 4, atk.WithRunner(runner))
+
+	require.Len(t, results, 20)
+	assert.Len(t, runner.Calls(), 20)
+	for i, result := range results {
+		assert.Equal(t, modules[i], result.Module)
+		if i == 3 {
+			assert.Error(t, result.Err)
+			assert.Equal(t, "boom\n", result.Stderr)
+			continue
+		}
+		assert.NoError(t, result.Err)
+		require.Len(t, result.Events, 1)
+		assert.Equal(t, string(atk.ListHookResponseEvent), result.Events[0].Type())
+	}
+	assert.False(t, runCtx.IsErrored())
+}
+
+func TestRunHookAllMissingHook(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Hooks.GetState = atk.ImageInfo{}
+
+	runCtx, _, _, _ := newTestRunContext()
+	results := atk.RunHookAll(runCtx, []*atk.ModuleInfo{module}, atk.GetStateHook, 0, atk.WithRunner(atktest.NewFakeRunner()))
+
+	assert.Error(t, results[0].Err)
+}
+
+func TestRunHookAllCancelled(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runCtx.Context = ctx
+
+	results := atk.RunHookAll(runCtx, []*atk.ModuleInfo{atktest.Manifest("a"), atktest.Manifest("b")}, atk.ListHook, 1, atk.WithRunner(runner))
+
+	assert.ErrorIs(t, results[0].Err, context.Canceled)
+	assert.ErrorIs(t, results[1].Err, context.Canceled)
+	assert.Empty(t, runner.Calls())
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+)
+
+// Run the benchmarks with:
+//
+//	go test ./test -run '^$' -bench . -benchmem
+//
+// They track the overhead that atkmod adds to each hook and stage, apart from
+// the time that the container takes to run.
+
+// noopRunner is an engine that runs nothing, so that a deployment only costs
+// the overhead of atkmod.
+type noopRunner struct{}
+
+func (noopRunner) RunImage(ctx *atk.RunContext, info atk.ImageInfo) error {
+	return nil
+}
+
+// benchImage is an image with the settings of a typical stage.
+var benchImage = atk.ImageInfo{
+	Image: "quay.io/example/deployer:1.0",
+	Args:  []string{"apply", "-auto-approve"},
+	EnvVars: []atk.EnvVarInfo{
+		{Name: "TF_VAR_region", Value: "us-south"},
+		{Name: "TF_VAR_resource_group", Value: "default"},
+		{Name: "IBMCLOUD_API_KEY", Value: "secret"},
+	},
+	Volumes: []atk.VolumeInfo{
+		{Name: "/home/me/.atk/workspaces/example", MountPath: "/workspace"},
+		{Name: "/home/me/.cache/atk", MountPath: "/var/cache/atk"},
+	},
+}
+
+func newBenchBuilder() *atk.PodmanCliCommandBuilder {
+	return atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "/usr/local/bin/podman", Flags: []string{"--rm"}, Platform: atk.PlatformLinux})
+}
+
+func BenchmarkBuild(b *testing.B) {
+	builder := newBenchBuilder().
+		WithImage(benchImage.Image).
+		WithWorkspace("/home/me/workdir").
+		WithEnvvar("MYVAR", "thisismyvalue").
+		WithPort("8080", "80")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := builder.Build(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildFrom(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := newBenchBuilder().BuildFrom(benchImage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDeployNoop(b *testing.B) {
+	module := atktest.Manifest("bench")
+	module.Specifications.Hooks = atk.HookInfo{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		runCtx, _, _, _ := newTestRunContext()
+		deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(noopRunner{}))
+		if _, err := deployment.Deploy(runCtx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkListNoop(b *testing.B) {
+	module := atktest.Manifest("bench")
+	runner := atktest.NewFakeRunner()
+	runner.Default = atktest.Response{Out: atktest.NewResponse(atk.ListHookResponseEvent, atk.EventDataVarInfo{Name: "region", Default: "us-south"})}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		runCtx, _, _, _ := newTestRunContext()
+		deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+		if _, err := deployment.List(runCtx); err != nil {
+			b.Fatal(err)
+		}
+		runner.Reset()
+	}
+}
+
+func BenchmarkBuildArgs(b *testing.B) {
+	builder := newBenchBuilder().
+		WithImage(benchImage.Image).
+		WithWorkspace("/home/me/workdir").
+		WithEnvvar("MYVAR", "thisismyvalue").
+		WithPort("8080", "80")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		builder.BuildArgs()
+	}
+}
+
+func BenchmarkBuildArgsFrom(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := newBenchBuilder().BuildArgsFrom(benchImage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageHistograms(t *testing.T) {
+	history := []atk.DeploymentResult{
+		{Stages: []atk.StageTiming{{State: atk.Deploying, Duration: 3 * time.Second}}},
+		{Stages: []atk.StageTiming{{State: atk.Deploying, Duration: 1 * time.Second}}},
+		{Stages: []atk.StageTiming{{State: atk.Deploying, Duration: 2 * time.Second}}},
+		{FailedState: atk.Deploying, Stages: []atk.StageTiming{{State: atk.PreDeploying, Duration: time.Second}, {State: atk.Deploying, Duration: time.Hour}}},
+	}
+	histograms := atk.StageHistograms(history)
+	deploying := histograms[atk.Deploying]
+	require.NotNil(t, deploying)
+	assert.Equal(t, 3, deploying.Count())
+	assert.Equal(t, 3*time.Second, deploying.Quantile(0.95))
+	assert.Equal(t, 2*time.Second, deploying.Quantile(0.5))
+	assert.Equal(t, []int{1, 2, 0}, deploying.Buckets([]time.Duration{time.Second, 5 * time.Second}))
+	assert.Equal(t, 1, histograms[atk.PreDeploying].Count())
+}
+
+// sleepingRunner runs the images with a FakeRunner after sleeping for the
+// delay of the image.
+type sleepingRunner struct {
+	*atktest.FakeRunner
+	delays map[string]time.Duration
+}
+
+func (r *sleepingRunner) RunImage(ctx *atk.RunContext, info atk.ImageInfo) error {
+	time.Sleep(r.delays[info.Image])
+	return r.FakeRunner.RunImage(ctx, info)
+}
+
+func TestSlowStageWarning(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	store := atk.NewHistoryStore(t.TempDir())
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.Record(atk.DeploymentResult{
+			Module:    "mymodule",
+			Namespace: module.Metadata.Namespace,
+			RunID:     "run",
+			State:     atk.Done,
+			Stages:    []atk.StageTiming{{State: atk.Deploying, Duration: 20 * time.Millisecond}},
+		}))
+	}
+
+	runCtx, _, _, hook := newTestRunContext()
+	sink := &recordingSink{}
+	runner := &sleepingRunner{FakeRunner: atktest.NewFakeRunner(), delays: map[string]time.Duration{"mymodule-deploy": 200 * time.Millisecond}}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithHistory(store),
+		atk.WithSlowStageWarnings(2), atk.WithEventSink(sink))
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	var warnings []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "stage deploying of module mymodule has been running for")
+	assert.Contains(t, warnings[0], "2x its p95")
+
+	var slow []string
+	for _, event := range sink.events {
+		if event.Type() == string(atk.SlowStageEvent) {
+			slow = append(slow, event.Subject())
+		}
+	}
+	assert.Equal(t, []string{"mymodule"}, slow)
+}
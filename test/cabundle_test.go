@@ -0,0 +1,88 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCA = `-----BEGIN CERTIFICATE-----
+MIIBdzCCAR2gAwIBAgIBATAKBggqhkjOPQQDAjAPMQ0wCwYDVQQDEwR0ZXN0MB4X
+-----END CERTIFICATE-----
+`
+
+func TestWithCABundle(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	ca := filepath.Join(t.TempDir(), "corporate.pem")
+	require.NoError(t, os.WriteFile(ca, []byte(testCA), 0600))
+
+	deploy, err := deployCall(t, atk.WithCABundle(ca))
+	require.NoError(t, err)
+
+	var bundle string
+	for _, mountPath := range atk.CABundleMountPaths {
+		found := false
+		for _, v := range deploy.Volumes {
+			if v.MountPath == mountPath {
+				found = true
+				bundle = v.Name
+			}
+		}
+		assert.True(t, found, mountPath)
+	}
+	for _, name := range atk.CABundleEnvVars {
+		assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: name, Value: atk.CABundleMountPaths[0]})
+	}
+	content, err := os.ReadFile(bundle)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), testCA)
+
+	// The same bundle is reused by the next run.
+	again, err := deployCall(t, atk.WithCABundle(ca))
+	require.NoError(t, err)
+	assert.Contains(t, again.Volumes, atk.VolumeInfo{Name: bundle, MountPath: atk.CABundleMountPaths[0]})
+}
+
+func TestWithCABundleImageTakesPrecedence(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	ca := filepath.Join(t.TempDir(), "corporate.pem")
+	require.NoError(t, os.WriteFile(ca, []byte(testCA), 0600))
+	runner := atktest.NewFakeRunner()
+	module := atktest.Manifest("ca")
+	module.Specifications.Hooks = atk.HookInfo{}
+	module.Specifications.Lifecycle.Deploy.EnvVars = []atk.EnvVarInfo{{Name: "SSL_CERT_FILE", Value: "/mine.pem"}}
+	module.Specifications.Lifecycle.Deploy.Volumes = []atk.VolumeInfo{{Name: "/host/mine.pem", MountPath: atk.CABundleMountPaths[0]}}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithCABundle(ca))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	deploy := runner.Calls()[1].Info
+	assert.Equal(t, "ca-deploy", deploy.Image)
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "SSL_CERT_FILE", Value: "/mine.pem"})
+	assert.NotContains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "SSL_CERT_FILE", Value: atk.CABundleMountPaths[0]})
+	mounts := 0
+	for _, v := range deploy.Volumes {
+		if v.MountPath == atk.CABundleMountPaths[0] {
+			mounts++
+			assert.Equal(t, "/host/mine.pem", v.Name)
+		}
+	}
+	assert.Equal(t, 1, mounts)
+}
+
+func TestWithCABundleInvalidFile(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0600))
+
+	_, err := deployCall(t, atk.WithCABundle(notPEM))
+	assert.Error(t, err)
+	_, err = deployCall(t, atk.WithCABundle(filepath.Join(t.TempDir(), "missing.pem")))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
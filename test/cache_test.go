@@ -0,0 +1,36 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCacheVolume(t *testing.T) {
+	dir := t.TempDir()
+	runner := atktest.NewFakeRunner()
+	module := atktest.Manifest("cached")
+	module.Specifications.Hooks = atk.HookInfo{}
+	module.Specifications.Lifecycle.PostDeploy.EnvVars = []atk.EnvVarInfo{{Name: "PIP_CACHE_DIR", Value: "/tmp/pip"}}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithCacheVolume(dir))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	calls := runner.Calls()
+	require.Len(t, calls, 3)
+	for _, call := range calls {
+		assert.Contains(t, call.Info.Volumes, atk.VolumeInfo{Name: dir, MountPath: atk.CacheMountPath})
+		assert.Contains(t, call.Info.EnvVars, atk.EnvVarInfo{Name: "TF_PLUGIN_CACHE_DIR", Value: "/var/cache/atk/terraform/plugins"})
+	}
+	assert.Contains(t, calls[0].Info.EnvVars, atk.EnvVarInfo{Name: "PIP_CACHE_DIR", Value: "/var/cache/atk/pip"})
+	// The variables of the image take precedence over the cache.
+	assert.Contains(t, calls[2].Info.EnvVars, atk.EnvVarInfo{Name: "PIP_CACHE_DIR", Value: "/tmp/pip"})
+	assert.NotContains(t, calls[2].Info.EnvVars, atk.EnvVarInfo{Name: "PIP_CACHE_DIR", Value: "/var/cache/atk/pip"})
+	assert.DirExists(t, filepath.Join(dir, "terraform", "plugins"))
+	assert.DirExists(t, filepath.Join(dir, "npm"))
+}
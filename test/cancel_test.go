@@ -0,0 +1,108 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stopRunner blocks in the deploy image until its container is stopped.
+type stopRunner struct {
+	mu        sync.Mutex
+	started   chan struct{}
+	stopped   chan struct{}
+	ran       []string
+	env       map[string]string
+	container string
+}
+
+func newStopRunner() *stopRunner {
+	return &stopRunner{started: make(chan struct{}), stopped: make(chan struct{}), env: map[string]string{}}
+}
+
+func (r *stopRunner) RunImage(ctx *atk.RunContext, info atk.ImageInfo) error {
+	r.mu.Lock()
+	r.ran = append(r.ran, info.Image)
+	for _, env := range info.EnvVars {
+		r.env[env.Name] = env.Value
+	}
+	r.mu.Unlock()
+	if info.Image != "deploy" {
+		return nil
+	}
+	close(r.started)
+	<-r.stopped
+	ctx.AddError(errors.New("container exited"))
+	return errors.New("container exited")
+}
+
+func (r *stopRunner) Stop(ctx *atk.RunContext, container string) error {
+	r.container = container
+	close(r.stopped)
+	return nil
+}
+
+func TestCancel(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle = atk.LifecycleInfo{
+		PreDeploy:  atk.ImageInfo{Image: "pre"},
+		Deploy:     atk.ImageInfo{Image: "deploy"},
+		PostDeploy: atk.ImageInfo{Image: "post"},
+		OnCancel:   atk.ImageInfo{Image: "cleanup"},
+	}
+	runner := newStopRunner()
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithRunID("run-1"))
+
+	var result *atk.DeploymentResult
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err = deployment.Deploy(runCtx)
+	}()
+
+	select {
+	case <-runner.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the deploy stage did not start")
+	}
+	require.NoError(t, deployment.Cancel("no longer needed"))
+	<-done
+
+	var cancelled *atk.CancelledError
+	require.ErrorAs(t, err, &cancelled)
+	assert.Equal(t, atk.Deploying, cancelled.State)
+	assert.Equal(t, "no longer needed", cancelled.Reason)
+	assert.Equal(t, atk.Cancelled, deployment.State())
+	assert.True(t, deployment.IsCancelled())
+	assert.False(t, deployment.IsErrored())
+	assert.Equal(t, "no longer needed", result.CancelReason)
+	assert.Empty(t, result.FailedState)
+	assert.True(t, strings.HasPrefix(runner.container, "atk-atktest-mymodule-run-1-"))
+	assert.Equal(t, []string{"mymodule-get-state", "mymodule-list", "mymodule-validate", "pre", "deploy", "cleanup"}, runner.ran)
+	assert.Equal(t, "no longer needed", runner.env[atk.CancelReasonEnvVar])
+}
+
+func TestCancelBeforeDeploy(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	require.NoError(t, deployment.Cancel("changed my mind"))
+	result, err := deployment.Deploy(runCtx)
+
+	var cancelled *atk.CancelledError
+	require.ErrorAs(t, err, &cancelled)
+	assert.Equal(t, atk.Cancelled, deployment.State())
+	assert.Equal(t, "changed my mind", result.CancelReason)
+	assert.Empty(t, runner.Calls())
+}
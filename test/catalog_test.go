@@ -0,0 +1,90 @@
+package test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCatalog saves the modules as manifests in subdirectories of dir, along
+// with a YAML file that is not a manifest.
+func writeCatalog(t *testing.T, dir string, modules ...*atk.ModuleInfo) {
+	for _, module := range modules {
+		path := filepath.Join(dir, module.Metadata.Name, "itz-manifest.yaml")
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		content, err := module.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, content, 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "values.yaml"), []byte("replicas: 3\n"), 0644))
+}
+
+func TestCatalogBuild(t *testing.T) {
+	dir := t.TempDir()
+	network := atktest.Manifest("network")
+	network.Metadata.Labels = map[string]string{"category": "networking"}
+	writeCatalog(t, dir, atktest.Manifest("storage"), network)
+
+	runner := atktest.NewFakeRunner().
+		On("network-list", atktest.Response{Out: atktest.NewResponse(atk.ListHookResponseEvent,
+			atk.EventDataVarInfo{Name: "VPC_CIDR", Description: "the CIDR of the VPC"})}).
+		On("storage-list", atktest.Response{ExitCode: 1})
+	runCtx, _, _, _ := newTestRunContext()
+	builder := &atk.CatalogBuilder{
+		Sources: []atk.CatalogSource{&atk.DirSource{Dir: dir}},
+		Options: []atk.DeployableModuleOption{atk.WithRunner(runner)},
+	}
+	index, err := builder.Build(runCtx)
+	require.NoError(t, err)
+	require.Len(t, index.Modules, 2)
+
+	entry := index.Modules[0]
+	assert.Equal(t, "network", entry.Name)
+	assert.Equal(t, filepath.Join(dir, "network", "itz-manifest.yaml"), entry.Source)
+	assert.Equal(t, "VPC_CIDR", entry.Variables[0].Name)
+	assert.Contains(t, entry.Images, "network-deploy")
+	assert.Empty(t, entry.Error)
+	assert.NotEmpty(t, index.Modules[1].Error)
+
+	assert.Len(t, index.Search(""), 2)
+	assert.Equal(t, "network", index.Search("Networking cidr")[0].Name)
+	assert.Empty(t, index.Search("networking storage"))
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, index.Save(buf))
+	loaded, err := atk.LoadCatalogIndex(buf)
+	require.NoError(t, err)
+	assert.Equal(t, index.Modules, loaded.Modules)
+}
+
+func TestCatalogGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	writeCatalog(t, repo, atktest.Manifest("storage"))
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "catalog"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	runCtx, _, _, _ := newTestRunContext()
+	manifests, err := (&atk.GitSource{URL: repo}).Manifests(runCtx)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	assert.Equal(t, "storage", manifests[0].Module.Metadata.Name)
+	assert.Equal(t, repo+"/storage/itz-manifest.yaml", manifests[0].Source)
+}
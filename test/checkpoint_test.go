@@ -0,0 +1,148 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkpointRunner blocks in the deploy image until it is checkpointed, as a
+// container does when podman checkpoints it.
+type checkpointRunner struct {
+	mu        sync.Mutex
+	started   chan string
+	stopped   chan struct{}
+	ran       []string
+	restored  []string
+	container string
+}
+
+func newCheckpointRunner() *checkpointRunner {
+	return &checkpointRunner{started: make(chan string, 1), stopped: make(chan struct{})}
+}
+
+func (r *checkpointRunner) RunImage(ctx *atk.RunContext, info atk.ImageInfo) error {
+	r.mu.Lock()
+	r.ran = append(r.ran, info.Image)
+	r.mu.Unlock()
+	if info.Image != "deploy" || len(r.restored) > 0 {
+		return nil
+	}
+	r.started <- info.Image
+	<-r.stopped
+	// Podman exits with an error when the container is stopped.
+	ctx.AddError(errors.New("container exited"))
+	return errors.New("container exited")
+}
+
+func (r *checkpointRunner) Checkpoint(ctx *atk.RunContext, container string, archive string) error {
+	r.container = container
+	if err := os.WriteFile(archive, []byte("checkpoint"), 0600); err != nil {
+		return err
+	}
+	close(r.stopped)
+	return nil
+}
+
+func (r *checkpointRunner) Restore(ctx *atk.RunContext, container string, archive string) error {
+	r.restored = append(r.restored, container)
+	return nil
+}
+
+func TestSuspendAndResume(t *testing.T) {
+	dir := t.TempDir()
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle = atk.LifecycleInfo{
+		PreDeploy:  atk.ImageInfo{Image: "pre"},
+		Deploy:     atk.ImageInfo{Image: "deploy"},
+		PostDeploy: atk.ImageInfo{Image: "post"},
+	}
+	runner := newCheckpointRunner()
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module,
+		atk.WithRunner(runner), atk.WithCheckpointDir(dir), atk.WithRunID("run-1"))
+
+	var result *atk.DeploymentResult
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err = deployment.Deploy(runCtx)
+	}()
+
+	select {
+	case <-runner.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the deploy stage did not start")
+	}
+	checkpoint, serr := deployment.Suspend(runCtx)
+	require.NoError(t, serr)
+	<-done
+
+	var suspended *atk.SuspendedError
+	require.ErrorAs(t, err, &suspended)
+	assert.Equal(t, atk.Deploying, suspended.Checkpoint.State)
+	assert.Equal(t, atk.Deploying, deployment.State())
+	assert.False(t, deployment.IsErrored())
+	assert.Empty(t, result.FailedState)
+	assert.True(t, strings.HasPrefix(runner.container, "atk-atktest-mymodule-run-1-"))
+	assert.Equal(t, runner.container, checkpoint.Container)
+
+	loaded, lerr := atk.LoadCheckpoint(dir, module, "run-1")
+	require.NoError(t, lerr)
+	assert.Equal(t, checkpoint.Archive, loaded.Archive)
+
+	// A new deployment with the same run ID continues where the first one
+	// stopped.
+	resumeCtx, _, _, _ := newTestRunContext()
+	resumed := atk.NewDeployableModule(resumeCtx, module,
+		atk.WithRunner(runner), atk.WithCheckpointDir(dir), atk.WithRunID("run-1"))
+	result, err = resumed.Resume(resumeCtx)
+
+	require.NoError(t, err)
+	assert.True(t, result.Succeeded())
+	assert.Equal(t, atk.Done, resumed.State())
+	assert.Equal(t, []string{checkpoint.Container}, runner.restored)
+	assert.Equal(t, []string{"mymodule-get-state", "mymodule-list", "mymodule-validate", "pre", "deploy", "post"}, runner.ran)
+	_, lerr = atk.LoadCheckpoint(dir, module, "run-1")
+	assert.True(t, os.IsNotExist(lerr))
+}
+
+func TestSuspendNotRunning(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"),
+		atk.WithRunner(newCheckpointRunner()), atk.WithCheckpointDir(t.TempDir()))
+
+	_, err := deployment.Suspend(runCtx)
+	assert.Error(t, err)
+
+	deployment = atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"),
+		atk.WithRunner(atktest.NewFakeRunner()))
+	_, err = deployment.Suspend(runCtx)
+	assert.ErrorIs(t, err, atk.ErrCheckpointNotSupported)
+}
+
+func TestRunImageContainerName(t *testing.T) {
+	// echo stands in for podman, so the command line is written to the output.
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runCtx.Context = context.Background()
+	module := atktest.Manifest("mymodule")
+	// The validate hook is not run, as it does not write a response.
+	module.Specifications.Hooks.Validate = atk.ImageInfo{}
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithRunID("run-1"))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Contains(t, outbuff.String(), "--name atk-atktest-mymodule-run-1-deploying")
+}
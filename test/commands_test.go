@@ -0,0 +1,41 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastCommands(t *testing.T) {
+	// echo stands in for podman, so the commands run without podman.
+	runCtx, _, _, _ := newTestRunContext()
+	runCtx.Context = context.Background()
+	module := atktest.Manifest("commands")
+	module.Specifications.Hooks.Validate = atk.ImageInfo{}
+	module.Specifications.Lifecycle.Deploy.Args = []string{"apply", "-auto-approve"}
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	assert.Nil(t, deployment.LastCommand(string(atk.Deploying)))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	_, err = deployment.List(runCtx)
+	require.Error(t, err)
+
+	deploy := deployment.LastCommand(string(atk.Deploying))
+	require.NotEmpty(t, deploy)
+	assert.Equal(t, "echo", deploy[0])
+	assert.Contains(t, deploy, "commands-deploy")
+	assert.Equal(t, []string{"commands-deploy", "apply", "-auto-approve"}, deploy[len(deploy)-3:])
+	assert.Contains(t, deployment.LastCommand(string(atk.ListHook)), "commands-list")
+
+	var names []string
+	for _, c := range deployment.LastCommands() {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"get_state", "predeploying", "deploying", "postdeploying", "list"}, names)
+}
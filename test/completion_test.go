@@ -0,0 +1,45 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var completionVars = &atk.EventData{Variables: []atk.EventDataVarInfo{
+	{Name: "region", Description: "the region of the cluster", Options: []string{"us-south", "us-east", "eu-de"}},
+	{Name: "replicas", Default: "3"},
+	{Name: "cluster_name"},
+}}
+
+func TestEventDataComplete(t *testing.T) {
+	assert.Equal(t, []atk.Completion{
+		{Value: "cluster_name="},
+		{Value: "region=", Description: "the region of the cluster"},
+		{Value: "replicas="},
+	}, completionVars.Complete(""))
+	assert.Equal(t, []atk.Completion{
+		{Value: "region=", Description: "the region of the cluster"},
+		{Value: "replicas="},
+	}, completionVars.Complete("re"))
+	assert.Equal(t, []atk.Completion{
+		{Value: "region=us-east"},
+		{Value: "region=us-south"},
+	}, completionVars.Complete("region=us"))
+	assert.Equal(t, []atk.Completion{{Value: "replicas=3"}}, completionVars.Complete("replicas="))
+	assert.Empty(t, completionVars.Complete("cluster_name="))
+	assert.Empty(t, completionVars.Complete("unknown="))
+}
+
+func TestDeployableModuleComplete(t *testing.T) {
+	runner := atktest.NewFakeRunner().On("complete-list", atktest.Response{Out: atktest.NewResponse(atk.ListHookResponseEvent, completionVars.Variables...)})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("complete"), atk.WithRunner(runner))
+
+	completions, err := deployment.Complete(runCtx, "region=eu")
+	require.NoError(t, err)
+	assert.Equal(t, []atk.Completion{{Value: "region=eu-de"}}, completions)
+}
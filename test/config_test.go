@@ -0,0 +1,69 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clearConfigEnv(t *testing.T) {
+	for _, envVar := range []string{atk.PodmanPathEnvVar, atk.WazeroPathEnvVar, atk.RegistryAuthFileEnvVar,
+		atk.BaseDirEnvVar, atk.PullPolicyEnvVar, atk.DeployTimeoutEnvVar, atk.ProxyEnvVar, atk.NoProxyEnvVar,
+		atk.CABundleEnvVar, atk.ClientCertEnvVar, atk.ClientKeyEnvVar, atk.HelperImageEnvVar, atk.PassEnvEnvVar} {
+		t.Setenv(envVar, "")
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	clearConfigEnv(t)
+	cfg, err := atk.LoadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, &atk.Config{}, cfg)
+	assert.Equal(t, atk.DefaultPodmanPath, cfg.CliParts().Path)
+	assert.Empty(t, cfg.WorkspaceRoot())
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	clearConfigEnv(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`podmanPath: /opt/bin/podman
+registryAuthFile: /home/me/auth.json
+baseDir: /var/lib/atk
+pullPolicy: missing
+deployTimeout: 10m
+`), 0644))
+
+	cfg, err := atk.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "/opt/bin/podman", cfg.PodmanPath)
+	assert.Equal(t, 10*time.Minute, cfg.DeployTimeout)
+	assert.Equal(t, filepath.Join("/var/lib/atk", "locks"), cfg.LockDir())
+	assert.Equal(t, filepath.Join("/var/lib/atk", "workspaces"), cfg.WorkspaceRoot())
+	parts := cfg.CliParts()
+	assert.Equal(t, []string{"--authfile", "/home/me/auth.json", "--pull=missing"}, parts.Flags)
+
+	t.Setenv(atk.PodmanPathEnvVar, "/usr/bin/podman")
+	t.Setenv(atk.DeployTimeoutEnvVar, "1h")
+	cfg, err = atk.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/podman", cfg.PodmanPath)
+	assert.Equal(t, time.Hour, cfg.DeployTimeout)
+	assert.Equal(t, "missing", cfg.PullPolicy)
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv(atk.PullPolicyEnvVar, "sometimes")
+	_, err := atk.LoadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+	assert.Error(t, err)
+
+	t.Setenv(atk.PullPolicyEnvVar, "")
+	t.Setenv(atk.DeployTimeoutEnvVar, "soon")
+	_, err = atk.LoadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeContainersConfig(t *testing.T, name string, content string) {
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "containers")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func TestActivePodmanConnection(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(atk.ContainerConnectionEnvVar, "")
+
+	name, err := atk.ActivePodmanConnection()
+	require.NoError(t, err)
+	assert.Empty(t, name)
+
+	writeContainersConfig(t, "containers.conf", `[containers]
+active_service = "not-this-one"
+
+[engine]
+active_service = "remote-box"
+`)
+	name, err = atk.ActivePodmanConnection()
+	require.NoError(t, err)
+	assert.Equal(t, "remote-box", name)
+
+	writeContainersConfig(t, "podman-connections.json",
+		`{"Connection":{"Default":"podman-machine-default","Connections":{}}}`)
+	name, err = atk.ActivePodmanConnection()
+	require.NoError(t, err)
+	assert.Equal(t, "podman-machine-default", name)
+
+	t.Setenv(atk.ContainerConnectionEnvVar, "from-env")
+	name, err = atk.ActivePodmanConnection()
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", name)
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckVariable(t *testing.T) {
+	assert.NoError(t, atk.CheckVariable(atk.EventDataVarInfo{Name: "optional"}))
+	assert.EqualError(t, atk.CheckVariable(atk.EventDataVarInfo{Name: "cluster", Required: true}), "a value is required")
+	assert.NoError(t, atk.CheckVariable(atk.EventDataVarInfo{Name: "replicas", Type: atk.VarTypeInt, Default: "3"}))
+	assert.EqualError(t, atk.CheckVariable(atk.EventDataVarInfo{Name: "replicas", Type: atk.VarTypeInt, Value: "three"}), "the value is not an int")
+	assert.EqualError(t, atk.CheckVariable(atk.EventDataVarInfo{Name: "debug", Type: atk.VarTypeBool, Value: "maybe"}), "the value is not a bool")
+	assert.EqualError(t, atk.CheckVariable(atk.EventDataVarInfo{Name: "region", Value: "mars", Options: []string{"us-east", "eu-de"}}),
+		`"mars" is not one of us-east, eu-de`)
+	assert.NoError(t, atk.CheckVariable(atk.EventDataVarInfo{Name: "name", Value: "my-cluster", Pattern: "[a-z][a-z0-9-]*"}))
+	assert.EqualError(t, atk.CheckVariable(atk.EventDataVarInfo{Name: "name", Value: "My Cluster", Pattern: "[a-z][a-z0-9-]*"}),
+		`"My Cluster" does not match [a-z][a-z0-9-]*`)
+	// The values of passwords are not shown.
+	assert.EqualError(t, atk.CheckVariable(atk.EventDataVarInfo{Name: "root", Type: atk.VarTypePassword, Value: "hunter2", Pattern: ".{12,}"}),
+		"the value does not match .{12,}")
+	assert.True(t, atk.IsSensitiveVariable(atk.EventDataVarInfo{Name: "root", Type: atk.VarTypePassword}))
+}
+
+func TestDeployChecksVariableConstraints(t *testing.T) {
+	runner := atktest.NewFakeRunner().On("constrained-list", atktest.Response{Out: atktest.NewResponse(atk.ListHookResponseEvent,
+		atk.EventDataVarInfo{Name: "region", Options: []string{"us-east", "eu-de"}},
+		atk.EventDataVarInfo{Name: "cluster_name", Required: true})})
+	module := atktest.Manifest("constrained")
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner),
+		atk.WithVariables(atk.EventDataVarInfo{Name: "region", Value: "mars"}))
+
+	_, err := deployment.Deploy(runCtx)
+	var constraintErr *atk.VariableConstraintError
+	require.ErrorAs(t, err, &constraintErr)
+	assert.Equal(t, "constrained", constraintErr.Module)
+	assert.Equal(t, []atk.VariableProblem{
+		{Name: "region", Message: `"mars" is not one of us-east, eu-de`},
+		{Name: "cluster_name", Message: "a value is required"},
+	}, constraintErr.Problems)
+	atktest.AssertNotRan(t, runner, "constrained-validate")
+	atktest.AssertNotRan(t, runner, "constrained-pre-deploy")
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	logger "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextValues(t *testing.T) {
+	log := logger.New()
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ctx := atk.WithBaseDirectory(atk.WithStdErr(atk.WithStdOut(atk.WithLogger(context.Background(), log), out), errOut), "/tmp/base")
+
+	assert.Same(t, log, atk.LoggerFrom(ctx))
+	assert.Same(t, out, atk.StdOutFrom(ctx))
+	assert.Same(t, errOut, atk.StdErrFrom(ctx))
+	assert.Equal(t, "/tmp/base", atk.BaseDirectoryFrom(ctx))
+}
+
+func TestContextValuesNotSet(t *testing.T) {
+	assert.Nil(t, atk.LoggerFrom(context.Background()))
+	assert.Nil(t, atk.StdOutFrom(context.Background()))
+	assert.Nil(t, atk.StdErrFrom(context.Background()))
+	assert.Empty(t, atk.BaseDirectoryFrom(context.Background()))
+	assert.Nil(t, atk.LoggerFrom(context.WithValue(context.Background(), atk.LoggerContextKey, "not a logger")))
+}
+
+func TestRunImageUsesContextValues(t *testing.T) {
+	logOut := &bytes.Buffer{}
+	log := logger.New()
+	log.Out = logOut
+	out := &bytes.Buffer{}
+	ctx := atk.WithStdOut(atk.WithLogger(context.Background(), log), out)
+	runCtx := &atk.RunContext{Context: ctx}
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+
+	require.NoError(t, runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"}))
+	assert.Equal(t, "run myimage\n", out.String())
+	assert.Contains(t, logOut.String(), "running command: echo run myimage")
+}
+
+func TestRunImagePrefersRunContext(t *testing.T) {
+	runCtx, outbuff, _, _ := newTestRunContext()
+	other := &bytes.Buffer{}
+	runCtx.Context = atk.WithStdOut(context.Background(), other)
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+
+	require.NoError(t, runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"}))
+	assert.Equal(t, "run myimage\n", outbuff.String())
+	assert.Empty(t, other.String())
+}
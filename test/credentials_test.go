@@ -0,0 +1,107 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deployCall deploys the module with the options and returns what the
+// deploy stage was run with.
+func deployCall(t *testing.T, opts ...atk.DeployableModuleOption) (atk.ImageInfo, error) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Hooks = atk.HookInfo{}
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, append([]atk.DeployableModuleOption{atk.WithRunner(runner)}, opts...)...)
+	_, err := deployment.Deploy(runCtx)
+	for _, call := range runner.Calls() {
+		if call.Info.Image == "mymodule-deploy" {
+			return call.Info, err
+		}
+	}
+	return atk.ImageInfo{}, err
+}
+
+func TestWithKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte("apiVersion: v1\n"), 0600))
+	t.Setenv("KUBECONFIG", kubeconfig+string(os.PathListSeparator)+filepath.Join(dir, "other"))
+
+	deploy, err := deployCall(t, atk.WithKubeconfig(""))
+	require.NoError(t, err)
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "KUBECONFIG", Value: atk.KubeconfigMountPath})
+	assert.Contains(t, deploy.Volumes, atk.VolumeInfo{Name: kubeconfig, MountPath: atk.KubeconfigMountPath})
+
+	_, err = deployCall(t, atk.WithKubeconfig(filepath.Join(dir, "missing")))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWithAWSCredentials(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, name := range atk.AWSEnvVars {
+		t.Setenv(name, "")
+	}
+	_, err := deployCall(t, atk.WithAWSCredentials())
+	assert.Error(t, err)
+
+	t.Setenv("AWS_PROFILE", "dev")
+	require.NoError(t, os.Mkdir(filepath.Join(home, ".aws"), 0700))
+	deploy, err := deployCall(t, atk.WithAWSCredentials())
+	require.NoError(t, err)
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "AWS_PROFILE", Value: "dev"})
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "AWS_SHARED_CREDENTIALS_FILE", Value: atk.AWSCredentialsMountPath + "/credentials"})
+	assert.Contains(t, deploy.Volumes, atk.VolumeInfo{Name: filepath.Join(home, ".aws"), MountPath: atk.AWSCredentialsMountPath})
+}
+
+func TestWithIBMCloudAPIKeyFromEnv(t *testing.T) {
+	t.Setenv("IBMCLOUD_API_KEY", "")
+	t.Setenv("IC_API_KEY", "the-key")
+
+	deploy, err := deployCall(t, atk.WithIBMCloudAPIKeyFromEnv())
+	require.NoError(t, err)
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "IBMCLOUD_API_KEY", Value: "the-key", Secret: true})
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "IC_API_KEY", Value: "the-key", Secret: true})
+}
+
+// deploySecret deploys the module with a podman script that prints its
+// arguments and the IBM Cloud API key of its environment, and fails the
+// test if the key is in the commands or in the logs of the deployment.
+func deploySecret(t *testing.T, key string, opts ...atk.DeployableModuleOption) string {
+	podman := writeScript(t, t.TempDir(), "podman", "echo \"$@\"\necho \"key=$IC_API_KEY\"\n")
+	runCtx, outbuff, _, hook := newTestRunContext()
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Hooks = atk.HookInfo{}
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman})}
+	deployment := atk.NewDeployableModule(runCtx, module, append([]atk.DeployableModuleOption{atk.WithRunner(runner)}, opts...)...)
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	commands := deployment.LastCommands()
+	require.NotEmpty(t, commands)
+	for _, c := range commands {
+		assert.NotContains(t, strings.Join(c.Argv, " "), key)
+		assert.Contains(t, c.Argv, "IC_API_KEY")
+	}
+	for _, entry := range hook.AllEntries() {
+		assert.NotContains(t, entry.Message, key)
+	}
+	return outbuff.String()
+}
+
+func TestIBMCloudAPIKeyFromEnvIsNotOnCommandLine(t *testing.T) {
+	t.Setenv("IBMCLOUD_API_KEY", "")
+	t.Setenv("IC_API_KEY", "the-secret-key")
+
+	out := deploySecret(t, "the-secret-key", atk.WithIBMCloudAPIKeyFromEnv())
+	assert.Contains(t, out, "-e IBMCLOUD_API_KEY -e IC_API_KEY mymodule-deploy")
+	assert.Contains(t, out, "key=the-secret-key")
+}
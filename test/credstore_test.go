@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCredentialHelper writes a script that stands in for a docker
+// credential helper, keeping the credentials in a file.
+func fakeCredentialHelper(t *testing.T) *atk.HelperCredentialStore {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "creds")
+	path := writeScript(t, dir, "docker-credential-fake", `store=`+store+`
+case "$1" in
+get)
+  server=$(cat); line=$(grep "^$server " $store 2>/dev/null | tail -1)
+  if [ -z "$line" ]; then echo "credentials not found in native keychain"; exit 1; fi
+  echo "${line#* }" ;;
+store)
+  json=$(cat); server=$(echo "$json" | sed 's/.*"ServerURL":"\([^"]*\)".*/\1/')
+  echo "$server $json" >> $store ;;
+erase)
+  server=$(cat); grep -v "^$server " $store > $store.tmp; mv $store.tmp $store ;;
+esac
+`)
+	return &atk.HelperCredentialStore{Helper: "fake", Path: path}
+}
+
+func TestHelperCredentialStore(t *testing.T) {
+	store := fakeCredentialHelper(t)
+
+	_, err := store.Get("quay.io")
+	assert.ErrorIs(t, err, atk.ErrCredentialNotFound)
+
+	require.NoError(t, store.Store(atk.Credential{Server: "https://quay.io/v2/", Username: "me", Secret: "token"}))
+	cred, err := store.Get("quay.io")
+	require.NoError(t, err)
+	assert.Equal(t, &atk.Credential{Server: "quay.io", Username: "me", Secret: "token"}, cred)
+
+	require.NoError(t, store.Erase("quay.io"))
+	_, err = store.Get("quay.io")
+	assert.ErrorIs(t, err, atk.ErrCredentialNotFound)
+
+	missing := &atk.HelperCredentialStore{Helper: "atk-missing-helper"}
+	_, err = missing.Get("quay.io")
+	assert.ErrorIs(t, err, atk.ErrCredentialNotFound)
+}
+
+func TestCredentialServer(t *testing.T) {
+	assert.Equal(t, "quay.io", atk.CredentialServer("https://quay.io/v2/"))
+	assert.Equal(t, "quay.io", atk.CredentialServer("quay.io/org/image:tag"))
+	assert.Equal(t, "localhost:5000", atk.CredentialServer("localhost:5000"))
+	assert.Equal(t, atk.IBMCloudCredentialServer, atk.CredentialServer("cloud.ibm.com"))
+}
+
+func TestCredentialKey(t *testing.T) {
+	store := fakeCredentialHelper(t)
+	_, err := atk.CredentialKey(store, "atk").Key()
+	assert.ErrorIs(t, err, atk.ErrNoEncryptionKey)
+
+	require.NoError(t, store.Store(atk.Credential{Server: "atk", Username: "variables", Secret: "passphrase"}))
+	key, err := atk.CredentialKey(store, "atk").Key()
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+}
+
+func TestWithIBMCloudAPIKey(t *testing.T) {
+	t.Setenv("IBMCLOUD_API_KEY", "")
+	t.Setenv("IC_API_KEY", "env-key")
+	store := fakeCredentialHelper(t)
+
+	// Without a key in the store, the key of the environment is used.
+	deploy, err := deployCall(t, atk.WithIBMCloudAPIKey(store))
+	require.NoError(t, err)
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "IBMCLOUD_API_KEY", Value: "env-key", Secret: true})
+
+	require.NoError(t, store.Store(atk.Credential{Server: atk.IBMCloudCredentialServer, Username: "apikey", Secret: "stored-key"}))
+	deploy, err = deployCall(t, atk.WithIBMCloudAPIKey(store))
+	require.NoError(t, err)
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "IBMCLOUD_API_KEY", Value: "stored-key", Secret: true})
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "IC_API_KEY", Value: "stored-key", Secret: true})
+
+	t.Setenv("IC_API_KEY", "")
+	_, err = deployCall(t, atk.WithIBMCloudAPIKey(fakeCredentialHelper(t)))
+	assert.Error(t, err)
+}
+
+func TestIBMCloudAPIKeyIsNotOnCommandLine(t *testing.T) {
+	t.Setenv("IBMCLOUD_API_KEY", "")
+	t.Setenv("IC_API_KEY", "")
+	store := fakeCredentialHelper(t)
+	require.NoError(t, store.Store(atk.Credential{Server: atk.IBMCloudCredentialServer, Username: "apikey", Secret: "stored-secret-key"}))
+
+	out := deploySecret(t, "stored-secret-key", atk.WithIBMCloudAPIKey(store))
+	assert.Contains(t, out, "-e IBMCLOUD_API_KEY -e IC_API_KEY mymodule-deploy")
+	assert.Contains(t, out, "key=stored-secret-key")
+}
+
+func TestRegistryClientCredentials(t *testing.T) {
+	var downloads int32
+	server := newRegistryServer(t, &downloads)
+	store := fakeCredentialHelper(t)
+	require.NoError(t, store.Store(atk.Credential{Server: server.URL, Username: "token", Secret: "secret"}))
+
+	client := atk.NewRegistryClient(server.URL, "")
+	client.Credentials = store
+	modules, err := client.ListModules(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, modules, 2)
+}
+
+func TestRunImagePullCredentials(t *testing.T) {
+	dir := t.TempDir()
+	copied := filepath.Join(dir, "auth.json")
+	podman := writeScript(t, dir, "podman", `case "$1" in
+image) exit 1 ;;
+pull) [ "$2" = "--authfile" ] && cp "$3" `+copied+` && echo "$3" > `+copied+`.path ;;
+*) echo "$@" ;;
+esac
+`)
+	store := fakeCredentialHelper(t)
+	require.NoError(t, store.Store(atk.Credential{Server: "quay.io", Username: "me", Secret: "token"}))
+
+	runCtx, _, _, _ := newTestRunContext()
+	runner := &atk.CliModuleRunner{
+		PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman}),
+		Pull:                    &atk.PullOptions{Credentials: store},
+	}
+	require.NoError(t, runner.RunImage(runCtx, atk.ImageInfo{Image: "quay.io/org/image:1.0"}))
+	content, err := os.ReadFile(copied)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"quay.io"`)
+	assert.Contains(t, string(content), base64.StdEncoding.EncodeToString([]byte("me:token")))
+	// The auth file is removed once the image is pulled.
+	path, err := os.ReadFile(copied + ".path")
+	require.NoError(t, err)
+	assert.NoFileExists(t, string(path[:len(path)-1]))
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookOutputErrorDeadLetterDir(t *testing.T) {
+	dir := t.TempDir()
+	runner := atktest.NewFakeRunner().On("dlq-list", atktest.Response{Out: "{not an event\n"})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("dlq"), atk.WithRunner(runner),
+		atk.WithDeadLetters(atk.NewDirDeadLetterQueue(dir)))
+
+	_, err := deployment.List(runCtx)
+	var hookErr *atk.HookOutputError
+	require.ErrorAs(t, err, &hookErr)
+	assert.Equal(t, atk.ListHook, hookErr.Hook)
+	assert.Equal(t, "{not an event\n", string(hookErr.Output))
+	require.NotEmpty(t, hookErr.DeadLetter)
+	assert.Contains(t, err.Error(), hookErr.DeadLetter)
+
+	content, err := os.ReadFile(hookErr.DeadLetter)
+	require.NoError(t, err)
+	var letter atk.DeadLetter
+	require.NoError(t, json.Unmarshal(content, &letter))
+	assert.Equal(t, "dlq", letter.Module)
+	assert.Equal(t, deployment.RunID(), letter.RunID)
+	assert.Equal(t, "{not an event\n", letter.Output)
+	assert.Contains(t, letter.Error, "could not load list hook response")
+}
+
+func TestHookOutputErrorDeadLetterSink(t *testing.T) {
+	sink := &recordingSink{}
+	wrongType := atktest.NewResponse(atk.ListHookResponseEvent)
+	runner := atktest.NewFakeRunner().On("dlq-get-state", atktest.Response{Out: wrongType})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("dlq"), atk.WithRunner(runner),
+		atk.WithDeadLetters(&atk.SinkDeadLetterQueue{Sink: sink}))
+
+	_, err := deployment.GetState(runCtx)
+	var hookErr *atk.HookOutputError
+	require.ErrorAs(t, err, &hookErr)
+	assert.ErrorIs(t, err, atk.ErrNoEvent)
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, string(atk.HookDeadLetterEvent), sink.events[0].Type())
+	assert.Equal(t, hookErr.DeadLetter, sink.events[0].ID())
+	var letter atk.DeadLetter
+	require.NoError(t, sink.events[0].DataAs(&letter))
+	assert.Equal(t, atk.GetStateHook, letter.Hook)
+	assert.Equal(t, wrongType, letter.Output)
+}
+
+func TestHookOutputErrorWithoutOutput(t *testing.T) {
+	sink := &recordingSink{}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("dlq"), atk.WithRunner(atktest.NewFakeRunner()),
+		atk.WithDeadLetters(&atk.SinkDeadLetterQueue{Sink: sink}))
+
+	_, err := deployment.List(runCtx)
+	var hookErr *atk.HookOutputError
+	require.ErrorAs(t, err, &hookErr)
+	assert.Empty(t, hookErr.DeadLetter)
+	assert.Empty(t, sink.events)
+}
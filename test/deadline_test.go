@@ -0,0 +1,49 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployDeadline(t *testing.T) {
+	dir := t.TempDir()
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle = atk.LifecycleInfo{
+		PreDeploy:  atk.ImageInfo{Script: writeScript(t, dir, "pre.sh", "exit 0\n")},
+		Deploy:     atk.ImageInfo{Script: writeScript(t, dir, "deploy.sh", "exec sleep 30\n")},
+		PostDeploy: atk.ImageInfo{Script: writeScript(t, dir, "post.sh", "exit 0\n")},
+	}
+	module.Specifications.Hooks = atk.HookInfo{}
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module,
+		atk.WithRunner(atk.NewLocalModuleRunner(t.TempDir())), atk.WithDeadline(200*time.Millisecond))
+	started := time.Now()
+	result, err := deployment.Deploy(runCtx)
+
+	assert.Less(t, time.Since(started), 10*time.Second)
+	var timeout *atk.DeadlineExceededError
+	require.ErrorAs(t, err, &timeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, atk.Deploying, timeout.State)
+	assert.Equal(t, atk.TimedOut, deployment.State())
+	assert.True(t, deployment.IsErrored())
+	assert.Equal(t, atk.TimedOut, result.State)
+	assert.Equal(t, atk.Deploying, result.FailedState)
+}
+
+func TestDeployWithinDeadline(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"),
+		atk.WithRunner(atktest.NewFakeRunner()), atk.WithDeadline(time.Minute))
+	result, err := deployment.Deploy(runCtx)
+
+	assert.NoError(t, err)
+	assert.True(t, result.Succeeded())
+}
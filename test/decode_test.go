@@ -0,0 +1,101 @@
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const manifestStream = `---
+apiVersion: itzcli/v1alpha1
+kind: InstallManifest
+metadata:
+  name: first
+---
+# an empty document
+---
+apiVersion: itzcli/v1alpha1
+kind: InstallManifest
+metadata:
+  name: second
+`
+
+func TestLoadAllStream(t *testing.T) {
+	loader := atk.NewAtkManifestFileLoader()
+	modules, err := loader.LoadAll(strings.NewReader(manifestStream), "stream.yaml")
+	require.NoError(t, err)
+	require.Len(t, modules, 2)
+	assert.Equal(t, "first", modules[0].Metadata.Name)
+	assert.Equal(t, "second", modules[1].Metadata.Name)
+}
+
+func TestLoadReaderLoadsFirstManifest(t *testing.T) {
+	loader := atk.NewAtkManifestFileLoader()
+	module, err := loader.LoadReader(strings.NewReader(manifestStream), "stream.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "first", module.Metadata.Name)
+}
+
+func TestLoadReaderEmpty(t *testing.T) {
+	loader := atk.NewAtkManifestFileLoader()
+	_, err := loader.LoadReader(strings.NewReader("---\n"), "empty.yaml")
+	assert.EqualError(t, err, "no manifest found in empty.yaml")
+}
+
+func TestLoadAllReportsPosition(t *testing.T) {
+	stream := manifestStream + "---\napiVersion: itzcli/v1alpha1\nkind: InstallManifest\nmetadata:\n  labels: [a, b]\n"
+	loader := atk.NewAtkManifestFileLoader()
+	modules, err := loader.LoadAll(strings.NewReader(stream), "stream.yaml")
+	assert.Len(t, modules, 2)
+
+	var syntaxErr *atk.ManifestSyntaxError
+	require.ErrorAs(t, err, &syntaxErr)
+	assert.Equal(t, 4, syntaxErr.Document)
+	assert.Equal(t, 17, syntaxErr.Line)
+	assert.Equal(t, int64(strings.Index(stream, "  labels")), syntaxErr.Offset)
+	assert.Contains(t, err.Error(), "document 4 of manifest stream.yaml at line 17")
+}
+
+func TestManifestDecoderStopsAfterSyntaxError(t *testing.T) {
+	decoder := atk.NewManifestDecoder(strings.NewReader("apiVersion: itzcli/v1alpha1\nmetadata:\n  name: [broken\n"), "broken.yaml")
+	_, err := decoder.Decode()
+	var syntaxErr *atk.ManifestSyntaxError
+	require.ErrorAs(t, err, &syntaxErr)
+	assert.Equal(t, 1, syntaxErr.Document)
+	assert.NotZero(t, syntaxErr.Line)
+
+	_, again := decoder.Decode()
+	assert.Equal(t, err, again)
+}
+
+func TestManifestDecoderEOF(t *testing.T) {
+	decoder := atk.NewManifestDecoder(strings.NewReader(manifestStream), "stream.yaml")
+	for i := 0; i < 2; i++ {
+		_, err := decoder.Decode()
+		require.NoError(t, err)
+	}
+	_, err := decoder.Decode()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestLoadReaderWithChecksum(t *testing.T) {
+	content, err := os.ReadFile("examples/module2.yml")
+	require.NoError(t, err)
+	sum := sha256.Sum256(content)
+	verifier := atk.WithManifestVerifier(&atk.ChecksumVerifier{SHA256: "sha256:" + hex.EncodeToString(sum[:])})
+
+	module, err := atk.NewAtkManifestFileLoader(verifier).LoadReader(strings.NewReader(string(content)), "module2.yml")
+	require.NoError(t, err)
+	assert.Equal(t, "MyOtherModule", module.Metadata.Name)
+
+	_, err = atk.NewAtkManifestFileLoader(verifier).LoadReader(strings.NewReader(string(content)+"\n"), "module2.yml")
+	var integrityErr *atk.ManifestIntegrityError
+	assert.ErrorAs(t, err, &integrityErr)
+}
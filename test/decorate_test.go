@@ -0,0 +1,52 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColorEnabled(t *testing.T) {
+	assert.False(t, atk.ColorEnabled(new(bytes.Buffer)))
+	assert.False(t, atk.IsTerminal(new(bytes.Buffer)))
+}
+
+func TestOutputDecorator(t *testing.T) {
+	buf := new(bytes.Buffer)
+	d := &atk.OutputDecorator{}
+	d.Started(buf, atk.Deploying)
+	w := d.Writer(buf, atk.Deploying, atk.Stdout)
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthree"))
+	require.NoError(t, w.Flush())
+	d.Stopped(buf, atk.Deploying, 1500*time.Millisecond, nil)
+	d.Stopped(buf, atk.PostDeploying, 0, errors.New("exit status 1"))
+	assert.Equal(t, "▶ deploying\n[deploying] one\n[deploying] two\n[deploying] three\n✔ deploying (1.5s)\n✖ postdeploying: exit status 1\n", buf.String())
+
+	buf.Reset()
+	d.Color = true
+	d.Stopped(buf, atk.Deploying, time.Second, nil)
+	assert.Equal(t, "\x1b[32m✔\x1b[0m deploying \x1b[2m(1s)\x1b[0m\n", buf.String())
+}
+
+func TestDeployWithOutputDecorator(t *testing.T) {
+	runCtx, outbuff, _, _ := newTestRunContext()
+	module := atktest.Manifest("mymodule")
+	runner := atktest.NewFakeRunner()
+	runner.On("mymodule-deploy", atktest.Response{Out: "applying\n"})
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithOutputDecorator(&atk.OutputDecorator{}))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	out := outbuff.String()
+	assert.Contains(t, out, "▶ deploying\n[deploying] applying\n✔ deploying (")
+	assert.Equal(t, 3, strings.Count(out, "▶"))
+	assert.Equal(t, 3, strings.Count(out, "✔"))
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const defaultsManifest = `apiVersion: itzcli/v1alpha1
+kind: InstallManifest
+metadata:
+  name: defaults
+spec:
+  lifecycle:
+    deploy:
+      image: " Example/Deploy:V1 "
+      env:
+        - name: REGION
+          value: " us-east "
+    post_deploy:
+      image: localhost:5000/post
+`
+
+func writeDefaultsManifest(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "module.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(defaultsManifest), 0644))
+	return path
+}
+
+func TestLoadNormalizesManifest(t *testing.T) {
+	loader := atk.NewAtkManifestFileLoader()
+	module, err := loader.Load(writeDefaultsManifest(t))
+	require.NoError(t, err)
+
+	deploy := module.Specifications.Lifecycle.Deploy
+	assert.Equal(t, "example/deploy:V1", deploy.Image)
+	assert.Equal(t, "us-east", deploy.EnvVars[0].Value)
+	assert.Equal(t, "localhost:5000/post", module.Specifications.Lifecycle.PostDeploy.Image)
+	assert.Equal(t, []atk.AppliedDefault{
+		{Path: "spec.lifecycle.deploy.image", From: " Example/Deploy:V1 ", To: "example/deploy:V1"},
+		{Path: "spec.lifecycle.deploy.env[0].value", From: " us-east ", To: "us-east"},
+	}, loader.Applied().Applied)
+	assert.Empty(t, loader.Applied().Warnings)
+}
+
+func TestLoadWithDefaultRegistry(t *testing.T) {
+	loader := atk.NewAtkManifestFileLoader(atk.WithDefaults(atk.ManifestDefaults{Registry: "docker.io", TagPolicy: atk.TagPolicyWarn}))
+	module, err := loader.Load(writeDefaultsManifest(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, "docker.io/example/deploy:V1", module.Specifications.Lifecycle.Deploy.Image)
+	assert.Equal(t, "localhost:5000/post", module.Specifications.Lifecycle.PostDeploy.Image)
+	assert.Equal(t, []string{"spec.lifecycle.post_deploy.image: image localhost:5000/post uses the latest tag"}, loader.Applied().Warnings)
+}
+
+func TestApplyDefaults(t *testing.T) {
+	tests := []struct {
+		image    string
+		registry string
+		expected string
+	}{
+		{"alpine", "docker.io", "docker.io/library/alpine"},
+		{"alpine:3.18", "quay.io/", "quay.io/alpine:3.18"},
+		{"Quay.io/Org/App@sha256:ABC", "docker.io", "quay.io/org/app@sha256:ABC"},
+		{"org/app:Latest", "", "org/app:Latest"},
+	}
+	for _, tt := range tests {
+		module := &atk.ModuleInfo{}
+		module.Specifications.Lifecycle.Deploy.Image = tt.image
+		_, err := module.ApplyDefaults(atk.ManifestDefaults{Registry: tt.registry})
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, module.Specifications.Lifecycle.Deploy.Image, tt.image)
+	}
+}
+
+func TestApplyDefaultsRejectsLatest(t *testing.T) {
+	module := &atk.ModuleInfo{}
+	module.Specifications.Lifecycle.PreDeploy.Image = "quay.io/org/pre:latest"
+	module.Specifications.Lifecycle.Deploy.Image = "quay.io/org/deploy@sha256:abc"
+	_, err := module.ApplyDefaults(atk.ManifestDefaults{TagPolicy: atk.TagPolicyReject})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "quay.io/org/pre:latest (spec.lifecycle.pre_deploy.image)")
+	assert.NotContains(t, err.Error(), "deploy@sha256")
+}
@@ -0,0 +1,136 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func planModule(name string, dependsOn ...string) *atk.ModuleInfo {
+	module := atktest.Manifest(name)
+	module.Specifications.Hooks = atk.HookInfo{}
+	module.Metadata.DependsOn = dependsOn
+	return module
+}
+
+func TestDeploymentPlanOrder(t *testing.T) {
+	plan, err := atk.NewDeploymentPlan([]*atk.ModuleInfo{
+		planModule("app", "cluster", "database"),
+		planModule("database", "network"),
+		planModule("cluster", "network"),
+		planModule("network"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"network", "cluster", "database", "app"}, moduleNames(plan.Modules))
+	assert.Equal(t, []string{"app", "cluster", "database"}, plan.Dependents("network"))
+}
+
+func TestDeploymentPlanCycle(t *testing.T) {
+	_, err := atk.NewDeploymentPlan([]*atk.ModuleInfo{
+		planModule("a", "b"),
+		planModule("b", "c"),
+		planModule("c", "a"),
+	})
+	var cycle *atk.DependencyCycleError
+	require.ErrorAs(t, err, &cycle)
+	assert.Equal(t, []string{"a", "b", "c", "a"}, cycle.Cycle)
+}
+
+func TestDeploymentPlanUnknownDependency(t *testing.T) {
+	_, err := atk.NewDeploymentPlan([]*atk.ModuleInfo{planModule("a", "missing")})
+	assert.ErrorContains(t, err, "not in the plan")
+}
+
+func TestDeploymentPlanSkipsDependents(t *testing.T) {
+	plan, err := atk.NewDeploymentPlan([]*atk.ModuleInfo{
+		planModule("network"),
+		planModule("cluster", "network"),
+		planModule("app", "cluster"),
+		planModule("docs"),
+	})
+	require.NoError(t, err)
+
+	runner := atktest.NewFakeRunner().On("network-deploy", atktest.Response{ExitCode: 1})
+	runCtx, _, _, _ := newTestRunContext()
+	results := plan.Deploy(runCtx, 2, atk.WithRunner(runner))
+
+	require.Len(t, results, 4)
+	byName := make(map[string]atk.PlanResult)
+	for _, r := range results {
+		byName[r.Module.Metadata.Name] = r
+	}
+	assert.Error(t, byName["network"].Err)
+	assert.False(t, byName["network"].Skipped)
+	assert.True(t, byName["cluster"].Skipped)
+	var failed *atk.DependencyFailedError
+	require.ErrorAs(t, byName["app"].Err, &failed)
+	assert.Equal(t, "cluster", failed.Dependency)
+	assert.NoError(t, byName["docs"].Err)
+	assert.Equal(t, atk.Done, byName["docs"].Result.State)
+	atktest.AssertNotRan(t, runner, "cluster-pre-deploy")
+}
+
+func TestDeploymentPlanResolvesReferences(t *testing.T) {
+	vpc := planModule("vpc")
+	vpc.Specifications.Hooks.GetState = atk.ImageInfo{Image: "vpc-get-state"}
+	vpc.Specifications.Lifecycle.Deploy.Scanners = []atk.ScannerInfo{{Pattern: `vpc_id=(\S+)`, Output: "vpc_id"}}
+	cluster := planModule("cluster", "vpc")
+	cluster.Specifications.Lifecycle.Deploy.EnvVars = []atk.EnvVarInfo{
+		{Name: "VPC_ID", Value: "${modules.vpc.outputs.vpc_id}"},
+		{Name: "SUBNETS", Value: "${modules.vpc.state.network.subnets}"},
+	}
+	cluster.Specifications.Lifecycle.Deploy.Args = []string{"--region=${modules.vpc.state.region}"}
+
+	plan, err := atk.NewDeploymentPlan([]*atk.ModuleInfo{cluster, vpc})
+	require.NoError(t, err)
+
+	runner := atktest.NewFakeRunner().
+		On("vpc-deploy", atktest.Response{Out: "created vpc_id=vpc-123\n"}).
+		// Nothing is deployed before the deployment of vpc.
+		OnSequence("vpc-get-state", atktest.Response{ExitCode: atk.HookExitUndetermined},
+			atktest.Response{Out: atktest.StateResponseWithData("DEPLOYED", map[string]interface{}{
+				"region":  "us-east",
+				"network": map[string]interface{}{"subnets": []string{"a", "b"}},
+			})})
+	runCtx, _, _, _ := newTestRunContext()
+	results := plan.Deploy(runCtx, 1, atk.WithRunner(runner))
+	for _, r := range results {
+		require.NoError(t, r.Err, r.Module.Metadata.Name)
+	}
+	assert.Equal(t, "vpc-123", results[0].Result.Outputs["vpc_id"])
+
+	var deploy atk.ImageInfo
+	for _, call := range runner.Calls() {
+		if call.Info.Image == "cluster-deploy" {
+			deploy = call.Info
+		}
+	}
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "VPC_ID", Value: "vpc-123"})
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "SUBNETS", Value: `["a","b"]`})
+	assert.Equal(t, []string{"--region=us-east"}, deploy.Args)
+	assert.Equal(t, "${modules.vpc.outputs.vpc_id}", cluster.Specifications.Lifecycle.Deploy.EnvVars[0].Value)
+}
+
+func TestDeploymentPlanUnresolvedReference(t *testing.T) {
+	vpc := planModule("vpc")
+	cluster := planModule("cluster", "vpc")
+	cluster.Specifications.Lifecycle.Deploy.EnvVars = []atk.EnvVarInfo{{Name: "VPC_ID", Value: "${modules.vpc.outputs.vpc_id}"}}
+	plan, err := atk.NewDeploymentPlan([]*atk.ModuleInfo{vpc, cluster})
+	require.NoError(t, err)
+
+	runCtx, _, _, _ := newTestRunContext()
+	results := plan.Deploy(runCtx, 1, atk.WithRunner(atktest.NewFakeRunner()))
+	var unresolved *atk.UnresolvedReferenceError
+	require.ErrorAs(t, results[1].Err, &unresolved)
+	assert.Equal(t, "vpc_id", unresolved.Reference.Key)
+}
+
+func TestDeploymentPlanReferenceWithoutDependency(t *testing.T) {
+	cluster := planModule("cluster")
+	cluster.Specifications.Lifecycle.Deploy.EnvVars = []atk.EnvVarInfo{{Name: "VPC_ID", Value: "${modules.vpc.outputs.vpc_id}"}}
+	_, err := atk.NewDeploymentPlan([]*atk.ModuleInfo{cluster, planModule("vpc")})
+	assert.ErrorContains(t, err, "does not depend on module vpc")
+}
@@ -0,0 +1,62 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureDiagnostics(t *testing.T) {
+	module := atktest.Manifest("diag")
+	module.Specifications.Hooks = atk.HookInfo{}
+	var stderr strings.Builder
+	for idx := 1; idx <= 30; idx++ {
+		fmt.Fprintf(&stderr, "line %d\n", idx)
+	}
+	runner := atktest.NewFakeRunner().On("diag-deploy", atktest.Response{Err: stderr.String(), ExitCode: 3})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithFailureStderrLines(5))
+
+	result, err := deployment.Deploy(runCtx)
+	require.Error(t, err)
+	require.NotNil(t, result.Failure)
+	assert.Equal(t, atk.Deploying, result.Failure.State)
+	assert.Equal(t, 3, result.Failure.ExitCode)
+	assert.Equal(t, []string{"line 26", "line 27", "line 28", "line 29", "line 30"}, result.Failure.Stderr)
+	assert.NotEmpty(t, result.Failure.Errors)
+	assert.Empty(t, result.Failure.Command)
+}
+
+func TestFailureDiagnosticsCommand(t *testing.T) {
+	module := atktest.Manifest("diag")
+	module.Specifications.Hooks = atk.HookInfo{}
+	module.Specifications.Lifecycle.PreDeploy.EnvVars = []atk.EnvVarInfo{{Name: "TOKEN", Value: "s3cret"}}
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "false"})}
+	runCtx, _, _, _ := newTestRunContext()
+	runCtx.Mask("s3cret")
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+
+	result, err := deployment.Deploy(runCtx)
+	require.Error(t, err)
+	require.NotNil(t, result.Failure)
+	assert.Equal(t, atk.PreDeploying, result.Failure.State)
+	assert.Equal(t, 1, result.Failure.ExitCode)
+	require.NotEmpty(t, result.Failure.Command)
+	assert.Equal(t, "false", result.Failure.Command[0])
+	assert.Contains(t, strings.Join(result.Failure.Command, " "), "diag-pre-deploy")
+	assert.NotContains(t, strings.Join(result.Failure.Command, " "), "s3cret")
+}
+
+func TestNoFailureDiagnosticsOnSuccess(t *testing.T) {
+	module := atktest.Manifest("diag")
+	module.Specifications.Hooks = atk.HookInfo{}
+	runCtx, _, _, _ := newTestRunContext()
+	result, err := atk.NewDeployableModule(runCtx, module, atk.WithRunner(atktest.NewFakeRunner())).Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Nil(t, result.Failure)
+}
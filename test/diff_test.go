@@ -0,0 +1,49 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle.Deploy.EnvVars = []atk.EnvVarInfo{
+		{Name: "REGION", Value: "us-east"},
+		{Name: "SIZE", Value: "large"},
+		{Name: "ZONE", Value: "1"},
+		{Name: "API_KEY"},
+	}
+	runner := atktest.NewFakeRunner().On("mymodule-get-state", atktest.Response{
+		Out: atktest.StateResponseWithData("DEPLOYING", map[string]interface{}{
+			"region": "us-west",
+			"ZONE":   1,
+		}),
+	})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+
+	diff, err := deployment.Diff(runCtx)
+	require.NoError(t, err)
+	assert.Equal(t, []atk.FieldDiff{
+		{Path: "health.status", Change: atk.DiffUpdate, Desired: "DEPLOYED", Actual: "DEPLOYING"},
+		{Path: "data.REGION", Change: atk.DiffUpdate, Desired: "us-east", Actual: "us-west"},
+		{Path: "data.SIZE", Change: atk.DiffAdd, Desired: "large"},
+	}, diff.Changes)
+	assert.Contains(t, diff.String(), "~ data.REGION: us-west -> us-east\n")
+	assert.Contains(t, diff.String(), "+ data.SIZE: large\n")
+}
+
+func TestDiffUpToDate(t *testing.T) {
+	runner := atktest.NewFakeRunner().On("mymodule-get-state", atktest.Response{Out: atktest.StateResponse("DEPLOYED")})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	diff, err := deployment.Diff(runCtx)
+	require.NoError(t, err)
+	assert.True(t, diff.Empty())
+	assert.Equal(t, "module mymodule is up to date\n", diff.String())
+}
@@ -0,0 +1,153 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealVariables(t *testing.T) {
+	key := make([]byte, 32)
+	vars := []atk.EventDataVarInfo{{Name: "password", Value: "s3cret", Sensitive: true}}
+
+	sealed, err := atk.SealVariables(key, vars)
+	require.NoError(t, err)
+	assert.Equal(t, atk.CipherAES256GCM, sealed.Cipher)
+	assert.NotContains(t, string(sealed.Data), "s3cret")
+
+	opened, err := sealed.Open(key)
+	require.NoError(t, err)
+	assert.Equal(t, vars, opened)
+
+	other := make([]byte, 32)
+	other[0] = 1
+	_, err = sealed.Open(other)
+	assert.Error(t, err)
+	_, err = atk.SealVariables([]byte("short"), vars)
+	assert.Error(t, err)
+}
+
+func TestKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "atk.key")
+	_, err := atk.KeyFile(path).Key()
+	assert.ErrorIs(t, err, atk.ErrNoEncryptionKey)
+
+	require.NoError(t, atk.GenerateKeyFile(path))
+	assert.Error(t, atk.GenerateKeyFile(path))
+	key, err := atk.KeyFile(path).Key()
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+	again, err := atk.KeyFile(path).Key()
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	// Any file can be used as a key file, such as an age identity.
+	identity := filepath.Join(t.TempDir(), "identity.txt")
+	require.NoError(t, os.WriteFile(identity, []byte("AGE-SECRET-KEY-1EXAMPLE\n"), 0600))
+	key, err = atk.KeyFile(identity).Key()
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+}
+
+// suspendWithVariables suspends the deploy stage of a deployment of the
+// module with the variables and returns the checkpoint.
+func suspendWithVariables(t *testing.T, dir string, module *atk.ModuleInfo, opts ...atk.DeployableModuleOption) *atk.CheckpointInfo {
+	runner := newCheckpointRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	opts = append([]atk.DeployableModuleOption{atk.WithRunner(runner), atk.WithCheckpointDir(dir), atk.WithRunID("run-1"),
+		atk.WithVariables(atk.EventDataVarInfo{Name: "password", Value: "s3cret"}, atk.EventDataVarInfo{Name: "region", Value: "us-east", Default: "us-east"})}, opts...)
+	deployment := atk.NewDeployableModule(runCtx, module, opts...)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		deployment.Deploy(runCtx)
+	}()
+	select {
+	case <-runner.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the deploy stage did not start")
+	}
+	checkpoint, err := deployment.Suspend(runCtx)
+	require.NoError(t, err)
+	<-done
+	return checkpoint
+}
+
+func checkpointModule() *atk.ModuleInfo {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle = atk.LifecycleInfo{
+		Deploy: atk.ImageInfo{Image: "deploy"},
+	}
+	return module
+}
+
+func TestSuspendEncryptsVariables(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(t.TempDir(), "atk.key")
+	require.NoError(t, atk.GenerateKeyFile(keyFile))
+	module := checkpointModule()
+
+	checkpoint := suspendWithVariables(t, dir, module, atk.WithVariableEncryption(atk.KeyFile(keyFile)))
+	assert.Equal(t, []string{"password"}, checkpoint.VariableNames)
+	require.NotNil(t, checkpoint.Variables)
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(checkpoint.Archive), "run-1.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "s3cret")
+
+	runCtx, _, _, _ := newTestRunContext()
+	resumed := atk.NewDeployableModule(runCtx, module, atk.WithRunner(newCheckpointRunner()),
+		atk.WithCheckpointDir(dir), atk.WithRunID("run-1"), atk.WithVariableEncryption(atk.KeyFile(keyFile)))
+	assert.True(t, resumed.CanPersistVariables())
+	result, err := resumed.Resume(runCtx)
+	require.NoError(t, err)
+	assert.True(t, result.Succeeded())
+	values := make(map[string]string)
+	for _, v := range resumed.Variables().Variables {
+		values[v.Name] = v.Value
+	}
+	assert.Equal(t, "s3cret", values["password"])
+}
+
+func TestSuspendWithoutKeyPromptsAgain(t *testing.T) {
+	dir := t.TempDir()
+	module := checkpointModule()
+
+	checkpoint := suspendWithVariables(t, dir, module, atk.WithVariableEncryption(atk.KeyFile(filepath.Join(dir, "missing.key"))))
+	assert.Equal(t, []string{"password"}, checkpoint.VariableNames)
+	assert.Nil(t, checkpoint.Variables)
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(checkpoint.Archive), "run-1.json"))
+	require.NoError(t, err)
+	assert.False(t, strings.Contains(string(content), "s3cret"))
+
+	loaded, err := atk.LoadCheckpoint(dir, module, "run-1")
+	require.NoError(t, err)
+	vars, missing, err := loaded.OpenVariables(nil)
+	require.NoError(t, err)
+	assert.Empty(t, vars)
+	assert.Equal(t, []string{"password"}, missing)
+
+	runCtx, _, _, _ := newTestRunContext()
+	resumed := atk.NewDeployableModule(runCtx, module, atk.WithRunner(newCheckpointRunner()),
+		atk.WithCheckpointDir(dir), atk.WithRunID("run-1"))
+	assert.False(t, resumed.CanPersistVariables())
+	_, err = resumed.Resume(runCtx)
+	var missingErr *atk.MissingVariablesError
+	require.True(t, errors.As(err, &missingErr))
+	assert.Equal(t, []string{"password"}, missingErr.Names)
+
+	// The values that the user is prompted for again are given as variables.
+	resumed = atk.NewDeployableModule(runCtx, module, atk.WithRunner(newCheckpointRunner()),
+		atk.WithCheckpointDir(dir), atk.WithRunID("run-1"), atk.WithVariables(atk.EventDataVarInfo{Name: "password", Value: "s3cret"}))
+	result, err := resumed.Resume(runCtx)
+	require.NoError(t, err)
+	assert.True(t, result.Succeeded())
+}
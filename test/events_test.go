@@ -0,0 +1,164 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEventMissingFields(t *testing.T) {
+	_, err := atk.LoadEvent(`{
+  "specversion": "1.0",
+  "type": "com.ibm.techzone.cli.hook.list.response",
+  "source": "atk-lister",
+  "id": "1"
+}`)
+
+	var invalid *atk.InvalidEventError
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, []string{"datacontenttype is required", "data is required"}, invalid.Problems)
+	assert.Equal(t, "invalid event of type com.ibm.techzone.cli.hook.list.response: datacontenttype is required; data is required", err.Error())
+}
+
+func TestLoadEventUnsupportedContentType(t *testing.T) {
+	_, err := atk.LoadEvent(`{
+  "specversion": "1.0",
+  "type": "com.ibm.techzone.cli.hook.list.response",
+  "source": "atk-lister",
+  "id": "1",
+  "datacontenttype": "text/plain",
+  "data": "hello"
+}`)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "datacontenttype text/plain is not supported")
+}
+
+func TestLoadEventOfType(t *testing.T) {
+	event, err := atk.LoadEventOfType(atktest.ListResponse, atk.ListHookResponseEvent)
+	assert.NoError(t, err)
+	assert.Equal(t, string(atk.ListHookResponseEvent), event.Type())
+
+	_, err = atk.LoadEventOfType(atktest.ListResponse, atk.GetStateHookResponseEvent)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected type com.ibm.techzone.cli.hook.get_state.response")
+
+	_, err = atk.LoadEventOfType(yamlListResponse, atk.GetStateHookResponseEvent)
+	var invalid *atk.InvalidEventError
+	assert.ErrorAs(t, err, &invalid)
+}
+
+func TestNewListResponseEvent(t *testing.T) {
+	event := atk.NewListResponseEvent("mymodule", atk.EventData{
+		Variables: []atk.EventDataVarInfo{{Name: "TF_VAR_cloud_provider", Default: "aws"}},
+	})
+
+	assert.NoError(t, atk.ValidateEvent(event, atk.ListHookResponseEvent))
+	assert.Equal(t, "mymodule", event.Subject())
+	assert.Equal(t, atk.EventSource, event.Source())
+	assert.NotEmpty(t, event.ID())
+	assert.False(t, event.Time().IsZero())
+
+	outbuff := new(bytes.Buffer)
+	assert.NoError(t, atk.WriteEvent(event, outbuff))
+	atktest.AssertVariables(t, outbuff.String(), "TF_VAR_cloud_provider")
+}
+
+func TestNewValidateResponseEvent(t *testing.T) {
+	event := atk.NewValidateResponseEvent("mymodule", atk.ValidateResponseData{Status: "OK"})
+
+	outbuff := new(bytes.Buffer)
+	assert.NoError(t, atk.WriteEvent(event, outbuff))
+	loaded, err := atk.LoadEventOfType(outbuff.String(), atk.ValidateHookResponseEvent)
+	assert.NoError(t, err)
+	assert.Equal(t, event.ID(), loaded.ID())
+}
+
+const yamlListResponse = `specversion: "1.0"
+type: com.ibm.techzone.cli.hook.list.response
+source: atk-lister
+id: "1"
+time: 2023-02-13T17:17:48.57Z
+datacontenttype: application/yaml
+data:
+  variables:
+    - name: TF_VAR_cloud_provider
+      default: fyre
+`
+
+func TestLoadEventYAML(t *testing.T) {
+	event, err := atk.LoadEvent(yamlListResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, string(atk.ListHookResponseEvent), event.Type())
+	assert.Equal(t, atk.ApplicationYAML, event.DataContentType())
+
+	data, err := atk.LoadEventData(event)
+	assert.NoError(t, err)
+	assert.Equal(t, []atk.EventDataVarInfo{{Name: "TF_VAR_cloud_provider", Default: "fyre"}}, data.Variables)
+}
+
+func TestLoadEventYAMLWithJSONData(t *testing.T) {
+	event, err := atk.LoadEventYAML(`specversion: "1.0"
+type: com.ibm.techzone.cli.hook.list.response
+source: atk-lister
+id: "1"
+datacontenttype: application/json
+data:
+  variables:
+    - name: MYVAR
+`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"variables":[{"name":"MYVAR"}]}`, string(event.Data()))
+}
+
+func TestLoadEventYAMLWithStringData(t *testing.T) {
+	event, err := atk.LoadEventYAML(`specversion: "1.0"
+type: com.ibm.techzone.cli.hook.list.response
+source: atk-lister
+id: "1"
+datacontenttype: application/json
+data: hello
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(event.Data()))
+	var data string
+	assert.NoError(t, atk.DecodeEventData(event, &data))
+	assert.Equal(t, "hello", data)
+}
+
+func TestLoadEventBase64Data(t *testing.T) {
+	event, err := atk.LoadEvent(`{
+  "specversion": "1.0",
+  "type": "com.ibm.techzone.cli.hook.list.response",
+  "source": "atk-lister",
+  "id": "1",
+  "datacontenttype": "application/yaml",
+  "data_base64": "dmFyaWFibGVzOgogIC0gbmFtZTogTVlWQVIK"
+}`)
+	assert.NoError(t, err)
+	data, err := atk.LoadEventData(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "MYVAR", data.Variables[0].Name)
+}
+
+func TestWriteEventYAMLRoundTrip(t *testing.T) {
+	event := atk.NewListResponseEvent("mymodule", atk.EventData{
+		Variables: []atk.EventDataVarInfo{{Name: "MYVAR", Default: "myvalue"}},
+	})
+	event.SetExtension("atkrunid", "test-run")
+
+	outbuff := new(bytes.Buffer)
+	assert.NoError(t, atk.WriteEventYAML(event, outbuff))
+	assert.Contains(t, outbuff.String(), "specversion: \"1.0\"\ntype: com.ibm.techzone.cli.hook.list.response\n")
+	assert.Contains(t, outbuff.String(), "atkrunid: test-run\n")
+
+	loaded, err := atk.LoadEventOfType(outbuff.String(), atk.ListHookResponseEvent)
+	assert.NoError(t, err)
+	assert.Equal(t, event.ID(), loaded.ID())
+	assert.Equal(t, "test-run", loaded.Extensions()["atkrunid"])
+	atktest.AssertVariables(t, outbuff.String(), "MYVAR")
+}
@@ -0,0 +1,207 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSink keeps the events that it receives in memory.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []*cloudevents.Event
+}
+
+func (s *recordingSink) Send(ctx context.Context, event *cloudevents.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func TestFileEventSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := atk.NewFileEventSink(path)
+	require.NoError(t, err)
+
+	event := atk.NewValidateRequestEvent("mymodule", atk.EventData{})
+	assert.NoError(t, sink.Send(context.Background(), event))
+	assert.NoError(t, sink.Send(context.Background(), event))
+	assert.NoError(t, sink.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 2)
+	loaded, err := atk.LoadEvent(lines[0])
+	require.NoError(t, err)
+	assert.Equal(t, string(atk.ValidateHookRequestEvent), loaded.Type())
+}
+
+func TestHTTPEventSink(t *testing.T) {
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := atk.NewHTTPEventSink(server.URL)
+	event := atk.NewValidateRequestEvent("mymodule", atk.EventData{})
+	assert.NoError(t, sink.Send(context.Background(), event))
+	assert.Equal(t, "application/cloudevents+json", contentType)
+	loaded, err := atk.LoadEvent(string(body))
+	require.NoError(t, err)
+	assert.Equal(t, event.ID(), loaded.ID())
+}
+
+func TestHTTPEventSinkWithErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sink := atk.NewHTTPEventSink(server.URL)
+	err := sink.Send(context.Background(), atk.NewValidateRequestEvent("mymodule", atk.EventData{}))
+	assert.Error(t, err)
+}
+
+// fakeNATSServer accepts a single connection and records the published
+// messages, answering PINGs with PONGs.
+func fakeNATSServer(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	published := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch {
+			case strings.HasPrefix(line, "PUB "):
+				parts := strings.Fields(line)
+				size, _ := strconv.Atoi(parts[len(parts)-1])
+				payload := make([]byte, size+2)
+				if _, err := io.ReadFull(reader, payload); err != nil {
+					return
+				}
+				published <- parts[1] + " " + string(payload[:size])
+			case strings.HasPrefix(line, "PING"):
+				fmt.Fprint(conn, "PONG\r\n")
+			}
+		}
+	}()
+	return "nats://" + listener.Addr().String(), published
+}
+
+func TestNATSEventSink(t *testing.T) {
+	address, published := fakeNATSServer(t)
+
+	sink, err := atk.NewNATSEventSink(address, "atk.events")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	event := atk.NewValidateRequestEvent("mymodule", atk.EventData{})
+	require.NoError(t, sink.Send(context.Background(), event))
+
+	var msg string
+	select {
+	case msg = <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not published")
+	}
+	subject, payload, _ := strings.Cut(msg, " ")
+	assert.Equal(t, "atk.events", subject)
+	var loaded map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(payload), &loaded))
+	assert.Equal(t, event.ID(), loaded["id"])
+}
+
+func TestDeploymentEmitsStateChanges(t *testing.T) {
+	sink := &recordingSink{}
+	runner := atktest.NewFakeRunner()
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Hooks.Validate = atk.ImageInfo{}
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithRunID("test-run"), atk.WithEventSink(sink))
+
+	var step atk.StateCmd
+	for next, hasNext := deployment.Itr(); hasNext; {
+		step, hasNext = next()
+		step(runCtx, deployment)
+	}
+
+	require.NotEmpty(t, sink.events)
+	var states []atk.State
+	for _, event := range sink.events {
+		assert.Equal(t, string(atk.StateChangedEvent), event.Type())
+		assert.Equal(t, "test-run", event.Extensions()[atk.RunIDExtension])
+		var change atk.StateChange
+		require.NoError(t, atk.DecodeEventData(event, &change))
+		assert.Equal(t, "mymodule", change.Module)
+		states = append(states, change.Current)
+	}
+	assert.Equal(t, atk.Done, states[len(states)-1])
+}
+
+// slowSink blocks until its context is done.
+type slowSink struct{}
+
+func (s *slowSink) Send(ctx context.Context, event *cloudevents.Event) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *slowSink) Close() error {
+	return nil
+}
+
+func TestSlowEventSinkDoesNotStallDeployment(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, hook := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"),
+		atk.WithRunner(runner), atk.WithEventSink(&slowSink{}), atk.WithEventSinkTimeout(10*time.Millisecond))
+
+	start := time.Now()
+	_, err := deployment.Deploy(runCtx)
+
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.NotEmpty(t, hook.AllEntries())
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEventStream(t *testing.T) {
+	getState := `{"specversion":"1.0","type":"com.ibm.techzone.cli.hook.get_state.response","source":"s","id":"1","datacontenttype":"application/json","data":{}}`
+	output := strings.Join([]string{
+		"Initializing the backend...",
+		getState,
+		"{ this is not json",
+		atktest.ListResponse,
+		"Done.",
+		"",
+	}, "\n")
+
+	events, err := atk.ParseEvents(strings.NewReader(output))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(events))
+
+	event, err := atk.ParseEventStream(strings.NewReader(output), atk.GetStateHookResponseEvent)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", event.ID())
+
+	event, err = atk.ParseEventStream(strings.NewReader(output), "")
+	assert.NoError(t, err)
+	assert.Equal(t, string(atk.ListHookResponseEvent), event.Type())
+}
+
+func TestParseEventStreamLastOfType(t *testing.T) {
+	first := atktest.NewResponse(atk.ListHookResponseEvent, atk.EventDataVarInfo{Name: "FIRST"})
+	second := atktest.NewResponse(atk.ListHookResponseEvent, atk.EventDataVarInfo{Name: "SECOND"})
+
+	event, err := atk.ParseEventStream(strings.NewReader(first+"\nprogress\n"+second), atk.ListHookResponseEvent)
+	assert.NoError(t, err)
+	data, _ := atk.LoadEventData(event)
+	assert.Equal(t, "SECOND", data.Variables[0].Name)
+}
+
+func TestParseEventStreamNoEvent(t *testing.T) {
+	_, err := atk.ParseEventStream(strings.NewReader("nothing here\n"), atk.ListHookResponseEvent)
+	assert.True(t, errors.Is(err, atk.ErrNoEvent))
+}
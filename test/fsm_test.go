@@ -0,0 +1,97 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/cloud-native-toolkit/atkmod/fsm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type phase string
+
+const (
+	phaseNew     phase = "new"
+	phaseRunning phase = "running"
+	phaseDone    phase = "done"
+	phaseFailed  phase = "failed"
+)
+
+func TestFsmSequence(t *testing.T) {
+	table := fsm.Sequence(phaseNew, phaseRunning, phaseDone)
+	assert.True(t, table.Allows(phaseNew, phaseRunning))
+	assert.True(t, table.Allows(phaseRunning, phaseDone))
+	assert.False(t, table.Allows(phaseNew, phaseDone))
+	assert.False(t, table.Allows(phaseDone, phaseNew))
+
+	table.Allow(phaseRunning, phaseFailed, phaseFailed)
+	assert.Equal(t, []phase{phaseDone, phaseFailed}, table[phaseRunning])
+}
+
+func TestFsmMachine(t *testing.T) {
+	m := fsm.New[phase, func() string](phaseNew, []phase{phaseNew, phaseRunning, phaseDone})
+	assert.Equal(t, phaseNew, m.Current())
+	assert.Equal(t, []phase{phaseNew, phaseRunning, phaseDone}, m.Order())
+
+	next, ok := m.Next(phaseRunning)
+	assert.True(t, ok)
+	assert.Equal(t, phaseDone, next)
+	_, ok = m.Next(phaseDone)
+	assert.False(t, ok)
+	_, ok = m.Next(phaseFailed)
+	assert.False(t, ok)
+
+	require.NoError(t, m.Transition(phaseRunning))
+	assert.Equal(t, phaseRunning, m.Current())
+	assert.Equal(t, phaseNew, m.Previous())
+
+	m.Restore(phaseFailed, phaseRunning)
+	assert.Equal(t, phaseFailed, m.Current())
+	assert.Equal(t, phaseRunning, m.Previous())
+
+	m.Allow(phaseRunning, phaseFailed)
+	assert.True(t, m.Allows(phaseRunning, phaseFailed))
+	table := m.Table()
+	table.Allow(phaseDone, phaseNew)
+	assert.False(t, m.Allows(phaseDone, phaseNew))
+}
+
+func TestFsmHandlers(t *testing.T) {
+	m := fsm.New[phase, func() string](phaseNew, []phase{phaseNew, phaseDone})
+	require.NoError(t, m.Handle(phaseNew, func() string { return "started" }))
+	assert.ErrorIs(t, m.Handle(phaseNew, func() string { return "again" }), fsm.ErrHandlerExists)
+
+	h, ok := m.Handler(phaseNew)
+	require.True(t, ok)
+	assert.Equal(t, "started", h())
+	_, ok = m.Handler(phaseDone)
+	assert.False(t, ok)
+}
+
+func TestFsmStrictAndGuards(t *testing.T) {
+	m := fsm.New[phase, func() string](phaseNew, []phase{phaseNew, phaseRunning, phaseDone})
+	require.NoError(t, m.Transition(phaseDone))
+
+	m.Restore(phaseNew, phaseNew)
+	m.SetStrict(true)
+	var illegal *fsm.IllegalTransitionError[phase]
+	require.ErrorAs(t, m.Transition(phaseDone), &illegal)
+	assert.Equal(t, phaseNew, illegal.From)
+	assert.Equal(t, phaseNew, m.Current())
+
+	var seen []phase
+	m.AddGuard(func(from phase, to phase) error {
+		seen = append(seen, from, to)
+		return nil
+	})
+	m.AddGuard(func(from phase, to phase) error {
+		if to == phaseDone {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, m.Transition(phaseRunning))
+	assert.ErrorIs(t, m.Transition(phaseDone), assert.AnError)
+	assert.Equal(t, phaseRunning, m.Current())
+	assert.Equal(t, []phase{phaseNew, phaseRunning, phaseRunning, phaseDone}, seen)
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventFileRunner reads the request event that is mounted in the validate
+// hook, while it still exists.
+type eventFileRunner struct {
+	*atktest.FakeRunner
+	request string
+}
+
+func (r *eventFileRunner) RunImage(ctx *atk.RunContext, info atk.ImageInfo) error {
+	for _, v := range info.Volumes {
+		if v.MountPath == atk.EventFileMountPath {
+			content, err := os.ReadFile(v.Name)
+			if err != nil {
+				return err
+			}
+			r.request = string(content)
+		}
+	}
+	return r.FakeRunner.RunImage(ctx, info)
+}
+
+func handshakeModule() *atk.ModuleInfo {
+	module := atktest.Manifest("shake")
+	module.Specifications.Hooks.Info = atk.ImageInfo{Image: "shake-info"}
+	return module
+}
+
+func capabilitiesResponse(t *testing.T, capabilities atk.HookCapabilities) string {
+	event, err := atk.NewEvent(atk.InfoHookResponseEvent, "shake", capabilities)
+	require.NoError(t, err)
+	content, err := event.MarshalJSON()
+	require.NoError(t, err)
+	return string(content) + "\n"
+}
+
+func TestHandshakeFileDelivery(t *testing.T) {
+	runner := &eventFileRunner{FakeRunner: atktest.NewFakeRunner().
+		On("shake-info", atktest.Response{Out: capabilitiesResponse(t, atk.HookCapabilities{Delivery: atk.DeliverFile})})}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, handshakeModule(), atk.WithRunner(runner))
+
+	capabilities, err := deployment.Handshake(runCtx)
+	require.NoError(t, err)
+	assert.Equal(t, atk.DeliverFile, capabilities.Delivery)
+	assert.Equal(t, "1.0", capabilities.SpecVersion)
+
+	request, err := atk.LoadEvent(runner.Calls()[0].In)
+	require.NoError(t, err)
+	assert.Equal(t, string(atk.InfoHookRequestEvent), request.Type())
+	var handshake atk.HandshakeRequest
+	require.NoError(t, request.DataAs(&handshake))
+	assert.Equal(t, []string{"1.0"}, handshake.SpecVersions)
+	assert.Equal(t, atk.SupportedDeliveries, handshake.Deliveries)
+
+	_, err = deployment.Validate(runCtx, atk.EventData{})
+	require.NoError(t, err)
+	validate := runner.Calls()[1]
+	assert.Empty(t, validate.In)
+	assert.Contains(t, validate.Info.EnvVars, atk.EnvVarInfo{Name: atk.EventFileEnvVar, Value: atk.EventFileMountPath})
+	event, err := atk.LoadEvent(runner.request)
+	require.NoError(t, err)
+	assert.Equal(t, string(atk.ValidateHookRequestEvent), event.Type())
+	_, err = os.Stat(validate.Info.Volumes[len(validate.Info.Volumes)-1].Name)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHandshakeDefaults(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("shake"), atk.WithRunner(runner))
+	capabilities, err := deployment.Handshake(runCtx)
+	require.NoError(t, err)
+	assert.Equal(t, atk.DeliverStdin, capabilities.Delivery)
+	assert.Empty(t, runner.Calls())
+
+	deployment = atk.NewDeployableModule(runCtx, handshakeModule(), atk.WithRunner(runner))
+	capabilities, err = deployment.Handshake(runCtx)
+	require.NoError(t, err)
+	assert.Equal(t, atk.HookCapabilities{SpecVersion: "1.0", Delivery: atk.DeliverStdin}, *capabilities)
+}
+
+func TestHandshakeUnsupported(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("shake-info", atktest.Response{Out: capabilitiesResponse(t, atk.HookCapabilities{SpecVersion: "2.0"})})
+	module := handshakeModule()
+	runCtx, _, _, _ := newTestRunContext()
+	result, err := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner)).Deploy(runCtx)
+	var handshake *atk.HandshakeError
+	require.ErrorAs(t, err, &handshake)
+	assert.Contains(t, handshake.Reason, "CloudEvents 2.0")
+	assert.Equal(t, atk.Initializing, result.FailedState)
+	atktest.AssertNotRan(t, runner, "shake-get-state")
+}
@@ -0,0 +1,39 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHelmStage(t *testing.T) {
+	module := atk.NewModuleScaffold("mymodule")
+	stage := atk.NewHelmStage(module, "oci://quay.io/org/chart",
+		atk.WithHelmVersion("1.2.3"), atk.WithHelmValues("values.yaml"), atk.WithHelmKubeconfig("/home/user/.kube/config"))
+
+	assert.Equal(t, atk.DefaultHelmImage, stage.Image)
+	assert.Equal(t, []string{"upgrade", "--install", "--wait", "--create-namespace", "mymodule", "oci://quay.io/org/chart",
+		"--namespace", "default", "--version", "1.2.3", "--values", "/workspace/values.yaml"}, stage.Args)
+	assert.Contains(t, stage.EnvVars, atk.EnvVarInfo{Name: "KUBECONFIG", Value: atk.KubeconfigMountPath})
+	assert.Contains(t, stage.Volumes, atk.VolumeInfo{Name: "/home/user/.kube/config", MountPath: atk.KubeconfigMountPath})
+	assert.Contains(t, stage.Volumes, atk.VolumeInfo{Name: atk.DefaultScaffoldWorkspace, MountPath: "/workspace"})
+}
+
+func TestNewHelmLifecycle(t *testing.T) {
+	module := atk.NewModuleScaffold("mymodule")
+	module.Specifications.Lifecycle = atk.NewHelmLifecycle(module, "/workspace/chart", atk.WithHelmRelease("web"), atk.WithHelmNamespace("apps"))
+
+	assert.Equal(t, []string{"template", "web", "/workspace/chart", "--namespace", "apps"}, module.Specifications.Lifecycle.PreDeploy.Args)
+	assert.Equal(t, "upgrade", module.Specifications.Lifecycle.Deploy.Args[0])
+	assert.False(t, atk.HasErrors(atk.Lint(module)))
+}
+
+func TestBuildFromPassesArgs(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman"})
+	cmd, err := builder.BuildFrom(atk.ImageInfo{Image: "myimage", Args: []string{"upgrade", "--install"}})
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(cmd, "myimage upgrade --install"), cmd)
+}
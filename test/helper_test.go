@@ -0,0 +1,71 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinImage(t *testing.T) {
+	digest := func(image string) (string, error) { return "sha256:0123", nil }
+
+	pinned, err := atk.PinImage("mirror.example.com:5000/library/busybox:1.36", digest)
+	require.NoError(t, err)
+	assert.Equal(t, "mirror.example.com:5000/library/busybox:1.36@sha256:0123", pinned)
+
+	pinned, err = atk.PinImage("busybox@sha256:4567", digest)
+	require.NoError(t, err)
+	assert.Equal(t, "busybox@sha256:4567", pinned)
+}
+
+func TestPinImageErrors(t *testing.T) {
+	_, err := atk.PinImage("busybox:1.36", func(string) (string, error) { return "", errors.New("no such image") })
+	assert.EqualError(t, err, "no such image")
+
+	_, err = atk.PinImage("busybox:1.36", func(string) (string, error) { return "", nil })
+	assert.ErrorContains(t, err, "is not a digest")
+}
+
+func TestHelperImageFromConfig(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv(atk.HelperImageEnvVar, "mirror.example.com/busybox:1.36")
+	cfg, err := atk.LoadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "mirror.example.com/busybox:1.36", cfg.HelperImage)
+	assert.Equal(t, "mirror.example.com/busybox:1.36", cfg.PodmanRunner().HelperImage)
+}
+
+func TestFixOwnershipUsesHelperImage(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	podman := writeScript(t, dir, "podman", "echo \"$@\" > "+args+"\n")
+	runner := &atk.CliModuleRunner{
+		PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman, Platform: atk.PlatformDarwin}),
+		HelperImage:             "mirror.example.com/busybox:1.36",
+	}
+	runCtx, _, _, _ := newTestRunContext()
+
+	require.NoError(t, runner.FixOwnership(runCtx, "/Users/me/workspace", 10001))
+	content, err := os.ReadFile(args)
+	require.NoError(t, err)
+	assert.Equal(t, "run --rm --user=0:0 --network=none -v /Users/me/workspace:/workspace:Z mirror.example.com/busybox:1.36 chown -R 10001:0 /workspace\n", string(content))
+}
+
+func TestSaveAndLoadHelperImage(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	podman := writeScript(t, dir, "podman", "echo \"$@\" >> "+args+"\n")
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman, Connection: "remote"})}
+	runCtx, _, _, _ := newTestRunContext()
+
+	require.NoError(t, runner.SaveHelperImage(runCtx, "/tmp/helper.tar"))
+	require.NoError(t, runner.LoadHelperImage(runCtx, "/tmp/helper.tar"))
+	content, err := os.ReadFile(args)
+	require.NoError(t, err)
+	assert.Equal(t, "--connection remote save --quiet -o /tmp/helper.tar "+atk.DefaultHelperImage+"\n--connection remote load --quiet -i /tmp/helper.tar\n", string(content))
+}
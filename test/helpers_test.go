@@ -0,0 +1,42 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	logger "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// newTestRunContext creates a RunContext that captures the output and error
+// streams in buffers and records the log entries in the returned hook.
+func newTestRunContext() (*atk.RunContext, *bytes.Buffer, *bytes.Buffer, *logtest.Hook) {
+	outbuff := new(bytes.Buffer)
+	errbuff := new(bytes.Buffer)
+
+	hook := new(logtest.Hook)
+	runCtx := &atk.RunContext{
+		Context: context.Background(),
+		Out:     outbuff,
+		Err:     errbuff,
+		Log:     testLogger(hook),
+	}
+	return runCtx, outbuff, errbuff, hook
+}
+
+// testLogger creates a logger for a RunContext that writes debug logs to
+// stdout and fires the given hooks.
+func testLogger(hooks ...logger.Hook) logger.Logger {
+	levelHooks := make(logger.LevelHooks)
+	for _, hook := range hooks {
+		levelHooks.Add(hook)
+	}
+	return logger.Logger{
+		Out:       os.Stdout,
+		Formatter: new(logger.TextFormatter),
+		Hooks:     levelHooks,
+		Level:     logger.DebugLevel,
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newResult(module string, runID string, state atk.State, errMsg string) atk.DeploymentResult {
+	return atk.DeploymentResult{
+		Module:     module,
+		Namespace:  "atktest",
+		RunID:      runID,
+		State:      state,
+		Error:      errMsg,
+		StartedAt:  time.Now().UTC(),
+		FinishedAt: time.Now().UTC(),
+	}
+}
+
+func TestHistoryRecord(t *testing.T) {
+	store := atk.NewHistoryStore(t.TempDir())
+	module := atktest.Manifest("mymodule")
+
+	require.NoError(t, store.Record(newResult("mymodule", "run-1", atk.Done, "")))
+	require.NoError(t, store.Record(newResult("mymodule", "run-2", atk.Errored, "deploy failed")))
+
+	results, err := store.History(module)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "run-2", results[0].RunID)
+	assert.Equal(t, "run-1", results[1].RunID)
+	assert.FileExists(t, filepath.Join(store.Dir, "atktest", "mymodule.json"))
+}
+
+func TestHistoryEmpty(t *testing.T) {
+	store := atk.NewHistoryStore(t.TempDir())
+
+	results, err := store.History(atktest.Manifest("mymodule"))
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	last, err := store.Last(atktest.Manifest("mymodule"))
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+}
+
+func TestHistoryLimit(t *testing.T) {
+	store := atk.NewHistoryStore(t.TempDir())
+	store.Limit = 3
+
+	for _, id := range []string{"run-1", "run-2", "run-3", "run-4", "run-5"} {
+		require.NoError(t, store.Record(newResult("mymodule", id, atk.Done, "")))
+	}
+
+	results, err := store.History(atktest.Manifest("mymodule"))
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, "run-5", results[0].RunID)
+	assert.Equal(t, "run-3", results[2].RunID)
+}
+
+func TestHistoryLastAndLastFailure(t *testing.T) {
+	store := atk.NewHistoryStore(t.TempDir())
+	module := atktest.Manifest("mymodule")
+
+	require.NoError(t, store.Record(newResult("mymodule", "run-1", atk.Errored, "deploy failed")))
+	require.NoError(t, store.Record(newResult("mymodule", "run-2", atk.Done, "")))
+
+	last, err := store.Last(module)
+	require.NoError(t, err)
+	assert.Equal(t, "run-2", last.RunID)
+	assert.True(t, last.Succeeded())
+
+	failure, err := store.LastFailure(module)
+	require.NoError(t, err)
+	assert.Equal(t, "run-1", failure.RunID)
+	assert.Equal(t, "deploy failed", failure.Error)
+}
+
+func TestHistoryRejectsUnsafeNames(t *testing.T) {
+	dir := t.TempDir()
+	store := atk.NewHistoryStore(filepath.Join(dir, "history"))
+
+	assert.Error(t, store.Record(newResult("../escaped", "run-1", atk.Done, "")))
+	assert.Error(t, store.Record(newResult("a/b", "run-1", atk.Done, "")))
+	_, err := os.Stat(filepath.Join(dir, "escaped.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDeployRecordsHistory(t *testing.T) {
+	store := atk.NewHistoryStore(t.TempDir())
+	runner := atktest.NewFakeRunner().
+		On("mymodule-deploy", atktest.Response{ExitCode: 1})
+	module := atktest.Manifest("mymodule")
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithRunID("test-run"), atk.WithHistory(store))
+	result, err := deployment.Deploy(runCtx)
+
+	assert.Error(t, err)
+	assert.Equal(t, atk.Errored, result.State)
+	assert.Equal(t, atk.Deploying, result.FailedState)
+	assert.False(t, result.Succeeded())
+
+	failure, err := store.LastFailure(module)
+	require.NoError(t, err)
+	assert.Equal(t, "test-run", failure.RunID)
+	assert.Equal(t, atk.Deploying, failure.FailedState)
+}
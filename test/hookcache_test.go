@@ -0,0 +1,83 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListParsesResponse(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-list", atktest.Response{Out: "starting\n" + atktest.ListResponse})
+	runCtx, outbuff, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	data, err := deployment.List(runCtx)
+
+	require.NoError(t, err)
+	assert.Equal(t, "", outbuff.String())
+	assert.Len(t, data.Variables, 3)
+	assert.Equal(t, "TF_VAR_cloud_provider", data.Variables[0].Name)
+}
+
+func TestListUsesHookCache(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-list", atktest.Response{Out: atktest.ListResponse})
+	cache := atk.NewHookCache(time.Minute)
+	runCtx, _, _, _ := newTestRunContext()
+	module := atktest.Manifest("mymodule")
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithHookCache(cache))
+
+	first, err := deployment.List(runCtx)
+	require.NoError(t, err)
+	first.Variables[0].Name = "changed"
+	second, err := deployment.List(runCtx)
+	require.NoError(t, err)
+
+	assert.Len(t, runner.Calls(), 1)
+	assert.Equal(t, "TF_VAR_cloud_provider", second.Variables[0].Name)
+
+	cache.Invalidate(module)
+	assert.Equal(t, 0, cache.Len())
+	_, err = deployment.List(runCtx)
+	require.NoError(t, err)
+	assert.Len(t, runner.Calls(), 2)
+}
+
+func TestHookCacheExpires(t *testing.T) {
+	cache := atk.NewHookCache(20 * time.Millisecond)
+	module := atktest.Manifest("mymodule")
+	key, err := cache.Key(module, atk.ListHook, module.Specifications.Hooks.List)
+	require.NoError(t, err)
+
+	cache.Put(key, module, &atk.EventData{Variables: []atk.EventDataVarInfo{{Name: "MYVAR"}}})
+	_, ok := cache.Get(key)
+	assert.True(t, ok)
+
+	time.Sleep(30 * time.Millisecond)
+	_, ok = cache.Get(key)
+	assert.False(t, ok)
+}
+
+func TestHookCacheKeyChangesWithImage(t *testing.T) {
+	cache := atk.NewHookCache(time.Minute)
+	module := atktest.Manifest("mymodule")
+	info := atk.ImageInfo{Image: "lister@sha256:aaaa"}
+
+	key1, err := cache.Key(module, atk.ListHook, info)
+	require.NoError(t, err)
+	info.Image = "lister@sha256:bbbb"
+	key2, err := cache.Key(module, atk.ListHook, info)
+	require.NoError(t, err)
+	info.EnvVars = []atk.EnvVarInfo{{Name: "MYVAR", Value: "myvalue"}}
+	key3, err := cache.Key(module, atk.ListHook, info)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, key1, key2)
+	assert.NotEqual(t, key2, key3)
+	assert.Contains(t, key1, "sha256:aaaa")
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewValidationResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		want    atk.ValidationStatus
+		wantErr bool
+	}{
+		{name: "valid", err: nil, want: atk.ValidationValid},
+		{name: "invalid", err: &atktest.ExitError{Code: atk.HookExitInvalid}, want: atk.ValidationInvalid},
+		{name: "undetermined", err: &atktest.ExitError{Code: atk.HookExitUndetermined}, want: atk.ValidationUndetermined},
+		{name: "failed", err: &atktest.ExitError{Code: atk.HookExitFailed}, wantErr: true},
+		{name: "not run", err: errors.New("command is not yet supported"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := atk.NewValidationResult(tt.err)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Status)
+		})
+	}
+}
+
+func TestValidationResultFromLocalHook(t *testing.T) {
+	script := writeScript(t, t.TempDir(), "validate.sh", "exit 3\n")
+
+	runCtx, _, _, _ := newTestRunContext()
+	err := atk.NewLocalModuleRunner(t.TempDir()).RunImage(runCtx, atk.ImageInfo{Script: script})
+	result, err := atk.NewValidationResult(err)
+
+	assert.NoError(t, err)
+	assert.False(t, result.IsValid())
+	assert.Equal(t, atk.ValidationInvalid, result.Status)
+	assert.Equal(t, 3, result.ExitCode)
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDefaultsFromHost(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600))
+	t.Setenv("KUBECONFIG", kubeconfig)
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".bluemix"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".bluemix", "config.json"),
+		[]byte(`{"Region": "us-south", "ResourceGroup": {"Name": "Default"}}`), 0600))
+	t.Setenv("IBMCLOUD_HOME", home)
+
+	runner := atktest.NewFakeRunner().On("defaults-list", atktest.Response{Out: atktest.NewResponse(atk.ListHookResponseEvent,
+		atk.EventDataVarInfo{Name: "context", DefaultFrom: atk.DefaultFromKubeContext},
+		atk.EventDataVarInfo{Name: "namespace", DefaultFrom: atk.DefaultFromKubeNamespace},
+		atk.EventDataVarInfo{Name: "region", DefaultFrom: atk.DefaultFromIBMCloudRegion},
+		atk.EventDataVarInfo{Name: "account", DefaultFrom: atk.DefaultFromIBMCloudAccount},
+		atk.EventDataVarInfo{Name: "owner", DefaultFrom: "ldap.user"},
+		atk.EventDataVarInfo{Name: "zone", Default: "us-south-1", DefaultFrom: "custom.zone"},
+		atk.EventDataVarInfo{Name: "cluster", DefaultFrom: atk.DefaultFromKubeContext})})
+	owner := func(ctx *atk.RunContext) (string, error) { return "jdoe", nil }
+	zone := func(ctx *atk.RunContext) (string, error) {
+		t.Error("the zone is not read, as it has a default")
+		return "", nil
+	}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("defaults"), atk.WithRunner(runner),
+		atk.WithDefaultSource("ldap.user", owner), atk.WithDefaultSource("custom.zone", zone),
+		atk.WithVariables(atk.EventDataVarInfo{Name: "cluster", Value: "prod"}))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	values := make(map[string]string)
+	for _, v := range deployment.Variables().Variables {
+		values[v.Name] = v.Value
+	}
+	assert.Equal(t, map[string]string{
+		"context":   "dev",
+		"namespace": "default",
+		"region":    "us-south",
+		// The account is not in the configuration, so it has no default.
+		"account": "",
+		"owner":   "jdoe",
+		"zone":    "us-south-1",
+		"cluster": "prod",
+	}, values)
+	atktest.AssertVariables(t, runner.Calls()[2].In, "context", "namespace", "region", "account", "owner", "zone", "cluster")
+}
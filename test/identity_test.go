@@ -0,0 +1,43 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleExtensionsOnRequests(t *testing.T) {
+	module := atktest.Manifest("identity")
+	module.Metadata.Namespace = "team"
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+
+	_, err := deployment.Validate(runCtx, atk.EventData{})
+	require.NoError(t, err)
+
+	calls := runner.Calls()
+	require.Len(t, calls, 1)
+	request, err := atk.LoadEvent(calls[0].In)
+	require.NoError(t, err)
+	checksum, err := atk.ManifestChecksum(module)
+	require.NoError(t, err)
+	extensions := request.Extensions()
+	assert.Equal(t, "identity", extensions[atk.ModuleExtension])
+	assert.Equal(t, "team", extensions[atk.NamespaceExtension])
+	assert.Equal(t, checksum, extensions[atk.ManifestChecksumExtension])
+	assert.Equal(t, atk.Version, extensions[atk.VersionExtension])
+	assert.NotEmpty(t, atk.Version)
+}
+
+func TestSetModuleExtensions(t *testing.T) {
+	module := atktest.Manifest("identity")
+	event := atk.NewGetStateRequestEvent("identity", atk.EventData{})
+	require.NoError(t, atk.SetModuleExtensions(event, module))
+	assert.Equal(t, "identity", event.Extensions()[atk.ModuleExtension])
+	assert.Equal(t, module.Metadata.Namespace, event.Extensions()[atk.NamespaceExtension])
+	assert.NoError(t, event.Validate())
+}
@@ -0,0 +1,174 @@
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeIncludingManifest writes a manifest for the module that includes the
+// given paths.
+func writeIncludingManifest(t *testing.T, dir string, name string, includes ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "apiVersion: itzcli/v1alpha1\nkind: InstallManifest\nmetadata:\n  name: %s\nspec:\n", name)
+	if len(includes) > 0 {
+		b.WriteString("  includes:\n")
+		for _, include := range includes {
+			fmt.Fprintf(&b, "    - path: %s\n", include)
+		}
+	}
+	fmt.Fprintf(&b, "  lifecycle:\n    deploy:\n      image: %s-deploy:1.0\n", name)
+	path := filepath.Join(dir, name+".yaml")
+	require.NoError(t, os.WriteFile(path, []byte(b.String()), 0644))
+	return path
+}
+
+func moduleNames(modules []*atk.ModuleInfo) []string {
+	names := make([]string, 0, len(modules))
+	for _, m := range modules {
+		names = append(names, m.Metadata.Name)
+	}
+	return names
+}
+
+func TestLoadIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeIncludingManifest(t, dir, "network")
+	storage := writeIncludingManifest(t, t.TempDir(), "storage")
+	writeIncludingManifest(t, dir, "cluster", "network.yaml", "file://"+filepath.ToSlash(storage))
+	root := writeIncludingManifest(t, dir, "solution", "network.yaml", "cluster.yaml")
+
+	loader := atk.NewAtkManifestFileLoader()
+	module, err := loader.Load(root)
+	require.NoError(t, err)
+	includes, err := loader.LoadIncludes(module)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"network", "storage", "cluster"}, moduleNames(includes))
+}
+
+func TestLoadIncludesCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeIncludingManifest(t, dir, "a", "b.yaml")
+	writeIncludingManifest(t, dir, "b", "a.yaml")
+
+	loader := atk.NewAtkManifestFileLoader()
+	module, err := loader.Load(filepath.Join(dir, "a.yaml"))
+	require.NoError(t, err)
+	_, err = loader.LoadIncludes(module)
+	assert.ErrorContains(t, err, "includes itself")
+}
+
+// fileChecksum returns the hex encoded sha256 checksum of the file.
+func fileChecksum(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestLoadIncludesVerifiesChecksums(t *testing.T) {
+	dir := t.TempDir()
+	network := writeIncludingManifest(t, dir, "network")
+	root := filepath.Join(dir, "solution.yaml")
+	writeRoot := func(include string) *atk.ManifestFileLoader {
+		manifest := "apiVersion: itzcli/v1alpha1\nkind: InstallManifest\nmetadata:\n  name: solution\nspec:\n  includes:\n" + include +
+			"  lifecycle:\n    deploy:\n      image: solution-deploy:1.0\n"
+		require.NoError(t, os.WriteFile(root, []byte(manifest), 0644))
+		return atk.NewAtkManifestFileLoader(atk.WithManifestVerifier(&atk.ChecksumVerifier{SHA256: fileChecksum(t, root)}))
+	}
+
+	loader := writeRoot("    - path: network.yaml\n      sha256: " + fileChecksum(t, network) + "\n")
+	module, err := loader.Load(root)
+	require.NoError(t, err)
+	includes, err := loader.LoadIncludes(module)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"network"}, moduleNames(includes))
+
+	// An include of a verified manifest must have a checksum.
+	loader = writeRoot("    - path: network.yaml\n")
+	module, err = loader.Load(root)
+	require.NoError(t, err)
+	_, err = loader.LoadIncludes(module)
+	assert.ErrorContains(t, err, "has no sha256")
+
+	// The include must match its checksum.
+	loader = writeRoot("    - path: network.yaml\n      sha256: " + strings.Repeat("0", 64) + "\n")
+	module, err = loader.Load(root)
+	require.NoError(t, err)
+	_, err = loader.LoadIncludes(module)
+	var integrityErr *atk.ManifestIntegrityError
+	assert.ErrorAs(t, err, &integrityErr)
+}
+
+func TestDeployIncludes(t *testing.T) {
+	child := atktest.Manifest("child")
+	child.Specifications.Hooks = atk.HookInfo{}
+	parent := atktest.Manifest("parent")
+	parent.Specifications.Hooks = atk.HookInfo{}
+
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, parent, atk.WithRunner(runner), atk.WithIncludes(child))
+	result, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	atktest.AssertRunOrder(t, runner, "child-pre-deploy", "child-deploy", "child-post-deploy",
+		"parent-pre-deploy", "parent-deploy", "parent-post-deploy")
+	require.Len(t, result.Includes, 1)
+	assert.Equal(t, "child", result.Includes[0].Module)
+	assert.Equal(t, atk.Done, result.Includes[0].State)
+	status := deployment.Status()
+	require.Len(t, status.Includes, 1)
+	assert.Equal(t, atk.Done, status.Includes[0].State)
+}
+
+func TestDeployIncludesWithOptionsOfModule(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte("apiVersion: v1\n"), 0600))
+	child := atktest.Manifest("child")
+	child.Specifications.Hooks = atk.HookInfo{}
+	parent := atktest.Manifest("parent")
+	parent.Specifications.Hooks = atk.HookInfo{}
+
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	transcript := filepath.Join(t.TempDir(), "transcript.tar.gz")
+	deployment := atk.NewDeployableModule(runCtx, parent, atk.WithRunner(runner), atk.WithIncludes(child),
+		atk.WithKubeconfig(kubeconfig), atk.WithRunID("parent-run"), atk.WithTranscript(transcript))
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	for _, call := range runner.Calls() {
+		assert.Contains(t, call.Info.Volumes, atk.VolumeInfo{Name: kubeconfig, MountPath: atk.KubeconfigMountPath}, call.Info.Image)
+	}
+	require.Len(t, deployment.Includes(), 1)
+	assert.NotEqual(t, "parent-run", deployment.Includes()[0].RunID())
+	assert.Empty(t, deployment.Includes()[0].Includes())
+}
+
+func TestDeployIncludeFails(t *testing.T) {
+	child := atktest.Manifest("child")
+	child.Specifications.Hooks = atk.HookInfo{}
+	parent := atktest.Manifest("parent")
+	parent.Specifications.Hooks = atk.HookInfo{}
+
+	runner := atktest.NewFakeRunner().On("child-deploy", atktest.Response{ExitCode: 1})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, parent, atk.WithRunner(runner), atk.WithIncludes(child))
+	result, err := deployment.Deploy(runCtx)
+
+	var includeErr *atk.IncludeError
+	require.ErrorAs(t, err, &includeErr)
+	assert.Equal(t, "child", includeErr.Include)
+	assert.Equal(t, atk.Errored, result.State)
+	atktest.AssertNotRan(t, runner, "parent-pre-deploy")
+}
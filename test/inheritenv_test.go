@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInheritEnv(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://proxy.example.com:3128")
+	t.Setenv("TF_VAR_region", "us-east")
+	t.Setenv("KUBECONFIG", "/home/user/.kube/config")
+	t.Setenv("SECRET_TOKEN", "s3cret")
+
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Hooks = atk.HookInfo{}
+	module.Specifications.Lifecycle.Deploy.InheritEnv = []string{"HTTPS_PROXY", "TF_VAR_*", "KUBECONFIG"}
+	module.Specifications.Lifecycle.Deploy.EnvVars = []atk.EnvVarInfo{{Name: "KUBECONFIG", Value: "/workspace/kubeconfig"}}
+
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	var deploy, preDeploy atk.ImageInfo
+	for _, call := range runner.Calls() {
+		switch call.Info.Image {
+		case "mymodule-deploy":
+			deploy = call.Info
+		case "mymodule-pre-deploy":
+			preDeploy = call.Info
+		}
+	}
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "HTTPS_PROXY", Value: "http://proxy.example.com:3128"})
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "TF_VAR_region", Value: "us-east"})
+	assert.Contains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "KUBECONFIG", Value: "/workspace/kubeconfig"})
+	assert.NotContains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "KUBECONFIG", Value: "/home/user/.kube/config"})
+	assert.NotContains(t, deploy.EnvVars, atk.EnvVarInfo{Name: "SECRET_TOKEN", Value: "s3cret"})
+	assert.NotContains(t, preDeploy.EnvVars, atk.EnvVarInfo{Name: "HTTPS_PROXY", Value: "http://proxy.example.com:3128"})
+}
+
+func TestLintInheritEnvPatterns(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle.Deploy.InheritEnv = []string{"HTTP_PROXY", "TF_[*"}
+	findings := atk.Lint(module)
+	assert.Contains(t, ruleIDs(findings), "ATK014")
+	for _, f := range findings {
+		if f.RuleID == "ATK014" {
+			assert.Equal(t, "spec.lifecycle.deploy.inheritEnv[1]", f.Path)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployInitializes(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-get-state", atktest.Response{Out: atktest.StateResponse("DEPLOYED")}).
+		On("mymodule-list", atktest.Response{Out: atktest.ListResponse})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner),
+		atk.WithVariables(atk.EventDataVarInfo{Name: "TF_VAR_api_key", Value: "secret"},
+			atk.EventDataVarInfo{Name: "TF_VAR_region", Value: "us-east"}))
+
+	result, err := deployment.Deploy(runCtx)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.InitialState)
+	assert.True(t, result.InitialState.IsDeployed())
+	assert.Equal(t, result.InitialState, deployment.InitialState())
+	assert.Equal(t, []atk.EventDataVarInfo{
+		{Name: "TF_VAR_cloud_provider", Value: "fyre", Default: "fyre"},
+		{Name: "TF_VAR_cloud_type", Value: "private", Default: "private"},
+		{Name: "TF_VAR_api_key", Value: "secret"},
+		{Name: "TF_VAR_region", Value: "us-east"},
+	}, deployment.Variables().Variables)
+	// The module is already deployed, so the deployment starts from Deployed.
+	assert.Equal(t, atk.Done, result.State)
+	transitions := deployment.Transitions()
+	require.Greater(t, len(transitions), 1)
+	assert.Equal(t, atk.Initializing, transitions[1].From)
+	assert.Equal(t, atk.Deployed, transitions[1].To)
+	atktest.AssertRunOrder(t, runner, "mymodule-get-state", "mymodule-list", "mymodule-post-deploy")
+	atktest.AssertNotRan(t, runner, "mymodule-validate")
+	atktest.AssertNotRan(t, runner, "mymodule-pre-deploy")
+	atktest.AssertNotRan(t, runner, "mymodule-deploy")
+}
+
+func TestDeployStartsFromReportedState(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-get-state", atktest.Response{Out: atktest.StateResponse("PREDEPLOYED")})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	result, err := deployment.Deploy(runCtx)
+
+	require.NoError(t, err)
+	assert.Equal(t, atk.Done, result.State)
+	atktest.AssertRunOrder(t, runner, "mymodule-get-state", "mymodule-list", "mymodule-deploy", "mymodule-post-deploy")
+	atktest.AssertNotRan(t, runner, "mymodule-pre-deploy")
+}
+
+func TestDeployConfiguresModuleInEarlierState(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-get-state", atktest.Response{Out: atktest.StateResponse("INITIALIZING")})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	_, err := deployment.Deploy(runCtx)
+
+	require.NoError(t, err)
+	atktest.AssertRunOrder(t, runner, "mymodule-get-state", "mymodule-list", "mymodule-validate",
+		"mymodule-pre-deploy", "mymodule-deploy", "mymodule-post-deploy")
+}
+
+func TestDeployInitializeHookFails(t *testing.T) {
+	runner := atktest.NewFakeRunner().On("mymodule-list", atktest.Response{ExitCode: 1})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	result, err := deployment.Deploy(runCtx)
+
+	assert.Error(t, err)
+	assert.Equal(t, atk.Errored, deployment.State())
+	assert.Equal(t, atk.Initializing, result.FailedState)
+	assert.Nil(t, result.InitialState)
+	atktest.AssertNotRan(t, runner, "mymodule-validate")
+}
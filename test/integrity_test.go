@@ -0,0 +1,93 @@
+package test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyManifest copies the example manifest to a temporary directory, so
+// that its signature can be written next to it.
+func copyManifest(t *testing.T) (string, []byte) {
+	content, err := os.ReadFile("examples/module2.yml")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "module2.yml")
+	require.NoError(t, os.WriteFile(path, content, 0644))
+	return path, content
+}
+
+func TestLoadWithChecksum(t *testing.T) {
+	path, content := copyManifest(t)
+	sum := sha256.Sum256(content)
+
+	loader := atk.NewAtkManifestFileLoader(atk.WithManifestVerifier(&atk.ChecksumVerifier{SHA256: "sha256:" + hex.EncodeToString(sum[:])}))
+	_, err := loader.Load(path)
+	assert.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, append(content, '\n'), 0644))
+	_, err = loader.Load(path)
+	var integrity *atk.ManifestIntegrityError
+	assert.ErrorAs(t, err, &integrity)
+}
+
+func TestLoadWithSignature(t *testing.T) {
+	path, content := copyManifest(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	digest := sha256.Sum256(content)
+	signature, err := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path+atk.SignatureFileSuffix, []byte(base64.StdEncoding.EncodeToString(signature)), 0644))
+
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	require.NoError(t, err)
+	keys, err := atk.ParsePublicKeys(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	loader := atk.NewAtkManifestFileLoader(atk.WithManifestVerifier(&atk.SignatureVerifier{Keys: keys}))
+	module, err := loader.Load(path)
+	require.NoError(t, err)
+	assert.NotEmpty(t, module.Metadata.Name)
+
+	// A signature made with another key is rejected.
+	otherPub, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	loader = atk.NewAtkManifestFileLoader(atk.WithManifestVerifier(&atk.SignatureVerifier{
+		Keys:      []crypto.PublicKey{otherPub},
+		Signature: []byte(base64.StdEncoding.EncodeToString(signature)),
+	}))
+	_, err = loader.Load(path)
+	assert.Error(t, err)
+
+	edSignature := ed25519.Sign(otherKey, content)
+	loader = atk.NewAtkManifestFileLoader(atk.WithManifestVerifier(&atk.SignatureVerifier{
+		Keys:      []crypto.PublicKey{otherPub},
+		Signature: []byte(base64.StdEncoding.EncodeToString(edSignature)),
+	}))
+	_, err = loader.Load(path)
+	assert.NoError(t, err)
+}
+
+func TestLoadWithMissingSignature(t *testing.T) {
+	path, _ := copyManifest(t)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	loader := atk.NewAtkManifestFileLoader(atk.WithManifestVerifier(&atk.SignatureVerifier{Keys: []crypto.PublicKey{pub}}))
+	_, err = loader.Load(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readJSONLog(t *testing.T, buf *bytes.Buffer) []atk.JSONLogRecord {
+	records := make([]atk.JSONLogRecord, 0)
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var record atk.JSONLogRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestJSONLogCommandRecords(t *testing.T) {
+	script := writeScript(t, t.TempDir(), "hook.sh", "echo hello\necho "+strings.Repeat("x", atk.MaxJSONLogOutput)+" >&2\nexit 2\n")
+
+	jsonLog := new(bytes.Buffer)
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runCtx.JSONLog = jsonLog
+	runCtx.RunID = "test-run"
+	err := atk.NewLocalModuleRunner(t.TempDir()).RunImage(runCtx, atk.ImageInfo{Script: script})
+	require.Error(t, err)
+	assert.Equal(t, "hello\n", outbuff.String())
+
+	records := readJSONLog(t, jsonLog)
+	require.Len(t, records, 2)
+	assert.Equal(t, atk.CommandRecord, records[0].Type)
+	assert.Equal(t, "test-run", records[0].RunID)
+	assert.Contains(t, records[0].Command, script)
+
+	exit := records[1]
+	assert.Equal(t, atk.ExitRecord, exit.Type)
+	require.NotNil(t, exit.ExitCode)
+	assert.Equal(t, 2, *exit.ExitCode)
+	assert.Equal(t, "hello\n", exit.Stdout)
+	assert.Len(t, exit.Stderr, atk.MaxJSONLogOutput)
+	assert.True(t, exit.Truncated)
+	assert.NotEmpty(t, exit.Error)
+}
+
+func TestJSONLogMasksValues(t *testing.T) {
+	jsonLog := new(bytes.Buffer)
+	runCtx, _, _, _ := newTestRunContext()
+	runCtx.JSONLog = jsonLog
+	runCtx.Mask("s3cret")
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage", EnvVars: []atk.EnvVarInfo{{Name: "TF_VAR_password", Value: "s3cret"}}})
+	require.NoError(t, err)
+
+	assert.NotContains(t, jsonLog.String(), "s3cret")
+	records := readJSONLog(t, jsonLog)
+	require.Len(t, records, 2)
+	assert.Contains(t, records[1].Command, "TF_VAR_password="+atk.MaskedValue)
+	assert.Equal(t, "run -e TF_VAR_password="+atk.MaskedValue+" myimage\n", records[1].Stdout)
+}
+
+func TestJSONLogStageRecords(t *testing.T) {
+	jsonLog := new(bytes.Buffer)
+	runCtx, _, _, _ := newTestRunContext()
+	runCtx.JSONLog = jsonLog
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(atktest.NewFakeRunner()), atk.WithRunID("test-run"))
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	records := readJSONLog(t, jsonLog)
+	require.NotEmpty(t, records)
+	assert.Equal(t, atk.StageStartRecord, records[0].Type)
+	assert.Equal(t, atk.Invalid, records[0].State)
+	for idx := 0; idx+1 < len(records); idx += 2 {
+		start, stop := records[idx], records[idx+1]
+		assert.Equal(t, atk.StageStartRecord, start.Type)
+		assert.Equal(t, atk.StageStopRecord, stop.Type)
+		assert.Equal(t, start.State, stop.State)
+		assert.Equal(t, "mymodule", stop.Module)
+		assert.Equal(t, "test-run", stop.RunID)
+	}
+	assert.Equal(t, atk.Done, records[len(records)-1].Next)
+}
+
+func TestJSONLogDisabled(t *testing.T) {
+	script := writeScript(t, t.TempDir(), "hook.sh", "echo hello\n")
+	runCtx, outbuff, _, _ := newTestRunContext()
+	err := atk.NewLocalModuleRunner(t.TempDir()).RunImage(runCtx, atk.ImageInfo{Script: script})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", outbuff.String())
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ruleIDs(findings []atk.Finding) []string {
+	ids := make([]string, 0, len(findings))
+	for _, f := range findings {
+		ids = append(ids, f.RuleID)
+	}
+	return ids
+}
+
+func TestLintScaffoldIsClean(t *testing.T) {
+	findings := atk.Lint(atk.NewModuleScaffold("mymodule"))
+	assert.Empty(t, findings)
+}
+
+func TestLintFindings(t *testing.T) {
+	moduleLoader := atk.NewAtkManifestFileLoader()
+	module, err := moduleLoader.Load("examples/module2.yml")
+	assert.NoError(t, err)
+
+	findings := atk.Lint(module)
+
+	assert.Equal(t, []string{"ATK004", "ATK004", "ATK004", "ATK005"}, ruleIDs(findings))
+	assert.Equal(t, atk.SeverityWarning, findings[0].Severity)
+	assert.Equal(t, "spec.hooks.validate.image", findings[0].Path)
+	assert.Equal(t, "spec.lifecycle.deploy.volumeMounts", findings[3].Path)
+	assert.False(t, atk.HasErrors(findings))
+}
+
+func TestLintErrors(t *testing.T) {
+	moduleLoader := atk.NewAtkManifestFileLoader()
+	module, err := moduleLoader.Load("examples/module7.yml")
+	// The loader reports the unsupported kind, but still returns the module.
+	assert.Error(t, err)
+	require.NotNil(t, module)
+
+	findings := atk.Lint(module)
+
+	assert.True(t, atk.HasErrors(findings))
+	assert.Equal(t, []string{"ATK001", "ATK005", "ATK006", "ATK008", "ATK008", "ATK008", "ATK007"}, ruleIDs(findings))
+	assert.Equal(t, atk.SeverityWarning, findings[3].Severity)
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeScript(t *testing.T, dir string, name string, body string) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755)
+	assert.NoError(t, err)
+	return path
+}
+
+func TestLocalRunnerRunsScript(t *testing.T) {
+	workdir := t.TempDir()
+	script := writeScript(t, t.TempDir(), "hook.sh", "echo \"$MYVAR from $(pwd)\"\n")
+
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := atk.NewLocalModuleRunner(workdir)
+	err := runner.RunImage(runCtx, atk.ImageInfo{
+		Script: script,
+		EnvVars: []atk.EnvVarInfo{
+			{Name: "MYVAR", Value: "thisismyvalue"},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.False(t, runCtx.IsErrored())
+	resolved, _ := filepath.EvalSymlinks(workdir)
+	assert.Equal(t, "thisismyvalue from "+resolved+"\n", outbuff.String())
+}
+
+func TestLocalRunnerUsesWorkspaceVolume(t *testing.T) {
+	workdir := t.TempDir()
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := atk.NewLocalModuleRunner("")
+	err := runner.RunImage(runCtx, atk.ImageInfo{
+		Command: []string{"sh", "-c"},
+		Args:    []string{"pwd"},
+		Volumes: []atk.VolumeInfo{
+			{Name: workdir, MountPath: "/workspace"},
+		},
+	})
+
+	assert.NoError(t, err)
+	resolved, _ := filepath.EvalSymlinks(workdir)
+	assert.Equal(t, resolved+"\n", outbuff.String())
+}
+
+func TestLocalRunnerWithErr(t *testing.T) {
+	script := writeScript(t, t.TempDir(), "fail.sh", "echo 'bad things' >&2\nexit 3\n")
+
+	runCtx, outbuff, errbuff, _ := newTestRunContext()
+	runner := atk.NewLocalModuleRunner(t.TempDir())
+	err := runner.RunImage(runCtx, atk.ImageInfo{Script: script})
+
+	assert.Error(t, err)
+	assert.Equal(t, "", outbuff.String())
+	assert.Equal(t, "bad things\n", errbuff.String())
+	assert.True(t, runCtx.IsErrored())
+	assert.Equal(t, 3, runCtx.LastErrCode)
+}
+
+func TestLocalRunnerNothingToRun(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	runner := atk.NewLocalModuleRunner(t.TempDir())
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(runCtx.Errors))
+}
+
+func TestLocalRunnerMapsWorkspacePaths(t *testing.T) {
+	workdir := t.TempDir()
+	writeScript(t, workdir, "list.sh", "echo \"listing $1\"\n")
+
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := atk.NewLocalModuleRunner(workdir)
+	err := runner.RunImage(runCtx, atk.ImageInfo{
+		Script: "/workspace/list.sh",
+		Args:   []string{"/workspace/vars.tfvars"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "listing "+filepath.Join(workdir, "vars.tfvars")+"\n", outbuff.String())
+}
+
+func TestLocalRunnerRejectsOtherVolumes(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	runner := atk.NewLocalModuleRunner(t.TempDir())
+	err := runner.RunImage(runCtx, atk.ImageInfo{
+		Command: []string{"true"},
+		Volumes: []atk.VolumeInfo{
+			{Name: "/home/myuser/.kube", MountPath: "/root/.kube"},
+		},
+	})
+
+	assert.Error(t, err)
+	assert.True(t, runCtx.IsErrored())
+}
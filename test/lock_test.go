@@ -0,0 +1,120 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockerAcquireAndRelease(t *testing.T) {
+	locker := atk.NewLocker(t.TempDir())
+	module := atktest.Manifest("mymodule")
+
+	lock, err := locker.Acquire(module, "/tmp/workspace", "run-1")
+	require.NoError(t, err)
+
+	_, err = locker.Acquire(module, "/tmp/workspace", "run-2")
+	var locked *atk.LockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, "run-1", locked.Holder.RunID)
+	assert.Equal(t, os.Getpid(), locked.Holder.PID)
+
+	// A different workspace is a different lock.
+	other, err := locker.Acquire(module, "/tmp/other", "run-3")
+	require.NoError(t, err)
+	assert.NoError(t, other.Release())
+
+	assert.NoError(t, lock.Release())
+	lock, err = locker.Acquire(module, "/tmp/workspace", "run-2")
+	require.NoError(t, err)
+	assert.NoError(t, lock.Release())
+}
+
+// writeLock writes a lock file for the holder in place of the lock that the
+// locker uses for the module.
+func writeLock(t *testing.T, locker *atk.Locker, module *atk.ModuleInfo, holder atk.LockInfo) {
+	_, err := locker.Acquire(module, "", "probe")
+	require.NoError(t, err)
+	matches, err := filepath.Glob(filepath.Join(locker.Dir, "*.lock"))
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	content, err := json.Marshal(holder)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(matches[0], content, 0644))
+}
+
+func TestLockerRemovesStaleLocks(t *testing.T) {
+	locker := atk.NewLocker(t.TempDir())
+	module := atktest.Manifest("mymodule")
+	host, _ := os.Hostname()
+
+	// A process that is not running on this host.
+	writeLock(t, locker, module, atk.LockInfo{Module: "mymodule", RunID: "dead", PID: 999999999, Host: host, CreatedAt: time.Now()})
+	lock, err := locker.Acquire(module, "", "run-1")
+	require.NoError(t, err)
+	assert.NoError(t, lock.Release())
+
+	// A lock of another host is only stale after StaleAfter.
+	writeLock(t, locker, module, atk.LockInfo{Module: "mymodule", RunID: "remote", PID: 1, Host: "elsewhere", CreatedAt: time.Now().Add(-time.Hour)})
+	_, err = locker.Acquire(module, "", "run-2")
+	assert.Error(t, err)
+	locker.StaleAfter = time.Minute
+	lock, err = locker.Acquire(module, "", "run-2")
+	require.NoError(t, err)
+	assert.NoError(t, lock.Release())
+}
+
+func TestLockerKeepsUnreadableLocks(t *testing.T) {
+	locker := atk.NewLocker(t.TempDir())
+	module := atktest.Manifest("mymodule")
+	writeLock(t, locker, module, atk.LockInfo{})
+	matches, err := filepath.Glob(filepath.Join(locker.Dir, "*.lock"))
+	require.NoError(t, err)
+
+	// An empty lock may still be being written by its process.
+	require.NoError(t, os.WriteFile(matches[0], nil, 0644))
+	_, err = locker.Acquire(module, "", "run-1")
+	assert.ErrorContains(t, err, "could not be read")
+
+	// Only once it has been unreadable for long enough is it stale.
+	old := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Chtimes(matches[0], old, old))
+	lock, err := locker.Acquire(module, "", "run-1")
+	require.NoError(t, err)
+	assert.NoError(t, lock.Release())
+
+	entries, err := os.ReadDir(locker.Dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestDeployHoldsLock(t *testing.T) {
+	locker := atk.NewLocker(t.TempDir())
+	module := atktest.Manifest("mymodule")
+	held, err := locker.Acquire(module, "", "other-run")
+	require.NoError(t, err)
+
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithLocker(locker))
+	result, err := deployment.Deploy(runCtx)
+
+	var locked *atk.LockedError
+	assert.ErrorAs(t, err, &locked)
+	assert.Equal(t, atk.Invalid, result.State)
+	assert.Empty(t, runner.Calls())
+
+	require.NoError(t, held.Release())
+	result, err = deployment.Deploy(runCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, atk.Done, result.State)
+	matches, _ := filepath.Glob(filepath.Join(locker.Dir, "*.lock"))
+	assert.Empty(t, matches)
+}
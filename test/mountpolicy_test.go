@@ -0,0 +1,104 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mountingModule(volumes ...atk.VolumeInfo) *atk.ModuleInfo {
+	module := atktest.Manifest("mounts")
+	module.Specifications.Lifecycle.Deploy.Volumes = volumes
+	return module
+}
+
+func TestMountPolicyCheck(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	work := t.TempDir()
+	policy := &atk.MountPolicy{Deny: []string{"~/.ssh", "/etc"}}
+
+	violations := policy.Check(mountingModule(
+		atk.VolumeInfo{Name: work, MountPath: "/workspace"},
+		atk.VolumeInfo{Name: "~/.ssh", MountPath: "/root/.ssh"},
+		atk.VolumeInfo{Name: filepath.Join(home, ".ssh", "id_rsa"), MountPath: "/key"},
+		atk.VolumeInfo{Name: "/", MountPath: "/host"},
+		atk.VolumeInfo{Name: home, MountPath: "/home"},
+		atk.VolumeInfo{Name: "/etc/hosts", MountPath: "/etc/hosts"},
+		atk.VolumeInfo{Name: "mydata", MountPath: "/data"},
+	))
+	require.Len(t, violations, 5)
+	assert.Equal(t, "spec.lifecycle.deploy", violations[0].Path)
+	assert.Equal(t, "~/.ssh", violations[0].Volume.Name)
+	assert.Equal(t, "~/.ssh", violations[1].Denied)
+	assert.Equal(t, "/", violations[2].Volume.Name)
+	assert.Equal(t, home, violations[3].Volume.Name)
+	assert.Equal(t, "/etc", violations[4].Denied)
+
+	policy.Allow = []string{"/etc/hosts", "~/.ssh/id_rsa"}
+	violations = policy.Check(mountingModule(
+		atk.VolumeInfo{Name: "/etc/hosts", MountPath: "/etc/hosts"},
+		atk.VolumeInfo{Name: "~/.ssh/id_rsa", MountPath: "/key"},
+		atk.VolumeInfo{Name: "/etc/passwd", MountPath: "/etc/passwd"},
+	))
+	require.Len(t, violations, 1)
+	assert.Equal(t, "/etc/passwd", violations[0].Volume.Name)
+}
+
+func TestMountPolicyResolvesLinks(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	require.NoError(t, os.Mkdir(filepath.Join(home, ".ssh"), 0700))
+	link := filepath.Join(t.TempDir(), "innocent")
+	require.NoError(t, os.Symlink(filepath.Join(home, ".ssh"), link))
+
+	violations := atk.DefaultMountPolicy().Check(mountingModule(atk.VolumeInfo{Name: link, MountPath: "/data"}))
+	require.Len(t, violations, 1)
+	assert.Equal(t, "~/.ssh", violations[0].Denied)
+}
+
+func TestDeployDeniesMounts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	module := mountingModule(atk.VolumeInfo{Name: "~/.kube", MountPath: "/root/.kube"})
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+
+	plan := deployment.Plan()
+	require.Len(t, plan.Violations, 1)
+	assert.Contains(t, plan.String(), "Mounts that are not allowed:")
+
+	_, err := deployment.Deploy(runCtx)
+	var policyErr *atk.MountPolicyError
+	require.ErrorAs(t, err, &policyErr)
+	assert.Equal(t, "mounts", policyErr.Module)
+	assert.Empty(t, runner.Calls())
+
+	deployment = atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithAllowedMounts("~/.kube"))
+	assert.Empty(t, deployment.Plan().Violations)
+	_, err = deployment.Deploy(runCtx)
+	assert.NoError(t, err)
+
+	deployment = atk.NewDeployableModule(runCtx, module, atk.WithRunner(atktest.NewFakeRunner()), atk.WithMountPolicy(nil))
+	_, err = deployment.Deploy(runCtx)
+	assert.NoError(t, err)
+}
+
+func TestHookDeniesMounts(t *testing.T) {
+	module := atktest.Manifest("mounts")
+	module.Specifications.Hooks.List.Volumes = []atk.VolumeInfo{{Name: "/proc", MountPath: "/host/proc"}}
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+
+	_, err := deployment.List(runCtx)
+	var policyErr *atk.MountPolicyError
+	require.ErrorAs(t, err, &policyErr)
+	assert.Equal(t, "spec.hooks.list", policyErr.Violations[0].Path)
+	atktest.AssertNotRan(t, runner, "mounts-list")
+}
@@ -0,0 +1,54 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleWorkspace(t *testing.T) {
+	root := t.TempDir()
+	module := atktest.Manifest("mymodule")
+	dir, err := atk.ModuleWorkspace(root, module)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "atktest", "mymodule"), dir)
+
+	module.Metadata.Namespace = ""
+	dir, err = atk.ModuleWorkspace(root, module)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, atk.DefaultNamespace, "mymodule"), dir)
+
+	module.Metadata.Namespace = "../etc"
+	_, err = atk.ModuleWorkspace(root, module)
+	assert.Error(t, err)
+}
+
+func TestWorkspaceRootScopesByNamespace(t *testing.T) {
+	root := t.TempDir()
+	var workspaces []string
+	for _, namespace := range []string{"team-a", "team-b"} {
+		module := atktest.Manifest("mymodule")
+		module.Metadata.Namespace = namespace
+		runner := atktest.NewFakeRunner()
+		runCtx, _, _, _ := newTestRunContext()
+		deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithWorkspaceRoot(root))
+		_, err := deployment.Deploy(runCtx)
+		require.NoError(t, err)
+
+		calls := runner.Calls()
+		require.NotEmpty(t, calls)
+		volumes := calls[0].Info.Volumes
+		require.NotEmpty(t, volumes)
+		workspace := volumes[len(volumes)-1]
+		assert.Equal(t, "/workspace", workspace.MountPath)
+		_, err = os.Stat(workspace.Name)
+		assert.NoError(t, err)
+		workspaces = append(workspaces, workspace.Name)
+	}
+	assert.NotEqual(t, workspaces[0], workspaces[1])
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier keeps the notifications that it receives in memory.
+type recordingNotifier struct {
+	mu            sync.Mutex
+	notifications []atk.Notification
+}
+
+func (r *recordingNotifier) Send(ctx context.Context, n atk.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, n)
+	return nil
+}
+
+func TestDeployNotifies(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	notifier := &recordingNotifier{}
+	runner := atktest.NewFakeRunner()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner), atk.WithNotifiers(notifier))
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	require.Len(t, notifier.notifications, 1)
+	assert.True(t, notifier.notifications[0].Succeeded)
+	assert.Equal(t, atk.Done, notifier.notifications[0].State)
+	assert.Equal(t, "Module mymodule deployed", notifier.notifications[0].Title())
+
+	runCtx, _, _, _ = newTestRunContext()
+	runner.On("mymodule-deploy", atktest.Response{ExitCode: 1})
+	deployment = atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner), atk.WithNotifiers(notifier))
+	_, err = deployment.Deploy(runCtx)
+	require.Error(t, err)
+	require.Len(t, notifier.notifications, 2)
+	failed := notifier.notifications[1]
+	assert.False(t, failed.Succeeded)
+	assert.Equal(t, atk.Deploying, failed.FailedState)
+	assert.Contains(t, failed.Message(), "failed in state deploying")
+}
+
+func TestSlackAndWebhookNotifiers(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		body := make(map[string]interface{})
+		json.Unmarshal(content, &body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	n := atk.Notification{Module: "mymodule", RunID: "run-1", State: atk.Done, Succeeded: true}
+	require.NoError(t, atk.NewSlackNotifier(server.URL).Send(context.Background(), n))
+	assert.Contains(t, (<-bodies)["text"], "*Module mymodule deployed*")
+
+	require.NoError(t, atk.NewWebhookNotifier(server.URL).Send(context.Background(), n))
+	body := <-bodies
+	assert.Equal(t, "mymodule", body["module"])
+	assert.Equal(t, true, body["succeeded"])
+}
+
+func TestDesktopNotifierCommand(t *testing.T) {
+	n := atk.Notification{Module: "mymodule", RunID: "run-1", Succeeded: false, FailedState: atk.Deploying, Error: `exit "1"`}
+	cmd, err := (&atk.DesktopNotifier{OS: "linux"}).Command(context.Background(), n)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"notify-send", "--app-name=atk", "--urgency=critical", "Module mymodule failed", n.Message()}, cmd.Args)
+
+	cmd, err = (&atk.DesktopNotifier{OS: "darwin"}).Command(context.Background(), n)
+	require.NoError(t, err)
+	assert.Contains(t, cmd.Args[2], `with title "Module mymodule failed"`)
+	assert.Contains(t, cmd.Args[2], `exit \"1\"`)
+
+	_, err = (&atk.DesktopNotifier{OS: "plan9"}).Command(context.Background(), n)
+	assert.Error(t, err)
+}
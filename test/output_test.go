@@ -0,0 +1,71 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineCallbackReceivesLines(t *testing.T) {
+	var mu sync.Mutex
+	lines := make(map[atk.OutputStream][]string)
+	callback := func(state atk.State, stream atk.OutputStream, line string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if state == atk.Deploying {
+			lines[stream] = append(lines[stream], line)
+		}
+		return nil
+	}
+	runner := atktest.NewFakeRunner().
+		On("mymodule-deploy", atktest.Response{Out: "one\ntwo\r\nthree", Err: "warning\n"})
+
+	runCtx, outbuff, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner), atk.WithLineCallback(callback), atk.WithCapturedOutput(0))
+	defer deployment.CloseOutputs()
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"one", "two", "three"}, lines[atk.Stdout])
+	assert.Equal(t, []string{"warning"}, lines[atk.Stderr])
+	assert.Contains(t, outbuff.String(), "one\ntwo\r\nthree")
+	assert.Equal(t, "one\ntwo\r\nthree", deployment.Output(atk.Deploying).Stdout.String())
+}
+
+func TestLineCallbackAbortsStage(t *testing.T) {
+	dir := t.TempDir()
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle = atk.LifecycleInfo{
+		PreDeploy:  atk.ImageInfo{Script: writeScript(t, dir, "pre.sh", "exit 0\n")},
+		Deploy:     atk.ImageInfo{Script: writeScript(t, dir, "deploy.sh", "echo 'Error acquiring the state lock'\nexec sleep 30\n")},
+		PostDeploy: atk.ImageInfo{Script: writeScript(t, dir, "post.sh", "exit 0\n")},
+	}
+	module.Specifications.Hooks = atk.HookInfo{}
+	lockErr := errors.New("state is locked")
+	callback := func(state atk.State, stream atk.OutputStream, line string) error {
+		if strings.Contains(line, "Error acquiring the state lock") {
+			return lockErr
+		}
+		return nil
+	}
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(atk.NewLocalModuleRunner(t.TempDir())), atk.WithLineCallback(callback))
+	started := time.Now()
+	result, err := deployment.Deploy(runCtx)
+
+	assert.Less(t, time.Since(started), 10*time.Second)
+	var aborted *atk.StageAbortedError
+	require.ErrorAs(t, err, &aborted)
+	assert.Equal(t, atk.Deploying, aborted.State)
+	assert.Equal(t, "Error acquiring the state lock", aborted.Line)
+	assert.ErrorIs(t, err, lockErr)
+	assert.Equal(t, atk.Deploying, result.FailedState)
+}
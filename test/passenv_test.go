@@ -0,0 +1,56 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildWithPassEnv(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman"}).
+		WithImage("myimage").
+		WithEnvvar("API_KEY", "secret").
+		WithEnvvar("PATH", "/opt/bin").
+		WithEnvvar("CONTAINER_HOST", "unix:///run/podman.sock").
+		WithPassEnv()
+
+	actual, err := builder.Build()
+	require.NoError(t, err)
+	assert.Equal(t, "podman run -e API_KEY -e PATH=/opt/bin -e CONTAINER_HOST=unix:///run/podman.sock myimage", actual)
+	assert.Equal(t, []string{"podman", "run", "-e", "API_KEY", "-e", "PATH=/opt/bin", "-e", "CONTAINER_HOST=unix:///run/podman.sock", "myimage"}, builder.BuildArgs())
+	assert.Equal(t, []string{"API_KEY=secret"}, builder.BuildEnv())
+}
+
+func TestBuildWithoutPassEnv(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman"}).
+		WithImage("myimage").
+		WithEnvvar("API_KEY", "secret")
+	assert.Contains(t, builder.BuildArgs(), "API_KEY=secret")
+	assert.Empty(t, builder.BuildEnv())
+}
+
+func TestRunImageWithPassEnv(t *testing.T) {
+	podman := writeScript(t, t.TempDir(), "podman", "echo \"$@\"\necho \"API_KEY is $API_KEY\"\n")
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman, PassEnv: true})}
+
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage", EnvVars: []atk.EnvVarInfo{{Name: "API_KEY", Value: "secret"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "run -e API_KEY myimage\nAPI_KEY is secret\n", outbuff.String())
+}
+
+func TestPassEnvFromConfig(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv(atk.PassEnvEnvVar, "true")
+	cfg, err := atk.LoadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+	require.NoError(t, err)
+	assert.True(t, cfg.PassEnv)
+	assert.True(t, cfg.CliParts().PassEnv)
+
+	t.Setenv(atk.PassEnvEnvVar, "maybe")
+	_, err = atk.LoadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+	assert.ErrorContains(t, err, "invalid ITZ_PASS_ENV")
+}
@@ -0,0 +1,45 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle.Deploy.EnvVars = []atk.EnvVarInfo{
+		{Name: "REGION", Value: "us-east"},
+		{Name: "API_KEY"},
+	}
+	module.Specifications.Lifecycle.PostDeploy.Image = module.Specifications.Lifecycle.Deploy.Image
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithExecOrder([]atk.State{
+		atk.Invalid, atk.Initializing, atk.Configured, atk.Validated,
+		atk.Deploying, atk.Deployed, atk.PreDeploying, atk.PreDeployed,
+		atk.PostDeploying, atk.PostDeployed,
+	}))
+
+	plan := deployment.Plan()
+	require.Len(t, plan.Stages, 3)
+	assert.Equal(t, "deploy", plan.Stages[0].Name)
+	assert.Equal(t, "pre_deploy", plan.Stages[1].Name)
+	assert.Equal(t, []atk.PlannedEnvVar{
+		{Name: "REGION", Source: atk.EnvFromManifest},
+		{Name: "API_KEY", Source: atk.EnvFromInput},
+		{Name: atk.RunIDEnvVar, Source: atk.EnvFromDeployment},
+	}, plan.Stages[0].Env)
+	assert.Len(t, plan.Hooks, 3)
+	// The deploy image is used twice but only pulled once.
+	assert.Len(t, plan.Pulls, 5)
+
+	explained := deployment.Explain()
+	assert.Contains(t, explained, "env: API_KEY (from input)")
+	assert.NotContains(t, explained, "us-east")
+	assert.Less(t, strings.Index(explained, "mymodule-deploy"), strings.Index(explained, "mymodule-pre-deploy"))
+	assert.Contains(t, explained, "Images that may be pulled: 5")
+}
@@ -3,10 +3,13 @@ package test
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"strings"
 	"testing"
 
 	atk "github.com/cloud-native-toolkit/atkmod"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var testPodmanPath = os.Getenv("ITZ_PODMAN_PATH")
@@ -92,6 +95,26 @@ func TestBuildFrom(t *testing.T) {
 
 }
 
+func TestBuildFromCommand(t *testing.T) {
+	imageInfo := atk.ImageInfo{
+		Image:   "myimage",
+		Command: []string{"/bin/sh", "-c"},
+		Args:    []string{"echo hello"},
+	}
+
+	actual, err := atk.NewPodmanCliCommandBuilder(nil).BuildFrom(imageInfo)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s run --entrypoint /bin/sh myimage -c 'echo hello'", testPodmanPath), actual)
+
+	args, err := atk.NewPodmanCliCommandBuilder(nil).BuildArgsFrom(imageInfo)
+	require.NoError(t, err)
+	assert.Equal(t, []string{testPodmanPath, "run", "--entrypoint", "/bin/sh", "myimage", "-c", "echo hello"}, args)
+
+	local, err := atk.NewLocalModuleRunner(t.TempDir()).BuildFrom(imageInfo)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh", "-c", "echo hello"}, local.Args)
+}
+
 func TestProvideOverrides(t *testing.T) {
 
 	cli := &atk.CliParts{
@@ -127,3 +150,262 @@ func TestPsCommandOnly(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, fmt.Sprintf("%s ps --format \"{{.Image}}\"", "/usr/local/bin/podman"), actual)
 }
+
+func TestPsCommandArgs(t *testing.T) {
+	bldr := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman", Cmd: `ps --format "{{.Image}} {{.Names}}" -a`})
+	assert.Equal(t, []string{"podman", "ps", "--format", "{{.Image}} {{.Names}}", "-a"}, bldr.BuildArgs())
+
+	bldr = atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman", Cmd: `container  inspect --format '{{.State}}' it\'s`})
+	assert.Equal(t, []string{"podman", "container", "inspect", "--format", "{{.State}}", "it's"}, bldr.BuildArgs())
+}
+
+func TestRunPsCommand(t *testing.T) {
+	podman := writeScript(t, t.TempDir(), "podman", "printf '%s\\n' \"$@\"\n")
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman, Cmd: `ps --format "{{.Image}}"`})}
+	assert.NoError(t, runner.Run(runCtx))
+	assert.Equal(t, "ps\n--format\n{{.Image}}\n", outbuff.String())
+}
+
+func TestBuildRunWithFlags(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(nil)
+	actual, err := builder.
+		WithImage("myimage").
+		WithFlags("-i", "--rm").
+		Build()
+
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("%s run -i --rm myimage", testPodmanPath), actual)
+}
+
+func TestRunImageInteractive(t *testing.T) {
+	// echo stands in for podman, so the command line is written to the output.
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runCtx.In = strings.NewReader("")
+
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"})
+	assert.NoError(t, err)
+	assert.Equal(t, "run myimage\n", outbuff.String())
+
+	outbuff.Reset()
+	runner = &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo", Interactive: true})}
+	err = runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"})
+	assert.NoError(t, err)
+	assert.Equal(t, "run -i myimage\n", outbuff.String())
+}
+
+func TestBuildRunWithConnection(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "/usr/bin/podman"})
+	actual, err := builder.
+		WithConnection("machine-default").
+		WithImage("myimage").
+		Build()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "/usr/bin/podman --connection machine-default run myimage", actual)
+}
+
+func TestMachinePath(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	tests := []struct {
+		platform atk.HostPlatform
+		local    string
+		expected string
+	}{
+		{atk.PlatformLinux, "/home/me/work", "/home/me/work"},
+		{atk.PlatformLinux, "myvolume", "myvolume"},
+		{atk.PlatformWindows, `C:\Users\me\work`, "/mnt/c/Users/me/work"},
+		{atk.PlatformWindows, `d:/src/module`, "/mnt/d/src/module"},
+		{atk.PlatformWindows, `E:\`, "/mnt/e"},
+		{atk.PlatformWindows, "myvolume", "myvolume"},
+		{atk.PlatformWSL, `C:\Users\me\work`, "/mnt/c/Users/me/work"},
+		{atk.PlatformWSL, "/home/me/work", "/home/me/work"},
+		{atk.PlatformDarwin, "/Users/me/work", "/Users/me/work"},
+		{atk.PlatformDarwin, "/tmp/work", "/private/tmp/work"},
+		{atk.PlatformDarwin, "/var/folders/xy/T/work", "/var/folders/xy/T/work"},
+		{atk.PlatformDarwin, "/var/lib/work", "/private/var/lib/work"},
+		{atk.PlatformDarwin, "~/work", home + "/work"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, atk.MachinePath(test.platform, test.local), "%s %s", test.platform, test.local)
+	}
+}
+
+func TestBuildFromOnWindows(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman", Platform: atk.PlatformWindows})
+	actual, err := builder.WithWorkspace(`C:\Users\me\work`).
+		BuildFrom(atk.ImageInfo{
+			Image:   "myimage",
+			Volumes: []atk.VolumeInfo{{Name: `C:\Users\me\.kube`, MountPath: "/root/.kube"}},
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "podman run -v /mnt/c/Users/me/work:/workspace -v /mnt/c/Users/me/.kube:/root/.kube myimage", actual)
+}
+
+func TestValidate(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman"})
+	assert.NoError(t, builder.WithImage("myimage").WithPort("8080", "80/tcp").Validate())
+
+	builder = atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman"})
+	err := builder.
+		WithPort("80a", "80").
+		WithUserMap(-1, 0, 1).
+		WithEnvvar("MYVAR", "one").
+		WithEnvvar("MYVAR", "two").
+		WithEnvvar("MY-VAR", "three").
+		WithVolume("", "/workspace").
+		WithVolume("/home/me", "workspace").
+		Validate()
+
+	var partsErr *atk.CliPartsError
+	assert.ErrorAs(t, err, &partsErr)
+	assert.Equal(t, []string{
+		"an image is required to run a container",
+		"invalid port map 80a:80",
+		"invalid uid map 0:-1:1; expected container:host:size",
+		"duplicate environment variable MYVAR",
+		`invalid environment variable name "MY-VAR"`,
+		"invalid volume :/workspace: the local path or volume name is empty",
+		"invalid volume /home/me:workspace: the path in the container must be absolute",
+	}, partsErr.Problems)
+}
+
+func TestRunImageInvalid(t *testing.T) {
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage", EnvVars: []atk.EnvVarInfo{{Name: "A"}, {Name: "A"}}})
+
+	var partsErr *atk.CliPartsError
+	assert.ErrorAs(t, err, &partsErr)
+	assert.Empty(t, outbuff.String())
+}
+
+func TestBuildArgs(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman", Connection: "remote", Flags: []string{"--rm"}, Platform: atk.PlatformLinux})
+	builder.WithUserMap(1000, 0, 1).
+		WithPort("9090", "90").
+		WithPort("8080", "80")
+	args, err := builder.BuildArgsFrom(atk.ImageInfo{
+		Image:   "myimage",
+		Args:    []string{"apply"},
+		EnvVars: []atk.EnvVarInfo{{Name: "MYVAR", Value: "thisismyvalue"}},
+		Volumes: []atk.VolumeInfo{{Name: "/tmp/data", MountPath: "/var/app/db"}},
+	})
+	assert.NoError(t, err)
+	cmd, err := builder.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Fields(cmd), args)
+	assert.Equal(t, "podman --connection remote run --rm --uidmap 0:1000:1 -v /tmp/data:/var/app/db -p 9090:90 -p 8080:80 -e MYVAR=thisismyvalue myimage apply", cmd)
+}
+
+func TestBuildArgsKeepsSpaces(t *testing.T) {
+	args := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman"}).
+		WithImage("myimage").
+		WithEnvvar("GREETING", "hello world").
+		BuildArgs()
+	assert.Equal(t, []string{"podman", "run", "-e", "GREETING=hello world", "myimage"}, args)
+}
+
+func TestBuildQuotesValues(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman"}).
+		WithImage("myimage").
+		WithVolume("/tmp/my data", "/data").
+		WithEnvvar("GREETING", "hello world").
+		WithEnvvar("QUOTE", "it's").
+		WithEnvvar("EMPTY", "").
+		WithEnvvar("SHELL_CHARS", "$HOME;*")
+	actual, err := builder.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, `podman run -v '/tmp/my data:/data' -e 'GREETING=hello world' -e 'QUOTE=it'\''s' -e EMPTY= -e 'SHELL_CHARS=$HOME;*' myimage`, actual)
+
+	out, err := exec.Command("sh", "-c", "printf '%s\\n' "+strings.TrimPrefix(actual, "podman ")).Output()
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join(builder.BuildArgs()[1:], "\n")+"\n", string(out))
+}
+
+func TestRunImageKeepsSpaces(t *testing.T) {
+	podman := writeScript(t, t.TempDir(), "podman", "printf '%s\\n' \"$@\"\n")
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman})}
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage", Args: []string{"two  spaces"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "run\nmyimage\ntwo  spaces\n", outbuff.String())
+}
+
+func TestBuildKeepsInsertionOrder(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman"}).
+		WithImage("myimage").
+		WithPort("9090", "90").
+		WithPort("8080", "80").
+		WithPort("7070", "70")
+	for i := 0; i < 10; i++ {
+		actual, err := builder.Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "podman run -p 9090:90 -p 8080:80 -p 7070:70 myimage", actual)
+	}
+}
+
+func TestBuildCanonicalOrder(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman", Flags: []string{"--rm", "--name", "mine"}, Platform: atk.PlatformLinux}).
+		WithImage("myimage").
+		WithPort("9090", "90").
+		WithPort("8080", "80").
+		WithVolume("/tmp/b", "/b").
+		WithVolume("/tmp/a", "/a").
+		WithEnvvar("ZED", "1").
+		WithEnvvar("ALPHA", "2").
+		WithCanonicalOrder()
+	expected := "podman run --rm --name mine -v /tmp/a:/a -v /tmp/b:/b -p 8080:80 -p 9090:90 -e ALPHA=2 -e ZED=1 myimage"
+	actual, err := builder.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, strings.Fields(expected), builder.BuildArgs())
+
+	// The order that the builder has is not changed.
+	builder.WithEnvvar("BETA", "3")
+	actual, err = builder.Build()
+	assert.NoError(t, err)
+	assert.Contains(t, actual, "-e ALPHA=2 -e BETA=3 -e ZED=1")
+}
+
+func TestBuildConflicts(t *testing.T) {
+	builder := atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "podman", Platform: atk.PlatformLinux}).
+		WithImage("myimage").
+		WithPort("8080", "80").
+		WithPort("127.0.0.1:8080", "81").
+		WithPort("8080", "53/udp").
+		WithPort("127.0.0.1:9090", "90").
+		WithPort("127.0.0.2:9090", "90").
+		WithEnvvar("MYVAR", "one").
+		WithEnvvar("MYVAR", "two").
+		WithVolume("/tmp/a", "/data").
+		WithVolume("/tmp/b", "/data/").
+		WithVolume("/tmp/a", "/other")
+
+	_, err := builder.Build()
+	var partsErr *atk.CliPartsError
+	assert.ErrorAs(t, err, &partsErr)
+	assert.Equal(t, []string{
+		"port maps 8080:80 and 127.0.0.1:8080:81 bind the same port of the host",
+		"duplicate environment variable MYVAR",
+		"volumes /tmp/a:/data and /tmp/b:/data/ both mount /data in the container",
+	}, partsErr.Problems)
+
+	assert.ErrorAs(t, builder.Validate(), &partsErr)
+	assert.Contains(t, partsErr.Problems, "port maps 8080:80 and 127.0.0.1:8080:81 bind the same port of the host")
+}
+
+func TestRunImageConflicts(t *testing.T) {
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage", Volumes: []atk.VolumeInfo{
+		{Name: "/tmp/a", MountPath: "/workspace"},
+		{Name: "/tmp/b", MountPath: "/workspace"},
+	}})
+
+	var partsErr *atk.CliPartsError
+	assert.ErrorAs(t, err, &partsErr)
+	assert.Empty(t, outbuff.String())
+}
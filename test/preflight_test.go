@@ -0,0 +1,106 @@
+package test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withTool puts a tool that prints the given version on the PATH.
+func withTool(t *testing.T, name string, version string) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '" + name + " version " + version + "'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestPreflight(t *testing.T) {
+	withTool(t, "mytool", "4.5.1")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Requires = &atk.RequiresInfo{
+		Tools:     []atk.ToolRequirement{{Name: "sh"}, {Name: "mytool", Version: ">= 4.x"}, {Name: "mytool", Version: "= 4.5"}},
+		DiskSpace: "1Ki",
+		Endpoints: []string{listener.Addr().String()},
+	}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(atktest.NewFakeRunner()))
+
+	result, err := deployment.Preflight(runCtx)
+	require.NoError(t, err)
+	assert.True(t, result.Passed())
+	assert.Len(t, result.Checks, 5)
+}
+
+func TestPreflightFails(t *testing.T) {
+	withTool(t, "mytool", "3.4.0")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := listener.Addr().String()
+	listener.Close()
+
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Requires = &atk.RequiresInfo{
+		Tools:     []atk.ToolRequirement{{Name: "no-such-tool-atk"}, {Name: "mytool", Version: "4.x"}},
+		DiskSpace: "1000Ti",
+		Endpoints: []string{"http://" + closed},
+	}
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+
+	result, err := deployment.Preflight(runCtx)
+	var preflight *atk.PreflightError
+	require.ErrorAs(t, err, &preflight)
+	assert.Len(t, preflight.Failures, 4)
+	assert.False(t, result.Passed())
+	assert.Equal(t, "no-such-tool-atk: not found", preflight.Failures[0].String())
+	assert.Equal(t, "mytool 4.x: found version 3.4.0", preflight.Failures[1].String())
+
+	// Deploy checks the requirements before anything runs.
+	_, err = deployment.Deploy(runCtx)
+	assert.ErrorAs(t, err, &preflight)
+	assert.Empty(t, runner.Calls())
+}
+
+func TestParseSize(t *testing.T) {
+	for s, expected := range map[string]uint64{
+		"1024":  1024,
+		"10Gi":  10 << 30,
+		"2GiB":  2 << 30,
+		"500MB": 500 * 1000 * 1000,
+		"5G":    5 * 1000 * 1000 * 1000,
+		"3 Ki":  3 << 10,
+	} {
+		size, err := atk.ParseSize(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, expected, size, s)
+		}
+	}
+	_, err := atk.ParseSize("10 parsecs")
+	assert.Error(t, err)
+}
+
+func TestLintRequires(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Requires = &atk.RequiresInfo{
+		Tools:     []atk.ToolRequirement{{Name: "podman", Version: ">= four"}},
+		DiskSpace: "lots",
+	}
+	var found []string
+	for _, f := range atk.Lint(module) {
+		if f.RuleID == "ATK013" {
+			found = append(found, f.Message)
+		}
+	}
+	assert.Len(t, found, 2)
+}
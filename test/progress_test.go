@@ -0,0 +1,68 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployReportsProgress(t *testing.T) {
+	progress := make([]atk.Progress, 0)
+	reporter := atk.ProgressFunc(func(p atk.Progress) {
+		progress = append(progress, p)
+	})
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(atktest.NewFakeRunner()), atk.WithProgressReporter(reporter))
+	result, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, progress)
+	assert.Equal(t, atk.Invalid, progress[0].State)
+	assert.Equal(t, 0.0, progress[0].Percent)
+	last := progress[len(progress)-1]
+	assert.Equal(t, atk.Done, last.State)
+	assert.Equal(t, 100.0, last.Percent)
+	for idx := 1; idx < len(progress); idx++ {
+		assert.GreaterOrEqual(t, progress[idx].Percent, progress[idx-1].Percent)
+		assert.NotEqual(t, progress[idx].State, progress[idx-1].State)
+	}
+	assert.NotEmpty(t, result.Stages)
+}
+
+func TestDeployProgressKeepsPercentOnError(t *testing.T) {
+	var last atk.Progress
+	var beforeError float64
+	reporter := atk.ProgressFunc(func(p atk.Progress) {
+		if p.State != atk.Errored {
+			beforeError = p.Percent
+		}
+		last = p
+	})
+	runner := atktest.NewFakeRunner().On("mymodule-deploy", atktest.Response{ExitCode: 1})
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner), atk.WithProgressReporter(reporter))
+	_, err := deployment.Deploy(runCtx)
+	require.Error(t, err)
+
+	assert.Equal(t, atk.Errored, last.State)
+	assert.Equal(t, beforeError, last.Percent)
+	assert.Greater(t, last.Percent, 0.0)
+}
+
+func TestEstimateStageWeights(t *testing.T) {
+	assert.Equal(t, atk.DefaultStageWeights, atk.EstimateStageWeights(nil))
+
+	history := []atk.DeploymentResult{
+		{Stages: []atk.StageTiming{{State: atk.Deploying, Duration: 2 * time.Second}, {State: atk.PreDeploying, Duration: time.Second}}},
+		{Stages: []atk.StageTiming{{State: atk.Deploying, Duration: 4 * time.Second}}},
+	}
+	weights := atk.EstimateStageWeights(history)
+	assert.Equal(t, 3.0, weights[atk.Deploying])
+	assert.Equal(t, 1.0, weights[atk.PreDeploying])
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeploymentProvenance(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle.Deploy.EnvVars = []atk.EnvVarInfo{{Name: "API_KEY", Value: "secret"}}
+	digests := func(image string) (string, error) {
+		if image == "mymodule-post-deploy" {
+			return "", errors.New("no such image")
+		}
+		return "sha256:0123abcd", nil
+	}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module,
+		atk.WithRunner(atktest.NewFakeRunner()), atk.WithProvenance(digests))
+	result, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	require.NotNil(t, result.Provenance)
+
+	p := result.Provenance
+	checksum, err := atk.ManifestChecksum(module)
+	require.NoError(t, err)
+	assert.Equal(t, atk.ProvenancePredicateType, p.PredicateType)
+	assert.Equal(t, "atktest/mymodule", p.Subject[0].Name)
+	assert.Equal(t, checksum, p.Subject[0].Digest["sha256"])
+	assert.Equal(t, []atk.ProvenanceMaterial{
+		{URI: "mymodule-pre-deploy", Digest: atk.DigestSet{"sha256": "0123abcd"}},
+		{URI: "mymodule-deploy", Digest: atk.DigestSet{"sha256": "0123abcd"}},
+		{URI: "mymodule-post-deploy"},
+	}, p.Predicate.Materials)
+	assert.Contains(t, p.Predicate.Invocation.Parameters.Variables, "API_KEY")
+	assert.Equal(t, result.RunID, p.Predicate.Invocation.Parameters.RunID)
+	assert.Equal(t, result.FinishedAt, p.Predicate.Metadata.BuildFinishedOn)
+
+	content, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "secret")
+	assert.Contains(t, string(content), `"_type":"https://in-toto.io/Statement/v0.1"`)
+}
+
+func TestNoProvenanceOnFailure(t *testing.T) {
+	runner := atktest.NewFakeRunner().On("mymodule-deploy", atktest.Response{ExitCode: 1})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"),
+		atk.WithRunner(runner), atk.WithProvenance(nil))
+	result, err := deployment.Deploy(runCtx)
+	assert.Error(t, err)
+	assert.Nil(t, result.Provenance)
+}
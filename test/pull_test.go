@@ -0,0 +1,78 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePodman writes a script that stands in for podman: the image is never
+// in the local storage, pull fails until it has been tried failures times,
+// and the other commands are echoed.
+func fakePodman(t *testing.T, failures int) (string, string) {
+	dir := t.TempDir()
+	count := filepath.Join(dir, "pulls")
+	script := `#!/bin/sh
+case "$1" in
+image) exit 1 ;;
+pull)
+  n=$(cat ` + count + ` 2>/dev/null || echo 0); n=$((n+1)); echo $n > ` + count + `
+  if [ $n -le ` + strconv.Itoa(failures) + ` ]; then
+    echo "Trying to pull $2..." >&2; echo "Error: connection reset by peer" >&2; exit 125
+  fi ;;
+*) echo "$@" ;;
+esac
+`
+	path := filepath.Join(dir, "podman")
+	require.NoError(t, os.WriteFile(path, []byte(script), 0755))
+	return path, count
+}
+
+func TestRunImagePullRetries(t *testing.T) {
+	podman, count := fakePodman(t, 1)
+	runCtx, outbuff, errbuff, _ := newTestRunContext()
+	runner := &atk.CliModuleRunner{
+		PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman}),
+		Pull:                    &atk.PullOptions{Attempts: 3, Backoff: time.Millisecond},
+	}
+	require.NoError(t, runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"}))
+	assert.Equal(t, "run --pull=never myimage\n", outbuff.String())
+	assert.Equal(t, "Error: connection reset by peer\n", errbuff.String())
+	pulls, _ := os.ReadFile(count)
+	assert.Equal(t, "2\n", string(pulls))
+}
+
+func TestRunImagePullFails(t *testing.T) {
+	podman, _ := fakePodman(t, 5)
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := &atk.CliModuleRunner{
+		PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman}),
+		Pull:                    &atk.PullOptions{Attempts: 2, Backoff: time.Millisecond},
+	}
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"})
+	var pullErr *atk.ImagePullError
+	require.ErrorAs(t, err, &pullErr)
+	assert.Equal(t, 2, pullErr.Attempts)
+	assert.Contains(t, err.Error(), "could not pull image myimage after 2 attempts")
+	assert.Contains(t, err.Error(), "connection reset by peer")
+	assert.Empty(t, outbuff.String())
+	assert.True(t, runCtx.IsErrored())
+}
+
+func TestRunImagePullNever(t *testing.T) {
+	podman, count := fakePodman(t, 5)
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := &atk.CliModuleRunner{
+		PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman}),
+		Pull:                    &atk.PullOptions{Policy: atk.PullNever},
+	}
+	require.NoError(t, runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"}))
+	assert.Equal(t, "run --pull=never myimage\n", outbuff.String())
+	assert.NoFileExists(t, count)
+}
@@ -0,0 +1,147 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetState(t *testing.T) {
+	runner := atktest.NewFakeRunner().On("mymodule-get-state", atktest.Response{Out: atktest.StateResponse("DEPLOYED")})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	state, err := deployment.GetState(runCtx)
+	require.NoError(t, err)
+	assert.True(t, state.IsDeployed())
+	assert.Equal(t, atk.Deployed, state.State())
+}
+
+func TestDeployWaitsForGetState(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Readiness = &atk.ReadinessInfo{Interval: "10ms", Timeout: "5s"}
+	// The first response is the state before the deployment, when nothing
+	// has been deployed yet.
+	runner := atktest.NewFakeRunner().OnSequence("mymodule-get-state",
+		atktest.Response{ExitCode: 4},
+		atktest.Response{ExitCode: 4},
+		atktest.Response{Out: atktest.StateResponse("DEPLOYING")},
+		atktest.Response{Out: atktest.StateResponse("DEPLOYED")})
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	result, err := deployment.Deploy(runCtx)
+
+	require.NoError(t, err)
+	assert.True(t, result.Succeeded())
+	atktest.AssertRunOrder(t, runner, "mymodule-get-state", "mymodule-list", "mymodule-validate", "mymodule-pre-deploy", "mymodule-deploy", "mymodule-get-state", "mymodule-get-state", "mymodule-get-state", "mymodule-post-deploy")
+}
+
+func TestDeployNotReady(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Readiness = &atk.ReadinessInfo{Interval: "10ms", Timeout: "50ms"}
+	runner := atktest.NewFakeRunner().On("mymodule-get-state", atktest.Response{Out: atktest.StateResponse("DEPLOYING")})
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	result, err := deployment.Deploy(runCtx)
+
+	var notReady *atk.NotReadyError
+	require.ErrorAs(t, err, &notReady)
+	assert.Contains(t, notReady.Error(), "DEPLOYING")
+	assert.Equal(t, atk.Deploying, result.FailedState)
+	assert.NotContains(t, runner.Images(), "mymodule-post-deploy")
+}
+
+func TestDeployWaitsForHTTPProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle.Deploy.Scanners = []atk.ScannerInfo{{Pattern: "url=(.*)", Output: "url"}}
+	module.Specifications.Readiness = &atk.ReadinessInfo{HTTPGet: "${url}/healthz", Interval: "10ms", Timeout: "5s"}
+	runner := atktest.NewFakeRunner().On("mymodule-deploy", atktest.Response{Out: "url=" + server.URL + "\n"})
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	_, err := deployment.Deploy(runCtx)
+	assert.NoError(t, err)
+}
+
+func TestDeployTCPProbeNotReady(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Readiness = &atk.ReadinessInfo{TCPSocket: address, Interval: "10ms", Timeout: "50ms"}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(atktest.NewFakeRunner()))
+	_, err = deployment.Deploy(runCtx)
+
+	var notReady *atk.NotReadyError
+	assert.ErrorAs(t, err, &notReady)
+}
+
+func TestLintReadiness(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Readiness = &atk.ReadinessInfo{Timeout: "soon"}
+
+	found := false
+	for _, f := range atk.Lint(module) {
+		if f.RuleID == "ATK011" {
+			found = true
+			assert.Equal(t, "spec.readiness", f.Path)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestWaitForState(t *testing.T) {
+	runner := atktest.NewFakeRunner().OnSequence("mymodule-get-state",
+		atktest.Response{Out: atktest.StateResponse("DEPLOYING")},
+		atktest.Response{ExitCode: 1},
+		atktest.Response{Out: atktest.StateResponse("DEPLOYED")})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	state, err := deployment.WaitForState(runCtx, atk.Deployed, 10*time.Millisecond, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, atk.Deployed, state.State())
+	assert.Len(t, runner.Calls(), 3)
+}
+
+func TestWaitForStateTimeout(t *testing.T) {
+	runner := atktest.NewFakeRunner().On("mymodule-get-state", atktest.Response{Out: atktest.StateResponse("DEPLOYING")})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	_, err := deployment.WaitForState(runCtx, atk.Deployed, 10*time.Millisecond, 50*time.Millisecond)
+	var waitErr *atk.WaitForStateError
+	require.ErrorAs(t, err, &waitErr)
+	assert.Equal(t, atk.State("deploying"), waitErr.Last)
+	assert.Equal(t, atk.Deployed, waitErr.Desired)
+}
+
+func TestWaitForStateCancelled(t *testing.T) {
+	runner := atktest.NewFakeRunner().On("mymodule-get-state", atktest.Response{Out: atktest.StateResponse("DEPLOYING")})
+	runCtx, _, _, _ := newTestRunContext()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runCtx.Context = ctx
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	_, err := deployment.WaitForState(runCtx, atk.Deployed, 10*time.Millisecond, time.Minute)
+	assert.ErrorIs(t, err, context.Canceled)
+}
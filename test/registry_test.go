@@ -0,0 +1,78 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRegistryServer(t *testing.T, downloads *int32) *httptest.Server {
+	manifest, err := atktest.Manifest("storage").Marshal()
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/modules", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page := map[string]interface{}{
+			"modules":  []atk.RegistryModule{{Namespace: "atktest", Name: "storage"}},
+			"nextPage": "2",
+		}
+		if r.URL.Query().Get("pageToken") == "2" {
+			page = map[string]interface{}{"modules": []atk.RegistryModule{{Namespace: "atktest", Name: "network"}}}
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	mux.HandleFunc("/modules/atktest/storage/manifest", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(downloads, 1)
+		w.Write(manifest)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRegistryListModules(t *testing.T) {
+	var downloads int32
+	server := newRegistryServer(t, &downloads)
+
+	modules, err := atk.NewRegistryClient(server.URL, "secret").ListModules(context.Background())
+	require.NoError(t, err)
+	require.Len(t, modules, 2)
+	assert.Equal(t, "network", modules[1].Name)
+
+	_, err = atk.NewRegistryClient(server.URL, "wrong").ListModules(context.Background())
+	var regErr *atk.RegistryError
+	require.ErrorAs(t, err, &regErr)
+	assert.Equal(t, http.StatusUnauthorized, regErr.StatusCode)
+}
+
+func TestRegistryGetManifestCached(t *testing.T) {
+	var downloads int32
+	server := newRegistryServer(t, &downloads)
+	client := atk.NewRegistryClient(server.URL, "secret")
+
+	for i := 0; i < 2; i++ {
+		module, err := client.GetManifest(context.Background(), "atktest", "storage")
+		require.NoError(t, err)
+		assert.Equal(t, "storage", module.Metadata.Name)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&downloads))
+
+	_, err := client.GetManifest(context.Background(), "atktest", "missing")
+	assert.Error(t, err)
+}
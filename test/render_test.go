@@ -0,0 +1,69 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func renderResult() *atk.DeploymentResult {
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return &atk.DeploymentResult{
+		Module:      "render",
+		State:       atk.Errored,
+		FailedState: atk.Deploying,
+		Error:       "exit status 1",
+		StartedAt:   started,
+		FinishedAt:  started.Add(95 * time.Second),
+		Stages: []atk.StageTiming{
+			{State: atk.PreDeploying, Duration: 5 * time.Second},
+			{State: atk.Deploying, Duration: 90 * time.Second},
+		},
+		Outputs: map[string]string{"console_url": "https://console.example.com"},
+	}
+}
+
+func TestDeploymentResultSummaryText(t *testing.T) {
+	assert.Equal(t, strings.Join([]string{
+		"module render: errored in 1m35s",
+		"STATE         DURATION  STATUS",
+		"predeploying  5s        ok",
+		"deploying     1m30s     failed",
+		"error: exit status 1",
+		"output console_url: https://console.example.com",
+		"",
+	}, "\n"), renderResult().Summary().String())
+}
+
+func TestDeploymentResultSummaryMarkdown(t *testing.T) {
+	assert.Equal(t, strings.Join([]string{
+		"**module render: errored in 1m35s**",
+		"",
+		"| state | duration | status |",
+		"|---|---|---|",
+		"| predeploying | 5s | ok |",
+		"| deploying | 1m30s | failed |",
+		"",
+		"- error: exit status 1",
+		"- output console\\_url: https://console.example.com",
+		"",
+	}, "\n"), renderResult().Summary().Markdown())
+}
+
+func TestPlanSummary(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	module := atktest.Manifest("render")
+	module.Specifications.Lifecycle.Deploy.Args = []string{"apply", "-var", "a|b"}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(atktest.NewFakeRunner()))
+
+	summary := deployment.Plan().Summary()
+	text := summary.String()
+	assert.Contains(t, text, "NAME         STATE          IMAGE               COMMAND\n")
+	assert.Contains(t, text, "deploy       deploying      render-deploy       apply -var a|b\n")
+	assert.Contains(t, text, "list         hook           render-list\n")
+	assert.Contains(t, summary.Markdown(), "| deploy | deploying | render-deploy | apply -var a\\|b |\n")
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ownershipRunner is a fake runner that records the changes of the owner of
+// the workspace.
+type ownershipRunner struct {
+	*atktest.FakeRunner
+	owners []string
+}
+
+func (r *ownershipRunner) FixOwnership(ctx *atk.RunContext, dir string, uid int) error {
+	r.owners = append(r.owners, fmt.Sprintf("%s %d", filepath.Base(dir), uid))
+	return nil
+}
+
+func TestEphemeralUserRunsStages(t *testing.T) {
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runCtx.Context = context.Background()
+	module := atktest.Manifest("ephemeral")
+	module.Specifications.Hooks = atk.HookInfo{}
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithEphemeralUser())
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(outbuff.String(), "--user=10001:0"))
+}
+
+func TestEphemeralUserDoesNotApplyToHooks(t *testing.T) {
+	out := hookCommand(t, atktest.Manifest("ephemeral"), atk.WithRunAsUser(2000))
+	assert.NotContains(t, out, "--user")
+}
+
+func TestEphemeralUserFixesOwnership(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	module := atktest.Manifest("ephemeral")
+	module.Specifications.Hooks = atk.HookInfo{}
+	runner := &ownershipRunner{FakeRunner: atktest.NewFakeRunner()}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithWorkspaceRoot(t.TempDir()), atk.WithRunAsUser(2000))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ephemeral 2000", "ephemeral 0", "ephemeral 2000", "ephemeral 0", "ephemeral 2000", "ephemeral 0"}, runner.owners)
+}
+
+func TestWithoutRunAsUserKeepsOwnership(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	module := atktest.Manifest("ephemeral")
+	module.Specifications.Hooks = atk.HookInfo{}
+	runner := &ownershipRunner{FakeRunner: atktest.NewFakeRunner()}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithWorkspaceRoot(t.TempDir()))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Empty(t, runner.owners)
+}
+
+func TestFixOwnershipWithHelperContainer(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	podman := writeScript(t, dir, "podman", "echo \"$@\" > "+args+"\n")
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman, Connection: "remote", Platform: atk.PlatformLinux})}
+	runCtx, _, _, _ := newTestRunContext()
+
+	require.NoError(t, runner.FixOwnership(runCtx, "/home/me/workspace", 0))
+	content, err := os.ReadFile(args)
+	require.NoError(t, err)
+	assert.Equal(t, "--connection remote run --rm --user=0:0 --network=none -v /home/me/workspace:/workspace:Z "+atk.DefaultHelperImage+" chown -R 0:0 /workspace\n", string(content))
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	logger "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunContextChild(t *testing.T) {
+	runCtx, outbuff, errbuff, hook := newTestRunContext()
+	runCtx.RunID = "test-run"
+
+	child := runCtx.Child("deploying")
+	fmt.Fprint(child.Out, "hello")
+	fmt.Fprint(child.Err, "oops")
+	child.AddError(errors.New("stage failed"))
+	child.SetLastErrCode(2)
+	child.Logger().Info("from the child")
+
+	assert.Equal(t, "hello", outbuff.String())
+	assert.Equal(t, "oops", errbuff.String())
+	assert.Equal(t, "hello", child.Stdout())
+	assert.Empty(t, runCtx.Errors)
+	assert.Equal(t, 0, runCtx.LastErrCode)
+	assert.True(t, runCtx.IsErrored())
+	assert.Len(t, runCtx.AllErrors(), 1)
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, "deploying", entry.Data[atk.StageLogField])
+	assert.Equal(t, "test-run", entry.Data[atk.RunIDLogField])
+
+	summary := runCtx.Summary()
+	require.Len(t, summary.Children, 1)
+	assert.Equal(t, "deploying", summary.Children[0].Stage)
+	assert.Equal(t, 2, summary.Children[0].LastErrCode)
+	assert.Equal(t, "oops", summary.Children[0].Stderr)
+	require.Len(t, summary.Failed(), 1)
+	assert.Equal(t, "deploying", summary.Failed()[0].Stage)
+}
+
+func TestDeployRunsStagesInChildContexts(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-pre-deploy", atktest.Response{Out: "pre\n"}).
+		On("mymodule-deploy", atktest.Response{Err: "deploy failed\n", ExitCode: 1})
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+	_, err := deployment.Deploy(runCtx)
+	require.Error(t, err)
+
+	assert.True(t, runCtx.IsErrored())
+	stages := make(map[string]atk.RunSummary)
+	for _, child := range runCtx.Summary().Children {
+		stages[child.Stage] = child
+	}
+	assert.Equal(t, "pre\n", stages[string(atk.PreDeploying)].Stdout)
+	assert.Empty(t, stages[string(atk.PreDeploying)].Errors)
+	failed := runCtx.Summary().Failed()
+	require.Len(t, failed, 1)
+	assert.Equal(t, string(atk.Deploying), failed[0].Stage)
+	assert.Equal(t, "deploy failed\n", failed[0].Stderr)
+}
+
+func TestDeployableModuleSharesRunContext(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(atktest.NewFakeRunner()))
+
+	deployment.NotifyErr(atk.Errored, errors.New("failed"))
+	assert.Len(t, runCtx.Errors, 1)
+}
+
+func TestNewRunContextDefaults(t *testing.T) {
+	runCtx, err := atk.NewRunContext()
+	require.NoError(t, err)
+	assert.Equal(t, context.Background(), runCtx.Context)
+	assert.Same(t, os.Stdout, runCtx.Out)
+	assert.Same(t, os.Stderr, runCtx.Err)
+	assert.Nil(t, runCtx.In)
+	assert.Same(t, os.Stderr, runCtx.Log.Out)
+	assert.Equal(t, logger.InfoLevel, runCtx.Log.Level)
+	assert.NoError(t, runCtx.Validate())
+}
+
+func TestNewRunContextOptions(t *testing.T) {
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ctxOut := &bytes.Buffer{}
+	log := logger.New()
+	log.Out = errOut
+	ctx := atk.WithStdOut(context.Background(), ctxOut)
+
+	runCtx, err := atk.NewRunContext(atk.WithContext(ctx), atk.WithOut(out), atk.WithErr(errOut), atk.WithLog(log), atk.WithVerbosity(atk.VerbosityDebug))
+	require.NoError(t, err)
+	assert.Equal(t, ctx, runCtx.Context)
+	assert.Same(t, out, runCtx.Out)
+	assert.Same(t, errOut, runCtx.Err)
+	assert.Same(t, errOut, runCtx.Log.Out)
+	assert.Equal(t, atk.VerbosityDebug, runCtx.Verbosity)
+
+	runCtx, err = atk.NewRunContext(atk.WithContext(ctx))
+	require.NoError(t, err)
+	assert.Same(t, ctxOut, runCtx.Out)
+}
+
+func TestNewRunContextInvalid(t *testing.T) {
+	_, err := atk.NewRunContext(atk.WithContext(nil), atk.WithVerbosity(atk.Verbosity(5)))
+	assert.EqualError(t, err, "invalid run context: the context is not set; unknown verbosity 5")
+}
+
+func TestZeroRunContextRunsImage(t *testing.T) {
+	runCtx := &atk.RunContext{}
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "true"})}
+	assert.NoError(t, runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"}))
+	assert.Error(t, runCtx.Validate())
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hookCommand returns the command line of the list hook, which echo, standing
+// in for podman, writes as the output of the hook.
+func hookCommand(t *testing.T, module *atk.ModuleInfo, opts ...atk.DeployableModuleOption) string {
+	runCtx, _, _, _ := newTestRunContext()
+	runCtx.Context = context.Background()
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	deployment := atk.NewDeployableModule(runCtx, module, append(opts, atk.WithRunner(runner))...)
+
+	_, err := deployment.List(runCtx)
+	var hookErr *atk.HookOutputError
+	require.ErrorAs(t, err, &hookErr)
+	return string(hookErr.Output)
+}
+
+func TestHookSandboxDefaults(t *testing.T) {
+	out := hookCommand(t, atktest.Manifest("sandboxed"))
+	assert.Contains(t, out, "--read-only --network=none --cap-drop=all --security-opt=no-new-privileges")
+}
+
+func TestHookSandboxFromManifest(t *testing.T) {
+	module := atktest.Manifest("sandboxed")
+	module.Specifications.Hooks.List.Sandbox = &atk.SandboxInfo{Network: "host", Writable: true, Capabilities: []string{"net_raw"}}
+	out := hookCommand(t, module)
+	assert.NotContains(t, out, "--read-only")
+	assert.Contains(t, out, "--network=host --cap-drop=all --cap-add=NET_RAW --security-opt=no-new-privileges")
+}
+
+func TestWithoutHookSandbox(t *testing.T) {
+	out := hookCommand(t, atktest.Manifest("sandboxed"), atk.WithoutHookSandbox())
+	assert.NotContains(t, out, "--read-only")
+	assert.NotContains(t, out, "--network")
+}
+
+func TestStagesAreNotSandboxed(t *testing.T) {
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runCtx.Context = context.Background()
+	module := atktest.Manifest("sandboxed")
+	module.Specifications.Hooks = atk.HookInfo{}
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Contains(t, outbuff.String(), "sandboxed-deploy")
+	assert.NotContains(t, outbuff.String(), "--read-only")
+}
@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewModuleScaffoldDefaults(t *testing.T) {
+	module := atk.NewModuleScaffold("mymodule")
+
+	assert.True(t, module.IsSupported())
+	assert.Equal(t, "mymodule", module.Metadata.Name)
+	assert.Equal(t, atk.DefaultScaffoldImage, module.Specifications.Hooks.List.Image)
+	assert.Equal(t, atk.DefaultScaffoldImage, module.Specifications.Lifecycle.PostDeploy.Image)
+	assert.Equal(t, "/workspace", module.Specifications.Lifecycle.Deploy.Volumes[0].MountPath)
+}
+
+func TestNewModuleScaffoldImages(t *testing.T) {
+	module := atk.NewModuleScaffold("mymodule", "lister", "validator", "stater", "deployer")
+
+	assert.Equal(t, "lister", module.Specifications.Hooks.List.Image)
+	assert.Equal(t, "validator", module.Specifications.Hooks.Validate.Image)
+	assert.Equal(t, "stater", module.Specifications.Hooks.GetState.Image)
+	assert.Equal(t, "deployer", module.Specifications.Lifecycle.PreDeploy.Image)
+	assert.Equal(t, "deployer", module.Specifications.Lifecycle.Deploy.Image)
+	assert.Equal(t, "deployer", module.Specifications.Lifecycle.PostDeploy.Image)
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScannersExtractOutputsAndProgress(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle.Deploy.Scanners = []atk.ScannerInfo{
+		{Pattern: `console_url = "(?P<value>[^"]+)"`, Output: "console_url"},
+		{Pattern: `Apply complete!`, Progress: 50},
+		{Path: "$.data.cluster.name", Output: "cluster"},
+		{Pattern: `^region: (\S+)`, Stream: atk.Stderr, Output: "region"},
+	}
+	runner := atktest.NewFakeRunner().On("mymodule-deploy", atktest.Response{
+		Out: "Apply complete!\nconsole_url = \"https://console.example.com\"\n{\"data\":{\"cluster\":{\"name\":\"mycluster\"}}}\nregion: stdout\n",
+		Err: "region: us-south\n",
+	})
+
+	var deploying []float64
+	reporter := atk.ProgressFunc(func(p atk.Progress) {
+		if p.State == atk.Deploying {
+			deploying = append(deploying, p.Percent)
+		}
+	})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithProgressReporter(reporter))
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"console_url": "https://console.example.com",
+		"cluster":     "mycluster",
+		"region":      "us-south",
+	}, deployment.Outputs())
+	require.Len(t, deploying, 2)
+	assert.Greater(t, deploying[1], deploying[0])
+}
+
+func TestScannerFailsStage(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle.Deploy.Scanners = []atk.ScannerInfo{
+		{Pattern: `Error acquiring the state lock`, State: atk.Errored},
+	}
+	runner := atktest.NewFakeRunner().On("mymodule-deploy", atktest.Response{Err: "Error acquiring the state lock\n"})
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	result, err := deployment.Deploy(runCtx)
+
+	var matched *atk.ScannerMatchError
+	require.ErrorAs(t, err, &matched)
+	assert.Equal(t, atk.Deploying, result.FailedState)
+}
+
+func TestScannerCompletesStageEarly(t *testing.T) {
+	dir := t.TempDir()
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle = atk.LifecycleInfo{
+		PreDeploy: atk.ImageInfo{Script: writeScript(t, dir, "pre.sh", "exit 0\n")},
+		Deploy: atk.ImageInfo{
+			Script:   writeScript(t, dir, "deploy.sh", "echo 'server started'\nexec sleep 30\n"),
+			Scanners: []atk.ScannerInfo{{Pattern: "server started", State: atk.Deployed}},
+		},
+		PostDeploy: atk.ImageInfo{Script: writeScript(t, dir, "post.sh", "exit 0\n")},
+	}
+	module.Specifications.Hooks = atk.HookInfo{}
+
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(atk.NewLocalModuleRunner(t.TempDir())))
+	result, err := deployment.Deploy(runCtx)
+
+	require.NoError(t, err)
+	assert.True(t, result.Succeeded())
+	assert.False(t, runCtx.IsErrored())
+}
+
+func TestLintScanners(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Lifecycle.Deploy.Scanners = []atk.ScannerInfo{
+		{Pattern: `(`},
+	}
+	module.Specifications.Lifecycle.PreDeploy.Scanners = []atk.ScannerInfo{
+		{Pattern: "done", State: atk.Deployed},
+	}
+	module.Specifications.Hooks.List.Scanners = []atk.ScannerInfo{{Pattern: "x"}}
+
+	paths := make(map[string]string)
+	for _, f := range atk.Lint(module) {
+		if strings.HasSuffix(f.Path, ".scanners") {
+			paths[f.Path] = f.RuleID
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"spec.lifecycle.deploy.scanners":     "ATK009",
+		"spec.lifecycle.pre_deploy.scanners": "ATK009",
+		"spec.hooks.list.scanners":           "ATK010",
+	}, paths)
+}
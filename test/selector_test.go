@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"tier": "demo", "cloud": "aws", "region": "us-east"}
+	tests := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"tier=demo", true},
+		{"tier==demo,cloud=aws", true},
+		{"tier=demo,cloud=azure", false},
+		{"cloud!=azure", true},
+		{"owner!=me", true},
+		{"region in (us-south, us-east)", true},
+		{"region notin (us-east)", false},
+		{"tier", true},
+		{"!deprecated", true},
+		{"!tier", false},
+		{"cloud in (aws,azure),tier=demo", true},
+	}
+	for _, test := range tests {
+		selector, err := atk.ParseSelector(test.selector)
+		require.NoError(t, err, test.selector)
+		assert.Equal(t, test.matches, selector.Matches(labels), test.selector)
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, selector := range []string{"tier=a=b", "region in us-east", "region within (a)", "region in ()", "=demo"} {
+		_, err := atk.ParseSelector(selector)
+		assert.Error(t, err, selector)
+	}
+
+	selector, err := atk.ParseSelector("region in (b,a), !old")
+	require.NoError(t, err)
+	assert.Equal(t, "region in (a,b),!old", selector.String())
+}
+
+func TestFilterModules(t *testing.T) {
+	demo := atktest.Manifest("demo")
+	demo.Metadata.Labels = map[string]string{"tier": "demo"}
+	prod := atktest.Manifest("prod")
+	prod.Metadata.Labels = map[string]string{"tier": "prod"}
+
+	selector, err := atk.ParseSelector("tier=demo")
+	require.NoError(t, err)
+	assert.Equal(t, []*atk.ModuleInfo{demo}, atk.Filter([]*atk.ModuleInfo{demo, prod, atktest.Manifest("other")}, selector))
+
+	index := &atk.CatalogIndex{Modules: []atk.CatalogEntry{{Name: "demo", Labels: demo.Metadata.Labels}, {Name: "prod", Labels: prod.Metadata.Labels}}}
+	assert.Equal(t, "demo", index.Select(selector)[0].Name)
+}
@@ -0,0 +1,174 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev:6443
+users:
+- name: dev
+  user:
+    token: dev
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+`
+
+// deployedKubeconfig is testKubeconfig after the module logged in to its
+// cluster.
+const deployedKubeconfig = `apiVersion: v1
+kind: Config
+current-context: snapshot
+clusters:
+- name: dev
+  cluster:
+    server: https://dev:6443
+- name: snapshot
+  cluster:
+    server: https://snapshot:6443
+users:
+- name: dev
+  user:
+    token: dev
+- name: snapshot
+  user:
+    token: snapshot
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+- name: snapshot
+  context:
+    cluster: snapshot
+    user: snapshot
+`
+
+// snapshotRunner stands in for the stages of a module that leave files in
+// the workspace, a context in the kubeconfig and named volumes behind, while
+// another process creates a volume of its own.
+type snapshotRunner struct {
+	kubeconfig string
+	// volumes are the names of the volumes and their RunIDLabel.
+	volumes map[string]string
+	removed []string
+}
+
+func (r *snapshotRunner) RunImage(ctx *atk.RunContext, info atk.ImageInfo) error {
+	if info.Image != "snapshot-deploy" {
+		return nil
+	}
+	for _, v := range info.Volumes {
+		if v.MountPath == "/workspace" {
+			if err := os.MkdirAll(filepath.Join(v.Name, ".terraform", "providers"), 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(v.Name, "terraform.tfstate"), []byte("{}"), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	runID := ""
+	for _, e := range info.EnvVars {
+		if e.Name == atk.RunIDEnvVar {
+			runID = e.Value
+		}
+	}
+	r.volumes["snapshot-data-"+runID] = ""
+	r.volumes["snapshot-cache"] = runID
+	r.volumes["other-process"] = "other-run"
+	return os.WriteFile(r.kubeconfig, []byte(deployedKubeconfig), 0600)
+}
+
+func (r *snapshotRunner) Volumes(ctx *atk.RunContext, runID string) ([]string, error) {
+	var names []string
+	for name, label := range r.volumes {
+		if label == runID || strings.Contains(name, runID) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (r *snapshotRunner) RemoveVolume(ctx *atk.RunContext, name string) error {
+	r.removed = append(r.removed, name)
+	return nil
+}
+
+func TestEnvironmentSnapshotUndo(t *testing.T) {
+	root := t.TempDir()
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600))
+	t.Setenv("KUBECONFIG", kubeconfig)
+
+	module := atktest.Manifest("snapshot")
+	module.Specifications.Hooks = atk.HookInfo{}
+	workspace, err := atk.ModuleWorkspace(root, module)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(workspace, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "main.tf"), []byte(""), 0644))
+
+	runner := &snapshotRunner{kubeconfig: kubeconfig, volumes: map[string]string{"unrelated": ""}}
+	runCtx, _, _, _ := newTestRunContext()
+	history := atk.NewHistoryStore(t.TempDir())
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner),
+		atk.WithWorkspaceRoot(root), atk.WithEnvironmentSnapshot(), atk.WithHistory(history))
+
+	result, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	require.NotNil(t, result.Changes)
+	recorded, err := history.Last(module)
+	require.NoError(t, err)
+	assert.Equal(t, result.Changes, recorded.Changes)
+	assert.Equal(t, []string{filepath.Join(workspace, ".terraform"), filepath.Join(workspace, "terraform.tfstate")}, result.Changes.Files)
+	assert.Equal(t, []string{kubeconfig + "#snapshot"}, result.Changes.KubeContexts)
+	assert.Equal(t, []string{kubeconfig + "#snapshot"}, result.Changes.KubeClusters)
+	assert.Equal(t, []string{kubeconfig + "#snapshot"}, result.Changes.KubeUsers)
+	data := "snapshot-data-" + deployment.RunID()
+	assert.Equal(t, []string{"snapshot-cache", data}, result.Changes.Volumes)
+
+	require.NoError(t, deployment.Undo(runCtx))
+	assert.NoFileExists(t, filepath.Join(workspace, "terraform.tfstate"))
+	assert.NoDirExists(t, filepath.Join(workspace, ".terraform"))
+	assert.FileExists(t, filepath.Join(workspace, "main.tf"))
+	content, err := os.ReadFile(kubeconfig)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "current-context: dev")
+	assert.Contains(t, string(content), "name: dev")
+	assert.NotContains(t, string(content), "snapshot")
+	assert.Contains(t, string(content), "server: https://dev:6443")
+	assert.ElementsMatch(t, []string{"snapshot-cache", data}, runner.removed)
+	assert.True(t, deployment.Changes().IsEmpty())
+}
+
+func TestUndoWithoutSnapshot(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("snapshot"), atk.WithRunner(atktest.NewFakeRunner()))
+	assert.Error(t, deployment.Undo(runCtx))
+}
+
+func TestVolumesOfRun(t *testing.T) {
+	podman := writeScript(t, t.TempDir(), "podman", "printf 'data-run1 \\nmine run1\\nother other\\nunlabelled \\n'\n")
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: podman})}
+	runCtx, _, _, _ := newTestRunContext()
+
+	names, err := runner.Volumes(runCtx, "run1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data-run1", "mine"}, names)
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolBufferInMemory(t *testing.T) {
+	buf := atk.NewSpoolBuffer(64)
+	buf.HeadTailSize = 4
+	_, err := buf.Write([]byte("hello world"))
+	require.NoError(t, err)
+
+	assert.False(t, buf.Spilled())
+	assert.Equal(t, int64(11), buf.Len())
+	assert.Equal(t, "hello world", buf.String())
+	assert.Equal(t, "hell", string(buf.Head()))
+	assert.Equal(t, "orld", string(buf.Tail()))
+	assert.NoError(t, buf.Close())
+}
+
+func TestSpoolBufferSpillsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	buf := atk.NewSpoolBuffer(16)
+	buf.Dir = dir
+	buf.HeadTailSize = 8
+
+	content := ""
+	for i := 0; i < 10; i++ {
+		line := strings.Repeat(string(rune('a'+i)), 5) + "\n"
+		content += line
+		_, err := buf.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	assert.True(t, buf.Spilled())
+	assert.Equal(t, int64(len(content)), buf.Len())
+	assert.Equal(t, content[:8], string(buf.Head()))
+	assert.Equal(t, content[len(content)-8:], string(buf.Tail()))
+
+	r, err := buf.Reader()
+	require.NoError(t, err)
+	all, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, content, string(all))
+
+	require.NoError(t, buf.Close())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Equal(t, content[:8], string(buf.Head()))
+}
+
+func TestDeployCapturesStageOutput(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-deploy", atktest.Response{Out: strings.Repeat("deploying\n", 100), Err: "warning\n"})
+
+	runCtx, outbuff, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner), atk.WithCapturedOutput(64))
+	defer deployment.CloseOutputs()
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	output := deployment.Output(atk.Deploying)
+	require.NotNil(t, output)
+	assert.True(t, output.Stdout.Spilled())
+	assert.Equal(t, strings.Repeat("deploying\n", 100), output.Stdout.String())
+	assert.Equal(t, "warning\n", output.Stderr.String())
+	assert.Contains(t, outbuff.String(), "deploying\n")
+	assert.Nil(t, deployment.Output(atk.Deployed))
+}
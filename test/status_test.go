@@ -0,0 +1,63 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStatusConditions(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Metadata.Generation = 3
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(atktest.NewFakeRunner()))
+
+	status := deployment.Status()
+	assert.Equal(t, atk.ConditionUnknown, status.Condition(atk.ConditionValidated).Status)
+	assert.Equal(t, atk.ConditionUnknown, status.Condition(atk.ConditionReady).Status)
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	status = deployment.Status()
+	assert.Equal(t, "mymodule", status.Module)
+	assert.Equal(t, int64(3), status.ObservedGeneration)
+	assert.Equal(t, atk.Done, status.State)
+	for _, c := range []atk.ConditionType{atk.ConditionValidated, atk.ConditionDeployed, atk.ConditionReady} {
+		assert.True(t, status.IsTrue(c), "condition %s", c)
+		assert.False(t, status.Condition(c).LastTransitionTime.IsZero())
+	}
+	validated := status.Condition(atk.ConditionValidated).LastTransitionTime
+	assert.False(t, status.Condition(atk.ConditionReady).LastTransitionTime.Before(validated))
+
+	content, err := yaml.Marshal(status)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "observedGeneration: 3")
+	assert.Contains(t, string(content), "type: Ready")
+
+	manifest, err := module.Marshal()
+	require.NoError(t, err)
+	assert.Contains(t, string(manifest), "  generation: 3\n")
+}
+
+func TestStatusFailedDeploy(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	runner.On("mymodule-deploy", atktest.Response{Err: "no quota", ExitCode: 1})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	_, err := deployment.Deploy(runCtx)
+	require.Error(t, err)
+
+	status := deployment.Status()
+	assert.True(t, status.IsTrue(atk.ConditionValidated))
+	deployed := status.Condition(atk.ConditionDeployed)
+	assert.Equal(t, atk.ConditionFalse, deployed.Status)
+	assert.Equal(t, "DeployFailed", deployed.Reason)
+	assert.NotEmpty(t, deployed.Message)
+	assert.Equal(t, atk.ConditionFalse, status.Condition(atk.ConditionReady).Status)
+}
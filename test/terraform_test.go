@@ -0,0 +1,71 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var terraformVars = atk.EventData{Variables: []atk.EventDataVarInfo{
+	{Name: "TF_VAR_region", Value: "us-east"},
+	{Name: "cluster_name", Default: "dev"},
+	{Name: "fyre_root_password", Value: "hunter2"},
+	{Name: "TF_VAR_unset"},
+}}
+
+func TestTerraformEnv(t *testing.T) {
+	assert.Equal(t, []atk.EnvVarInfo{
+		{Name: "TF_VAR_region", Value: "us-east"},
+		{Name: "TF_VAR_cluster_name", Value: "dev"},
+		{Name: "TF_VAR_fyre_root_password", Value: "hunter2"},
+	}, atk.TerraformEnv(terraformVars))
+}
+
+func TestWriteTerraformVarFile(t *testing.T) {
+	path, err := atk.WriteTerraformVarFile(t.TempDir(), terraformVars)
+	require.NoError(t, err)
+	assert.Equal(t, atk.TerraformVarFile, filepath.Base(path))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var values map[string]string
+	require.NoError(t, json.Unmarshal(content, &values))
+	assert.Equal(t, map[string]string{"region": "us-east", "cluster_name": "dev", "fyre_root_password": "hunter2"}, values)
+}
+
+func TestIsSensitiveVariable(t *testing.T) {
+	assert.True(t, atk.IsSensitiveVariable(atk.EventDataVarInfo{Name: "TF_VAR_fyre_api_key"}))
+	assert.True(t, atk.IsSensitiveVariable(atk.EventDataVarInfo{Name: "pin", Sensitive: true}))
+	assert.False(t, atk.IsSensitiveVariable(atk.EventDataVarInfo{Name: "TF_VAR_region"}))
+}
+
+func TestWithTerraformVariables(t *testing.T) {
+	module := atktest.Manifest("mymodule")
+	module.Specifications.Hooks = atk.HookInfo{}
+	root := t.TempDir()
+	runCtx, _, _, hook := newTestRunContext()
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithWorkspaceRoot(root),
+		atk.WithTerraformVariables(), atk.WithVariables(terraformVars.Variables...))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	logged := false
+	for _, entry := range hook.AllEntries() {
+		assert.NotContains(t, entry.Message, "hunter2")
+		logged = logged || strings.Contains(entry.Message, "TF_VAR_fyre_root_password="+atk.MaskedValue)
+	}
+	assert.True(t, logged)
+
+	workspace, err := atk.ModuleWorkspace(root, module)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(workspace, atk.TerraformVarFile))
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscriptDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "transcript")
+	runner := atktest.NewFakeRunner().
+		On("mymodule-deploy", atktest.Response{Out: "applying\n", Err: "warning: deprecated\n"})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner),
+		atk.WithRunID("run-1"), atk.WithTranscript(dir))
+
+	result, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Equal(t, dir, result.Transcript)
+
+	stdout, err := os.ReadFile(filepath.Join(dir, "stages", "deploying.stdout.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "applying\n", string(stdout))
+	stderr, err := os.ReadFile(filepath.Join(dir, "stages", "deploying.stderr.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "warning: deprecated\n", string(stderr))
+	assert.FileExists(t, filepath.Join(dir, "stages", "predeploying.stdout.log"))
+
+	manifest, err := atk.NewAtkManifestFileLoader().Load(filepath.Join(dir, atk.TranscriptManifestFile))
+	require.NoError(t, err)
+	assert.Equal(t, "mymodule", manifest.Metadata.Name)
+
+	content, err := os.ReadFile(filepath.Join(dir, atk.TranscriptResultFile))
+	require.NoError(t, err)
+	var written atk.DeploymentResult
+	require.NoError(t, json.Unmarshal(content, &written))
+	assert.Equal(t, "run-1", written.RunID)
+	assert.Equal(t, atk.Done, written.State)
+
+	events, err := os.ReadFile(filepath.Join(dir, atk.TranscriptEventsFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(events), string(atk.StateChangedEvent))
+	assert.Contains(t, string(events), string(atk.ValidateHookRequestEvent))
+}
+
+func TestTranscriptTarGz(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.tar.gz")
+	runner := atktest.NewFakeRunner().On("mymodule-deploy", atktest.Response{Out: "applying\n"})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner), atk.WithTranscript(path))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = string(content)
+	}
+	assert.Equal(t, "applying\n", files["stages/deploying.stdout.log"])
+	assert.True(t, strings.HasPrefix(files[atk.TranscriptManifestFile], "apiVersion: itzcli/v1alpha1"))
+	assert.Contains(t, files, atk.TranscriptResultFile)
+	assert.Contains(t, files, atk.TranscriptEventsFile)
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictTransitionsDeploy(t *testing.T) {
+	module := atktest.Manifest("strict")
+	module.Specifications.Hooks = atk.HookInfo{}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(atktest.NewFakeRunner()), atk.WithStrictTransitions())
+
+	result, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Equal(t, atk.Done, result.State)
+}
+
+func TestStrictTransitionsRejectIllegal(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("strict"), atk.WithStrictTransitions())
+	assert.False(t, deployment.AllowsTransition(atk.Configured, atk.Deployed))
+
+	err := deployment.Notify(atk.Deployed)
+	var illegal *atk.IllegalTransitionError
+	require.ErrorAs(t, err, &illegal)
+	assert.Equal(t, atk.Invalid, illegal.From)
+	assert.Equal(t, atk.Deployed, illegal.To)
+	assert.Equal(t, atk.Errored, deployment.State())
+}
+
+func TestTransitionsNotStrict(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("lenient"))
+	assert.NoError(t, deployment.Notify(atk.Deployed))
+	assert.Equal(t, atk.Deployed, deployment.State())
+}
+
+func TestTransitionGuard(t *testing.T) {
+	module := atktest.Manifest("guarded")
+	module.Specifications.Hooks = atk.HookInfo{}
+	frozen := errors.New("deployments are frozen")
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner),
+		atk.WithTransitionGuard(func(from atk.State, to atk.State) error {
+			if to == atk.Deploying {
+				return frozen
+			}
+			return nil
+		}))
+
+	result, err := deployment.Deploy(runCtx)
+	assert.ErrorIs(t, err, frozen)
+	assert.Equal(t, atk.Errored, result.State)
+	atktest.AssertNotRan(t, runner, "guarded-deploy")
+}
+
+func TestTransitionsHistory(t *testing.T) {
+	module := atktest.Manifest("history")
+	module.Specifications.Hooks = atk.HookInfo{}
+	runner := atktest.NewFakeRunner().On("history-deploy", atktest.Response{ExitCode: 1})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner))
+	before := time.Now().UTC()
+
+	_, err := deployment.Deploy(runCtx)
+	require.Error(t, err)
+
+	transitions := deployment.Transitions()
+	var states []atk.State
+	for idx, tr := range transitions {
+		states = append(states, tr.To)
+		assert.False(t, tr.At.Before(before))
+		if idx > 0 {
+			assert.Equal(t, transitions[idx-1].To, tr.From)
+			assert.False(t, tr.At.Before(transitions[idx-1].At))
+		}
+	}
+	assert.Equal(t, []atk.State{atk.Initializing, atk.Configured, atk.Validated, atk.PreDeploying, atk.PreDeploying,
+		atk.PreDeployed, atk.Deploying, atk.Deploying, atk.Errored}, states)
+	assert.Equal(t, atk.Invalid, transitions[0].From)
+}
+
+func TestTransitionsHistoryRejected(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("strict"), atk.WithStrictTransitions())
+	require.Error(t, deployment.Notify(atk.Deployed))
+
+	transitions := deployment.Transitions()
+	require.Len(t, transitions, 2)
+	assert.Equal(t, atk.Deployed, transitions[0].To)
+	assert.True(t, transitions[0].Rejected)
+	assert.Contains(t, transitions[0].Error, "illegal transition from invalid to deployed")
+	assert.Equal(t, atk.Errored, transitions[1].To)
+	assert.False(t, transitions[1].Rejected)
+}
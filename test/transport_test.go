@@ -0,0 +1,126 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigProxy(t *testing.T) {
+	cfg := &atk.Config{Proxy: "proxy.example.com:3128", NoProxy: ".internal.example.com, registry.local:5000"}
+	require.NoError(t, cfg.Validate())
+	transport, err := cfg.Transport()
+	require.NoError(t, err)
+
+	for url, proxied := range map[string]bool{
+		"https://quay.io/v2/":                 true,
+		"https://api.internal.example.com/":   false,
+		"https://internal.example.com/":       false,
+		"https://registry.local:5000/modules": false,
+		"https://registry.local:443/modules":  true,
+		"http://localhost:8080/":              false,
+		"http://127.0.0.1:8080/":              false,
+	} {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		proxy, err := transport.Proxy(req)
+		require.NoError(t, err)
+		if proxied {
+			require.NotNil(t, proxy, url)
+			assert.Equal(t, "http://proxy.example.com:3128", proxy.String(), url)
+		} else {
+			assert.Nil(t, proxy, url)
+		}
+	}
+
+	assert.Error(t, (&atk.Config{Proxy: "http://"}).Validate())
+	assert.Error(t, (&atk.Config{ClientCert: "client.pem"}).Validate())
+}
+
+func TestLoadConfigTLS(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv(atk.CABundleEnvVar, "/etc/pki/ca.pem")
+	t.Setenv(atk.ProxyEnvVar, "http://proxy:3128")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("clientCert: client.pem\nclientKey: client-key.pem\nnoProxy: .local\n"), 0644))
+
+	cfg, err := atk.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/pki/ca.pem", cfg.CABundle)
+	assert.Equal(t, "http://proxy:3128", cfg.Proxy)
+	assert.Equal(t, ".local", cfg.NoProxy)
+	assert.Equal(t, "client.pem", cfg.ClientCert)
+}
+
+// writeClientCert writes a self-signed client certificate and its key.
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "atk"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func TestConfigHTTPClientTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	certFile, keyFile := writeClientCert(t, dir)
+
+	// The CA of the server is not trusted without the bundle.
+	client, err := (&atk.Config{}).HTTPClient(5 * time.Second)
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	// The server requires a client certificate.
+	client, err = (&atk.Config{CABundle: bundle}).HTTPClient(5 * time.Second)
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	client, err = (&atk.Config{CABundle: bundle, ClientCert: certFile, ClientKey: keyFile}).HTTPClient(5 * time.Second)
+	require.NoError(t, err)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	_, err = (&atk.Config{CABundle: certFile + ".missing"}).TLSConfig()
+	assert.Error(t, err)
+}
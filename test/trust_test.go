@@ -0,0 +1,85 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustPolicyConfirmsUntrustedModule(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	module := atktest.Manifest("untrusted")
+	module.Specifications.Hooks = atk.HookInfo{}
+	module.Specifications.Lifecycle.Deploy.Volumes = []atk.VolumeInfo{{Name: "/home/me", MountPath: "/home"}}
+	var requests []atk.TrustRequest
+	policy := atk.TrustPolicyFunc(func(ctx *atk.RunContext, req atk.TrustRequest) (bool, error) {
+		requests = append(requests, req)
+		return true, nil
+	})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner),
+		atk.WithManifestSource("/tmp/modules/untrusted.yaml"), atk.WithTrustPolicy(policy, "/home/me/modules"))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+	deploy := requests[1]
+	assert.Equal(t, "untrusted", deploy.Module)
+	assert.Equal(t, "/tmp/modules/untrusted.yaml", deploy.Source)
+	assert.Equal(t, "untrusted-deploy", deploy.Image)
+	assert.Equal(t, []atk.VolumeInfo{{Name: "/home/me", MountPath: "/home"}}, deploy.Volumes)
+	assert.Contains(t, deploy.EnvNames, atk.RunIDEnvVar)
+	assert.Equal(t, "module untrusted will run untrusted-deploy with access to /home/me", deploy.String())
+
+	// The images that were confirmed are not asked for again.
+	_, err = deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Len(t, requests, 3)
+}
+
+func TestTrustPolicyRejectsUntrustedModule(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	module := atktest.Manifest("untrusted")
+	module.Specifications.Hooks = atk.HookInfo{}
+	policy := atk.TrustPolicyFunc(func(ctx *atk.RunContext, req atk.TrustRequest) (bool, error) {
+		return false, nil
+	})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithTrustPolicy(policy))
+
+	_, err := deployment.Deploy(runCtx)
+	var untrusted *atk.UntrustedModuleError
+	require.ErrorAs(t, err, &untrusted)
+	assert.Equal(t, "untrusted-pre-deploy", untrusted.Image)
+	assert.Empty(t, runner.Calls())
+}
+
+func TestTrustedSourceSkipsPolicy(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	module := atktest.Manifest("trusted")
+	module.Specifications.Hooks = atk.HookInfo{}
+	policy := atk.TrustPolicyFunc(func(ctx *atk.RunContext, req atk.TrustRequest) (bool, error) {
+		t.Fatal("the policy is not consulted for a trusted manifest")
+		return false, nil
+	})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner),
+		atk.WithManifestSource("https://modules.example.com/trusted/manifest.yaml"),
+		atk.WithTrustPolicy(policy, "https://modules.example.com/"))
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Len(t, runner.Calls(), 3)
+}
+
+func TestIsTrustedSource(t *testing.T) {
+	trusted := []string{"/home/me/modules", "https://modules.example.com/"}
+	assert.True(t, atk.IsTrustedSource("/home/me/modules", trusted))
+	assert.True(t, atk.IsTrustedSource("/home/me/modules/vpc/manifest.yaml", trusted))
+	assert.True(t, atk.IsTrustedSource("https://modules.example.com/vpc", trusted))
+	assert.False(t, atk.IsTrustedSource("/home/me/modules-evil/manifest.yaml", trusted))
+	assert.False(t, atk.IsTrustedSource("", trusted))
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func invalidResponse(t *testing.T) string {
+	event := atk.NewValidateResponseEvent("mymodule", atk.ValidateResponseData{
+		Status:   "ERROR",
+		Messages: []string{"Variable 'TF_VAR_cluster_api' is invalid."},
+		Variables: []atk.VariableValidation{
+			{Name: "TF_VAR_cloud_provider", Valid: true},
+			{Name: "TF_VAR_cluster_api", Valid: false, Message: "must be a URL"},
+		},
+	})
+	buf := new(bytes.Buffer)
+	assert.NoError(t, atk.WriteEvent(event, buf))
+	return buf.String()
+}
+
+func TestValidateSendsRequest(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	runCtx, outbuff, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	result, err := deployment.Validate(runCtx, atk.EventData{
+		Variables: []atk.EventDataVarInfo{{Name: "TF_VAR_cloud_provider", Value: "aws"}},
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, result.IsValid())
+	assert.Equal(t, "", outbuff.String())
+	atktest.AssertRunOrder(t, runner, "mymodule-validate")
+	in := runner.Calls()[0].In
+	atktest.AssertEventType(t, in, atk.ValidateHookRequestEvent)
+	atktest.AssertVariables(t, in, "TF_VAR_cloud_provider")
+}
+
+func TestValidateInvalidVariables(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-validate", atktest.Response{Out: invalidResponse(t), ExitCode: atk.HookExitInvalid})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	result, err := deployment.Validate(runCtx, atk.EventData{})
+
+	assert.NoError(t, err)
+	assert.False(t, runCtx.IsErrored())
+	assert.Equal(t, atk.ValidationInvalid, result.Status)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, []string{"Variable 'TF_VAR_cluster_api' is invalid."}, result.Messages)
+	assert.Equal(t, []atk.VariableValidation{
+		{Name: "TF_VAR_cloud_provider", Valid: true},
+		{Name: "TF_VAR_cluster_api", Valid: false, Message: "must be a URL"},
+	}, result.Variables)
+}
+
+func TestValidateHookFailed(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-validate", atktest.Response{ExitCode: 125})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	result, err := deployment.Validate(runCtx, atk.EventData{})
+
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	assert.True(t, runCtx.IsErrored())
+}
+
+func TestValidateWrongResponseType(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-validate", atktest.Response{Out: atktest.ListResponse})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	_, err := deployment.Validate(runCtx, atk.EventData{})
+
+	assert.Error(t, err)
+}
+
+func TestDeployValidatesVariables(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner),
+		atk.WithVariables(atk.EventDataVarInfo{Name: "TF_VAR_cloud_provider", Default: "fyre"}))
+
+	result, err := deployment.Deploy(runCtx)
+
+	assert.NoError(t, err)
+	assert.True(t, result.Succeeded())
+	assert.True(t, result.Validation.IsValid())
+	atktest.AssertRunOrder(t, runner, "mymodule-get-state", "mymodule-list", "mymodule-validate", "mymodule-pre-deploy", "mymodule-deploy", "mymodule-post-deploy")
+	in := runner.Calls()[2].In
+	atktest.AssertEventType(t, in, atk.ValidateHookRequestEvent)
+	assert.Contains(t, in, `"value":"fyre"`)
+}
+
+func TestDeployFailsValidation(t *testing.T) {
+	runner := atktest.NewFakeRunner().
+		On("mymodule-validate", atktest.Response{Out: invalidResponse(t), ExitCode: atk.HookExitInvalid})
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner))
+
+	result, err := deployment.Deploy(runCtx)
+
+	var invalid *atk.ValidationFailedError
+	if assert.ErrorAs(t, err, &invalid) {
+		assert.Equal(t, atk.ValidationInvalid, invalid.Result.Status)
+	}
+	assert.EqualError(t, err, "validation of module mymodule failed: Variable 'TF_VAR_cluster_api' is invalid.; variable TF_VAR_cluster_api: must be a URL")
+	assert.Equal(t, atk.Errored, deployment.State())
+	assert.Equal(t, atk.Configured, result.FailedState)
+	assert.Equal(t, invalid.Result, result.Validation)
+	atktest.AssertNotRan(t, runner, "mymodule-pre-deploy")
+}
@@ -0,0 +1,65 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVerbosity(t *testing.T) {
+	v, err := atk.ParseVerbosity("Silent")
+	require.NoError(t, err)
+	assert.Equal(t, atk.VerbositySilent, v)
+	v, err = atk.ParseVerbosity("debug")
+	require.NoError(t, err)
+	assert.Equal(t, atk.VerbosityDebug, v)
+	_, err = atk.ParseVerbosity("loud")
+	assert.Error(t, err)
+}
+
+func TestPullProgressFilter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	filter := atk.NewPullProgressFilter(buf)
+	filter.Write([]byte("Trying to pull quay.io/example/deployer:latest...\nGetting image source signatures\nCopying blob sha256:1234 done\n"))
+	filter.Write([]byte("Copying config sha256:5678 done\nWriting manifest to image destination\nStoring signatures\nterraform: "))
+	filter.Write([]byte("applying\nError: no credentials"))
+	assert.Equal(t, "terraform: applying\n", buf.String())
+	require.NoError(t, filter.Flush())
+	assert.Equal(t, "terraform: applying\nError: no credentials", buf.String())
+}
+
+func TestRunImagePullProgress(t *testing.T) {
+	script := "echo 'Trying to pull myimage...' >&2; echo 'failed to connect' >&2"
+	runCtx, _, errbuff, _ := newTestRunContext()
+	runner := atk.NewLocalModuleRunner(t.TempDir())
+	require.NoError(t, runner.RunImage(runCtx, atk.ImageInfo{Command: []string{"sh", "-c", script}}))
+	assert.Equal(t, "failed to connect\n", errbuff.String())
+
+	runCtx, _, errbuff, _ = newTestRunContext()
+	runCtx.Verbosity = atk.VerbosityDebug
+	require.NoError(t, runner.RunImage(runCtx, atk.ImageInfo{Command: []string{"sh", "-c", script}}))
+	assert.Equal(t, "Trying to pull myimage...\nfailed to connect\n", errbuff.String())
+}
+
+func TestDeploySilent(t *testing.T) {
+	runCtx, outbuff, _, hook := newTestRunContext()
+	runCtx.Verbosity = atk.VerbositySilent
+	module := atktest.Manifest("mymodule")
+	// The validate hook is not run, as it does not write a response.
+	module.Specifications.Hooks.Validate = atk.ImageInfo{}
+	runner := &atk.CliModuleRunner{PodmanCliCommandBuilder: *atk.NewPodmanCliCommandBuilder(&atk.CliParts{Path: "echo"})}
+	deployment := atk.NewDeployableModule(runCtx, module, atk.WithRunner(runner), atk.WithCapturedOutput(0))
+	defer deployment.CloseOutputs()
+
+	_, err := deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.Empty(t, outbuff.String())
+	for _, entry := range hook.AllEntries() {
+		assert.NotContains(t, entry.Message, "running command")
+	}
+	assert.Contains(t, deployment.Output(atk.Deploying).Stdout.String(), "mymodule-deploy")
+}
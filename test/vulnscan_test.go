@@ -0,0 +1,116 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/cloud-native-toolkit/atkmod/atktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const trivyReport = `{
+  "Results": [
+    {
+      "Target": "mymodule-deploy (alpine 3.16)",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2022-0001", "PkgName": "openssl", "InstalledVersion": "1.1.1", "FixedVersion": "1.1.2", "Severity": "HIGH"},
+        {"VulnerabilityID": "CVE-2022-0002", "PkgName": "zlib", "InstalledVersion": "1.2.11", "Severity": "LOW"}
+      ]
+    }
+  ]
+}`
+
+const grypeReport = `{
+  "matches": [
+    {
+      "vulnerability": {"id": "CVE-2022-0003", "severity": "Critical", "fix": {"versions": ["2.0.1"]}},
+      "artifact": {"name": "busybox", "version": "1.35.0"}
+    }
+  ]
+}`
+
+// reportCommand returns a command that writes the report, in place of the
+// scanner.
+func reportCommand(t *testing.T, report string) []string {
+	path := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, os.WriteFile(path, []byte(report), 0600))
+	return []string{"sh", "-c", "cat " + path}
+}
+
+func TestTrivyScanner(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	scanner := &atk.TrivyScanner{Command: reportCommand(t, trivyReport)}
+
+	vulns, err := scanner.ScanImage(runCtx, "mymodule-deploy")
+	require.NoError(t, err)
+	assert.Equal(t, []atk.Vulnerability{
+		{ID: "CVE-2022-0001", Package: "openssl", InstalledVersion: "1.1.1", FixedVersion: "1.1.2", Severity: atk.VulnHigh},
+		{ID: "CVE-2022-0002", Package: "zlib", InstalledVersion: "1.2.11", Severity: atk.VulnLow},
+	}, vulns)
+}
+
+func TestGrypeScanner(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	scanner := &atk.GrypeScanner{Command: reportCommand(t, grypeReport)}
+
+	vulns, err := scanner.ScanImage(runCtx, "mymodule-deploy")
+	require.NoError(t, err)
+	assert.Equal(t, []atk.Vulnerability{
+		{ID: "CVE-2022-0003", Package: "busybox", InstalledVersion: "1.35.0", FixedVersion: "2.0.1", Severity: atk.VulnCritical},
+	}, vulns)
+}
+
+// fakeVulnScanner reports the same vulnerabilities for the deploy image.
+type fakeVulnScanner struct {
+	scanned []string
+}
+
+func (s *fakeVulnScanner) ScanImage(ctx *atk.RunContext, image string) ([]atk.Vulnerability, error) {
+	s.scanned = append(s.scanned, image)
+	if image != "mymodule-deploy" {
+		return nil, nil
+	}
+	return []atk.Vulnerability{
+		{ID: "CVE-2022-0002", Severity: atk.VulnLow},
+		{ID: "CVE-2022-0001", Severity: atk.VulnHigh},
+	}, nil
+}
+
+func TestDeployVulnScan(t *testing.T) {
+	runner := atktest.NewFakeRunner()
+	scanner := &fakeVulnScanner{}
+	runCtx, _, _, _ := newTestRunContext()
+	deployment := atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner),
+		atk.WithVulnScan(scanner, atk.VulnHigh))
+
+	result, err := deployment.Deploy(runCtx)
+
+	var vulnerable *atk.VulnerableImagesError
+	require.ErrorAs(t, err, &vulnerable)
+	assert.Equal(t, "images of module mymodule have vulnerabilities of severity HIGH or higher: mymodule-deploy (1)", err.Error())
+	require.Len(t, result.Vulnerabilities, 1)
+	assert.Equal(t, "CVE-2022-0001", result.Vulnerabilities[0].Vulnerabilities[0].ID)
+	assert.Len(t, scanner.scanned, 6)
+	assert.Empty(t, runner.Calls())
+
+	// With a higher threshold, the deployment runs.
+	deployment = atk.NewDeployableModule(runCtx, atktest.Manifest("mymodule"), atk.WithRunner(runner),
+		atk.WithVulnScan(&fakeVulnScanner{}, atk.VulnCritical))
+	result, err = deployment.Deploy(runCtx)
+	require.NoError(t, err)
+	assert.True(t, result.Succeeded())
+}
+
+func TestParseVulnSeverity(t *testing.T) {
+	severity, err := atk.ParseVulnSeverity("high")
+	require.NoError(t, err)
+	assert.Equal(t, atk.VulnHigh, severity)
+	assert.True(t, atk.VulnCritical.AtLeast(severity))
+	assert.False(t, atk.VulnMedium.AtLeast(severity))
+
+	_, err = atk.ParseVulnSeverity("severe")
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"testing"
+
+	atk "github.com/cloud-native-toolkit/atkmod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWazeroCliRunnerBuildFrom(t *testing.T) {
+	runner := atk.NewWazeroCliRunner("/home/myuser/workdir")
+	runner.Path = "/usr/local/bin/wazero"
+
+	actual, err := runner.BuildFrom(atk.ImageInfo{
+		Script: "hooks/list.wasm",
+		Args:   []string{"--verbose"},
+		EnvVars: []atk.EnvVarInfo{
+			{Name: "MYVAR", Value: "thisismyvalue"},
+		},
+		Volumes: []atk.VolumeInfo{
+			{Name: "/tmp/data", MountPath: "/data"},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/local/bin/wazero", "run",
+		"-mount=/home/myuser/workdir:/workspace",
+		"-mount=/tmp/data:/data",
+		"-env=MYVAR=thisismyvalue",
+		"hooks/list.wasm", "--", "--verbose",
+	}, actual)
+}
+
+func TestWazeroCliRunnerNoModule(t *testing.T) {
+	runCtx, _, _, _ := newTestRunContext()
+	runner := atk.NewWazeroCliRunner("")
+	err := runner.RunImage(runCtx, atk.ImageInfo{Image: "myimage"})
+
+	assert.Error(t, err)
+	assert.True(t, runCtx.IsErrored())
+}
+
+func TestWazeroCliRunnerRunImage(t *testing.T) {
+	dir := t.TempDir()
+	// The fake wazero prints its arguments, so the command line can be checked.
+	fake := writeScript(t, dir, "wazero", "echo \"$@\"\n")
+
+	runCtx, outbuff, _, _ := newTestRunContext()
+	runner := atk.NewWazeroCliRunner(dir)
+	runner.Path = fake
+	err := runner.RunImage(runCtx, atk.ImageInfo{Script: "list.wasm", Args: []string{"--verbose"}})
+
+	assert.NoError(t, err)
+	assert.False(t, runCtx.IsErrored())
+	assert.Equal(t, "run -mount="+dir+":/workspace list.wasm -- --verbose\n", outbuff.String())
+}
@@ -0,0 +1,261 @@
+package atkmod
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// The files in a transcript bundle.
+const (
+	TranscriptManifestFile = "manifest.yaml"
+	TranscriptResultFile   = "result.json"
+	TranscriptEventsFile   = "events.jsonl"
+	TranscriptStagesDir    = "stages"
+)
+
+// WithTranscript writes a transcript of each deployment to the given path
+// when it finishes, which is a single thing that can be attached to a
+// support ticket. The transcript has the output and error streams of each
+// lifecycle stage, the manifest, the events emitted by the deployment and
+// the result as JSON. If the path ends with .tar.gz or .tgz, the transcript
+// is a gzipped tar file; if it ends with .tar, a tar file; otherwise, it is a
+// directory.
+//
+// The output of the stages is captured for the transcript. Unless
+// WithCapturedOutput is also used, the captured output is removed once the
+// transcript is written.
+func WithTranscript(path string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.transcript = path
+		m.transcriptEvents = &eventRecorder{}
+		m.sinks = append(m.sinks, m.transcriptEvents)
+	}
+}
+
+// eventRecorder is an EventSink that keeps the events in memory for the
+// transcript.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []*cloudevents.Event
+}
+
+func (r *eventRecorder) Send(ctx context.Context, event *cloudevents.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := event.Clone()
+	r.events = append(r.events, &e)
+	return nil
+}
+
+func (r *eventRecorder) Close() error {
+	return nil
+}
+
+func (r *eventRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+func (r *eventRecorder) writeTo(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	encoder := json.NewEncoder(w)
+	for _, event := range r.events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTranscript writes the transcript of the deployment with the given
+// result to the path, as described by WithTranscript. The output of the
+// stages is only in the transcript if it was captured, and the events only
+// if the deployment was created with WithTranscript.
+func (m *DeployableModule) WriteTranscript(path string, result *DeploymentResult) error {
+	bundle, err := newTranscriptBundle(path)
+	if err != nil {
+		return err
+	}
+	if err := m.writeTranscript(bundle, result); err != nil {
+		bundle.Close()
+		return fmt.Errorf("could not write the transcript %s: %w", path, err)
+	}
+	return bundle.Close()
+}
+
+func (m *DeployableModule) writeTranscript(bundle transcriptBundle, result *DeploymentResult) error {
+	manifest, err := m.module.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := bundle.addBytes(TranscriptManifestFile, manifest); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := bundle.addBytes(TranscriptResultFile, append(content, '\n')); err != nil {
+		return err
+	}
+
+	if m.transcriptEvents != nil {
+		events := new(bytes.Buffer)
+		if err := m.transcriptEvents.writeTo(events); err != nil {
+			return err
+		}
+		if err := bundle.addBytes(TranscriptEventsFile, events.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	for _, state := range append(m.machine.Order(), Cancelled) {
+		output := m.outputs[state]
+		if output == nil {
+			continue
+		}
+		streams := []struct {
+			stream OutputStream
+			buffer *SpoolBuffer
+		}{{Stdout, output.Stdout}, {Stderr, output.Stderr}}
+		for _, s := range streams {
+			name := fmt.Sprintf("%s/%s.%s.log", TranscriptStagesDir, state, s.stream)
+			if err := bundle.addSpool(name, s.buffer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// transcriptBundle is the directory or the tar file of a transcript.
+type transcriptBundle interface {
+	addBytes(name string, content []byte) error
+	addSpool(name string, buffer *SpoolBuffer) error
+	Close() error
+}
+
+func newTranscriptBundle(path string) (transcriptBundle, error) {
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return newTarBundle(path, true)
+	case strings.HasSuffix(path, ".tar"):
+		return newTarBundle(path, false)
+	default:
+		if err := os.MkdirAll(filepath.Join(path, TranscriptStagesDir), 0700); err != nil {
+			return nil, err
+		}
+		return dirBundle(path), nil
+	}
+}
+
+// dirBundle writes the files of the transcript to a directory.
+type dirBundle string
+
+func (d dirBundle) addBytes(name string, content []byte) error {
+	return os.WriteFile(filepath.Join(string(d), filepath.FromSlash(name)), content, 0600)
+}
+
+func (d dirBundle) addSpool(name string, buffer *SpoolBuffer) error {
+	r, err := buffer.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.OpenFile(filepath.Join(string(d), filepath.FromSlash(name)), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (d dirBundle) Close() error {
+	return nil
+}
+
+// tarBundle writes the files of the transcript to a tar file, which is
+// optionally gzipped.
+type tarBundle struct {
+	file     *os.File
+	gz       *gzip.Writer
+	tw       *tar.Writer
+	modified time.Time
+}
+
+func newTarBundle(path string, compress bool) (*tarBundle, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	b := &tarBundle{file: f, modified: time.Now()}
+	var w io.Writer = f
+	if compress {
+		b.gz = gzip.NewWriter(f)
+		w = b.gz
+	}
+	b.tw = tar.NewWriter(w)
+	return b, nil
+}
+
+func (b *tarBundle) header(name string, size int64) error {
+	return b.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0600,
+		Size:     size,
+		ModTime:  b.modified,
+	})
+}
+
+func (b *tarBundle) addBytes(name string, content []byte) error {
+	if err := b.header(name, int64(len(content))); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(content)
+	return err
+}
+
+func (b *tarBundle) addSpool(name string, buffer *SpoolBuffer) error {
+	r, err := buffer.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := b.header(name, buffer.Len()); err != nil {
+		return err
+	}
+	_, err = io.Copy(b.tw, r)
+	return err
+}
+
+func (b *tarBundle) Close() error {
+	err := b.tw.Close()
+	if b.gz != nil {
+		if gerr := b.gz.Close(); err == nil {
+			err = gerr
+		}
+	}
+	if ferr := b.file.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package atkmod
+
+import (
+	"time"
+
+	"github.com/cloud-native-toolkit/atkmod/fsm"
+)
+
+// Transition is a change of the state of a deployment, or a notification of
+// a state that was rejected.
+type Transition struct {
+	From State     `json:"from" yaml:"from"`
+	To   State     `json:"to" yaml:"to"`
+	At   time.Time `json:"at" yaml:"at"`
+	// Error is the error that the state was notified with, or the reason
+	// that the transition was rejected.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Rejected is true if the deployment did not move to the state, because
+	// the transition is illegal or a guard rejected it.
+	Rejected bool `json:"rejected,omitempty" yaml:"rejected,omitempty"`
+}
+
+// IllegalTransitionError is the error of a deployment with strict
+// transitions that was notified of a state that its current state cannot
+// move to, such as from Invalid straight to Deployed.
+type IllegalTransitionError = fsm.IllegalTransitionError[State]
+
+// TransitionGuard checks a transition of the deployment before it is made.
+// A guard that returns an error rejects the transition.
+type TransitionGuard func(from State, to State) error
+
+// WithStrictTransitions rejects the transitions that are not in the
+// transition table of the deployment with an IllegalTransitionError. Each
+// state of the execution order can move to the state after it, to itself,
+// and to Errored, TimedOut or Cancelled.
+func WithStrictTransitions() DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.strict = true
+	}
+}
+
+// WithTransitionGuard adds the guard, which is checked for every transition
+// of the deployment, after the guards that were added before it.
+func WithTransitionGuard(guard TransitionGuard) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.guards = append(m.guards, fsm.Guard[State](guard))
+	}
+}
+
+// AllowsTransition returns true if the transition table of the deployment
+// has the transition from the state to the other state.
+func (m *DeployableModule) AllowsTransition(from State, to State) bool {
+	return m.machine.Allows(from, to)
+}
+
+// Transitions returns the transitions of the deployment, in the order that
+// they were made, including the ones that were rejected. The transitions of
+// every run of the deployment are kept, such as when it is resumed.
+func (m *DeployableModule) Transitions() []Transition {
+	m.transitionMu.Lock()
+	defer m.transitionMu.Unlock()
+	return append([]Transition(nil), m.transitions...)
+}
+
+// moved records the transition of the deployment to the state and reports
+// it.
+func (m *DeployableModule) moved(from State, to State, err error) {
+	m.recordTransition(Transition{From: from, To: to}, err)
+	m.updateConditions(err)
+	m.emitStateChange(err)
+}
+
+func (m *DeployableModule) recordTransition(t Transition, err error) {
+	t.At = time.Now().UTC()
+	if err != nil {
+		t.Error = err.Error()
+	}
+	m.transitionMu.Lock()
+	m.transitions = append(m.transitions, t)
+	m.transitionMu.Unlock()
+}
+
+// rejectTransition fails the deployment with the error of a transition to
+// the state that was rejected, so that it does not carry on in a state that
+// it should not be in.
+func (m *DeployableModule) rejectTransition(to State, err error) {
+	m.runCtx.AddError(err)
+	if m.rejected == nil {
+		m.rejected = err
+	}
+	from := m.machine.Current()
+	m.recordTransition(Transition{From: from, To: to, Rejected: true}, err)
+	m.recordTransition(Transition{From: from, To: Errored}, err)
+	m.machine.Restore(Errored, from)
+	m.updateConditions(err)
+	m.emitStateChange(err)
+}
@@ -0,0 +1,174 @@
+package atkmod
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	logger "github.com/sirupsen/logrus"
+)
+
+// parseProxy parses the URL of a proxy, which is an http URL if it has no
+// scheme, as it is for HTTPS_PROXY.
+func parseProxy(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid proxy %q", proxy)
+	}
+	return u, nil
+}
+
+// bypassProxy returns true if the host is in the comma-separated list of
+// hosts and domains, or is a loopback address. An entry of * matches all
+// of the hosts, and an entry matches the host and its subdomains.
+func bypassProxy(host string, noProxy string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(hostname); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case len(entry) == 0:
+		case entry == "*":
+			return true
+		case strings.Contains(entry, ":"):
+			if strings.EqualFold(host, entry) {
+				return true
+			}
+		default:
+			domain := strings.TrimPrefix(entry, ".")
+			name := strings.ToLower(hostname)
+			if name == domain || strings.HasSuffix(name, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyFunc returns the proxy of the requests: Proxy, except for the hosts
+// of NoProxy, or else the proxy of the environment.
+func (c *Config) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if len(c.Proxy) == 0 {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxy, err := parseProxy(c.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	noProxy := c.NoProxy
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Host, noProxy) {
+			return nil, nil
+		}
+		return proxy, nil
+	}, nil
+}
+
+// TLSConfig returns the TLS configuration of the connections to remote
+// servers, which trusts the CAs of the system and of CABundle and
+// authenticates with the client certificate. It returns nil if neither a
+// CA bundle nor a client certificate is configured.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if len(c.CABundle) == 0 && len(c.ClientCert) == 0 {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(c.CABundle) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		content, err := os.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no PEM encoded certificates found in the CA bundle %s", c.CABundle)
+		}
+		cfg.RootCAs = pool
+	}
+	if len(c.ClientCert) > 0 {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Transport returns the transport of the requests to remote servers, which
+// is the default transport with the proxy and the TLS configuration.
+func (c *Config) Transport() (*http.Transport, error) {
+	proxy, err := c.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+// HTTPClient returns a client with the Transport and the timeout.
+func (c *Config) HTTPClient(timeout time.Duration) (*http.Client, error) {
+	transport, err := c.Transport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// NATSOptions returns the options of the NATS client for the TLS
+// configuration, which are used when the server requires TLS.
+func (c *Config) NATSOptions() ([]nats.Option, error) {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil || tlsConfig == nil {
+		return nil, err
+	}
+	return []nats.Option{func(o *nats.Options) error {
+		o.TLSConfig = tlsConfig
+		return nil
+	}}, nil
+}
+
+// newHTTPClient returns the client of the requests to remote servers, such
+// as the registry and the webhooks, for the DefaultConfig. If the
+// configuration cannot be used, the error is logged and the client uses the
+// proxy of the environment only.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	cfg := DefaultConfig()
+	if len(cfg.Proxy) == 0 && len(cfg.CABundle) == 0 && len(cfg.ClientCert) == 0 {
+		return &http.Client{Timeout: timeout}
+	}
+	client, err := cfg.HTTPClient(timeout)
+	if err != nil {
+		logger.Warnf("could not configure the connections to remote servers: %v", err)
+		return &http.Client{Timeout: timeout}
+	}
+	return client
+}
@@ -0,0 +1,157 @@
+package atkmod
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TrustRequest has the details of an image that is about to be run for a
+// module whose manifest is not trusted, for a TrustPolicy to decide on,
+// such as by asking the user.
+type TrustRequest struct {
+	Module    string
+	Namespace string
+	// Source is where the manifest was loaded from, as given to
+	// WithManifestSource, or empty if it is not known.
+	Source  string
+	Image   string
+	Script  string
+	Command []string
+	Args    []string
+	// Volumes are the local directories and files, or named volumes, that
+	// are mounted in the container, including the ones that are added by
+	// the deployment, such as the workspace and the credentials.
+	Volumes []VolumeInfo
+	// EnvNames are the names of the environment variables of the
+	// container. Their values are not given, as they may be secrets.
+	EnvNames []string
+	// Network is the network of the container: none for a hook in the
+	// sandbox, or empty for the default network of the runner.
+	Network string
+}
+
+func (r TrustRequest) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "module %s will run %s", r.Module, Iif(r.Image, r.Script))
+	if len(r.Volumes) > 0 {
+		mounts := make([]string, 0, len(r.Volumes))
+		for _, v := range r.Volumes {
+			mounts = append(mounts, v.Name)
+		}
+		fmt.Fprintf(&b, " with access to %s", strings.Join(mounts, ", "))
+	}
+	return b.String()
+}
+
+// TrustPolicy decides whether the images of a manifest that is not trusted
+// are run. It is consulted before each image is run, and the image is only
+// run if Confirm returns true.
+type TrustPolicy interface {
+	Confirm(ctx *RunContext, req TrustRequest) (bool, error)
+}
+
+// TrustPolicyFunc is a function that is a TrustPolicy.
+type TrustPolicyFunc func(ctx *RunContext, req TrustRequest) (bool, error)
+
+// Confirm calls the function.
+func (f TrustPolicyFunc) Confirm(ctx *RunContext, req TrustRequest) (bool, error) {
+	return f(ctx, req)
+}
+
+// UntrustedModuleError is returned when the TrustPolicy did not confirm an
+// image of a manifest that is not trusted.
+type UntrustedModuleError struct {
+	Module string
+	Source string
+	Image  string
+}
+
+func (e *UntrustedModuleError) Error() string {
+	return fmt.Sprintf("image %s of module %s from %s was not run because the module is not trusted", e.Image, e.Module, Iif(e.Source, "an unknown source"))
+}
+
+// WithManifestSource records where the manifest of the module was loaded
+// from, such as its absolute path or its URL, which is checked against the
+// trusted sources of WithTrustPolicy.
+func WithManifestSource(source string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.source = source
+	}
+}
+
+// WithTrustPolicy consults the policy before each image of the module is
+// run, unless the source of its manifest is one of the trusted sources or is
+// under one of them, such as /home/me/modules or https://modules.example.com.
+// A manifest without a source is not trusted. The policy is asked once for
+// each image and volumes of a deployment. The included modules are trusted
+// if the module that includes them is.
+func WithTrustPolicy(policy TrustPolicy, trusted ...string) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.trustPolicy = policy
+		m.trustedSources = append(m.trustedSources, trusted...)
+	}
+}
+
+// IsTrustedSource returns true if the source is one of the trusted sources,
+// or a path or URL under one of them.
+func IsTrustedSource(source string, trusted []string) bool {
+	if len(source) == 0 {
+		return false
+	}
+	for _, t := range trusted {
+		if len(t) == 0 {
+			continue
+		}
+		if source == t || strings.HasPrefix(source, strings.TrimSuffix(t, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// trustCache has the images that the TrustPolicy confirmed, which are shared
+// by a deployment and the deployments of its includes.
+type trustCache struct {
+	mu        sync.Mutex
+	confirmed map[string]bool
+}
+
+// confirmTrust consults the TrustPolicy of the deployment for the image,
+// which returns an UntrustedModuleError if it was not confirmed.
+func (m *DeployableModule) confirmTrust(ctx *RunContext, img ImageInfo) error {
+	if m.trustPolicy == nil || IsTrustedSource(m.source, m.trustedSources) {
+		return nil
+	}
+	req := TrustRequest{
+		Module:    m.module.Metadata.Name,
+		Namespace: namespaceOf(m.module),
+		Source:    m.source,
+		Image:     img.Image,
+		Script:    img.Script,
+		Command:   img.Command,
+		Args:      img.Args,
+		Volumes:   img.Volumes,
+	}
+	for _, e := range img.EnvVars {
+		req.EnvNames = append(req.EnvNames, e.Name)
+	}
+	if sandbox := sandboxOf(ctx.Context); sandbox != nil {
+		req.Network = Iif(sandbox.Network, "none")
+	}
+	key := fmt.Sprintf("%s|%s|%v", req.Image, req.Script, req.Volumes)
+	m.trust.mu.Lock()
+	defer m.trust.mu.Unlock()
+	if m.trust.confirmed[key] {
+		return nil
+	}
+	ok, err := m.trustPolicy.Confirm(ctx, req)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &UntrustedModuleError{Module: req.Module, Source: req.Source, Image: Iif(req.Image, req.Script)}
+	}
+	m.trust.confirmed[key] = true
+	return nil
+}
@@ -0,0 +1,259 @@
+package atkmod
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// VariableValidation is the result of the validation of a single variable.
+type VariableValidation struct {
+	Name    string `json:"name" yaml:"name"`
+	Valid   bool   `json:"valid" yaml:"valid"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// ValidateResponseData is the data of the event written by the validate hook
+// in response to a ValidateHookRequestEvent.
+type ValidateResponseData struct {
+	// Status is either "OK" or "ERROR".
+	Status    string               `json:"status" yaml:"status"`
+	Messages  []string             `json:"messages,omitempty" yaml:"messages,omitempty"`
+	Variables []VariableValidation `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// Validate runs the validate hook of the module with the given variables.
+// The variables are sent to the hook as a ValidateHookRequestEvent, on
+// standard input or in a file if the hooks asked for it in the Handshake,
+// and the ValidateHookResponseEvent written by the hook is parsed into the
+// result, along with the status from the exit code of the hook. An error is returned only if the hook could not be run or its
+// response could not be understood.
+func (m *DeployableModule) Validate(ctx *RunContext, vars EventData) (*ValidationResult, error) {
+	request := NewValidateRequestEvent(m.Name(), vars)
+	m.setDeploymentExtensions(request)
+	m.emit(request)
+	in := new(bytes.Buffer)
+	if err := WriteEvent(request, in); err != nil {
+		return nil, err
+	}
+	out := new(bytes.Buffer)
+
+	hook := m.GetHook(ValidateHook)
+	prevCtx, prevIn, prevOut, prevErrs := ctx.Context, ctx.In, ctx.Out, len(ctx.Errors)
+	if m.Capabilities().Delivery == DeliverFile {
+		img, cleanup, err := withEventFile(m.module.Specifications.Hooks.Validate, in.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		hook = m.getHookCmd(ValidateHook, img)
+		ctx.In, ctx.Out = nil, out
+	} else {
+		ctx.Context, ctx.In, ctx.Out = withInput(ctx.Context), in, out
+	}
+	hookErr := hook(ctx)
+	ctx.Context, ctx.In, ctx.Out = prevCtx, prevIn, prevOut
+
+	result, err := NewValidationResult(hookErr)
+	if err != nil {
+		return nil, err
+	}
+	// The exit code was understood, so it is reported in the result and not
+	// as an error on the context.
+	ctx.Errors = ctx.Errors[:prevErrs]
+	ctx.Reset()
+
+	raw := append([]byte(nil), out.Bytes()...)
+	if err := parseValidateResponse(out, result); err != nil {
+		return nil, m.hookOutputError(ctx, ValidateHook, raw, err)
+	}
+	return result, nil
+}
+
+type inputContextKey struct{}
+
+// withInput marks the context so that the runners send the input of the
+// RunContext to the image, such as the request event of the validate hook.
+func withInput(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, inputContextKey{}, true)
+}
+
+// sendsInput returns true if the input of the RunContext should be sent to
+// the image.
+func sendsInput(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(inputContextKey{}).(bool)
+	return v
+}
+
+func parseValidateResponse(out io.Reader, result *ValidationResult) error {
+	raw, err := io.ReadAll(out)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	event, err := ParseEventStream(bytes.NewReader(raw), ValidateHookResponseEvent)
+	if err != nil {
+		return fmt.Errorf("could not load validate hook response: %w", err)
+	}
+	var data ValidateResponseData
+	if err := DecodeEventData(event, &data); err != nil {
+		return fmt.Errorf("could not load validate hook response data: %w", err)
+	}
+	result.Messages = data.Messages
+	result.Variables = data.Variables
+	if data.Status == "ERROR" && result.Status == ValidationValid {
+		result.Status = ValidationInvalid
+	}
+	for _, v := range data.Variables {
+		if !v.Valid && result.Status == ValidationValid {
+			result.Status = ValidationInvalid
+		}
+	}
+	return nil
+}
+
+// ValidationFailedError is returned by Deploy when the validate hook of the
+// module reports that the variables of the deployment are not valid. The
+// Result has the messages of the hook and the result of each variable.
+type ValidationFailedError struct {
+	Module string
+	Result *ValidationResult
+}
+
+func (e *ValidationFailedError) Error() string {
+	problems := append([]string{}, e.Result.Messages...)
+	for _, v := range e.Result.Variables {
+		if v.Valid {
+			continue
+		}
+		if len(v.Message) == 0 {
+			problems = append(problems, fmt.Sprintf("variable %s is not valid", v.Name))
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("variable %s: %s", v.Name, v.Message))
+	}
+	if len(problems) == 0 {
+		return fmt.Sprintf("validation of module %s failed with exit code %d", e.Module, e.Result.ExitCode)
+	}
+	return fmt.Sprintf("validation of module %s failed: %s", e.Module, strings.Join(problems, "; "))
+}
+
+// WithVariables sets the variables of the deployment, which are sent to the
+// validate hook before the lifecycle stages run. A variable without a value
+// uses its default, or the default reported by the list hook.
+func WithVariables(vars ...EventDataVarInfo) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.variables = append(m.variables, vars...)
+	}
+}
+
+// Variables returns the variables of the deployment, with the defaults
+// resolved, including those read from the host by ResolveDefaults. The
+// variables reported by the list hook when the deployment was
+// initialized come first, in their order, followed by the other variables
+// given with WithVariables.
+func (m *DeployableModule) Variables() EventData {
+	given := make(map[string]EventDataVarInfo, len(m.variables))
+	for _, v := range m.variables {
+		given[v.Name] = v
+	}
+	var listed []EventDataVarInfo
+	if m.listed != nil {
+		listed = m.listed.Variables
+	}
+	vars := make([]EventDataVarInfo, 0, len(listed)+len(m.variables))
+	seen := make(map[string]bool, len(listed))
+	for _, v := range listed {
+		seen[v.Name] = true
+		if g, ok := given[v.Name]; ok {
+			if len(g.Default) == 0 {
+				g.Default = v.Default
+			}
+			if len(g.Description) == 0 {
+				g.Description = v.Description
+			}
+			g.Sensitive = g.Sensitive || v.Sensitive
+			// The constraints that the list hook reports apply to the
+			// values that are given.
+			if len(g.Type) == 0 {
+				g.Type = v.Type
+			}
+			if len(g.Options) == 0 {
+				g.Options = v.Options
+			}
+			if len(g.Pattern) == 0 {
+				g.Pattern = v.Pattern
+			}
+			g.Required = g.Required || v.Required
+			if len(g.DefaultFrom) == 0 {
+				g.DefaultFrom = v.DefaultFrom
+			}
+			v = g
+		}
+		vars = append(vars, v)
+	}
+	for _, v := range m.variables {
+		if !seen[v.Name] {
+			vars = append(vars, v)
+		}
+	}
+	for idx := range vars {
+		if len(vars[idx].Default) == 0 && len(vars[idx].DefaultFrom) > 0 {
+			vars[idx].Default = m.resolvedDefaults[vars[idx].DefaultFrom]
+		}
+		if len(vars[idx].Value) == 0 {
+			vars[idx].Value = vars[idx].Default
+		}
+	}
+	return EventData{Variables: vars}
+}
+
+// validate resolves the defaults of the variables of the deployment from the
+// host, checks the variables against their constraints
+// and runs the validate hook of the module, if it has one, with them, and
+// moves the deployment to Validated. Variables that do not meet their
+// constraints fail the deployment with a VariableConstraintError before the
+// hook runs. If the hook reports that the variables are invalid, the deployment fails with a
+// ValidationFailedError. An undetermined result is logged, but does not stop
+// the deployment.
+func (m *DeployableModule) validate(ctx *RunContext, notifier Notifier) error {
+	m.ResolveDefaults(ctx)
+	if err := m.checkConstraints(); err != nil {
+		ctx.AddError(err)
+		notifier.Notify(Errored)
+		return err
+	}
+	if m.module.Specifications.Hooks.Validate.Equal(ImageInfo{}) {
+		notifier.Notify(Validated)
+		return nil
+	}
+	errCount := len(ctx.Errors)
+	result, err := m.Validate(ctx, m.Variables())
+	if err != nil {
+		addHookError(ctx, errCount, err)
+		notifier.Notify(Errored)
+		return err
+	}
+	m.validation = result
+	switch result.Status {
+	case ValidationInvalid:
+		err := &ValidationFailedError{Module: m.module.Metadata.Name, Result: result}
+		ctx.AddError(err)
+		notifier.Notify(Errored)
+		return err
+	case ValidationUndetermined:
+		ctx.Log.WithField(RunIDLogField, m.runID).Warnf("the validate hook of module %s could not determine whether the variables are valid", m.module.Metadata.Name)
+	}
+	notifier.Notify(Validated)
+	return nil
+}
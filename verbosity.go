@@ -0,0 +1,149 @@
+package atkmod
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Verbosity controls how much of the command execution reaches the output
+// and error streams of a RunContext.
+type Verbosity int
+
+const (
+	// VerbositySilent does not log the commands that are run, and discards
+	// the output of the lifecycle stages. The output is still captured and
+	// passed to the line callbacks and scanners.
+	VerbositySilent Verbosity = iota - 1
+	// VerbosityNormal logs the commands that are run and writes the output
+	// of the containers, without the progress of podman pulling the images.
+	// It is the zero value.
+	VerbosityNormal
+	// VerbosityDebug also writes the progress of podman pulling the images.
+	VerbosityDebug
+)
+
+func (v Verbosity) String() string {
+	switch v {
+	case VerbositySilent:
+		return "silent"
+	case VerbosityNormal:
+		return "normal"
+	case VerbosityDebug:
+		return "debug"
+	default:
+		return fmt.Sprintf("Verbosity(%d)", int(v))
+	}
+}
+
+// ParseVerbosity returns the Verbosity with the name: silent, normal or
+// debug.
+func ParseVerbosity(name string) (Verbosity, error) {
+	for _, v := range []Verbosity{VerbositySilent, VerbosityNormal, VerbosityDebug} {
+		if strings.EqualFold(name, v.String()) {
+			return v, nil
+		}
+	}
+	return VerbosityNormal, fmt.Errorf("unknown verbosity %q; expected silent, normal or debug", name)
+}
+
+// pullProgressPrefixes are the starts of the lines that podman writes to its
+// error stream while it pulls an image.
+var pullProgressPrefixes = []string{
+	"Resolved \"",
+	"Trying to pull ",
+	"Getting image source signatures",
+	"Copying blob ",
+	"Copying config ",
+	"Writing manifest to image destination",
+	"Storing signatures",
+}
+
+// IsPullProgress returns true if the line is one of the lines of progress
+// that podman writes while it pulls an image.
+func IsPullProgress(line string) bool {
+	line = strings.TrimSpace(line)
+	for _, prefix := range pullProgressPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// LineFilterWriter writes the lines written to it to another writer, except
+// for the lines that the filter drops. A line that is not complete is held
+// until the rest of it is written or until Flush is called.
+type LineFilterWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	drop    func(line string) bool
+	pending []byte
+}
+
+// NewLineFilterWriter returns a LineFilterWriter that writes to w the lines
+// for which drop returns false.
+func NewLineFilterWriter(w io.Writer, drop func(line string) bool) *LineFilterWriter {
+	return &LineFilterWriter{w: w, drop: drop}
+}
+
+// NewPullProgressFilter returns a LineFilterWriter that drops the progress of
+// podman pulling an image.
+func NewPullProgressFilter(w io.Writer) *LineFilterWriter {
+	return NewLineFilterWriter(w, IsPullProgress)
+}
+
+func (f *LineFilterWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = append(f.pending, p...)
+	for {
+		idx := bytes.IndexByte(f.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := f.pending[:idx+1]
+		if !f.drop(string(line)) {
+			if _, err := f.w.Write(line); err != nil {
+				return len(p), err
+			}
+		}
+		f.pending = f.pending[idx+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the line that is not complete, unless the filter drops it.
+func (f *LineFilterWriter) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	line := f.pending
+	f.pending = nil
+	if len(line) == 0 || f.drop(string(line)) {
+		return nil
+	}
+	_, err := f.w.Write(line)
+	return err
+}
+
+// logCommand logs the command that is about to run, unless the context is
+// silent.
+func (c *RunContext) logCommand(format string, args ...interface{}) {
+	if c.Verbosity == VerbositySilent {
+		return
+	}
+	c.Logger().Info(c.mask(fmt.Sprintf(format, args...)))
+}
+
+// errWriter returns the writer for the error stream of a command, which
+// filters out the progress of pulling images unless it is wanted. The
+// returned function must be called once the command has exited.
+func (c *RunContext) errWriter() (io.Writer, func()) {
+	if c.Err == nil || c.Verbosity >= VerbosityDebug || c.ShowPullProgress {
+		return c.Err, func() {}
+	}
+	filter := NewPullProgressFilter(c.Err)
+	return filter, func() { filter.Flush() }
+}
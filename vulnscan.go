@@ -0,0 +1,274 @@
+package atkmod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// VulnSeverity is the severity of a vulnerability found in an image.
+type VulnSeverity string
+
+const (
+	VulnUnknown  VulnSeverity = "UNKNOWN"
+	VulnLow      VulnSeverity = "LOW"
+	VulnMedium   VulnSeverity = "MEDIUM"
+	VulnHigh     VulnSeverity = "HIGH"
+	VulnCritical VulnSeverity = "CRITICAL"
+)
+
+// The images of the scanners used when the scanner is not installed.
+const (
+	DefaultTrivyImage = "docker.io/aquasec/trivy:latest"
+	DefaultGrypeImage = "docker.io/anchore/grype:latest"
+)
+
+var vulnSeverityRanks = map[VulnSeverity]int{
+	VulnUnknown:  0,
+	VulnLow:      1,
+	VulnMedium:   2,
+	VulnHigh:     3,
+	VulnCritical: 4,
+}
+
+// ParseVulnSeverity parses a severity such as high or CRITICAL.
+func ParseVulnSeverity(s string) (VulnSeverity, error) {
+	severity := VulnSeverity(strings.ToUpper(strings.TrimSpace(s)))
+	if _, ok := vulnSeverityRanks[severity]; !ok {
+		return "", fmt.Errorf("unknown severity %q; use low, medium, high or critical", s)
+	}
+	return severity, nil
+}
+
+// AtLeast returns true if the severity is the same as or worse than the
+// threshold. Severities that the scanner reports but that are not known are
+// treated as UNKNOWN.
+func (s VulnSeverity) AtLeast(threshold VulnSeverity) bool {
+	return vulnSeverityRanks[s] >= vulnSeverityRanks[threshold]
+}
+
+// Vulnerability is a single vulnerability found in an image.
+type Vulnerability struct {
+	ID               string       `json:"id" yaml:"id"`
+	Package          string       `json:"package,omitempty" yaml:"package,omitempty"`
+	InstalledVersion string       `json:"installedVersion,omitempty" yaml:"installedVersion,omitempty"`
+	FixedVersion     string       `json:"fixedVersion,omitempty" yaml:"fixedVersion,omitempty"`
+	Severity         VulnSeverity `json:"severity" yaml:"severity"`
+}
+
+func (v Vulnerability) String() string {
+	return fmt.Sprintf("%s (%s) in %s %s", v.ID, v.Severity, v.Package, v.InstalledVersion)
+}
+
+// VulnScanner scans an image for vulnerabilities.
+type VulnScanner interface {
+	ScanImage(ctx *RunContext, image string) ([]Vulnerability, error)
+}
+
+// ImageScanReport is the vulnerabilities of an image at or above the
+// severity threshold of the deployment.
+type ImageScanReport struct {
+	Image           string          `json:"image" yaml:"image"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities,omitempty" yaml:"vulnerabilities,omitempty"`
+}
+
+// VulnerableImagesError is returned by Deploy when images of the module have
+// vulnerabilities at or above the severity threshold.
+type VulnerableImagesError struct {
+	Module    string
+	Threshold VulnSeverity
+	Reports   []ImageScanReport
+}
+
+func (e *VulnerableImagesError) Error() string {
+	images := make([]string, 0, len(e.Reports))
+	for _, r := range e.Reports {
+		images = append(images, fmt.Sprintf("%s (%d)", r.Image, len(r.Vulnerabilities)))
+	}
+	return fmt.Sprintf("images of module %s have vulnerabilities of severity %s or higher: %s", e.Module, e.Threshold, strings.Join(images, ", "))
+}
+
+// WithVulnScan scans each of the images of the module with the scanner
+// before anything runs, and fails the deployment with a
+// VulnerableImagesError if any of them has vulnerabilities of the threshold
+// severity or higher. If the scanner fails, so does the deployment, as the
+// images cannot be shown to be safe.
+func WithVulnScan(scanner VulnScanner, threshold VulnSeverity) DeployableModuleOption {
+	return func(m *DeployableModule) {
+		m.vulnScanner = scanner
+		m.vulnThreshold = threshold
+	}
+}
+
+// ScanImages scans each of the images of the module with the scanner of the
+// deployment and returns the reports of the images that have vulnerabilities
+// at or above the threshold. A VulnerableImagesError is returned along with
+// the reports if there are any.
+func (m *DeployableModule) ScanImages(ctx *RunContext) ([]ImageScanReport, error) {
+	if m.vulnScanner == nil {
+		return nil, nil
+	}
+	log := ctx.Log.WithField(RunIDLogField, m.runID)
+	reports := make([]ImageScanReport, 0)
+	for _, image := range m.Images() {
+		vulns, err := m.vulnScanner.ScanImage(ctx, image)
+		if err != nil {
+			return reports, fmt.Errorf("could not scan image %s: %w", image, err)
+		}
+		report := ImageScanReport{Image: image}
+		for _, v := range vulns {
+			if v.Severity.AtLeast(m.vulnThreshold) {
+				report.Vulnerabilities = append(report.Vulnerabilities, v)
+			}
+		}
+		log.Debugf("image %s has %d vulnerabilities, %d of severity %s or higher", image, len(vulns), len(report.Vulnerabilities), m.vulnThreshold)
+		if len(report.Vulnerabilities) > 0 {
+			sort.SliceStable(report.Vulnerabilities, func(i, j int) bool {
+				return vulnSeverityRanks[report.Vulnerabilities[i].Severity] > vulnSeverityRanks[report.Vulnerabilities[j].Severity]
+			})
+			reports = append(reports, report)
+		}
+	}
+	if len(reports) > 0 {
+		return reports, &VulnerableImagesError{Module: m.module.Metadata.Name, Threshold: m.vulnThreshold, Reports: reports}
+	}
+	return reports, nil
+}
+
+// TrivyScanner scans the images with trivy.
+type TrivyScanner struct {
+	// Command runs trivy, such as ["trivy"] or a podman run of the trivy
+	// image. The arguments of the scan are added to it.
+	Command []string
+}
+
+// NewTrivyScanner creates a TrivyScanner that runs trivy if it is installed,
+// or else the DefaultTrivyImage with podman.
+func NewTrivyScanner() *TrivyScanner {
+	return &TrivyScanner{Command: scannerCommand("trivy", DefaultTrivyImage)}
+}
+
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string
+			PkgName          string
+			InstalledVersion string
+			FixedVersion     string
+			Severity         string
+		}
+	}
+}
+
+// ScanImage runs trivy image on the image and returns its vulnerabilities.
+func (s *TrivyScanner) ScanImage(ctx *RunContext, image string) ([]Vulnerability, error) {
+	out, err := runScanner(ctx, s.Command, "image", "--quiet", "--format", "json", image)
+	if err != nil {
+		return nil, err
+	}
+	var report trivyReport
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("could not read the trivy report: %w", err)
+	}
+	var vulns []Vulnerability
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			vulns = append(vulns, Vulnerability{
+				ID:               v.VulnerabilityID,
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         VulnSeverity(strings.ToUpper(v.Severity)),
+			})
+		}
+	}
+	return vulns, nil
+}
+
+// GrypeScanner scans the images with grype.
+type GrypeScanner struct {
+	// Command runs grype, such as ["grype"] or a podman run of the grype
+	// image. The arguments of the scan are added to it.
+	Command []string
+}
+
+// NewGrypeScanner creates a GrypeScanner that runs grype if it is installed,
+// or else the DefaultGrypeImage with podman.
+func NewGrypeScanner() *GrypeScanner {
+	return &GrypeScanner{Command: scannerCommand("grype", DefaultGrypeImage)}
+}
+
+type grypeReport struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID       string `json:"id"`
+			Severity string `json:"severity"`
+			Fix      struct {
+				Versions []string `json:"versions"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"artifact"`
+	} `json:"matches"`
+}
+
+// ScanImage runs grype on the image and returns its vulnerabilities.
+func (s *GrypeScanner) ScanImage(ctx *RunContext, image string) ([]Vulnerability, error) {
+	out, err := runScanner(ctx, s.Command, image, "-o", "json", "-q")
+	if err != nil {
+		return nil, err
+	}
+	var report grypeReport
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("could not read the grype report: %w", err)
+	}
+	vulns := make([]Vulnerability, 0, len(report.Matches))
+	for _, match := range report.Matches {
+		vulns = append(vulns, Vulnerability{
+			ID:               match.Vulnerability.ID,
+			Package:          match.Artifact.Name,
+			InstalledVersion: match.Artifact.Version,
+			FixedVersion:     strings.Join(match.Vulnerability.Fix.Versions, ", "),
+			Severity:         VulnSeverity(strings.ToUpper(match.Vulnerability.Severity)),
+		})
+	}
+	return vulns, nil
+}
+
+// scannerCommand returns the command of the scanner if it is installed, or a
+// podman run of its image. The image of the scanner reads the images from
+// their registries, as it cannot see the images of the host.
+func scannerCommand(name string, image string) []string {
+	if path, err := exec.LookPath(name); err == nil {
+		return []string{path}
+	}
+	path, global := NewPodmanCliCommandBuilder(nil).globalArgs()
+	return append(append([]string{path}, global...), "run", "--rm", image)
+}
+
+// runScanner runs the scanner with the arguments and returns its output. The
+// errors of the scanner are written to the error stream of the context.
+func runScanner(ctx *RunContext, command []string, args ...string) ([]byte, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no scanner command")
+	}
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	cmd := exec.CommandContext(parent, command[0], append(append([]string{}, command[1:]...), args...)...)
+	ctx.logCommand("running command: %s", shellJoin(cmd.Args))
+	out := new(bytes.Buffer)
+	cmd.Stdout = out
+	cmd.Stderr = ctx.Err
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
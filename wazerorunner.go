@@ -0,0 +1,78 @@
+package atkmod
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// WazeroCliRunner is an experimental runner that executes hooks compiled to
+// WASI by running them with the wazero command line tool, which must be
+// installed on the host. WASI hooks are sandboxed by the runtime and do not
+// need a container engine, which makes them a lightweight option for small
+// hooks such as list and validate.
+//
+// The Script of the ImageInfo is the path to the compiled .wasm module and
+// the Args are passed to it. The volumes are mounted in the guest at their
+// mount paths, so the workspace is available at /workspace in the same way
+// that it is in a container.
+type WazeroCliRunner struct {
+	// Path is the path to the wazero CLI. If empty, "wazero" from PATH is
+	// used.
+	Path string
+	// Workdir is the local directory mounted as the workspace, if any.
+	Workdir string
+	// ContainerWorkdir is the guest path of the workspace.
+	ContainerWorkdir string
+}
+
+// NewWazeroCliRunner creates a WazeroCliRunner that mounts the given local
+// directory as the workspace and uses the path of wazero in the
+// DefaultConfig.
+func NewWazeroCliRunner(workdir string) *WazeroCliRunner {
+	return &WazeroCliRunner{
+		Path:             DefaultConfig().WazeroPath,
+		Workdir:          workdir,
+		ContainerWorkdir: "/workspace",
+	}
+}
+
+// BuildFrom builds the wazero command line for the WASI module defined in
+// the given ImageInfo.
+func (r *WazeroCliRunner) BuildFrom(info ImageInfo) ([]string, error) {
+	if len(info.Command) > 0 {
+		return nil, errors.New("command is not supported for wasm modules")
+	}
+	if len(strings.TrimSpace(info.Script)) == 0 {
+		return nil, errors.New("no wasm module defined in script")
+	}
+
+	argv := []string{Iif(r.Path, "wazero"), "run"}
+	if len(r.Workdir) > 0 {
+		argv = append(argv, fmt.Sprintf("-mount=%s:%s", r.Workdir, Iif(r.ContainerWorkdir, "/workspace")))
+	}
+	for _, v := range info.Volumes {
+		argv = append(argv, fmt.Sprintf("-mount=%s:%s", v.Name, v.MountPath))
+	}
+	for _, envvar := range info.EnvVars {
+		argv = append(argv, fmt.Sprintf("-env=%s", envvar.String()))
+	}
+	argv = append(argv, info.Script)
+	if len(info.Args) > 0 {
+		argv = append(argv, "--")
+		argv = append(argv, info.Args...)
+	}
+	return argv, nil
+}
+
+// RunImage runs the WASI module that is defined in the provided ImageInfo.
+func (r *WazeroCliRunner) RunImage(ctx *RunContext, info ImageInfo) error {
+	argv, err := r.BuildFrom(info)
+	if err != nil {
+		ctx.AddError(err)
+		return err
+	}
+	ctx.logCommand("running command: %s", strings.Join(argv, " "))
+	return execCmd(ctx, exec.Command(argv[0], argv[1:]...))
+}